@@ -0,0 +1,184 @@
+package aa
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// accountABIJSON covers the eth-infinitism SimpleAccount, its factory and
+// the EntryPoint nonce getter
+const accountABIJSON = `[
+{"type":"function","name":"createAccount","stateMutability":"nonpayable","inputs":[{"name":"owner","type":"address"},{"name":"salt","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"getAddress","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"salt","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"execute","stateMutability":"nonpayable","inputs":[{"name":"dest","type":"address"},{"name":"value","type":"uint256"},{"name":"func","type":"bytes"}],"outputs":[]},
+{"type":"function","name":"executeBatch","stateMutability":"nonpayable","inputs":[{"name":"dest","type":"address[]"},{"name":"func","type":"bytes[]"}],"outputs":[]},
+{"type":"function","name":"getNonce","stateMutability":"view","inputs":[{"name":"sender","type":"address"},{"name":"key","type":"uint192"}],"outputs":[{"name":"nonce","type":"uint256"}]}
+]`
+
+var accountABI = mustParseABI(accountABIJSON)
+
+// Call is one call made by the smart account
+type Call struct {
+	To    common.Address
+	Value *big.Int
+	Data  []byte
+}
+
+// Account is a SimpleAccount owned by a wallet. Its address is known before
+// deployment; the first user operation deploys it through the factory
+type Account struct {
+	Owner      *wallet.Wallet
+	Client     *ethclient.Client
+	Factory    common.Address
+	Salt       *big.Int
+	EntryPoint common.Address
+	Address    common.Address
+}
+
+// NewAccount resolves the counterfactual address of owner's account from the
+// factory on the v0.6 EntryPoint
+func NewAccount(ctx context.Context, owner *wallet.Wallet, factory common.Address, salt *big.Int) (*Account, error) {
+	if salt == nil {
+		salt = new(big.Int)
+	}
+	client, err := owner.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a := &Account{
+		Owner:      owner,
+		Client:     client,
+		Factory:    factory,
+		Salt:       salt,
+		EntryPoint: EntryPointV06,
+	}
+	out, err := a.call(ctx, factory, "getAddress", owner.Address, salt)
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := out[0].(common.Address)
+	if !ok {
+		return nil, errors.New("unexpected getAddress result")
+	}
+	a.Address = addr
+	return a, nil
+}
+
+// Deployed reports whether the account contract exists yet
+func (a *Account) Deployed(ctx context.Context) (bool, error) {
+	code, err := a.Client.CodeAt(ctx, a.Address, nil)
+	if err != nil {
+		return false, err
+	}
+	return len(code) > 0, nil
+}
+
+// InitCode returns the factory call that deploys the account
+func (a *Account) InitCode() ([]byte, error) {
+	data, err := accountABI.Pack("createAccount", a.Owner.Address, a.Salt)
+	if err != nil {
+		return nil, err
+	}
+	return append(a.Factory.Bytes(), data...), nil
+}
+
+// CallData encodes calls for the account: execute for one call, executeBatch
+// for several. SimpleAccount batches cannot carry ETH
+func (a *Account) CallData(calls ...Call) ([]byte, error) {
+	switch len(calls) {
+	case 0:
+		return nil, errors.New("no calls")
+	case 1:
+		return accountABI.Pack("execute", calls[0].To, orZero(calls[0].Value), calls[0].Data)
+	}
+	dest := make([]common.Address, len(calls))
+	funcs := make([][]byte, len(calls))
+	for i, c := range calls {
+		if c.Value != nil && c.Value.Sign() != 0 {
+			return nil, errors.New("batched calls cannot send ETH")
+		}
+		dest[i], funcs[i] = c.To, c.Data
+		if funcs[i] == nil {
+			funcs[i] = []byte{}
+		}
+	}
+	return accountABI.Pack("executeBatch", dest, funcs)
+}
+
+// Nonce returns the account's next EntryPoint nonce
+func (a *Account) Nonce(ctx context.Context) (*big.Int, error) {
+	out, err := a.call(ctx, a.EntryPoint, "getNonce", a.Address, new(big.Int))
+	if err != nil {
+		return nil, err
+	}
+	nonce, ok := out[0].(*big.Int)
+	if !ok {
+		return nil, errors.New("unexpected getNonce result")
+	}
+	return nonce, nil
+}
+
+// UserOp builds an unsigned operation making calls, with init code when the
+// account is not deployed, fees from the owner's gas strategy and a
+// placeholder signature for estimation. Gas limits are left for the
+// paymaster or bundler to fill
+func (a *Account) UserOp(ctx context.Context, calls ...Call) (*UserOperation, error) {
+	callData, err := a.CallData(calls...)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := a.Nonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	op := &UserOperation{
+		Sender:    a.Address,
+		Nonce:     nonce,
+		CallData:  callData,
+		Signature: dummySignature,
+	}
+	deployed, err := a.Deployed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !deployed {
+		if op.InitCode, err = a.InitCode(); err != nil {
+			return nil, err
+		}
+	}
+
+	fees, err := a.Owner.Fees(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	op.MaxPriorityFeePerGas, op.MaxFeePerGas = fees.GasTipCap, fees.GasFeeCap
+	return op, nil
+}
+
+func (a *Account) call(ctx context.Context, to common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := accountABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := a.Client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return accountABI.Unpack(method, result)
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -0,0 +1,156 @@
+package aa
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/clock"
+)
+
+// GasEstimate is a bundler's gas estimate for a user operation
+type GasEstimate struct {
+	CallGasLimit         *hexutil.Big `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big `json:"preVerificationGas"`
+}
+
+// Receipt is the outcome of a bundled user operation
+type Receipt struct {
+	UserOpHash    common.Hash    `json:"userOpHash"`
+	Sender        common.Address `json:"sender"`
+	Paymaster     common.Address `json:"paymaster"`
+	Success       bool           `json:"success"`
+	Reason        string         `json:"reason"`
+	ActualGasCost *hexutil.Big   `json:"actualGasCost"`
+	Receipt       *types.Receipt `json:"receipt"`
+}
+
+// Bundler submits user operations over the ERC-4337 bundler RPC
+type Bundler struct {
+	Client     *rpc.Client
+	EntryPoint common.Address
+	Clock      clock.Clock // paces Wait; nil is the wall clock
+}
+
+// DialBundler connects to a bundler for the v0.6 EntryPoint
+func DialBundler(ctx context.Context, url string) (*Bundler, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundler{Client: client, EntryPoint: EntryPointV06}, nil
+}
+
+// Estimate asks the bundler for the operation's gas limits
+func (b *Bundler) Estimate(ctx context.Context, op *UserOperation) (*GasEstimate, error) {
+	var est GasEstimate
+	if err := b.Client.CallContext(ctx, &est, "eth_estimateUserOperationGas", op, b.EntryPoint); err != nil {
+		return nil, err
+	}
+	return &est, nil
+}
+
+// Send submits a signed operation and returns its hash
+func (b *Bundler) Send(ctx context.Context, op *UserOperation) (common.Hash, error) {
+	var hash common.Hash
+	err := b.Client.CallContext(ctx, &hash, "eth_sendUserOperation", op, b.EntryPoint)
+	return hash, err
+}
+
+// Receipt returns the operation's receipt, or ethereum.NotFound while it is
+// not yet included
+func (b *Bundler) Receipt(ctx context.Context, hash common.Hash) (*Receipt, error) {
+	var r *Receipt
+	if err := b.Client.CallContext(ctx, &r, "eth_getUserOperationReceipt", hash); err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, ethereum.NotFound
+	}
+	return r, nil
+}
+
+// Wait polls until the operation is included
+func (b *Bundler) Wait(ctx context.Context, hash common.Hash, poll time.Duration) (*Receipt, error) {
+	if poll <= 0 {
+		poll = 2 * time.Second
+	}
+	ticker := clock.Or(b.Clock).NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		r, err := b.Receipt(ctx, hash)
+		if err == nil {
+			return r, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
+// Paymaster sponsors user operations, setting paymasterAndData and the gas
+// limits its signature covers
+type Paymaster interface {
+	Sponsor(ctx context.Context, op *UserOperation, entryPoint common.Address) error
+}
+
+// SponsorClient is a paymaster service speaking pm_sponsorUserOperation, as
+// offered by Pimlico, Alchemy and Stackup
+type SponsorClient struct {
+	Client *rpc.Client
+	// Context is passed as the third parameter, such as a sponsorship
+	// policy id; nil sends none
+	Context map[string]interface{}
+}
+
+// DialSponsor connects to a paymaster service
+func DialSponsor(ctx context.Context, url string) (*SponsorClient, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &SponsorClient{Client: client}, nil
+}
+
+// Sponsor asks the service to pay for op and applies its answer
+func (s *SponsorClient) Sponsor(ctx context.Context, op *UserOperation, entryPoint common.Address) error {
+	var res struct {
+		PaymasterAndData     hexutil.Bytes `json:"paymasterAndData"`
+		CallGasLimit         *hexutil.Big  `json:"callGasLimit"`
+		VerificationGasLimit *hexutil.Big  `json:"verificationGasLimit"`
+		PreVerificationGas   *hexutil.Big  `json:"preVerificationGas"`
+	}
+	args := []interface{}{op, entryPoint}
+	if s.Context != nil {
+		args = append(args, s.Context)
+	}
+	if err := s.Client.CallContext(ctx, &res, "pm_sponsorUserOperation", args...); err != nil {
+		return err
+	}
+	op.PaymasterAndData = res.PaymasterAndData
+	for _, f := range []struct {
+		dst **big.Int
+		v   *hexutil.Big
+	}{
+		{&op.CallGasLimit, res.CallGasLimit},
+		{&op.VerificationGasLimit, res.VerificationGasLimit},
+		{&op.PreVerificationGas, res.PreVerificationGas},
+	} {
+		if f.v != nil {
+			*f.dst = f.v.ToInt()
+		}
+	}
+	return nil
+}
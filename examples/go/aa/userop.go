@@ -0,0 +1,149 @@
+package aa
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// EntryPointV06 is the canonical ERC-4337 v0.6 EntryPoint deployment
+var EntryPointV06 = common.HexToAddress("0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789")
+
+// dummySignature has the length of a real ECDSA signature so gas
+// estimation and paymaster checks see realistic calldata
+var dummySignature = append(common.FromHex("0xfffffffffffffffffffffffffffffff0000000000000000000000000000000007aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), 0x1c)
+
+var (
+	uint256Type, _ = abi.NewType("uint256", "", nil)
+	addressType, _ = abi.NewType("address", "", nil)
+	bytes32Type, _ = abi.NewType("bytes32", "", nil)
+)
+
+// UserOperation is an ERC-4337 v0.6 user operation
+type UserOperation struct {
+	Sender               common.Address
+	Nonce                *big.Int
+	InitCode             []byte
+	CallData             []byte
+	CallGasLimit         *big.Int
+	VerificationGasLimit *big.Int
+	PreVerificationGas   *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	PaymasterAndData     []byte
+	Signature            []byte
+}
+
+// userOpJSON is the hex encoding bundlers and paymasters exchange
+type userOpJSON struct {
+	Sender               common.Address `json:"sender"`
+	Nonce                *hexutil.Big   `json:"nonce"`
+	InitCode             hexutil.Bytes  `json:"initCode"`
+	CallData             hexutil.Bytes  `json:"callData"`
+	CallGasLimit         *hexutil.Big   `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big   `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big   `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	PaymasterAndData     hexutil.Bytes  `json:"paymasterAndData"`
+	Signature            hexutil.Bytes  `json:"signature"`
+}
+
+// MarshalJSON encodes the operation as bundler RPCs expect
+func (op *UserOperation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&userOpJSON{
+		Sender:               op.Sender,
+		Nonce:                hexBig(op.Nonce),
+		InitCode:             op.InitCode,
+		CallData:             op.CallData,
+		CallGasLimit:         hexBig(op.CallGasLimit),
+		VerificationGasLimit: hexBig(op.VerificationGasLimit),
+		PreVerificationGas:   hexBig(op.PreVerificationGas),
+		MaxFeePerGas:         hexBig(op.MaxFeePerGas),
+		MaxPriorityFeePerGas: hexBig(op.MaxPriorityFeePerGas),
+		PaymasterAndData:     op.PaymasterAndData,
+		Signature:            op.Signature,
+	})
+}
+
+// UnmarshalJSON decodes the bundler encoding
+func (op *UserOperation) UnmarshalJSON(data []byte) error {
+	var j userOpJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*op = UserOperation{
+		Sender:               j.Sender,
+		Nonce:                j.Nonce.ToInt(),
+		InitCode:             j.InitCode,
+		CallData:             j.CallData,
+		CallGasLimit:         j.CallGasLimit.ToInt(),
+		VerificationGasLimit: j.VerificationGasLimit.ToInt(),
+		PreVerificationGas:   j.PreVerificationGas.ToInt(),
+		MaxFeePerGas:         j.MaxFeePerGas.ToInt(),
+		MaxPriorityFeePerGas: j.MaxPriorityFeePerGas.ToInt(),
+		PaymasterAndData:     j.PaymasterAndData,
+		Signature:            j.Signature,
+	}
+	return nil
+}
+
+// Hash returns the user operation hash the EntryPoint computes, which the
+// account owner signs
+func (op *UserOperation) Hash(entryPoint common.Address, chainID *big.Int) common.Hash {
+	packed, _ := abi.Arguments{
+		{Type: addressType}, {Type: uint256Type}, {Type: bytes32Type}, {Type: bytes32Type},
+		{Type: uint256Type}, {Type: uint256Type}, {Type: uint256Type}, {Type: uint256Type}, {Type: uint256Type},
+		{Type: bytes32Type},
+	}.Pack(
+		op.Sender, orZero(op.Nonce), crypto.Keccak256Hash(op.InitCode), crypto.Keccak256Hash(op.CallData),
+		orZero(op.CallGasLimit), orZero(op.VerificationGasLimit), orZero(op.PreVerificationGas),
+		orZero(op.MaxFeePerGas), orZero(op.MaxPriorityFeePerGas),
+		crypto.Keccak256Hash(op.PaymasterAndData),
+	)
+	enc, _ := abi.Arguments{{Type: bytes32Type}, {Type: addressType}, {Type: uint256Type}}.Pack(
+		crypto.Keccak256Hash(packed), entryPoint, orZero(chainID),
+	)
+	return crypto.Keccak256Hash(enc)
+}
+
+// MaxCost is the most the operation can be charged in wei: the EntryPoint
+// v0.6 prefund, which counts verification gas three times when a paymaster
+// pays for its postOp
+func (op *UserOperation) MaxCost() *big.Int {
+	verification := new(big.Int).Set(orZero(op.VerificationGasLimit))
+	if len(op.PaymasterAndData) > 0 {
+		verification.Mul(verification, big.NewInt(3))
+	}
+	gas := new(big.Int).Add(orZero(op.CallGasLimit), verification)
+	gas.Add(gas, orZero(op.PreVerificationGas))
+	return gas.Mul(gas, orZero(op.MaxFeePerGas))
+}
+
+// Sign sets the signature SimpleAccount-style accounts check: the owner's
+// personal_sign over the operation hash
+func (op *UserOperation) Sign(owner *wallet.Wallet, entryPoint common.Address, chainID *big.Int) error {
+	hash := op.Hash(entryPoint, chainID)
+	sig, err := owner.SignPersonalMessage(hash.Bytes())
+	if err != nil {
+		return err
+	}
+	op.Signature = sig
+	return nil
+}
+
+func hexBig(v *big.Int) *hexutil.Big {
+	return (*hexutil.Big)(orZero(v))
+}
+
+func orZero(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return v
+}
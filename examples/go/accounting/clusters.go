@@ -0,0 +1,279 @@
+package accounting
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/indexer"
+)
+
+// Heuristic names a reason two own addresses were clustered
+type Heuristic string
+
+const (
+	// CommonFunding links addresses whose first ETH came from the same
+	// sender, or one funded the other
+	CommonFunding Heuristic = "common-funding"
+	// Sweep links an address to the own address it repeatedly sends to, as
+	// deposit addresses do with a collector
+	Sweep Heuristic = "sweep"
+)
+
+// Link is the evidence for clustering two addresses
+type Link struct {
+	A, B      common.Address
+	Heuristic Heuristic
+	TxHash    common.Hash // the transfer that formed the link
+}
+
+// Cluster is a group of own addresses reported as one unit
+type Cluster struct {
+	Name      string           // the chart account of its first address, or that address
+	Addresses []common.Address // in address order
+	Links     []Link
+}
+
+// Clusterer groups the chart's own wallets by deterministic heuristics over
+// their transfers. Only addresses in Chart.Wallets are ever clustered;
+// external addresses serve as evidence of common funding but never join a
+// cluster, so the result describes the user's own address set and nothing
+// about third parties
+type Clusterer struct {
+	Chart      *Chart
+	Heuristics []Heuristic // empty applies all
+	MinSweeps  int         // transfers from one address to another that make a sweep; zero is 2
+}
+
+// NewClusterer creates a clusterer applying the given heuristics, all when
+// none are given
+func NewClusterer(chart *Chart, heuristics ...Heuristic) *Clusterer {
+	return &Clusterer{Chart: chart, Heuristics: heuristics}
+}
+
+// Clusters returns every cluster, including single-address ones, ordered by
+// their first address. The same transfers always give the same clusters
+func (c *Clusterer) Clusters(transfers []indexer.Transfer) []Cluster {
+	own := make([]common.Address, 0, len(c.Chart.Wallets))
+	for addr := range c.Chart.Wallets {
+		own = append(own, addr)
+	}
+	sort.Slice(own, func(i, j int) bool { return bytes.Compare(own[i][:], own[j][:]) < 0 })
+	parent := make(map[common.Address]common.Address, len(own))
+	for _, addr := range own {
+		parent[addr] = addr
+	}
+	var find func(common.Address) common.Address
+	find = func(a common.Address) common.Address {
+		if parent[a] != a {
+			parent[a] = find(parent[a])
+		}
+		return parent[a]
+	}
+	var links []Link
+	link := func(a, b common.Address, h Heuristic, tx common.Hash) {
+		if bytes.Compare(a[:], b[:]) > 0 {
+			a, b = b, a
+		}
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		// the lower address roots the cluster so names are stable
+		if bytes.Compare(ra[:], rb[:]) > 0 {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+		links = append(links, Link{A: a, B: b, Heuristic: h, TxHash: tx})
+	}
+
+	ordered := unique(transfers)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].BlockNumber != ordered[j].BlockNumber {
+			return ordered[i].BlockNumber < ordered[j].BlockNumber
+		}
+		return ordered[i].LogIndex < ordered[j].LogIndex
+	})
+	if c.applies(CommonFunding) {
+		c.funding(ordered, parent, link)
+	}
+	if c.applies(Sweep) {
+		c.sweeps(ordered, parent, link)
+	}
+
+	byRoot := make(map[common.Address]*Cluster)
+	var out []*Cluster
+	for _, addr := range own {
+		root := find(addr)
+		cl, ok := byRoot[root]
+		if !ok {
+			cl = &Cluster{Name: c.Chart.Wallets[root]}
+			if cl.Name == "" {
+				cl.Name = root.Hex()
+			}
+			byRoot[root] = cl
+			out = append(out, cl)
+		}
+		cl.Addresses = append(cl.Addresses, addr)
+	}
+	for _, l := range links {
+		cl := byRoot[find(l.A)]
+		cl.Links = append(cl.Links, l)
+	}
+	clusters := make([]Cluster, len(out))
+	for i, cl := range out {
+		clusters[i] = *cl
+	}
+	return clusters
+}
+
+// funding links own addresses by the sender of their first incoming ETH
+func (c *Clusterer) funding(transfers []indexer.Transfer, own map[common.Address]common.Address, link func(a, b common.Address, h Heuristic, tx common.Hash)) {
+	funded := make(map[common.Address]bool)
+	firstFunded := make(map[common.Address]common.Address) // funder to the first address it funded
+	for _, t := range transfers {
+		if !t.IsNative() || t.Amount.Sign() == 0 || funded[t.To] {
+			continue
+		}
+		if _, ok := own[t.To]; !ok {
+			continue
+		}
+		funded[t.To] = true
+		if _, ok := own[t.From]; ok {
+			link(t.From, t.To, CommonFunding, t.TxHash)
+		}
+		if first, ok := firstFunded[t.From]; ok {
+			link(first, t.To, CommonFunding, t.TxHash)
+		} else {
+			firstFunded[t.From] = t.To
+		}
+	}
+}
+
+// sweeps links own addresses that send to the same own address MinSweeps
+// times or more, in any asset
+func (c *Clusterer) sweeps(transfers []indexer.Transfer, own map[common.Address]common.Address, link func(a, b common.Address, h Heuristic, tx common.Hash)) {
+	min := c.MinSweeps
+	if min <= 0 {
+		min = 2
+	}
+	type pair struct{ from, to common.Address }
+	counts := make(map[pair]int)
+	for _, t := range transfers {
+		_, fromOwn := own[t.From]
+		_, toOwn := own[t.To]
+		if !fromOwn || !toOwn || t.From == t.To || t.Amount.Sign() == 0 {
+			continue
+		}
+		p := pair{t.From, t.To}
+		counts[p]++
+		if counts[p] == min {
+			link(t.From, t.To, Sweep, t.TxHash)
+		}
+	}
+}
+
+func (c *Clusterer) applies(h Heuristic) bool {
+	if len(c.Heuristics) == 0 {
+		return true
+	}
+	for _, x := range c.Heuristics {
+		if x == h {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterFlow is a cluster's activity in one asset. Transfers between its
+// own addresses are internal and count toward neither In nor Out
+type ClusterFlow struct {
+	Cluster  string
+	Asset    common.Address
+	In       *big.Int
+	Out      *big.Int
+	Fees     *big.Int // gas paid, in wei; set on the native asset only
+	Internal int      // transfers within the cluster
+}
+
+// Flows summarizes transfers per cluster and asset, in cluster order and
+// then asset order. Like Clusters it accepts the transfers of several
+// addresses indexed separately; a transfer seen twice counts once
+func Flows(clusters []Cluster, transfers []indexer.Transfer) []ClusterFlow {
+	of := make(map[common.Address]int)
+	for i, cl := range clusters {
+		for _, addr := range cl.Addresses {
+			of[addr] = i
+		}
+	}
+	type key struct {
+		cluster int
+		asset   common.Address
+	}
+	flows := make(map[key]*ClusterFlow)
+	get := func(cluster int, asset common.Address) *ClusterFlow {
+		k := key{cluster, asset}
+		f, ok := flows[k]
+		if !ok {
+			f = &ClusterFlow{Cluster: clusters[cluster].Name, Asset: asset, In: new(big.Int), Out: new(big.Int), Fees: new(big.Int)}
+			flows[k] = f
+		}
+		return f
+	}
+	for _, t := range unique(transfers) {
+		from, fromOwn := of[t.From]
+		to, toOwn := of[t.To]
+		if fromOwn && toOwn && from == to {
+			get(from, t.Asset).Internal++
+		} else {
+			if fromOwn {
+				f := get(from, t.Asset)
+				f.Out.Add(f.Out, t.Amount.Base())
+			}
+			if toOwn {
+				f := get(to, t.Asset)
+				f.In.Add(f.In, t.Amount.Base())
+			}
+		}
+		if fromOwn && t.Fee != nil {
+			f := get(from, indexer.NativeAsset)
+			f.Fees.Add(f.Fees, t.Fee.Big())
+		}
+	}
+	keys := make([]key, 0, len(flows))
+	for k := range flows {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].cluster != keys[j].cluster {
+			return keys[i].cluster < keys[j].cluster
+		}
+		return bytes.Compare(keys[i].asset[:], keys[j].asset[:]) < 0
+	})
+	out := make([]ClusterFlow, len(keys))
+	for i, k := range keys {
+		out[i] = *flows[k]
+	}
+	return out
+}
+
+// unique returns the transfers without duplicates, as indexing two own
+// addresses returns the transfers between them twice
+func unique(transfers []indexer.Transfer) []indexer.Transfer {
+	type id struct {
+		tx    common.Hash
+		index uint
+		asset common.Address
+	}
+	seen := make(map[id]bool, len(transfers))
+	out := make([]indexer.Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		k := id{t.TxHash, t.LogIndex, t.Asset}
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
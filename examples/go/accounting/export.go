@@ -0,0 +1,93 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Format is a bookkeeping export format
+type Format string
+
+const (
+	// FormatCSV is one row per journal line, importable by most spreadsheet
+	// based bookkeeping tools
+	FormatCSV Format = "csv"
+	// FormatLedger is plain-text accounting syntax understood by ledger,
+	// hledger and beancount's ledger importer
+	FormatLedger Format = "ledger"
+)
+
+// amountPrecision is the number of decimals written for asset quantities
+const amountPrecision = 18
+
+// valuePrecision is the number of decimals written for fiat values
+const valuePrecision = 2
+
+// Export writes journal entries in the given format
+func Export(w io.Writer, entries []Entry, format Format) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, entries)
+	case FormatLedger:
+		return writeLedger(w, entries)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+func writeCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "tx_hash", "memo", "account", "asset", "debit", "credit", "value", "currency"})
+	for _, e := range entries {
+		for _, l := range e.Lines {
+			cw.Write([]string{
+				e.Date.Format("2006-01-02"),
+				e.TxHash.Hex(),
+				e.Memo,
+				l.Account,
+				l.Asset,
+				ratString(l.Debit, amountPrecision),
+				ratString(l.Credit, amountPrecision),
+				ratString(l.Value, valuePrecision),
+				l.Currency,
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeLedger(w io.Writer, entries []Entry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%s %s\n    ; tx: %s\n", e.Date.Format("2006/01/02"), e.Memo, e.TxHash.Hex()); err != nil {
+			return err
+		}
+		for _, l := range e.Lines {
+			qty := l.Debit
+			if qty == nil {
+				qty = new(big.Rat).Neg(l.Credit)
+			}
+			line := fmt.Sprintf("    %-40s %s %s", l.Account, ratString(qty, amountPrecision), l.Asset)
+			if l.Value != nil && qty.Sign() != 0 {
+				unit := new(big.Rat).Quo(l.Value, new(big.Rat).Abs(qty))
+				line += fmt.Sprintf(" @ %s %s", ratString(unit, valuePrecision), l.Currency)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ratString(r *big.Rat, prec int) string {
+	if r == nil {
+		return ""
+	}
+	return r.FloatString(prec)
+}
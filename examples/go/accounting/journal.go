@@ -0,0 +1,147 @@
+package accounting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/pricing"
+)
+
+// Asset describes how to present an asset in the books
+type Asset struct {
+	Symbol   string
+	Decimals uint8
+}
+
+// Chart maps on-chain addresses to ledger accounts
+type Chart struct {
+	Wallets        map[common.Address]string // own addresses, e.g. "Assets:Crypto:Hot"
+	Counterparties map[common.Address]string // known external parties, e.g. "Liabilities:Payables:Vendor"
+	Assets         map[common.Address]Asset  // assets to book; transfers of others are skipped
+	Income         string                    // credit account for unclassified incoming transfers
+	Expense        string                    // debit account for unclassified outgoing transfers
+	Fees           string                    // debit account for gas fees
+}
+
+// DefaultChart returns a chart with conventional fallback accounts and ETH
+// registered as an asset
+func DefaultChart() *Chart {
+	return &Chart{
+		Wallets:        make(map[common.Address]string),
+		Counterparties: make(map[common.Address]string),
+		Assets:         map[common.Address]Asset{indexer.NativeAsset: {Symbol: "ETH", Decimals: 18}},
+		Income:         "Income:Unclassified",
+		Expense:        "Expenses:Unclassified",
+		Fees:           "Expenses:Fees:Gas",
+	}
+}
+
+// Line is one side of a journal entry
+type Line struct {
+	Account  string
+	Asset    string
+	Debit    *big.Rat // whole units; nil on credit lines
+	Credit   *big.Rat // whole units; nil on debit lines
+	Value    *big.Rat // fiat value; nil when no price was available
+	Currency string
+}
+
+// Entry is a balanced double-entry journal entry for one transfer
+type Entry struct {
+	Date   time.Time
+	TxHash common.Hash
+	Memo   string
+	Lines  []Line
+}
+
+// Journal converts indexed transfers into journal entries
+type Journal struct {
+	Chart    *Chart
+	Prices   pricing.Source // optional; fiat values are left empty without it
+	Currency string
+}
+
+// NewJournal creates a journal builder
+func NewJournal(chart *Chart, prices pricing.Source, currency string) *Journal {
+	return &Journal{Chart: chart, Prices: prices, Currency: currency}
+}
+
+// Entries builds journal entries for the transfers. Transfers between two
+// external addresses and transfers of unregistered assets are skipped. Gas
+// paid by an own wallet is booked as a separate fee entry.
+func (j *Journal) Entries(ctx context.Context, transfers []indexer.Transfer) ([]Entry, error) {
+	native, ok := j.Chart.Assets[indexer.NativeAsset]
+	if !ok {
+		native = Asset{Symbol: "ETH", Decimals: 18}
+	}
+
+	var entries []Entry
+	for i := range transfers {
+		t := &transfers[i]
+		fromWallet, fromOwn := j.Chart.Wallets[t.From]
+		toWallet, toOwn := j.Chart.Wallets[t.To]
+		if !fromOwn && !toOwn {
+			continue
+		}
+		date := time.Unix(int64(t.Timestamp), 0).UTC()
+
+		if asset, ok := j.Chart.Assets[t.Asset]; ok && t.Amount.Sign() > 0 {
+			debit, credit, memo := toWallet, fromWallet, "transfer"
+			switch {
+			case !fromOwn:
+				credit, memo = j.counterparty(t.From, j.Chart.Income), "received from "+t.From.Hex()
+			case !toOwn:
+				debit, memo = j.counterparty(t.To, j.Chart.Expense), "sent to "+t.To.Hex()
+			}
+			e, err := j.entry(ctx, date, t.TxHash, memo, debit, credit, t.Asset, asset, t.Amount.Base())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+
+		if fromOwn && t.Fee != nil && t.Fee.Sign() > 0 {
+			e, err := j.entry(ctx, date, t.TxHash, "gas fee", j.Chart.Fees, fromWallet, indexer.NativeAsset, native, t.Fee.Big())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (j *Journal) counterparty(addr common.Address, fallback string) string {
+	if acct, ok := j.Chart.Counterparties[addr]; ok {
+		return acct
+	}
+	return fallback
+}
+
+func (j *Journal) entry(ctx context.Context, date time.Time, txHash common.Hash, memo, debit, credit string, assetAddr common.Address, asset Asset, amount *big.Int) (Entry, error) {
+	qty := pricing.Units(amount, asset.Decimals)
+
+	var value *big.Rat
+	if j.Prices != nil {
+		v, err := pricing.Value(ctx, j.Prices, assetAddr, amount, asset.Decimals, date)
+		if err != nil && !errors.Is(err, pricing.ErrNoPrice) {
+			return Entry{}, fmt.Errorf("pricing %s: %w", asset.Symbol, err)
+		}
+		value = v
+	}
+
+	return Entry{
+		Date:   date,
+		TxHash: txHash,
+		Memo:   memo,
+		Lines: []Line{
+			{Account: debit, Asset: asset.Symbol, Debit: qty, Value: value, Currency: j.Currency},
+			{Account: credit, Asset: asset.Symbol, Credit: qty, Value: value, Currency: j.Currency},
+		},
+	}, nil
+}
@@ -0,0 +1,260 @@
+package accounting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/pricing"
+)
+
+// Method selects which lots a disposition consumes first
+type Method string
+
+const (
+	FIFO Method = "fifo" // oldest lots first
+	LIFO Method = "lifo" // newest lots first
+	HIFO Method = "hifo" // highest unit cost first
+)
+
+// ErrInsufficientLots is returned when a disposition exceeds the tracked holdings
+var ErrInsufficientLots = errors.New("accounting: disposition exceeds open lots")
+
+// Lot is an acquired quantity of an asset with its cost basis
+type Lot struct {
+	Asset    common.Address
+	Acquired time.Time
+	Quantity *big.Rat // whole units remaining
+	UnitCost *big.Rat // fiat per whole unit
+	TxHash   common.Hash
+}
+
+// Realized is the gain or loss from disposing of (part of) a lot
+type Realized struct {
+	Asset    common.Address
+	Acquired time.Time
+	Disposed time.Time
+	Quantity *big.Rat
+	Cost     *big.Rat
+	Proceeds *big.Rat
+	Gain     *big.Rat
+	TxHash   common.Hash // disposition transaction
+}
+
+// LongTerm reports whether the lot was held for more than a year
+func (r *Realized) LongTerm() bool {
+	return r.Disposed.Sub(r.Acquired) > 365*24*time.Hour
+}
+
+// Unrealized is the paper gain on an open lot at a valuation time
+type Unrealized struct {
+	Lot   Lot
+	Value *big.Rat
+	Gain  *big.Rat
+}
+
+// Lots tracks open tax lots per asset
+type Lots struct {
+	Method Method
+
+	open     map[common.Address][]*Lot
+	realized []Realized
+}
+
+// NewLots creates an empty lot tracker
+func NewLots(method Method) *Lots {
+	return &Lots{Method: method, open: make(map[common.Address][]*Lot)}
+}
+
+// Acquire opens a lot
+func (l *Lots) Acquire(asset common.Address, at time.Time, qty, unitCost *big.Rat, txHash common.Hash) {
+	l.open[asset] = append(l.open[asset], &Lot{
+		Asset:    asset,
+		Acquired: at,
+		Quantity: new(big.Rat).Set(qty),
+		UnitCost: new(big.Rat).Set(unitCost),
+		TxHash:   txHash,
+	})
+}
+
+// Dispose consumes open lots for a sale or spend at the given unit price and
+// records the realized gains
+func (l *Lots) Dispose(asset common.Address, at time.Time, qty, unitPrice *big.Rat, txHash common.Hash) ([]Realized, error) {
+	lots := l.ordered(asset)
+	available := new(big.Rat)
+	for _, lot := range lots {
+		available.Add(available, lot.Quantity)
+	}
+	if available.Cmp(qty) < 0 {
+		return nil, fmt.Errorf("%w: %s of %s", ErrInsufficientLots, qty.FloatString(8), asset.Hex())
+	}
+
+	remaining := new(big.Rat).Set(qty)
+	var out []Realized
+	for _, lot := range lots {
+		if remaining.Sign() == 0 {
+			break
+		}
+		take := new(big.Rat).Set(lot.Quantity)
+		if take.Cmp(remaining) > 0 {
+			take.Set(remaining)
+		}
+		cost := new(big.Rat).Mul(take, lot.UnitCost)
+		proceeds := new(big.Rat).Mul(take, unitPrice)
+		out = append(out, Realized{
+			Asset:    asset,
+			Acquired: lot.Acquired,
+			Disposed: at,
+			Quantity: take,
+			Cost:     cost,
+			Proceeds: proceeds,
+			Gain:     new(big.Rat).Sub(proceeds, cost),
+			TxHash:   txHash,
+		})
+		lot.Quantity.Sub(lot.Quantity, take)
+		remaining.Sub(remaining, take)
+	}
+
+	kept := l.open[asset][:0]
+	for _, lot := range l.open[asset] {
+		if lot.Quantity.Sign() > 0 {
+			kept = append(kept, lot)
+		}
+	}
+	l.open[asset] = kept
+	l.realized = append(l.realized, out...)
+	return out, nil
+}
+
+// Open returns copies of the open lots for an asset in acquisition order
+func (l *Lots) Open(asset common.Address) []Lot {
+	var out []Lot
+	for _, lot := range l.open[asset] {
+		c := *lot
+		c.Quantity = new(big.Rat).Set(lot.Quantity)
+		out = append(out, c)
+	}
+	return out
+}
+
+// Realized returns every realized gain recorded so far
+func (l *Lots) Realized() []Realized {
+	return append([]Realized(nil), l.realized...)
+}
+
+// Unrealized values every open lot at the given time
+func (l *Lots) Unrealized(ctx context.Context, prices pricing.Source, at time.Time) ([]Unrealized, error) {
+	var out []Unrealized
+	for asset, lots := range l.open {
+		price, err := prices.Price(ctx, asset, at)
+		if err != nil {
+			return nil, fmt.Errorf("pricing %s: %w", asset.Hex(), err)
+		}
+		for _, lot := range lots {
+			value := new(big.Rat).Mul(lot.Quantity, price)
+			cost := new(big.Rat).Mul(lot.Quantity, lot.UnitCost)
+			c := *lot
+			c.Quantity = new(big.Rat).Set(lot.Quantity)
+			out = append(out, Unrealized{Lot: c, Value: value, Gain: new(big.Rat).Sub(value, cost)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Lot.Acquired.Before(out[j].Lot.Acquired) })
+	return out, nil
+}
+
+// ordered returns the open lots for asset in consumption order
+func (l *Lots) ordered(asset common.Address) []*Lot {
+	lots := append([]*Lot(nil), l.open[asset]...)
+	switch l.Method {
+	case LIFO:
+		sort.SliceStable(lots, func(i, j int) bool { return lots[i].Acquired.After(lots[j].Acquired) })
+	case HIFO:
+		sort.SliceStable(lots, func(i, j int) bool { return lots[i].UnitCost.Cmp(lots[j].UnitCost) > 0 })
+	default:
+		sort.SliceStable(lots, func(i, j int) bool { return lots[i].Acquired.Before(lots[j].Acquired) })
+	}
+	return lots
+}
+
+// Track replays indexed transfers through the lot tracker at market prices.
+// Transfers into own wallets are acquisitions and transfers out are
+// dispositions, so a swap becomes a disposal of one asset and an acquisition
+// of the other. Moves between own wallets keep their lots; gas paid from own
+// wallets disposes of ETH.
+func (j *Journal) Track(ctx context.Context, lots *Lots, transfers []indexer.Transfer) error {
+	if j.Prices == nil {
+		return errors.New("lot tracking requires a price source")
+	}
+	sorted := append([]indexer.Transfer(nil), transfers...)
+	sort.SliceStable(sorted, func(a, b int) bool { return sorted[a].Timestamp < sorted[b].Timestamp })
+
+	for _, t := range sorted {
+		_, fromOwn := j.Chart.Wallets[t.From]
+		_, toOwn := j.Chart.Wallets[t.To]
+		at := time.Unix(int64(t.Timestamp), 0).UTC()
+
+		if asset, ok := j.Chart.Assets[t.Asset]; ok && fromOwn != toOwn && t.Amount.Sign() > 0 {
+			price, err := j.Prices.Price(ctx, t.Asset, at)
+			if err != nil {
+				return fmt.Errorf("pricing %s at %s: %w", asset.Symbol, at.Format(time.RFC3339), err)
+			}
+			qty := pricing.Units(t.Amount.Base(), asset.Decimals)
+			if toOwn {
+				lots.Acquire(t.Asset, at, qty, price, t.TxHash)
+			} else if _, err := lots.Dispose(t.Asset, at, qty, price, t.TxHash); err != nil {
+				return err
+			}
+		}
+
+		if fromOwn && t.Fee != nil && t.Fee.Sign() > 0 {
+			price, err := j.Prices.Price(ctx, indexer.NativeAsset, at)
+			if err != nil {
+				return fmt.Errorf("pricing gas at %s: %w", at.Format(time.RFC3339), err)
+			}
+			if _, err := lots.Dispose(indexer.NativeAsset, at, pricing.Units(t.Fee.Big(), 18), price, t.TxHash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GainsReport summarizes realized and unrealized gains
+type GainsReport struct {
+	RealizedShortTerm *big.Rat
+	RealizedLongTerm  *big.Rat
+	Unrealized        *big.Rat
+	Realized          []Realized
+	Open              []Unrealized
+}
+
+// Report builds a realized/unrealized gains report valued at the given time
+func (l *Lots) Report(ctx context.Context, prices pricing.Source, at time.Time) (*GainsReport, error) {
+	open, err := l.Unrealized(ctx, prices, at)
+	if err != nil {
+		return nil, err
+	}
+	r := &GainsReport{
+		RealizedShortTerm: new(big.Rat),
+		RealizedLongTerm:  new(big.Rat),
+		Unrealized:        new(big.Rat),
+		Realized:          l.Realized(),
+		Open:              open,
+	}
+	for _, g := range r.Realized {
+		if g.LongTerm() {
+			r.RealizedLongTerm.Add(r.RealizedLongTerm, g.Gain)
+		} else {
+			r.RealizedShortTerm.Add(r.RealizedShortTerm, g.Gain)
+		}
+	}
+	for _, u := range open {
+		r.Unrealized.Add(r.Unrealized, u.Gain)
+	}
+	return r, nil
+}
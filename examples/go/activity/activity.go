@@ -0,0 +1,405 @@
+package activity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/paging"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// span is how many blocks Activity scans before checking whether its page
+// is full
+const span = 500
+
+// Kind is the type of an activity entry
+type Kind string
+
+const (
+	KindNative   Kind = "native"   // ETH sent or received by a transaction
+	KindToken    Kind = "token"    // ERC-20 Transfer event
+	KindInternal Kind = "internal" // ETH moved by a contract call inside a transaction
+	KindContract Kind = "contract" // transaction from the account calling a contract
+	KindMessage  Kind = "message"  // WhisperChain envelope
+)
+
+// Direction is how an entry relates to the account
+type Direction string
+
+const (
+	In   Direction = "in"
+	Out  Direction = "out"
+	Self Direction = "self"
+)
+
+// Call is a contract interaction sent by the account; failed calls are kept
+// since they still cost gas
+type Call struct {
+	To       common.Address `json:"to"`
+	Selector hexutil.Bytes  `json:"selector,omitempty"`
+	Value    *big.Int       `json:"value"`
+	Fee      *big.Int       `json:"fee"`
+	Success  bool           `json:"success"`
+}
+
+// Message is the metadata of an envelope visible without decrypting it
+type Message struct {
+	ID          common.Hash    `json:"id"`
+	Topic       string         `json:"topic"`
+	Sender      common.Address `json:"sender"`
+	Recipient   common.Address `json:"recipient"`
+	Attachments int            `json:"attachments"`
+}
+
+// Entry is one item of an account's timeline. Exactly one of Transfer, Call
+// and Message is set
+type Entry struct {
+	Kind         Kind              `json:"kind"`
+	Direction    Direction         `json:"direction"`
+	Time         time.Time         `json:"time"`
+	BlockNumber  uint64            `json:"blockNumber,omitempty"` // zero for messages
+	TxHash       common.Hash       `json:"txHash,omitempty"`
+	Counterparty common.Address    `json:"counterparty"`
+	Transfer     *indexer.Transfer `json:"transfer,omitempty"` // native, token and internal entries
+	Call         *Call             `json:"call,omitempty"`
+	Message      *Message          `json:"message,omitempty"`
+	Cursor       string            `json:"cursor"` // pass as Filter.Cursor to continue after this entry
+
+	seq uint64 // orders internal transfers within their transaction
+	key string // sort key the cursor encodes
+}
+
+// Filter selects and pages a timeline
+type Filter struct {
+	FromBlock uint64
+	ToBlock   uint64 // zero means the latest block
+	Kinds     []Kind // empty means every kind
+	paging.Request
+}
+
+// Page is one page of a timeline, oldest first
+type Page = paging.Page[Entry]
+
+// MessageSource looks up the envelopes an address sent or received, such as
+// a relay's store
+type MessageSource interface {
+	Envelopes(ctx context.Context, addr common.Address, since, until time.Time) ([]*messaging.Envelope, error)
+}
+
+// Timeline merges every source of an account's activity into one stream
+type Timeline struct {
+	Client   *ethclient.Client
+	Tokens   []common.Address // ERC-20 contracts to include; empty includes every token
+	Messages MessageSource    // optional
+	// Traces finds internal transfers with trace_filter, or on nodes without
+	// it with debug_traceTransaction over the account's own transactions
+	Traces bool
+}
+
+// New creates a timeline
+func New(client *ethclient.Client, messages MessageSource, tokens ...common.Address) *Timeline {
+	return &Timeline{Client: client, Tokens: tokens, Messages: messages, Traces: true}
+}
+
+// scan is what one pass over the block range found
+type scan struct {
+	times   map[uint64]uint64      // block number to timestamp
+	txIndex map[common.Hash]uint64 // position of the account's transactions in their block
+}
+
+// Activity returns a page of the account's activity in the filter's block
+// range, ordered by time and then by position within the block
+func (t *Timeline) Activity(ctx context.Context, addr common.Address, f Filter) (*Page, error) {
+	c, err := paging.NewCollector(f.Request, func(e Entry) string { return e.key })
+	if err != nil {
+		return nil, err
+	}
+	// Resume at the cursor's block and stop once the page is full, so long
+	// histories are never held in memory at once
+	fromBlock := f.FromBlock
+	if after, _ := f.Key(); len(after) >= 25 {
+		if b, err := strconv.ParseUint(after[13:25], 10, 64); err == nil && b > fromBlock {
+			fromBlock = b
+		}
+	}
+	err = t.each(ctx, addr, f, fromBlock, func(e Entry) error {
+		c.Add(e)
+		if c.Full() {
+			return paging.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Page(), nil
+}
+
+// Each calls fn for every entry of the account's activity in the filter's
+// block range, in timeline order, ignoring the filter's paging. Blocks are
+// scanned a span at a time so only one span's entries are held in memory.
+// The scan waits for fn and ends when ctx is done or fn returns an error,
+// paging.ErrStop ending it without one
+func (t *Timeline) Each(ctx context.Context, addr common.Address, f Filter, fn func(Entry) error) error {
+	return t.each(ctx, addr, f, f.FromBlock, fn)
+}
+
+func (t *Timeline) each(ctx context.Context, addr common.Address, f Filter, fromBlock uint64, fn func(Entry) error) error {
+	toBlock := f.ToBlock
+	if toBlock == 0 {
+		head, err := t.Client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		toBlock = head
+	}
+	if toBlock < f.FromBlock {
+		return errors.New("activity: invalid block range")
+	}
+	want := kinds(f.Kinds)
+
+	sc := &scan{times: make(map[uint64]uint64), txIndex: make(map[common.Hash]uint64)}
+	for lo := fromBlock; lo <= toBlock; lo += span {
+		hi := min(lo+span-1, toBlock)
+		entries, err := t.window(ctx, addr, lo, hi, hi == toBlock && f.ToBlock == 0, want, sc)
+		if err != nil {
+			return err
+		}
+		for i := range entries {
+			entries[i].key = sortKey(&entries[i], sc)
+			entries[i].Cursor = paging.Cursor(entries[i].key)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+		if err := paging.Each(ctx, entries, fn); err != nil {
+			return paging.Stopped(err)
+		}
+	}
+	return nil
+}
+
+// window collects every wanted entry in one block span; open extends the
+// span's messages to now
+func (t *Timeline) window(ctx context.Context, addr common.Address, fromBlock, toBlock uint64, open bool, want map[Kind]bool, sc *scan) ([]Entry, error) {
+	var entries []Entry
+	if want[KindNative] || want[KindContract] || want[KindInternal] {
+		found, err := t.scanBlocks(ctx, addr, fromBlock, toBlock, want, sc)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+	if want[KindToken] {
+		transfers, err := indexer.New(t.Client, false, t.Tokens...).Transfers(ctx, addr, fromBlock, toBlock)
+		if err != nil {
+			return nil, err
+		}
+		for i := range transfers {
+			entries = append(entries, transferEntry(KindToken, addr, &transfers[i]))
+		}
+	}
+	if want[KindInternal] && t.Traces {
+		internal, err := t.internalTransfers(ctx, addr, fromBlock, toBlock, sc)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, internal...)
+	}
+	if want[KindMessage] && t.Messages != nil {
+		msgs, err := t.messages(ctx, addr, fromBlock, toBlock, open, sc)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, msgs...)
+	}
+	return entries, nil
+}
+
+// scanBlocks reads every block in range for the account's transactions,
+// producing native transfers and contract calls
+func (t *Timeline) scanBlocks(ctx context.Context, addr common.Address, fromBlock, toBlock uint64, want map[Kind]bool, sc *scan) ([]Entry, error) {
+	chainID, err := t.Client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.LatestSignerForChainID(chainID)
+
+	var entries []Entry
+	for n := fromBlock; n <= toBlock; n++ {
+		block, err := t.Client.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return nil, err
+		}
+		sc.times[n] = block.Time()
+		for i, tx := range block.Transactions() {
+			from, err := types.Sender(signer, tx)
+			if err != nil {
+				return nil, err
+			}
+			to := tx.To()
+			if from != addr && (to == nil || *to != addr) {
+				continue
+			}
+			sc.txIndex[tx.Hash()] = uint64(i)
+			isCall := from == addr && to != nil && len(tx.Data()) > 0
+			isNative := to != nil && tx.Value().Sign() > 0 && !isCall
+			if !(isCall && want[KindContract]) && !(isNative && want[KindNative]) {
+				continue
+			}
+
+			rcpt, err := t.Client.TransactionReceipt(ctx, tx.Hash())
+			if err != nil {
+				return nil, err
+			}
+			feeWei := units.NewWei(rcpt.EffectiveGasPrice).Mul(rcpt.GasUsed)
+			fee := feeWei.Big()
+			success := rcpt.Status == types.ReceiptStatusSuccessful
+			switch {
+			case isCall:
+				call := &Call{To: *to, Value: tx.Value(), Fee: fee, Success: success}
+				if len(tx.Data()) >= 4 {
+					call.Selector = tx.Data()[:4]
+				}
+				entries = append(entries, Entry{
+					Kind:         KindContract,
+					Direction:    Out,
+					Time:         time.Unix(int64(block.Time()), 0).UTC(),
+					BlockNumber:  n,
+					TxHash:       tx.Hash(),
+					Counterparty: *to,
+					Call:         call,
+				})
+			case success:
+				entries = append(entries, transferEntry(KindNative, addr, &indexer.Transfer{
+					Asset:       indexer.NativeAsset,
+					From:        from,
+					To:          *to,
+					Amount:      units.NewWei(tx.Value()).Amount(),
+					Fee:         &feeWei,
+					TxHash:      tx.Hash(),
+					BlockNumber: n,
+					BlockHash:   block.Hash(),
+					Timestamp:   block.Time(),
+				}))
+			}
+		}
+	}
+	return entries, nil
+}
+
+// messages returns the envelopes sent in the time span of the block range;
+// an open range runs to now
+func (t *Timeline) messages(ctx context.Context, addr common.Address, fromBlock, toBlock uint64, open bool, sc *scan) ([]Entry, error) {
+	since, err := t.blockTime(ctx, fromBlock, sc)
+	if err != nil {
+		return nil, err
+	}
+	until := time.Now().Add(time.Second)
+	if !open {
+		if until, err = t.blockTime(ctx, toBlock+1, sc); err != nil {
+			return nil, err
+		}
+	}
+	envs, err := t.Messages.Envelopes(ctx, addr, since, until)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(envs))
+	for _, env := range envs {
+		e := Entry{
+			Kind: KindMessage,
+			Time: time.Unix(env.Timestamp, 0).UTC(),
+			Message: &Message{
+				ID:          env.ID,
+				Topic:       env.Topic,
+				Sender:      env.Sender,
+				Recipient:   env.Recipient,
+				Attachments: len(env.Attachments),
+			},
+		}
+		e.Direction, e.Counterparty = direction(addr, env.Sender, env.Recipient)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// blockTime returns a block's timestamp, or now for blocks not mined yet
+func (t *Timeline) blockTime(ctx context.Context, n uint64, sc *scan) (time.Time, error) {
+	if ts, ok := sc.times[n]; ok {
+		return time.Unix(int64(ts), 0).UTC(), nil
+	}
+	h, err := t.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+	if err != nil {
+		head, headErr := t.Client.BlockNumber(ctx)
+		if headErr == nil && n > head {
+			return time.Now().UTC(), nil
+		}
+		return time.Time{}, err
+	}
+	sc.times[n] = h.Time
+	return time.Unix(int64(h.Time), 0).UTC(), nil
+}
+
+func transferEntry(kind Kind, addr common.Address, tr *indexer.Transfer) Entry {
+	e := Entry{
+		Kind:        kind,
+		Time:        time.Unix(int64(tr.Timestamp), 0).UTC(),
+		BlockNumber: tr.BlockNumber,
+		TxHash:      tr.TxHash,
+		Transfer:    tr,
+	}
+	e.Direction, e.Counterparty = direction(addr, tr.From, tr.To)
+	return e
+}
+
+func direction(addr, from, to common.Address) (Direction, common.Address) {
+	switch {
+	case from == addr && to == addr:
+		return Self, addr
+	case from == addr:
+		return Out, to
+	default:
+		return In, from
+	}
+}
+
+// sortKey orders entries by time, block, position in the block, then kind
+// and identity so equal positions still order deterministically
+func sortKey(e *Entry, sc *scan) string {
+	var position, sub uint64
+	if idx, ok := sc.txIndex[e.TxHash]; ok {
+		position = idx
+	}
+	id := e.TxHash.Hex()
+	switch {
+	case e.Message != nil:
+		id = e.Message.ID.Hex()
+	case e.Kind == KindToken:
+		// The log index orders token transfers even without a block scan
+		sub = uint64(e.Transfer.LogIndex) + 1
+	case e.Kind == KindInternal:
+		sub = e.seq
+	}
+	return fmt.Sprintf("%012d.%012d.%06d.%06d.%s.%s", e.Time.Unix(), e.BlockNumber, position, sub, e.Kind, id)
+}
+
+func kinds(list []Kind) map[Kind]bool {
+	want := make(map[Kind]bool)
+	if len(list) == 0 {
+		list = []Kind{KindNative, KindToken, KindInternal, KindContract, KindMessage}
+	}
+	for _, k := range list {
+		want[k] = true
+	}
+	return want
+}
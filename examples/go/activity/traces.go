@@ -0,0 +1,164 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// parityTrace is one frame returned by trace_filter
+type parityTrace struct {
+	Action struct {
+		CallType string         `json:"callType"`
+		From     common.Address `json:"from"`
+		To       common.Address `json:"to"`
+		Value    *hexutil.Big   `json:"value"`
+	} `json:"action"`
+	BlockHash       common.Hash  `json:"blockHash"`
+	BlockNumber     uint64       `json:"blockNumber"`
+	TransactionHash *common.Hash `json:"transactionHash"`
+	TraceAddress    []int        `json:"traceAddress"`
+	Type            string       `json:"type"`
+	Error           string       `json:"error"`
+}
+
+// callFrame is one frame returned by geth's callTracer
+type callFrame struct {
+	Type  string         `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// internalTransfers returns ETH moved to or from addr by calls inside
+// transactions. trace_filter sees every transaction; the callTracer fallback
+// only sees transactions the block scan tied to the account, so internal
+// payments from other people's transactions need a node with trace_filter
+func (t *Timeline) internalTransfers(ctx context.Context, addr common.Address, fromBlock, toBlock uint64, sc *scan) ([]Entry, error) {
+	entries, err := t.traceFilter(ctx, addr, fromBlock, toBlock, sc)
+	if err == nil {
+		return entries, nil
+	}
+	return t.traceTransactions(ctx, addr, sc)
+}
+
+func (t *Timeline) traceFilter(ctx context.Context, addr common.Address, fromBlock, toBlock uint64, sc *scan) ([]Entry, error) {
+	var entries []Entry
+	reverted := make(map[common.Hash]bool)
+	seen := make(map[string]bool)
+	for _, side := range []string{"fromAddress", "toAddress"} {
+		var traces []parityTrace
+		err := t.Client.Client().CallContext(ctx, &traces, "trace_filter", map[string]interface{}{
+			"fromBlock": hexutil.Uint64(fromBlock),
+			"toBlock":   hexutil.Uint64(toBlock),
+			side:        []common.Address{addr},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, tr := range traces {
+			if tr.Type != "call" || len(tr.TraceAddress) == 0 || tr.Error != "" || tr.TransactionHash == nil ||
+				tr.Action.Value == nil || tr.Action.Value.ToInt().Sign() == 0 ||
+				tr.Action.CallType == "delegatecall" || tr.Action.CallType == "staticcall" {
+				continue
+			}
+			key := tr.TransactionHash.Hex() + fmt.Sprint(tr.TraceAddress)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			// A reverted transaction undoes its internal calls
+			hash := *tr.TransactionHash
+			undone, known := reverted[hash]
+			if !known {
+				rcpt, err := t.Client.TransactionReceipt(ctx, hash)
+				if err != nil {
+					return nil, err
+				}
+				undone = rcpt.Status != types.ReceiptStatusSuccessful
+				reverted[hash] = undone
+			}
+			if undone {
+				continue
+			}
+			ts, err := t.blockTime(ctx, tr.BlockNumber, sc)
+			if err != nil {
+				return nil, err
+			}
+			e := transferEntry(KindInternal, addr, &indexer.Transfer{
+				Asset:       indexer.NativeAsset,
+				From:        tr.Action.From,
+				To:          tr.Action.To,
+				Amount:      units.NewWei(tr.Action.Value.ToInt()).Amount(),
+				TxHash:      hash,
+				BlockNumber: tr.BlockNumber,
+				BlockHash:   tr.BlockHash,
+				Timestamp:   uint64(ts.Unix()),
+			})
+			e.seq = uint64(i) + 1
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// traceTransactions runs the callTracer over the account's transactions
+func (t *Timeline) traceTransactions(ctx context.Context, addr common.Address, sc *scan) ([]Entry, error) {
+	var entries []Entry
+	for hash := range sc.txIndex {
+		var root callFrame
+		err := t.Client.Client().CallContext(ctx, &root, "debug_traceTransaction", hash, map[string]string{"tracer": "callTracer"})
+		if err != nil {
+			return nil, err
+		}
+		if root.Error != "" {
+			continue
+		}
+		rcpt, err := t.Client.TransactionReceipt(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		n := rcpt.BlockNumber.Uint64()
+		ts, err := t.blockTime(ctx, n, sc)
+		if err != nil {
+			return nil, err
+		}
+
+		var seq uint64
+		var walk func(frames []callFrame)
+		walk = func(frames []callFrame) {
+			for _, f := range frames {
+				// Reverted frames undo everything below them
+				if f.Error != "" {
+					continue
+				}
+				seq++
+				if f.Type == "CALL" && f.Value != nil && f.Value.ToInt().Sign() > 0 && (f.From == addr || f.To == addr) {
+					e := transferEntry(KindInternal, addr, &indexer.Transfer{
+						Asset:       indexer.NativeAsset,
+						From:        f.From,
+						To:          f.To,
+						Amount:      units.NewWei(f.Value.ToInt()).Amount(),
+						TxHash:      hash,
+						BlockNumber: n,
+						BlockHash:   rcpt.BlockHash,
+						Timestamp:   uint64(ts.Unix()),
+					})
+					e.seq = seq
+					entries = append(entries, e)
+				}
+				walk(f.Calls)
+			}
+		}
+		walk(root.Calls)
+	}
+	return entries, nil
+}
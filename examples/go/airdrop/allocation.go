@@ -0,0 +1,110 @@
+// Package airdrop distributes a token to the holders of a snapshot: it takes
+// the snapshot, allocates by a rule, then either sends the allocations in
+// resumable batches of transfers or publishes a Merkle root for a
+// MerkleDistributor-style claim contract, and finishes with a signed
+// distribution report
+package airdrop
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/indexer"
+)
+
+// Allocation kinds
+const (
+	// ProRata splits Rule.Amount in proportion to snapshot balances,
+	// rounding down; the rounding dust stays with the sender
+	ProRata = "pro-rata"
+	// Flat gives every eligible holder Rule.Amount
+	Flat = "flat"
+)
+
+var (
+	// ErrUnknownRule is returned for a rule kind this package does not know
+	ErrUnknownRule = errors.New("airdrop: unknown allocation rule")
+	// ErrNoRecipients is returned when no holder is eligible
+	ErrNoRecipients = errors.New("airdrop: no eligible holders")
+)
+
+// Rule decides who gets what from a snapshot
+type Rule struct {
+	Kind       string           `json:"kind"`
+	Amount     *big.Int         `json:"amount"`               // the pool for ProRata, per holder for Flat
+	MinBalance *big.Int         `json:"minBalance,omitempty"` // holders below it are not eligible
+	Cap        *big.Int         `json:"cap,omitempty"`        // most one holder gets; the excess is not redistributed
+	Exclude    []common.Address `json:"exclude,omitempty"`    // never eligible, such as the treasury and exchanges
+}
+
+// Allocation is what one account receives. Index is its position in the
+// distribution, used by the Merkle leaf and in progress records
+type Allocation struct {
+	Index   uint64         `json:"index"`
+	Account common.Address `json:"account"`
+	Amount  *big.Int       `json:"amount"`
+}
+
+// Allocate applies the rule to a snapshot. Holders keep their snapshot
+// order, which indexer.Holders gives by address, and holders allocated
+// nothing are left out
+func Allocate(holders []indexer.Holder, rule Rule) ([]Allocation, error) {
+	if rule.Amount == nil || rule.Amount.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrUnknownRule)
+	}
+	excluded := make(map[common.Address]bool, len(rule.Exclude))
+	for _, addr := range rule.Exclude {
+		excluded[addr] = true
+	}
+	eligible := make([]indexer.Holder, 0, len(holders))
+	total := new(big.Int)
+	for _, h := range holders {
+		if excluded[h.Address] || h.Address == (common.Address{}) || h.Balance.Sign() <= 0 {
+			continue
+		}
+		if rule.MinBalance != nil && h.Balance.Base().Cmp(rule.MinBalance) < 0 {
+			continue
+		}
+		eligible = append(eligible, h)
+		total.Add(total, h.Balance.Base())
+	}
+	if len(eligible) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	allocs := make([]Allocation, 0, len(eligible))
+	for _, h := range eligible {
+		var amount *big.Int
+		switch rule.Kind {
+		case ProRata:
+			amount = new(big.Int).Mul(rule.Amount, h.Balance.Base())
+			amount.Quo(amount, total)
+		case Flat:
+			amount = new(big.Int).Set(rule.Amount)
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrUnknownRule, rule.Kind)
+		}
+		if rule.Cap != nil && amount.Cmp(rule.Cap) > 0 {
+			amount.Set(rule.Cap)
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+		allocs = append(allocs, Allocation{Index: uint64(len(allocs)), Account: h.Address, Amount: amount})
+	}
+	if len(allocs) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return allocs, nil
+}
+
+// Total sums allocations
+func Total(allocs []Allocation) *big.Int {
+	total := new(big.Int)
+	for _, a := range allocs {
+		total.Add(total, a.Amount)
+	}
+	return total
+}
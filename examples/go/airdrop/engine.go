@@ -0,0 +1,443 @@
+package airdrop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const storePrefix = "airdrop/"
+
+// Method is how allocations reach their recipients
+type Method string
+
+const (
+	// MethodTransfer sends every allocation from the engine's wallet
+	MethodTransfer Method = "transfer"
+	// MethodMerkle publishes a Merkle root; recipients claim with proofs from
+	// a distributor contract the operator deploys and funds
+	MethodMerkle Method = "merkle"
+)
+
+// Status is the state of one allocation's transfer
+type Status string
+
+const (
+	StatusPending Status = "pending" // signed and saved, possibly broadcast, not yet mined
+	StatusSent    Status = "sent"    // mined successfully
+	StatusFailed  Status = "failed"  // mined and reverted
+)
+
+var (
+	// ErrExists is returned when planning an airdrop ID that is already planned
+	ErrExists = errors.New("airdrop: already planned")
+	// ErrUnknownMethod is returned for a distribution method this package
+	// does not know
+	ErrUnknownMethod = errors.New("airdrop: unknown distribution method")
+	// ErrInsufficientBalance is returned when the wallet holds less of the
+	// token than the allocations left to send
+	ErrInsufficientBalance = errors.New("airdrop: wallet balance does not cover the remaining allocations")
+)
+
+// Config describes an airdrop
+type Config struct {
+	Snapshot   common.Address `json:"snapshot"`   // token whose holders are eligible
+	StartBlock uint64         `json:"startBlock"` // the snapshot token's deployment block
+	Block      uint64         `json:"block"`      // snapshot block
+	Token      common.Address `json:"token"`      // token distributed
+	Rule       Rule           `json:"rule"`
+	Method     Method         `json:"method"`
+}
+
+// Plan is an airdrop's allocations, computed once from its snapshot and
+// stored so execution can resume from it
+type Plan struct {
+	ID string `json:"id"`
+	Config
+	ChainID     *hexutil.Big `json:"chainId"`
+	BlockHash   common.Hash  `json:"blockHash"`
+	Allocations []Allocation `json:"allocations"`
+	Total       *big.Int     `json:"total"`
+	Root        common.Hash  `json:"root,omitempty"` // MethodMerkle only
+}
+
+// Claim is what a recipient submits to a MerkleDistributor
+type Claim struct {
+	Index   uint64         `json:"index"`
+	Account common.Address `json:"account"`
+	Amount  *hexutil.Big   `json:"amount"`
+	Proof   []common.Hash  `json:"proof"`
+}
+
+// Claims returns every allocation with its proof against Root
+func (p *Plan) Claims() []Claim {
+	tree := p.tree()
+	claims := make([]Claim, 0, len(p.Allocations))
+	for _, a := range p.Allocations {
+		proof, _ := tree.Proof(Leaf(a.Index, a.Account, a.Amount))
+		claims = append(claims, Claim{Index: a.Index, Account: a.Account, Amount: (*hexutil.Big)(a.Amount), Proof: proof})
+	}
+	return claims
+}
+
+func (p *Plan) tree() *Tree {
+	leaves := make([]common.Hash, len(p.Allocations))
+	for i, a := range p.Allocations {
+		leaves[i] = Leaf(a.Index, a.Account, a.Amount)
+	}
+	return NewTree(leaves)
+}
+
+// Transfer is the progress record of one allocation sent by MethodTransfer.
+// Raw keeps the signed transaction so a resumed run rebroadcasts the same
+// nonce instead of paying twice
+type Transfer struct {
+	Index   uint64         `json:"index"`
+	Account common.Address `json:"account"`
+	Amount  *big.Int       `json:"amount"`
+	Status  Status         `json:"status"`
+	TxHash  common.Hash    `json:"txHash"`
+	Block   uint64         `json:"block,omitempty"`
+	Raw     hexutil.Bytes  `json:"raw,omitempty"`
+	// Reverted lists earlier transactions for the allocation that were
+	// mined and reverted, oldest first
+	Reverted []common.Hash `json:"reverted,omitempty"`
+}
+
+// Engine plans and executes airdrops from one wallet, saving progress to a
+// store. While it sends, the wallet must not send anything else: transfers
+// are signed with explicit nonces ahead of broadcasting
+type Engine struct {
+	Wallet    *wallet.Wallet
+	Indexer   *indexer.Indexer
+	Store     storage.Store
+	BatchSize int // transfers broadcast before waiting for them; default 50
+	Audit     audit.Log
+}
+
+// NewEngine creates an engine
+func NewEngine(w *wallet.Wallet, ix *indexer.Indexer, store storage.Store, auditLog audit.Log) *Engine {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Engine{Wallet: w, Indexer: ix, Store: store, BatchSize: 50, Audit: auditLog}
+}
+
+// Plan takes the snapshot, allocates by the rule and saves the plan under
+// id, computing the Merkle root for MethodMerkle
+func (e *Engine) Plan(ctx context.Context, id string, cfg Config) (*Plan, error) {
+	if cfg.Method != MethodTransfer && cfg.Method != MethodMerkle {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMethod, cfg.Method)
+	}
+	if _, err := e.Store.Get(ctx, planKey(id)); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrExists, id)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	client, err := e.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(cfg.Block))
+	if err != nil {
+		return nil, err
+	}
+
+	var holders []indexer.Holder
+	err = e.Indexer.Holders(ctx, cfg.Snapshot, cfg.StartBlock, cfg.Block, func(h indexer.Holder) error {
+		holders = append(holders, h)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	allocs, err := Allocate(holders, cfg.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		ID:          id,
+		Config:      cfg,
+		ChainID:     (*hexutil.Big)(chainID),
+		BlockHash:   header.Hash(),
+		Allocations: allocs,
+		Total:       Total(allocs),
+	}
+	if cfg.Method == MethodMerkle {
+		p.Root = p.tree().Root()
+	}
+	if err := e.put(ctx, planKey(id), p); err != nil {
+		return nil, err
+	}
+	e.record(ctx, "airdrop-planned", id, "ok", map[string]string{
+		"method":     string(cfg.Method),
+		"recipients": strconv.Itoa(len(allocs)),
+		"total":      p.Total.String(),
+		"block":      strconv.FormatUint(cfg.Block, 10),
+	})
+	return p, nil
+}
+
+// Load returns a saved plan
+func (e *Engine) Load(ctx context.Context, id string) (*Plan, error) {
+	data, err := e.Store.Get(ctx, planKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Execute carries out a saved plan and returns its signed report. For
+// MethodTransfer it sends the allocations not yet sent, BatchSize at a
+// time, saving each signed transfer before broadcasting it; after a crash
+// or error, calling Execute again settles the saved transfers and carries
+// on. Each call also sends again, once, the allocations whose transfer
+// reverted. Merkle plans have nothing to send. Bound the wait for
+// transactions with ctx
+func (e *Engine) Execute(ctx context.Context, id string) (*Report, error) {
+	p, err := e.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Method == MethodTransfer {
+		if err := e.send(ctx, p); err != nil {
+			e.record(ctx, "airdrop-executed", id, "error", map[string]string{"error": err.Error()})
+			return nil, err
+		}
+	}
+	r, err := e.Report(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	e.record(ctx, "airdrop-executed", id, "ok", map[string]string{"sent": r.Sent.ToInt().String(), "complete": strconv.FormatBool(r.Complete)})
+	return r, nil
+}
+
+// Progress returns the saved transfer records of a plan, by index
+func (e *Engine) Progress(ctx context.Context, id string) (map[uint64]*Transfer, error) {
+	keys, err := e.Store.List(ctx, transferPrefix(id))
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64]*Transfer, len(keys))
+	for _, key := range keys {
+		data, err := e.Store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var t Transfer
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		out[t.Index] = &t
+	}
+	return out, nil
+}
+
+func (e *Engine) send(ctx context.Context, p *Plan) error {
+	// the nonces below bypass the tx manager; make it reread them afterwards
+	if m := e.Wallet.Settings().TxManager; m != nil {
+		defer m.Reset(e.Wallet.Address)
+	}
+	progress, err := e.Progress(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if err := e.settle(ctx, p.ID, progress); err != nil {
+		return err
+	}
+
+	var todo []Allocation
+	reverted := make(map[uint64][]common.Hash)
+	remaining := new(big.Int)
+	for _, a := range p.Allocations {
+		t, ok := progress[a.Index]
+		if ok && t.Status != StatusFailed {
+			continue
+		}
+		if ok {
+			reverted[a.Index] = append(t.Reverted, t.TxHash)
+		}
+		todo = append(todo, a)
+		remaining.Add(remaining, a.Amount)
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+	client, err := e.Wallet.Client(ctx)
+	if err != nil {
+		return err
+	}
+	balance, err := contract.NewERC20(p.Token, client).BalanceOf(ctx, e.Wallet.Address)
+	if err != nil {
+		return err
+	}
+	if balance.Base().Cmp(remaining) < 0 {
+		return fmt.Errorf("%w: have %s, need %s", ErrInsufficientBalance, balance.Base(), remaining)
+	}
+
+	size := e.BatchSize
+	if size <= 0 {
+		size = 50
+	}
+	for len(todo) > 0 {
+		batch := todo[:min(size, len(todo))]
+		todo = todo[len(batch):]
+		if err := e.sendBatch(ctx, p, batch, reverted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBatch signs and saves a transfer for each allocation, broadcasts them
+// and waits for them all; reverted holds the earlier attempts of retried
+// allocations
+func (e *Engine) sendBatch(ctx context.Context, p *Plan, batch []Allocation, reverted map[uint64][]common.Hash) error {
+	client, err := e.Wallet.Client(ctx)
+	if err != nil {
+		return err
+	}
+	nonce, err := client.PendingNonceAt(ctx, e.Wallet.Address)
+	if err != nil {
+		return err
+	}
+	txs := make([]*types.Transaction, 0, len(batch))
+	for i, a := range batch {
+		n := nonce + uint64(i)
+		data, err := contract.TransferData(a.Account, a.Amount)
+		if err != nil {
+			return fmt.Errorf("allocation %d: %w", a.Index, err)
+		}
+		tx, err := e.Wallet.BuildTx(ctx, p.Token, units.Wei{}, &wallet.TxOpts{Nonce: &n, Data: data})
+		if err != nil {
+			return fmt.Errorf("allocation %d: %w", a.Index, err)
+		}
+		if tx, err = e.Wallet.SignTx(ctx, tx); err != nil {
+			return fmt.Errorf("allocation %d: %w", a.Index, err)
+		}
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		t := &Transfer{Index: a.Index, Account: a.Account, Amount: a.Amount, Status: StatusPending, TxHash: tx.Hash(), Raw: raw, Reverted: reverted[a.Index]}
+		if err := e.put(ctx, transferKey(p.ID, a.Index), t); err != nil {
+			return err
+		}
+		txs = append(txs, tx)
+	}
+	for _, tx := range txs {
+		if err := client.SendTransaction(ctx, tx); err != nil {
+			return err
+		}
+	}
+	for i, a := range batch {
+		t := &Transfer{Index: a.Index, Account: a.Account, Amount: a.Amount, Status: StatusPending, TxHash: txs[i].Hash(), Reverted: reverted[a.Index]}
+		if err := e.wait(ctx, p.ID, t, txs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settle finishes the transfers an earlier run saved but did not see mined:
+// those the node does not know are rebroadcast, in nonce order, then all are
+// waited for
+func (e *Engine) settle(ctx context.Context, id string, progress map[uint64]*Transfer) error {
+	var pending []*Transfer
+	for _, t := range progress {
+		if t.Status == StatusPending {
+			pending = append(pending, t)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Index < pending[j].Index })
+	client, err := e.Wallet.Client(ctx)
+	if err != nil {
+		return err
+	}
+	txs := make([]*types.Transaction, len(pending))
+	for i, t := range pending {
+		txs[i] = new(types.Transaction)
+		if err := txs[i].UnmarshalBinary(t.Raw); err != nil {
+			return fmt.Errorf("allocation %d: %w", t.Index, err)
+		}
+		if _, _, err := client.TransactionByHash(ctx, t.TxHash); errors.Is(err, ethereum.NotFound) {
+			if err := client.SendTransaction(ctx, txs[i]); err != nil {
+				return fmt.Errorf("allocation %d: %w", t.Index, err)
+			}
+		}
+	}
+	for i, t := range pending {
+		if err := e.wait(ctx, id, t, txs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait waits for a transfer to be mined and saves its outcome
+func (e *Engine) wait(ctx context.Context, id string, t *Transfer, tx *types.Transaction) error {
+	rcpt, err := e.Wallet.WaitForTransaction(ctx, tx.Hash())
+	if err != nil {
+		return fmt.Errorf("allocation %d: %w", t.Index, err)
+	}
+	t.Status, t.Block, t.Raw = StatusSent, rcpt.BlockNumber.Uint64(), nil
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		t.Status = StatusFailed
+	}
+	return e.put(ctx, transferKey(id, t.Index), t)
+}
+
+func (e *Engine) put(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.Store.Put(ctx, key, data)
+}
+
+func (e *Engine) record(ctx context.Context, action, id, outcome string, details map[string]string) {
+	e.Audit.Record(ctx, audit.Entry{
+		Actor:   e.Wallet.Address.Hex(),
+		Action:  action,
+		Subject: id,
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+func planKey(id string) string {
+	return storePrefix + id + "/plan"
+}
+
+func transferPrefix(id string) string {
+	return storePrefix + id + "/transfer/"
+}
+
+func transferKey(id string, index uint64) string {
+	return fmt.Sprintf("%s%010d", transferPrefix(id), index)
+}
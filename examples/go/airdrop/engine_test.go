@@ -0,0 +1,177 @@
+package airdrop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+var token = common.HexToAddress("0x00000000000000000000000000000000000070c0")
+
+// fakeChain is an eth RPC namespace that mines each token transfer as it
+// arrives, reverting the first transfer to each account in revertOnce
+type fakeChain struct {
+	mu         sync.Mutex
+	chainID    *big.Int
+	nonces     map[common.Address]uint64
+	receipts   map[common.Hash]*types.Receipt
+	revertOnce map[common.Address]bool
+	head       uint64
+	sent       int
+}
+
+func (f *fakeChain) ChainId() *hexutil.Big { return (*hexutil.Big)(f.chainID) }
+
+func (f *fakeChain) GetTransactionCount(addr common.Address, block string) hexutil.Uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return hexutil.Uint64(f.nonces[addr])
+}
+
+func (f *fakeChain) EstimateGas(args map[string]interface{}) hexutil.Uint64 { return 60000 }
+
+func (f *fakeChain) BlockNumber() hexutil.Uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return hexutil.Uint64(f.head)
+}
+
+// Call answers symbol with "TKN", decimals with 18 and balanceOf with more than any test sends
+func (f *fakeChain) Call(args map[string]interface{}, block string) (hexutil.Bytes, error) {
+	input, _ := args["input"].(string)
+	if input == "" {
+		input, _ = args["data"].(string)
+	}
+	switch {
+	case strings.HasPrefix(input, "0x95d89b41"):
+		out := append(common.LeftPadBytes([]byte{0x20}, 32), common.LeftPadBytes([]byte{3}, 32)...)
+		return append(out, common.RightPadBytes([]byte("TKN"), 32)...), nil
+	case strings.HasPrefix(input, "0x313ce567"):
+		return common.LeftPadBytes([]byte{18}, 32), nil
+	case strings.HasPrefix(input, "0x70a08231"):
+		return common.LeftPadBytes(big.NewInt(1e18).Bytes(), 32), nil
+	}
+	return nil, fmt.Errorf("unexpected call %s", input)
+}
+
+func (f *fakeChain) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Hash{}, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(f.chainID), tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	to, _, ok := contract.DecodeTransfer(tx.Data())
+	if !ok {
+		return common.Hash{}, errors.New("not a token transfer")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if tx.Nonce() != f.nonces[from] {
+		return common.Hash{}, errors.New("nonce too low")
+	}
+	f.nonces[from]++
+	f.sent++
+	f.head++
+	status := types.ReceiptStatusSuccessful
+	if f.revertOnce[to] {
+		status = types.ReceiptStatusFailed
+		delete(f.revertOnce, to)
+	}
+	f.receipts[tx.Hash()] = &types.Receipt{
+		Status:      status,
+		Logs:        []*types.Log{},
+		TxHash:      tx.Hash(),
+		BlockHash:   common.BigToHash(new(big.Int).SetUint64(f.head)),
+		BlockNumber: new(big.Int).SetUint64(f.head),
+	}
+	return tx.Hash(), nil
+}
+
+func (f *fakeChain) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.receipts[hash]
+}
+
+func TestExecuteRetriesRevertedTransfers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	chain := &fakeChain{
+		chainID:    big.NewInt(1337),
+		nonces:     map[common.Address]uint64{},
+		receipts:   map[common.Hash]*types.Receipt{},
+		revertOnce: map[common.Address]bool{},
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", chain); err != nil {
+		t.Fatal(err)
+	}
+	client := ethclient.NewClient(rpc.DialInProc(srv))
+	t.Cleanup(func() {
+		client.Close()
+		srv.Stop()
+	})
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wallet.NewWalletFromClient(key, client)
+	w.GasStrategy = wallet.FixedGasPrice{Price: big.NewInt(1e9)}
+	w.TxManager.Config.PollInterval = 10 * time.Millisecond
+
+	e := NewEngine(w, nil, storage.NewMemoryStore(), nil)
+	allocs := []Allocation{
+		{Index: 0, Account: common.HexToAddress("0xa0"), Amount: big.NewInt(10)},
+		{Index: 1, Account: common.HexToAddress("0xa1"), Amount: big.NewInt(20)},
+		{Index: 2, Account: common.HexToAddress("0xa2"), Amount: big.NewInt(30)},
+	}
+	plan := &Plan{ID: "drop", Config: Config{Token: token, Method: MethodTransfer}, ChainID: (*hexutil.Big)(chain.chainID), Allocations: allocs, Total: Total(allocs)}
+	if err := e.put(ctx, planKey(plan.ID), plan); err != nil {
+		t.Fatal(err)
+	}
+	chain.revertOnce[allocs[1].Account] = true
+
+	r, err := e.Execute(ctx, plan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Complete || r.Sent.ToInt().Int64() != 40 || r.Transfers[1].Status != StatusFailed {
+		t.Fatalf("first run: complete %v, sent %s, allocation 1 %s", r.Complete, r.Sent, r.Transfers[1].Status)
+	}
+	reverted := r.Transfers[1].TxHash
+
+	r, err = e.Execute(ctx, plan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Complete || r.Sent.ToInt().Int64() != 60 {
+		t.Fatalf("retry: complete %v, sent %s", r.Complete, r.Sent)
+	}
+	if got := r.Transfers[1].Reverted; len(got) != 1 || got[0] != reverted {
+		t.Fatalf("reverted attempts %v, want %v", got, reverted)
+	}
+	if _, err := e.Execute(ctx, plan.ID); err != nil {
+		t.Fatal(err)
+	}
+	if chain.sent != 4 {
+		t.Fatalf("%d transfers sent, want three and one retry", chain.sent)
+	}
+}
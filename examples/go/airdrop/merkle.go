@@ -0,0 +1,101 @@
+package airdrop
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Leaf is the Merkle leaf of an allocation, keccak256(abi.encodePacked(
+// uint256 index, address account, uint256 amount)), as Uniswap's
+// MerkleDistributor checks it
+func Leaf(index uint64, account common.Address, amount *big.Int) common.Hash {
+	return crypto.Keccak256Hash(
+		common.LeftPadBytes(new(big.Int).SetUint64(index).Bytes(), 32),
+		account.Bytes(),
+		common.LeftPadBytes(amount.Bytes(), 32),
+	)
+}
+
+// Tree is a Merkle tree over sorted leaves with sorted-pair hashing, the
+// layout OpenZeppelin's MerkleProof verifies. A node without a sibling is
+// carried up unchanged
+type Tree struct {
+	layers [][]common.Hash // leaves first, root last
+	index  map[common.Hash]int
+}
+
+// NewTree builds a tree; duplicate leaves are kept once
+func NewTree(leaves []common.Hash) *Tree {
+	sorted := make([]common.Hash, 0, len(leaves))
+	index := make(map[common.Hash]int, len(leaves))
+	for _, l := range leaves {
+		if _, ok := index[l]; !ok {
+			index[l] = 0
+			sorted = append(sorted, l)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+	for i, l := range sorted {
+		index[l] = i
+	}
+	t := &Tree{layers: [][]common.Hash{sorted}, index: index}
+	for layer := sorted; len(layer) > 1; {
+		next := make([]common.Hash, 0, (len(layer)+1)/2)
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 == len(layer) {
+				next = append(next, layer[i])
+			} else {
+				next = append(next, hashPair(layer[i], layer[i+1]))
+			}
+		}
+		t.layers = append(t.layers, next)
+		layer = next
+	}
+	return t
+}
+
+// Root returns the tree's root, zero for an empty tree
+func (t *Tree) Root() common.Hash {
+	top := t.layers[len(t.layers)-1]
+	if len(top) == 0 {
+		return common.Hash{}
+	}
+	return top[0]
+}
+
+// Proof returns the sibling hashes proving leaf, or false if it is not in
+// the tree
+func (t *Tree) Proof(leaf common.Hash) ([]common.Hash, bool) {
+	i, ok := t.index[leaf]
+	if !ok {
+		return nil, false
+	}
+	proof := []common.Hash{}
+	for _, layer := range t.layers[:len(t.layers)-1] {
+		if sibling := i ^ 1; sibling < len(layer) {
+			proof = append(proof, layer[sibling])
+		}
+		i /= 2
+	}
+	return proof, true
+}
+
+// VerifyProof reports whether proof links leaf to root
+func VerifyProof(root, leaf common.Hash, proof []common.Hash) bool {
+	h := leaf
+	for _, p := range proof {
+		h = hashPair(h, p)
+	}
+	return h == root
+}
+
+func hashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256Hash(a[:], b[:])
+}
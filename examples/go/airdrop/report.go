@@ -0,0 +1,156 @@
+package airdrop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Report is the signed record of a distribution: the snapshot and rule it
+// came from, the Merkle root or every transfer's outcome, and the totals
+type Report struct {
+	ID          string         `json:"id"`
+	ChainID     *hexutil.Big   `json:"chainId"`
+	Snapshot    common.Address `json:"snapshot"`
+	Block       uint64         `json:"block"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	Token       common.Address `json:"token"`
+	Rule        Rule           `json:"rule"`
+	Method      Method         `json:"method"`
+	Root        common.Hash    `json:"root,omitempty"`
+	Recipients  int            `json:"recipients"`
+	Total       *hexutil.Big   `json:"total"`
+	Sent        *hexutil.Big   `json:"sent"` // by successful transfers; zero for Merkle airdrops
+	Transfers   []Transfer     `json:"transfers,omitempty"`
+	Complete    bool           `json:"complete"` // every allocation was sent, or the root published
+	Distributor common.Address `json:"distributor"`
+	Signature   hexutil.Bytes  `json:"signature,omitempty"`
+}
+
+// Report builds and signs the report of an airdrop as it stands, whether or
+// not Execute has finished
+func (e *Engine) Report(ctx context.Context, id string) (*Report, error) {
+	p, err := e.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{
+		ID:         p.ID,
+		ChainID:    p.ChainID,
+		Snapshot:   p.Snapshot,
+		Block:      p.Block,
+		BlockHash:  p.BlockHash,
+		Token:      p.Token,
+		Rule:       p.Rule,
+		Method:     p.Method,
+		Root:       p.Root,
+		Recipients: len(p.Allocations),
+		Total:      (*hexutil.Big)(p.Total),
+		Sent:       (*hexutil.Big)(new(big.Int)),
+		Complete:   p.Method == MethodMerkle,
+	}
+	if p.Method == MethodTransfer {
+		progress, err := e.Progress(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		r.Complete = true
+		for _, a := range p.Allocations {
+			t, ok := progress[a.Index]
+			if !ok {
+				t = &Transfer{Index: a.Index, Account: a.Account, Amount: a.Amount}
+			}
+			t.Raw = nil
+			r.Transfers = append(r.Transfers, *t)
+			if t.Status == StatusSent {
+				r.Sent.ToInt().Add(r.Sent.ToInt(), t.Amount)
+			} else {
+				r.Complete = false
+			}
+		}
+	}
+	if err := r.Seal(e.Wallet); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Seal signs the report as its distributor
+func (r *Report) Seal(w *wallet.Wallet) error {
+	r.Distributor = w.Address
+	data, err := r.payload()
+	if err != nil {
+		return err
+	}
+	sig, err := w.SignPersonalMessage(data)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// Verify checks the distributor's signature and that the totals match the
+// transfers; anyone holding the report can run it. Check the transfers
+// themselves against the chain by their hashes
+func (r *Report) Verify() error {
+	if r.ChainID == nil || r.Total == nil || r.Sent == nil {
+		return errors.New("airdrop: report is incomplete")
+	}
+	data, err := r.payload()
+	if err != nil {
+		return err
+	}
+	if !wallet.VerifyPersonalSignature(data, r.Signature, r.Distributor) {
+		return errors.New("airdrop: report is not signed by its distributor")
+	}
+	if r.Method != MethodTransfer {
+		return nil
+	}
+	if len(r.Transfers) != r.Recipients {
+		return fmt.Errorf("airdrop: %d transfers for %d recipients", len(r.Transfers), r.Recipients)
+	}
+	total, sent, complete := new(big.Int), new(big.Int), true
+	for _, t := range r.Transfers {
+		total.Add(total, t.Amount)
+		if t.Status == StatusSent {
+			sent.Add(sent, t.Amount)
+		} else {
+			complete = false
+		}
+	}
+	if total.Cmp(r.Total.ToInt()) != 0 || sent.Cmp(r.Sent.ToInt()) != 0 || complete != r.Complete {
+		return errors.New("airdrop: totals do not match the transfers")
+	}
+	return nil
+}
+
+// Encode returns the report as indented JSON
+func (r *Report) Encode() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// DecodeReport parses a report
+func DecodeReport(data []byte) (*Report, error) {
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.ChainID == nil || r.Total == nil || r.Sent == nil {
+		return nil, errors.New("airdrop: report is incomplete")
+	}
+	return &r, nil
+}
+
+// payload is what the distributor signs: the report without its signature
+func (r *Report) payload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
@@ -0,0 +1,217 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Severity orders alerts by urgency
+type Severity int
+
+const (
+	Info Severity = iota + 1
+	Warning
+	Critical
+)
+
+var severityNames = map[Severity]string{
+	Info:     "info",
+	Warning:  "warning",
+	Critical: "critical",
+}
+
+// String returns the severity name
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalJSON encodes the severity by name
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes a severity name
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for sev, n := range severityNames {
+		if n == name {
+			*s = sev
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", name)
+}
+
+// Alert is a notification raised by a subsystem
+type Alert struct {
+	Time     time.Time         `json:"time"`
+	Severity Severity          `json:"severity"`
+	Source   string            `json:"source"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message,omitempty"`
+	Key      string            `json:"key,omitempty"` // alerts with the same key are deduplicated
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// Notifier delivers alerts
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Func adapts a function to a Notifier
+type Func func(ctx context.Context, a Alert) error
+
+// Notify calls f
+func (f Func) Notify(ctx context.Context, a Alert) error {
+	return f(ctx, a)
+}
+
+// Discard drops every alert
+var Discard Notifier = Func(func(context.Context, Alert) error { return nil })
+
+type route struct {
+	min      Severity
+	notifier Notifier
+}
+
+// Dispatcher fans alerts out to notifiers by minimum severity and suppresses
+// repeats of the same key within the dedup window
+type Dispatcher struct {
+	Dedup time.Duration
+
+	mu     sync.Mutex
+	routes []route
+	sent   map[string]time.Time
+}
+
+// NewDispatcher creates a dispatcher with no routes
+func NewDispatcher(dedup time.Duration) *Dispatcher {
+	return &Dispatcher{Dedup: dedup, sent: make(map[string]time.Time)}
+}
+
+// Route delivers alerts at or above min to n
+func (d *Dispatcher) Route(min Severity, n Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes = append(d.routes, route{min: min, notifier: n})
+}
+
+// Target is a notifier with the minimum severity it receives
+type Target struct {
+	Min      Severity
+	Notifier Notifier
+}
+
+// SetRoutes atomically replaces the dedup window and every route. Alerts
+// being delivered finish on the old routes
+func (d *Dispatcher) SetRoutes(dedup time.Duration, targets ...Target) {
+	routes := make([]route, len(targets))
+	for i, t := range targets {
+		routes[i] = route{min: t.Min, notifier: t.Notifier}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Dedup = dedup
+	d.routes = routes
+}
+
+// Notify delivers an alert to every matching route and joins their errors
+func (d *Dispatcher) Notify(ctx context.Context, a Alert) error {
+	if a.Time.IsZero() {
+		a.Time = time.Now().UTC()
+	}
+
+	d.mu.Lock()
+	if a.Key != "" && d.Dedup > 0 {
+		if last, ok := d.sent[a.Key]; ok && a.Time.Sub(last) < d.Dedup {
+			d.mu.Unlock()
+			return nil
+		}
+		d.sent[a.Key] = a.Time
+	}
+	routes := append([]route(nil), d.routes...)
+	d.mu.Unlock()
+
+	var errs []error
+	for _, r := range routes {
+		if a.Severity < r.min {
+			continue
+		}
+		if err := r.notifier.Notify(ctx, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Webhook posts alerts as JSON to an HTTP endpoint
+type Webhook struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Notify posts the alert
+func (h *Webhook) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := h.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// MessageType is the message type of alerts sent over the messaging layer
+const MessageType = "alert"
+
+// Messenger delivers alerts as encrypted messages to an operator's key
+type Messenger struct {
+	Wallet    *wallet.Wallet
+	Sender    messaging.Sender
+	Recipient *ecdsa.PublicKey
+}
+
+// Notify seals the alert for the recipient and sends it
+func (m *Messenger) Notify(ctx context.Context, a Alert) error {
+	msg, err := messaging.NewMessage(MessageType, a)
+	if err != nil {
+		return err
+	}
+	env, err := messaging.SealMessage(m.Wallet, m.Recipient, "alerts", msg)
+	if err != nil {
+		return err
+	}
+	return m.Sender.Send(ctx, env)
+}
@@ -0,0 +1,262 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+)
+
+const profilePrefix = "anomaly/profile/"
+
+// Kind names an anomaly rule
+type Kind string
+
+const (
+	LargeTransfer   Kind = "large-transfer"
+	NewCounterparty Kind = "new-counterparty"
+	UnusualHour     Kind = "unusual-hour"
+)
+
+// Finding is an outgoing transfer that deviates from the account's profile
+type Finding struct {
+	Kind     Kind
+	Severity alert.Severity
+	Transfer indexer.Transfer
+	Detail   string
+}
+
+// Config holds the detection thresholds
+type Config struct {
+	MinHistory   uint64         // outgoing transfers needed before amount and hour rules apply
+	ZScore       float64        // log-amount z-score for a warning
+	CriticalZ    float64        // log-amount z-score for a critical alert
+	MinStdDev    float64        // floor on the log-amount deviation; 0.25 is roughly ±28%
+	HourShare    float64        // hours with a smaller share of past transfers are unusual
+	MaxBlocks    uint64         // blocks indexed per account per check
+	Location     *time.Location // time zone for hour-of-day profiling
+	NewRecipient alert.Severity // severity for first payments to an address
+}
+
+// DefaultConfig returns thresholds suited to a wallet making a few transfers a day
+func DefaultConfig() Config {
+	return Config{
+		MinHistory:   20,
+		ZScore:       3,
+		CriticalZ:    5,
+		MinStdDev:    0.25,
+		HourShare:    0.02,
+		MaxBlocks:    5000,
+		Location:     time.UTC,
+		NewRecipient: alert.Info,
+	}
+}
+
+// Detector profiles the indexed activity of managed accounts and raises
+// alerts for outgoing transfers that do not fit the profile
+type Detector struct {
+	Indexer  *indexer.Indexer
+	Store    storage.Store
+	Alerts   alert.Notifier
+	Accounts []common.Address
+	Config   Config
+}
+
+// NewDetector creates a detector with DefaultConfig
+func NewDetector(ix *indexer.Indexer, store storage.Store, alerts alert.Notifier, accounts ...common.Address) *Detector {
+	if alerts == nil {
+		alerts = alert.Discard
+	}
+	return &Detector{Indexer: ix, Store: store, Alerts: alerts, Accounts: accounts, Config: DefaultConfig()}
+}
+
+// Train builds an account's profile from historical blocks without raising
+// alerts, replacing any stored profile
+func (d *Detector) Train(ctx context.Context, account common.Address, fromBlock, toBlock uint64) (*Profile, error) {
+	transfers, err := d.Indexer.Transfers(ctx, account, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	p := NewProfile(account)
+	for i := range transfers {
+		p.Learn(&transfers[i], d.location())
+	}
+	p.LastBlock = toBlock
+	return p, d.save(ctx, p)
+}
+
+// Check indexes new blocks for every account, scores each outgoing transfer
+// against the profile learned so far and sends an alert per finding. An
+// account without a profile starts learning from the current head
+func (d *Detector) Check(ctx context.Context) ([]Finding, error) {
+	head, err := d.Indexer.Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, account := range d.Accounts {
+		found, err := d.check(ctx, account, head)
+		if err != nil {
+			return findings, fmt.Errorf("%s: %w", account.Hex(), err)
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+func (d *Detector) check(ctx context.Context, account common.Address, head uint64) ([]Finding, error) {
+	p, err := d.load(ctx, account)
+	if errors.Is(err, storage.ErrNotFound) {
+		p = NewProfile(account)
+		p.LastBlock = head
+		return nil, d.save(ctx, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if head <= p.LastBlock {
+		return nil, nil
+	}
+
+	to := head
+	if d.Config.MaxBlocks > 0 && to-p.LastBlock > d.Config.MaxBlocks {
+		to = p.LastBlock + d.Config.MaxBlocks
+	}
+	transfers, err := d.Indexer.Transfers(ctx, account, p.LastBlock+1, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for i := range transfers {
+		t := &transfers[i]
+		if t.From == account {
+			for _, f := range d.Score(p, t) {
+				if err := d.notify(ctx, f); err != nil {
+					return findings, err
+				}
+				findings = append(findings, f)
+			}
+		}
+		p.Learn(t, d.location())
+	}
+	p.LastBlock = to
+	return findings, d.save(ctx, p)
+}
+
+// Score returns the findings for an outgoing transfer without updating the
+// profile
+func (d *Detector) Score(p *Profile, t *indexer.Transfer) []Finding {
+	var findings []Finding
+	_, known := p.Counterparties[t.To]
+	if !known {
+		findings = append(findings, Finding{
+			Kind:     NewCounterparty,
+			Severity: d.Config.NewRecipient,
+			Transfer: *t,
+			Detail:   "first transfer to " + t.To.Hex(),
+		})
+	}
+	if p.Outgoing < d.Config.MinHistory {
+		return findings
+	}
+
+	if s, ok := p.Amounts[t.Asset]; ok && s.Count >= d.Config.MinHistory {
+		z := s.ZScore(logAmount(t.Amount.Base()), d.Config.MinStdDev)
+		if z >= d.Config.ZScore {
+			sev := alert.Warning
+			// A large payment to a never-seen address is the classic drain pattern
+			if z >= d.Config.CriticalZ || !known {
+				sev = alert.Critical
+			}
+			findings = append(findings, Finding{
+				Kind:     LargeTransfer,
+				Severity: sev,
+				Transfer: *t,
+				Detail:   fmt.Sprintf("amount %s is %.1f standard deviations above the typical transfer", t.Amount, z),
+			})
+		}
+	}
+
+	hour := hourOf(t, d.location())
+	if share := p.HourShare(hour); share < d.Config.HourShare {
+		findings = append(findings, Finding{
+			Kind:     UnusualHour,
+			Severity: alert.Warning,
+			Transfer: *t,
+			Detail:   fmt.Sprintf("%.1f%% of past transfers were made at %02d:00", share*100, hour),
+		})
+	}
+	return findings
+}
+
+// Profile returns the stored profile of an account
+func (d *Detector) Profile(ctx context.Context, account common.Address) (*Profile, error) {
+	return d.load(ctx, account)
+}
+
+// Schedule registers periodic checks with a scheduler
+func (d *Detector) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("anomaly", interval, func(ctx context.Context) error {
+		_, err := d.Check(ctx)
+		return err
+	})
+}
+
+func (d *Detector) notify(ctx context.Context, f Finding) error {
+	t := f.Transfer
+	return d.Alerts.Notify(ctx, alert.Alert{
+		Severity: f.Severity,
+		Source:   "anomaly",
+		Title:    fmt.Sprintf("%s from %s", f.Kind, t.From.Hex()),
+		Message:  fmt.Sprintf("%s (tx %s, block %d)", f.Detail, t.TxHash.Hex(), t.BlockNumber),
+		Key:      "anomaly/" + string(f.Kind) + "/" + t.TxHash.Hex() + "/" + strconv.FormatUint(uint64(t.LogIndex), 10),
+		Labels: map[string]string{
+			"account": t.From.Hex(),
+			"to":      t.To.Hex(),
+			"asset":   t.Asset.Hex(),
+			"tx":      t.TxHash.Hex(),
+		},
+	})
+}
+
+func (d *Detector) location() *time.Location {
+	if d.Config.Location == nil {
+		return time.UTC
+	}
+	return d.Config.Location
+}
+
+func (d *Detector) load(ctx context.Context, account common.Address) (*Profile, error) {
+	data, err := d.Store.Get(ctx, profilePrefix+account.Hex())
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if p.Amounts == nil {
+		p.Amounts = make(map[common.Address]*Stats)
+	}
+	if p.Counterparties == nil {
+		p.Counterparties = make(map[common.Address]uint64)
+	}
+	return &p, nil
+}
+
+func (d *Detector) save(ctx context.Context, p *Profile) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return d.Store.Put(ctx, profilePrefix+p.Account.Hex(), data)
+}
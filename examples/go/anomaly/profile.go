@@ -0,0 +1,100 @@
+package anomaly
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/indexer"
+)
+
+// Stats is a running mean and variance (Welford's algorithm)
+type Stats struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean"`
+	M2    float64 `json:"m2"`
+}
+
+// Add includes a sample
+func (s *Stats) Add(x float64) {
+	s.Count++
+	d := x - s.Mean
+	s.Mean += d / float64(s.Count)
+	s.M2 += d * (x - s.Mean)
+}
+
+// StdDev returns the sample standard deviation
+func (s *Stats) StdDev() float64 {
+	if s.Count < 2 {
+		return 0
+	}
+	return math.Sqrt(s.M2 / float64(s.Count-1))
+}
+
+// ZScore returns how many standard deviations x is above the mean, treating
+// the deviation as at least minStdDev so constant histories stay usable
+func (s *Stats) ZScore(x, minStdDev float64) float64 {
+	return (x - s.Mean) / math.Max(s.StdDev(), minStdDev)
+}
+
+// Profile is the learned spending behaviour of one account
+type Profile struct {
+	Account common.Address `json:"account"`
+	// Amounts tracks the natural log of outgoing amounts per asset, since
+	// transfer sizes are roughly log-normal
+	Amounts        map[common.Address]*Stats `json:"amounts"`
+	Counterparties map[common.Address]uint64 `json:"counterparties"`
+	Hours          [24]uint64                `json:"hours"` // outgoing transfers by hour of day
+	Outgoing       uint64                    `json:"outgoing"`
+	LastBlock      uint64                    `json:"lastBlock"`
+}
+
+// NewProfile creates an empty profile
+func NewProfile(account common.Address) *Profile {
+	return &Profile{
+		Account:        account,
+		Amounts:        make(map[common.Address]*Stats),
+		Counterparties: make(map[common.Address]uint64),
+	}
+}
+
+// Learn adds a transfer to the profile
+func (p *Profile) Learn(t *indexer.Transfer, loc *time.Location) {
+	if t.From == p.Account {
+		p.Counterparties[t.To]++
+		s, ok := p.Amounts[t.Asset]
+		if !ok {
+			s = &Stats{}
+			p.Amounts[t.Asset] = s
+		}
+		s.Add(logAmount(t.Amount.Base()))
+		p.Hours[hourOf(t, loc)]++
+		p.Outgoing++
+	} else {
+		p.Counterparties[t.From]++
+	}
+	if t.BlockNumber > p.LastBlock {
+		p.LastBlock = t.BlockNumber
+	}
+}
+
+// HourShare returns the fraction of outgoing transfers made in an hour
+func (p *Profile) HourShare(hour int) float64 {
+	if p.Outgoing == 0 {
+		return 0
+	}
+	return float64(p.Hours[hour]) / float64(p.Outgoing)
+}
+
+func logAmount(amount *big.Int) float64 {
+	if amount == nil || amount.Sign() <= 0 {
+		return 0
+	}
+	f, _ := new(big.Float).SetInt(amount).Float64()
+	return math.Log(f)
+}
+
+func hourOf(t *indexer.Transfer, loc *time.Location) int {
+	return time.Unix(int64(t.Timestamp), 0).In(loc).Hour()
+}
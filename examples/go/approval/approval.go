@@ -0,0 +1,124 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Message types exchanged over the messaging layer
+const (
+	MessageRequest  = "approval-request"
+	MessageDecision = "approval-decision"
+)
+
+// Status is the state of an approval request
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+	StatusSent     Status = "sent"
+)
+
+// Approver is a party allowed to approve transactions
+type Approver struct {
+	Address   common.Address `json:"address"`
+	PublicKey hexutil.Bytes  `json:"publicKey"` // messaging key for approval requests
+}
+
+// RequestMessage asks an approver to review a signed transaction
+type RequestMessage struct {
+	ID        common.Hash    `json:"id"`
+	Requester common.Address `json:"requester"`
+	RawTx     hexutil.Bytes  `json:"rawTx"`
+	Reason    string         `json:"reason,omitempty"`
+}
+
+// Decision is an approver's signed vote on a request
+type Decision struct {
+	RequestID common.Hash    `json:"requestId"`
+	Approver  common.Address `json:"approver"`
+	Approve   bool           `json:"approve"`
+	Comment   string         `json:"comment,omitempty"`
+	Timestamp int64          `json:"timestamp"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// NewDecision creates a decision signed by the approver's wallet, dated on
+// clk, nil for the wall clock
+func NewDecision(w *wallet.Wallet, requestID common.Hash, approve bool, comment string, clk clock.Clock) (*Decision, error) {
+	d := &Decision{
+		RequestID: requestID,
+		Approver:  w.Address,
+		Approve:   approve,
+		Comment:   comment,
+		Timestamp: clock.Or(clk).Now().Unix(),
+	}
+	sig, err := w.SignMessage(d.payload())
+	if err != nil {
+		return nil, err
+	}
+	d.Signature = sig
+	return d, nil
+}
+
+// Verify checks the approver's signature
+func (d *Decision) Verify() bool {
+	return wallet.VerifySignature(d.payload(), d.Signature, d.Approver)
+}
+
+func (d *Decision) payload() []byte {
+	return []byte("whisperchain-approval:" + d.RequestID.Hex() + ":" +
+		strconv.FormatBool(d.Approve) + ":" + strconv.FormatInt(d.Timestamp, 10) + ":" + d.Comment)
+}
+
+// Request is a transaction awaiting approval
+type Request struct {
+	ID        common.Hash                  `json:"id"`
+	Requester common.Address               `json:"requester"`
+	RawTx     hexutil.Bytes                `json:"rawTx"`
+	Value     *hexutil.Big                 `json:"value"`
+	To        *common.Address              `json:"to"`
+	Required  int                          `json:"required"`
+	Status    Status                       `json:"status"`
+	Decisions map[common.Address]*Decision `json:"decisions"`
+	CreatedAt time.Time                    `json:"createdAt"`
+}
+
+// Approvals returns the number of approving decisions
+func (r *Request) Approvals() int {
+	n := 0
+	for _, d := range r.Decisions {
+		if d.Approve {
+			n++
+		}
+	}
+	return n
+}
+
+func decodeRequest(data []byte) (*Request, error) {
+	var r Request
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Decisions == nil {
+		r.Decisions = make(map[common.Address]*Decision)
+	}
+	return &r, nil
+}
+
+var (
+	ErrPending      = errors.New("approval: request pending")
+	ErrRejected     = errors.New("approval: request rejected")
+	ErrUnknown      = errors.New("approval: unknown request")
+	ErrNotSubmitted = errors.New("approval: transaction needs approval and was not submitted")
+	ErrNoTxManager  = errors.New("approval: wallet has no tx manager to check broadcasts")
+)
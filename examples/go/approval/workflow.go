@@ -0,0 +1,418 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/txmgr"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// requestPrefix is the storage key prefix for approval requests
+const requestPrefix = "approval/request/"
+
+// Policy decides which transactions need approval and from whom
+type Policy struct {
+	Threshold *big.Int // transactions with a value above this need approval; nil for all
+	// TokenThresholds bounds ERC-20 transfers and approvals of each token, in
+	// its base units. Other contract calls and deployments always need approval
+	TokenThresholds map[common.Address]*big.Int
+	Required        int        // number of approvals needed
+	Approvers       []Approver // parties allowed to approve
+}
+
+// NeedsApproval reports whether tx exceeds the policy's thresholds
+func (p *Policy) NeedsApproval(tx *types.Transaction) bool {
+	if p.Threshold == nil || tx.Value().Cmp(p.Threshold) > 0 || tx.To() == nil {
+		return true
+	}
+	if len(tx.Data()) == 0 {
+		return false
+	}
+	limit, ok := p.TokenThresholds[*tx.To()]
+	if !ok {
+		return true
+	}
+	amount, ok := tokenAmount(tx.Data())
+	return !ok || amount.Cmp(limit) > 0
+}
+
+// tokenAmount returns the amount an ERC-20 transfer, transferFrom or approve
+// call moves or allows
+func tokenAmount(data []byte) (*big.Int, bool) {
+	if _, amount, ok := contract.DecodeTransfer(data); ok {
+		return amount, true
+	}
+	if _, amount, ok := contract.DecodeApprove(data); ok {
+		return amount, true
+	}
+	if _, _, amount, ok := contract.DecodeTransferFrom(data); ok {
+		return amount, true
+	}
+	return nil, false
+}
+
+// Workflow collects signed approvals for outgoing transactions before they
+// may be broadcast. It is independent of any on-chain multisig.
+type Workflow struct {
+	Policy Policy
+	Wallet *wallet.Wallet // requester wallet used to seal approval requests
+	Sender messaging.Sender
+	Store  storage.Store
+	Audit  audit.Log
+	Topic  string
+	Clock  clock.Clock // dates requests; nil is the wall clock
+
+	mu sync.Mutex
+}
+
+// NewWorkflow creates an approval workflow
+func NewWorkflow(policy Policy, w *wallet.Wallet, sender messaging.Sender, store storage.Store, auditLog audit.Log) (*Workflow, error) {
+	if policy.Required < 1 || policy.Required > len(policy.Approvers) {
+		return nil, errors.New("required approvals must be between 1 and the number of approvers")
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Workflow{
+		Policy: policy,
+		Wallet: w,
+		Sender: sender,
+		Store:  store,
+		Audit:  auditLog,
+		Topic:  "approvals",
+	}, nil
+}
+
+// Submit registers a signed transaction and, if it exceeds the policy's
+// thresholds, sends approval requests to every approver
+func (wf *Workflow) Submit(ctx context.Context, tx *types.Transaction, reason string) (*Request, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &Request{
+		ID:        tx.Hash(),
+		Requester: wf.Wallet.Address,
+		RawTx:     raw,
+		Value:     (*hexutil.Big)(tx.Value()),
+		To:        tx.To(),
+		Required:  wf.Policy.Required,
+		Status:    StatusPending,
+		Decisions: make(map[common.Address]*Decision),
+		CreatedAt: clock.Or(wf.Clock).Now().UTC(),
+	}
+	if !wf.Policy.NeedsApproval(tx) {
+		req.Status = StatusApproved
+		req.Required = 0
+	}
+
+	wf.mu.Lock()
+	err = wf.save(ctx, req)
+	wf.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	wf.record(ctx, wf.Wallet.Address.Hex(), "approval-submit", req, map[string]string{
+		"value":  tx.Value().String(),
+		"reason": reason,
+	})
+
+	if req.Status == StatusPending {
+		if err := wf.requestApprovals(ctx, req, reason); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// requestApprovals sends a sealed approval request to each approver
+func (wf *Workflow) requestApprovals(ctx context.Context, req *Request, reason string) error {
+	msg, err := messaging.NewMessage(MessageRequest, &RequestMessage{
+		ID:        req.ID,
+		Requester: req.Requester,
+		RawTx:     req.RawTx,
+		Reason:    reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, a := range wf.Policy.Approvers {
+		pub, err := crypto.UnmarshalPubkey(a.PublicKey)
+		if err != nil {
+			return fmt.Errorf("approver %s: %w", a.Address.Hex(), err)
+		}
+		env, err := messaging.SealMessage(wf.Wallet, pub, wf.Topic, msg)
+		if err != nil {
+			return err
+		}
+		if err := wf.Sender.Send(ctx, env); err != nil {
+			return fmt.Errorf("approver %s: %w", a.Address.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// HandleEnvelope processes an approval decision received over the messaging layer
+func (wf *Workflow) HandleEnvelope(ctx context.Context, env *messaging.Envelope) error {
+	if !env.Verify() {
+		return errors.New("invalid envelope")
+	}
+	msg, err := messaging.OpenMessage(env, wf.Wallet.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if msg.Type != MessageDecision {
+		return fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+
+	var d Decision
+	if err := msg.Decode(&d); err != nil {
+		return err
+	}
+	if d.Approver != env.Sender {
+		return errors.New("decision not sent by approver")
+	}
+	return wf.Decide(ctx, &d)
+}
+
+// Decide applies a signed approver decision to its request
+func (wf *Workflow) Decide(ctx context.Context, d *Decision) error {
+	if !d.Verify() {
+		return errors.New("invalid decision signature")
+	}
+	if !wf.isApprover(d.Approver) {
+		return fmt.Errorf("%s is not an approver", d.Approver.Hex())
+	}
+
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+
+	req, err := wf.load(ctx, d.RequestID)
+	if err != nil {
+		return err
+	}
+	if req.Status != StatusPending {
+		return fmt.Errorf("request is %s", req.Status)
+	}
+	if _, ok := req.Decisions[d.Approver]; ok {
+		return errors.New("approver already decided")
+	}
+
+	req.Decisions[d.Approver] = d
+	approvals := req.Approvals()
+	undecided := len(wf.Policy.Approvers) - len(req.Decisions)
+	switch {
+	case approvals >= req.Required:
+		req.Status = StatusApproved
+	case approvals+undecided < req.Required:
+		req.Status = StatusRejected
+	}
+
+	if err := wf.save(ctx, req); err != nil {
+		return err
+	}
+
+	outcome := "reject"
+	if d.Approve {
+		outcome = "approve"
+	}
+	wf.record(ctx, d.Approver.Hex(), "approval-decision", req, map[string]string{
+		"decision":  outcome,
+		"comment":   d.Comment,
+		"approvals": strconv.Itoa(approvals),
+	})
+	return nil
+}
+
+// Authorize returns nil if the transaction may be broadcast: it is within
+// the policy's thresholds or its request was approved
+func (wf *Workflow) Authorize(ctx context.Context, tx *types.Transaction) error {
+	if !wf.Policy.NeedsApproval(tx) {
+		return nil
+	}
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+
+	req, err := wf.load(ctx, tx.Hash())
+	if errors.Is(err, ErrUnknown) {
+		return ErrNotSubmitted
+	}
+	if err != nil {
+		return err
+	}
+	switch req.Status {
+	case StatusApproved, StatusSent:
+		return nil
+	case StatusRejected:
+		return ErrRejected
+	default:
+		return ErrPending
+	}
+}
+
+// Install makes the wallet's tx manager refuse to broadcast transactions
+// that need approval and were not approved, so over-threshold sends must be
+// submitted and go out through Broadcast
+func (wf *Workflow) Install(w *wallet.Wallet) error {
+	m := w.Settings().TxManager
+	if m == nil {
+		return ErrNoTxManager
+	}
+	m.WrapCheck(func(next txmgr.CheckFunc) txmgr.CheckFunc {
+		return func(ctx context.Context, tx *types.Transaction) error {
+			if err := wf.Authorize(ctx, tx); err != nil {
+				return err
+			}
+			if next != nil {
+				return next(ctx, tx)
+			}
+			return nil
+		}
+	})
+	return nil
+}
+
+// Broadcast sends an approved transaction through the wallet's client
+func (wf *Workflow) Broadcast(ctx context.Context, id common.Hash) (*types.Transaction, error) {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+
+	req, err := wf.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch req.Status {
+	case StatusApproved:
+	case StatusRejected:
+		return nil, ErrRejected
+	default:
+		return nil, ErrPending
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(req.RawTx); err != nil {
+		return nil, err
+	}
+	client, err := wf.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	req.Status = StatusSent
+	if err := wf.save(ctx, req); err != nil {
+		return tx, err
+	}
+	wf.record(ctx, wf.Wallet.Address.Hex(), "approval-broadcast", req, nil)
+	return tx, nil
+}
+
+// Get returns a request by ID
+func (wf *Workflow) Get(ctx context.Context, id common.Hash) (*Request, error) {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	return wf.load(ctx, id)
+}
+
+func (wf *Workflow) isApprover(addr common.Address) bool {
+	for _, a := range wf.Policy.Approvers {
+		if a.Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (wf *Workflow) load(ctx context.Context, id common.Hash) (*Request, error) {
+	data, err := wf.Store.Get(ctx, requestPrefix+id.Hex())
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrUnknown
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeRequest(data)
+}
+
+func (wf *Workflow) save(ctx context.Context, req *Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return wf.Store.Put(ctx, requestPrefix+req.ID.Hex(), data)
+}
+
+func (wf *Workflow) record(ctx context.Context, actor, action string, req *Request, details map[string]string) {
+	wf.Audit.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  action,
+		Subject: req.ID.Hex(),
+		Outcome: string(req.Status),
+		Details: details,
+	})
+}
+
+// Respond opens an approval request envelope, lets review inspect the
+// transaction, and replies to the requester with a signed decision dated on
+// clk, nil for the wall clock
+func Respond(ctx context.Context, w *wallet.Wallet, sender messaging.Sender, env *messaging.Envelope, review func(req *RequestMessage, tx *types.Transaction) (bool, string), clk clock.Clock) (*Decision, error) {
+	msg, err := messaging.OpenMessage(env, w.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessageRequest {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+
+	var req RequestMessage
+	if err := msg.Decode(&req); err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(req.RawTx); err != nil {
+		return nil, err
+	}
+	if tx.Hash() != req.ID {
+		return nil, errors.New("request ID does not match transaction")
+	}
+
+	approve, comment := review(&req, tx)
+	d, err := NewDecision(w, req.ID, approve, comment, clk)
+	if err != nil {
+		return nil, err
+	}
+
+	requester, err := env.SenderKey()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := messaging.NewMessage(MessageDecision, d)
+	if err != nil {
+		return nil, err
+	}
+	out, err := messaging.SealMessage(w, requester, env.Topic, reply)
+	if err != nil {
+		return nil, err
+	}
+	return d, sender.Send(ctx, out)
+}
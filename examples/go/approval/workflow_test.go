@@ -0,0 +1,298 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+var token = common.HexToAddress("0x00000000000000000000000000000000000070c0")
+
+// fakeNode is an eth RPC namespace that records the transactions it is sent
+type fakeNode struct {
+	mu    sync.Mutex
+	nonce uint64
+	sent  []common.Hash
+}
+
+func (f *fakeNode) ChainId() *hexutil.Big { return (*hexutil.Big)(big.NewInt(1337)) }
+
+func (f *fakeNode) GetTransactionCount(addr common.Address, block string) hexutil.Uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return hexutil.Uint64(f.nonce)
+}
+
+func (f *fakeNode) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Hash{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nonce++
+	f.sent = append(f.sent, tx.Hash())
+	return tx.Hash(), nil
+}
+
+func (f *fakeNode) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent)
+}
+
+// outbox is a messaging.Sender keeping what it is given
+type outbox struct {
+	mu   sync.Mutex
+	envs []*messaging.Envelope
+}
+
+func (o *outbox) Send(ctx context.Context, env *messaging.Envelope) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.envs = append(o.envs, env)
+	return nil
+}
+
+// take returns and forgets the envelopes sent to addr
+func (o *outbox) take(addr common.Address) []*messaging.Envelope {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out, rest []*messaging.Envelope
+	for _, env := range o.envs {
+		if env.Recipient == addr {
+			out = append(out, env)
+		} else {
+			rest = append(rest, env)
+		}
+	}
+	o.envs = rest
+	return out
+}
+
+type fixture struct {
+	node      *fakeNode
+	out       *outbox
+	requester *wallet.Wallet
+	approvers []*wallet.Wallet
+	wf        *Workflow
+}
+
+// newFixture creates a workflow needing two of three approvals for more than
+// 1 ETH or 100 base units of token
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{node: &fakeNode{}, out: &outbox{}}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", f.node); err != nil {
+		t.Fatal(err)
+	}
+	client := ethclient.NewClient(rpc.DialInProc(srv))
+	t.Cleanup(func() {
+		client.Close()
+		srv.Stop()
+	})
+
+	newWallet := func() *wallet.Wallet {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wallet.NewWalletFromClient(key, client)
+	}
+	f.requester = newWallet()
+	policy := Policy{
+		Threshold:       big.NewInt(1e18),
+		TokenThresholds: map[common.Address]*big.Int{token: big.NewInt(100)},
+		Required:        2,
+	}
+	for i := 0; i < 3; i++ {
+		a := newWallet()
+		f.approvers = append(f.approvers, a)
+		policy.Approvers = append(policy.Approvers, Approver{Address: a.Address, PublicKey: crypto.FromECDSAPub(a.PublicKey)})
+	}
+	wf, err := NewWorkflow(policy, f.requester, f.out, storage.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.Install(f.requester); err != nil {
+		t.Fatal(err)
+	}
+	f.wf = wf
+	return f
+}
+
+// opts fixes the gas so transactions build without estimation
+func opts(data []byte) *wallet.TxOpts {
+	fee := units.WeiFromUint64(1e9)
+	return &wallet.TxOpts{GasLimit: 100000, GasFeeCap: &fee, GasTipCap: &fee, Data: data}
+}
+
+// sign builds and signs a transaction at the node's next nonce
+func (f *fixture) sign(t *testing.T, to common.Address, value units.Wei, data []byte) *types.Transaction {
+	ctx := context.Background()
+	tx, err := f.requester.BuildTx(ctx, to, value, opts(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := f.requester.SignTx(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// decide has approver i answer every request it was sent
+func (f *fixture) decide(t *testing.T, i int, approve bool) {
+	ctx := context.Background()
+	a := f.approvers[i]
+	for _, env := range f.out.take(a.Address) {
+		if _, err := Respond(ctx, a, f.out, env, func(*RequestMessage, *types.Transaction) (bool, string) {
+			return approve, ""
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, env := range f.out.take(f.requester.Address) {
+		if err := f.wf.HandleEnvelope(ctx, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSubmitAppliesTokenThresholds(t *testing.T) {
+	f := newFixture(t)
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tests := []struct {
+		name  string
+		to    common.Address
+		value units.Wei
+		data  []byte
+		want  Status
+	}{
+		{"small payment", other, units.WeiFromUint64(1e17), nil, StatusApproved},
+		{"large payment", other, units.WeiFromUint64(2e18), nil, StatusPending},
+		{"small transfer", token, units.Wei{}, must(t)(contract.TransferData(other, big.NewInt(100))), StatusApproved},
+		{"large transfer", token, units.Wei{}, must(t)(contract.TransferData(other, big.NewInt(101))), StatusPending},
+		{"large approve", token, units.Wei{}, must(t)(contract.ApproveData(other, big.NewInt(1000))), StatusPending},
+		{"unlisted token", other, units.Wei{}, must(t)(contract.TransferData(other, big.NewInt(1))), StatusPending},
+		{"other call", token, units.Wei{}, []byte{0xde, 0xad, 0xbe, 0xef}, StatusPending},
+	}
+	for _, tt := range tests {
+		tx := f.sign(t, tt.to, tt.value, tt.data)
+		req, err := f.wf.Submit(context.Background(), tx, tt.name)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if req.Status != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, req.Status, tt.want)
+		}
+	}
+}
+
+func TestInstalledWorkflowHoldsPendingTransactions(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	large := must(t)(contract.TransferData(common.HexToAddress("0xaa"), big.NewInt(500)))
+
+	if _, err := f.requester.SendTx(ctx, token, units.Wei{}, opts(large)); !errors.Is(err, ErrNotSubmitted) {
+		t.Fatalf("unsubmitted send: got %v", err)
+	}
+	small := must(t)(contract.TransferData(common.HexToAddress("0xaa"), big.NewInt(5)))
+	if _, err := f.requester.SendTx(ctx, token, units.Wei{}, opts(small)); err != nil {
+		t.Fatalf("send within threshold: %v", err)
+	}
+
+	tx := f.sign(t, token, units.Wei{}, large)
+	req, err := f.wf.Submit(ctx, tx, "payroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != StatusPending {
+		t.Fatalf("status %s", req.Status)
+	}
+	if err := f.requester.TxManager.Check(ctx, tx); !errors.Is(err, ErrPending) {
+		t.Fatalf("check while pending: got %v", err)
+	}
+	if _, err := f.wf.Broadcast(ctx, req.ID); !errors.Is(err, ErrPending) {
+		t.Fatalf("broadcast while pending: got %v", err)
+	}
+
+	f.decide(t, 0, true)
+	if req, _ = f.wf.Get(ctx, req.ID); req.Status != StatusPending {
+		t.Fatalf("one of two approvals: %s", req.Status)
+	}
+	f.decide(t, 1, true)
+	if req, _ = f.wf.Get(ctx, req.ID); req.Status != StatusApproved {
+		t.Fatalf("two approvals: %s", req.Status)
+	}
+	if err := f.requester.TxManager.Check(ctx, tx); err != nil {
+		t.Fatalf("check once approved: %v", err)
+	}
+	if _, err := f.wf.Broadcast(ctx, req.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.node.count(); n != 2 {
+		t.Fatalf("node got %d transactions, want the small send and the approved one", n)
+	}
+}
+
+func TestRejectedRequestIsNeverSent(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	tx := f.sign(t, common.HexToAddress("0xaa"), units.WeiFromUint64(5e18), nil)
+	req, err := f.wf.Submit(ctx, tx, "bonus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.decide(t, 0, false)
+	f.decide(t, 1, false)
+	if req, _ = f.wf.Get(ctx, req.ID); req.Status != StatusRejected {
+		t.Fatalf("two of three rejected: %s", req.Status)
+	}
+	if err := f.requester.TxManager.Check(ctx, tx); !errors.Is(err, ErrRejected) {
+		t.Fatalf("check: got %v", err)
+	}
+	if _, err := f.wf.Broadcast(ctx, req.ID); !errors.Is(err, ErrRejected) {
+		t.Fatalf("broadcast: got %v", err)
+	}
+	if err := f.wf.Decide(ctx, mustDecide(t, f.approvers[2], req.ID)); err == nil {
+		t.Fatal("decision on a closed request")
+	}
+	if n := f.node.count(); n != 0 {
+		t.Fatalf("node got %d transactions", n)
+	}
+}
+
+// must returns a calldata builder's result, failing t on error
+func must(t *testing.T) func([]byte, error) []byte {
+	return func(data []byte, err error) []byte {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+}
+
+func mustDecide(t *testing.T, w *wallet.Wallet, id common.Hash) *Decision {
+	d, err := NewDecision(w, id, true, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
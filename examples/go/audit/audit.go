@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a single audit record
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	Actor   string            `json:"actor"`
+	Action  string            `json:"action"`
+	Subject string            `json:"subject,omitempty"`
+	Outcome string            `json:"outcome"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Log records audit entries
+type Log interface {
+	Record(ctx context.Context, e Entry) error
+}
+
+// MemoryLog keeps audit entries in memory
+type MemoryLog struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+// NewMemoryLog creates an empty in-memory audit log
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{}
+}
+
+// Record appends an entry, stamping the time if unset
+func (m *MemoryLog) Record(ctx context.Context, e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+// Entries returns a copy of all recorded entries
+func (m *MemoryLog) Entries() []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Entry(nil), m.entries...)
+}
+
+// Last returns up to n of the most recent entries
+func (m *MemoryLog) Last(n int) []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if n > len(m.entries) {
+		n = len(m.entries)
+	}
+	return append([]Entry(nil), m.entries[len(m.entries)-n:]...)
+}
+
+// FileLog appends audit entries to a file as JSON lines
+type FileLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFileLog opens or creates an append-only JSON lines audit file
+func OpenFileLog(path string) (*FileLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLog{file: f}, nil
+}
+
+// Record appends an entry, stamping the time if unset
+func (l *FileLog) Record(ctx context.Context, e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the underlying file
+func (l *FileLog) Close() error {
+	return l.file.Close()
+}
+
+// Discard is a Log that drops every entry
+var Discard Log = discard{}
+
+type discard struct{}
+
+func (discard) Record(ctx context.Context, e Entry) error { return nil }
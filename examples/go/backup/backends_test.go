@@ -0,0 +1,301 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/whisperchain/go-examples/storage"
+)
+
+// objects is the bucket behind the fake cloud APIs; list pages hold two keys
+// so pagination is exercised
+type objects struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newObjects() *objects {
+	return &objects{data: make(map[string][]byte)}
+}
+
+func (o *objects) page(prefix, token string) (keys []string, next string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var all []string
+	for k := range o.data {
+		if strings.HasPrefix(k, prefix) {
+			all = append(all, k)
+		}
+	}
+	sort.Strings(all)
+	start, _ := strconv.Atoi(token)
+	end := start + 2
+	if end >= len(all) {
+		return all[start:], ""
+	}
+	return all[start:end], strconv.Itoa(end)
+}
+
+func (o *objects) get(key string) ([]byte, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	v, ok := o.data[key]
+	return v, ok
+}
+
+func (o *objects) put(key string, v []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.data[key] = v
+}
+
+func (o *objects) delete(key string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, ok := o.data[key]
+	delete(o.data, key)
+	return ok
+}
+
+// handlerClient sends every request to h, whatever its host
+func handlerClient(h http.Handler) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Result(), nil
+	})}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func fakeS3(o *objects) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("x-amz-content-sha256") != sha256Hex(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+		switch {
+		case key == "" && r.Method == http.MethodGet:
+			keys, next := o.page(r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+			var res struct {
+				XMLName  xml.Name `xml:"ListBucketResult"`
+				Contents []struct {
+					Key string `xml:"Key"`
+				} `xml:"Contents"`
+				IsTruncated           bool   `xml:"IsTruncated"`
+				NextContinuationToken string `xml:"NextContinuationToken"`
+			}
+			for _, k := range keys {
+				res.Contents = append(res.Contents, struct {
+					Key string `xml:"Key"`
+				}{k})
+			}
+			res.IsTruncated, res.NextContinuationToken = next != "", next
+			xml.NewEncoder(w).Encode(&res)
+		case r.Method == http.MethodGet:
+			if v, ok := o.get(key); ok {
+				w.Write(v)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPut:
+			o.put(key, body)
+		case r.Method == http.MethodDelete:
+			o.delete(key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+func fakeGCS(o *objects) http.Handler {
+	const objectsPath = "/storage/v1/b/bucket/o"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := r.URL.EscapedPath()
+		switch {
+		case r.Method == http.MethodPost && path == "/upload"+objectsPath:
+			body, _ := io.ReadAll(r.Body)
+			o.put(r.URL.Query().Get("name"), body)
+		case r.Method == http.MethodGet && path == objectsPath:
+			keys, next := o.page(r.URL.Query().Get("prefix"), r.URL.Query().Get("pageToken"))
+			page := map[string]interface{}{"nextPageToken": next}
+			var items []map[string]string
+			for _, k := range keys {
+				items = append(items, map[string]string{"name": k})
+			}
+			page["items"] = items
+			json.NewEncoder(w).Encode(page)
+		case strings.HasPrefix(path, objectsPath+"/"):
+			key, _ := url.PathUnescape(strings.TrimPrefix(path, objectsPath+"/"))
+			if r.Method == http.MethodDelete {
+				if !o.delete(key) {
+					w.WriteHeader(http.StatusNotFound)
+				}
+				return
+			}
+			if v, ok := o.get(key); ok && r.URL.Query().Get("alt") == "media" {
+				w.Write(v)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+}
+
+func fakeDropbox(o *objects) http.Handler {
+	notFound := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error_summary":"path/not_found/"}`)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var arg map[string]interface{}
+		if h := r.Header.Get("Dropbox-API-Arg"); h != "" {
+			json.Unmarshal([]byte(h), &arg)
+		} else {
+			json.NewDecoder(r.Body).Decode(&arg)
+		}
+		path, _ := arg["path"].(string)
+		switch r.Host + r.URL.Path {
+		case "content.dropboxapi.com/2/files/upload":
+			body, _ := io.ReadAll(r.Body)
+			o.put(path, body)
+		case "content.dropboxapi.com/2/files/download":
+			if v, ok := o.get(path); ok {
+				w.Write(v)
+			} else {
+				notFound(w)
+			}
+		case "api.dropboxapi.com/2/files/delete_v2":
+			if !o.delete(path) {
+				notFound(w)
+			}
+		case "api.dropboxapi.com/2/files/list_folder", "api.dropboxapi.com/2/files/list_folder/continue":
+			cursor, _ := arg["cursor"].(string)
+			prefix, token, _ := strings.Cut(cursor, "|")
+			if cursor == "" {
+				prefix = path + "/"
+			}
+			keys, next := o.page(prefix, token)
+			var entries []map[string]string
+			for _, k := range keys {
+				entries = append(entries, map[string]string{".tag": "file", "path_display": k})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"entries": entries, "cursor": prefix + "|" + next, "has_more": next != "",
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+}
+
+func TestBackends(t *testing.T) {
+	token := func(context.Context) (string, error) { return "token", nil }
+	backends := map[string]func() storage.Store{
+		"s3": func() storage.Store {
+			return &S3{Endpoint: "https://s3.test", Region: "eu-west-1", Bucket: "bucket", AccessKey: "AK", SecretKey: "SK",
+				HTTPClient: handlerClient(fakeS3(newObjects()))}
+		},
+		"gcs": func() storage.Store {
+			return &GCS{Bucket: "bucket", Token: token, HTTPClient: handlerClient(fakeGCS(newObjects()))}
+		},
+		"dropbox": func() storage.Store {
+			return &Dropbox{Token: "token", Root: "/backups", HTTPClient: handlerClient(fakeDropbox(newObjects()))}
+		},
+	}
+	for name, newStore := range backends {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, newStore())
+
+			// A full backup cycle over the backend
+			ctx := context.Background()
+			m, err := NewManager(newStore(), "phone", secret, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.Keep = 2
+			for i := 0; i < 3; i++ {
+				if _, err := m.Backup(ctx, snapshot(time.Unix(1_700_000_000+int64(i), 0))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			latest, err := m.Latest(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			snap, err := m.Restore(ctx, latest.Name)
+			if err != nil || snap.Created.Unix() != 1_700_000_002 {
+				t.Fatalf("restored %v, %v", snap, err)
+			}
+			if versions, _ := m.Versions(ctx); len(versions) != 2 {
+				t.Fatalf("kept %d versions", len(versions))
+			}
+		})
+	}
+}
+
+// testStore checks the storage.Store contract
+func testStore(t *testing.T, s storage.Store) {
+	t.Helper()
+	ctx := context.Background()
+	keys := []string{"a/3", "a/1", "b/1", "a/2", "a/sub/4"}
+	for _, k := range keys {
+		if err := s.Put(ctx, k, []byte("v"+k)); err != nil {
+			t.Fatalf("put %s: %v", k, err)
+		}
+	}
+	v, err := s.Get(ctx, "a/sub/4")
+	if err != nil || string(v) != "va/sub/4" {
+		t.Fatalf("get: %q, %v", v, err)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("get missing: %v", err)
+	}
+
+	listed, err := s.List(ctx, "a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(listed, ",") != "a/1,a/2,a/3,a/sub/4" {
+		t.Fatalf("list: %v", listed)
+	}
+
+	if err := s.Delete(ctx, "a/2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "a/2"); err != nil {
+		t.Fatalf("delete missing: %v", err)
+	}
+	if _, err := s.Get(ctx, "a/2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("get deleted: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/storage"
+)
+
+// Snapshot is the backed-up state: encrypted keystores and application state
+// such as contacts and messaging data, taken from a storage.Store
+type Snapshot struct {
+	Created   time.Time                  `json:"created"`
+	Keystores map[string]json.RawMessage `json:"keystores,omitempty"` // V3 keystore JSON by address
+	State     map[string][]byte          `json:"state,omitempty"`
+}
+
+// Capture copies every key under the given prefixes, or the whole store when
+// no prefix is given
+func Capture(ctx context.Context, store storage.Store, prefixes ...string) (*Snapshot, error) {
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	snap := &Snapshot{Created: time.Now().UTC(), State: make(map[string][]byte)}
+	for _, prefix := range prefixes {
+		keys, err := store.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			value, err := store.Get(ctx, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue // deleted while capturing
+			}
+			if err != nil {
+				return nil, err
+			}
+			snap.State[key] = value
+		}
+	}
+	return snap, nil
+}
+
+// AddKeystore includes an encrypted V3 keystore in the snapshot
+func (s *Snapshot) AddKeystore(address string, keystoreJSON []byte) error {
+	if !json.Valid(keystoreJSON) {
+		return errors.New("backup: keystore is not valid JSON")
+	}
+	if s.Keystores == nil {
+		s.Keystores = make(map[string]json.RawMessage)
+	}
+	s.Keystores[strings.ToLower(address)] = append(json.RawMessage(nil), keystoreJSON...)
+	return nil
+}
+
+// Restore writes the snapshot's state into store, overwriting existing keys
+func (s *Snapshot) Restore(ctx context.Context, store storage.Store) error {
+	keys := make([]string, 0, len(s.State))
+	for key := range s.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := store.Put(ctx, key, s.State[key]); err != nil {
+			return fmt.Errorf("restore %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// objectPrefix namespaces backup objects in a backend
+const objectPrefix = "whisperchain-backup/"
+
+// versionLayout sorts lexically in time order
+const versionLayout = "20060102T150405.000000000Z"
+
+// Version describes one stored backup
+type Version struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Size    int       `json:"size"`
+	Digest  string    `json:"digest,omitempty"` // SHA-256 of the plaintext, set when verified
+}
+
+// Manager stores versioned, end-to-end encrypted backups in a backend. Any
+// storage.Store works as a backend: a FileStore, or the S3, GCS and Dropbox
+// stores in this package
+type Manager struct {
+	Backend storage.Store
+	Name    string // backup set, e.g. a device or wallet label
+	Secret  Secret
+	Keep    int // versions to retain, zero keeps everything
+	Audit   audit.Log
+	Rand    io.Reader // salts and nonces; nil is crypto/rand
+}
+
+// NewManager creates a manager for a named backup set
+func NewManager(backend storage.Store, name string, secret Secret, auditLog audit.Log) (*Manager, error) {
+	if err := secret.Validate(); err != nil {
+		return nil, err
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return nil, errors.New("backup: invalid backup set name")
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Manager{Backend: backend, Name: name, Secret: secret, Keep: 10, Audit: auditLog}, nil
+}
+
+func (m *Manager) prefix() string {
+	return objectPrefix + m.Name + "/"
+}
+
+// Backup encrypts and uploads a snapshot, then downloads it again and checks
+// that it decrypts to the same content before pruning old versions
+func (m *Manager) Backup(ctx context.Context, snap *Snapshot) (*Version, error) {
+	plaintext, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(m.Rand, plaintext, m.Secret, snap.Created)
+	if err != nil {
+		return nil, err
+	}
+	v := &Version{
+		Name:    m.prefix() + snap.Created.UTC().Format(versionLayout) + ".wcb",
+		Created: snap.Created.UTC(),
+		Size:    len(sealed),
+	}
+	if err := m.Backend.Put(ctx, v.Name, sealed); err != nil {
+		m.record(ctx, "backup-upload", v.Name, "failed")
+		return nil, err
+	}
+
+	digest, err := m.verify(ctx, v.Name)
+	if err == nil && digest != hexDigest(plaintext) {
+		err = errors.New("backup: stored copy does not match the snapshot")
+	}
+	if err != nil {
+		m.record(ctx, "backup-verify", v.Name, "failed")
+		return nil, err
+	}
+	v.Digest = digest
+	m.record(ctx, "backup-upload", v.Name, "verified")
+	return v, m.prune(ctx)
+}
+
+// Versions lists stored backups, newest first
+func (m *Manager) Versions(ctx context.Context) ([]Version, error) {
+	names, err := m.Backend.List(ctx, m.prefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []Version
+	for _, name := range names {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, m.prefix()), ".wcb")
+		created, err := time.Parse(versionLayout, stamp)
+		if err != nil {
+			continue // not written by a Manager
+		}
+		out = append(out, Version{Name: name, Created: created})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// Latest returns the newest stored backup
+func (m *Manager) Latest(ctx context.Context) (*Version, error) {
+	versions, err := m.Versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &versions[0], nil
+}
+
+// Verify downloads a backup and checks that it decrypts, returning the
+// plaintext digest. Run it periodically to catch backend corruption or a
+// forgotten secret before a restore is needed
+func (m *Manager) Verify(ctx context.Context, name string) (string, error) {
+	digest, err := m.verify(ctx, name)
+	outcome := "ok"
+	if err != nil {
+		outcome = "failed"
+	}
+	m.record(ctx, "backup-verify", name, outcome)
+	return digest, err
+}
+
+func (m *Manager) verify(ctx context.Context, name string) (string, error) {
+	data, err := m.Backend.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	plaintext, _, err := open(data, m.Secret)
+	if err != nil {
+		return "", err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(plaintext, &snap); err != nil {
+		return "", err
+	}
+	return hexDigest(plaintext), nil
+}
+
+// Restore downloads and decrypts a backup
+func (m *Manager) Restore(ctx context.Context, name string) (*Snapshot, error) {
+	if !strings.HasPrefix(name, m.prefix()) {
+		return nil, fmt.Errorf("backup: %s is not in set %s", name, m.Name)
+	}
+	data, err := m.Backend.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, h, err := open(data, m.Secret)
+	if err != nil {
+		m.record(ctx, "backup-restore", name, "failed")
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(plaintext, &snap); err != nil {
+		return nil, err
+	}
+	if !snap.Created.Equal(h.Created) {
+		return nil, errors.New("backup: header does not match contents")
+	}
+	m.record(ctx, "backup-restore", name, "ok")
+	return &snap, nil
+}
+
+func (m *Manager) prune(ctx context.Context) error {
+	if m.Keep <= 0 {
+		return nil
+	}
+	versions, err := m.Versions(ctx)
+	if err != nil {
+		return err
+	}
+	for i := m.Keep; i < len(versions); i++ {
+		if err := m.Backend.Delete(ctx, versions[i].Name); err != nil {
+			return err
+		}
+		m.record(ctx, "backup-prune", versions[i].Name, "deleted")
+	}
+	return nil
+}
+
+func (m *Manager) record(ctx context.Context, action, name, outcome string) {
+	m.Audit.Record(ctx, audit.Entry{
+		Actor:   "backup",
+		Action:  action,
+		Subject: name,
+		Outcome: outcome,
+		Details: map[string]string{"set": m.Name},
+	})
+}
+
+func hexDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
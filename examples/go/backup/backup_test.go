@@ -0,0 +1,225 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/storage"
+)
+
+const mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+var secret = Secret{Passphrase: "correct horse", Mnemonic: mnemonic}
+
+func TestMain(m *testing.M) {
+	// Keep key derivation fast; the format records the cost it used
+	scryptN = 1 << 10
+	os.Exit(m.Run())
+}
+
+func snapshot(created time.Time) *Snapshot {
+	snap := &Snapshot{
+		Created: created.UTC(),
+		State:   map[string][]byte{"contacts/alice": []byte(`{"name":"alice"}`), "messages/1": {0, 1, 2}},
+	}
+	if err := snap.AddKeystore("0xABC", []byte(`{"version":3}`)); err != nil {
+		panic(err)
+	}
+	return snap
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	log := audit.NewMemoryLog()
+	m, err := NewManager(storage.NewMemoryStore(), "phone", secret, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap := snapshot(time.Unix(1_700_000_000, 0))
+	v, err := m.Backup(ctx, snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Digest == "" {
+		t.Fatal("backup not verified")
+	}
+
+	latest, err := m.Latest(ctx)
+	if err != nil || latest.Name != v.Name {
+		t.Fatalf("latest %v, %v", latest, err)
+	}
+	got, err := m.Restore(ctx, v.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Created.Equal(snap.Created) || !bytes.Equal(got.State["messages/1"], snap.State["messages/1"]) ||
+		string(got.Keystores["0xabc"]) != `{"version":3}` {
+		t.Fatal("restored a different snapshot")
+	}
+
+	// Restoring into a store writes every key
+	store := storage.NewMemoryStore()
+	if err := got.Restore(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Capture(ctx, store)
+	if err != nil || len(again.State) != len(snap.State) {
+		t.Fatalf("captured %d keys, %v", len(again.State), err)
+	}
+}
+
+func TestWrongSecretFails(t *testing.T) {
+	ctx := context.Background()
+	backend := storage.NewMemoryStore()
+	m, err := NewManager(backend, "phone", secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := m.Backup(ctx, snapshot(time.Unix(1_700_000_000, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	for name, s := range map[string]Secret{
+		"passphrase only": {Passphrase: secret.Passphrase, Mnemonic: other},
+		"mnemonic only":   {Passphrase: "wrong", Mnemonic: secret.Mnemonic},
+	} {
+		wrong, err := NewManager(backend, "phone", s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wrong.Restore(ctx, v.Name); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: got %v", name, err)
+		}
+		if _, err := wrong.Verify(ctx, v.Name); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s verify: got %v", name, err)
+		}
+	}
+}
+
+func TestTamperedBackupFails(t *testing.T) {
+	sealed, err := seal(nil, []byte(`{"created":"2023-11-14T22:13:20Z"}`), secret, time.Unix(1_700_000_000, 0).UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdrLen := int(binary.BigEndian.Uint32(sealed[len(magic):]))
+	body := len(magic) + 4 + hdrLen
+
+	header := func(edit func(h map[string]interface{})) []byte {
+		var h map[string]interface{}
+		if err := json.Unmarshal(sealed[len(magic)+4:body], &h); err != nil {
+			t.Fatal(err)
+		}
+		edit(h)
+		hdr, _ := json.Marshal(h)
+		out := append([]byte(nil), magic...)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(hdr)))
+		out = append(out, hdr...)
+		return append(out, sealed[body:]...)
+	}
+	flip := func(i int) []byte {
+		c := append([]byte(nil), sealed...)
+		c[i] ^= 1
+		return c
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"ciphertext", flip(len(sealed) - 20), ErrDecrypt},
+		{"tag", flip(len(sealed) - 1), ErrDecrypt},
+		{"created", header(func(h map[string]interface{}) { h["created"] = "2024-01-01T00:00:00Z" }), ErrDecrypt},
+		{"salt", header(func(h map[string]interface{}) { h["salt"] = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=" }), ErrDecrypt},
+		{"magic", flip(0), nil},
+		{"truncated", sealed[:6], nil},
+		{"huge cost", header(func(h map[string]interface{}) { h["n"] = 1 << 30 }), nil},
+		{"version", header(func(h map[string]interface{}) { h["version"] = 2 }), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := open(tt.data, secret)
+			if err == nil {
+				t.Fatal("tampered backup opened")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if plaintext, _, err := open(sealed, secret); err != nil || !bytes.Contains(plaintext, []byte("2023")) {
+		t.Fatalf("untampered backup: %v", err)
+	}
+}
+
+func TestVersionsAndPrune(t *testing.T) {
+	ctx := context.Background()
+	backend := storage.NewMemoryStore()
+	m, err := NewManager(backend, "phone", secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Keep = 2
+
+	start := time.Unix(1_700_000_000, 0)
+	var names []string
+	for i := 0; i < 4; i++ {
+		v, err := m.Backup(ctx, snapshot(start.Add(time.Duration(i)*time.Hour)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, v.Name)
+	}
+	// Foreign objects are ignored
+	if err := backend.Put(ctx, m.prefix()+"notes.txt", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := m.Versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Name != names[3] || versions[1].Name != names[2] {
+		t.Fatalf("got %+v", versions)
+	}
+
+	other, err := NewManager(backend, "laptop", secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Restore(ctx, names[3]); err == nil {
+		t.Fatal("restored a backup from another set")
+	}
+	if _, err := other.Latest(ctx); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("empty set: got %v", err)
+	}
+}
+
+func TestNewManagerValidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    string
+		secret Secret
+	}{
+		{"no passphrase", "phone", Secret{Mnemonic: mnemonic}},
+		{"bad mnemonic", "phone", Secret{Passphrase: "x", Mnemonic: "abandon abandon"}},
+		{"empty set", "", secret},
+		{"nested set", "a/b", secret},
+	}
+	for _, tt := range tests {
+		if _, err := NewManager(storage.NewMemoryStore(), tt.set, tt.secret, nil); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
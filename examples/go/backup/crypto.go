@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/tyler-smith/go-bip39"
+	"github.com/whisperchain/go-examples/entropy"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// magic prefixes every sealed backup
+var magic = []byte("WCBK")
+
+const formatVersion = 1
+
+// Scrypt cost for new backups, matching the standard keystore parameters;
+// tests lower it. Opening uses the cost recorded in each backup's header
+var (
+	scryptN = 1 << 18
+	scryptR = 8
+	scryptP = 1
+)
+
+// maxPlaintext bounds decompression of a restored backup
+const maxPlaintext = 256 << 20
+
+// ErrDecrypt is returned when a backup cannot be opened with the given secret
+var ErrDecrypt = errors.New("backup: wrong passphrase or mnemonic, or corrupted backup")
+
+// Secret is what a backup key is derived from. Both parts are required, so a
+// leaked passphrase alone or a leaked mnemonic alone cannot open a backup
+type Secret struct {
+	Passphrase string
+	Mnemonic   string
+}
+
+// Validate checks that both parts are present and the mnemonic is well formed
+func (s Secret) Validate() error {
+	if s.Passphrase == "" {
+		return errors.New("backup: passphrase is required")
+	}
+	if !bip39.IsMnemonicValid(s.Mnemonic) {
+		return errors.New("backup: invalid mnemonic")
+	}
+	return nil
+}
+
+// header is stored in clear before the ciphertext and authenticated with it
+type header struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Salt    []byte    `json:"salt"`
+	N       int       `json:"n"`
+	R       int       `json:"r"`
+	P       int       `json:"p"`
+	Nonce   []byte    `json:"nonce"`
+}
+
+func deriveKey(secret Secret, h *header) ([]byte, error) {
+	stretched, err := scrypt.Key([]byte(secret.Passphrase), h.Salt, h.N, h.R, h.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	seed := bip39.NewSeed(secret.Mnemonic, "")
+	ikm := append(stretched, seed...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, h.Salt, []byte("whisperchain-backup-v1")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// seal compresses and encrypts plaintext with AES-256-GCM, drawing the salt
+// and nonce from rand
+func seal(rand io.Reader, plaintext []byte, secret Secret, created time.Time) ([]byte, error) {
+	if err := secret.Validate(); err != nil {
+		return nil, err
+	}
+	h := &header{Version: formatVersion, Created: created, Salt: make([]byte, 32), N: scryptN, R: scryptR, P: scryptP, Nonce: make([]byte, 12)}
+	if err := entropy.Read(rand, h.Salt); err != nil {
+		return nil, err
+	}
+	if err := entropy.Read(rand, h.Nonce); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(secret, h)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), magic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(hdr)))
+	out = append(out, hdr...)
+	return aead.Seal(out, h.Nonce, compressed.Bytes(), out), nil
+}
+
+// open reverses seal and returns the plaintext and the backup header
+func open(data []byte, secret Secret) ([]byte, *header, error) {
+	if len(data) < len(magic)+4 || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, nil, errors.New("backup: not a WhisperChain backup")
+	}
+	n := int(binary.BigEndian.Uint32(data[len(magic):]))
+	start := len(magic) + 4
+	if n > 4096 || len(data) < start+n {
+		return nil, nil, errors.New("backup: malformed header")
+	}
+	var h header
+	if err := json.Unmarshal(data[start:start+n], &h); err != nil {
+		return nil, nil, err
+	}
+	if h.Version != formatVersion {
+		return nil, nil, errors.New("backup: unsupported format version")
+	}
+	// Refuse parameters that would make key derivation unreasonably slow or
+	// memory hungry; a hostile backend controls the header
+	if h.N <= 1 || h.N > 1<<20 || h.R <= 0 || h.R > 32 || h.P <= 0 || h.P > 16 || len(h.Salt) < 16 || len(h.Nonce) != 12 {
+		return nil, nil, errors.New("backup: unsupported key derivation parameters")
+	}
+
+	aead, err := newAEAD(secret, &h)
+	if err != nil {
+		return nil, nil, err
+	}
+	compressed, err := aead.Open(nil, h.Nonce, data[start+n:], data[:start+n])
+	if err != nil {
+		return nil, nil, ErrDecrypt
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := io.ReadAll(io.LimitReader(zr, maxPlaintext+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(plaintext) > maxPlaintext {
+		return nil, nil, errors.New("backup: plaintext too large")
+	}
+	return plaintext, &h, nil
+}
+
+func newAEAD(secret Secret, h *header) (cipher.AEAD, error) {
+	key, err := deriveKey(secret, h)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
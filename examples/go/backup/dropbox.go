@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/whisperchain/go-examples/storage"
+)
+
+// Dropbox API hosts
+const (
+	dropboxAPI     = "https://api.dropboxapi.com/2"
+	dropboxContent = "https://content.dropboxapi.com/2"
+)
+
+// Dropbox is a storage.Store backed by a Dropbox app folder. Keys map to
+// paths under Root
+type Dropbox struct {
+	Token      string // OAuth 2.0 access token
+	Root       string // folder inside the app folder, e.g. /backups
+	HTTPClient *http.Client
+}
+
+// Get downloads a file
+func (d *Dropbox) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := d.content(ctx, "/files/download", map[string]interface{}{"path": d.path(key)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Put uploads a file, replacing any existing version
+func (d *Dropbox) Put(ctx context.Context, key string, value []byte) error {
+	arg := map[string]interface{}{"path": d.path(key), "mode": "overwrite", "mute": true}
+	resp, err := d.content(ctx, "/files/upload", arg, value)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Delete removes a file; deleting a missing file is not an error
+func (d *Dropbox) Delete(ctx context.Context, key string) error {
+	err := d.rpc(ctx, "/files/delete_v2", map[string]interface{}{"path": d.path(key)}, nil)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// List returns the sorted keys that start with prefix
+func (d *Dropbox) List(ctx context.Context, prefix string) ([]string, error) {
+	root := d.path("")
+	dir := path.Dir(d.path(prefix + "x"))
+	type page struct {
+		Entries []struct {
+			Tag         string `json:".tag"`
+			PathDisplay string `json:"path_display"`
+		} `json:"entries"`
+		Cursor  string `json:"cursor"`
+		HasMore bool   `json:"has_more"`
+	}
+
+	var p page
+	err := d.rpc(ctx, "/files/list_folder", map[string]interface{}{"path": dropboxFolder(dir), "recursive": true}, &p)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	var keys []string
+	for err == nil {
+		for _, e := range p.Entries {
+			if e.Tag != "file" {
+				continue
+			}
+			key := strings.TrimPrefix(strings.TrimPrefix(e.PathDisplay, root), "/")
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		if !p.HasMore {
+			break
+		}
+		cursor := p.Cursor
+		p = page{}
+		err = d.rpc(ctx, "/files/list_folder/continue", map[string]interface{}{"cursor": cursor}, &p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (d *Dropbox) path(key string) string {
+	return path.Join("/", d.Root, key)
+}
+
+// dropboxFolder maps the root folder to the empty path the API expects
+func dropboxFolder(p string) string {
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
+// rpc calls an endpoint that takes and returns JSON
+func (d *Dropbox) rpc(ctx context.Context, endpoint string, arg, out interface{}) error {
+	body, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dropboxAPI+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// content calls an endpoint that passes its argument in the Dropbox-API-Arg
+// header and file data in the body
+func (d *Dropbox) content(ctx context.Context, endpoint string, arg interface{}, data []byte) (*http.Response, error) {
+	header, err := json.Marshal(arg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dropboxContent+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.Token)
+	req.Header.Set("Dropbox-API-Arg", string(header))
+	if data != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return d.send(req)
+}
+
+// send maps Dropbox's not_found path errors, reported as 409, to
+// storage.ErrNotFound
+func (d *Dropbox) send(req *http.Request) (*http.Response, error) {
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if bytes.Contains(msg, []byte("not_found")) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.New("backup: dropbox: " + string(msg))
+	}
+	return checkStatus(req, resp)
+}
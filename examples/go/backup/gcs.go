@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/whisperchain/go-examples/storage"
+)
+
+// gcsAPI is the Cloud Storage JSON API root
+const gcsAPI = "https://storage.googleapis.com"
+
+// GCS is a storage.Store backed by a Google Cloud Storage bucket
+type GCS struct {
+	Bucket     string
+	Token      func(ctx context.Context) (string, error) // OAuth 2.0 access token source
+	HTTPClient *http.Client
+}
+
+// Get downloads an object
+func (g *GCS) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := g.do(ctx, http.MethodGet, "/storage/v1/b/"+url.PathEscape(g.Bucket)+"/o/"+url.PathEscape(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Put uploads an object
+func (g *GCS) Put(ctx context.Context, key string, value []byte) error {
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	resp, err := g.do(ctx, http.MethodPost, "/upload/storage/v1/b/"+url.PathEscape(g.Bucket)+"/o?"+query.Encode(), value)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Delete removes an object; deleting a missing object is not an error
+func (g *GCS) Delete(ctx context.Context, key string) error {
+	resp, err := g.do(ctx, http.MethodDelete, "/storage/v1/b/"+url.PathEscape(g.Bucket)+"/o/"+url.PathEscape(key), nil)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// List returns the sorted keys that start with prefix
+func (g *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+		resp, err := g.do(ctx, http.MethodGet, "/storage/v1/b/"+url.PathEscape(g.Bucket)+"/o?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			keys = append(keys, item.Name)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		token = page.NextPageToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (g *GCS) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	token, err := g.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, gcsAPI+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return send(g.HTTPClient, req)
+}
@@ -0,0 +1,35 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/whisperchain/go-examples/storage"
+)
+
+// send performs a request and maps 404 to storage.ErrNotFound and other
+// non-2xx statuses to errors
+func send(client *http.Client, req *http.Request) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return checkStatus(req, resp)
+}
+
+// checkStatus passes 2xx responses through and closes the body of others
+func checkStatus(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, storage.ErrNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("backup: %s %s: %s: %s", req.Method, req.URL.Host, resp.Status, msg)
+}
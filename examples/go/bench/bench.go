@@ -0,0 +1,313 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/whisperchain/go-examples/rpcpool"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// maxErrorSamples bounds the distinct errors kept per operation
+const maxErrorSamples = 5
+
+// Workload is what each endpoint is measured on
+type Workload struct {
+	Operations  []Operation   // DefaultReads when empty
+	Requests    int           // per operation per endpoint; zero is 100
+	Concurrency int           // requests in flight per operation; zero is 4
+	Timeout     time.Duration // per request; zero is 10 seconds
+	// Sends, when positive, sends that many zero-value self-transfers from
+	// Wallet through each endpoint, one at a time, timing submission and
+	// receipt. Only on chains in rpcpool.Testnets
+	Sends          int
+	Wallet         *wallet.Wallet
+	ReceiptTimeout time.Duration // zero is two minutes
+}
+
+// OpResult is one operation's outcome on one endpoint
+type OpResult struct {
+	Operation  string        `json:"operation"`
+	Requests   int           `json:"requests"`
+	Errors     int           `json:"errors"`
+	Latency    Latency       `json:"latency"`
+	Throughput float64       `json:"throughput"` // successful requests per second
+	Elapsed    time.Duration `json:"elapsed"`
+	Samples    []string      `json:"errorSamples,omitempty"`
+}
+
+// ErrorRate returns the share of failed requests
+func (r *OpResult) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Requests)
+}
+
+// EndpointResult is everything measured on one endpoint
+type EndpointResult struct {
+	Endpoint   string     `json:"endpoint"`
+	Operations []OpResult `json:"operations"`
+	Err        string     `json:"error,omitempty"` // set when the endpoint could not be benchmarked
+}
+
+// Report compares endpoints on one workload
+type Report struct {
+	Started   time.Time        `json:"started"`
+	Endpoints []EndpointResult `json:"endpoints"`
+	// Best names, per operation, the endpoint with the lowest p90 among
+	// those failing at most 1% of requests
+	Best map[string]string `json:"best"`
+}
+
+// Run benchmarks each endpoint in turn, so they do not compete for the
+// local network, and compares them
+func Run(ctx context.Context, endpoints []*rpcpool.Endpoint, w Workload) (*Report, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("bench: no endpoints")
+	}
+	if w.Sends > 0 && w.Wallet == nil {
+		return nil, errors.New("bench: sends need a wallet")
+	}
+	if len(w.Operations) == 0 {
+		w.Operations = DefaultReads()
+	}
+	if w.Requests <= 0 {
+		w.Requests = 100
+	}
+	if w.Concurrency <= 0 {
+		w.Concurrency = 4
+	}
+	if w.Timeout <= 0 {
+		w.Timeout = 10 * time.Second
+	}
+	if w.ReceiptTimeout <= 0 {
+		w.ReceiptTimeout = 2 * time.Minute
+	}
+
+	r := &Report{Started: time.Now().UTC(), Best: make(map[string]string)}
+	for _, e := range endpoints {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r.Endpoints = append(r.Endpoints, runEndpoint(ctx, e, &w))
+	}
+	r.rank()
+	return r, nil
+}
+
+func runEndpoint(ctx context.Context, e *rpcpool.Endpoint, w *Workload) EndpointResult {
+	res := EndpointResult{Endpoint: e.Name}
+	head, err := e.Client.BlockNumber(ctx)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	for _, op := range w.Operations {
+		res.Operations = append(res.Operations, runOperation(ctx, e, op, head, w))
+	}
+	if w.Sends > 0 {
+		submit, mined := runSends(ctx, e, w)
+		res.Operations = append(res.Operations, submit, mined)
+	}
+	return res
+}
+
+// runOperation sends w.Requests requests of op from w.Concurrency workers
+func runOperation(ctx context.Context, e *rpcpool.Endpoint, op Operation, head uint64, w *Workload) OpResult {
+	var (
+		mu      sync.Mutex
+		samples []time.Duration
+		res     = OpResult{Operation: op.Name, Requests: w.Requests}
+		next    = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range next {
+				reqCtx, cancel := context.WithTimeout(ctx, w.Timeout)
+				t := time.Now()
+				err := op.Run(reqCtx, e.Client, head)
+				d := time.Since(t)
+				cancel()
+				mu.Lock()
+				if err != nil {
+					res.addError(err)
+				} else {
+					samples = append(samples, d)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < w.Requests; i++ {
+		next <- struct{}{}
+	}
+	close(next)
+	wg.Wait()
+	res.finish(samples, time.Since(start))
+	return res
+}
+
+// runSends times submission and inclusion of self-transfers
+func runSends(ctx context.Context, e *rpcpool.Endpoint, w *Workload) (submit, mined OpResult) {
+	submit = OpResult{Operation: "eth_sendRawTransaction", Requests: w.Sends}
+	mined = OpResult{Operation: "receipt", Requests: w.Sends}
+	var submitted, included []time.Duration
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		submit.finish(submitted, elapsed)
+		mined.finish(included, elapsed)
+	}()
+
+	chainID, err := e.Client.ChainID(ctx)
+	if err == nil {
+		if _, ok := rpcpool.Testnets[chainID.Uint64()]; !ok {
+			err = rpcpool.ErrNotTestnet
+		}
+	}
+	if err != nil {
+		for i := 0; i < w.Sends; i++ {
+			submit.addError(err)
+			mined.addError(err)
+		}
+		return submit, mined
+	}
+
+	for i := 0; i < w.Sends; i++ {
+		t, err := sendOne(ctx, e, w)
+		if err != nil {
+			submit.addError(err)
+			mined.addError(err)
+			continue
+		}
+		submitted = append(submitted, t.submitted)
+		if t.err != nil {
+			mined.addError(t.err)
+			continue
+		}
+		included = append(included, t.mined)
+	}
+	return submit, mined
+}
+
+type sendTiming struct {
+	submitted, mined time.Duration
+	err              error // waiting for the receipt failed
+}
+
+func sendOne(ctx context.Context, e *rpcpool.Endpoint, w *Workload) (*sendTiming, error) {
+	nonce, err := e.Client.PendingNonceAt(ctx, w.Wallet.Address)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := w.Wallet.BuildTx(ctx, w.Wallet.Address, units.Wei{}, &wallet.TxOpts{Nonce: &nonce})
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := w.Wallet.SignTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if err := e.Client.SendTransaction(ctx, signedTx); err != nil {
+		return nil, err
+	}
+	t := &sendTiming{submitted: time.Since(start)}
+	waitCtx, cancel := context.WithTimeout(ctx, w.ReceiptTimeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		_, err := e.Client.TransactionReceipt(waitCtx, signedTx.Hash())
+		if err == nil {
+			t.mined = time.Since(start)
+			return t, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			t.err = err
+			return t, nil
+		}
+		select {
+		case <-waitCtx.Done():
+			t.err = fmt.Errorf("bench: %s not mined: %w", signedTx.Hash().Hex(), waitCtx.Err())
+			return t, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *OpResult) addError(err error) {
+	r.Errors++
+	msg := err.Error()
+	for _, s := range r.Samples {
+		if s == msg {
+			return
+		}
+	}
+	if len(r.Samples) < maxErrorSamples {
+		r.Samples = append(r.Samples, msg)
+	}
+}
+
+func (r *OpResult) finish(samples []time.Duration, elapsed time.Duration) {
+	r.Latency = Summarize(samples)
+	r.Elapsed = elapsed
+	if elapsed > 0 {
+		r.Throughput = float64(len(samples)) / elapsed.Seconds()
+	}
+}
+
+// rank fills Best
+func (r *Report) rank() {
+	best := make(map[string]OpResult)
+	for _, e := range r.Endpoints {
+		for _, op := range e.Operations {
+			if op.ErrorRate() > 0.01 || op.Requests == op.Errors {
+				continue
+			}
+			if b, ok := best[op.Operation]; !ok || op.Latency.P90 < b.Latency.P90 {
+				best[op.Operation] = op
+				r.Best[op.Operation] = e.Endpoint
+			}
+		}
+	}
+}
+
+// WriteTable writes the report as an aligned text table, one row per
+// endpoint and operation, marking the best endpoint for each operation
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tOPERATION\tREQS\tERRORS\tP50\tP90\tP99\tMAX\tREQ/S\t")
+	for _, e := range r.Endpoints {
+		if e.Err != "" {
+			fmt.Fprintf(tw, "%s\t-\t-\t%s\t\t\t\t\t\t\n", e.Endpoint, e.Err)
+			continue
+		}
+		for _, op := range e.Operations {
+			mark := ""
+			if r.Best[op.Operation] == e.Endpoint {
+				mark = "*"
+			}
+			l := op.Latency
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%.1f\t%s\n", e.Endpoint, op.Operation, op.Requests, op.Errors,
+				ms(l.P50), ms(l.P90), ms(l.P99), ms(l.Max), op.Throughput, mark)
+		}
+	}
+	return tw.Flush()
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
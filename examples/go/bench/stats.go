@@ -0,0 +1,46 @@
+package bench
+
+import (
+	"sort"
+	"time"
+)
+
+// Latency summarizes the latencies of successful requests
+type Latency struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// Summarize computes a latency summary; samples are sorted in place
+func Summarize(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	var sum time.Duration
+	for _, d := range samples {
+		sum += d
+	}
+	return Latency{
+		Mean: sum / time.Duration(len(samples)),
+		P50:  percentile(samples, 0.50),
+		P90:  percentile(samples, 0.90),
+		P99:  percentile(samples, 0.99),
+		Max:  samples[len(samples)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
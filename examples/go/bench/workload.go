@@ -0,0 +1,69 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Operation is one kind of request in a workload
+type Operation struct {
+	Name string
+	Run  func(ctx context.Context, c *ethclient.Client, head uint64) error // head is read once before the run
+}
+
+// BlockNumber reads the head block number
+func BlockNumber() Operation {
+	return Operation{Name: "eth_blockNumber", Run: func(ctx context.Context, c *ethclient.Client, head uint64) error {
+		_, err := c.BlockNumber(ctx)
+		return err
+	}}
+}
+
+// Balance reads an account balance at the head
+func Balance(addr common.Address) Operation {
+	return Operation{Name: "eth_getBalance", Run: func(ctx context.Context, c *ethclient.Client, head uint64) error {
+		_, err := c.BalanceAt(ctx, addr, nil)
+		return err
+	}}
+}
+
+// Block reads the head block with its transactions
+func Block() Operation {
+	return Operation{Name: "eth_getBlockByNumber", Run: func(ctx context.Context, c *ethclient.Client, head uint64) error {
+		_, err := c.BlockByNumber(ctx, nil)
+		return err
+	}}
+}
+
+// Call runs an eth_call at the head, such as a token balanceOf
+func Call(msg ethereum.CallMsg) Operation {
+	return Operation{Name: "eth_call", Run: func(ctx context.Context, c *ethclient.Client, head uint64) error {
+		_, err := c.CallContract(ctx, msg, nil)
+		return err
+	}}
+}
+
+// Logs queries the span blocks up to the head for logs matching q's
+// addresses and topics, as indexers and watchers do
+func Logs(q ethereum.FilterQuery, span uint64) Operation {
+	return Operation{Name: "eth_getLogs", Run: func(ctx context.Context, c *ethclient.Client, head uint64) error {
+		if head < span {
+			return errors.New("bench: chain is shorter than the log span")
+		}
+		q := q
+		q.FromBlock = new(big.Int).SetUint64(head - span + 1)
+		q.ToBlock = new(big.Int).SetUint64(head)
+		_, err := c.FilterLogs(ctx, q)
+		return err
+	}}
+}
+
+// DefaultReads is a light read workload that any endpoint can serve
+func DefaultReads() []Operation {
+	return []Operation{BlockNumber(), Balance(common.Address{}), Block(), Logs(ethereum.FilterQuery{}, 10)}
+}
@@ -0,0 +1,343 @@
+package bot
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/policy"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const (
+	// Topic is the messaging topic bots listen on
+	Topic = "bot"
+	// MessageCommand carries a CommandMessage
+	MessageCommand = "bot.command"
+	// MessageReply carries a Reply
+	MessageReply = "bot.reply"
+)
+
+// processedPrefix is the storage key prefix for handled envelope IDs
+const processedPrefix = "bot/processed/"
+
+// ErrNotCommand is returned for text that does not start with a slash
+var ErrNotCommand = errors.New("bot: commands start with /")
+
+// CommandMessage is the body of a command message
+type CommandMessage struct {
+	Text string `json:"text"`
+}
+
+// Reply is sent back to the sender of a command
+type Reply struct {
+	Command string       `json:"command"`
+	OK      bool         `json:"ok"`
+	Text    string       `json:"text"`
+	TxHash  *common.Hash `json:"txHash,omitempty"`
+	Status  string       `json:"status,omitempty"` // submitted, confirmed or failed for transactions
+}
+
+// Command is a parsed "/name arg..." line
+type Command struct {
+	Name string
+	Args []string
+	Text string
+}
+
+// Parse splits a command line into its lower-cased name and arguments
+func Parse(text string) (*Command, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return nil, ErrNotCommand
+	}
+	fields := strings.Fields(text[1:])
+	if len(fields) == 0 {
+		return nil, errors.New("bot: empty command")
+	}
+	return &Command{Name: strings.ToLower(fields[0]), Args: fields[1:], Text: text}, nil
+}
+
+// Request is a verified command together with who sent it
+type Request struct {
+	Command   *Command
+	Sender    common.Address
+	SenderKey *ecdsa.PublicKey
+	Envelope  *messaging.Envelope
+}
+
+// Result is the outcome of an executed action
+type Result struct {
+	Text string
+	Tx   *types.Transaction // set when the action sent a transaction
+}
+
+// Action is what a command will do once the policy engine allows it. Name,
+// Resource and Attributes form the policy request; Summary is echoed back
+// when the action is denied or fails
+type Action struct {
+	Name       string
+	Resource   string
+	Attributes map[string]string
+	Summary    string
+	Public     bool // skips the policy engine; for read-only commands such as /help
+	Execute    func(ctx context.Context) (*Result, error)
+}
+
+// HandlerFunc validates a command's arguments and returns the action to
+// execute. Returned errors are sent back to the sender as usage errors
+type HandlerFunc func(ctx context.Context, req *Request) (*Action, error)
+
+type handler struct {
+	usage string
+	fn    HandlerFunc
+}
+
+// Bot answers commands received over WhisperChain messages. Every action is
+// evaluated by the policy engine with the sender's address as subject before
+// it runs; a bot without rules denies everything but public commands
+type Bot struct {
+	Wallet       *wallet.Wallet
+	Sender       messaging.Sender
+	Policy       *policy.Engine
+	Store        storage.Store
+	Audit        audit.Log
+	MaxAge       time.Duration // commands older than this are ignored
+	ConfirmMined bool          // send a second reply once a transaction is mined
+	Clock        clock.Clock   // ages commands; nil is the wall clock
+
+	mu       sync.RWMutex
+	handlers map[string]handler
+}
+
+// New creates a bot with a /help command. A nil engine denies every action
+// that is not public
+func New(w *wallet.Wallet, sender messaging.Sender, engine *policy.Engine, store storage.Store, auditLog audit.Log) *Bot {
+	if engine == nil {
+		engine = policy.NewEngine(false)
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	b := &Bot{
+		Wallet:   w,
+		Sender:   sender,
+		Policy:   engine,
+		Store:    store,
+		Audit:    auditLog,
+		MaxAge:   10 * time.Minute,
+		handlers: make(map[string]handler),
+	}
+	b.Handle("help", "/help", b.help)
+	return b
+}
+
+// Handle registers a command; usage is shown by /help and on usage errors
+func (b *Bot) Handle(name, usage string, fn HandlerFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[strings.ToLower(name)] = handler{usage: usage, fn: fn}
+}
+
+// HandleEnvelope verifies, runs and answers one command envelope. Envelopes
+// are handled at most once. With ConfirmMined set it returns after the
+// transaction is mined
+func (b *Bot) HandleEnvelope(ctx context.Context, env *messaging.Envelope) (*Reply, error) {
+	if !env.Verify() {
+		return nil, errors.New("invalid envelope")
+	}
+	if env.Recipient != b.Wallet.Address {
+		return nil, fmt.Errorf("envelope is for %s", env.Recipient.Hex())
+	}
+	if b.MaxAge > 0 && clock.Since(b.Clock, time.Unix(env.Timestamp, 0)) > b.MaxAge {
+		return nil, errors.New("command expired")
+	}
+	senderKey, err := env.SenderKey()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := messaging.OpenMessage(env, b.Wallet.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessageCommand {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	var body CommandMessage
+	if err := msg.Decode(&body); err != nil {
+		return nil, err
+	}
+
+	fresh, err := b.claim(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, errors.New("command already handled")
+	}
+
+	cmd, err := Parse(body.Text)
+	if err != nil {
+		return b.reply(ctx, senderKey, &Reply{Text: err.Error()})
+	}
+	req := &Request{Command: cmd, Sender: env.Sender, SenderKey: senderKey, Envelope: env}
+	reply, tx := b.run(ctx, req)
+	reply, err = b.reply(ctx, senderKey, reply)
+	if err != nil || tx == nil || !b.ConfirmMined {
+		return reply, err
+	}
+
+	confirmation := &Reply{Command: cmd.Name, TxHash: reply.TxHash}
+	rcpt, err := b.Wallet.WaitMined(ctx, tx)
+	switch {
+	case err != nil:
+		confirmation.Status, confirmation.Text = "failed", err.Error()
+	case rcpt.Status != types.ReceiptStatusSuccessful:
+		confirmation.Status, confirmation.Text = "failed", fmt.Sprintf("reverted in block %s", rcpt.BlockNumber)
+	default:
+		h := rcpt.TxHash
+		confirmation.OK, confirmation.Status, confirmation.TxHash = true, "confirmed", &h
+		confirmation.Text = fmt.Sprintf("confirmed in block %s", rcpt.BlockNumber)
+	}
+	return b.reply(ctx, senderKey, confirmation)
+}
+
+// run validates, authorizes and executes a command
+func (b *Bot) run(ctx context.Context, req *Request) (*Reply, *types.Transaction) {
+	name := req.Command.Name
+	b.mu.RLock()
+	h, ok := b.handlers[name]
+	b.mu.RUnlock()
+	if !ok {
+		return &Reply{Command: name, Text: fmt.Sprintf("unknown command /%s; try /help", name)}, nil
+	}
+
+	action, err := h.fn(ctx, req)
+	if err != nil {
+		b.record(ctx, req, name, "invalid")
+		return &Reply{Command: name, Text: err.Error() + "; usage: " + h.usage}, nil
+	}
+
+	if !action.Public {
+		d := b.Policy.Evaluate(policy.Request{
+			Subject:    req.Sender.Hex(),
+			Action:     action.Name,
+			Resource:   action.Resource,
+			Attributes: action.Attributes,
+		})
+		if !d.Allowed {
+			b.record(ctx, req, action.Name, "denied")
+			return &Reply{Command: name, Text: "denied by policy: " + action.Summary}, nil
+		}
+	}
+
+	res, err := action.Execute(ctx)
+	if err != nil {
+		b.record(ctx, req, action.Name, "failed")
+		return &Reply{Command: name, Text: action.Summary + " failed: " + err.Error()}, nil
+	}
+	b.record(ctx, req, action.Name, "executed")
+	reply := &Reply{Command: name, OK: true, Text: res.Text}
+	if res.Tx != nil {
+		h := res.Tx.Hash()
+		reply.TxHash, reply.Status = &h, "submitted"
+	}
+	return reply, res.Tx
+}
+
+// help lists the registered commands
+func (b *Bot) help(ctx context.Context, req *Request) (*Action, error) {
+	b.mu.RLock()
+	usages := make([]string, 0, len(b.handlers))
+	for _, h := range b.handlers {
+		usages = append(usages, h.usage)
+	}
+	b.mu.RUnlock()
+	sort.Strings(usages)
+	return &Action{
+		Name:    "help",
+		Summary: "help",
+		Public:  true,
+		Execute: func(ctx context.Context) (*Result, error) {
+			return &Result{Text: strings.Join(usages, "\n")}, nil
+		},
+	}, nil
+}
+
+// claim marks an envelope as handled, reporting false if it already was
+func (b *Bot) claim(ctx context.Context, env *messaging.Envelope) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := processedPrefix + env.ID.Hex()
+	if _, err := b.Store.Get(ctx, key); err == nil {
+		return false, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return false, err
+	}
+	return true, b.Store.Put(ctx, key, []byte(clock.Or(b.Clock).Now().UTC().Format(time.RFC3339)))
+}
+
+func (b *Bot) reply(ctx context.Context, to *ecdsa.PublicKey, reply *Reply) (*Reply, error) {
+	msg, err := messaging.NewMessage(MessageReply, reply)
+	if err != nil {
+		return reply, err
+	}
+	env, err := messaging.SealMessage(b.Wallet, to, Topic, msg)
+	if err != nil {
+		return reply, err
+	}
+	return reply, b.Sender.Send(ctx, env)
+}
+
+func (b *Bot) record(ctx context.Context, req *Request, action, outcome string) {
+	b.Audit.Record(ctx, audit.Entry{
+		Actor:   req.Sender.Hex(),
+		Action:  "bot-" + action,
+		Subject: req.Envelope.ID.Hex(),
+		Outcome: outcome,
+		Details: map[string]string{"command": req.Command.Text},
+	})
+}
+
+// SendCommand seals a command line to a bot
+func SendCommand(ctx context.Context, w *wallet.Wallet, sender messaging.Sender, botKey *ecdsa.PublicKey, text string) (*messaging.Envelope, error) {
+	msg, err := messaging.NewMessage(MessageCommand, CommandMessage{Text: text})
+	if err != nil {
+		return nil, err
+	}
+	env, err := messaging.SealMessage(w, botKey, Topic, msg)
+	if err != nil {
+		return nil, err
+	}
+	return env, sender.Send(ctx, env)
+}
+
+// OpenReply decodes a reply envelope from a bot
+func OpenReply(env *messaging.Envelope, key *ecdsa.PrivateKey) (*Reply, error) {
+	if !env.Verify() {
+		return nil, errors.New("invalid envelope")
+	}
+	msg, err := messaging.OpenMessage(env, key)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessageReply {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	var reply Reply
+	if err := msg.Decode(&reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
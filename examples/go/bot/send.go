@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// ErrUnknownName is returned by resolvers for names they do not know
+var ErrUnknownName = errors.New("bot: unknown name")
+
+// Asset is a currency /send accepts; the zero address is ETH
+type Asset struct {
+	Symbol   string
+	Address  common.Address
+	Decimals uint8
+}
+
+// Resolver maps names such as bob.eth to addresses
+type Resolver interface {
+	Resolve(ctx context.Context, name string) (common.Address, error)
+}
+
+// StaticResolver is an address book keyed by lower-cased name
+type StaticResolver map[string]common.Address
+
+// Resolve looks name up case-insensitively
+func (r StaticResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	addr, ok := r[strings.ToLower(name)]
+	if !ok {
+		return common.Address{}, fmt.Errorf("%w: %s", ErrUnknownName, name)
+	}
+	return addr, nil
+}
+
+// SendHandler implements "/send <amount> <symbol> to <recipient>", paying
+// from the wallet. The recipient is a hex address or a name known to the
+// resolver. The policy request has action "send", the recipient address as
+// resource and asset, amount (decimal), wei (base units) and to attributes
+func SendHandler(w *wallet.Wallet, assets []Asset, resolver Resolver) HandlerFunc {
+	bySymbol := make(map[string]Asset, len(assets))
+	for _, a := range assets {
+		bySymbol[strings.ToUpper(a.Symbol)] = a
+	}
+	return func(ctx context.Context, req *Request) (*Action, error) {
+		args := req.Command.Args
+		if len(args) == 4 && strings.EqualFold(args[2], "to") {
+			args = []string{args[0], args[1], args[3]}
+		}
+		if len(args) != 3 {
+			return nil, errors.New("expected amount, asset and recipient")
+		}
+		asset, ok := bySymbol[strings.ToUpper(args[1])]
+		if !ok {
+			return nil, fmt.Errorf("unknown asset %s", args[1])
+		}
+		amount, err := units.ParseUnits(args[0], asset.Decimals)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Sign() <= 0 {
+			return nil, errors.New("amount must be positive")
+		}
+		to, err := resolve(ctx, resolver, args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		summary := fmt.Sprintf("send %s %s to %s", args[0], asset.Symbol, args[2])
+		return &Action{
+			Name:     "send",
+			Resource: to.Hex(),
+			Attributes: map[string]string{
+				"asset":  asset.Symbol,
+				"amount": args[0],
+				"wei":    amount.String(),
+				"to":     args[2],
+			},
+			Summary: summary,
+			Execute: func(ctx context.Context) (*Result, error) {
+				var opts *wallet.TxOpts
+				target, value := to, units.NewWei(amount)
+				if asset.Address != (common.Address{}) {
+					data, err := contract.TransferData(to, amount)
+					if err != nil {
+						return nil, err
+					}
+					opts = &wallet.TxOpts{Data: data}
+					target, value = asset.Address, units.Wei{}
+				}
+				tx, err := w.SendTx(ctx, target, value, opts)
+				if err != nil {
+					return nil, err
+				}
+				return &Result{Text: summary + ": submitted " + tx.Hash().Hex(), Tx: tx}, nil
+			},
+		}, nil
+	}
+}
+
+func resolve(ctx context.Context, resolver Resolver, name string) (common.Address, error) {
+	if common.IsHexAddress(name) {
+		return common.HexToAddress(name), nil
+	}
+	if resolver == nil {
+		return common.Address{}, fmt.Errorf("%w: %s", ErrUnknownName, name)
+	}
+	return resolver.Resolve(ctx, name)
+}
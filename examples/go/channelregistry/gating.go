@@ -0,0 +1,116 @@
+package channelregistry
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/streampay"
+)
+
+// Gating is who may join a channel. The zero value is an open channel.
+// It is stored on-chain ABI-encoded so contracts can read it too
+type Gating struct {
+	Token      common.Address // members must hold MinBalance of Token; zero for no token gate
+	MinBalance *big.Int
+	Asset      common.Address // streamed payment asset, or the zero address for ETH
+	Rate       *big.Int       // streamed payment per Window; nil or zero for free
+	Window     time.Duration
+	Grace      time.Duration
+}
+
+// gatingArgs is the on-chain layout of Gating
+var gatingArgs = func() abi.Arguments {
+	address, _ := abi.NewType("address", "", nil)
+	uint256, _ := abi.NewType("uint256", "", nil)
+	uint64T, _ := abi.NewType("uint64", "", nil)
+	return abi.Arguments{{Type: address}, {Type: uint256}, {Type: address}, {Type: uint256}, {Type: uint64T}, {Type: uint64T}}
+}()
+
+// Open reports whether anyone may join
+func (g *Gating) Open() bool {
+	return !g.TokenGated() && !g.Paid()
+}
+
+// TokenGated reports whether members must hold a token balance
+func (g *Gating) TokenGated() bool {
+	return g.Token != (common.Address{})
+}
+
+// Paid reports whether members must stream payments to the owner
+func (g *Gating) Paid() bool {
+	return g.Rate != nil && g.Rate.Sign() > 0
+}
+
+// Encode returns the on-chain encoding; a nil or open Gating encodes empty
+func (g *Gating) Encode() ([]byte, error) {
+	if g == nil || g.Open() {
+		return nil, nil
+	}
+	if g.Paid() && g.Window < time.Second {
+		return nil, errors.New("paid channel needs a window of at least a second")
+	}
+	return gatingArgs.Pack(g.Token, orZero(g.MinBalance), g.Asset, orZero(g.Rate),
+		uint64(g.Window/time.Second), uint64(g.Grace/time.Second))
+}
+
+// DecodeGating parses the on-chain encoding of Gating
+func DecodeGating(data []byte) (*Gating, error) {
+	if len(data) == 0 {
+		return &Gating{}, nil
+	}
+	values, err := gatingArgs.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(gatingArgs) {
+		return nil, errors.New("malformed gating rules")
+	}
+	token, ok1 := values[0].(common.Address)
+	minBalance, ok2 := values[1].(*big.Int)
+	asset, ok3 := values[2].(common.Address)
+	rate, ok4 := values[3].(*big.Int)
+	window, ok5 := values[4].(uint64)
+	grace, ok6 := values[5].(uint64)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 {
+		return nil, errors.New("malformed gating rules")
+	}
+	return &Gating{
+		Token:      token,
+		MinBalance: minBalance,
+		Asset:      asset,
+		Rate:       rate,
+		Window:     time.Duration(window) * time.Second,
+		Grace:      time.Duration(grace) * time.Second,
+	}, nil
+}
+
+// Plan returns the streampay plan for a paid channel, using the channel name
+// as its messaging topic
+func (c *Channel) Plan() (*streampay.Plan, error) {
+	g, err := c.Rules()
+	if err != nil {
+		return nil, err
+	}
+	if !g.Paid() {
+		return nil, errors.New("channel is not paid")
+	}
+	plan := &streampay.Plan{
+		Channel: c.Name,
+		Owner:   c.Owner,
+		Asset:   g.Asset,
+		Rate:    g.Rate,
+		Window:  g.Window,
+		Grace:   g.Grace,
+	}
+	return plan, plan.Validate()
+}
+
+func orZero(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return v
+}
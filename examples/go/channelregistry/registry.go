@@ -0,0 +1,232 @@
+package channelregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+)
+
+// registryABIJSON is the ABI of the WhisperChain channel registry contract.
+// Channels are keyed by keccak256 of their normalized name, which the
+// contract keeps unique
+const registryABIJSON = `[
+{"type":"function","name":"createChannel","stateMutability":"nonpayable","inputs":[{"name":"name","type":"string"},{"name":"gating","type":"bytes"},{"name":"metadataCID","type":"string"}],"outputs":[{"name":"id","type":"bytes32"}]},
+{"type":"function","name":"updateChannel","stateMutability":"nonpayable","inputs":[{"name":"id","type":"bytes32"},{"name":"gating","type":"bytes"},{"name":"metadataCID","type":"string"}],"outputs":[]},
+{"type":"function","name":"transferOwnership","stateMutability":"nonpayable","inputs":[{"name":"id","type":"bytes32"},{"name":"newOwner","type":"address"}],"outputs":[]},
+{"type":"function","name":"channel","stateMutability":"view","inputs":[{"name":"id","type":"bytes32"}],"outputs":[{"name":"","type":"tuple","components":[{"name":"name","type":"string"},{"name":"owner","type":"address"},{"name":"gating","type":"bytes"},{"name":"metadataCID","type":"string"},{"name":"createdAt","type":"uint64"}]}]},
+{"type":"event","name":"ChannelCreated","anonymous":false,"inputs":[{"name":"id","type":"bytes32","indexed":true},{"name":"owner","type":"address","indexed":true},{"name":"name","type":"string","indexed":false}]},
+{"type":"event","name":"ChannelUpdated","anonymous":false,"inputs":[{"name":"id","type":"bytes32","indexed":true},{"name":"metadataCID","type":"string","indexed":false}]},
+{"type":"event","name":"OwnershipTransferred","anonymous":false,"inputs":[{"name":"id","type":"bytes32","indexed":true},{"name":"previousOwner","type":"address","indexed":true},{"name":"newOwner","type":"address","indexed":true}]}
+]`
+
+var registryABI = mustParseABI(registryABIJSON)
+
+var (
+	// ErrInvalidName is returned for names that are not 3 to 32 lower-case
+	// letters, digits or inner hyphens
+	ErrInvalidName = errors.New("channelregistry: invalid channel name")
+	// ErrNameTaken is returned when creating a channel whose name exists
+	ErrNameTaken = errors.New("channelregistry: channel name taken")
+	// ErrNotFound is returned for channels that were never created
+	ErrNotFound = errors.New("channelregistry: channel not found")
+	// ErrNotOwner is returned when the caller does not own the channel
+	ErrNotOwner = errors.New("channelregistry: not the channel owner")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{1,30})[a-z0-9]$`)
+
+// NormalizeName lower-cases and validates a channel name
+func NormalizeName(name string) (string, error) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	if !namePattern.MatchString(n) || strings.Contains(n, "--") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return n, nil
+}
+
+// ChannelID returns the registry key of a channel name
+func ChannelID(name string) (common.Hash, error) {
+	n, err := NormalizeName(name)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash([]byte(n)), nil
+}
+
+// Channel is the on-chain record of a channel
+type Channel struct {
+	Name        string
+	Owner       common.Address
+	Gating      []byte
+	MetadataCID string
+	CreatedAt   uint64
+	ID          common.Hash // filled in by the wrapper; keep last so the tuple converts
+}
+
+// Exists reports whether the channel was created
+func (c *Channel) Exists() bool {
+	return c.Owner != (common.Address{})
+}
+
+// Rules decodes the channel's gating rules
+func (c *Channel) Rules() (*Gating, error) {
+	return DecodeGating(c.Gating)
+}
+
+// Registry wraps the on-chain channel registry contract
+type Registry struct {
+	Address  common.Address
+	Client   *ethclient.Client
+	contract *bind.BoundContract
+}
+
+// NewRegistry creates a new Registry instance
+func NewRegistry(address common.Address, client *ethclient.Client) *Registry {
+	return &Registry{
+		Address:  address,
+		Client:   client,
+		contract: bind.NewBoundContract(address, registryABI, client, client, client),
+	}
+}
+
+// Create registers a channel owned by auth.From. It fails early with
+// ErrNameTaken rather than sending a transaction that would revert
+func (r *Registry) Create(auth *bind.TransactOpts, name string, gating *Gating, metadataCID string) (*types.Transaction, error) {
+	n, err := NormalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := r.Lookup(auth.Context, n)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNameTaken, n)
+	}
+	rules, err := gating.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return r.contract.Transact(auth, "createChannel", n, rules, metadataCID)
+}
+
+// Update replaces a channel's gating rules and metadata
+func (r *Registry) Update(auth *bind.TransactOpts, name string, gating *Gating, metadataCID string) (*types.Transaction, error) {
+	c, err := r.owned(auth, name)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := gating.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return r.contract.Transact(auth, "updateChannel", [32]byte(c.ID), rules, metadataCID)
+}
+
+// TransferOwnership hands a channel to newOwner
+func (r *Registry) TransferOwnership(auth *bind.TransactOpts, name string, newOwner common.Address) (*types.Transaction, error) {
+	if newOwner == (common.Address{}) {
+		return nil, errors.New("new owner is the zero address")
+	}
+	c, err := r.owned(auth, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.contract.Transact(auth, "transferOwnership", [32]byte(c.ID), newOwner)
+}
+
+// Lookup returns the channel registered under name
+func (r *Registry) Lookup(ctx context.Context, name string) (*Channel, error) {
+	id, err := ChannelID(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, id)
+}
+
+// Get returns the channel with the given id
+func (r *Registry) Get(ctx context.Context, id common.Hash) (*Channel, error) {
+	c, err := contract.Call[Channel](ctx, r.contract, "channel", [32]byte(id))
+	if err != nil {
+		return nil, err
+	}
+	if !c.Exists() {
+		return nil, ErrNotFound
+	}
+	c.ID = id
+	return &c, nil
+}
+
+// List discovers every channel created since block start, in creation order,
+// with its current record
+func (r *Registry) List(ctx context.Context, start uint64) ([]*Channel, error) {
+	logs, err := r.Client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(start),
+		Addresses: []common.Address{r.Address},
+		Topics:    [][]common.Hash{{registryABI.Events["ChannelCreated"].ID}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var channels []*Channel
+	seen := make(map[common.Hash]bool)
+	for _, l := range logs {
+		if l.Removed || len(l.Topics) < 2 || seen[l.Topics[1]] {
+			continue
+		}
+		seen[l.Topics[1]] = true
+		c, err := r.Get(ctx, l.Topics[1])
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, nil
+}
+
+// OwnedBy returns the channels created since block start that owner holds now
+func (r *Registry) OwnedBy(ctx context.Context, owner common.Address, start uint64) ([]*Channel, error) {
+	all, err := r.List(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	var owned []*Channel
+	for _, c := range all {
+		if c.Owner == owner {
+			owned = append(owned, c)
+		}
+	}
+	return owned, nil
+}
+
+// owned loads a channel and checks auth.From owns it
+func (r *Registry) owned(auth *bind.TransactOpts, name string) (*Channel, error) {
+	c, err := r.Lookup(auth.Context, name)
+	if err != nil {
+		return nil, err
+	}
+	if c.Owner != auth.From {
+		return nil, fmt.Errorf("%w: %s is owned by %s", ErrNotOwner, c.Name, c.Owner.Hex())
+	}
+	return c, nil
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
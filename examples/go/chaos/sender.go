@@ -0,0 +1,113 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/messaging"
+)
+
+// Sender wraps a messaging transport with injected faults. Rates are shares
+// of envelopes from zero to one and are drawn in the order fail, drop,
+// duplicate
+type Sender struct {
+	Next          messaging.Sender
+	FailRate      float64       // Send returns ErrInjected without sending
+	DropRate      float64       // Send reports success but the envelope is lost
+	DuplicateRate float64       // the envelope is delivered twice
+	Delay         time.Duration // every delivery waits this long
+	Clock         clock.Clock
+
+	mu          sync.Mutex
+	rand        *rand.Rand
+	partitioned bool
+	injected    map[Fault]int
+}
+
+// Faults injected by Sender besides the transport ones
+const (
+	// Fail is a send rejected with an error
+	Fail Fault = "fail"
+	// Duplicate is an envelope delivered twice
+	Duplicate Fault = "duplicate"
+)
+
+// NewSender creates a fault-injecting sender over next
+func NewSender(next messaging.Sender, seed int64) *Sender {
+	return &Sender{Next: next, rand: rand.New(rand.NewSource(seed)), injected: make(map[Fault]int)}
+}
+
+// Send implements messaging.Sender
+func (s *Sender) Send(ctx context.Context, env *messaging.Envelope) error {
+	s.mu.Lock()
+	fault := s.draw()
+	if fault != "" {
+		s.injected[fault]++
+	}
+	s.mu.Unlock()
+
+	switch fault {
+	case Partitioned:
+		return fmt.Errorf("%w: partitioned from the relay", ErrInjected)
+	case Fail:
+		return fmt.Errorf("%w: send failed", ErrInjected)
+	case Drop:
+		return nil
+	}
+	if s.Delay > 0 {
+		if err := clock.Sleep(ctx, s.Clock, s.Delay); err != nil {
+			return err
+		}
+	}
+	if err := s.Next.Send(ctx, env); err != nil {
+		return err
+	}
+	if fault == Duplicate {
+		return s.Next.Send(ctx, env)
+	}
+	return nil
+}
+
+// Partition fails every send until Heal
+func (s *Sender) Partition() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partitioned = true
+}
+
+// Heal ends a partition
+func (s *Sender) Heal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partitioned = false
+}
+
+// Injected returns how many times each fault was injected
+func (s *Sender) Injected() map[Fault]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[Fault]int, len(s.injected))
+	for f, n := range s.injected {
+		out[f] = n
+	}
+	return out
+}
+
+// draw picks the fault for one envelope, if any
+func (s *Sender) draw() Fault {
+	switch {
+	case s.partitioned:
+		return Partitioned
+	case s.FailRate > 0 && s.rand.Float64() < s.FailRate:
+		return Fail
+	case s.DropRate > 0 && s.rand.Float64() < s.DropRate:
+		return Drop
+	case s.DuplicateRate > 0 && s.rand.Float64() < s.DuplicateRate:
+		return Duplicate
+	}
+	return ""
+}
@@ -0,0 +1,429 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/clock"
+)
+
+// ErrInjected is the error injected transport failures return, so tests can
+// tell them from real ones
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Fault is a kind of injected failure
+type Fault string
+
+const (
+	// Refuse fails the request before it reaches the node
+	Refuse Fault = "refuse"
+	// Drop sends the request but loses the response, so the node may have
+	// acted on it, as with a send whose acknowledgement was lost
+	Drop Fault = "drop"
+	// Delay holds the response for the rule's Delay
+	Delay Fault = "delay"
+	// Unavailable answers 503 without contacting the node
+	Unavailable Fault = "unavailable"
+	// RPCError answers a JSON-RPC internal error without contacting the node
+	RPCError Fault = "rpc-error"
+	// PendingReceipt answers eth_getTransactionReceipt with null until the
+	// rule's Delay has passed since the hash was first asked for
+	PendingReceipt Fault = "pending-receipt"
+	// Partitioned counts requests failed by Partition
+	Partitioned Fault = "partitioned"
+)
+
+// Rule injects one fault into matching requests
+type Rule struct {
+	Methods []string // JSON-RPC methods; empty matches every request
+	Fault   Fault
+	Rate    float64       // share of matching requests faulted; zero is all
+	Delay   time.Duration // for Delay and PendingReceipt
+	Limit   int           // stop after this many faults; zero is unlimited
+}
+
+// Transport is an http.RoundTripper that injects faults into JSON-RPC
+// traffic to a node. Rules are checked in order and the first that fires
+// applies. Randomness is seeded, so a failing run can be repeated
+type Transport struct {
+	Base  http.RoundTripper
+	Clock clock.Clock // times delays; nil is the wall clock
+
+	mu          sync.Mutex
+	rules       []*rule
+	rand        *rand.Rand
+	partitioned bool
+	rollback    *rollback
+	receipts    map[string]time.Time // first lookup of each hash
+	injected    map[Fault]int
+}
+
+type rule struct {
+	Rule
+	fired int
+}
+
+// rollback hides the newest blocks, as a reorg does before the replacement
+// chain arrives
+type rollback struct {
+	depth uint64
+	until time.Time
+	cut   uint64 // highest visible block; zero until the head is read
+}
+
+// NewTransport creates a fault-injecting transport over base,
+// http.DefaultTransport when nil
+func NewTransport(base http.RoundTripper, seed int64) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		Base:     base,
+		rand:     rand.New(rand.NewSource(seed)),
+		receipts: make(map[string]time.Time),
+		injected: make(map[Fault]int),
+	}
+}
+
+// Add appends a rule
+func (t *Transport) Add(r Rule) *Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = append(t.rules, &rule{Rule: r})
+	return t
+}
+
+// Clear removes every rule, ends any partition or rollback and resets the
+// counts
+func (t *Transport) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = nil
+	t.partitioned = false
+	t.rollback = nil
+	t.receipts = make(map[string]time.Time)
+	t.injected = make(map[Fault]int)
+}
+
+// Partition fails every request until Heal, as when the node is unreachable
+func (t *Transport) Partition() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partitioned = true
+}
+
+// Heal ends a partition
+func (t *Transport) Heal() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partitioned = false
+}
+
+// Rollback makes the chain appear to lose its newest depth blocks for d:
+// the head number drops, those blocks read as missing and receipts and logs
+// in them disappear. Afterwards the blocks return, so code watching
+// confirmations sees a transaction unmined and then mined again
+func (t *Transport) Rollback(depth uint64, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollback = &rollback{depth: depth, until: clock.Or(t.Clock).Now().Add(d)}
+}
+
+// Injected returns how many times each fault was injected
+func (t *Transport) Injected() map[Fault]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[Fault]int, len(t.injected))
+	for f, n := range t.injected {
+		out[f] = n
+	}
+	return out
+}
+
+// Client returns a node client whose traffic to url goes through t. Only
+// HTTP endpoints are supported
+func (t *Transport) Client(ctx context.Context, url string) (*ethclient.Client, error) {
+	client, err := rpc.DialOptions(ctx, url, rpc.WithHTTPClient(&http.Client{Transport: t}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// request is a single JSON-RPC request; batches pass through whole
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	var call request
+	if json.Unmarshal(body, &call) != nil {
+		call = request{Method: "batch"}
+	}
+
+	t.mu.Lock()
+	if t.partitioned {
+		t.injected[Partitioned]++
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w: partitioned from the node", ErrInjected)
+	}
+	now := clock.Or(t.Clock).Now()
+	if t.rollback != nil && !now.Before(t.rollback.until) {
+		t.rollback = nil
+	}
+	rb := t.rollback
+	r := t.fire(call.Method)
+	var pendingFor time.Duration
+	if r != nil && r.Fault == PendingReceipt && len(call.Params) > 0 {
+		hash := string(call.Params[0])
+		first, ok := t.receipts[hash]
+		if !ok {
+			first = now
+			t.receipts[hash] = now
+		}
+		if pendingFor = r.Delay - now.Sub(first); pendingFor <= 0 {
+			// the receipt is due; this lookup is not a fault
+			r.fired--
+			t.injected[PendingReceipt]--
+			r = nil
+		}
+	}
+	t.mu.Unlock()
+
+	if r != nil {
+		switch r.Fault {
+		case Refuse:
+			return nil, fmt.Errorf("%w: connection refused", ErrInjected)
+		case Unavailable:
+			return respond(req, http.StatusServiceUnavailable, []byte("service unavailable")), nil
+		case RPCError:
+			return respond(req, http.StatusOK, rpcResponse(call.ID, nil, &rpcError{Code: -32603, Message: "chaos: injected internal error"})), nil
+		case PendingReceipt:
+			return respond(req, http.StatusOK, rpcResponse(call.ID, json.RawMessage("null"), nil)), nil
+		case Delay:
+			if err := clock.Sleep(req.Context(), t.Clock, r.Delay); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var cut uint64
+	if rb != nil {
+		if cut, err = t.cut(req, rb); err != nil {
+			return nil, err
+		}
+		body = hideRequest(cut, &call, body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil && r.Fault == Drop {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: response lost", ErrInjected)
+	}
+	if rb != nil && resp.StatusCode == http.StatusOK {
+		respBody, err := readBody(&resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		respBody = hideResponse(cut, &call, respBody)
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		resp.ContentLength = int64(len(respBody))
+		resp.Header.Del("Content-Length")
+	}
+	return resp, nil
+}
+
+// fire returns the first rule that injects a fault into a call of method
+func (t *Transport) fire(method string) *rule {
+	for _, r := range t.rules {
+		if !matches(r.Methods, method) || (r.Limit > 0 && r.fired >= r.Limit) {
+			continue
+		}
+		if r.Fault == PendingReceipt && method != "eth_getTransactionReceipt" {
+			continue
+		}
+		if r.Rate > 0 && t.rand.Float64() >= r.Rate {
+			continue
+		}
+		r.fired++
+		t.injected[r.Fault]++
+		return r
+	}
+	return nil
+}
+
+// cut returns the highest block visible during a rollback, reading the
+// node's head the first time
+func (t *Transport) cut(req *http.Request, rb *rollback) (uint64, error) {
+	t.mu.Lock()
+	cut := rb.cut
+	t.mu.Unlock()
+	if cut > 0 {
+		return cut, nil
+	}
+	probe := []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	preq := req.Clone(req.Context())
+	preq.Body = io.NopCloser(bytes.NewReader(probe))
+	preq.ContentLength = int64(len(probe))
+	resp, err := t.Base.RoundTrip(preq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Result hexutil.Uint64 `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("chaos: reading head for rollback: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rb.cut == 0 && uint64(out.Result) > rb.depth {
+		rb.cut = uint64(out.Result) - rb.depth
+	}
+	return rb.cut, nil
+}
+
+// hideRequest points requests for the latest block at the visible head
+func hideRequest(cut uint64, call *request, body []byte) []byte {
+	if cut == 0 || call.Method != "eth_getBlockByNumber" || len(call.Params) == 0 || string(call.Params[0]) != `"latest"` {
+		return body
+	}
+	call.Params[0] = mustJSON(hexutil.Uint64(cut))
+	rewritten, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": call.ID, "method": call.Method, "params": call.Params})
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// hideResponse removes blocks above the visible head from a response
+func hideResponse(cut uint64, call *request, body []byte) []byte {
+	var resp struct {
+		ID     json.RawMessage `json:"id"`
+		Result json.RawMessage `json:"result"`
+	}
+	if cut == 0 || json.Unmarshal(body, &resp) != nil || resp.Result == nil {
+		return body
+	}
+	switch call.Method {
+	case "eth_blockNumber":
+		var head hexutil.Uint64
+		if json.Unmarshal(resp.Result, &head) == nil && uint64(head) > cut {
+			return rpcResponse(resp.ID, mustJSON(hexutil.Uint64(cut)), nil)
+		}
+	case "eth_getBlockByNumber", "eth_getBlockByHash", "eth_getTransactionReceipt", "eth_getTransactionByHash":
+		var obj struct {
+			Number      *hexutil.Uint64 `json:"number"`
+			BlockNumber *hexutil.Uint64 `json:"blockNumber"`
+		}
+		if json.Unmarshal(resp.Result, &obj) != nil {
+			return body
+		}
+		n := obj.Number
+		if n == nil {
+			n = obj.BlockNumber
+		}
+		if n != nil && uint64(*n) > cut {
+			return rpcResponse(resp.ID, json.RawMessage("null"), nil)
+		}
+	case "eth_getLogs":
+		var logs []map[string]json.RawMessage
+		if json.Unmarshal(resp.Result, &logs) != nil {
+			return body
+		}
+		kept := logs[:0]
+		for _, l := range logs {
+			var n hexutil.Uint64
+			if json.Unmarshal(l["blockNumber"], &n) == nil && uint64(n) > cut {
+				continue
+			}
+			kept = append(kept, l)
+		}
+		return rpcResponse(resp.ID, mustJSON(kept), nil)
+	}
+	return body
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func rpcResponse(id, result json.RawMessage, rpcErr *rpcError) []byte {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		msg["error"] = rpcErr
+	} else {
+		msg["result"] = result
+	}
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+func respond(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func matches(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// readBody reads a body and puts back an unread copy
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
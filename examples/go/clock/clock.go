@@ -0,0 +1,113 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules wakeups. Waiters, schedulers and TTL
+// checks take one so tests can fast-forward time with a Fake
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at an interval, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// System is the wall clock
+var System Clock = system{}
+
+// Or returns c, or System when c is nil, so a zero Clock field means the
+// wall clock
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// Since returns the time elapsed on c since t
+func Since(c Clock, t time.Time) time.Duration {
+	return Or(c).Now().Sub(t)
+}
+
+// Sleep waits for d on c, returning early with the context's error when ctx
+// is done
+func Sleep(ctx context.Context, c Clock, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-Or(c).After(d):
+		return nil
+	}
+}
+
+// WithTimeout is context.WithTimeout measured on c, so a Fake clock
+// advanced past the deadline expires the context
+func WithTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	c = Or(c)
+	if _, ok := c.(system); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	inner, cancel := context.WithCancel(ctx)
+	t := &timeoutCtx{Context: inner, deadline: c.Now().Add(d)}
+	fired := c.After(d)
+	go func() {
+		select {
+		case <-inner.Done():
+		case <-fired:
+			t.mu.Lock()
+			t.expired = true
+			t.mu.Unlock()
+			cancel()
+		}
+	}()
+	return t, cancel
+}
+
+// timeoutCtx reports DeadlineExceeded when its clock, rather than its parent,
+// ended it
+type timeoutCtx struct {
+	context.Context
+	deadline time.Time
+
+	mu      sync.Mutex
+	expired bool
+}
+
+func (t *timeoutCtx) Deadline() (time.Time, bool) {
+	if d, ok := t.Context.Deadline(); ok && d.Before(t.deadline) {
+		return d, true
+	}
+	return t.deadline, true
+}
+
+func (t *timeoutCtx) Err() error {
+	err := t.Context.Err()
+	if err == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.expired {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+type system struct{}
+
+func (system) Now() time.Time                         { return time.Now() }
+func (system) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (system) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
@@ -0,0 +1,133 @@
+// Command bench compares RPC endpoints on the same workload.
+//
+// Each endpoint is measured in turn on reads, log queries and, with -sends
+// and a testnet keystore, zero-value self-transfers. The report marks the
+// endpoint with the lowest p90 for each operation.
+//
+//	bench -endpoint name=url [-endpoint name=url ...] [-ops blockNumber,balance,block,logs]
+//	      [-requests 100] [-concurrency 4] [-address 0x...] [-log-blocks 10]
+//	      [-sends 3 -keystore key.json -passfile pass] [-json]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/bench"
+	"github.com/whisperchain/go-examples/rpcpool"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// endpointFlags collects repeated -endpoint name=url flags
+type endpointFlags []string
+
+func (f *endpointFlags) String() string     { return strings.Join(*f, ",") }
+func (f *endpointFlags) Set(v string) error { *f = append(*f, v); return nil }
+
+func main() {
+	var endpoints endpointFlags
+	flag.Var(&endpoints, "endpoint", "endpoint to compare as name=url; repeat for each")
+	ops := flag.String("ops", "blockNumber,balance,block,logs", "comma-separated operations")
+	requests := flag.Int("requests", 100, "requests per operation per endpoint")
+	concurrency := flag.Int("concurrency", 4, "requests in flight per operation")
+	address := flag.String("address", "", "account for balance reads and contract for log queries")
+	logBlocks := flag.Uint64("log-blocks", 10, "blocks per log query")
+	sends := flag.Int("sends", 0, "self-transfers per endpoint; testnets only")
+	keystore := flag.String("keystore", "", "keystore of the sending account")
+	passfile := flag.String("passfile", "", "file holding the keystore passphrase")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if err := run(endpoints, *ops, *requests, *concurrency, *address, *logBlocks, *sends, *keystore, *passfile, *asJSON); err != nil {
+		fmt.Fprintln(os.Stderr, "bench:", err)
+		os.Exit(1)
+	}
+}
+
+func run(endpoints []string, ops string, requests, concurrency int, address string, logBlocks uint64, sends int, keystore, passfile string, asJSON bool) error {
+	if len(endpoints) == 0 {
+		return errors.New("at least one -endpoint is required")
+	}
+	ctx := context.Background()
+	var pool []*rpcpool.Endpoint
+	for _, spec := range endpoints {
+		name, url, ok := strings.Cut(spec, "=")
+		if !ok {
+			name, url = spec, spec
+		}
+		e, err := rpcpool.Dial(ctx, name, url)
+		if err != nil {
+			return err
+		}
+		defer e.Client.Close()
+		pool = append(pool, e)
+	}
+
+	var addr common.Address
+	if address != "" {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("invalid address %q", address)
+		}
+		addr = common.HexToAddress(address)
+	}
+	w := bench.Workload{Requests: requests, Concurrency: concurrency, Sends: sends}
+	for _, op := range strings.Split(ops, ",") {
+		switch strings.TrimSpace(op) {
+		case "blockNumber":
+			w.Operations = append(w.Operations, bench.BlockNumber())
+		case "balance":
+			w.Operations = append(w.Operations, bench.Balance(addr))
+		case "block":
+			w.Operations = append(w.Operations, bench.Block())
+		case "logs":
+			q := ethereum.FilterQuery{}
+			if address != "" {
+				q.Addresses = []common.Address{addr}
+			}
+			w.Operations = append(w.Operations, bench.Logs(q, logBlocks))
+		case "":
+		default:
+			return fmt.Errorf("unknown operation %q", op)
+		}
+	}
+	if sends > 0 {
+		passphrase, err := readPassphrase(passfile)
+		if err != nil {
+			return err
+		}
+		// the wallet estimates fees through the first endpoint; sends go
+		// through each endpoint in turn
+		if w.Wallet, err = wallet.LoadKeystore(keystore, passphrase, pool[0].URL); err != nil {
+			return err
+		}
+	}
+
+	report, err := bench.Run(ctx, pool, w)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return report.WriteTable(os.Stdout)
+}
+
+func readPassphrase(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("-passfile is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
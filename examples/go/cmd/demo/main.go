@@ -0,0 +1,91 @@
+// Command demo deploys the WHSP demo token to a devnet or testnet and funds
+// the caller, printing the token address for the other examples to use.
+//
+// The key is read from stdin as hex. Without -token a new token owned by the
+// key is deployed and -mint WHSP are minted to it; with -token the key mints
+// if it owns that token, and otherwise claims from its faucet.
+//
+//	demo [-rpc URL] [-token 0x...] [-mint 1000] < key.hex
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/demo"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+func main() {
+	rpc := flag.String("rpc", "http://localhost:8545", "node to deploy to")
+	token := flag.String("token", "", "existing demo token to fund from instead of deploying")
+	mint := flag.String("mint", "1000", "WHSP to mint to the caller when it owns the token")
+	flag.Parse()
+	if flag.NArg() != 0 || (*token != "" && !common.IsHexAddress(*token)) {
+		fmt.Fprintln(os.Stderr, "usage: demo [-rpc URL] [-token 0x...] [-mint 1000] < key.hex")
+		os.Exit(2)
+	}
+	if err := run(*rpc, *token, *mint); err != nil {
+		fmt.Fprintln(os.Stderr, "demo:", err)
+		os.Exit(1)
+	}
+}
+
+func run(rpc, token, mint string) error {
+	amount, err := units.ParseUnits(mint, 18)
+	if err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return errors.New("no private key on stdin")
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(line), "0x"))
+	if err != nil {
+		return err
+	}
+	w, err := wallet.NewWalletFromPrivateKey(key, rpc)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	opts := demo.Options{Mint: amount}
+	if token != "" {
+		opts.Token = common.HexToAddress(token)
+	}
+	ctx := context.Background()
+	res, err := demo.Bootstrap(ctx, w, opts)
+	if err != nil {
+		return err
+	}
+	info, err := res.Token.GetTokenInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	action := "using"
+	if res.Deployed {
+		action = "deployed"
+	}
+	fmt.Printf("%s %s (%s) at %s\n", action, info.Name, info.Symbol, res.Token.Address.Hex())
+	switch {
+	case res.Minted.Sign() > 0:
+		fmt.Printf("minted %s %s\n", units.FormatUnits(res.Minted, info.Decimals), info.Symbol)
+	case res.Claimed:
+		fmt.Printf("claimed %s %s from the faucet\n", units.FormatUnits(demo.FaucetAmount, info.Decimals), info.Symbol)
+	case !res.Deployed:
+		fmt.Println("nothing minted or claimed")
+	}
+	fmt.Printf("balance of %s: %s\n", w.Address.Hex(), res.Balance)
+	fmt.Printf("total supply: %s %s\n", units.FormatUnits(info.TotalSupply, info.Decimals), info.Symbol)
+	return nil
+}
@@ -0,0 +1,89 @@
+// Command easm assembles the EVM assembly the demo contracts are written in.
+//
+// By default it prints the deployment code, or with -runtime the runtime
+// code, as hex. With -const it writes Go source declaring the deployment code
+// as a hex string constant instead, which is how go generate rebuilds
+// demo/token_code.go from demo/token.easm.
+//
+//	easm [-runtime] file.easm
+//	easm -const tokenCode [-pkg demo] [-o token_code.go] file.easm
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+
+	"github.com/whisperchain/go-examples/easm"
+)
+
+// hexPerLine is how many hex digits each line of a generated constant holds
+const hexPerLine = 128
+
+func main() {
+	runtime := flag.Bool("runtime", false, "print the runtime code instead of the deployment code")
+	name := flag.String("const", "", "write Go source declaring the code as this constant")
+	pkg := flag.String("pkg", "main", "package of the generated Go source")
+	out := flag.String("o", "", "write to this file instead of stdout")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: easm [-runtime] [-const name [-pkg name]] [-o file] file.easm")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *runtime, *name, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "easm:", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string, runtime bool, name, pkg, out string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	prog, err := easm.Assemble(string(src))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	code := prog.Init
+	if runtime {
+		code = prog.Runtime
+	}
+
+	data := []byte(hex.EncodeToString(code) + "\n")
+	if name != "" {
+		if data, err = goSource(filepath.Base(path), pkg, name, code); err != nil {
+			return err
+		}
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(out, data, 0o644)
+}
+
+// goSource declares code as a hex string constant split across lines
+func goSource(source, pkg, name string, code []byte) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by easm from %s; DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "// %s is the init code assembled from %s\n", name, source)
+	fmt.Fprintf(&b, "const %s = \"\"", name)
+	digits := hex.EncodeToString(code)
+	for len(digits) > 0 {
+		n := min(hexPerLine, len(digits))
+		fmt.Fprintf(&b, " +\n\t%q", digits[:n])
+		digits = digits[n:]
+	}
+	b.WriteString("\n")
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,139 @@
+// Command gasfees reports network fee conditions from a node's fee history.
+//
+// forecast prints, for each horizon, the cheapest fees likely to be mined in
+// time, and with -all the chance for every sampled tip level. history prints
+// time-bucketed base and priority fees of recent blocks as CSV for charting.
+//
+//	gasfees forecast [-rpc url] [-blocks 1,3,10] [-target 0.9] [-history 20] [-all]
+//	gasfees history [-rpc url] [-blocks 1024] [-bucket 10m]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/gasstats"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "forecast":
+		err = forecast(os.Args[2:])
+	case "history":
+		err = history(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gasfees:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gasfees forecast|history [flags]")
+	os.Exit(2)
+}
+
+func forecast(args []string) error {
+	fs := flag.NewFlagSet("forecast", flag.ExitOnError)
+	rpcURL := fs.String("rpc", "http://localhost:8545", "node RPC URL")
+	horizons := fs.String("blocks", "1,3,10", "comma-separated horizons in blocks")
+	target := fs.Float64("target", 0.9, "wanted chance of inclusion within each horizon")
+	history := fs.Uint64("history", 20, "blocks of fee history to learn from")
+	all := fs.Bool("all", false, "print every sampled tip level")
+	fs.Parse(args)
+
+	blocks, err := parseBlocks(*horizons)
+	if err != nil {
+		return err
+	}
+	if *target <= 0 || *target >= 1 {
+		return fmt.Errorf("-target must be between 0 and 1, got %v", *target)
+	}
+	client, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	forecaster := &wallet.FeeForecaster{Blocks: *history}
+	h, err := forecaster.History(ctx, client)
+	if err != nil {
+		return err
+	}
+	for _, n := range blocks {
+		fc := h.Target(wallet.Inclusion{Blocks: n, Probability: *target})
+		fmt.Println(fc)
+		if !*all {
+			continue
+		}
+		for _, level := range h.Levels(n) {
+			fmt.Println("  ", level.String())
+		}
+	}
+	return nil
+}
+
+func history(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	rpcURL := fs.String("rpc", "http://localhost:8545", "node RPC URL")
+	blocks := fs.Uint64("blocks", 1024, "number of recent blocks")
+	width := fs.Duration("bucket", 10*time.Minute, "bucket width")
+	fs.Parse(args)
+
+	if *blocks == 0 || *width <= 0 {
+		return errors.New("-blocks and -bucket must be positive")
+	}
+	client, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	var first uint64
+	if head+1 > *blocks {
+		first = head + 1 - *blocks
+	}
+	samples, err := gasstats.FromFeeHistory(ctx, client, first, head)
+	if err != nil {
+		return err
+	}
+	fmt.Println("start,blocks,base_min,base_median,base_max,tip_min,tip_median,tip_max,gas_used_ratio")
+	for _, b := range gasstats.Aggregate(samples, *width) {
+		fmt.Printf("%s,%d,%s,%s,%s,%s,%s,%s,%.3f\n", b.Start.Format(time.RFC3339), b.Blocks,
+			b.BaseFee.Min, b.BaseFee.Median, b.BaseFee.Max,
+			b.PriorityFee.Min, b.PriorityFee.Median, b.PriorityFee.Max, b.GasUsedRatio)
+	}
+	return nil
+}
+
+func parseBlocks(s string) ([]int, error) {
+	var blocks []int
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("bad horizon %q", part)
+		}
+		blocks = append(blocks, n)
+	}
+	return blocks, nil
+}
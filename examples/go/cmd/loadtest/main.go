@@ -0,0 +1,86 @@
+// Command loadtest simulates concurrent wallets against a deployment in
+// server mode and reports latency histograms and failure breakdowns.
+//
+// Every wallet repeatedly requests one of -paths and, with -transfer-to,
+// posts transfers. Transfers move real funds from the deployment's wallet,
+// so only enable them against a testnet deployment. Relay mode has no
+// network API; drive relays in-process with loadtest.Message.
+//
+//	loadtest -url https://host [-keys k1,k2] [-wallets 10] [-duration 1m] [-rampup 10s]
+//	         [-rate 1] [-paths /v1/balance,/v1/address] [-transfer-to 0x... -transfer-wei 1] [-json]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/loadtest"
+	"github.com/whisperchain/go-examples/units"
+)
+
+func main() {
+	url := flag.String("url", "", "deployment base URL")
+	keys := flag.String("keys", "", "comma-separated API keys handed to wallets round-robin")
+	wallets := flag.Int("wallets", 10, "concurrent simulated wallets")
+	duration := flag.Duration("duration", time.Minute, "length of the run")
+	rampup := flag.Duration("rampup", 0, "period over which wallets start")
+	rate := flag.Float64("rate", 1, "requests per second per wallet; 0 is unthrottled")
+	paths := flag.String("paths", "/v1/balance,/v1/address", "comma-separated paths to GET")
+	transferTo := flag.String("transfer-to", "", "also post transfers to this address")
+	transferWei := flag.String("transfer-wei", "1", "wei per transfer")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if err := run(*url, *keys, *wallets, *duration, *rampup, *rate, *paths, *transferTo, *transferWei, *asJSON); err != nil {
+		fmt.Fprintln(os.Stderr, "loadtest:", err)
+		os.Exit(1)
+	}
+}
+
+func run(url, keys string, wallets int, duration, rampup time.Duration, rate float64, paths, transferTo, transferWei string, asJSON bool) error {
+	if url == "" {
+		return errors.New("-url is required")
+	}
+	target := &loadtest.HTTP{BaseURL: url}
+	if keys != "" {
+		target.Keys = strings.Split(keys, ",")
+	}
+	h := &loadtest.Harness{Wallets: wallets, Duration: duration, Rampup: rampup, Rate: rate}
+	for _, p := range strings.Split(paths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			h.Actions = append(h.Actions, target.Get(p, p))
+		}
+	}
+	if transferTo != "" {
+		if !common.IsHexAddress(transferTo) {
+			return fmt.Errorf("invalid address %q", transferTo)
+		}
+		amount, err := units.ParseWei(transferWei)
+		if err != nil || amount.Sign() < 0 {
+			return fmt.Errorf("invalid amount %q", transferWei)
+		}
+		h.Actions = append(h.Actions, target.Transfer(common.HexToAddress(transferTo), amount))
+	}
+
+	// Ctrl-C ends the run early and still prints the report
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := h.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return report.WriteText(os.Stdout)
+}
@@ -0,0 +1,189 @@
+// Command paperbackup prints SeedQR and encrypted keystore backups and
+// restores them from a scanned QR code.
+//
+// Secrets are read from stdin rather than flags so they stay out of shell
+// history. Most QR scanners act as keyboards, so a scan can be piped or typed
+// straight into the import command.
+//
+//	paperbackup seed [-compact] [-o sheet.html]        < mnemonic
+//	paperbackup keystore -passfile pass [-o sheet.html] < hex private key
+//	paperbackup import [-hex] [-passfile pass] [-check 1234] < scanned payload
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/paperbackup"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "seed":
+		err = seed(os.Args[2:])
+	case "keystore":
+		err = keystore(os.Args[2:])
+	case "import":
+		err = restore(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "paperbackup:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: paperbackup seed|keystore|import [flags]")
+	os.Exit(2)
+}
+
+func seed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	compact := fs.Bool("compact", false, "encode entropy as a Compact SeedQR")
+	out := fs.String("o", "", "write a printable HTML sheet to this file")
+	fs.Parse(args)
+
+	mnemonic, err := readLine(os.Stdin)
+	if err != nil {
+		return err
+	}
+	format := paperbackup.Standard
+	if *compact {
+		format = paperbackup.Compact
+	}
+	sheet, err := paperbackup.NewSeedSheet(mnemonic, format)
+	if err != nil {
+		return err
+	}
+	return emit(sheet, *out)
+}
+
+func keystore(args []string) error {
+	fs := flag.NewFlagSet("keystore", flag.ExitOnError)
+	passfile := fs.String("passfile", "", "file holding the keystore passphrase")
+	out := fs.String("o", "", "write a printable HTML sheet to this file")
+	fs.Parse(args)
+
+	passphrase, err := readPassphrase(*passfile)
+	if err != nil {
+		return err
+	}
+	keyHex, err := readLine(os.Stdin)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(keyHex, "0x"))
+	if err != nil {
+		return err
+	}
+	sheet, err := paperbackup.NewKeystoreSheet(key, passphrase)
+	if err != nil {
+		return err
+	}
+	return emit(sheet, *out)
+}
+
+func restore(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	isHex := fs.Bool("hex", false, "payload is hex encoded, as scanners report binary Compact SeedQR codes")
+	passfile := fs.String("passfile", "", "file holding the keystore passphrase")
+	check := fs.String("check", "", "check digits printed on the sheet")
+	fs.Parse(args)
+
+	payload, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	if *isHex {
+		if payload, err = hex.DecodeString(strings.TrimSpace(string(payload))); err != nil {
+			return err
+		}
+	}
+	var passphrase string
+	if *passfile != "" {
+		if passphrase, err = readPassphrase(*passfile); err != nil {
+			return err
+		}
+	}
+
+	restored, err := paperbackup.Import(payload, passphrase)
+	if err != nil {
+		return err
+	}
+	if *check != "" && *check != restored.Check {
+		return fmt.Errorf("check digits %s do not match the sheet (%s)", restored.Check, *check)
+	}
+	switch restored.Kind {
+	case paperbackup.KindSeed:
+		fmt.Println(restored.Mnemonic)
+	case paperbackup.KindKeystore:
+		fmt.Println(crypto.PubkeyToAddress(restored.Key.PublicKey).Hex())
+	}
+	fmt.Fprintln(os.Stderr, "check digits", restored.Check)
+	return nil
+}
+
+// emit writes the HTML sheet, or shows the QR code and words in the terminal
+func emit(sheet *paperbackup.Sheet, out string) error {
+	if out != "" {
+		f, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := sheet.WriteHTML(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	qr, err := sheet.Terminal()
+	if err != nil {
+		return err
+	}
+	fmt.Print(qr)
+	for _, row := range sheet.Rows {
+		fmt.Printf("%2d. %-40s %s\n", row.First, strings.Join(row.Words, " "), row.Check)
+	}
+	if sheet.Kind == paperbackup.KindKeystore {
+		fmt.Println("address", sheet.Address.Hex())
+	}
+	fmt.Println("check digits", sheet.Check)
+	return nil
+}
+
+func readPassphrase(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("-passfile is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", errors.New("no input on stdin")
+	}
+	return line, nil
+}
@@ -0,0 +1,76 @@
+// Command reserves verifies a proof-of-reserves report.
+//
+// Without -rpc only the signatures and totals are checked. With -rpc every
+// balance is also read back from that node at the report block; use a node
+// you trust, and an archive node for older reports.
+//
+//	reserves [-rpc URL] [-attester 0x...] [-challenge nonce] report.json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/reserves"
+)
+
+func main() {
+	rpc := flag.String("rpc", "", "node to check balances against")
+	attester := flag.String("attester", "", "require the report to be signed by this address")
+	challenge := flag.String("challenge", "", "require the signatures to answer this challenge")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: reserves [-rpc URL] [-attester 0x...] [-challenge nonce] report.json")
+		os.Exit(2)
+	}
+	if err := verify(flag.Arg(0), *rpc, *attester, *challenge); err != nil {
+		fmt.Fprintln(os.Stderr, "reserves:", err)
+		os.Exit(1)
+	}
+}
+
+func verify(path, rpc, attester, challenge string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r, err := reserves.DecodeReport(data)
+	if err != nil {
+		return err
+	}
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	if attester != "" && (!common.IsHexAddress(attester) || common.HexToAddress(attester) != r.Attester) {
+		return fmt.Errorf("report is signed by %s", r.Attester.Hex())
+	}
+	if challenge != "" && challenge != r.Challenge {
+		return fmt.Errorf("report answers challenge %q", r.Challenge)
+	}
+	onChain := "not checked"
+	if rpc != "" {
+		client, err := ethclient.Dial(rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		if err := r.VerifyOnChain(context.Background(), client); err != nil {
+			return err
+		}
+		onChain = "match " + rpc
+	}
+
+	fmt.Printf("chain %s, block %d (%s) at %s\n", r.ChainID.ToInt(), r.Block, r.BlockHash.Hex(), r.BlockTime.Format("2006-01-02 15:04:05 UTC"))
+	fmt.Printf("attester %s, %d addresses proved control\n", r.Attester.Hex(), len(r.Holdings))
+	fmt.Printf("total %s wei\n", r.Total.ToInt())
+	for _, t := range r.TokenTotals {
+		fmt.Printf("total %s of token %s\n", t.Balance.ToInt(), t.Token.Hex())
+	}
+	fmt.Printf("balances: %s\n", onChain)
+	fmt.Println("OK")
+	return nil
+}
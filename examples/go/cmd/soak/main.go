@@ -0,0 +1,97 @@
+// Command soak sends transfers between funded devnet accounts for as long as
+// it runs and checks that nonces stay gapless, nothing gets stuck and every
+// balance reconciles with the transfers and fees. Violations are printed as
+// they are found, with the context needed to debug them; the exit status is
+// 1 when any were found.
+//
+//	soak -rpc URL -keystore a.json -keystore b.json -passfile pass [-duration 1h] [-interval 2s] [-check-every 10]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/whisperchain/go-examples/soak"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// keystoreFlags collects repeated -keystore flags
+type keystoreFlags []string
+
+func (f *keystoreFlags) String() string     { return strings.Join(*f, ",") }
+func (f *keystoreFlags) Set(v string) error { *f = append(*f, v); return nil }
+
+func main() {
+	var keystores keystoreFlags
+	rpcURL := flag.String("rpc", "http://localhost:8545", "devnet node RPC URL")
+	flag.Var(&keystores, "keystore", "keystore of a funded account; repeat for each")
+	passfile := flag.String("passfile", "", "file holding the keystores' passphrase")
+	duration := flag.Duration("duration", 0, "length of the run; 0 runs until interrupted")
+	interval := flag.Duration("interval", 2*time.Second, "time between actions")
+	checkEvery := flag.Int("check-every", 10, "actions between invariant checks")
+	flag.Parse()
+
+	violations, err := run(*rpcURL, keystores, *passfile, *duration, *interval, *checkEvery)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "soak:", err)
+		os.Exit(2)
+	}
+	if violations > 0 {
+		os.Exit(1)
+	}
+}
+
+func run(rpcURL string, keystores []string, passfile string, duration, interval time.Duration, checkEvery int) (int, error) {
+	if len(keystores) < 2 {
+		return 0, errors.New("at least two -keystore accounts are required")
+	}
+	if passfile == "" {
+		return 0, errors.New("-passfile is required")
+	}
+	data, err := os.ReadFile(passfile)
+	if err != nil {
+		return 0, err
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	var wallets []*wallet.Wallet
+	for _, path := range keystores {
+		w, err := wallet.LoadKeystore(path, passphrase, rpcURL)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		wallets = append(wallets, w)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	client, err := wallets[0].Client(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r := soak.New(client, wallets...)
+	r.Interval = interval
+	r.CheckEvery = checkEvery
+	r.Seed = time.Now().UnixNano()
+	enc := json.NewEncoder(os.Stdout)
+	r.OnViolation = func(v soak.Violation) { enc.Encode(v) }
+
+	report, err := r.Run(ctx)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d transfers, %d checks, %d send errors, %d violations\n",
+		report.Elapsed.Round(time.Second), report.Transfers, report.Checks, report.Errors, len(report.Violations))
+	return len(report.Violations), nil
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/policy"
+)
+
+// ErrInvalid is returned for a configuration that fails validation; nothing
+// of it is applied
+var ErrInvalid = errors.New("config: invalid configuration")
+
+// Config is the part of a deployment's configuration that can change while
+// it runs. Omitted sections leave the running settings as they are
+type Config struct {
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+	Policy    *Policy    `json:"policy,omitempty"`
+	Gas       *Gas       `json:"gas,omitempty"`
+	Alerts    *Alerts    `json:"alerts,omitempty"`
+}
+
+// Endpoint is an RPC provider of the pool
+type Endpoint struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Archive bool   `json:"archive,omitempty"`
+}
+
+// Policy is the rule set of the policy engine
+type Policy struct {
+	DefaultAllow bool          `json:"defaultAllow"`
+	Rules        []policy.Rule `json:"rules"`
+}
+
+// Gas strategies
+const (
+	GasDynamic = "dynamic"
+	GasLegacy  = "legacy"
+	GasFixed   = "fixed"
+)
+
+// Gas selects and tunes the wallet's gas strategy
+type Gas struct {
+	Strategy          string   `json:"strategy"`
+	BaseFeeMultiplier int64    `json:"baseFeeMultiplier,omitempty"` // dynamic
+	MinTip            *big.Int `json:"minTipWei,omitempty"`         // dynamic
+	MaxFeeCap         *big.Int `json:"maxFeeCapWei,omitempty"`      // dynamic
+	Price             *big.Int `json:"priceWei,omitempty"`          // fixed
+}
+
+// Alerts is the alert dispatcher's dedup window and routes
+type Alerts struct {
+	Dedup  string       `json:"dedup,omitempty"` // e.g. "5m"
+	Routes []AlertRoute `json:"routes"`
+}
+
+// AlertRoute posts alerts at or above MinSeverity to a webhook
+type AlertRoute struct {
+	MinSeverity alert.Severity `json:"minSeverity"`
+	Webhook     string         `json:"webhook"`
+}
+
+// Load reads and validates a JSON configuration file
+func Load(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks every section, so a reload is applied whole or not at all
+func (c *Config) Validate() error {
+	names := make(map[string]bool, len(c.Endpoints))
+	for _, e := range c.Endpoints {
+		if e.Name == "" || names[e.Name] {
+			return fmt.Errorf("%w: endpoint names must be unique and set", ErrInvalid)
+		}
+		names[e.Name] = true
+		if !validURL(e.URL, "http", "https", "ws", "wss") {
+			return fmt.Errorf("%w: endpoint %s has an invalid URL", ErrInvalid, e.Name)
+		}
+	}
+
+	if c.Policy != nil {
+		for _, r := range c.Policy.Rules {
+			if r.Name == "" {
+				return fmt.Errorf("%w: policy rules need a name", ErrInvalid)
+			}
+			if r.Effect != policy.Allow && r.Effect != policy.Deny {
+				return fmt.Errorf("%w: rule %s has effect %q", ErrInvalid, r.Name, r.Effect)
+			}
+			for _, patterns := range [][]string{r.Subjects, r.Actions, r.Resources} {
+				for _, p := range patterns {
+					if _, err := path.Match(p, ""); err != nil {
+						return fmt.Errorf("%w: rule %s has pattern %q: %v", ErrInvalid, r.Name, p, err)
+					}
+				}
+			}
+		}
+	}
+
+	if g := c.Gas; g != nil {
+		switch g.Strategy {
+		case GasDynamic:
+			if g.BaseFeeMultiplier < 0 || negative(g.MinTip) || negative(g.MaxFeeCap) {
+				return fmt.Errorf("%w: gas settings must not be negative", ErrInvalid)
+			}
+			if g.MinTip != nil && g.MaxFeeCap != nil && g.MinTip.Cmp(g.MaxFeeCap) > 0 {
+				return fmt.Errorf("%w: gas minimum tip is above the fee cap", ErrInvalid)
+			}
+		case GasLegacy:
+		case GasFixed:
+			if g.Price == nil || g.Price.Sign() <= 0 {
+				return fmt.Errorf("%w: fixed gas needs a positive price", ErrInvalid)
+			}
+		default:
+			return fmt.Errorf("%w: unknown gas strategy %q", ErrInvalid, g.Strategy)
+		}
+	}
+
+	if a := c.Alerts; a != nil {
+		if _, err := a.dedup(); err != nil {
+			return fmt.Errorf("%w: alert dedup: %v", ErrInvalid, err)
+		}
+		for _, r := range a.Routes {
+			if r.MinSeverity < alert.Info || r.MinSeverity > alert.Critical {
+				return fmt.Errorf("%w: alert route has no severity", ErrInvalid)
+			}
+			if !validURL(r.Webhook, "http", "https") {
+				return fmt.Errorf("%w: alert route has an invalid webhook URL", ErrInvalid)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Alerts) dedup() (time.Duration, error) {
+	if a.Dedup == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(a.Dedup)
+	if err == nil && d < 0 {
+		err = errors.New("negative window")
+	}
+	return d, err
+}
+
+func validURL(raw string, schemes ...string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, s := range schemes {
+		if u.Scheme == s {
+			return true
+		}
+	}
+	return false
+}
+
+func negative(v *big.Int) bool {
+	return v != nil && v.Sign() < 0
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/policy"
+	"github.com/whisperchain/go-examples/rpcpool"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Change summarizes what a reload applied
+type Change struct {
+	EndpointsAdded   []string `json:"endpointsAdded,omitempty"`
+	EndpointsRemoved []string `json:"endpointsRemoved,omitempty"`
+	Policy           bool     `json:"policy"`
+	Gas              bool     `json:"gas"`
+	Alerts           bool     `json:"alerts"`
+}
+
+// Reloader applies a configuration file to running components without a
+// restart. Each component is swapped atomically: requests already running
+// finish with the settings they started with, the next ones use the new
+// settings. Components left nil are not reloaded
+type Reloader struct {
+	Path   string
+	Pool   *rpcpool.Pool
+	Policy *policy.Engine
+	Gas    *wallet.SwitchStrategy // install it as the wallet's GasStrategy
+	Alerts *alert.Dispatcher
+	Audit  audit.Log
+	Clock  clock.Clock
+	// Drain is how long removed endpoints stay open for requests still using
+	// them; zero is 30 seconds
+	Drain time.Duration
+
+	mu      sync.Mutex // one reload at a time
+	current *Config
+}
+
+// NewReloader creates a reloader for a configuration file
+func NewReloader(file string, auditLog audit.Log) *Reloader {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Reloader{Path: file, Audit: auditLog}
+}
+
+// Current returns the last applied configuration, nil before the first reload
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload reads, validates and applies the configuration file. New endpoints
+// are dialed before anything is swapped, so an invalid file or an unreachable
+// endpoint leaves every component untouched
+func (r *Reloader) Reload(ctx context.Context) (*Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := Load(r.Path)
+	if err != nil {
+		r.record(ctx, "rejected", map[string]string{"error": err.Error()})
+		return nil, err
+	}
+	change := &Change{}
+
+	var endpoints []*rpcpool.Endpoint
+	if r.Pool != nil && len(c.Endpoints) > 0 {
+		endpoints, change.EndpointsAdded, err = r.endpoints(ctx, c.Endpoints)
+		if err != nil {
+			r.record(ctx, "rejected", map[string]string{"error": err.Error()})
+			return nil, err
+		}
+	}
+	var strategy wallet.GasStrategy
+	if c.Gas != nil {
+		strategy = gasStrategy(c.Gas)
+	}
+	var dedup time.Duration
+	var targets []alert.Target
+	if c.Alerts != nil {
+		dedup, _ = c.Alerts.dedup()
+		for _, route := range c.Alerts.Routes {
+			targets = append(targets, alert.Target{Min: route.MinSeverity, Notifier: &alert.Webhook{URL: route.Webhook}})
+		}
+	}
+
+	if endpoints != nil {
+		removed := r.Pool.SetEndpoints(endpoints)
+		for _, e := range removed {
+			change.EndpointsRemoved = append(change.EndpointsRemoved, e.Name)
+		}
+		r.close(removed)
+	}
+	if r.Policy != nil && c.Policy != nil {
+		r.Policy.Reset(c.Policy.DefaultAllow, c.Policy.Rules)
+		change.Policy = true
+	}
+	if r.Gas != nil && strategy != nil {
+		r.Gas.Set(strategy)
+		change.Gas = true
+	}
+	if r.Alerts != nil && c.Alerts != nil {
+		r.Alerts.SetRoutes(dedup, targets...)
+		change.Alerts = true
+	}
+	r.current = c
+
+	r.record(ctx, "applied", map[string]string{
+		"endpointsAdded":   strings.Join(change.EndpointsAdded, ","),
+		"endpointsRemoved": strings.Join(change.EndpointsRemoved, ","),
+	})
+	return change, nil
+}
+
+// WatchSignals reloads on every SIGHUP until ctx is done. Failed reloads are
+// recorded in the audit log and passed to onError, if set; the running
+// configuration stays in place
+func (r *Reloader) WatchSignals(ctx context.Context, onError func(error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if _, err := r.Reload(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// endpoints builds the new endpoint list, keeping current endpoints with the
+// same name, URL and archive flag so their stats survive the reload
+func (r *Reloader) endpoints(ctx context.Context, configured []Endpoint) ([]*rpcpool.Endpoint, []string, error) {
+	current := make(map[Endpoint]*rpcpool.Endpoint)
+	for _, e := range r.Pool.List() {
+		current[Endpoint{Name: e.Name, URL: e.URL, Archive: e.Archive}] = e
+	}
+	var out, dialed []*rpcpool.Endpoint
+	var added []string
+	for _, c := range configured {
+		if e, ok := current[c]; ok {
+			out = append(out, e)
+			continue
+		}
+		e, err := rpcpool.Dial(ctx, c.Name, c.URL)
+		if err != nil {
+			for _, d := range dialed {
+				d.Client.Close()
+			}
+			return nil, nil, err
+		}
+		e.Archive = c.Archive
+		dialed = append(dialed, e)
+		out = append(out, e)
+		added = append(added, c.Name)
+	}
+	return out, added, nil
+}
+
+// close closes removed endpoints once requests that picked them have had
+// time to finish
+func (r *Reloader) close(removed []*rpcpool.Endpoint) {
+	if len(removed) == 0 {
+		return
+	}
+	drain := r.Drain
+	if drain <= 0 {
+		drain = 30 * time.Second
+	}
+	fired := clock.Or(r.Clock).After(drain)
+	go func() {
+		<-fired
+		for _, e := range removed {
+			e.Client.Close()
+		}
+	}()
+}
+
+func (r *Reloader) record(ctx context.Context, outcome string, details map[string]string) {
+	for k, v := range details {
+		if v == "" {
+			delete(details, k)
+		}
+	}
+	r.Audit.Record(ctx, audit.Entry{
+		Actor:   "config",
+		Action:  "config-reload",
+		Subject: r.Path,
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+func gasStrategy(g *Gas) wallet.GasStrategy {
+	switch g.Strategy {
+	case GasLegacy:
+		return wallet.LegacyStrategy{}
+	case GasFixed:
+		return wallet.FixedGasPrice{Price: g.Price}
+	default:
+		return &wallet.DynamicFeeStrategy{BaseFeeMultiplier: g.BaseFeeMultiplier, MinTip: g.MinTip, MaxFeeCap: g.MaxFeeCap}
+	}
+}
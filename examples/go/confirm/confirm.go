@@ -0,0 +1,188 @@
+package confirm
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/pricing"
+	"github.com/whisperchain/go-examples/txmgr"
+)
+
+// KindBridgeWithdrawal labels withdrawals from an L1 bridge, which should
+// wait for finality
+const KindBridgeWithdrawal = "bridge-withdrawal"
+
+// ErrReorged is returned when a block is no longer canonical
+var ErrReorged = errors.New("confirm: block reorged out")
+
+// Requirement is how settled a transaction must be before it is trusted
+type Requirement struct {
+	Confirmations uint64 `json:"confirmations"` // blocks including the transaction's; at least 1
+	Finalized     bool   `json:"finalized"`     // wait for the finalized block tag instead
+}
+
+// Stricter reports whether r asks for more than o
+func (r Requirement) Stricter(o Requirement) bool {
+	if r.Finalized != o.Finalized {
+		return r.Finalized
+	}
+	return r.Confirmations > o.Confirmations
+}
+
+// Payment is what a requirement is chosen for
+type Payment struct {
+	ChainID  uint64
+	Asset    common.Address // zero for ETH
+	Amount   *big.Int
+	Decimals uint8
+	Kind     string // optional label such as KindBridgeWithdrawal
+}
+
+// Rule sets a requirement for payments on a chain, of an asset or kind, at or
+// above a fiat value. Zero fields match everything
+type Rule struct {
+	ChainID  uint64
+	Asset    *common.Address
+	Kind     string
+	MinValue *big.Rat // in the currency of the policy's prices
+	Requirement
+}
+
+// Policy picks the strictest requirement among the rules matching a payment
+type Policy struct {
+	Rules   []Rule
+	Default Requirement
+	// Prices values payments for MinValue rules; payments that cannot be
+	// valued are held to every value rule
+	Prices pricing.Source
+	Clock  clock.Clock // the time payments are valued at; nil is the wall clock
+}
+
+// DefaultPolicy waits 1 confirmation under 100, 3 from 100 and 12 from
+// 10,000 in the prices' currency, and for finality on bridge withdrawals
+func DefaultPolicy(prices pricing.Source) *Policy {
+	return &Policy{
+		Default: Requirement{Confirmations: 1},
+		Prices:  prices,
+		Rules: []Rule{
+			{MinValue: big.NewRat(100, 1), Requirement: Requirement{Confirmations: 3}},
+			{MinValue: big.NewRat(10000, 1), Requirement: Requirement{Confirmations: 12}},
+			{Kind: KindBridgeWithdrawal, Requirement: Requirement{Finalized: true}},
+		},
+	}
+}
+
+// Requirement returns what p asks of pay
+func (p *Policy) Requirement(ctx context.Context, pay Payment) (Requirement, error) {
+	req := p.Default
+	var value *big.Rat
+	valued := false
+	for _, rule := range p.Rules {
+		if rule.ChainID != 0 && rule.ChainID != pay.ChainID {
+			continue
+		}
+		if rule.Asset != nil && *rule.Asset != pay.Asset {
+			continue
+		}
+		if rule.Kind != "" && rule.Kind != pay.Kind {
+			continue
+		}
+		if rule.MinValue != nil {
+			if !valued {
+				valued = true
+				if p.Prices != nil && pay.Amount != nil {
+					v, err := pricing.Value(ctx, p.Prices, pay.Asset, pay.Amount, pay.Decimals, clock.Or(p.Clock).Now())
+					if err != nil && !errors.Is(err, pricing.ErrNoPrice) {
+						return Requirement{}, err
+					}
+					value = v
+				}
+			}
+			if value != nil && value.Cmp(rule.MinValue) < 0 {
+				continue
+			}
+		}
+		if rule.Requirement.Stricter(req) {
+			req = rule.Requirement
+		}
+	}
+	if !req.Finalized && req.Confirmations == 0 {
+		req.Confirmations = 1
+	}
+	return req, nil
+}
+
+// Met reports whether the block holding a transaction satisfies req. It
+// returns ErrReorged when the block is no longer canonical
+func Met(ctx context.Context, client *ethclient.Client, req Requirement, number uint64, hash common.Hash) (bool, error) {
+	h, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if errors.Is(err, ethereum.NotFound) {
+		return false, ErrReorged
+	}
+	if err != nil {
+		return false, err
+	}
+	if h.Hash() != hash {
+		return false, ErrReorged
+	}
+
+	if req.Finalized {
+		final, err := client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+		if err != nil {
+			return false, err
+		}
+		return final.Number.Uint64() >= number, nil
+	}
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	confirmations := req.Confirmations
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	return head+1 >= number+confirmations, nil
+}
+
+// Wait waits until the transaction meets req and returns its receipt,
+// polling every poll on clk; a nil clk is the wall clock
+func Wait(ctx context.Context, client *ethclient.Client, txHash common.Hash, req Requirement, clk clock.Clock, poll time.Duration) (*types.Receipt, error) {
+	if !req.Finalized {
+		m := &txmgr.Manager{Client: client, Config: txmgr.Config{Confirmations: req.Confirmations, PollInterval: poll}, Clock: clk}
+		return m.WaitHash(ctx, txHash)
+	}
+	if poll <= 0 {
+		poll = 12 * time.Second
+	}
+	ticker := clock.Or(clk).NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		rcpt, err := client.TransactionReceipt(ctx, txHash)
+		switch {
+		case err == nil:
+			ok, err := Met(ctx, client, req, rcpt.BlockNumber.Uint64(), rcpt.BlockHash)
+			if ok {
+				return rcpt, nil
+			}
+			// A reorged receipt is looked up again on the next tick
+			if err != nil && !errors.Is(err, ErrReorged) {
+				return nil, err
+			}
+		case !errors.Is(err, ethereum.NotFound):
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package confirm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/indexer"
+)
+
+// Settler holds incoming transfers back until they meet a policy, so
+// payment detection only acts on settled funds
+type Settler struct {
+	Client   *ethclient.Client
+	Policy   *Policy
+	Kind     string                           // payment kind passed to the policy
+	Decimals func(asset common.Address) uint8 // nil assumes 18
+	Poll     time.Duration
+	Clock    clock.Clock // paces polling; nil is the wall clock
+
+	chainID uint64
+}
+
+// NewSettler creates a settler checking every 12 seconds
+func NewSettler(client *ethclient.Client, policy *Policy) *Settler {
+	return &Settler{Client: client, Policy: policy, Poll: 12 * time.Second}
+}
+
+// Requirement returns what the policy asks of t
+func (s *Settler) Requirement(ctx context.Context, t *indexer.Transfer) (Requirement, error) {
+	if s.chainID == 0 {
+		id, err := s.Client.ChainID(ctx)
+		if err != nil {
+			return Requirement{}, err
+		}
+		s.chainID = id.Uint64()
+	}
+	return s.Policy.Requirement(ctx, Payment{
+		ChainID:  s.chainID,
+		Asset:    t.Asset,
+		Amount:   t.Amount.Base(),
+		Decimals: s.decimals(t.Asset),
+		Kind:     s.Kind,
+	})
+}
+
+// decimals returns the decimals of asset's amounts
+func (s *Settler) decimals(asset common.Address) uint8 {
+	if s.Decimals == nil || asset == indexer.NativeAsset {
+		return 18
+	}
+	return s.Decimals(asset)
+}
+
+// Settled reports whether t meets the policy. It returns ErrReorged when
+// the block holding t is no longer canonical
+func (s *Settler) Settled(ctx context.Context, t *indexer.Transfer) (bool, error) {
+	req, err := s.Requirement(ctx, t)
+	if err != nil {
+		return false, err
+	}
+	return Met(ctx, s.Client, req, t.BlockNumber, t.BlockHash)
+}
+
+// Settle passes on each transfer from in once it is settled. Transfers whose
+// block is reorged out are dropped; a watcher sends them again if they are
+// mined on the new chain. The channel closes when in closes and nothing is
+// pending, or when ctx is done
+func (s *Settler) Settle(ctx context.Context, in <-chan indexer.Transfer) <-chan indexer.Transfer {
+	out := make(chan indexer.Transfer)
+	go func() {
+		defer close(out)
+		poll := s.Poll
+		if poll <= 0 {
+			poll = 12 * time.Second
+		}
+		ticker := clock.Or(s.Clock).NewTicker(poll)
+		defer ticker.Stop()
+
+		var pending []indexer.Transfer
+		for in != nil || len(pending) > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case t, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				pending = append(pending, t)
+			case <-ticker.C():
+			}
+
+			kept := pending[:0]
+			for _, t := range pending {
+				settled, err := s.Settled(ctx, &t)
+				switch {
+				case errors.Is(err, ErrReorged):
+					continue
+				case err != nil || !settled:
+					// Node errors are retried on the next tick
+					kept = append(kept, t)
+					continue
+				}
+				select {
+				case out <- t:
+				case <-ctx.Done():
+					return
+				}
+			}
+			pending = kept
+		}
+	}()
+	return out
+}
@@ -0,0 +1,305 @@
+package confirm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/txmgr"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// EventType is a step in an incoming payment's life
+type EventType string
+
+const (
+	EventPending  EventType = "pending"  // seen in the node's pool
+	EventMined    EventType = "mined"    // included in a canonical block
+	EventSettled  EventType = "settled"  // meets the confirmation policy; safe to act on
+	EventReversed EventType = "reversed" // a payment reported before is gone
+)
+
+// Event reports a change in an incoming payment. Pending payments have no
+// block or log index
+type Event struct {
+	Type     EventType
+	Transfer indexer.Transfer
+	Reason   string // why a payment was reversed
+}
+
+// Tracker follows incoming payments from the pool to settlement and reports
+// any that disappear on the way: pool transactions replaced by another at
+// the same nonce or dropped, and mined ones reorged out without being mined
+// again. Merchants should only ship on EventSettled
+type Tracker struct {
+	Settler *Settler
+	Account common.Address
+	// WatchPool also reports pending payments from txpool_content. The whole
+	// pool is read on every poll, so prefer a local node
+	WatchPool bool
+	// DropAfter is how many polls a pool transaction may be missing before
+	// it is reported dropped; nodes evict and re-admit transactions
+	DropAfter int
+}
+
+// tracked is one payment being followed
+type tracked struct {
+	transfer indexer.Transfer
+	state    EventType
+	nonce    uint64 // sender nonce, for pending payments
+	missing  int
+}
+
+// NewTracker creates a tracker for payments to account
+func NewTracker(s *Settler, account common.Address) *Tracker {
+	return &Tracker{Settler: s, Account: account, DropAfter: 2}
+}
+
+// Track follows the mined transfers from in, such as a watcher's Incoming
+// channel, and the pool when WatchPool is set. The channel closes when ctx is
+// done or, without WatchPool, when in closes and nothing is left to follow
+func (tr *Tracker) Track(ctx context.Context, in <-chan indexer.Transfer) <-chan Event {
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		poll := tr.Settler.Poll
+		if poll <= 0 {
+			poll = 12 * time.Second
+		}
+		ticker := clock.Or(tr.Settler.Clock).NewTicker(poll)
+		defer ticker.Stop()
+
+		payments := make(map[string]*tracked)
+		emit := func(typ EventType, p *tracked, reason string) bool {
+			select {
+			case out <- Event{Type: typ, Transfer: p.transfer, Reason: reason}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for in != nil || len(payments) > 0 || tr.WatchPool {
+			select {
+			case <-ctx.Done():
+				return
+			case t, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				if !tr.mined(payments, t, emit) {
+					return
+				}
+				continue
+			case <-ticker.C():
+			}
+
+			if tr.WatchPool {
+				if !tr.scanPool(ctx, payments, emit) {
+					return
+				}
+			}
+			if !tr.check(ctx, payments, emit) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// mined records a transfer from a block, replacing its pool entry
+func (tr *Tracker) mined(payments map[string]*tracked, t indexer.Transfer, emit func(EventType, *tracked, string) bool) bool {
+	delete(payments, poolKey(t.TxHash))
+	key := minedKey(&t)
+	if p, ok := payments[key]; ok && p.transfer.BlockHash == t.BlockHash {
+		return true
+	}
+	p := &tracked{transfer: t, state: EventMined}
+	payments[key] = p
+	return emit(EventMined, p, "")
+}
+
+// scanPool reports new pending payments and ones that left the pool unmined
+func (tr *Tracker) scanPool(ctx context.Context, payments map[string]*tracked, emit func(EventType, *tracked, string) bool) bool {
+	content, err := txmgr.TxPoolContent(ctx, tr.Settler.Client)
+	if err != nil {
+		// No txpool namespace, or a transient error; try again next poll
+		return true
+	}
+	inPool := make(map[common.Hash]bool)
+	for _, byNonce := range []map[common.Address]txmgr.PoolTxs{content.Pending, content.Queued} {
+		for from, txs := range byNonce {
+			for nonce, ptx := range txs {
+				t, ok := tr.poolTransfer(from, ptx)
+				if !ok {
+					continue
+				}
+				inPool[t.TxHash] = true
+				key := poolKey(t.TxHash)
+				if p, ok := payments[key]; ok {
+					p.missing = 0
+					continue
+				}
+				p := &tracked{transfer: t, state: EventPending, nonce: nonce}
+				payments[key] = p
+				if !emit(EventPending, p, "") {
+					return false
+				}
+			}
+		}
+	}
+
+	for key, p := range payments {
+		if p.state != EventPending || inPool[p.transfer.TxHash] {
+			continue
+		}
+		// Mined transactions leave the pool; the mined transfer replaces the
+		// pool entry once it arrives, unless the transaction reverted
+		reason := ""
+		rcpt, err := tr.Settler.Client.TransactionReceipt(ctx, p.transfer.TxHash)
+		if err == nil && rcpt.Status == types.ReceiptStatusSuccessful {
+			continue
+		}
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		nonce, err := tr.Settler.Client.NonceAt(ctx, p.transfer.From, nil)
+		if err != nil {
+			continue
+		}
+		switch {
+		case rcpt != nil:
+			reason = "transaction reverted"
+		case nonce > p.nonce:
+			reason = fmt.Sprintf("replaced: sender nonce %d was used by another transaction", p.nonce)
+		default:
+			if p.missing++; p.missing < tr.dropAfter() {
+				continue
+			}
+			reason = "dropped from the pool"
+		}
+		delete(payments, key)
+		if !emit(EventReversed, p, reason) {
+			return false
+		}
+	}
+	return true
+}
+
+// check settles mined payments and reverses ones reorged out for good
+func (tr *Tracker) check(ctx context.Context, payments map[string]*tracked, emit func(EventType, *tracked, string) bool) bool {
+	for key, p := range payments {
+		if p.state != EventMined {
+			continue
+		}
+		settled, err := tr.Settler.Settled(ctx, &p.transfer)
+		switch {
+		case err == nil && settled:
+			delete(payments, key)
+			if !emit(EventSettled, p, "") {
+				return false
+			}
+		case errors.Is(err, ErrReorged):
+			moved, err := tr.remined(ctx, p)
+			if err != nil {
+				continue
+			}
+			if moved {
+				delete(payments, key)
+				newKey := minedKey(&p.transfer)
+				if _, dup := payments[newKey]; dup {
+					// The watcher already sent the transfer from its new block
+					continue
+				}
+				payments[newKey] = p
+				if !emit(EventMined, p, "") {
+					return false
+				}
+				continue
+			}
+			delete(payments, key)
+			if !emit(EventReversed, p, "reorged out of block "+p.transfer.BlockHash.Hex()) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// remined reports whether a reorged payment's transaction succeeded in
+// another canonical block, moving the payment there
+func (tr *Tracker) remined(ctx context.Context, p *tracked) (bool, error) {
+	rcpt, err := tr.Settler.Client.TransactionReceipt(ctx, p.transfer.TxHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if rcpt.Status != types.ReceiptStatusSuccessful || rcpt.BlockHash == p.transfer.BlockHash {
+		return false, nil
+	}
+	if _, err := Met(ctx, tr.Settler.Client, Requirement{Confirmations: 1}, rcpt.BlockNumber.Uint64(), rcpt.BlockHash); err != nil {
+		if errors.Is(err, ErrReorged) {
+			return false, nil
+		}
+		return false, err
+	}
+	p.transfer.BlockNumber = rcpt.BlockNumber.Uint64()
+	p.transfer.BlockHash = rcpt.BlockHash
+	if !p.transfer.IsNative() {
+		// Log indexes shift with the block; find the transfer's new one
+		for _, l := range rcpt.Logs {
+			if l.Address == p.transfer.Asset && len(l.Topics) == 3 &&
+				common.BytesToAddress(l.Topics[2].Bytes()) == tr.Account &&
+				new(big.Int).SetBytes(l.Data).Cmp(p.transfer.Amount.Base()) == 0 {
+				p.transfer.LogIndex = l.Index
+				break
+			}
+		}
+	}
+	return true, nil
+}
+
+// poolTransfer decodes a pool transaction paying the account ETH, or tokens
+// through transfer(address,uint256)
+func (tr *Tracker) poolTransfer(from common.Address, ptx *txmgr.PoolTx) (indexer.Transfer, bool) {
+	if ptx.To == nil {
+		return indexer.Transfer{}, false
+	}
+	t := indexer.Transfer{From: from, TxHash: ptx.Hash}
+	if *ptx.To == tr.Account && ptx.Value != nil && ptx.Value.ToInt().Sign() > 0 {
+		t.Asset, t.To, t.Amount = indexer.NativeAsset, tr.Account, units.NewWei(ptx.Value.ToInt()).Amount()
+		return t, true
+	}
+	if to, amount, ok := contract.DecodeTransfer(ptx.Input); ok && to == tr.Account {
+		token := units.Token{Address: *ptx.To, Decimals: tr.Settler.decimals(*ptx.To)}
+		t.Asset, t.To, t.Amount = *ptx.To, tr.Account, units.NewTokenAmount(token, amount)
+		return t, true
+	}
+	return indexer.Transfer{}, false
+}
+
+func (tr *Tracker) dropAfter() int {
+	if tr.DropAfter < 1 {
+		return 1
+	}
+	return tr.DropAfter
+}
+
+func poolKey(hash common.Hash) string {
+	return "pool/" + hash.Hex()
+}
+
+func minedKey(t *indexer.Transfer) string {
+	return fmt.Sprintf("mined/%s/%d", t.TxHash.Hex(), t.LogIndex)
+}
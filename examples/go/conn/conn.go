@@ -0,0 +1,251 @@
+package conn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/clock"
+)
+
+var (
+	// ErrClosed is returned for requests made after Close
+	ErrClosed = errors.New("conn: connection closed")
+	// ErrBackoff is returned while waiting to retry a node that just failed
+	ErrBackoff = errors.New("conn: backing off after node failure")
+	// ErrNoSubscriptions is returned by Subscribe on an HTTP endpoint
+	ErrNoSubscriptions = errors.New("conn: subscriptions need a websocket endpoint")
+)
+
+// Conn is a node connection that dials lazily and can be closed. Over HTTP
+// the client is built without any network traffic, connections are opened
+// per request, kept while in use and torn down after IdleTimeout, so a node
+// that is down at startup only fails the requests made while it is down.
+// Over websockets the client is dialed on first use, and geth re-dials a
+// dropped socket on the next request. After a failed request or dial, calls
+// fail fast with ErrBackoff for an exponentially growing interval rather
+// than piling onto a struggling node.
+//
+// Close tears down everything sharing the connection: the client handed to
+// wallets and token bindings stops serving requests, and subscriptions made
+// through Subscribe are unsubscribed
+type Conn struct {
+	URL         string
+	IdleTimeout time.Duration // idle HTTP connections are closed after this; zero is 90 seconds
+	MinBackoff  time.Duration // first retry delay after a failure; zero is one second
+	MaxBackoff  time.Duration // zero is 30 seconds
+	Clock       clock.Clock
+
+	mu        sync.Mutex
+	client    *ethclient.Client
+	transport *http.Transport
+	failures  int
+	retryAt   time.Time
+	subs      map[*subscription]struct{}
+	closed    bool
+}
+
+// New creates a connection to url without dialing it
+func New(url string) *Conn {
+	return &Conn{URL: url, subs: make(map[*subscription]struct{})}
+}
+
+// Client returns the connection's client, creating it on first use. HTTP
+// clients are created without contacting the node; websocket and IPC
+// clients are dialed, and a failed dial backs off like a failed request
+func (c *Conn) Client(ctx context.Context) (*ethclient.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if c.client != nil {
+		return c.client, nil
+	}
+	if err := c.backingOff(); err != nil {
+		return nil, err
+	}
+	var (
+		client *rpc.Client
+		err    error
+	)
+	if c.isHTTP() {
+		c.transport = http.DefaultTransport.(*http.Transport).Clone()
+		c.transport.IdleConnTimeout = c.idleTimeout()
+		client, err = rpc.DialOptions(ctx, c.URL, rpc.WithHTTPClient(&http.Client{Transport: (*roundTripper)(c)}))
+	} else {
+		client, err = rpc.DialContext(ctx, c.URL)
+	}
+	if err != nil {
+		c.failed()
+		return nil, err
+	}
+	c.failures = 0
+	c.client = ethclient.NewClient(client)
+	return c.client, nil
+}
+
+// Subscribe starts a subscription on the connection's client and tracks it,
+// so Close unsubscribes it
+func (c *Conn) Subscribe(ctx context.Context, start func(*ethclient.Client) (ethereum.Subscription, error)) (ethereum.Subscription, error) {
+	if c.isHTTP() {
+		return nil, ErrNoSubscriptions
+	}
+	client, err := c.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := start(client)
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{Subscription: inner, conn: c}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		inner.Unsubscribe()
+		return nil, ErrClosed
+	}
+	if c.subs == nil {
+		c.subs = make(map[*subscription]struct{})
+	}
+	c.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Subscriptions returns how many tracked subscriptions are active
+func (c *Conn) Subscriptions() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.subs)
+}
+
+// Close unsubscribes every tracked subscription and closes the client.
+// Later requests fail with ErrClosed. Closing twice is harmless
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	subs := c.subs
+	c.subs = make(map[*subscription]struct{})
+	client, transport := c.client, c.transport
+	c.mu.Unlock()
+
+	for sub := range subs {
+		sub.Unsubscribe()
+	}
+	if client != nil {
+		client.Close()
+	}
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// roundTripper is the HTTP side of a Conn: it refuses requests while closed
+// or backing off and counts transport failures
+type roundTripper Conn
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := (*Conn)(rt)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if err := c.backingOff(); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	transport := c.transport
+	c.mu.Unlock()
+
+	resp, err := transport.RoundTrip(req)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil && req.Context().Err() == nil && isConnError(err) {
+		c.failed()
+		// the next request after the backoff dials afresh
+		transport.CloseIdleConnections()
+	} else if err == nil {
+		c.failures = 0
+	}
+	return resp, err
+}
+
+// backingOff returns ErrBackoff until the retry time; c.mu must be held
+func (c *Conn) backingOff() error {
+	if c.failures == 0 {
+		return nil
+	}
+	if wait := c.retryAt.Sub(clock.Or(c.Clock).Now()); wait > 0 {
+		return fmt.Errorf("%w: retrying %s in %s", ErrBackoff, c.URL, wait.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// failed doubles the backoff; c.mu must be held
+func (c *Conn) failed() {
+	min, max := c.MinBackoff, c.MaxBackoff
+	if min <= 0 {
+		min = time.Second
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	wait := min
+	for i := 0; i < c.failures && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	c.failures++
+	c.retryAt = clock.Or(c.Clock).Now().Add(wait)
+}
+
+func (c *Conn) idleTimeout() time.Duration {
+	if c.IdleTimeout <= 0 {
+		return 90 * time.Second
+	}
+	return c.IdleTimeout
+}
+
+func (c *Conn) isHTTP() bool {
+	return strings.HasPrefix(c.URL, "http://") || strings.HasPrefix(c.URL, "https://")
+}
+
+// isConnError reports whether err means the node could not be reached, as
+// opposed to a request it answered
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// subscription stops being tracked once unsubscribed
+type subscription struct {
+	ethereum.Subscription
+	conn *Conn
+	once sync.Once
+}
+
+func (s *subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.conn.mu.Lock()
+		delete(s.conn.subs, s)
+		s.conn.mu.Unlock()
+		s.Subscription.Unsubscribe()
+	})
+}
@@ -0,0 +1,72 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// ErrResultType is returned when a call's outputs do not fit the requested
+// result type
+var ErrResultType = errors.New("contract: unexpected call result type")
+
+// Caller is a contract binding that can call view methods, such as the
+// *bind.BoundContract every binding in this module holds
+type Caller interface {
+	Call(opts *bind.CallOpts, results *[]interface{}, method string, params ...interface{}) error
+}
+
+// Call calls a view method at the latest block and returns its output as T.
+// A single output converts to T directly, including a tuple into a struct
+// with matching field names; several outputs fill the fields of struct T in
+// order
+func Call[T any](ctx context.Context, c Caller, method string, args ...interface{}) (T, error) {
+	return CallOpts[T](&bind.CallOpts{Context: ctx}, c, method, args...)
+}
+
+// CallOpts is Call with explicit call options, such as a historical block
+func CallOpts[T any](opts *bind.CallOpts, c Caller, method string, args ...interface{}) (T, error) {
+	var out []interface{}
+	if err := c.Call(opts, &out, method, args...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return convert[T](method, out)
+}
+
+func convert[T any](method string, out []interface{}) (result T, err error) {
+	if len(out) == 1 {
+		if v, ok := out[0].(T); ok {
+			return v, nil
+		}
+	}
+	// abi.ConvertType panics on types it cannot set
+	defer func() {
+		if r := recover(); r != nil {
+			var zero T
+			result, err = zero, fmt.Errorf("%w: %s into %T: %v", ErrResultType, method, zero, r)
+		}
+	}()
+	switch {
+	case len(out) == 1:
+		return *abi.ConvertType(out[0], new(T)).(*T), nil
+	case len(out) > 1:
+		v := reflect.ValueOf(&result).Elem()
+		if v.Kind() != reflect.Struct || v.NumField() != len(out) {
+			break
+		}
+		for i, o := range out {
+			field, src := v.Field(i), reflect.ValueOf(o)
+			if !src.Type().ConvertibleTo(field.Type()) {
+				return result, fmt.Errorf("%w: %s output %d is %T, not %s", ErrResultType, method, i, o, field.Type())
+			}
+			field.Set(src.Convert(field.Type()))
+		}
+		return result, nil
+	}
+	return result, fmt.Errorf("%w: %s returned %d values for %T", ErrResultType, method, len(out), result)
+}
@@ -1,46 +1,262 @@
 package contract
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"math/big"
+	"strings"
+	"sync"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/conn"
+	"github.com/whisperchain/go-examples/units"
 )
 
+// erc20ABIJSON is the standard ERC-20 interface
+const erc20ABIJSON = `[
+{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+{"type":"function","name":"totalSupply","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"approve","stateMutability":"nonpayable","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"transferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+{"type":"event","name":"Approval","anonymous":false,"inputs":[{"name":"owner","type":"address","indexed":true},{"name":"spender","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+// erc20Bytes32ABIJSON covers older tokens, such as MKR, that return name and
+// symbol as bytes32
+const erc20Bytes32ABIJSON = `[
+{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]}
+]`
+
+var (
+	erc20ABI        = mustParseABI(erc20ABIJSON)
+	erc20Bytes32ABI = mustParseABI(erc20Bytes32ABIJSON)
+)
+
+// ERC-20 function selectors and event topics, taken from the parsed ABI for
+// code that builds or inspects raw calldata and logs. Do not modify them
+var (
+	TransferSelector     = erc20ABI.Methods["transfer"].ID
+	TransferFromSelector = erc20ABI.Methods["transferFrom"].ID
+	ApproveSelector      = erc20ABI.Methods["approve"].ID
+	BalanceOfSelector    = erc20ABI.Methods["balanceOf"].ID
+	TransferTopic        = erc20ABI.Events["Transfer"].ID
+	ApprovalTopic        = erc20ABI.Events["Approval"].ID
+)
+
+// ErrAmountRange is returned for token amounts that are negative or do not
+// fit in a uint256
+var ErrAmountRange = errors.New("contract: amount out of uint256 range")
+
+// ErrNoClient is returned by calls on an ERC20 with neither a client nor a
+// Conn
+var ErrNoClient = errors.New("contract: no node client")
+
+// TransferData returns the calldata of transfer(to, amount)
+func TransferData(to common.Address, amount *big.Int) ([]byte, error) {
+	return packAddressUint(TransferSelector, to, amount)
+}
+
+// ApproveData returns the calldata of approve(spender, amount)
+func ApproveData(spender common.Address, amount *big.Int) ([]byte, error) {
+	return packAddressUint(ApproveSelector, spender, amount)
+}
+
+// TransferFromData returns the calldata of transferFrom(from, to, amount)
+func TransferFromData(from, to common.Address, amount *big.Int) ([]byte, error) {
+	word, err := uint256Word(amount)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, 4+3*32)
+	data = append(data, TransferFromSelector...)
+	data = append(data, common.LeftPadBytes(from.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(to.Bytes(), 32)...)
+	return append(data, word...), nil
+}
+
+// BalanceOfData returns the calldata of balanceOf(account)
+func BalanceOfData(account common.Address) []byte {
+	return append(append([]byte(nil), BalanceOfSelector...), common.LeftPadBytes(account.Bytes(), 32)...)
+}
+
+// DecodeTransfer unpacks transfer calldata, reporting false for anything else
+func DecodeTransfer(data []byte) (to common.Address, amount *big.Int, ok bool) {
+	return unpackAddressUint(TransferSelector, data)
+}
+
+// DecodeApprove unpacks approve calldata, reporting false for anything else
+func DecodeApprove(data []byte) (spender common.Address, amount *big.Int, ok bool) {
+	return unpackAddressUint(ApproveSelector, data)
+}
+
+// DecodeTransferFrom unpacks transferFrom calldata, reporting false for
+// anything else
+func DecodeTransferFrom(data []byte) (from, to common.Address, amount *big.Int, ok bool) {
+	if len(data) != 4+3*32 || !bytes.Equal(data[:4], TransferFromSelector) {
+		return common.Address{}, common.Address{}, nil, false
+	}
+	return common.BytesToAddress(data[4:36]), common.BytesToAddress(data[36:68]), new(big.Int).SetBytes(data[68:100]), true
+}
+
+func packAddressUint(selector []byte, addr common.Address, amount *big.Int) ([]byte, error) {
+	word, err := uint256Word(amount)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, 4+2*32)
+	data = append(data, selector...)
+	data = append(data, common.LeftPadBytes(addr.Bytes(), 32)...)
+	return append(data, word...), nil
+}
+
+// uint256Word encodes amount as one ABI word
+func uint256Word(amount *big.Int) ([]byte, error) {
+	if amount == nil || amount.Sign() < 0 || amount.BitLen() > 256 {
+		return nil, ErrAmountRange
+	}
+	return amount.FillBytes(make([]byte, 32)), nil
+}
+
+func unpackAddressUint(selector, data []byte) (common.Address, *big.Int, bool) {
+	if len(data) != 4+2*32 || !bytes.Equal(data[:4], selector) {
+		return common.Address{}, nil, false
+	}
+	return common.BytesToAddress(data[4:36]), new(big.Int).SetBytes(data[36:68]), true
+}
+
 // ERC20 represents an ERC-20 token contract
 type ERC20 struct {
 	Address common.Address
-	Client  *ethclient.Client
+	Client  *ethclient.Client // supplied by the caller; nil with a Conn
+	// Conn supplies the client on first use and is closed by Close; nil
+	// when the client was supplied by the caller
+	Conn *conn.Conn
+
+	bindMu   sync.Mutex // guards client and contract
+	client   *ethclient.Client
+	contract *bind.BoundContract
+
+	mu    sync.Mutex
+	token *units.Token
 }
 
-// NewERC20 creates a new ERC20 instance
+// NewERC20 creates a new ERC20 instance on a client owned by the caller
 func NewERC20(address common.Address, client *ethclient.Client) *ERC20 {
 	return &ERC20{
-		Address: address,
-		Client:  client,
+		Address:  address,
+		Client:   client,
+		client:   client,
+		contract: bind.NewBoundContract(address, erc20ABI, client, client, client),
+	}
+}
+
+// NewERC20FromConn creates an ERC20 that takes its client from c on first
+// use, so a node that is down at startup fails only the calls made while it
+// is down. Close closes c, and with it any wallet sharing it
+func NewERC20FromConn(address common.Address, c *conn.Conn) *ERC20 {
+	return &ERC20{Address: address, Conn: c}
+}
+
+// Close closes the token's Conn. Tokens created with NewERC20 leave the
+// client to its owner
+func (e *ERC20) Close() error {
+	if e.Conn == nil {
+		return nil
 	}
+	return e.Conn.Close()
+}
+
+// bound returns the contract binding and its client, resolving the client
+// through Conn on first use; a failed resolve is retried by the next call
+func (e *ERC20) bound(ctx context.Context) (*bind.BoundContract, *ethclient.Client, error) {
+	e.bindMu.Lock()
+	defer e.bindMu.Unlock()
+	if e.contract != nil {
+		return e.contract, e.client, nil
+	}
+	if e.Conn == nil {
+		return nil, nil, ErrNoClient
+	}
+	client, err := e.Conn.Client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.client = client
+	e.contract = bind.NewBoundContract(e.Address, erc20ABI, client, client, client)
+	return e.contract, client, nil
+}
+
+// NewERC20ForToken creates an ERC20 for a token whose symbol and decimals
+// are already known, so Token does not read them from the contract
+func NewERC20ForToken(token units.Token, client *ethclient.Client) *ERC20 {
+	e := NewERC20(token.Address, client)
+	e.token = &token
+	return e
+}
+
+// Token returns the token's address, symbol and decimals, reading them from
+// the contract on first use
+func (e *ERC20) Token(ctx context.Context) (units.Token, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token != nil {
+		return *e.token, nil
+	}
+	symbol, err := e.callString(ctx, "symbol")
+	if err != nil {
+		return units.Token{}, err
+	}
+	decimals, err := e.callUint8(ctx, "decimals")
+	if err != nil {
+		return units.Token{}, err
+	}
+	e.token = &units.Token{Address: e.Address, Symbol: symbol, Decimals: decimals}
+	return *e.token, nil
 }
 
 // BalanceOf returns the token balance of an address
-func (e *ERC20) BalanceOf(ctx context.Context, address common.Address) (*big.Int, error) {
-	// This is a simplified version. In production, use generated bindings
-	// For demonstration purposes
-	return big.NewInt(0), nil
+func (e *ERC20) BalanceOf(ctx context.Context, address common.Address) (units.TokenAmount, error) {
+	return e.callAmount(ctx, "balanceOf", address)
 }
 
-// Transfer transfers tokens to an address
+// Transfer transfers tokens to an address. The amount must be of this token
 func (e *ERC20) Transfer(
 	ctx context.Context,
 	auth *bind.TransactOpts,
 	to common.Address,
-	amount *big.Int,
+	amount units.TokenAmount,
 ) (*types.Transaction, error) {
-	// This would use generated contract bindings in production
-	// Example implementation placeholder
-	return nil, nil
+	if err := e.owns(amount); err != nil {
+		return nil, err
+	}
+	return e.transact(ctx, auth, "transfer", to, amount.Base())
+}
+
+// TransferFrom moves tokens from an owner that approved auth.From
+func (e *ERC20) TransferFrom(
+	ctx context.Context,
+	auth *bind.TransactOpts,
+	from common.Address,
+	to common.Address,
+	amount units.TokenAmount,
+) (*types.Transaction, error) {
+	if err := e.owns(amount); err != nil {
+		return nil, err
+	}
+	return e.transact(ctx, auth, "transferFrom", from, to, amount.Base())
 }
 
 // Approve approves a spender to spend tokens
@@ -48,10 +264,12 @@ func (e *ERC20) Approve(
 	ctx context.Context,
 	auth *bind.TransactOpts,
 	spender common.Address,
-	amount *big.Int,
+	amount units.TokenAmount,
 ) (*types.Transaction, error) {
-	// Implementation placeholder
-	return nil, nil
+	if err := e.owns(amount); err != nil {
+		return nil, err
+	}
+	return e.transact(ctx, auth, "approve", spender, amount.Base())
 }
 
 // Allowance returns the allowance for a spender
@@ -59,9 +277,30 @@ func (e *ERC20) Allowance(
 	ctx context.Context,
 	owner common.Address,
 	spender common.Address,
-) (*big.Int, error) {
-	// Implementation placeholder
-	return big.NewInt(0), nil
+) (units.TokenAmount, error) {
+	return e.callAmount(ctx, "allowance", owner, spender)
+}
+
+// callAmount calls a uint256 getter and scales the result by the token
+func (e *ERC20) callAmount(ctx context.Context, method string, args ...interface{}) (units.TokenAmount, error) {
+	token, err := e.Token(ctx)
+	if err != nil {
+		return units.TokenAmount{}, err
+	}
+	v, err := e.callUint(ctx, method, args...)
+	if err != nil {
+		return units.TokenAmount{}, err
+	}
+	return units.NewTokenAmount(token, v), nil
+}
+
+// owns rejects amounts of other tokens, which would move the wrong number
+// of base units
+func (e *ERC20) owns(amount units.TokenAmount) error {
+	if amount.Token().Address != e.Address {
+		return units.ErrTokenMismatch
+	}
+	return nil
 }
 
 // TokenInfo represents token metadata
@@ -74,11 +313,204 @@ type TokenInfo struct {
 
 // GetTokenInfo retrieves token information
 func (e *ERC20) GetTokenInfo(ctx context.Context) (*TokenInfo, error) {
-	// In production, this would call the contract methods
+	name, err := e.callString(ctx, "name")
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := e.callString(ctx, "symbol")
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := e.callUint8(ctx, "decimals")
+	if err != nil {
+		return nil, err
+	}
+	supply, err := e.callUint(ctx, "totalSupply")
+	if err != nil {
+		return nil, err
+	}
 	return &TokenInfo{
-		Name:        "WhisperToken",
-		Symbol:      "WHSP",
-		Decimals:    18,
-		TotalSupply: big.NewInt(1000000000),
+		Name:        name,
+		Symbol:      symbol,
+		Decimals:    decimals,
+		TotalSupply: supply,
 	}, nil
 }
+
+// TransferEvent is a decoded Transfer log
+type TransferEvent struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+	Raw   types.Log
+}
+
+// ApprovalEvent is a decoded Approval log
+type ApprovalEvent struct {
+	Owner   common.Address
+	Spender common.Address
+	Value   *big.Int
+	Raw     types.Log
+}
+
+// ParseTransfer decodes a Transfer log emitted by this token
+func (e *ERC20) ParseTransfer(l types.Log) (*TransferEvent, error) {
+	ev := &TransferEvent{Raw: l}
+	if err := e.unpackLog(ev, "Transfer", l); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// ParseApproval decodes an Approval log emitted by this token
+func (e *ERC20) ParseApproval(l types.Log) (*ApprovalEvent, error) {
+	ev := &ApprovalEvent{Raw: l}
+	if err := e.unpackLog(ev, "Approval", l); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// FilterTransfers returns Transfer events in the block range; nil or empty
+// from and to lists match any address, and a nil end means the latest block
+func (e *ERC20) FilterTransfers(ctx context.Context, start uint64, end *uint64, from, to []common.Address) ([]*TransferEvent, error) {
+	logs, err := e.filter(ctx, "Transfer", start, end, from, to)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*TransferEvent, 0, len(logs))
+	for _, l := range logs {
+		ev, err := e.ParseTransfer(l)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// FilterApprovals returns Approval events in the block range; nil or empty
+// owner and spender lists match any address, and a nil end means the latest block
+func (e *ERC20) FilterApprovals(ctx context.Context, start uint64, end *uint64, owner, spender []common.Address) ([]*ApprovalEvent, error) {
+	logs, err := e.filter(ctx, "Approval", start, end, owner, spender)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*ApprovalEvent, 0, len(logs))
+	for _, l := range logs {
+		ev, err := e.ParseApproval(l)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func (e *ERC20) filter(ctx context.Context, event string, start uint64, end *uint64, first, second []common.Address) ([]types.Log, error) {
+	query := ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(start),
+		Addresses: []common.Address{e.Address},
+		Topics:    [][]common.Hash{{erc20ABI.Events[event].ID}, addressTopics(first), addressTopics(second)},
+	}
+	if end != nil {
+		query.ToBlock = new(big.Int).SetUint64(*end)
+	}
+	_, client, err := e.bound(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.FilterLogs(ctx, query)
+}
+
+func (e *ERC20) unpackLog(out interface{}, event string, l types.Log) error {
+	if l.Address != e.Address {
+		return errors.New("log was not emitted by this token")
+	}
+	// ERC-721 shares the Transfer signature but indexes the third argument
+	if len(l.Topics) != 3 || l.Topics[0] != erc20ABI.Events[event].ID {
+		return errors.New("log is not an ERC-20 " + event + " event")
+	}
+	return bind.NewBoundContract(e.Address, erc20ABI, nil, nil, nil).UnpackLog(out, event, l)
+}
+
+func (e *ERC20) callUint(ctx context.Context, method string, args ...interface{}) (*big.Int, error) {
+	c, _, err := e.bound(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Call[*big.Int](ctx, c, method, args...)
+}
+
+func (e *ERC20) callUint8(ctx context.Context, method string) (uint8, error) {
+	c, _, err := e.bound(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return Call[uint8](ctx, c, method)
+}
+
+// transact sends a state-changing call through the binding
+func (e *ERC20) transact(ctx context.Context, auth *bind.TransactOpts, method string, args ...interface{}) (*types.Transaction, error) {
+	c, _, err := e.bound(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Transact(withContext(ctx, auth), method, args...)
+}
+
+// callString reads a string getter, falling back to bytes32 for old tokens
+func (e *ERC20) callString(ctx context.Context, method string) (string, error) {
+	data, err := erc20ABI.Pack(method)
+	if err != nil {
+		return "", err
+	}
+	_, client, err := e.bound(ctx)
+	if err != nil {
+		return "", err
+	}
+	result, err := client.CallContract(ctx, ethereum.CallMsg{To: &e.Address, Data: data}, nil)
+	if err != nil {
+		return "", err
+	}
+	if out, err := erc20ABI.Unpack(method, result); err == nil {
+		if s, ok := out[0].(string); ok {
+			return s, nil
+		}
+	}
+	out, err := erc20Bytes32ABI.Unpack(method, result)
+	if err != nil {
+		return "", err
+	}
+	b, ok := out[0].([32]byte)
+	if !ok {
+		return "", errors.New("unexpected " + method + " result")
+	}
+	return string(bytes.TrimRight(b[:], "\x00")), nil
+}
+
+func addressTopics(addrs []common.Address) []common.Hash {
+	var topics []common.Hash
+	for _, a := range addrs {
+		topics = append(topics, common.BytesToHash(a.Bytes()))
+	}
+	return topics
+}
+
+// withContext copies auth with ctx applied unless it already carries one
+func withContext(ctx context.Context, auth *bind.TransactOpts) *bind.TransactOpts {
+	if auth.Context != nil {
+		return auth
+	}
+	opts := *auth
+	opts.Context = ctx
+	return &opts
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
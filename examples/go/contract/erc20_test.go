@@ -0,0 +1,156 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/conn"
+)
+
+func TestCalldataMatchesABI(t *testing.T) {
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	from := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	amount := new(big.Int).Set(math.MaxBig256)
+
+	tests := []struct {
+		name   string
+		got    []byte
+		method string
+		args   []interface{}
+	}{
+		{"transfer", must(t)(TransferData(to, amount)), "transfer", []interface{}{to, amount}},
+		{"approve", must(t)(ApproveData(to, big.NewInt(0))), "approve", []interface{}{to, big.NewInt(0)}},
+		{"transferFrom", must(t)(TransferFromData(from, to, amount)), "transferFrom", []interface{}{from, to, amount}},
+		{"balanceOf", BalanceOfData(to), "balanceOf", []interface{}{to}},
+	}
+	for _, tt := range tests {
+		want, err := erc20ABI.Pack(tt.method, tt.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(tt.got, want) {
+			t.Errorf("%s: got %x, want %x", tt.name, tt.got, want)
+		}
+	}
+
+	f, r, a, ok := DecodeTransferFrom(must(t)(TransferFromData(from, to, amount)))
+	if !ok || f != from || r != to || a.Cmp(amount) != 0 {
+		t.Fatalf("transferFrom: got %v %v %v %v", f, r, a, ok)
+	}
+}
+
+func TestDecodeRejectsOtherCalls(t *testing.T) {
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	transfer := must(t)(TransferData(to, big.NewInt(5)))
+
+	if got, amount, ok := DecodeTransfer(transfer); !ok || got != to || amount.Int64() != 5 {
+		t.Fatalf("transfer: got %v %v %v", got, amount, ok)
+	}
+	for name, data := range map[string][]byte{
+		"approve":   must(t)(ApproveData(to, big.NewInt(5))),
+		"truncated": transfer[:67],
+		"padded":    append(append([]byte(nil), transfer...), 0),
+		"empty":     nil,
+	} {
+		if _, _, ok := DecodeTransfer(data); ok {
+			t.Errorf("%s decoded as a transfer", name)
+		}
+	}
+	if _, _, ok := DecodeApprove(transfer); ok {
+		t.Error("transfer decoded as an approval")
+	}
+	if _, _, _, ok := DecodeTransferFrom(transfer); ok {
+		t.Error("transfer decoded as transferFrom")
+	}
+}
+
+func TestCalldataRejectsOutOfRangeAmounts(t *testing.T) {
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	for name, amount := range map[string]*big.Int{
+		"negative": big.NewInt(-5),
+		"2^256":    new(big.Int).Lsh(big.NewInt(1), 256),
+		"nil":      nil,
+	} {
+		if _, err := TransferData(to, amount); !errors.Is(err, ErrAmountRange) {
+			t.Errorf("transfer %s: got %v", name, err)
+		}
+		if _, err := ApproveData(to, amount); !errors.Is(err, ErrAmountRange) {
+			t.Errorf("approve %s: got %v", name, err)
+		}
+		if _, err := TransferFromData(to, to, amount); !errors.Is(err, ErrAmountRange) {
+			t.Errorf("transferFrom %s: got %v", name, err)
+		}
+	}
+}
+
+// must returns a calldata builder's result, failing t on error
+func must(t *testing.T) func([]byte, error) []byte {
+	return func(data []byte, err error) []byte {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+}
+
+// tokenNode is an eth RPC namespace answering a token's view calls
+type tokenNode struct{}
+
+func (tokenNode) Call(args map[string]interface{}, block string) (hexutil.Bytes, error) {
+	input, _ := args["input"].(string)
+	if input == "" {
+		input, _ = args["data"].(string)
+	}
+	switch {
+	case strings.HasPrefix(input, "0x95d89b41"): // symbol
+		out := append(common.LeftPadBytes([]byte{0x20}, 32), common.LeftPadBytes([]byte{3}, 32)...)
+		return append(out, common.RightPadBytes([]byte("TKN"), 32)...), nil
+	case strings.HasPrefix(input, "0x313ce567"): // decimals
+		return common.LeftPadBytes([]byte{6}, 32), nil
+	case strings.HasPrefix(input, "0x70a08231"): // balanceOf
+		return common.LeftPadBytes(big.NewInt(2500000).Bytes(), 32), nil
+	}
+	return nil, fmt.Errorf("unexpected call %s", input)
+}
+
+func TestERC20FromConnClosesConn(t *testing.T) {
+	ctx := context.Background()
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", tokenNode{}); err != nil {
+		t.Fatal(err)
+	}
+	node := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		node.Close()
+		srv.Stop()
+	})
+
+	token := NewERC20FromConn(common.HexToAddress("0x70c0"), conn.New(node.URL))
+	balance, err := token.BalanceOf(ctx, common.HexToAddress("0xaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.String() != "2.5 TKN" {
+		t.Fatalf("balance %s", balance)
+	}
+	if err := token.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := token.BalanceOf(ctx, common.HexToAddress("0xaa")); !errors.Is(err, conn.ErrClosed) {
+		t.Fatalf("call after close: got %v", err)
+	}
+	if err := NewERC20(common.HexToAddress("0x70c0"), nil).Close(); err != nil {
+		t.Fatalf("closing a borrowed client: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package demo
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Options controls Bootstrap
+type Options struct {
+	Token common.Address // demo token to reuse; zero deploys a new one
+	Mint  *big.Int       // minted to the caller when it owns the token; nil or zero mints nothing
+	Clock clock.Clock    // optional, decides whether the faucet is ready
+}
+
+// Result reports what Bootstrap did
+type Result struct {
+	Token    *Token
+	Deployed bool
+	Minted   *big.Int          // zero when nothing was minted by the owner
+	Claimed  bool              // the caller claimed from the faucet
+	Balance  units.TokenAmount // the caller's balance afterwards
+	TxHashes []common.Hash
+}
+
+// Bootstrap gives w a funded demo token in one call: it deploys the token
+// unless opts.Token names one, then mints opts.Mint to w if w owns it, or
+// claims from the faucet if it does not and the cooldown has passed. The
+// result's Token is the ERC20 wrapper the other examples take
+func Bootstrap(ctx context.Context, w *wallet.Wallet, opts Options) (*Result, error) {
+	res := &Result{Minted: new(big.Int)}
+	if opts.Token == (common.Address{}) {
+		t, tx, err := Deploy(ctx, w)
+		if err != nil {
+			return nil, fmt.Errorf("deploy: %w", err)
+		}
+		res.Token, res.Deployed = t, true
+		res.TxHashes = append(res.TxHashes, tx.Hash())
+	} else {
+		client, err := w.Client(ctx)
+		if err != nil {
+			return nil, err
+		}
+		code, err := client.CodeAt(ctx, opts.Token, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(code) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNoCode, opts.Token.Hex())
+		}
+		res.Token = NewToken(opts.Token, client)
+	}
+	t := res.Token
+
+	owner, err := t.Owner(ctx)
+	if err != nil {
+		return res, err
+	}
+	auth, err := transactor(ctx, w)
+	if err != nil {
+		return res, err
+	}
+	switch {
+	case owner == w.Address:
+		if opts.Mint == nil || opts.Mint.Sign() == 0 {
+			break
+		}
+		tx, err := t.Mint(ctx, auth, w.Address, opts.Mint)
+		if err != nil {
+			return res, fmt.Errorf("mint: %w", err)
+		}
+		res.TxHashes = append(res.TxHashes, tx.Hash())
+		if err := wait(ctx, w, tx); err != nil {
+			return res, fmt.Errorf("mint: %w", err)
+		}
+		res.Minted.Set(opts.Mint)
+	default:
+		next, err := t.NextClaim(ctx, w.Address)
+		if err != nil {
+			return res, err
+		}
+		if clock.Or(opts.Clock).Now().Before(next) {
+			break
+		}
+		tx, err := t.Faucet(ctx, auth)
+		if err != nil {
+			return res, fmt.Errorf("faucet: %w", err)
+		}
+		res.TxHashes = append(res.TxHashes, tx.Hash())
+		if err := wait(ctx, w, tx); err != nil {
+			return res, fmt.Errorf("faucet: %w", err)
+		}
+		res.Claimed = true
+	}
+
+	if res.Balance, err = t.BalanceOf(ctx, w.Address); err != nil {
+		return res, err
+	}
+	return res, nil
+}
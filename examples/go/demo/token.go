@@ -0,0 +1,170 @@
+// Package demo deploys the WHSP demo token, so the examples run end to end
+// on any devnet or testnet without a Solidity toolchain or a token already
+// deployed
+package demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// tokenABIJSON is ERC-20 plus the demo token's mint, faucet and owner
+// methods
+const tokenABIJSON = `[
+{"type":"constructor","stateMutability":"nonpayable","inputs":[]},
+{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+{"type":"function","name":"totalSupply","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"approve","stateMutability":"nonpayable","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"transferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"mint","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[]},
+{"type":"function","name":"faucet","stateMutability":"nonpayable","inputs":[],"outputs":[]},
+{"type":"function","name":"owner","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"lastClaim","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+{"type":"event","name":"Approval","anonymous":false,"inputs":[{"name":"owner","type":"address","indexed":true},{"name":"spender","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+//go:generate go run ../cmd/easm -const tokenCode -pkg demo -o token_code.go token.easm
+
+var tokenABI = mustParseABI(tokenABIJSON)
+
+var (
+	// FaucetAmount is what one faucet claim mints: 100 WHSP
+	FaucetAmount = new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))
+	// MaxSupply caps minting at one billion WHSP
+	MaxSupply = new(big.Int).Mul(big.NewInt(1e9), big.NewInt(1e18))
+)
+
+// FaucetCooldown is how long an account waits between faucet claims
+const FaucetCooldown = 24 * time.Hour
+
+var (
+	// ErrReverted is returned when a deployment, mint or claim reverted
+	ErrReverted = errors.New("demo: transaction reverted")
+	// ErrNoCode is returned when the token address has no contract
+	ErrNoCode = errors.New("demo: no token deployed at address")
+)
+
+// Token is the deployed demo token: the ERC-20 wrapper plus its mint and
+// faucet
+type Token struct {
+	*contract.ERC20
+	contract *bind.BoundContract
+}
+
+// NewToken binds a demo token deployed at address
+func NewToken(address common.Address, client *ethclient.Client) *Token {
+	return &Token{
+		ERC20:    contract.NewERC20(address, client),
+		contract: bind.NewBoundContract(address, tokenABI, client, client, client),
+	}
+}
+
+// Deploy deploys a new demo token owned by w and waits for it to be mined
+func Deploy(ctx context.Context, w *wallet.Wallet) (*Token, *types.Transaction, error) {
+	auth, err := transactor(ctx, w)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	addr, tx, _, err := bind.DeployContract(auth, tokenABI, common.FromHex(tokenCode), client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := wait(ctx, w, tx); err != nil {
+		return nil, tx, err
+	}
+	return NewToken(addr, client), tx, nil
+}
+
+// Mint mints amount to an account; only the owner may mint, up to MaxSupply
+func (t *Token) Mint(ctx context.Context, auth *bind.TransactOpts, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return t.contract.Transact(withContext(ctx, auth), "mint", to, amount)
+}
+
+// Faucet mints FaucetAmount to the sender, at most once per FaucetCooldown
+func (t *Token) Faucet(ctx context.Context, auth *bind.TransactOpts) (*types.Transaction, error) {
+	return t.contract.Transact(withContext(ctx, auth), "faucet")
+}
+
+// Owner returns the account allowed to mint
+func (t *Token) Owner(ctx context.Context) (common.Address, error) {
+	return contract.Call[common.Address](ctx, t.contract, "owner")
+}
+
+// NextClaim returns when account may next use the faucet; the zero time
+// means it never has
+func (t *Token) NextClaim(ctx context.Context, account common.Address) (time.Time, error) {
+	last, err := contract.Call[*big.Int](ctx, t.contract, "lastClaim", account)
+	if err != nil || last.Sign() == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(last.Int64(), 0).Add(FaucetCooldown), nil
+}
+
+// transactor returns w's transaction options bound to ctx
+func transactor(ctx context.Context, w *wallet.Wallet) (*bind.TransactOpts, error) {
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := w.TransactOpts(chainID)
+	if err != nil {
+		return nil, err
+	}
+	auth.Context = ctx
+	return auth, nil
+}
+
+// wait waits for tx and fails if it reverted
+func wait(ctx context.Context, w *wallet.Wallet, tx *types.Transaction) error {
+	rcpt, err := w.WaitMined(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("%w: %s", ErrReverted, tx.Hash().Hex())
+	}
+	return nil
+}
+
+func withContext(ctx context.Context, auth *bind.TransactOpts) *bind.TransactOpts {
+	if auth.Context != nil {
+		return auth
+	}
+	opts := *auth
+	opts.Context = ctx
+	return &opts
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
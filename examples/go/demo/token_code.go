@@ -0,0 +1,24 @@
+// Code generated by easm from token.easm; DO NOT EDIT.
+
+package demo
+
+// tokenCode is the init code assembled from token.easm
+const tokenCode = "" +
+	"34610016573360015561043d8061001b6000396000f35b600080fd346100a257600436106100a25760003560e01c806306fdde03146100a757806395d89b4114" +
+	"6100ca578063313ce567146100e557806318160ddd146100f057806370a0823114610108578063dd62ed3e1461012a578063a9059cbb14610162578063095ea7" +
+	"b3146101dd57806323b872dd1461023d57806340c10f19146102fb5780638da5cb5b146100fc578063de5f72fd1461037f5780635c16e15e1461041b575b6000" +
+	"80fd5b6020600052600c6020526b57686973706572546f6b656e60a01b60405260606000f35b60206000526004602052635748535060e01b60405260606000f3" +
+	"5b601260005260206000f35b60005460005260206000f35b60015460005260206000f35b6004358060a01c6100a2576000526002602052604060002054600052" +
+	"60206000f35b6024358060a01c6100a2576004358060a01c6100a2576000526003602052604060002060205260005260406000205460005260206000f35b6024" +
+	"356004358060a01c6100a25780156100a25733806000526002602052604060002080548481106100a25784900390558160005260026020526040600020805484" +
+	"019055826000527fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a350600160005260206000f35b60243560043580" +
+	"60a01c6100a2578181336000526003602052604060002060205260005260406000205590600052337f8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b229" +
+	"1e5b200ac8c7c3b92560206000a3600160005260206000f35b6044356024358060a01c6100a25780156100a2576004358060a01c6100a2573381600052600360" +
+	"20526040600020602052600052604060002080548060001914610292578481106100a2578490039055610295565b50505b806000526002602052604060002080" +
+	"548481106100a25784900390558160005260026020526040600020805484019055826000527fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f5" +
+	"5a4df523b3ef60206000a350600160005260206000f35b6001543314156100a2576024356004358060a01c6100a25780156100a2576000548201806000541161" +
+	"00a257806b033b2e3c9fd0803ce8000000106100a25760005580600052600260205260406000208054830190559060005260007fddf252ad1be2c89b69c2b068" +
+	"fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a3005b3360005260046020526040600020805480156103a557620151800142106100a2576103a756" +
+	"5b505b42905568056bc75e2d6310000033600054820180600054116100a257806b033b2e3c9fd0803ce8000000106100a2576000558060005260026020526040" +
+	"6000208054830190559060005260007fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a3005b6004358060a01c6100" +
+	"a257600052600460205260406000205460005260206000f3"
@@ -0,0 +1,372 @@
+package demo
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/easm"
+)
+
+func TestTokenCodeMatchesAssembly(t *testing.T) {
+	src, err := os.ReadFile("token.easm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := easm.Assemble(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(prog.Init); got != tokenCode {
+		t.Fatal("tokenCode is out of date with token.easm; run go generate ./demo")
+	}
+}
+
+var (
+	owner = common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob   = common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	carol = common.HexToAddress("0x00000000000000000000000000000000000ca201")
+	dave  = common.HexToAddress("0x000000000000000000000000000000000000da7e")
+)
+
+func whsp(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func TestTokenMintAndTransfer(t *testing.T) {
+	c := newChain(t)
+	token := c.deploy(owner)
+
+	if got := c.call(bob, token, "owner")[0].(common.Address); got != owner {
+		t.Fatalf("owner %s", got.Hex())
+	}
+	if name, symbol := c.call(bob, token, "name")[0], c.call(bob, token, "symbol")[0]; name != "WhisperToken" || symbol != "WHSP" {
+		t.Fatalf("name %q, symbol %q", name, symbol)
+	}
+	if d := c.call(bob, token, "decimals")[0].(uint8); d != 18 {
+		t.Fatalf("decimals %d", d)
+	}
+
+	c.reverts(bob, token, "mint", bob, big.NewInt(5))
+	logs := c.send(owner, token, "mint", owner, whsp(1000))
+	expectTransfer(t, logs, common.Address{}, owner, whsp(1000))
+	c.expectUint(token, "totalSupply", whsp(1000))
+	c.reverts(owner, token, "mint", common.Address{}, big.NewInt(5))
+	c.reverts(owner, token, "mint", carol, MaxSupply)
+	c.send(owner, token, "mint", carol, new(big.Int).Sub(MaxSupply, whsp(1000)))
+	c.expectUint(token, "totalSupply", MaxSupply)
+	c.reverts(owner, token, "mint", carol, big.NewInt(1))
+
+	logs = c.send(owner, token, "transfer", bob, whsp(10))
+	expectTransfer(t, logs, owner, bob, whsp(10))
+	c.expectUint(token, "balanceOf", whsp(10), bob)
+	c.expectUint(token, "balanceOf", whsp(990), owner)
+	c.reverts(bob, token, "transfer", owner, new(big.Int).Add(whsp(10), big.NewInt(1)))
+	c.reverts(bob, token, "transfer", common.Address{}, big.NewInt(1))
+	c.send(bob, token, "transfer", bob, whsp(4))
+	c.expectUint(token, "balanceOf", whsp(10), bob)
+
+	c.send(owner, token, "approve", bob, whsp(5))
+	c.expectUint(token, "allowance", whsp(5), owner, bob)
+	c.reverts(bob, token, "transferFrom", owner, carol, new(big.Int).Add(whsp(5), big.NewInt(1)))
+	logs = c.send(bob, token, "transferFrom", owner, carol, whsp(2))
+	expectTransfer(t, logs, owner, carol, whsp(2))
+	c.expectUint(token, "allowance", whsp(3), owner, bob)
+	c.expectUint(token, "balanceOf", whsp(988), owner)
+	c.reverts(carol, token, "transferFrom", owner, carol, big.NewInt(1))
+
+	// An unlimited allowance is never spent down
+	unlimited := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	c.send(owner, token, "approve", bob, unlimited)
+	c.send(bob, token, "transferFrom", owner, bob, whsp(8))
+	c.expectUint(token, "allowance", unlimited, owner, bob)
+
+	// Payments and unknown selectors are refused
+	if _, err := c.run(bob, token, tokenABI.Methods["totalSupply"].ID, big.NewInt(1)); !errors.Is(err, vm.ErrExecutionReverted) {
+		t.Fatalf("payment: got %v", err)
+	}
+	if _, err := c.run(bob, token, []byte{0x12, 0x34, 0x56, 0x78}, nil); !errors.Is(err, vm.ErrExecutionReverted) {
+		t.Fatalf("unknown selector: got %v", err)
+	}
+}
+
+func TestTokenFaucet(t *testing.T) {
+	c := newChain(t)
+	token := c.deploy(owner)
+
+	c.expectUint(token, "lastClaim", new(big.Int), dave)
+	logs := c.send(dave, token, "faucet")
+	expectTransfer(t, logs, common.Address{}, dave, FaucetAmount)
+	c.expectUint(token, "balanceOf", FaucetAmount, dave)
+	c.expectUint(token, "lastClaim", new(big.Int).SetUint64(c.time), dave)
+
+	cooldown := uint64(FaucetCooldown.Seconds())
+	c.reverts(dave, token, "faucet")
+	c.time += cooldown - 1
+	c.reverts(dave, token, "faucet")
+	c.time++
+	c.send(dave, token, "faucet")
+	c.expectUint(token, "balanceOf", new(big.Int).Mul(FaucetAmount, big.NewInt(2)), dave)
+
+	// Claims stop at the supply cap
+	supply := c.call(dave, token, "totalSupply")[0].(*big.Int)
+	c.send(owner, token, "mint", owner, new(big.Int).Sub(MaxSupply, supply))
+	c.reverts(carol, token, "faucet")
+}
+
+func expectTransfer(t *testing.T, logs []*types.Log, from, to common.Address, amount *big.Int) {
+	t.Helper()
+	if len(logs) != 1 {
+		t.Fatalf("%d logs, want one Transfer", len(logs))
+	}
+	l := logs[0]
+	if len(l.Topics) != 3 || l.Topics[0] != contract.TransferTopic ||
+		common.BytesToAddress(l.Topics[1].Bytes()) != from || common.BytesToAddress(l.Topics[2].Bytes()) != to ||
+		new(big.Int).SetBytes(l.Data).Cmp(amount) != 0 {
+		t.Fatalf("log %v %x, want Transfer of %s from %s to %s", l.Topics, l.Data, amount, from.Hex(), to.Hex())
+	}
+}
+
+// chain runs contracts on geth's interpreter over an in-memory state
+type chain struct {
+	t     *testing.T
+	state *memState
+	time  uint64
+}
+
+func newChain(t *testing.T) *chain {
+	return &chain{t: t, state: newMemState(), time: 1_700_000_000}
+}
+
+func (c *chain) evm(origin common.Address) *vm.EVM {
+	block := vm.BlockContext{
+		CanTransfer: func(db vm.StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		Transfer: func(db vm.StateDB, from, to common.Address, amount *big.Int) {
+			db.SubBalance(from, amount)
+			db.AddBalance(to, amount)
+		},
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		BlockNumber: big.NewInt(1),
+		Time:        c.time,
+		Difficulty:  new(big.Int),
+		GasLimit:    30_000_000,
+	}
+	return vm.NewEVM(block, vm.TxContext{Origin: origin, GasPrice: new(big.Int)}, c.state, params.TestChainConfig, vm.Config{})
+}
+
+func (c *chain) deploy(from common.Address) common.Address {
+	c.t.Helper()
+	_, addr, _, err := c.evm(from).Create(vm.AccountRef(from), common.FromHex(tokenCode), 10_000_000, new(big.Int))
+	if err != nil {
+		c.t.Fatalf("deploy: %v", err)
+	}
+	return addr
+}
+
+// run calls to with input and returns the output; a revert undoes the call
+func (c *chain) run(from, to common.Address, input []byte, value *big.Int) ([]byte, error) {
+	if value == nil {
+		value = new(big.Int)
+	}
+	c.state.AddBalance(from, value)
+	out, _, err := c.evm(from).Call(vm.AccountRef(from), to, input, 10_000_000, value)
+	return out, err
+}
+
+// send calls method, failing the test if it reverts, and returns its logs
+func (c *chain) send(from, to common.Address, method string, args ...interface{}) []*types.Log {
+	c.t.Helper()
+	input, err := tokenABI.Pack(method, args...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	before := len(c.state.logs)
+	if _, err := c.run(from, to, input, nil); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	return c.state.logs[before:]
+}
+
+// call calls method and returns its decoded outputs
+func (c *chain) call(from, to common.Address, method string, args ...interface{}) []interface{} {
+	c.t.Helper()
+	input, err := tokenABI.Pack(method, args...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	out, err := c.run(from, to, input, nil)
+	if err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	res, err := tokenABI.Unpack(method, out)
+	if err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	return res
+}
+
+func (c *chain) reverts(from, to common.Address, method string, args ...interface{}) {
+	c.t.Helper()
+	input, err := tokenABI.Pack(method, args...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	before := len(c.state.logs)
+	if _, err := c.run(from, to, input, nil); !errors.Is(err, vm.ErrExecutionReverted) {
+		c.t.Fatalf("%s%v: got %v, want a revert", method, args, err)
+	}
+	if len(c.state.logs) != before {
+		c.t.Fatalf("%s: reverted call left logs", method)
+	}
+}
+
+func (c *chain) expectUint(token common.Address, method string, want *big.Int, args ...interface{}) {
+	c.t.Helper()
+	if got := c.call(bob, token, method, args...)[0].(*big.Int); got.Cmp(want) != 0 {
+		c.t.Fatalf("%s%v = %s, want %s", method, args, got, want)
+	}
+}
+
+// memState is a vm.StateDB held in memory. Snapshots copy the whole state,
+// which is plenty for a handful of accounts
+type memState struct {
+	accounts  map[common.Address]*memAccount
+	logs      []*types.Log
+	refund    uint64
+	transient map[common.Address]map[common.Hash]common.Hash
+	snapshots []memSnapshot
+}
+
+type memAccount struct {
+	balance *big.Int
+	nonce   uint64
+	code    []byte
+	storage map[common.Hash]common.Hash
+}
+
+type memSnapshot struct {
+	accounts map[common.Address]*memAccount
+	logs     int
+	refund   uint64
+}
+
+func newMemState() *memState {
+	return &memState{accounts: make(map[common.Address]*memAccount), transient: make(map[common.Address]map[common.Hash]common.Hash)}
+}
+
+func (s *memState) account(addr common.Address) *memAccount {
+	a, ok := s.accounts[addr]
+	if !ok {
+		a = &memAccount{balance: new(big.Int), storage: make(map[common.Hash]common.Hash)}
+		s.accounts[addr] = a
+	}
+	return a
+}
+
+func (s *memState) CreateAccount(addr common.Address) {
+	balance := s.account(addr).balance
+	s.accounts[addr] = &memAccount{balance: balance, storage: make(map[common.Hash]common.Hash)}
+}
+
+func (s *memState) SubBalance(addr common.Address, v *big.Int) {
+	a := s.account(addr)
+	a.balance = new(big.Int).Sub(a.balance, v)
+}
+
+func (s *memState) AddBalance(addr common.Address, v *big.Int) {
+	a := s.account(addr)
+	a.balance = new(big.Int).Add(a.balance, v)
+}
+
+func (s *memState) GetBalance(addr common.Address) *big.Int { return s.account(addr).balance }
+func (s *memState) GetNonce(addr common.Address) uint64     { return s.account(addr).nonce }
+func (s *memState) SetNonce(addr common.Address, n uint64)  { s.account(addr).nonce = n }
+
+func (s *memState) GetCodeHash(addr common.Address) common.Hash {
+	if !s.Exist(addr) {
+		return common.Hash{}
+	}
+	return crypto.Keccak256Hash(s.account(addr).code)
+}
+
+func (s *memState) GetCode(addr common.Address) []byte       { return s.account(addr).code }
+func (s *memState) SetCode(addr common.Address, code []byte) { s.account(addr).code = code }
+func (s *memState) GetCodeSize(addr common.Address) int      { return len(s.account(addr).code) }
+func (s *memState) AddRefund(n uint64)                       { s.refund += n }
+func (s *memState) SubRefund(n uint64)                       { s.refund -= n }
+func (s *memState) GetRefund() uint64                        { return s.refund }
+func (s *memState) GetState(a common.Address, k common.Hash) common.Hash {
+	return s.account(a).storage[k]
+}
+
+func (s *memState) GetCommittedState(a common.Address, k common.Hash) common.Hash {
+	return s.GetState(a, k)
+}
+
+func (s *memState) SetState(a common.Address, k, v common.Hash) { s.account(a).storage[k] = v }
+
+func (s *memState) GetTransientState(a common.Address, k common.Hash) common.Hash {
+	return s.transient[a][k]
+}
+
+func (s *memState) SetTransientState(a common.Address, k, v common.Hash) {
+	if s.transient[a] == nil {
+		s.transient[a] = make(map[common.Hash]common.Hash)
+	}
+	s.transient[a][k] = v
+}
+
+func (s *memState) SelfDestruct(common.Address)           {}
+func (s *memState) HasSelfDestructed(common.Address) bool { return false }
+func (s *memState) Selfdestruct6780(common.Address)       {}
+
+func (s *memState) Exist(addr common.Address) bool {
+	_, ok := s.accounts[addr]
+	return ok
+}
+
+func (s *memState) Empty(addr common.Address) bool {
+	a, ok := s.accounts[addr]
+	return !ok || (a.balance.Sign() == 0 && a.nonce == 0 && len(a.code) == 0)
+}
+
+func (s *memState) AddressInAccessList(common.Address) bool { return true }
+func (s *memState) SlotInAccessList(common.Address, common.Hash) (bool, bool) {
+	return true, true
+}
+func (s *memState) AddAddressToAccessList(common.Address)           {}
+func (s *memState) AddSlotToAccessList(common.Address, common.Hash) {}
+func (s *memState) Prepare(params.Rules, common.Address, common.Address, *common.Address, []common.Address, types.AccessList) {
+}
+
+func (s *memState) Snapshot() int {
+	accounts := make(map[common.Address]*memAccount, len(s.accounts))
+	for addr, a := range s.accounts {
+		storage := make(map[common.Hash]common.Hash, len(a.storage))
+		for k, v := range a.storage {
+			storage[k] = v
+		}
+		accounts[addr] = &memAccount{balance: a.balance, nonce: a.nonce, code: a.code, storage: storage}
+	}
+	s.snapshots = append(s.snapshots, memSnapshot{accounts: accounts, logs: len(s.logs), refund: s.refund})
+	return len(s.snapshots) - 1
+}
+
+func (s *memState) RevertToSnapshot(id int) {
+	snap := s.snapshots[id]
+	s.accounts, s.logs, s.refund = snap.accounts, s.logs[:snap.logs], snap.refund
+	s.snapshots = s.snapshots[:id]
+}
+
+func (s *memState) AddLog(l *types.Log)             { s.logs = append(s.logs, l) }
+func (s *memState) AddPreimage(common.Hash, []byte) {}
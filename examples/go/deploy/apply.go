@@ -0,0 +1,171 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Status is the outcome of applying one manifest entry
+type Status string
+
+const (
+	StatusDeployed Status = "deployed" // deployed by this run
+	StatusVerified Status = "verified" // already deployed with the expected code
+	StatusExists   Status = "exists"   // code present; no runtime bytecode to compare against
+	StatusMissing  Status = "missing"  // not deployed; reported by dry runs
+	StatusMismatch Status = "mismatch" // code at the address differs from the artifact
+)
+
+// Result describes the state of one contract after Apply
+type Result struct {
+	Name    string
+	Address common.Address
+	Status  Status
+	TxHash  common.Hash // set when deployed by this run
+}
+
+// Options controls Apply
+type Options struct {
+	DryRun bool // only report what would be deployed
+}
+
+// Apply brings the chain in line with the manifest: contracts that are missing
+// are deployed through the CREATE2 factory and contracts that exist are
+// checked against their artifacts. Applying a manifest twice is a no-op.
+func Apply(ctx context.Context, w *wallet.Wallet, m *Manifest, opts Options) ([]Result, error) {
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	factoryCode, err := client.CodeAt(ctx, m.Factory, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(factoryCode) == 0 {
+		return nil, fmt.Errorf("no CREATE2 factory at %s on this chain", m.Factory.Hex())
+	}
+
+	var auth *bind.TransactOpts
+	if !opts.DryRun {
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if auth, err = w.TransactOpts(chainID); err != nil {
+			return nil, err
+		}
+		auth.Context = ctx
+	}
+	factory := bind.NewBoundContract(m.Factory, abi.ABI{}, client, client, client)
+
+	resolved := make(map[string]common.Address)
+	results := make([]Result, 0, len(m.Contracts))
+	for _, c := range m.Contracts {
+		res, err := apply(ctx, w, m, c, resolved, factory, auth)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		resolved[c.Name] = res.Address
+		results = append(results, *res)
+	}
+	return results, nil
+}
+
+func apply(ctx context.Context, w *wallet.Wallet, m *Manifest, c Contract, resolved map[string]common.Address, factory *bind.BoundContract, auth *bind.TransactOpts) (*Result, error) {
+	path := c.Artifact
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(m.dir, path)
+	}
+	art, err := LoadArtifact(path)
+	if err != nil {
+		return nil, err
+	}
+	args, err := parseArgs(art.ABI.Constructor.Inputs, c.Args, resolved)
+	if err != nil {
+		return nil, err
+	}
+	initCode, err := art.InitCode(args)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := Address(m.Factory, c.Salt, initCode)
+	if c.ExpectedAddress != nil && *c.ExpectedAddress != addr {
+		return nil, fmt.Errorf("computed address %s does not match expected %s", addr.Hex(), c.ExpectedAddress.Hex())
+	}
+	res := &Result{Name: c.Name, Address: addr}
+
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	code, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) > 0 {
+		res.Status = verify(code, art.DeployedBytecode)
+		return res, nil
+	}
+	if auth == nil {
+		res.Status = StatusMissing
+		return res, nil
+	}
+
+	txHash, err := create2(ctx, w, factory, auth, c.Salt, initCode, addr)
+	if err != nil {
+		return nil, err
+	}
+	res.Status, res.TxHash = StatusDeployed, txHash
+	return res, nil
+}
+
+// create2 deploys initCode through the factory and checks that code appeared
+// at the predicted address
+func create2(ctx context.Context, w *wallet.Wallet, factory *bind.BoundContract, auth *bind.TransactOpts, salt common.Hash, initCode []byte, addr common.Address) (common.Hash, error) {
+	tx, err := factory.RawTransact(auth, append(salt.Bytes(), initCode...))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	rcpt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		return common.Hash{}, errors.New("deployment transaction reverted")
+	}
+	code, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(code) == 0 {
+		return common.Hash{}, errors.New("factory did not create the contract")
+	}
+	return tx.Hash(), nil
+}
+
+// verify compares deployed code with the artifact's runtime bytecode.
+// Contracts with immutables embed constructor values in their runtime code;
+// omit deployedBytecode from such artifacts to skip the comparison.
+func verify(code, runtime []byte) Status {
+	if len(runtime) == 0 {
+		return StatusExists
+	}
+	if bytes.Equal(code, runtime) {
+		return StatusVerified
+	}
+	return StatusMismatch
+}
@@ -0,0 +1,99 @@
+package deploy
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// StorageLayout is solc's storageLayout output, present in artifacts compiled
+// with outputSelection "storageLayout"
+type StorageLayout struct {
+	Storage []StorageSlot          `json:"storage"`
+	Types   map[string]StorageType `json:"types"`
+}
+
+// StorageSlot is one state variable in a storage layout
+type StorageSlot struct {
+	Label  string `json:"label"`
+	Offset int    `json:"offset"`
+	Slot   string `json:"slot"` // decimal
+	Type   string `json:"type"`
+}
+
+// StorageType describes a type referenced by a storage layout
+type StorageType struct {
+	Encoding      string `json:"encoding"`
+	Label         string `json:"label"`
+	NumberOfBytes string `json:"numberOfBytes"`
+}
+
+// LayoutIssue is an incompatibility between two storage layouts
+type LayoutIssue struct {
+	Label  string
+	Slot   string
+	Reason string
+}
+
+// String describes the issue
+func (i LayoutIssue) String() string {
+	return fmt.Sprintf("%s (slot %s): %s", i.Label, i.Slot, i.Reason)
+}
+
+// CheckLayout reports the changes in next that would corrupt state written by
+// prev. Existing variables must keep their slot, offset and type; renames are
+// allowed. New variables may only be added after the last existing one.
+func CheckLayout(prev, next *StorageLayout) []LayoutIssue {
+	byPosition := make(map[string]StorageSlot, len(next.Storage))
+	for _, s := range next.Storage {
+		byPosition[position(s)] = s
+	}
+
+	var issues []LayoutIssue
+	end, endOffset := new(big.Int), -1
+	for _, old := range prev.Storage {
+		cur, ok := byPosition[position(old)]
+		if !ok {
+			issues = append(issues, LayoutIssue{Label: old.Label, Slot: old.Slot, Reason: "variable removed or moved"})
+			continue
+		}
+		oldType, newType := prev.Types[old.Type], next.Types[cur.Type]
+		if oldType.Label != newType.Label || oldType.NumberOfBytes != newType.NumberOfBytes || oldType.Encoding != newType.Encoding {
+			issues = append(issues, LayoutIssue{Label: old.Label, Slot: old.Slot,
+				Reason: fmt.Sprintf("type changed from %s to %s", oldType.Label, newType.Label)})
+		}
+		if slot, ok := new(big.Int).SetString(old.Slot, 10); ok {
+			offset := old.Offset
+			// Static arrays and structs span several slots
+			if size, ok := new(big.Int).SetString(oldType.NumberOfBytes, 10); ok && size.Cmp(big.NewInt(32)) > 0 {
+				slot.Add(slot, size.Sub(size, big.NewInt(1)).Div(size, big.NewInt(32)))
+				offset = 31
+			}
+			if c := slot.Cmp(end); c > 0 || c == 0 && offset > endOffset {
+				end, endOffset = slot, offset
+			}
+		}
+	}
+
+	prevPositions := make(map[string]bool, len(prev.Storage))
+	for _, s := range prev.Storage {
+		prevPositions[position(s)] = true
+	}
+	for _, s := range next.Storage {
+		if prevPositions[position(s)] {
+			continue
+		}
+		slot, ok := new(big.Int).SetString(s.Slot, 10)
+		if !ok {
+			issues = append(issues, LayoutIssue{Label: s.Label, Slot: s.Slot, Reason: "invalid slot"})
+			continue
+		}
+		if c := slot.Cmp(end); c < 0 || c == 0 && s.Offset <= endOffset {
+			issues = append(issues, LayoutIssue{Label: s.Label, Slot: s.Slot, Reason: "new variable inserted before existing storage"})
+		}
+	}
+	return issues
+}
+
+func position(s StorageSlot) string {
+	return fmt.Sprintf("%s:%d", s.Slot, s.Offset)
+}
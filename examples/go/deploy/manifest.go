@@ -0,0 +1,254 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ManifestVersion is the current manifest format version
+const ManifestVersion = 1
+
+// DefaultFactory is the deterministic deployment proxy available at the same
+// address on most EVM chains; it deploys calldata salt ++ initcode with CREATE2
+var DefaultFactory = common.HexToAddress("0x4e59b44847b379578588920ca78fbf26c0b4956c")
+
+// Manifest lists the contracts that make up an environment. Because every
+// contract is deployed with CREATE2 from the same factory, applying the same
+// manifest on different chains yields the same addresses.
+type Manifest struct {
+	Version   int            `json:"version"`
+	Factory   common.Address `json:"factory,omitempty"`
+	Contracts []Contract     `json:"contracts"`
+
+	dir string // base directory for relative artifact paths
+}
+
+// Contract describes one deterministic deployment. Args are constructor
+// arguments as strings; "${Name}" refers to the address of an earlier contract
+// in the manifest.
+type Contract struct {
+	Name            string          `json:"name"`
+	Artifact        string          `json:"artifact"` // Hardhat or Foundry artifact JSON
+	Args            []string        `json:"args,omitempty"`
+	Salt            common.Hash     `json:"salt"`
+	ExpectedAddress *common.Address `json:"expectedAddress,omitempty"`
+}
+
+// Artifact is the subset of a compiler artifact needed for deployment
+type Artifact struct {
+	ABI              abi.ABI
+	Bytecode         []byte
+	DeployedBytecode []byte         // empty skips runtime code verification
+	StorageLayout    *StorageLayout // nil unless the artifact was compiled with storage layout output
+}
+
+// LoadManifest reads a manifest file
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if m.Factory == (common.Address{}) {
+		m.Factory = DefaultFactory
+	}
+	m.dir = filepath.Dir(path)
+
+	seen := make(map[string]bool)
+	for _, c := range m.Contracts {
+		if c.Name == "" || c.Artifact == "" {
+			return nil, errors.New("every contract needs a name and an artifact")
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("duplicate contract %q", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return &m, nil
+}
+
+// LoadArtifact reads a Hardhat or Foundry artifact
+func LoadArtifact(path string) (*Artifact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		ABI              json.RawMessage `json:"abi"`
+		Bytecode         json.RawMessage `json:"bytecode"`
+		DeployedBytecode json.RawMessage `json:"deployedBytecode"`
+		StorageLayout    *StorageLayout  `json:"storageLayout"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(string(raw.ABI)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	code, err := decodeBytecode(raw.Bytecode)
+	if err != nil || len(code) == 0 {
+		return nil, fmt.Errorf("%s: missing or invalid bytecode", path)
+	}
+	runtime, err := decodeBytecode(raw.DeployedBytecode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid deployed bytecode", path)
+	}
+	return &Artifact{ABI: parsed, Bytecode: code, DeployedBytecode: runtime, StorageLayout: raw.StorageLayout}, nil
+}
+
+// decodeBytecode accepts Hardhat's hex string and Foundry's {"object": hex}
+func decodeBytecode(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		var obj struct {
+			Object string `json:"object"`
+		}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		s = obj.Object
+	}
+	if s == "" || s == "0x" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "0x") {
+		s = "0x" + s
+	}
+	return hexutil.Decode(s)
+}
+
+// InitCode returns the creation bytecode with ABI-encoded constructor args
+func (a *Artifact) InitCode(args []interface{}) ([]byte, error) {
+	packed, err := a.ABI.Pack("", args...)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), a.Bytecode...), packed...), nil
+}
+
+// Address returns the CREATE2 address of initCode deployed by factory with salt
+func Address(factory common.Address, salt common.Hash, initCode []byte) common.Address {
+	return crypto.CreateAddress2(factory, salt, crypto.Keccak256(initCode))
+}
+
+// parseArgs converts string constructor arguments into the Go values the ABI
+// encoder expects, resolving ${Name} references against deployed addresses
+func parseArgs(inputs abi.Arguments, args []string, resolved map[string]common.Address) ([]interface{}, error) {
+	if len(args) != len(inputs) {
+		return nil, fmt.Errorf("constructor takes %d arguments, got %d", len(inputs), len(args))
+	}
+	out := make([]interface{}, len(args))
+	for i, s := range args {
+		if strings.HasPrefix(s, "${") && strings.HasSuffix(s, "}") {
+			name := s[2 : len(s)-1]
+			addr, ok := resolved[name]
+			if !ok {
+				return nil, fmt.Errorf("argument %d: unknown contract %q", i, name)
+			}
+			s = addr.Hex()
+		}
+		v, err := parseArg(inputs[i].Type, s)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %w", i, inputs[i].Name, err)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func parseArg(t abi.Type, s string) (interface{}, error) {
+	switch t.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		return common.HexToAddress(s), nil
+	case abi.BoolTy:
+		switch s {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid bool %q", s)
+	case abi.StringTy:
+		return s, nil
+	case abi.BytesTy:
+		return hexutil.Decode(s)
+	case abi.FixedBytesTy:
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != t.Size {
+			return nil, fmt.Errorf("expected %d bytes, got %d", t.Size, len(b))
+		}
+		arr := reflect.New(reflect.ArrayOf(t.Size, reflect.TypeOf(byte(0)))).Elem()
+		reflect.Copy(arr, reflect.ValueOf(b))
+		return arr.Interface(), nil
+	case abi.IntTy, abi.UintTy:
+		n, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", s)
+		}
+		return sizedInt(t, n)
+	default:
+		return nil, fmt.Errorf("unsupported constructor argument type %s", t.String())
+	}
+}
+
+// sizedInt returns n as the Go integer type the ABI encoder uses for t and
+// checks that it fits
+func sizedInt(t abi.Type, n *big.Int) (interface{}, error) {
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(t.Size))
+	if t.T == abi.IntTy {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+		return nil, fmt.Errorf("%s out of range for %s", n, t.String())
+	}
+
+	switch {
+	case t.T == abi.UintTy && t.Size == 8:
+		return uint8(n.Uint64()), nil
+	case t.T == abi.UintTy && t.Size == 16:
+		return uint16(n.Uint64()), nil
+	case t.T == abi.UintTy && t.Size == 32:
+		return uint32(n.Uint64()), nil
+	case t.T == abi.UintTy && t.Size == 64:
+		return n.Uint64(), nil
+	case t.T == abi.IntTy && t.Size == 8:
+		return int8(n.Int64()), nil
+	case t.T == abi.IntTy && t.Size == 16:
+		return int16(n.Int64()), nil
+	case t.T == abi.IntTy && t.Size == 32:
+		return int32(n.Int64()), nil
+	case t.T == abi.IntTy && t.Size == 64:
+		return n.Int64(), nil
+	default:
+		return n, nil
+	}
+}
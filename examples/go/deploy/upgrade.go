@@ -0,0 +1,311 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/approval"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// ProxyKind selects how an upgrade is performed
+type ProxyKind string
+
+const (
+	// ProxyTransparent upgrades through the proxy's ProxyAdmin contract
+	ProxyTransparent ProxyKind = "transparent"
+	// ProxyUUPS upgrades by calling upgradeToAndCall on the proxy itself
+	ProxyUUPS ProxyKind = "uups"
+)
+
+// EIP-1967 storage slots
+var (
+	ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	AdminSlot          = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+)
+
+const upgradeABIJSON = `[
+	{"inputs":[{"name":"newImplementation","type":"address"},{"name":"data","type":"bytes"}],"name":"upgradeToAndCall","outputs":[],"stateMutability":"payable","type":"function"},
+	{"inputs":[{"name":"proxy","type":"address"},{"name":"implementation","type":"address"},{"name":"data","type":"bytes"}],"name":"upgradeAndCall","outputs":[],"stateMutability":"payable","type":"function"}
+]`
+
+var upgradeABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(upgradeABIJSON))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// ErrIncompatibleLayout is returned when a new implementation would corrupt
+// the proxy's storage
+var ErrIncompatibleLayout = errors.New("deploy: incompatible storage layout")
+
+// Implementation reads the EIP-1967 implementation address of a proxy
+func Implementation(ctx context.Context, client *ethclient.Client, proxy common.Address) (common.Address, error) {
+	return readSlot(ctx, client, proxy, ImplementationSlot)
+}
+
+// Admin reads the EIP-1967 admin address of a transparent proxy
+func Admin(ctx context.Context, client *ethclient.Client, proxy common.Address) (common.Address, error) {
+	return readSlot(ctx, client, proxy, AdminSlot)
+}
+
+func readSlot(ctx context.Context, client *ethclient.Client, proxy common.Address, slot common.Hash) (common.Address, error) {
+	v, err := client.StorageAt(ctx, proxy, slot, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(v), nil
+}
+
+// Upgrade is a prepared proxy upgrade
+type Upgrade struct {
+	Proxy          common.Address
+	Kind           ProxyKind
+	Previous       common.Address // implementation before the upgrade
+	Implementation common.Address // new implementation
+	Call           []byte         // optional initializer calldata run after the upgrade
+	To             common.Address // proxy admin or proxy, depending on Kind
+	Data           []byte         // upgrade calldata sent to To
+	Request        *approval.Request
+}
+
+// Upgrader deploys new implementations and upgrades proxies to them. When
+// Approvals is set the upgrade transaction can be proposed to the approval
+// workflow instead of being sent directly. Upgrades carry no value, so the
+// workflow's policy should have no threshold for every upgrade to need
+// approvers.
+type Upgrader struct {
+	Wallet    *wallet.Wallet
+	Factory   common.Address
+	Approvals *approval.Workflow
+	Audit     audit.Log
+}
+
+// NewUpgrader creates an upgrader using the default CREATE2 factory
+func NewUpgrader(w *wallet.Wallet, approvals *approval.Workflow, auditLog audit.Log) (*Upgrader, error) {
+	if approvals != nil && approvals.Wallet.Address != w.Address {
+		return nil, errors.New("approval workflow must use the upgrader's wallet")
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Upgrader{Wallet: w, Factory: DefaultFactory, Approvals: approvals, Audit: auditLog}, nil
+}
+
+// Prepare checks that next can safely replace current behind proxy, deploys
+// next with CREATE2 (reusing an existing deployment) and builds the upgrade
+// calldata. Both artifacts must carry storage layouts.
+func (u *Upgrader) Prepare(ctx context.Context, proxy common.Address, kind ProxyKind, current, next *Artifact, salt common.Hash, call []byte) (*Upgrade, error) {
+	if current.StorageLayout == nil || next.StorageLayout == nil {
+		return nil, errors.New("both artifacts need storage layouts to check upgrade safety")
+	}
+	if issues := CheckLayout(current.StorageLayout, next.StorageLayout); len(issues) > 0 {
+		reasons := make([]string, len(issues))
+		for i, issue := range issues {
+			reasons[i] = issue.String()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrIncompatibleLayout, strings.Join(reasons, "; "))
+	}
+
+	client, err := u.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := Implementation(ctx, client, proxy)
+	if err != nil {
+		return nil, err
+	}
+	if previous == (common.Address{}) {
+		return nil, fmt.Errorf("%s is not an EIP-1967 proxy", proxy.Hex())
+	}
+
+	impl, err := u.deployImplementation(ctx, next, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	up := &Upgrade{Proxy: proxy, Kind: kind, Previous: previous, Implementation: impl, Call: call}
+	switch kind {
+	case ProxyUUPS:
+		up.To = proxy
+		up.Data, err = upgradeABI.Pack("upgradeToAndCall", impl, nonNil(call))
+	case ProxyTransparent:
+		if up.To, err = Admin(ctx, client, proxy); err != nil {
+			return nil, err
+		}
+		up.Data, err = upgradeABI.Pack("upgradeAndCall", proxy, impl, nonNil(call))
+	default:
+		return nil, fmt.Errorf("unknown proxy kind %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.record(ctx, "upgrade-prepared", up, "")
+	return up, nil
+}
+
+// Propose signs the upgrade transaction and submits it for approval
+func (u *Upgrader) Propose(ctx context.Context, up *Upgrade, reason string) (*approval.Request, error) {
+	if u.Approvals == nil {
+		return nil, errors.New("no approval workflow configured")
+	}
+	auth, err := u.transactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth.NoSend = true
+	client, err := u.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := bind.NewBoundContract(up.To, upgradeABI, client, client, nil).RawTransact(auth, up.Data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := u.Approvals.Submit(ctx, tx, reason)
+	if err != nil {
+		return nil, err
+	}
+	up.Request = req
+	u.record(ctx, "upgrade-proposed", up, string(req.Status))
+	return req, nil
+}
+
+// Execute performs the upgrade, broadcasting the approved transaction when it
+// was proposed, and confirms the proxy now points at the new implementation
+func (u *Upgrader) Execute(ctx context.Context, up *Upgrade) (*types.Transaction, error) {
+	client, err := u.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tx *types.Transaction
+	if up.Request != nil {
+		tx, err = u.Approvals.Broadcast(ctx, up.Request.ID)
+	} else {
+		var auth *bind.TransactOpts
+		if auth, err = u.transactor(ctx); err == nil {
+			tx, err = bind.NewBoundContract(up.To, upgradeABI, client, client, nil).RawTransact(auth, up.Data)
+		}
+	}
+	if err != nil {
+		u.record(ctx, "upgrade-executed", up, "error")
+		return nil, err
+	}
+
+	rcpt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		return tx, err
+	}
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		u.record(ctx, "upgrade-executed", up, "reverted")
+		return tx, errors.New("upgrade transaction reverted")
+	}
+	impl, err := Implementation(ctx, client, up.Proxy)
+	if err != nil {
+		return tx, err
+	}
+	if impl != up.Implementation {
+		u.record(ctx, "upgrade-executed", up, "unexpected-implementation")
+		return tx, fmt.Errorf("proxy points at %s after upgrade", impl.Hex())
+	}
+	u.record(ctx, "upgrade-executed", up, "ok")
+	return tx, nil
+}
+
+// SafeBatch returns the upgrade as a Safe Transaction Builder batch file, for
+// proxies administered by a Safe
+func (up *Upgrade) SafeBatch(chainID *big.Int) ([]byte, error) {
+	return json.MarshalIndent(map[string]interface{}{
+		"version": "1.0",
+		"chainId": chainID.String(),
+		"meta":    map[string]string{"name": "Upgrade " + up.Proxy.Hex()},
+		"transactions": []map[string]string{{
+			"to":    up.To.Hex(),
+			"value": "0",
+			"data":  hexutil.Encode(up.Data),
+		}},
+	}, "", "  ")
+}
+
+func (u *Upgrader) deployImplementation(ctx context.Context, art *Artifact, salt common.Hash) (common.Address, error) {
+	initCode, err := art.InitCode(nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	addr := Address(u.Factory, salt, initCode)
+	client, err := u.Wallet.Client(ctx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	code, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(code) > 0 {
+		if verify(code, art.DeployedBytecode) == StatusMismatch {
+			return common.Address{}, fmt.Errorf("different code already deployed at %s", addr.Hex())
+		}
+		return addr, nil
+	}
+
+	auth, err := u.transactor(ctx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	factory := bind.NewBoundContract(u.Factory, abi.ABI{}, client, client, client)
+	if _, err := create2(ctx, u.Wallet, factory, auth, salt, initCode, addr); err != nil {
+		return common.Address{}, err
+	}
+	return addr, nil
+}
+
+func (u *Upgrader) transactor(ctx context.Context) (*bind.TransactOpts, error) {
+	client, err := u.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := u.Wallet.TransactOpts(chainID)
+	if err != nil {
+		return nil, err
+	}
+	auth.Context = ctx
+	return auth, nil
+}
+
+func (u *Upgrader) record(ctx context.Context, action string, up *Upgrade, outcome string) {
+	u.Audit.Record(ctx, audit.Entry{
+		Actor:   u.Wallet.Address.Hex(),
+		Action:  action,
+		Subject: up.Proxy.Hex(),
+		Outcome: outcome,
+		Details: map[string]string{
+			"kind":     string(up.Kind),
+			"previous": up.Previous.Hex(),
+			"next":     up.Implementation.Hex(),
+		},
+	})
+}
+
+func nonNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
@@ -0,0 +1,251 @@
+package diagnostics
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/eventbus"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/txmgr"
+)
+
+// redacted replaces secret values in a bundle
+const redacted = "[redacted]"
+
+// secretKeys are substrings of detail names whose values are never bundled
+var secretKeys = []string{"key", "secret", "token", "password", "passphrase", "mnemonic", "seed", "signature", "authorization", "cookie"}
+
+// AuditSource returns recent audit entries, such as an audit.MemoryLog
+type AuditSource interface {
+	Last(n int) []audit.Entry
+}
+
+// Versions identifies the build
+type Versions struct {
+	Go       string            `json:"go"`
+	OS       string            `json:"os"`
+	Arch     string            `json:"arch"`
+	Module   string            `json:"module,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Revision string            `json:"revision,omitempty"`
+	Deps     map[string]string `json:"deps,omitempty"`
+}
+
+// Chain is what the node reports about itself
+type Chain struct {
+	ChainID       string `json:"chainId,omitempty"`
+	Head          uint64 `json:"head,omitempty"`
+	HeadTime      string `json:"headTime,omitempty"`
+	ClientVersion string `json:"clientVersion,omitempty"`
+	London        bool   `json:"london"` // blocks carry a base fee
+	TxPool        bool   `json:"txpool"` // txpool_ namespace available
+	Trace         bool   `json:"trace"`  // debug_ tracing available
+	Syncing       bool   `json:"syncing"`
+}
+
+// Queue is the depth of each account's transaction queue
+type Queue struct {
+	Account   common.Address `json:"account"`
+	Confirmed uint64         `json:"confirmed"` // latest nonce
+	Pending   uint64         `json:"pending"`   // pending nonce
+	InFlight  uint64         `json:"inFlight"`
+}
+
+// Collector gathers the state bundled for issue reports. Every source is
+// optional; a source that fails is noted in the bundle instead of failing it
+type Collector struct {
+	Client       *ethclient.Client
+	Accounts     []common.Address // accounts whose queues are reported
+	Audit        AuditSource
+	AuditEntries int // default 100
+	Errors       *Recent
+	Bus          *eventbus.Bus // queue depths and drops of every subscriber
+	Messaging    *messaging.Metrics
+}
+
+// Bundle returns a zip archive of sanitized diagnostics to attach to an
+// issue: versions, chain and capabilities, recent errors, queue depth,
+// event bus stats, messaging metrics and recent audit entries with secrets
+// redacted. It holds no keys and no RPC URLs
+func (c *Collector) Bundle(ctx context.Context) ([]byte, error) {
+	files := map[string]interface{}{"versions.json": buildVersions()}
+	var problems []string
+	if c.Client != nil {
+		chain, errs := c.chain(ctx)
+		files["chain.json"] = chain
+		problems = append(problems, errs...)
+
+		queues, errs := c.queues(ctx)
+		files["queue.json"] = queues
+		problems = append(problems, errs...)
+	}
+	if c.Errors != nil {
+		files["errors.json"] = c.Errors.Entries()
+	}
+	if c.Bus != nil {
+		files["eventbus.json"] = c.Bus.Stats()
+	}
+	if c.Messaging != nil {
+		files["messaging.json"] = c.Messaging.Snapshot()
+	}
+	if c.Audit != nil {
+		n := c.AuditEntries
+		if n <= 0 {
+			n = 100
+		}
+		entries := c.Audit.Last(n)
+		for i := range entries {
+			entries[i] = Redact(entries[i])
+		}
+		files["audit.json"] = entries
+	}
+	files["manifest.json"] = map[string]interface{}{
+		"created":  time.Now().UTC(),
+		"problems": problems,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Redact returns a copy of an audit entry with secret details replaced and
+// credentials stripped from URLs
+func Redact(e audit.Entry) audit.Entry {
+	if len(e.Details) == 0 {
+		e.Subject = redactURL(e.Subject)
+		return e
+	}
+	details := make(map[string]string, len(e.Details))
+	for k, v := range e.Details {
+		details[k] = redactURL(v)
+		name := strings.ToLower(k)
+		for _, secret := range secretKeys {
+			if strings.Contains(name, secret) {
+				details[k] = redacted
+				break
+			}
+		}
+	}
+	e.Details = details
+	e.Subject = redactURL(e.Subject)
+	return e
+}
+
+// redactURL keeps only the scheme and host of URLs, whose paths and queries
+// often carry provider API keys
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" || u.Scheme == "" {
+		return s
+	}
+	if u.User == nil && u.Path == "" && u.RawQuery == "" {
+		return s
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+func buildVersions() Versions {
+	v := Versions{Go: runtime.Version(), OS: runtime.GOOS, Arch: runtime.GOARCH}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	v.Module, v.Version = info.Main.Path, info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			v.Revision = s.Value
+		}
+	}
+	v.Deps = make(map[string]string)
+	for _, dep := range info.Deps {
+		if strings.HasPrefix(dep.Path, "github.com/ethereum/") {
+			v.Deps[dep.Path] = dep.Version
+		}
+	}
+	return v
+}
+
+func (c *Collector) chain(ctx context.Context) (*Chain, []string) {
+	var chain Chain
+	var problems []string
+	if id, err := c.Client.ChainID(ctx); err != nil {
+		problems = append(problems, "chainId: "+err.Error())
+	} else {
+		chain.ChainID = id.String()
+	}
+	if head, err := c.Client.HeaderByNumber(ctx, nil); err != nil {
+		problems = append(problems, "head: "+err.Error())
+	} else {
+		chain.Head = head.Number.Uint64()
+		chain.HeadTime = time.Unix(int64(head.Time), 0).UTC().Format(time.RFC3339)
+		chain.London = head.BaseFee != nil
+	}
+	if err := c.Client.Client().CallContext(ctx, &chain.ClientVersion, "web3_clientVersion"); err != nil {
+		problems = append(problems, "clientVersion: "+err.Error())
+	}
+	if progress, err := c.Client.SyncProgress(ctx); err == nil {
+		chain.Syncing = progress != nil
+	}
+	_, err := txmgr.TxPoolStatus(ctx, c.Client)
+	chain.TxPool = err == nil
+	var trace json.RawMessage
+	err = c.Client.Client().CallContext(ctx, &trace, "debug_traceBlockByNumber", "latest", map[string]string{"tracer": "callTracer"})
+	chain.Trace = err == nil
+	return &chain, problems
+}
+
+func (c *Collector) queues(ctx context.Context) ([]Queue, []string) {
+	var queues []Queue
+	var problems []string
+	for _, acct := range c.Accounts {
+		confirmed, err := c.Client.NonceAt(ctx, acct, nil)
+		if err != nil {
+			problems = append(problems, "queue "+acct.Hex()+": "+err.Error())
+			continue
+		}
+		pending, err := c.Client.PendingNonceAt(ctx, acct)
+		if err != nil {
+			problems = append(problems, "queue "+acct.Hex()+": "+err.Error())
+			continue
+		}
+		q := Queue{Account: acct, Confirmed: confirmed, Pending: pending}
+		if pending > confirmed {
+			q.InFlight = pending - confirmed
+		}
+		queues = append(queues, q)
+	}
+	return queues, problems
+}
@@ -0,0 +1,59 @@
+package diagnostics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/whisperchain/go-examples/alert"
+)
+
+// Error is a recorded failure
+type Error struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
+// Recent keeps the latest errors for diagnostic bundles. It is also an
+// alert.Notifier, so it can be routed every alert
+type Recent struct {
+	mu     sync.Mutex
+	max    int
+	errors []Error
+}
+
+// NewRecent keeps the last max errors
+func NewRecent(max int) *Recent {
+	return &Recent{max: max}
+}
+
+// Record keeps an error from source; nil errors are ignored
+func (r *Recent) Record(source string, err error) {
+	if err == nil {
+		return
+	}
+	r.add(Error{Time: time.Now().UTC(), Source: source, Message: err.Error()})
+}
+
+// Notify implements alert.Notifier
+func (r *Recent) Notify(ctx context.Context, a alert.Alert) error {
+	r.add(Error{Time: a.Time.UTC(), Source: a.Source + "/" + a.Severity.String(), Message: a.Title + ": " + a.Message})
+	return nil
+}
+
+// Entries returns the kept errors, oldest first
+func (r *Recent) Entries() []Error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Error(nil), r.errors...)
+}
+
+func (r *Recent) add(e Error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, e)
+	if len(r.errors) > r.max {
+		r.errors = append(r.errors[:0], r.errors[len(r.errors)-r.max:]...)
+	}
+}
@@ -0,0 +1,177 @@
+package eas
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+)
+
+// easABIJSON is the subset of the EAS contract ABI used by this package
+const easABIJSON = `[
+{"type":"function","name":"attest","stateMutability":"payable","inputs":[{"name":"request","type":"tuple","components":[{"name":"schema","type":"bytes32"},{"name":"data","type":"tuple","components":[{"name":"recipient","type":"address"},{"name":"expirationTime","type":"uint64"},{"name":"revocable","type":"bool"},{"name":"refUID","type":"bytes32"},{"name":"data","type":"bytes"},{"name":"value","type":"uint256"}]}]}],"outputs":[{"name":"","type":"bytes32"}]},
+{"type":"function","name":"revoke","stateMutability":"payable","inputs":[{"name":"request","type":"tuple","components":[{"name":"schema","type":"bytes32"},{"name":"data","type":"tuple","components":[{"name":"uid","type":"bytes32"},{"name":"value","type":"uint256"}]}]}],"outputs":[]},
+{"type":"function","name":"getAttestation","stateMutability":"view","inputs":[{"name":"uid","type":"bytes32"}],"outputs":[{"name":"","type":"tuple","components":[{"name":"uid","type":"bytes32"},{"name":"schema","type":"bytes32"},{"name":"time","type":"uint64"},{"name":"expirationTime","type":"uint64"},{"name":"revocationTime","type":"uint64"},{"name":"refUID","type":"bytes32"},{"name":"recipient","type":"address"},{"name":"attester","type":"address"},{"name":"revocable","type":"bool"},{"name":"data","type":"bytes"}]}]},
+{"type":"function","name":"isAttestationValid","stateMutability":"view","inputs":[{"name":"uid","type":"bytes32"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"event","name":"Attested","anonymous":false,"inputs":[{"name":"recipient","type":"address","indexed":true},{"name":"attester","type":"address","indexed":true},{"name":"uid","type":"bytes32","indexed":false},{"name":"schemaUID","type":"bytes32","indexed":true}]},
+{"type":"event","name":"Revoked","anonymous":false,"inputs":[{"name":"recipient","type":"address","indexed":true},{"name":"attester","type":"address","indexed":true},{"name":"uid","type":"bytes32","indexed":false},{"name":"schemaUID","type":"bytes32","indexed":true}]}
+]`
+
+var easABI = mustParseABI(easABIJSON)
+
+// Known EAS contract deployments by chain ID
+var Deployments = map[int64]common.Address{
+	1:        common.HexToAddress("0xA1207F3BBa224E2c9c3c6D5aF63D0eb1582Ce587"),
+	11155111: common.HexToAddress("0xC2679fBD37d54388Ce493F1DB75320D236e1815e"),
+}
+
+// AttestationRequestData holds the per-attestation fields of a request
+type AttestationRequestData struct {
+	Recipient      common.Address
+	ExpirationTime uint64
+	Revocable      bool
+	RefUID         [32]byte
+	Data           []byte
+	Value          *big.Int
+}
+
+// AttestationRequest is the argument to EAS.attest
+type AttestationRequest struct {
+	Schema [32]byte
+	Data   AttestationRequestData
+}
+
+// RevocationRequestData holds the per-revocation fields of a request
+type RevocationRequestData struct {
+	Uid   [32]byte
+	Value *big.Int
+}
+
+// RevocationRequest is the argument to EAS.revoke
+type RevocationRequest struct {
+	Schema [32]byte
+	Data   RevocationRequestData
+}
+
+// Attestation is an on-chain attestation record
+type Attestation struct {
+	Uid            [32]byte
+	Schema         [32]byte
+	Time           uint64
+	ExpirationTime uint64
+	RevocationTime uint64
+	RefUID         [32]byte
+	Recipient      common.Address
+	Attester       common.Address
+	Revocable      bool
+	Data           []byte
+}
+
+// Revoked reports whether the attestation has been revoked
+func (a *Attestation) Revoked() bool {
+	return a.RevocationTime != 0
+}
+
+// EAS wraps an Ethereum Attestation Service contract
+type EAS struct {
+	Address  common.Address
+	Client   *ethclient.Client
+	contract *bind.BoundContract
+}
+
+// NewEAS creates a new EAS instance
+func NewEAS(address common.Address, client *ethclient.Client) *EAS {
+	return &EAS{
+		Address:  address,
+		Client:   client,
+		contract: bind.NewBoundContract(address, easABI, client, client, client),
+	}
+}
+
+// Attest submits a new attestation
+func (e *EAS) Attest(auth *bind.TransactOpts, req AttestationRequest) (*types.Transaction, error) {
+	if req.Data.Value == nil {
+		req.Data.Value = big.NewInt(0)
+	}
+	return e.contract.Transact(auth, "attest", req)
+}
+
+// Revoke revokes an attestation created under schema
+func (e *EAS) Revoke(auth *bind.TransactOpts, schema, uid common.Hash) (*types.Transaction, error) {
+	req := RevocationRequest{
+		Schema: schema,
+		Data:   RevocationRequestData{Uid: uid, Value: big.NewInt(0)},
+	}
+	return e.contract.Transact(auth, "revoke", req)
+}
+
+// GetAttestation fetches an attestation by UID
+func (e *EAS) GetAttestation(ctx context.Context, uid common.Hash) (*Attestation, error) {
+	att, err := contract.Call[Attestation](ctx, e.contract, "getAttestation", uid)
+	if err != nil {
+		return nil, err
+	}
+	if att.Uid == ([32]byte{}) {
+		return nil, errors.New("attestation not found")
+	}
+	return &att, nil
+}
+
+// IsValid reports whether uid refers to an existing attestation
+func (e *EAS) IsValid(ctx context.Context, uid common.Hash) (bool, error) {
+	return contract.Call[bool](ctx, e.contract, "isAttestationValid", uid)
+}
+
+// UIDFromReceipt extracts the attestation UID from an attest transaction receipt
+func (e *EAS) UIDFromReceipt(receipt *types.Receipt) (common.Hash, error) {
+	event := easABI.Events["Attested"]
+	for _, l := range receipt.Logs {
+		if l.Address != e.Address || len(l.Topics) == 0 || l.Topics[0] != event.ID {
+			continue
+		}
+		var attested struct {
+			Recipient common.Address
+			Attester  common.Address
+			Uid       [32]byte
+			SchemaUID [32]byte
+		}
+		if err := e.contract.UnpackLog(&attested, "Attested", *l); err != nil {
+			return common.Hash{}, err
+		}
+		return attested.Uid, nil
+	}
+	return common.Hash{}, errors.New("no Attested event in receipt")
+}
+
+// ParseSchema converts an EAS schema string such as "uint256 score, bool verified"
+// into ABI arguments for encoding and decoding attestation data
+func ParseSchema(schema string) (abi.Arguments, error) {
+	var args abi.Arguments
+	for _, field := range strings.Split(schema, ",") {
+		parts := strings.Fields(field)
+		if len(parts) != 2 {
+			return nil, errors.New("malformed schema field: " + strings.TrimSpace(field))
+		}
+		typ, err := abi.NewType(parts[0], "", nil)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, abi.Argument{Name: parts[1], Type: typ})
+	}
+	return args, nil
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -0,0 +1,188 @@
+package eas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/paging"
+)
+
+// Known EAS GraphQL indexer endpoints by chain ID
+var IndexerEndpoints = map[int64]string{
+	1:        "https://easscan.org/graphql",
+	11155111: "https://sepolia.easscan.org/graphql",
+}
+
+const attestationsQuery = `query Attestations($where: AttestationWhereInput, $take: Int) {
+  attestations(where: $where, take: $take, orderBy: [{time: desc}]) {` + attestationFields + `}
+}`
+
+// attestationsPageQuery resumes after the attestation with the cursor's ID
+const attestationsPageQuery = `query Attestations($where: AttestationWhereInput, $take: Int, $skip: Int, $cursor: AttestationWhereUniqueInput) {
+  attestations(where: $where, take: $take, skip: $skip, cursor: $cursor, orderBy: [{time: desc}, {id: asc}]) {` + attestationFields + `}
+}`
+
+const attestationFields = `
+    id
+    schemaId
+    attester
+    recipient
+    refUID
+    revocable
+    revoked
+    revocationTime
+    expirationTime
+    time
+    txid
+    data
+  `
+
+// IndexedAttestation is an attestation as returned by the EAS indexer
+type IndexedAttestation struct {
+	ID             common.Hash    `json:"id"`
+	SchemaID       common.Hash    `json:"schemaId"`
+	Attester       common.Address `json:"attester"`
+	Recipient      common.Address `json:"recipient"`
+	RefUID         common.Hash    `json:"refUID"`
+	Revocable      bool           `json:"revocable"`
+	Revoked        bool           `json:"revoked"`
+	RevocationTime uint64         `json:"revocationTime"`
+	ExpirationTime uint64         `json:"expirationTime"`
+	Time           uint64         `json:"time"`
+	TxID           common.Hash    `json:"txid"`
+	Data           string         `json:"data"`
+}
+
+// Filter selects attestations from the indexer
+type Filter struct {
+	Schema         *common.Hash
+	Recipient      *common.Address
+	Attester       *common.Address
+	IncludeRevoked bool
+	Limit          int
+}
+
+// Indexer queries the EAS GraphQL API
+type Indexer struct {
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// NewIndexer creates an indexer client for a GraphQL endpoint
+func NewIndexer(endpoint string) *Indexer {
+	return &Indexer{
+		Endpoint:   endpoint,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Attestations returns attestations matching the filter, newest first
+func (ix *Indexer) Attestations(ctx context.Context, f Filter) ([]IndexedAttestation, error) {
+	vars := map[string]interface{}{"where": f.where()}
+	if f.Limit > 0 {
+		vars["take"] = f.Limit
+	}
+
+	var out struct {
+		Attestations []IndexedAttestation `json:"attestations"`
+	}
+	if err := ix.query(ctx, attestationsQuery, vars, &out); err != nil {
+		return nil, err
+	}
+	return out.Attestations, nil
+}
+
+// AttestationsPage returns a page of the attestations matching the filter,
+// newest first. The indexer pages by ID, so the filter's Limit is ignored in
+// favour of the request's
+func (ix *Indexer) AttestationsPage(ctx context.Context, f Filter, r paging.Request) (*paging.Page[IndexedAttestation], error) {
+	after, err := r.Key()
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]interface{}{"where": f.where(), "take": r.Size() + 1}
+	if after != "" {
+		vars["cursor"] = map[string]string{"id": after}
+		vars["skip"] = 1
+	}
+
+	var out struct {
+		Attestations []IndexedAttestation `json:"attestations"`
+	}
+	if err := ix.query(ctx, attestationsPageQuery, vars, &out); err != nil {
+		return nil, err
+	}
+	page := &paging.Page[IndexedAttestation]{Items: out.Attestations}
+	if page.Items == nil {
+		page.Items = []IndexedAttestation{}
+	}
+	if len(page.Items) > r.Size() {
+		page.Items = page.Items[:r.Size()]
+		page.Next = paging.Cursor(page.Items[len(page.Items)-1].ID.Hex())
+		page.HasMore = true
+	}
+	return page, nil
+}
+
+func (f Filter) where() map[string]interface{} {
+	where := map[string]interface{}{}
+	if f.Schema != nil {
+		where["schemaId"] = map[string]string{"equals": f.Schema.Hex()}
+	}
+	if f.Recipient != nil {
+		where["recipient"] = map[string]string{"equals": f.Recipient.Hex()}
+	}
+	if f.Attester != nil {
+		where["attester"] = map[string]string{"equals": f.Attester.Hex()}
+	}
+	if !f.IncludeRevoked {
+		where["revoked"] = map[string]bool{"equals": false}
+	}
+	return where
+}
+
+// query performs a GraphQL request and decodes the data field into out
+func (ix *Indexer) query(ctx context.Context, query string, vars map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ix.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ix.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("indexer returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return errors.New("indexer error: " + result.Errors[0].Message)
+	}
+	return json.Unmarshal(result.Data, out)
+}
@@ -0,0 +1,317 @@
+// Package easm assembles the small EVM assembly dialect the demo contracts
+// are written in, so their bytecode can be rebuilt and checked without a
+// Solidity toolchain.
+//
+// A source file has one instruction per line and ";" comments. "label:"
+// assembles to a JUMPDEST and "PUSH @label" to a PUSH2 of the label's offset
+// in its section. ".macro NAME" ... ".endm" defines a block that a line
+// naming it expands to. Code goes in ".section init", which deploys, and
+// ".section runtime", which init returns; init refers to the runtime with
+// "@runtime.offset" and "@runtime.size". A comment after a push that names a
+// function or event signature, such as "; transfer(address,uint256)", or a
+// quoted string is checked against the value pushed
+package easm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrSyntax is returned for source the assembler cannot parse
+	ErrSyntax = errors.New("easm: syntax error")
+	// ErrComment is returned when a comment naming a signature or string
+	// disagrees with the value pushed
+	ErrComment = errors.New("easm: pushed value does not match its comment")
+)
+
+// maxMacroDepth bounds macro expansion, so a macro that names itself fails
+const maxMacroDepth = 16
+
+var (
+	signatureComment = regexp.MustCompile(`^[A-Za-z_]\w*\([^)]*\)`)
+	stringComment    = regexp.MustCompile(`^"(.*)"`)
+)
+
+// Program is assembled contract code
+type Program struct {
+	Init    []byte // deployment code: the init section followed by the runtime
+	Runtime []byte // the code init returns
+}
+
+// line is one instruction with its source line number and comment
+type line struct {
+	n       int
+	text    string
+	comment string
+}
+
+// Assemble assembles src, which must have an init and a runtime section
+func Assemble(src string) (*Program, error) {
+	sections, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"init", "runtime"} {
+		if sections[name] == nil {
+			return nil, fmt.Errorf("%w: no %s section", ErrSyntax, name)
+		}
+	}
+	runtime, err := build(sections["runtime"], nil)
+	if err != nil {
+		return nil, err
+	}
+	// Every push of a symbol is two bytes wide, so the init size does not
+	// depend on the runtime's
+	size, err := sizeOf(sections["init"])
+	if err != nil {
+		return nil, err
+	}
+	init, err := build(sections["init"], map[string]int{"runtime.size": len(runtime), "runtime.offset": size})
+	if err != nil {
+		return nil, err
+	}
+	return &Program{Init: append(init, runtime...), Runtime: runtime}, nil
+}
+
+// parse splits src into sections with their macros expanded
+func parse(src string) (map[string][]line, error) {
+	var (
+		macros   = make(map[string][]line)
+		sections = make(map[string][]line)
+		section  string
+		macro    string
+	)
+	for i, raw := range strings.Split(src, "\n") {
+		text, comment, _ := strings.Cut(raw, ";")
+		l := line{n: i + 1, text: strings.TrimSpace(text), comment: strings.TrimSpace(comment)}
+		if l.text == "" {
+			continue
+		}
+		fields := strings.Fields(l.text)
+		switch {
+		case fields[0] == ".endm":
+			if macro == "" {
+				return nil, fmt.Errorf("%w: line %d: .endm outside a macro", ErrSyntax, l.n)
+			}
+			macro = ""
+		case macro != "":
+			macros[macro] = append(macros[macro], l)
+		case fields[0] == ".macro":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%w: line %d: .macro takes a name", ErrSyntax, l.n)
+			}
+			macro = fields[1]
+			if _, ok := macros[macro]; ok {
+				return nil, fmt.Errorf("%w: line %d: macro %s defined twice", ErrSyntax, l.n, macro)
+			}
+			macros[macro] = []line{}
+		case fields[0] == ".section":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%w: line %d: .section takes a name", ErrSyntax, l.n)
+			}
+			section = fields[1]
+			if _, ok := sections[section]; ok {
+				return nil, fmt.Errorf("%w: line %d: section %s defined twice", ErrSyntax, l.n, section)
+			}
+			sections[section] = []line{}
+		case strings.HasPrefix(fields[0], "."):
+			return nil, fmt.Errorf("%w: line %d: unknown directive %s", ErrSyntax, l.n, fields[0])
+		case section == "":
+			return nil, fmt.Errorf("%w: line %d: code outside a section", ErrSyntax, l.n)
+		default:
+			sections[section] = append(sections[section], l)
+		}
+	}
+	if macro != "" {
+		return nil, fmt.Errorf("%w: macro %s has no .endm", ErrSyntax, macro)
+	}
+	for name, lines := range sections {
+		expanded, err := expand(lines, macros, 0)
+		if err != nil {
+			return nil, err
+		}
+		sections[name] = expanded
+	}
+	return sections, nil
+}
+
+func expand(lines []line, macros map[string][]line, depth int) ([]line, error) {
+	if depth > maxMacroDepth {
+		return nil, fmt.Errorf("%w: macros nested more than %d deep", ErrSyntax, maxMacroDepth)
+	}
+	var out []line
+	for _, l := range lines {
+		body, ok := macros[l.text]
+		if !ok {
+			out = append(out, l)
+			continue
+		}
+		expanded, err := expand(body, macros, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%w (from line %d)", err, l.n)
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
+
+// sizeOf returns the assembled size of lines without resolving symbols
+func sizeOf(lines []line) (int, error) {
+	size := 0
+	for _, l := range lines {
+		n, err := width(l)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// width returns how many bytes l assembles to
+func width(l line) (int, error) {
+	if strings.HasSuffix(l.text, ":") {
+		return 1, nil
+	}
+	fields := strings.Fields(l.text)
+	if len(fields) == 2 && fields[0] == "PUSH" && strings.HasPrefix(fields[1], "@") {
+		return 3, nil
+	}
+	if n, ok := pushSize(fields[0]); ok {
+		return 1 + n, nil
+	}
+	return 1, nil
+}
+
+// build assembles one section; labels resolve to offsets in it and other
+// symbols come from syms
+func build(lines []line, syms map[string]int) ([]byte, error) {
+	labels := make(map[string]int)
+	offset := 0
+	for _, l := range lines {
+		if name, ok := strings.CutSuffix(l.text, ":"); ok {
+			if _, dup := labels[name]; dup {
+				return nil, fmt.Errorf("%w: line %d: label %s defined twice", ErrSyntax, l.n, name)
+			}
+			labels[name] = offset
+		}
+		n, err := width(l)
+		if err != nil {
+			return nil, err
+		}
+		offset += n
+	}
+
+	var code bytes.Buffer
+	for _, l := range lines {
+		if strings.HasSuffix(l.text, ":") {
+			code.WriteByte(byte(vm.JUMPDEST))
+			continue
+		}
+		fields := strings.Fields(l.text)
+		if len(fields) == 2 && fields[0] == "PUSH" && strings.HasPrefix(fields[1], "@") {
+			name := fields[1][1:]
+			v, ok := labels[name]
+			if !ok {
+				v, ok = syms[name]
+			}
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: undefined symbol %s", ErrSyntax, l.n, name)
+			}
+			if v > 0xffff {
+				return nil, fmt.Errorf("%w: line %d: %s is past 64 KiB", ErrSyntax, l.n, name)
+			}
+			code.Write([]byte{byte(vm.PUSH2), byte(v >> 8), byte(v)})
+			continue
+		}
+		op, err := opcode(l, fields[0])
+		if err != nil {
+			return nil, err
+		}
+		code.WriteByte(byte(op))
+		n, ok := pushSize(fields[0])
+		if !ok {
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("%w: line %d: %s takes no operand", ErrSyntax, l.n, fields[0])
+			}
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: line %d: %s takes one operand", ErrSyntax, l.n, fields[0])
+		}
+		arg, err := operand(l, fields[1], n)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkComment(l, arg); err != nil {
+			return nil, err
+		}
+		code.Write(arg)
+	}
+	return code.Bytes(), nil
+}
+
+// opcode looks up an instruction; SHA3 is accepted for KECCAK256
+func opcode(l line, name string) (vm.OpCode, error) {
+	if name == "SHA3" {
+		return vm.KECCAK256, nil
+	}
+	op := vm.StringToOp(name)
+	if op == vm.STOP && name != "STOP" {
+		return 0, fmt.Errorf("%w: line %d: unknown instruction %s", ErrSyntax, l.n, name)
+	}
+	return op, nil
+}
+
+// pushSize returns n for PUSH1 to PUSH32
+func pushSize(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, "PUSH")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 || n > 32 {
+		return 0, false
+	}
+	return n, true
+}
+
+// operand decodes a hex operand into n big-endian bytes
+func operand(l line, s string, n int) ([]byte, error) {
+	digits, ok := strings.CutPrefix(s, "0x")
+	v, valid := new(big.Int).SetString(digits, 16)
+	if !ok || !valid || v.Sign() < 0 {
+		return nil, fmt.Errorf("%w: line %d: operand %s is not hex", ErrSyntax, l.n, s)
+	}
+	if (v.BitLen()+7)/8 > n {
+		return nil, fmt.Errorf("%w: line %d: %s does not fit in %d bytes", ErrSyntax, l.n, s, n)
+	}
+	return v.FillBytes(make([]byte, n)), nil
+}
+
+// checkComment compares a pushed value with the signature or string its
+// comment names; other comments are free text
+func checkComment(l line, pushed []byte) error {
+	if sig := signatureComment.FindString(l.comment); sig != "" {
+		hash := crypto.Keccak256([]byte(sig))
+		if len(pushed) == 4 {
+			hash = hash[:4]
+		}
+		if !bytes.Equal(pushed, hash) {
+			return fmt.Errorf("%w: line %d: %s hashes to %x", ErrComment, l.n, sig, hash)
+		}
+	}
+	if m := stringComment.FindStringSubmatch(l.comment); m != nil && !bytes.Equal(pushed, []byte(m[1])) {
+		return fmt.Errorf("%w: line %d: %x is not %q", ErrComment, l.n, pushed, m[1])
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package easm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestAssembleLayout(t *testing.T) {
+	src := `
+.macro RET_ZERO
+        PUSH1 0x00
+        DUP1
+        RETURN
+.endm
+
+.section init
+        PUSH @runtime.size      ; copy the runtime and return it
+        DUP1
+        PUSH @runtime.offset
+        PUSH1 0x00
+        CODECOPY
+        PUSH1 0x00
+        RETURN
+
+.section runtime
+        PUSH4 0xa9059cbb        ; transfer(address,uint256)
+        PUSH @done
+        JUMP
+        PUSH2 0x5748            ; "WH"
+done:
+        RET_ZERO
+`
+	prog, err := Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(prog.Runtime), "63a9059cbb61000c566157485b600080f3"; got != want {
+		t.Fatalf("runtime %s, want %s", got, want)
+	}
+	// The init section is 13 bytes and pushes the runtime's 17 byte size
+	// and its offset after init
+	if got, want := hex.EncodeToString(prog.Init[:13]), "6100118061000d6000396000f3"; got != want {
+		t.Fatalf("init %s, want %s", got, want)
+	}
+	if !bytes.Equal(prog.Init[13:], prog.Runtime) {
+		t.Fatal("init is not followed by the runtime")
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body string
+		err  error
+	}{
+		"selector":    {"PUSH4 0x12345678 ; transfer(address,uint256)", ErrComment},
+		"string":      {`PUSH2 0x5748 ; "WX"`, ErrComment},
+		"label":       {"PUSH @nowhere", ErrSyntax},
+		"instruction": {"NOPE", ErrSyntax},
+		"width":       {"PUSH1 0x100", ErrSyntax},
+		"operand":     {"ADD 0x01", ErrSyntax},
+		"macro":       {"LOOP", ErrSyntax},
+	} {
+		src := ".macro LOOP\nLOOP\n.endm\n.section init\nSTOP\n.section runtime\n" + tc.body + "\n"
+		if _, err := Assemble(src); !errors.Is(err, tc.err) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.err)
+		}
+	}
+	if _, err := Assemble(".section runtime\nSTOP\n"); !errors.Is(err, ErrSyntax) {
+		t.Errorf("no init section: got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package entropy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// Or returns r, or crypto/rand.Reader when r is nil, so a zero Rand field
+// means the system's secure source
+func Or(r io.Reader) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+	return r
+}
+
+// Read fills b from r, crypto/rand when nil
+func Read(r io.Reader, b []byte) error {
+	_, err := io.ReadFull(Or(r), b)
+	return err
+}
+
+// Deterministic returns an endless stream derived from seed, the same for
+// the same seed, for test fixtures and reproducible demos. Anyone who knows
+// the seed can recreate every key made from it; never use it for real funds
+type Deterministic struct {
+	mu      sync.Mutex
+	seed    [32]byte
+	counter uint64
+	buf     []byte
+}
+
+// NewDeterministic creates a stream for seed
+func NewDeterministic(seed string) *Deterministic {
+	return &Deterministic{seed: sha256.Sum256([]byte(seed))}
+}
+
+// Read implements io.Reader; it never fails
+func (d *Deterministic) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		if len(d.buf) == 0 {
+			var block [40]byte
+			copy(block[:], d.seed[:])
+			binary.BigEndian.PutUint64(block[32:], d.counter)
+			d.counter++
+			sum := sha256.Sum256(block[:])
+			d.buf = sum[:]
+		}
+		c := copy(p[n:], d.buf)
+		d.buf = d.buf[c:]
+		n += c
+	}
+	return n, nil
+}
@@ -0,0 +1,307 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrClosed is returned when publishing to a closed topic
+	ErrClosed = errors.New("eventbus: topic closed")
+	// ErrTopicType is returned when a topic name is reused for another type
+	ErrTopicType = errors.New("eventbus: topic has another event type")
+)
+
+// Policy is what a publisher does when a subscriber's queue is full
+type Policy int
+
+const (
+	// Block waits for room, slowing the publisher down to the subscriber.
+	// Use it where losing events is worse than falling behind, such as
+	// feeding the transaction queue
+	Block Policy = iota
+	// DropNewest discards the event being published
+	DropNewest
+	// DropOldest discards the oldest queued event to make room, for
+	// consumers that only care about recent state such as head updates
+	DropOldest
+)
+
+// String returns the policy name
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	}
+	return fmt.Sprintf("policy(%d)", int(p))
+}
+
+// Options tune a subscription
+type Options struct {
+	Buffer int // queue length; zero is 64
+	Policy Policy
+}
+
+// Stats counts a subscription's traffic
+type Stats struct {
+	Policy    string `json:"policy"`
+	Capacity  int    `json:"capacity"`
+	Queued    int    `json:"queued"`
+	Delivered uint64 `json:"delivered"` // accepted into the queue
+	Dropped   uint64 `json:"dropped"`
+	Blocked   uint64 `json:"blocked"` // publishes that had to wait for room
+}
+
+// Bus names topics so subsystems find each other's streams and operators can
+// read every queue's stats in one place
+type Bus struct {
+	mu     sync.Mutex
+	topics map[string]topic
+}
+
+// topic is the type-independent part of a Topic
+type topic interface {
+	Stats() map[string]Stats
+	Close()
+}
+
+// New creates an empty bus
+func New() *Bus {
+	return &Bus{topics: make(map[string]topic)}
+}
+
+// TopicOf returns the bus's topic of events T named name, creating it on
+// first use
+func TopicOf[T any](b *Bus, name string) (*Topic[T], error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[name]; ok {
+		typed, ok := t.(*Topic[T])
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTopicType, name)
+		}
+		return typed, nil
+	}
+	t := NewTopic[T](name)
+	b.topics[name] = t
+	return t, nil
+}
+
+// Stats returns every subscription's stats by topic and subscriber name
+func (b *Bus) Stats() map[string]map[string]Stats {
+	b.mu.Lock()
+	topics := make(map[string]topic, len(b.topics))
+	for name, t := range b.topics {
+		topics[name] = t
+	}
+	b.mu.Unlock()
+	out := make(map[string]map[string]Stats, len(topics))
+	for name, t := range topics {
+		out[name] = t.Stats()
+	}
+	return out
+}
+
+// Close closes every topic, ending their subscriptions
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, t := range b.topics {
+		t.Close()
+	}
+}
+
+// Topic fans events of one type out to its subscribers, each with its own
+// bounded queue and full-queue policy, so one slow consumer only holds up
+// publishers when it asked to
+type Topic[T any] struct {
+	Name string
+
+	mu     sync.RWMutex // held for reading while publishing
+	subs   []*Subscription[T]
+	closed bool
+}
+
+// NewTopic creates a topic outside any bus
+func NewTopic[T any](name string) *Topic[T] {
+	return &Topic[T]{Name: name}
+}
+
+// Subscribe adds a subscriber. Only events published after it subscribes
+// are delivered
+func (t *Topic[T]) Subscribe(name string, opts Options) *Subscription[T] {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	s := &Subscription[T]{
+		Name:   name,
+		topic:  t,
+		policy: opts.Policy,
+		ch:     make(chan T, opts.Buffer),
+		done:   make(chan struct{}),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		s.stop()
+		close(s.ch)
+		return s
+	}
+	t.subs = append(t.subs, s)
+	return s
+}
+
+// Publish delivers v to every subscriber by its policy. It returns early with
+// ctx's error only when a blocking subscriber is full; subscribers before it
+// already have the event
+func (t *Topic[T]) Publish(ctx context.Context, v T) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return ErrClosed
+	}
+	for _, s := range t.subs {
+		if err := s.offer(ctx, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns the stats of each subscription by name
+func (t *Topic[T]) Stats() map[string]Stats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make(map[string]Stats, len(t.subs))
+	for _, s := range t.subs {
+		out[s.Name] = s.Stats()
+	}
+	return out
+}
+
+// Close ends every subscription; subscribers still receive what is queued
+func (t *Topic[T]) Close() {
+	t.mu.RLock()
+	subs := append([]*Subscription[T](nil), t.subs...)
+	t.mu.RUnlock()
+	for _, s := range subs {
+		s.stop() // release publishers blocked on a full queue
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	for _, s := range t.subs {
+		close(s.ch)
+	}
+	t.subs = nil
+}
+
+func (t *Topic[T]) remove(s *Subscription[T]) {
+	s.stop()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, sub := range t.subs {
+		if sub == s {
+			t.subs = append(t.subs[:i:i], t.subs[i+1:]...)
+			close(s.ch)
+			return
+		}
+	}
+}
+
+// Subscription is one consumer's queue on a topic
+type Subscription[T any] struct {
+	Name string
+
+	topic    *Topic[T]
+	policy   Policy
+	ch       chan T
+	done     chan struct{}
+	stopOnce sync.Once
+	dropMu   sync.Mutex // serializes drop-oldest evictions
+
+	delivered, dropped, blocked atomic.Uint64
+}
+
+// C returns the queue; it is closed when the subscription or topic ends
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Unsubscribe stops delivery and closes C after releasing any publisher
+// waiting on it
+func (s *Subscription[T]) Unsubscribe() {
+	s.topic.remove(s)
+}
+
+// Stats returns the subscription's counters
+func (s *Subscription[T]) Stats() Stats {
+	return Stats{
+		Policy:    s.policy.String(),
+		Capacity:  cap(s.ch),
+		Queued:    len(s.ch),
+		Delivered: s.delivered.Load(),
+		Dropped:   s.dropped.Load(),
+		Blocked:   s.blocked.Load(),
+	}
+}
+
+func (s *Subscription[T]) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+// offer queues v by the subscription's policy. It is called with the topic
+// read-locked, so ch is open
+func (s *Subscription[T]) offer(ctx context.Context, v T) error {
+	select {
+	case s.ch <- v:
+		s.delivered.Add(1)
+		return nil
+	default:
+	}
+
+	switch s.policy {
+	case DropNewest:
+		s.dropped.Add(1)
+		return nil
+	case DropOldest:
+		s.dropMu.Lock()
+		defer s.dropMu.Unlock()
+		for {
+			select {
+			case s.ch <- v:
+				s.delivered.Add(1)
+				return nil
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	}
+
+	s.blocked.Add(1)
+	select {
+	case s.ch <- v:
+		s.delivered.Add(1)
+		return nil
+	case <-s.done:
+		s.dropped.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
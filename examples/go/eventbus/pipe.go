@@ -0,0 +1,93 @@
+package eventbus
+
+import (
+	"context"
+
+	"github.com/whisperchain/go-examples/alert"
+)
+
+// Pipe publishes every value from in, such as a watcher's Incoming channel
+// or a confirm.Tracker's events, until in closes or ctx is done
+func Pipe[T any](ctx context.Context, in <-chan T, to *Topic[T]) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case v, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if err := to.Publish(ctx, v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Stream copies a subscription to an unbuffered channel for stages that
+// take one, such as confirm.Settler.Settle. The channel closes when the
+// subscription ends or ctx is done
+func Stream[T any](ctx context.Context, s *Subscription[T]) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-s.C():
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Handle calls fn for each event until the subscription ends or ctx is done.
+// Errors go to onError, if set, and do not stop the handler
+func Handle[T any](ctx context.Context, s *Subscription[T], fn func(ctx context.Context, v T) error, onError func(v T, err error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-s.C():
+			if !ok {
+				return
+			}
+			if err := fn(ctx, v); err != nil && onError != nil {
+				onError(v, err)
+			}
+		}
+	}
+}
+
+// Map is a stage between topics: each event from s is passed to fn and, when
+// fn returns ok, its result is published to the next topic. A rule that
+// turns transfers into alerts is a Map from a transfer topic to an alert one
+func Map[A, B any](ctx context.Context, s *Subscription[A], to *Topic[B], fn func(ctx context.Context, v A) (B, bool, error), onError func(v A, err error)) {
+	Handle(ctx, s, func(ctx context.Context, v A) error {
+		out, ok, err := fn(ctx, v)
+		if err != nil || !ok {
+			return err
+		}
+		return to.Publish(ctx, out)
+	}, onError)
+}
+
+// Notifier returns an alert.Notifier publishing to t, so subsystems raising
+// alerts feed the bus instead of calling notifiers directly
+func Notifier(t *Topic[alert.Alert]) alert.Notifier {
+	return alert.Func(t.Publish)
+}
+
+// Notify delivers alerts from s to n, such as an alert.Dispatcher
+func Notify(ctx context.Context, s *Subscription[alert.Alert], n alert.Notifier, onError func(a alert.Alert, err error)) {
+	Handle(ctx, s, n.Notify, onError)
+}
@@ -0,0 +1,170 @@
+package gasquote
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/aa"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/pricing"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// NativeAsset is the pricing key used for ETH
+var NativeAsset = common.Address{}
+
+// Token is an ERC-20 that fees can be quoted in
+type Token struct {
+	Address  common.Address
+	Symbol   string
+	Decimals uint8
+}
+
+// Quote is a transaction fee expressed in an ERC-20
+type Quote struct {
+	Token       Token
+	GasLimit    uint64
+	GasFeeCap   *big.Int // wei per gas
+	GasTipCap   *big.Int // wei per gas
+	ExpectedWei *big.Int // gas limit * (base fee + tip)
+	MaxWei      *big.Int // gas limit * fee cap
+	Expected    *big.Int // expected fee in token base units
+	Max         *big.Int // maximum fee in token base units; sponsors should charge this
+	Rate        *big.Rat // token units per ETH used for the conversion
+	ExpiresAt   time.Time
+}
+
+// Quoter prices transaction fees in ERC-20 terms for stablecoin-first UX and
+// for paymasters that charge users in tokens
+type Quoter struct {
+	Client    *ethclient.Client
+	Prices    pricing.Source // must price both ETH and the quoted tokens in the same fiat currency
+	MarkupBps int64          // added to the converted amounts to cover price movement
+	TTL       time.Duration  // how long a quote is honoured
+	Clock     clock.Clock    // stamps quote expiry; nil is the wall clock
+	// Strategy prices gas for Quote; nil is wallet.DefaultGasStrategy, so
+	// quotes match what a default wallet would send
+	Strategy wallet.GasStrategy
+}
+
+// New creates a quoter
+func New(client *ethclient.Client, prices pricing.Source) *Quoter {
+	return &Quoter{Client: client, Prices: prices, MarkupBps: 100, TTL: time.Minute}
+}
+
+// Quote estimates the fee for msg and converts it into token
+func (q *Quoter) Quote(ctx context.Context, msg ethereum.CallMsg, token Token) (*Quote, error) {
+	gas := msg.Gas
+	if gas == 0 {
+		var err error
+		if gas, err = q.Client.EstimateGas(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	strategy := q.Strategy
+	if strategy == nil {
+		strategy = wallet.DefaultGasStrategy
+	}
+	fees, err := strategy.Fees(ctx, q.Client)
+	if err != nil {
+		return nil, err
+	}
+	return q.QuoteFees(ctx, token, gas, fees)
+}
+
+// QuoteFees converts gas at fees already chosen, such as a wallet's, into
+// token. The expected fee pays the current base fee plus the tip
+func (q *Quoter) QuoteFees(ctx context.Context, token Token, gas uint64, fees *wallet.Fees) (*Quote, error) {
+	expectedPrice := fees.GasFeeCap
+	if !fees.Legacy {
+		head, err := q.Client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if head.BaseFee != nil {
+			if p := new(big.Int).Add(head.BaseFee, fees.GasTipCap); p.Cmp(expectedPrice) < 0 {
+				expectedPrice = p
+			}
+		}
+	}
+
+	limit := new(big.Int).SetUint64(gas)
+	return q.quoteWei(ctx, token, gas, fees.GasFeeCap, fees.GasTipCap,
+		new(big.Int).Mul(limit, expectedPrice),
+		new(big.Int).Mul(limit, fees.GasFeeCap))
+}
+
+// QuoteUserOp converts the most a user operation can cost, as its paymaster
+// is charged, into token
+func (q *Quoter) QuoteUserOp(ctx context.Context, op *aa.UserOperation, token Token) (*Quote, error) {
+	max := op.MaxCost()
+	return q.quoteWei(ctx, token, 0, op.MaxFeePerGas, op.MaxPriorityFeePerGas, max, max)
+}
+
+// QuoteWei converts a fee already computed in wei into token, for callers such
+// as a paymaster that price gas themselves
+func (q *Quoter) QuoteWei(ctx context.Context, token Token, feeWei *big.Int) (*Quote, error) {
+	return q.quoteWei(ctx, token, 0, nil, nil, feeWei, feeWei)
+}
+
+func (q *Quoter) quoteWei(ctx context.Context, token Token, gas uint64, feeCap, tip, expectedWei, maxWei *big.Int) (*Quote, error) {
+	now := clock.Or(q.Clock).Now()
+	rate, err := q.Rate(ctx, token, now)
+	if err != nil {
+		return nil, err
+	}
+	return &Quote{
+		Token:       token,
+		GasLimit:    gas,
+		GasFeeCap:   feeCap,
+		GasTipCap:   tip,
+		ExpectedWei: expectedWei,
+		MaxWei:      maxWei,
+		Expected:    convert(expectedWei, rate, token.Decimals, q.MarkupBps),
+		Max:         convert(maxWei, rate, token.Decimals, q.MarkupBps),
+		Rate:        rate,
+		ExpiresAt:   now.Add(q.TTL),
+	}, nil
+}
+
+// Rate returns how many whole token units one ETH buys at the given time
+func (q *Quoter) Rate(ctx context.Context, token Token, at time.Time) (*big.Rat, error) {
+	ethPrice, err := q.Prices.Price(ctx, NativeAsset, at)
+	if err != nil {
+		return nil, err
+	}
+	tokenPrice, err := q.Prices.Price(ctx, token.Address, at)
+	if err != nil {
+		return nil, err
+	}
+	if tokenPrice.Sign() <= 0 {
+		return nil, errors.New("token price must be positive")
+	}
+	return new(big.Rat).Quo(ethPrice, tokenPrice), nil
+}
+
+// Valid reports whether the quote can still be honoured
+func (q *Quote) Valid(now time.Time) bool {
+	return now.Before(q.ExpiresAt)
+}
+
+// convert turns wei into token base units at rate, applying the markup and
+// rounding up so sponsors never undercharge
+func convert(wei *big.Int, rate *big.Rat, decimals uint8, markupBps int64) *big.Int {
+	amount := pricing.Units(wei, 18)
+	amount.Mul(amount, rate)
+	amount.Mul(amount, new(big.Rat).SetFrac64(10000+markupBps, 10000))
+	amount.Mul(amount, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)))
+
+	out, rem := new(big.Int).QuoRem(amount.Num(), amount.Denom(), new(big.Int))
+	if rem.Sign() > 0 {
+		out.Add(out, big.NewInt(1))
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package gasquote
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/aa"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/pricing"
+)
+
+var usdc = Token{Address: common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"), Symbol: "USDC", Decimals: 6}
+
+func newQuoter() *Quoter {
+	q := New(nil, pricing.Static{
+		NativeAsset:  big.NewRat(2000, 1),
+		usdc.Address: big.NewRat(1, 1),
+	})
+	q.MarkupBps = 0
+	q.Clock = clock.NewFake(time.Unix(1_700_000_000, 0))
+	return q
+}
+
+func TestQuoteWei(t *testing.T) {
+	q := newQuoter()
+	// 0.001 ETH at 2000 USDC/ETH is 2 USDC
+	quote, err := q.QuoteWei(context.Background(), usdc, big.NewInt(1e15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Max.Cmp(big.NewInt(2_000_000)) != 0 {
+		t.Fatalf("got %s", quote.Max)
+	}
+	if !quote.Valid(q.Clock.Now().Add(59*time.Second)) || quote.Valid(q.Clock.Now().Add(time.Minute)) {
+		t.Fatal("quote should be honoured for its TTL only")
+	}
+
+	// Markup is applied and the conversion rounds up
+	q.MarkupBps = 100
+	quote, err = q.QuoteWei(context.Background(), usdc, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Max.Sign() != 1 {
+		t.Fatalf("one wei rounded to %s", quote.Max)
+	}
+}
+
+func TestQuoteUserOp(t *testing.T) {
+	op := &aa.UserOperation{
+		CallGasLimit:         big.NewInt(100_000),
+		VerificationGasLimit: big.NewInt(50_000),
+		PreVerificationGas:   big.NewInt(50_000),
+		MaxFeePerGas:         big.NewInt(10_000_000_000),
+		MaxPriorityFeePerGas: big.NewInt(1_000_000_000),
+	}
+	// 200k gas at 10 gwei is 0.002 ETH, or 4 USDC
+	quote, err := newQuoter().QuoteUserOp(context.Background(), op, usdc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.MaxWei.Cmp(big.NewInt(2e15)) != 0 || quote.Max.Cmp(big.NewInt(4_000_000)) != 0 {
+		t.Fatalf("got %s wei, %s USDC units", quote.MaxWei, quote.Max)
+	}
+
+	// A paymaster's postOp triples the verification gas
+	op.PaymasterAndData = []byte{1}
+	quote, err = newQuoter().QuoteUserOp(context.Background(), op, usdc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.MaxWei.Cmp(big.NewInt(3e15)) != 0 {
+		t.Fatalf("got %s wei with a paymaster", quote.MaxWei)
+	}
+}
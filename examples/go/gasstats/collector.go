@@ -0,0 +1,201 @@
+package gasstats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+)
+
+const (
+	storePrefix  = "gasstats/"
+	samplePrefix = storePrefix + "sample/"
+	lastKey      = storePrefix + "last"
+)
+
+// Collector records per-block fee samples so charts can cover more history
+// than nodes keep for eth_feeHistory
+type Collector struct {
+	Client   *ethclient.Client
+	Store    storage.Store
+	Backfill uint64 // blocks sampled on the first run; default 1024
+	MaxBatch uint64 // most blocks sampled per run; default 4096
+
+	mu sync.Mutex
+}
+
+// NewCollector creates a collector
+func NewCollector(client *ethclient.Client, store storage.Store) *Collector {
+	return &Collector{Client: client, Store: store, Backfill: maxHistory, MaxBatch: 4 * maxHistory}
+}
+
+// Collect samples the blocks mined since the last run and returns how many
+// were stored
+func (c *Collector) Collect(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	head, err := c.Client.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var first uint64
+	data, err := c.Store.Get(ctx, lastKey)
+	switch {
+	case err == nil:
+		last, err := strconv.ParseUint(string(data), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("gasstats: bad last block %q", data)
+		}
+		first = last + 1
+	case errors.Is(err, storage.ErrNotFound):
+		if backfill := c.Backfill; backfill > 0 && head+1 > backfill {
+			first = head + 1 - backfill
+		}
+	default:
+		return 0, err
+	}
+	if first > head {
+		return 0, nil
+	}
+	last := head
+	if c.MaxBatch > 0 && last-first+1 > c.MaxBatch {
+		last = first + c.MaxBatch - 1
+	}
+
+	samples, err := FromFeeHistory(ctx, c.Client, first, last)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range samples {
+		value, err := json.Marshal(s)
+		if err != nil {
+			return 0, err
+		}
+		if err := c.Store.Put(ctx, sampleKey(s), value); err != nil {
+			return 0, err
+		}
+	}
+	return len(samples), c.Store.Put(ctx, lastKey, []byte(strconv.FormatUint(last, 10)))
+}
+
+// Schedule registers Collect with a scheduler
+func (c *Collector) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("gasstats-collect", interval, func(ctx context.Context) error {
+		_, err := c.Collect(ctx)
+		return err
+	})
+}
+
+// Samples returns the stored samples with times in [from, to)
+func (c *Collector) Samples(ctx context.Context, from, to time.Time) ([]Sample, error) {
+	keys, err := c.Store.List(ctx, samplePrefix)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := timeKey(from), timeKey(to)
+	var samples []Sample
+	for _, key := range keys {
+		// Keys sort by time, so most can be skipped without reading them
+		t := strings.TrimPrefix(key, samplePrefix)
+		if t < lo {
+			continue
+		}
+		if t >= hi {
+			break
+		}
+		data, err := c.Store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var s Sample
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// Buckets aggregates the stored samples in [from, to) into buckets of width
+func (c *Collector) Buckets(ctx context.Context, from, to time.Time, width time.Duration) ([]Bucket, error) {
+	samples, err := c.Samples(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return Aggregate(samples, width), nil
+}
+
+// ServeHTTP serves buckets as JSON for dashboards. Query parameters are from
+// and to as RFC 3339 or unix seconds (default the last 24 hours) and bucket
+// as a Go duration (default 1h)
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to, err := parseTime(q.Get("to"), time.Now())
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "bad to: "+err.Error())
+		return
+	}
+	from, err := parseTime(q.Get("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "bad from: "+err.Error())
+		return
+	}
+	width := time.Hour
+	if v := q.Get("bucket"); v != "" {
+		if width, err = time.ParseDuration(v); err != nil || width < time.Second {
+			httpError(w, http.StatusBadRequest, "bad bucket width")
+			return
+		}
+	}
+	if !from.Before(to) || to.Sub(from)/width > 10000 {
+		httpError(w, http.StatusBadRequest, "range must be positive and at most 10000 buckets")
+		return
+	}
+
+	buckets, err := c.Buckets(r.Context(), from, to, width)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    from.UTC(),
+		"to":      to.UTC(),
+		"bucket":  width.String(),
+		"buckets": buckets,
+	})
+}
+
+func sampleKey(s Sample) string {
+	return samplePrefix + timeKey(s.Time) + "/" + fmt.Sprintf("%020d", s.Block)
+}
+
+func timeKey(t time.Time) string {
+	return fmt.Sprintf("%012d", t.Unix())
+}
+
+func parseTime(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func httpError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
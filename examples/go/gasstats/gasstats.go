@@ -0,0 +1,171 @@
+package gasstats
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// maxHistory is the most blocks nodes return from one eth_feeHistory call
+const maxHistory = 1024
+
+// Sample is the fee data of one block
+type Sample struct {
+	Block        uint64    `json:"block"`
+	Time         time.Time `json:"time"`
+	BaseFee      *big.Int  `json:"baseFee"`
+	PriorityFee  *big.Int  `json:"priorityFee"` // median tip paid in the block
+	GasUsedRatio float64   `json:"gasUsedRatio"`
+}
+
+// Series summarizes one fee over a bucket, in wei
+type Series struct {
+	Min    *big.Int `json:"min"`
+	Median *big.Int `json:"median"`
+	Mean   *big.Int `json:"mean"`
+	Max    *big.Int `json:"max"`
+}
+
+// Bucket aggregates the blocks whose time falls in [Start, Start+width)
+type Bucket struct {
+	Start        time.Time `json:"start"`
+	Blocks       int       `json:"blocks"`
+	BaseFee      Series    `json:"baseFee"`
+	PriorityFee  Series    `json:"priorityFee"`
+	GasUsedRatio float64   `json:"gasUsedRatio"` // mean
+}
+
+// Aggregate groups samples into buckets of width by block time, oldest
+// first. Buckets without samples are omitted
+func Aggregate(samples []Sample, width time.Duration) []Bucket {
+	if width <= 0 || len(samples) == 0 {
+		return nil
+	}
+	sorted := append([]Sample(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Block < sorted[j].Block })
+
+	var buckets []Bucket
+	for i := 0; i < len(sorted); {
+		start := sorted[i].Time.Truncate(width)
+		j := i
+		for j < len(sorted) && sorted[j].Time.Truncate(width).Equal(start) {
+			j++
+		}
+		buckets = append(buckets, bucket(start, sorted[i:j]))
+		i = j
+	}
+	return buckets
+}
+
+// FromHeader builds a sample from an indexed block header and the tips its
+// transactions paid; headers without a base fee give nil
+func FromHeader(h *types.Header, tips []*big.Int) *Sample {
+	if h.BaseFee == nil {
+		return nil
+	}
+	s := &Sample{
+		Block:       h.Number.Uint64(),
+		Time:        time.Unix(int64(h.Time), 0).UTC(),
+		BaseFee:     new(big.Int).Set(h.BaseFee),
+		PriorityFee: new(big.Int),
+	}
+	if h.GasLimit > 0 {
+		s.GasUsedRatio = float64(h.GasUsed) / float64(h.GasLimit)
+	}
+	if len(tips) > 0 {
+		s.PriorityFee = summarize(tips).Median
+	}
+	return s
+}
+
+// FromFeeHistory samples blocks first through last from eth_feeHistory.
+// Fee history carries no timestamps, so block times are interpolated
+// between the headers of first and last; missed slots skew them slightly
+func FromFeeHistory(ctx context.Context, client *ethclient.Client, first, last uint64) ([]Sample, error) {
+	if last < first {
+		return nil, errors.New("gasstats: empty block range")
+	}
+	firstHeader, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(first))
+	if err != nil {
+		return nil, err
+	}
+	lastHeader, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(last))
+	if err != nil {
+		return nil, err
+	}
+	blockTime := func(n uint64) time.Time {
+		if last == first {
+			return time.Unix(int64(firstHeader.Time), 0).UTC()
+		}
+		span := float64(lastHeader.Time - firstHeader.Time)
+		offset := span * float64(n-first) / float64(last-first)
+		return time.Unix(int64(firstHeader.Time)+int64(offset), 0).UTC()
+	}
+
+	var samples []Sample
+	for end := last; ; {
+		count := end - first + 1
+		if count > maxHistory {
+			count = maxHistory
+		}
+		h, err := client.FeeHistory(ctx, count, new(big.Int).SetUint64(end), []float64{50})
+		if err != nil {
+			return nil, err
+		}
+		oldest := h.OldestBlock.Uint64()
+		var chunk []Sample
+		for i, ratio := range h.GasUsedRatio {
+			if i >= len(h.BaseFee) || h.BaseFee[i] == nil || h.BaseFee[i].Sign() == 0 {
+				continue // pre-London
+			}
+			n := oldest + uint64(i)
+			s := Sample{Block: n, Time: blockTime(n), BaseFee: h.BaseFee[i], PriorityFee: new(big.Int), GasUsedRatio: ratio}
+			if i < len(h.Reward) && len(h.Reward[i]) > 0 && h.Reward[i][0] != nil {
+				s.PriorityFee = h.Reward[i][0]
+			}
+			chunk = append(chunk, s)
+		}
+		samples = append(chunk, samples...)
+		if oldest <= first || len(h.GasUsedRatio) == 0 {
+			return samples, nil
+		}
+		end = oldest - 1
+	}
+}
+
+func bucket(start time.Time, samples []Sample) Bucket {
+	base := make([]*big.Int, len(samples))
+	tips := make([]*big.Int, len(samples))
+	var ratio float64
+	for i, s := range samples {
+		base[i], tips[i] = s.BaseFee, s.PriorityFee
+		ratio += s.GasUsedRatio
+	}
+	return Bucket{
+		Start:        start,
+		Blocks:       len(samples),
+		BaseFee:      summarize(base),
+		PriorityFee:  summarize(tips),
+		GasUsedRatio: ratio / float64(len(samples)),
+	}
+}
+
+func summarize(values []*big.Int) Series {
+	sorted := append([]*big.Int(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+	sum := new(big.Int)
+	for _, v := range sorted {
+		sum.Add(sum, v)
+	}
+	return Series{
+		Min:    sorted[0],
+		Median: sorted[len(sorted)/2],
+		Mean:   sum.Div(sum, big.NewInt(int64(len(sorted)))),
+		Max:    sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,163 @@
+// Package holderstats reports how a token is distributed: a leaderboard of
+// top holders, the Gini coefficient of balances, and holder count, transfer
+// volume and velocity over time, rebuilt from the token's Transfer logs
+package holderstats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrNegativeBalance is returned when a transfer spends more than its sender
+// received in the logs replayed so far, usually because replay did not start
+// at the token's deployment block
+var ErrNegativeBalance = errors.New("holderstats: transfer exceeds replayed balance")
+
+// Rank is an account's place on the holder leaderboard
+type Rank struct {
+	Rank    int            `json:"rank"`
+	Address common.Address `json:"address"`
+	Balance *big.Int       `json:"balance"`
+	Share   float64        `json:"share"` // of total supply
+}
+
+// Ledger is the token balances implied by the Transfer logs applied to it.
+// Transfers from the zero address mint and transfers to it burn
+type Ledger struct {
+	balances map[common.Address]*big.Int
+	supply   *big.Int
+}
+
+// NewLedger creates an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{balances: make(map[common.Address]*big.Int), supply: new(big.Int)}
+}
+
+// Apply moves value from one account to another
+func (l *Ledger) Apply(from, to common.Address, value *big.Int) error {
+	if value.Sign() == 0 {
+		return nil
+	}
+	if from == (common.Address{}) {
+		l.supply.Add(l.supply, value)
+	} else {
+		b := l.balances[from]
+		if b == nil || b.Cmp(value) < 0 {
+			return fmt.Errorf("%w: %s sends %s", ErrNegativeBalance, from.Hex(), value)
+		}
+		if b.Sub(b, value); b.Sign() == 0 {
+			delete(l.balances, from)
+		}
+	}
+	if to == (common.Address{}) {
+		l.supply.Sub(l.supply, value)
+		return nil
+	}
+	if b := l.balances[to]; b != nil {
+		b.Add(b, value)
+	} else {
+		l.balances[to] = new(big.Int).Set(value)
+	}
+	return nil
+}
+
+// Balance returns an account's balance
+func (l *Ledger) Balance(addr common.Address) *big.Int {
+	if b := l.balances[addr]; b != nil {
+		return new(big.Int).Set(b)
+	}
+	return new(big.Int)
+}
+
+// Supply returns minted minus burned tokens
+func (l *Ledger) Supply() *big.Int {
+	return new(big.Int).Set(l.supply)
+}
+
+// Holders returns how many accounts hold a balance, not counting exclude
+func (l *Ledger) Holders(exclude map[common.Address]bool) int {
+	n := len(l.balances)
+	for addr := range exclude {
+		if _, ok := l.balances[addr]; ok {
+			n--
+		}
+	}
+	return n
+}
+
+// Top returns the n largest holders, largest first, not counting exclude;
+// ties are ordered by address. Zero or negative n returns every holder
+func (l *Ledger) Top(n int, exclude map[common.Address]bool) []Rank {
+	ranks := make([]Rank, 0, len(l.balances))
+	for addr, b := range l.balances {
+		if !exclude[addr] {
+			ranks = append(ranks, Rank{Address: addr, Balance: b})
+		}
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if c := ranks[i].Balance.Cmp(ranks[j].Balance); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(ranks[i].Address[:], ranks[j].Address[:]) < 0
+	})
+	if n > 0 && len(ranks) > n {
+		ranks = ranks[:n]
+	}
+	for i := range ranks {
+		ranks[i].Rank = i + 1
+		ranks[i].Balance = new(big.Int).Set(ranks[i].Balance)
+		ranks[i].Share = ratio(ranks[i].Balance, l.supply)
+	}
+	return ranks
+}
+
+// Gini returns the Gini coefficient of the holders' balances, not counting
+// exclude
+func (l *Ledger) Gini(exclude map[common.Address]bool) float64 {
+	balances := make([]*big.Int, 0, len(l.balances))
+	for addr, b := range l.balances {
+		if !exclude[addr] {
+			balances = append(balances, b)
+		}
+	}
+	return Gini(balances)
+}
+
+// Gini returns the Gini coefficient of balances: 0 when all are equal,
+// approaching 1 as one account holds everything. It is 0 for fewer than two
+// balances
+func Gini(balances []*big.Int) float64 {
+	if len(balances) < 2 {
+		return 0
+	}
+	sorted := append([]*big.Int(nil), balances...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+	// G = 2*sum(i*x_i) / (n*sum(x_i)) - (n+1)/n, with i from 1 in
+	// ascending order; exact in integers up to the final division
+	weighted, total := new(big.Int), new(big.Int)
+	for i, b := range sorted {
+		weighted.Add(weighted, new(big.Int).Mul(big.NewInt(int64(i+1)), b))
+		total.Add(total, b)
+	}
+	if total.Sign() == 0 {
+		return 0
+	}
+	n := big.NewInt(int64(len(sorted)))
+	num := new(big.Int).Sub(new(big.Int).Lsh(weighted, 1), new(big.Int).Mul(new(big.Int).Add(n, big.NewInt(1)), total))
+	g, _ := new(big.Rat).SetFrac(num, new(big.Int).Mul(n, total)).Float64()
+	return g
+}
+
+// ratio returns a/b, or 0 when b is zero
+func ratio(a, b *big.Int) float64 {
+	if b.Sign() == 0 {
+		return 0
+	}
+	r, _ := new(big.Rat).SetFrac(a, b).Float64()
+	return r
+}
@@ -0,0 +1,273 @@
+package holderstats
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/paging"
+	"github.com/whisperchain/go-examples/scheduler"
+)
+
+// maxTop bounds the leaderboard served over HTTP
+const maxTop = 10000
+
+// Point is the token at the end of one interval of blocks
+type Point struct {
+	Block     uint64    `json:"block"` // last block of the interval
+	Time      time.Time `json:"time"`
+	Holders   int       `json:"holders"`
+	Transfers int       `json:"transfers"` // in the interval, mints and burns included
+	Volume    *big.Int  `json:"volume"`    // moved between accounts in the interval, mints and burns excluded
+	Supply    *big.Int  `json:"supply"`
+	Velocity  float64   `json:"velocity"` // Volume / Supply
+	Gini      float64   `json:"gini"`
+}
+
+// Report is a token's distribution at the last scanned block and its history
+// up to the last complete interval
+type Report struct {
+	Token   common.Address `json:"token"`
+	Block   uint64         `json:"block"`
+	Supply  *big.Int       `json:"supply"`
+	Holders int            `json:"holders"`
+	Gini    float64        `json:"gini"`
+	Top     []Rank         `json:"top"`
+	History []Point        `json:"history"`
+}
+
+// Tracker keeps a token's holder statistics current by replaying its
+// Transfer logs from deployment, picking up where the last Update stopped.
+// Balances are held in memory, so a restarted tracker replays from Start
+type Tracker struct {
+	Client        *ethclient.Client
+	Token         common.Address
+	Start         uint64 // the token's deployment block
+	Interval      uint64 // blocks per history point; default 7200, a day of 12 second slots
+	Confirmations uint64 // blocks behind the head left unscanned, so reorgs are not counted; default 12
+	// Exclude is left out of holder counts, the Gini coefficient and the
+	// leaderboard, such as treasury, vesting and exchange wallets
+	Exclude []common.Address
+
+	mu      sync.Mutex
+	ledger  *Ledger
+	next    uint64    // first block not fully applied
+	applied types.Log // last log applied, so a failed Update resumes after it
+	open    Point     // the interval being accumulated
+	history []Point
+}
+
+// NewTracker creates a tracker for a token deployed at block start
+func NewTracker(client *ethclient.Client, token common.Address, start uint64) *Tracker {
+	return &Tracker{Client: client, Token: token, Start: start, Interval: 7200, Confirmations: 12}
+}
+
+// Update applies the Transfer logs of the blocks confirmed since the last
+// run and returns how many it applied
+func (t *Tracker) Update(ctx context.Context) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ledger == nil {
+		t.ledger, t.next = NewLedger(), t.Start
+		t.open = Point{Block: t.Start + t.interval() - 1, Volume: new(big.Int)}
+	}
+	head, err := t.Client.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if head < t.Confirmations || head-t.Confirmations < t.next {
+		return 0, nil
+	}
+	last := head - t.Confirmations
+	exclude := t.excluded()
+
+	n := 0
+	err = paging.EachLog(ctx, t.Client, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(t.next),
+		ToBlock:   new(big.Int).SetUint64(last),
+		Addresses: []common.Address{t.Token},
+		Topics:    [][]common.Hash{{contract.TransferTopic}},
+	}, func(l types.Log) error {
+		// ERC-721 transfers share the signature but index the token ID
+		if len(l.Topics) != 3 || !t.after(l) {
+			return nil
+		}
+		if l.BlockNumber > t.open.Block {
+			if err := t.close(ctx, l.BlockNumber-1, exclude); err != nil {
+				return err
+			}
+		}
+		from := common.BytesToAddress(l.Topics[1].Bytes())
+		to := common.BytesToAddress(l.Topics[2].Bytes())
+		value := new(big.Int).SetBytes(l.Data)
+		if err := t.ledger.Apply(from, to, value); err != nil {
+			return err
+		}
+		t.open.Transfers++
+		if from != (common.Address{}) && to != (common.Address{}) {
+			t.open.Volume.Add(t.open.Volume, value)
+		}
+		t.applied, t.next = l, l.BlockNumber
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := t.close(ctx, last, exclude); err != nil {
+		return n, err
+	}
+	t.next = last + 1
+	return n, nil
+}
+
+// Schedule registers Update with a scheduler
+func (t *Tracker) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("holderstats-"+t.Token.Hex(), interval, func(ctx context.Context) error {
+		_, err := t.Update(ctx)
+		return err
+	})
+}
+
+// Report returns the current statistics with the top holders; zero or
+// negative top lists every holder
+func (t *Tracker) Report(top int) *Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := &Report{Token: t.Token, Supply: new(big.Int), History: []Point{}, Top: []Rank{}}
+	if t.ledger == nil {
+		return r
+	}
+	exclude := t.excluded()
+	if t.next > t.Start {
+		r.Block = t.next - 1
+	}
+	r.Supply = t.ledger.Supply()
+	r.Holders = t.ledger.Holders(exclude)
+	r.Gini = t.ledger.Gini(exclude)
+	r.Top = t.ledger.Top(top, exclude)
+	r.History = append(r.History, t.history...)
+	return r
+}
+
+// ServeHTTP serves the report for community dashboards. Query parameters
+// are top, the leaderboard size (default 100), and format: json (default),
+// holders for the leaderboard as CSV or history for the history as CSV
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	top := 100
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTop {
+			httpError(w, http.StatusBadRequest, fmt.Sprintf("top must be between 1 and %d", maxTop))
+			return
+		}
+		top = n
+	}
+	report := t.Report(top)
+	switch q.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	case "holders":
+		w.Header().Set("Content-Type", "text/csv")
+		report.WriteHoldersCSV(w)
+	case "history":
+		w.Header().Set("Content-Type", "text/csv")
+		report.WriteHistoryCSV(w)
+	default:
+		httpError(w, http.StatusBadRequest, "format must be json, holders or history")
+	}
+}
+
+// WriteHoldersCSV writes the leaderboard as CSV, balances in base units
+func (r *Report) WriteHoldersCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"rank", "address", "balance", "share"})
+	for _, h := range r.Top {
+		cw.Write([]string{strconv.Itoa(h.Rank), h.Address.Hex(), h.Balance.String(), strconv.FormatFloat(h.Share, 'f', 6, 64)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteHistoryCSV writes the history as CSV, amounts in base units
+func (r *Report) WriteHistoryCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"block", "time", "holders", "transfers", "volume", "supply", "velocity", "gini"})
+	for _, p := range r.History {
+		cw.Write([]string{
+			strconv.FormatUint(p.Block, 10),
+			p.Time.Format(time.RFC3339),
+			strconv.Itoa(p.Holders),
+			strconv.Itoa(p.Transfers),
+			p.Volume.String(),
+			p.Supply.String(),
+			strconv.FormatFloat(p.Velocity, 'f', 6, 64),
+			strconv.FormatFloat(p.Gini, 'f', 6, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// close records every interval that ends at or before block
+func (t *Tracker) close(ctx context.Context, block uint64, exclude map[common.Address]bool) error {
+	for t.open.Block <= block {
+		h, err := t.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(t.open.Block))
+		if err != nil {
+			return err
+		}
+		p := t.open
+		p.Time = time.Unix(int64(h.Time), 0).UTC()
+		p.Holders = t.ledger.Holders(exclude)
+		p.Supply = t.ledger.Supply()
+		p.Velocity = ratio(p.Volume, p.Supply)
+		p.Gini = t.ledger.Gini(exclude)
+		t.history = append(t.history, p)
+		t.open = Point{Block: p.Block + t.interval(), Volume: new(big.Int)}
+	}
+	return nil
+}
+
+// after reports whether l comes after the last log applied
+func (t *Tracker) after(l types.Log) bool {
+	if t.applied.TxHash == (common.Hash{}) || l.BlockNumber != t.applied.BlockNumber {
+		return l.BlockNumber >= t.next
+	}
+	return l.Index > t.applied.Index
+}
+
+func (t *Tracker) interval() uint64 {
+	if t.Interval == 0 {
+		return 7200
+	}
+	return t.Interval
+}
+
+func (t *Tracker) excluded() map[common.Address]bool {
+	m := make(map[common.Address]bool, len(t.Exclude))
+	for _, addr := range t.Exclude {
+		m[addr] = true
+	}
+	return m
+}
+
+func httpError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,77 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/paging"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// Holder is an account's balance in a holder snapshot
+type Holder struct {
+	Address common.Address    `json:"address"`
+	Balance units.TokenAmount `json:"balance"`
+}
+
+// Holders calls fn for every account holding token at block atBlock, in
+// address order. Transfer logs since startBlock are replayed a span at a
+// time to find recipients and each balance is read from the node at atBlock,
+// so only the set of addresses is held in memory, never the transfers or
+// balances. The scan waits for fn and ends when ctx is done or fn returns an
+// error, paging.ErrStop ending it without one
+func (ix *Indexer) Holders(ctx context.Context, token common.Address, startBlock, atBlock uint64, fn func(Holder) error) error {
+	seen := make(map[common.Address]struct{})
+	err := paging.EachLog(ctx, ix.Client, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(startBlock),
+		ToBlock:   new(big.Int).SetUint64(atBlock),
+		Addresses: []common.Address{token},
+		Topics:    [][]common.Hash{{contract.TransferTopic}},
+	}, func(l types.Log) error {
+		if len(l.Topics) == 3 {
+			seen[common.BytesToAddress(l.Topics[2].Bytes())] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	delete(seen, common.Address{})
+
+	accounts := make([]common.Address, 0, len(seen))
+	for addr := range seen {
+		accounts = append(accounts, addr)
+	}
+	seen = nil
+	sort.Slice(accounts, func(i, j int) bool { return bytes.Compare(accounts[i][:], accounts[j][:]) < 0 })
+
+	unit, err := ix.token(ctx, token)
+	if err != nil {
+		return err
+	}
+	block := new(big.Int).SetUint64(atBlock)
+	for _, addr := range accounts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data := contract.BalanceOfData(addr)
+		out, err := ix.Client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, block)
+		if err != nil {
+			return err
+		}
+		balance := new(big.Int).SetBytes(out)
+		if balance.Sign() == 0 {
+			continue
+		}
+		if err := fn(Holder{Address: addr, Balance: units.NewTokenAmount(unit, balance)}); err != nil {
+			return paging.Stopped(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/paging"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// NativeAsset is the asset address used for ETH transfers
+var NativeAsset = common.Address{}
+
+// Transfer is a single observed movement of ETH or an ERC-20 token
+type Transfer struct {
+	Asset       common.Address    `json:"asset"`
+	From        common.Address    `json:"from"`
+	To          common.Address    `json:"to"`
+	Amount      units.TokenAmount `json:"amount"`        // in units.Native for ETH
+	Fee         *units.Wei        `json:"fee,omitempty"` // gas paid by From; set for native transfers only
+	TxHash      common.Hash       `json:"txHash"`
+	LogIndex    uint              `json:"logIndex"` // zero for native transfers
+	BlockNumber uint64            `json:"blockNumber"`
+	BlockHash   common.Hash       `json:"blockHash"`
+	Timestamp   uint64            `json:"timestamp"`
+}
+
+// IsNative reports whether the transfer moved ETH
+func (t *Transfer) IsNative() bool {
+	return t.Asset == NativeAsset
+}
+
+// Indexer collects the transfers touching an account from a node
+type Indexer struct {
+	Client *ethclient.Client
+	Tokens []common.Address // ERC-20 contracts to index; empty indexes every token
+	Native bool             // also scan blocks for ETH transfers
+
+	headers map[uint64]*types.Header
+	tokens  map[common.Address]units.Token
+}
+
+// New creates an indexer
+func New(client *ethclient.Client, native bool, tokens ...common.Address) *Indexer {
+	return &Indexer{Client: client, Tokens: tokens, Native: native, headers: make(map[uint64]*types.Header), tokens: make(map[common.Address]units.Token)}
+}
+
+// Transfers returns every transfer to or from account in the inclusive block
+// range, ordered by block and log index
+func (ix *Indexer) Transfers(ctx context.Context, account common.Address, fromBlock, toBlock uint64) ([]Transfer, error) {
+	if toBlock < fromBlock {
+		return nil, errors.New("invalid block range")
+	}
+
+	tokens, err := ix.tokenTransfers(ctx, account, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	transfers := tokens
+
+	if ix.Native {
+		native, err := ix.nativeTransfers(ctx, account, fromBlock, toBlock)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, native...)
+	}
+
+	sort.SliceStable(transfers, func(i, j int) bool {
+		if transfers[i].BlockNumber != transfers[j].BlockNumber {
+			return transfers[i].BlockNumber < transfers[j].BlockNumber
+		}
+		return transfers[i].LogIndex < transfers[j].LogIndex
+	})
+	return transfers, nil
+}
+
+// TransfersPage returns a page of the transfers to or from account in the
+// inclusive block range, scanning from the cursor on and stopping once the
+// page is full
+func (ix *Indexer) TransfersPage(ctx context.Context, account common.Address, fromBlock, toBlock uint64, r paging.Request) (*paging.Page[Transfer], error) {
+	if toBlock < fromBlock {
+		return nil, errors.New("invalid block range")
+	}
+	c, err := paging.NewCollector(r, TransferKey)
+	if err != nil {
+		return nil, err
+	}
+	if after, _ := r.Key(); after != "" {
+		if b, ok := paging.KeyBlock(after); ok && b > fromBlock {
+			fromBlock = min(b, toBlock)
+		}
+	}
+	err = ix.EachTransfer(ctx, account, fromBlock, toBlock, func(t Transfer) error {
+		c.Add(t)
+		if c.Full() {
+			return paging.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Page(), nil
+}
+
+// EachTransfer calls fn for every transfer to or from account in the
+// inclusive block range, in order, holding one span of blocks' transfers at a
+// time. The scan waits for fn and ends when ctx is done or fn returns an
+// error, paging.ErrStop ending it without one
+func (ix *Indexer) EachTransfer(ctx context.Context, account common.Address, fromBlock, toBlock uint64, fn func(Transfer) error) error {
+	if toBlock < fromBlock {
+		return errors.New("invalid block range")
+	}
+	for lo := fromBlock; lo <= toBlock; lo += paging.Span {
+		transfers, err := ix.Transfers(ctx, account, lo, min(lo+paging.Span-1, toBlock))
+		if err != nil {
+			return err
+		}
+		if err := paging.Each(ctx, transfers, fn); err != nil {
+			return paging.Stopped(err)
+		}
+	}
+	return nil
+}
+
+// TransferKey is the paging sort key of a transfer; the asset tells a
+// transaction's ETH transfer from a token transfer at log index zero
+func TransferKey(t Transfer) string {
+	return paging.BlockKey(t.BlockNumber, t.LogIndex, t.TxHash.Hex()+t.Asset.Hex())
+}
+
+func (ix *Indexer) tokenTransfers(ctx context.Context, account common.Address, fromBlock, toBlock uint64) ([]Transfer, error) {
+	accountTopic := common.BytesToHash(account.Bytes())
+	queries := [][][]common.Hash{
+		{{contract.TransferTopic}, {accountTopic}},
+		{{contract.TransferTopic}, nil, {accountTopic}},
+	}
+
+	seen := make(map[common.Hash]map[uint]bool)
+	var transfers []Transfer
+	for _, topics := range queries {
+		logs, err := ix.Client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(fromBlock),
+			ToBlock:   new(big.Int).SetUint64(toBlock),
+			Addresses: ix.Tokens,
+			Topics:    topics,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range logs {
+			// ERC-721 shares the event signature but indexes the token id
+			if l.Removed || len(l.Topics) != 3 || len(l.Data) != 32 {
+				continue
+			}
+			if seen[l.TxHash][l.Index] {
+				continue
+			}
+			if seen[l.TxHash] == nil {
+				seen[l.TxHash] = make(map[uint]bool)
+			}
+			seen[l.TxHash][l.Index] = true
+
+			ts, err := ix.timestamp(ctx, l.BlockNumber)
+			if err != nil {
+				return nil, err
+			}
+			token, err := ix.token(ctx, l.Address)
+			if err != nil {
+				return nil, err
+			}
+			transfers = append(transfers, Transfer{
+				Asset:       l.Address,
+				From:        common.BytesToAddress(l.Topics[1].Bytes()),
+				To:          common.BytesToAddress(l.Topics[2].Bytes()),
+				Amount:      units.NewTokenAmount(token, new(big.Int).SetBytes(l.Data)),
+				TxHash:      l.TxHash,
+				LogIndex:    l.Index,
+				BlockNumber: l.BlockNumber,
+				BlockHash:   l.BlockHash,
+				Timestamp:   ts,
+			})
+		}
+	}
+	return transfers, nil
+}
+
+func (ix *Indexer) nativeTransfers(ctx context.Context, account common.Address, fromBlock, toBlock uint64) ([]Transfer, error) {
+	chainID, err := ix.Client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.LatestSignerForChainID(chainID)
+
+	var transfers []Transfer
+	for n := fromBlock; n <= toBlock; n++ {
+		block, err := ix.Client.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions() {
+			if tx.To() == nil || tx.Value().Sign() == 0 {
+				continue
+			}
+			from, err := types.Sender(signer, tx)
+			if err != nil {
+				return nil, err
+			}
+			if from != account && *tx.To() != account {
+				continue
+			}
+
+			rcpt, err := ix.Client.TransactionReceipt(ctx, tx.Hash())
+			if err != nil {
+				return nil, err
+			}
+			if rcpt.Status != types.ReceiptStatusSuccessful {
+				continue
+			}
+			fee := units.NewWei(rcpt.EffectiveGasPrice).Mul(rcpt.GasUsed)
+			transfers = append(transfers, Transfer{
+				Asset:       NativeAsset,
+				From:        from,
+				To:          *tx.To(),
+				Amount:      units.NewWei(tx.Value()).Amount(),
+				Fee:         &fee,
+				TxHash:      tx.Hash(),
+				BlockNumber: n,
+				BlockHash:   block.Hash(),
+				Timestamp:   block.Time(),
+			})
+		}
+	}
+	return transfers, nil
+}
+
+func (ix *Indexer) timestamp(ctx context.Context, number uint64) (uint64, error) {
+	if h, ok := ix.headers[number]; ok {
+		return h.Time, nil
+	}
+	h, err := ix.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return 0, err
+	}
+	if ix.headers == nil {
+		ix.headers = make(map[uint64]*types.Header)
+	}
+	ix.headers[number] = h
+	return h.Time, nil
+}
+
+// token returns the symbol and decimals of an ERC-20, cached once read.
+// Tokens without readable metadata, which ERC-20 makes optional, are
+// reported in base units with no symbol, and read again next time
+func (ix *Indexer) token(ctx context.Context, address common.Address) (units.Token, error) {
+	if t, ok := ix.tokens[address]; ok {
+		return t, nil
+	}
+	t, err := contract.NewERC20(address, ix.Client).Token(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return units.Token{}, ctx.Err()
+		}
+		return units.Token{Address: address}, nil
+	}
+	if ix.tokens == nil {
+		ix.tokens = make(map[common.Address]units.Token)
+	}
+	ix.tokens[address] = t
+	return t, nil
+}
@@ -0,0 +1,143 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// refundPrefix is the store key prefix for refund links, keyed by the
+// original transaction and then the refund
+const refundPrefix = "indexer/refund/"
+
+// RefundLink ties a refund transfer to the payment it returns
+type RefundLink struct {
+	Original common.Hash       `json:"original"`
+	LogIndex uint              `json:"logIndex"` // of the original transfer
+	Refund   common.Hash       `json:"refund"`
+	Asset    common.Address    `json:"asset"`
+	Amount   units.TokenAmount `json:"amount"`
+}
+
+// Links records which transfers refund which payments
+type Links struct {
+	Store storage.Store
+}
+
+// NewLinks creates a link index backed by store
+func NewLinks(store storage.Store) *Links {
+	return &Links{Store: store}
+}
+
+// Link records a refund
+func (l *Links) Link(ctx context.Context, link *RefundLink) error {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	return l.Store.Put(ctx, refundKey(link.Original, link.Refund), data)
+}
+
+// Unlink removes a refund, such as one that was never broadcast
+func (l *Links) Unlink(ctx context.Context, original, refund common.Hash) error {
+	return l.Store.Delete(ctx, refundKey(original, refund))
+}
+
+// Refunds returns the refunds of a payment
+func (l *Links) Refunds(ctx context.Context, original common.Hash) ([]RefundLink, error) {
+	return l.list(ctx, refundPrefix+original.Hex()+"/")
+}
+
+// Refunded returns the total refunded from one transfer of a payment, in
+// the transfer's token
+func (l *Links) Refunded(ctx context.Context, paid *Transfer) (units.TokenAmount, error) {
+	links, err := l.Refunds(ctx, paid.TxHash)
+	if err != nil {
+		return units.TokenAmount{}, err
+	}
+	total := new(big.Int)
+	for _, link := range links {
+		if link.LogIndex == paid.LogIndex {
+			total.Add(total, link.Amount.Base())
+		}
+	}
+	return units.NewTokenAmount(paid.Amount.Token(), total), nil
+}
+
+// Net folds refunds into the payments they return: each original's amount
+// is reduced by its refunds in the list, fully refunded payments are left
+// out, and the refund transfers themselves are dropped. Refunds whose
+// original is outside the list are kept as they are
+func (l *Links) Net(ctx context.Context, transfers []Transfer) ([]Transfer, error) {
+	links, err := l.list(ctx, refundPrefix)
+	if err != nil {
+		return nil, err
+	}
+	type ref struct {
+		hash  common.Hash
+		index uint
+	}
+	present := make(map[ref]bool)
+	for _, t := range transfers {
+		present[ref{t.TxHash, t.LogIndex}] = true
+	}
+
+	// Links are keyed by transfer, so they share its asset; sum base units
+	// rather than trust the token details each side was recorded with
+	refunded := make(map[ref]*big.Int)
+	refunds := make(map[common.Hash]common.Address)
+	for _, link := range links {
+		orig := ref{link.Original, link.LogIndex}
+		if !present[orig] {
+			continue
+		}
+		if refunded[orig] == nil {
+			refunded[orig] = new(big.Int)
+		}
+		refunded[orig].Add(refunded[orig], link.Amount.Base())
+		refunds[link.Refund] = link.Asset
+	}
+
+	out := make([]Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		if asset, ok := refunds[t.TxHash]; ok && asset == t.Asset {
+			continue
+		}
+		if r := refunded[ref{t.TxHash, t.LogIndex}]; r != nil {
+			t.Amount = units.NewTokenAmount(t.Amount.Token(), new(big.Int).Sub(t.Amount.Base(), r))
+			if t.Amount.Sign() <= 0 {
+				continue
+			}
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (l *Links) list(ctx context.Context, prefix string) ([]RefundLink, error) {
+	keys, err := l.Store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RefundLink, 0, len(keys))
+	for _, key := range keys {
+		data, err := l.Store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var link RefundLink
+		if err := json.Unmarshal(data, &link); err != nil {
+			return nil, err
+		}
+		out = append(out, link)
+	}
+	return out, nil
+}
+
+func refundKey(original, refund common.Hash) string {
+	return refundPrefix + original.Hex() + "/" + refund.Hex()
+}
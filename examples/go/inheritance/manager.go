@@ -0,0 +1,200 @@
+package inheritance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// maxClockSkew bounds how far in the future a check-in may be dated
+const maxClockSkew = 5 * time.Minute
+
+// CheckIn is a signed proof of life from the plan owner
+type CheckIn struct {
+	Owner     common.Address `json:"owner"`
+	Timestamp int64          `json:"timestamp"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+func checkInPayload(owner common.Address, ts int64) []byte {
+	return []byte("whisperchain-inheritance-checkin:" + owner.Hex() + ":" + strconv.FormatInt(ts, 10))
+}
+
+// SignCheckIn creates a check-in for the owner's wallet dated now on clk;
+// a nil clk is the wall clock
+func SignCheckIn(w *wallet.Wallet, clk clock.Clock) (*CheckIn, error) {
+	ts := clock.Or(clk).Now().Unix()
+	sig, err := w.SignMessage(checkInPayload(w.Address, ts))
+	if err != nil {
+		return nil, err
+	}
+	return &CheckIn{Owner: w.Address, Timestamp: ts, Signature: sig}, nil
+}
+
+// Manager persists a plan and releases it when the owner misses a check-in
+type Manager struct {
+	Client *ethclient.Client
+	Store  storage.Store
+	Audit  audit.Log
+	Clock  clock.Clock // dates check-ins and releases; nil is the wall clock
+
+	// Deliver hands an encrypted share to its heir, e.g. over the messaging layer
+	Deliver func(ctx context.Context, heir Heir, share EncryptedShare) error
+
+	mu   sync.Mutex
+	plan *Plan
+}
+
+// NewManager creates a manager for a plan and persists it
+func NewManager(ctx context.Context, plan *Plan, client *ethclient.Client, store storage.Store, auditLog audit.Log) (*Manager, error) {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	m := &Manager{Client: client, Store: store, Audit: auditLog, plan: plan}
+	if err := m.save(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadManager restores a persisted plan for owner
+func LoadManager(ctx context.Context, owner common.Address, client *ethclient.Client, store storage.Store, auditLog audit.Log) (*Manager, error) {
+	data, err := store.Get(ctx, planKey(owner))
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, err
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Manager{Client: client, Store: store, Audit: auditLog, plan: &plan}, nil
+}
+
+// Plan returns a copy of the managed plan
+func (m *Manager) Plan() Plan {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.plan
+}
+
+// CheckIn verifies a proof of life and postpones the release deadline
+func (m *Manager) CheckIn(ctx context.Context, c *CheckIn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.plan.Released {
+		return errors.New("plan already released")
+	}
+	if c.Owner != m.plan.Owner || !wallet.VerifySignature(checkInPayload(c.Owner, c.Timestamp), c.Signature, c.Owner) {
+		return errors.New("invalid check-in signature")
+	}
+
+	at := time.Unix(c.Timestamp, 0).UTC()
+	if !at.After(m.plan.LastCheckIn) || at.After(clock.Or(m.Clock).Now().Add(maxClockSkew)) {
+		return errors.New("stale or future-dated check-in")
+	}
+
+	m.plan.LastCheckIn = at
+	if err := m.save(ctx); err != nil {
+		return err
+	}
+	m.Audit.Record(ctx, audit.Entry{
+		Actor:   c.Owner.Hex(),
+		Action:  "inheritance-checkin",
+		Outcome: "ok",
+		Details: map[string]string{"deadline": m.plan.Deadline().Format(time.RFC3339)},
+	})
+	return nil
+}
+
+// Tick releases the plan if the deadline has passed
+func (m *Manager) Tick(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.plan.Due(clock.Or(m.Clock).Now()) {
+		return nil
+	}
+	return m.release(ctx)
+}
+
+// Schedule registers the manager's deadline check with a scheduler
+func (m *Manager) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("inheritance:"+m.plan.Owner.Hex(), interval, m.Tick)
+}
+
+// release broadcasts pre-signed transfers and delivers key shares; callers must hold m.mu
+func (m *Manager) release(ctx context.Context) error {
+	var errs []error
+	for _, t := range m.plan.Transfers {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(t.Raw); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := m.Client.SendTransaction(ctx, tx); err != nil {
+			// A stale nonce means the owner spent after signing; heirs can still
+			// recover funds with the reconstructed key
+			errs = append(errs, fmt.Errorf("transfer nonce %d: %w", t.Nonce, err))
+			continue
+		}
+		m.Audit.Record(ctx, audit.Entry{
+			Actor:   "inheritance",
+			Action:  "broadcast-transfer",
+			Subject: tx.Hash().Hex(),
+			Outcome: "sent",
+		})
+	}
+
+	if m.Deliver != nil {
+		for i, share := range m.plan.Shares {
+			if err := m.Deliver(ctx, m.plan.Heirs[i], share); err != nil {
+				return fmt.Errorf("deliver share to %s: %w", share.Heir.Hex(), err)
+			}
+		}
+	}
+
+	m.plan.Released = true
+	m.plan.ReleasedAt = clock.Or(m.Clock).Now().UTC()
+	if err := m.save(ctx); err != nil {
+		return err
+	}
+
+	m.Audit.Record(ctx, audit.Entry{
+		Actor:   "inheritance",
+		Action:  "release",
+		Subject: m.plan.Owner.Hex(),
+		Outcome: "released",
+		Details: map[string]string{"transfer_errors": strconv.Itoa(len(errs))},
+	})
+	return errors.Join(errs...)
+}
+
+func (m *Manager) save(ctx context.Context) error {
+	data, err := json.Marshal(m.plan)
+	if err != nil {
+		return err
+	}
+	return m.Store.Put(ctx, planKey(m.plan.Owner), data)
+}
+
+func planKey(owner common.Address) string {
+	return "inheritance/plan/" + owner.Hex()
+}
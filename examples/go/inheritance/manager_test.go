@@ -0,0 +1,71 @@
+package inheritance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+func TestManagerReleasesOnMissedCheckIn(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	ownerKey, _ := crypto.GenerateKey()
+	owner := &wallet.Wallet{PrivateKey: ownerKey, Address: crypto.PubkeyToAddress(ownerKey.PublicKey)}
+	a, _ := crypto.GenerateKey()
+	b, _ := crypto.GenerateKey()
+	plan, err := NewPlan(owner, []Heir{NewHeir(&a.PublicKey), NewHeir(&b.PublicKey)}, 2, 24*time.Hour, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(ctx, plan, nil, storage.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Clock = clk
+	delivered := 0
+	m.Deliver = func(ctx context.Context, heir Heir, share EncryptedShare) error {
+		delivered++
+		return nil
+	}
+
+	// A check-in from a clock running ahead of the manager's is refused
+	ahead := clock.NewFake(clk.Now().Add(time.Hour))
+	early, err := SignCheckIn(owner, ahead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CheckIn(ctx, early); err == nil {
+		t.Fatal("accepted a future-dated check-in")
+	}
+
+	clk.Advance(20 * time.Hour)
+	checkIn, err := SignCheckIn(owner, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CheckIn(ctx, checkIn); err != nil {
+		t.Fatal(err)
+	}
+
+	// 30 hours after the start is only 10 past the check-in
+	clk.Advance(10 * time.Hour)
+	if err := m.Tick(ctx); err != nil || m.Plan().Released {
+		t.Fatalf("released before the deadline: %v", err)
+	}
+
+	clk.Advance(15 * time.Hour)
+	if err := m.Tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := m.Plan()
+	if !got.Released || !got.ReleasedAt.Equal(clk.Now()) || delivered != 2 {
+		t.Fatalf("released %v at %v with %d shares delivered", got.Released, got.ReleasedAt, delivered)
+	}
+}
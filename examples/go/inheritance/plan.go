@@ -0,0 +1,153 @@
+package inheritance
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/shamir"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Heir is a designated recipient of key shares and assets
+type Heir struct {
+	Address   common.Address `json:"address"`
+	PublicKey hexutil.Bytes  `json:"publicKey"` // uncompressed secp256k1 key used to encrypt the share
+}
+
+// NewHeir creates an heir from a public key
+func NewHeir(pub *ecdsa.PublicKey) Heir {
+	return Heir{
+		Address:   crypto.PubkeyToAddress(*pub),
+		PublicKey: crypto.FromECDSAPub(pub),
+	}
+}
+
+// EncryptedShare is a key share encrypted to one heir
+type EncryptedShare struct {
+	Heir       common.Address `json:"heir"`
+	Ciphertext hexutil.Bytes  `json:"ciphertext"`
+}
+
+// PresignedTransfer is a signed transaction broadcast on release
+type PresignedTransfer struct {
+	Nonce uint64        `json:"nonce"`
+	Raw   hexutil.Bytes `json:"raw"`
+}
+
+// Plan describes what happens when the owner stops checking in
+type Plan struct {
+	Owner         common.Address      `json:"owner"`
+	CheckInPeriod time.Duration       `json:"checkInPeriod"`
+	Threshold     int                 `json:"threshold"`
+	Heirs         []Heir              `json:"heirs"`
+	Shares        []EncryptedShare    `json:"shares"`
+	Transfers     []PresignedTransfer `json:"transfers,omitempty"`
+	LastCheckIn   time.Time           `json:"lastCheckIn"`
+	Released      bool                `json:"released"`
+	ReleasedAt    time.Time           `json:"releasedAt,omitempty"`
+}
+
+// NewPlan splits the owner's key into one share per heir, any threshold of
+// which reconstruct it, and encrypts each share to its heir. The first
+// check-in is dated on clk, nil for the wall clock
+func NewPlan(owner *wallet.Wallet, heirs []Heir, threshold int, checkInPeriod time.Duration, clk clock.Clock) (*Plan, error) {
+	if checkInPeriod <= 0 {
+		return nil, errors.New("check-in period must be positive")
+	}
+	if len(heirs) < 2 {
+		return nil, errors.New("at least two heirs are required")
+	}
+
+	shares, err := shamir.Split(crypto.FromECDSA(owner.PrivateKey), len(heirs), threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Owner:         owner.Address,
+		CheckInPeriod: checkInPeriod,
+		Threshold:     threshold,
+		Heirs:         heirs,
+		LastCheckIn:   clock.Or(clk).Now().UTC(),
+	}
+	for i, heir := range heirs {
+		pub, err := crypto.UnmarshalPubkey(heir.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		ct, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), shares[i], nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		p.Shares = append(p.Shares, EncryptedShare{Heir: heir.Address, Ciphertext: ct})
+	}
+	return p, nil
+}
+
+// Deadline returns when the plan releases unless the owner checks in
+func (p *Plan) Deadline() time.Time {
+	return p.LastCheckIn.Add(p.CheckInPeriod)
+}
+
+// Due reports whether the check-in deadline has passed
+func (p *Plan) Due(now time.Time) bool {
+	return !p.Released && now.After(p.Deadline())
+}
+
+// PresignTransfer signs an ETH transfer to an heir at the given nonce and stores
+// it for release. Any later transaction from the owner at that nonce
+// invalidates it, so transfers should be re-signed after check-ins that
+// follow owner activity.
+func (p *Plan) PresignTransfer(ctx context.Context, owner *wallet.Wallet, to common.Address, amount *big.Int, nonce uint64, gasPrice *big.Int) error {
+	if owner.Address != p.Owner {
+		return errors.New("wallet is not the plan owner")
+	}
+	client, err := owner.Client(ctx)
+	if err != nil {
+		return err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx := types.NewTransaction(nonce, to, amount, 21000, gasPrice, nil)
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(chainID), owner.PrivateKey)
+	if err != nil {
+		return err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	p.Transfers = append(p.Transfers, PresignedTransfer{Nonce: nonce, Raw: raw})
+	return nil
+}
+
+// OpenShare decrypts the share addressed to an heir
+func OpenShare(share EncryptedShare, heirKey *ecdsa.PrivateKey) ([]byte, error) {
+	if crypto.PubkeyToAddress(heirKey.PublicKey) != share.Heir {
+		return nil, errors.New("share is addressed to a different heir")
+	}
+	return ecies.ImportECDSA(heirKey).Decrypt(share.Ciphertext, nil, nil)
+}
+
+// RecoverKey reconstructs the owner's private key from decrypted shares
+func RecoverKey(shares [][]byte) (*ecdsa.PrivateKey, error) {
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.ToECDSA(secret)
+}
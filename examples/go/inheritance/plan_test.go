@@ -0,0 +1,76 @@
+package inheritance
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/shamir"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+func TestPlanRecoversOwnerKey(t *testing.T) {
+	ownerKey, _ := crypto.GenerateKey()
+	owner := &wallet.Wallet{PrivateKey: ownerKey, Address: crypto.PubkeyToAddress(ownerKey.PublicKey)}
+
+	heirKeys := make([]*ecdsa.PrivateKey, 3)
+	heirs := make([]Heir, 3)
+	for i := range heirKeys {
+		heirKeys[i], _ = crypto.GenerateKey()
+		heirs[i] = NewHeir(&heirKeys[i].PublicKey)
+	}
+
+	plan, err := NewPlan(owner, heirs, 2, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened := make([][]byte, len(heirs))
+	for i, share := range plan.Shares {
+		if _, err := OpenShare(share, heirKeys[(i+1)%len(heirKeys)]); err == nil {
+			t.Fatalf("share %d opened by the wrong heir", i)
+		}
+		opened[i], err = OpenShare(share, heirKeys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pair := range [][2]int{{0, 1}, {0, 2}, {1, 2}} {
+		key, err := RecoverKey([][]byte{opened[pair[0]], opened[pair[1]]})
+		if err != nil {
+			t.Fatalf("heirs %v: %v", pair, err)
+		}
+		if crypto.PubkeyToAddress(key.PublicKey) != owner.Address {
+			t.Fatalf("heirs %v recovered the wrong key", pair)
+		}
+	}
+
+	if _, err := RecoverKey(opened[:1]); !errors.Is(err, shamir.ErrTooFewShares) {
+		t.Fatalf("one share: got %v", err)
+	}
+}
+
+func TestPlanDue(t *testing.T) {
+	ownerKey, _ := crypto.GenerateKey()
+	owner := &wallet.Wallet{PrivateKey: ownerKey, Address: crypto.PubkeyToAddress(ownerKey.PublicKey)}
+	a, _ := crypto.GenerateKey()
+	b, _ := crypto.GenerateKey()
+
+	plan, err := NewPlan(owner, []Heir{NewHeir(&a.PublicKey), NewHeir(&b.PublicKey)}, 2, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Due(plan.LastCheckIn.Add(59 * time.Minute)) {
+		t.Fatal("due before the deadline")
+	}
+	if !plan.Due(plan.LastCheckIn.Add(61 * time.Minute)) {
+		t.Fatal("not due after the deadline")
+	}
+	plan.Released = true
+	if plan.Due(plan.LastCheckIn.Add(2 * time.Hour)) {
+		t.Fatal("released plan is due")
+	}
+}
@@ -0,0 +1,55 @@
+package keyregistry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Migrate moves token and ETH balances from a compromised wallet to its
+// successor address. Tokens are moved first while ETH is still available for
+// gas; the remaining ETH is swept last.
+func Migrate(ctx context.Context, old *wallet.Wallet, successor common.Address, tokens []*contract.ERC20) ([]*types.Transaction, error) {
+	client, err := old.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := old.TransactOpts(chainID)
+	if err != nil {
+		return nil, err
+	}
+	auth.Context = ctx
+
+	var txs []*types.Transaction
+	for _, token := range tokens {
+		balance, err := token.BalanceOf(ctx, old.Address)
+		if err != nil {
+			return txs, fmt.Errorf("token %s: %w", token.Address.Hex(), err)
+		}
+		if balance.Sign() == 0 {
+			continue
+		}
+
+		tx, err := token.Transfer(ctx, auth, successor, balance)
+		if err != nil {
+			return txs, fmt.Errorf("token %s: %w", token.Address.Hex(), err)
+		}
+		if tx != nil {
+			txs = append(txs, tx)
+		}
+	}
+
+	tx, err := old.Sweep(ctx, successor)
+	if err != nil {
+		return txs, fmt.Errorf("sweep ETH: %w", err)
+	}
+	return append(txs, tx), nil
+}
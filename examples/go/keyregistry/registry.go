@@ -0,0 +1,153 @@
+package keyregistry
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+)
+
+// registryABIJSON is the ABI of the WhisperChain key registry contract
+const registryABIJSON = `[
+{"type":"function","name":"registerKey","stateMutability":"nonpayable","inputs":[{"name":"messagingKey","type":"bytes"}],"outputs":[]},
+{"type":"function","name":"revokeKey","stateMutability":"nonpayable","inputs":[{"name":"key","type":"address"},{"name":"successor","type":"address"},{"name":"effectiveAt","type":"uint64"},{"name":"payload","type":"bytes"},{"name":"signature","type":"bytes"}],"outputs":[]},
+{"type":"function","name":"keyInfo","stateMutability":"view","inputs":[{"name":"key","type":"address"}],"outputs":[{"name":"","type":"tuple","components":[{"name":"messagingKey","type":"bytes"},{"name":"validFrom","type":"uint64"},{"name":"revokedAt","type":"uint64"},{"name":"successor","type":"address"}]}]},
+{"type":"event","name":"KeyRegistered","anonymous":false,"inputs":[{"name":"key","type":"address","indexed":true},{"name":"messagingKey","type":"bytes","indexed":false}]},
+{"type":"event","name":"KeyRevoked","anonymous":false,"inputs":[{"name":"key","type":"address","indexed":true},{"name":"successor","type":"address","indexed":true},{"name":"effectiveAt","type":"uint64","indexed":false}]}
+]`
+
+var registryABI = mustParseABI(registryABIJSON)
+
+// KeyInfo is the on-chain record for a key
+type KeyInfo struct {
+	MessagingKey []byte
+	ValidFrom    uint64
+	RevokedAt    uint64
+	Successor    common.Address
+}
+
+// Registered reports whether the key has ever been registered
+func (k *KeyInfo) Registered() bool {
+	return k.ValidFrom != 0
+}
+
+// ValidAt reports whether the key was valid at unix time t
+func (k *KeyInfo) ValidAt(t uint64) bool {
+	if !k.Registered() || t < k.ValidFrom {
+		return false
+	}
+	return k.RevokedAt == 0 || t < k.RevokedAt
+}
+
+// Registry wraps the on-chain key registry contract
+type Registry struct {
+	Address  common.Address
+	Client   *ethclient.Client
+	contract *bind.BoundContract
+}
+
+// NewRegistry creates a new Registry instance
+func NewRegistry(address common.Address, client *ethclient.Client) *Registry {
+	return &Registry{
+		Address:  address,
+		Client:   client,
+		contract: bind.NewBoundContract(address, registryABI, client, client, client),
+	}
+}
+
+// RegisterKey publishes the sender's messaging public key
+func (r *Registry) RegisterKey(auth *bind.TransactOpts, messagingKey []byte) (*types.Transaction, error) {
+	return r.contract.Transact(auth, "registerKey", messagingKey)
+}
+
+// RegisterKeyData encodes a registerKey call, for sending it from a smart
+// account; the key is then registered to the account address
+func RegisterKeyData(messagingKey []byte) ([]byte, error) {
+	return registryABI.Pack("registerKey", messagingKey)
+}
+
+// SubmitRevocation records a signed revocation on-chain; any account may relay it
+func (r *Registry) SubmitRevocation(auth *bind.TransactOpts, rev *Revocation) (*types.Transaction, error) {
+	payload, err := rev.SigningPayload()
+	if err != nil {
+		return nil, err
+	}
+	return r.contract.Transact(auth, "revokeKey", rev.Key, rev.Successor, uint64(rev.EffectiveAt), payload, []byte(rev.Signature))
+}
+
+// KeyInfo returns the on-chain record for a key
+func (r *Registry) KeyInfo(ctx context.Context, key common.Address) (*KeyInfo, error) {
+	info, err := contract.Call[KeyInfo](ctx, r.contract, "keyInfo", key)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// KeyEvent is a registration or revocation logged by the registry
+type KeyEvent struct {
+	Key          common.Address
+	Revoked      bool
+	MessagingKey []byte         // registrations only
+	Successor    common.Address // revocations only
+	EffectiveAt  uint64         // revocations only
+	BlockNumber  uint64
+	TxHash       common.Hash
+}
+
+// Events returns the registrations and revocations logged since block start,
+// in log order
+func (r *Registry) Events(ctx context.Context, start uint64) ([]KeyEvent, error) {
+	registered, revoked := registryABI.Events["KeyRegistered"], registryABI.Events["KeyRevoked"]
+	logs, err := r.Client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(start),
+		Addresses: []common.Address{r.Address},
+		Topics:    [][]common.Hash{{registered.ID, revoked.ID}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var events []KeyEvent
+	for _, l := range logs {
+		if l.Removed || len(l.Topics) < 2 {
+			continue
+		}
+		e := KeyEvent{Key: common.BytesToAddress(l.Topics[1].Bytes()), BlockNumber: l.BlockNumber, TxHash: l.TxHash}
+		switch l.Topics[0] {
+		case registered.ID:
+			out, err := registered.Inputs.NonIndexed().Unpack(l.Data)
+			if err != nil {
+				return nil, err
+			}
+			e.MessagingKey, _ = out[0].([]byte)
+		case revoked.ID:
+			if len(l.Topics) < 3 {
+				continue
+			}
+			out, err := revoked.Inputs.NonIndexed().Unpack(l.Data)
+			if err != nil {
+				return nil, err
+			}
+			e.Revoked = true
+			e.Successor = common.BytesToAddress(l.Topics[2].Bytes())
+			e.EffectiveAt, _ = out[0].(uint64)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
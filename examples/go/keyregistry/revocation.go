@@ -0,0 +1,105 @@
+package keyregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// RevocationVersion is the current revocation message format version
+const RevocationVersion = 1
+
+// Revocation is a signed statement that a key must no longer be trusted.
+// It is signed by the compromised key and, when rotating, countersigned by
+// the successor key to prove possession.
+type Revocation struct {
+	Version            int            `json:"version"`
+	Key                common.Address `json:"key"`
+	Successor          common.Address `json:"successor,omitempty"`
+	EffectiveAt        int64          `json:"effectiveAt"`
+	Reason             string         `json:"reason,omitempty"`
+	Signature          hexutil.Bytes  `json:"signature"`
+	SuccessorSignature hexutil.Bytes  `json:"successorSignature,omitempty"`
+}
+
+// NewRevocation creates a revocation of the wallet's key effective at the given
+// time. Signatures made at or after effectiveAt must be rejected by peers; use
+// the suspected compromise time rather than now when known.
+func NewRevocation(compromised *wallet.Wallet, successor *wallet.Wallet, effectiveAt time.Time, reason string) (*Revocation, error) {
+	r := &Revocation{
+		Version:     RevocationVersion,
+		Key:         compromised.Address,
+		EffectiveAt: effectiveAt.Unix(),
+		Reason:      reason,
+	}
+	if successor != nil {
+		r.Successor = successor.Address
+	}
+
+	payload, err := r.SigningPayload()
+	if err != nil {
+		return nil, err
+	}
+	if r.Signature, err = compromised.SignMessage(payload); err != nil {
+		return nil, err
+	}
+	if successor != nil {
+		if r.SuccessorSignature, err = successor.SignMessage(payload); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// SigningPayload returns the canonical bytes covered by both signatures
+func (r *Revocation) SigningPayload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	unsigned.SuccessorSignature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Verify checks the revoked key's signature and, if a successor is named, its
+// proof of possession
+func (r *Revocation) Verify() error {
+	payload, err := r.SigningPayload()
+	if err != nil {
+		return err
+	}
+	if !wallet.VerifySignature(payload, r.Signature, r.Key) {
+		return errors.New("revocation not signed by revoked key")
+	}
+	if r.Successor != (common.Address{}) && !wallet.VerifySignature(payload, r.SuccessorSignature, r.Successor) {
+		return errors.New("revocation not countersigned by successor")
+	}
+	return nil
+}
+
+// Effective returns the time from which the key is revoked
+func (r *Revocation) Effective() time.Time {
+	return time.Unix(r.EffectiveAt, 0)
+}
+
+// Encode serializes the revocation for broadcast
+func (r *Revocation) Encode() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// DecodeRevocation parses and verifies a broadcast revocation
+func DecodeRevocation(data []byte) (*Revocation, error) {
+	var r Revocation
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Version != RevocationVersion {
+		return nil, errors.New("unsupported revocation version")
+	}
+	if err := r.Verify(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,132 @@
+package keyregistry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/relay"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+var (
+	ErrKeyRevoked       = errors.New("keyregistry: key revoked")
+	ErrKeyNotYetValid   = errors.New("keyregistry: key not yet valid")
+	ErrInvalidSignature = errors.New("keyregistry: invalid signature")
+)
+
+// Validator decides whether a key may be trusted at a point in time, combining
+// broadcast revocations with the on-chain registry. Keys that were never
+// registered are trusted unless a revocation for them has been seen.
+type Validator struct {
+	Registry *Registry
+	Clock    clock.Clock // the relay filter's notion of now; nil is the wall clock
+
+	mu          sync.RWMutex
+	revocations map[common.Address]*Revocation
+}
+
+// NewValidator creates a validator; registry may be nil to rely on broadcasts only
+func NewValidator(registry *Registry) *Validator {
+	return &Validator{
+		Registry:    registry,
+		revocations: make(map[common.Address]*Revocation),
+	}
+}
+
+// Accept verifies and records a broadcast revocation, keeping the earliest
+// effective time seen for a key
+func (v *Validator) Accept(rev *Revocation) error {
+	if err := rev.Verify(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if existing, ok := v.revocations[rev.Key]; ok && existing.EffectiveAt <= rev.EffectiveAt {
+		return nil
+	}
+	v.revocations[rev.Key] = rev
+	return nil
+}
+
+// Successor returns the key that replaced a revoked key, if any
+func (v *Validator) Successor(key common.Address) (common.Address, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	rev, ok := v.revocations[key]
+	if !ok || rev.Successor == (common.Address{}) {
+		return common.Address{}, false
+	}
+	return rev.Successor, true
+}
+
+// Check returns an error if key was not valid at time at
+func (v *Validator) Check(ctx context.Context, key common.Address, at time.Time) error {
+	v.mu.RLock()
+	rev, ok := v.revocations[key]
+	v.mu.RUnlock()
+
+	if ok && at.Unix() >= rev.EffectiveAt {
+		return ErrKeyRevoked
+	}
+
+	if v.Registry == nil {
+		return nil
+	}
+	info, err := v.Registry.KeyInfo(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !info.Registered() {
+		return nil
+	}
+
+	t := uint64(at.Unix())
+	if t < info.ValidFrom {
+		return ErrKeyNotYetValid
+	}
+	if !info.ValidAt(t) {
+		return ErrKeyRevoked
+	}
+	return nil
+}
+
+// VerifySignature checks a message signature and that the signing key was
+// valid at signedAt
+func (v *Validator) VerifySignature(ctx context.Context, message, signature []byte, key common.Address, signedAt time.Time) error {
+	if !wallet.VerifySignature(message, signature, key) {
+		return ErrInvalidSignature
+	}
+	return v.Check(ctx, key, signedAt)
+}
+
+// RelayFilter returns a relay filter that rejects envelopes from keys that are
+// revoked now. The relay's clock is used instead of the envelope timestamp,
+// which a holder of a leaked key could backdate.
+func (v *Validator) RelayFilter() relay.Filter {
+	return keyFilter{v}
+}
+
+type keyFilter struct {
+	v *Validator
+}
+
+func (f keyFilter) Name() string { return "key-validity" }
+
+func (f keyFilter) Check(ctx context.Context, stage relay.Stage, env *messaging.Envelope) (relay.Decision, error) {
+	err := f.v.Check(ctx, env.Sender, clock.Or(f.v.Clock).Now())
+	if errors.Is(err, ErrKeyRevoked) || errors.Is(err, ErrKeyNotYetValid) {
+		return relay.Reject("sender key: %v", err), nil
+	}
+	if err != nil {
+		return relay.Decision{}, err
+	}
+	return relay.Allow, nil
+}
@@ -0,0 +1,115 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/server"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// Action is one kind of request a simulated wallet makes
+type Action struct {
+	Name   string
+	Weight int // relative frequency; zero is 1
+	Do     func(ctx context.Context, w *Worker) error
+}
+
+// StatusError is an HTTP response outside 2xx
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("loadtest: http %d: %s", e.Code, e.Message)
+}
+
+// Message seals a short text message to another simulated wallet, chosen at
+// random, and submits it through sender, such as a relay in relay mode
+func Message(sender messaging.Sender, topic string, size int) Action {
+	return Action{Name: "message", Do: func(ctx context.Context, w *Worker) error {
+		to := w.Peer()
+		text := strings.Repeat("x", size)
+		msg, err := messaging.NewMessage("text", text)
+		if err != nil {
+			return err
+		}
+		env, err := messaging.SealMessage(w.Wallet, to.Wallet.PublicKey, topic, msg)
+		if err != nil {
+			return err
+		}
+		return sender.Send(ctx, env)
+	}}
+}
+
+// HTTP targets a deployment in server mode
+type HTTP struct {
+	BaseURL string
+	Client  *http.Client
+	// Keys are API keys handed to simulated wallets round-robin, so load
+	// spreads across principals as real clients would
+	Keys []string
+}
+
+// Get requests path, such as /v1/balance or /v1/public/messages?address=
+func (h *HTTP) Get(name, path string) Action {
+	return Action{Name: name, Do: func(ctx context.Context, w *Worker) error {
+		return h.do(ctx, w, http.MethodGet, path, nil)
+	}}
+}
+
+// Transfer posts amount wei transfers to to through POST /v1/transfer. Every
+// request sends real funds from the deployment's wallet; use a testnet
+func (h *HTTP) Transfer(to common.Address, amount units.Wei) Action {
+	return Action{Name: "transfer", Do: func(ctx context.Context, w *Worker) error {
+		return h.do(ctx, w, http.MethodPost, "/v1/transfer", server.TransferRequest{To: to.Hex(), Amount: amount.String()})
+	}}
+}
+
+func (h *HTTP) do(ctx context.Context, w *Worker, method, path string, body interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(h.BaseURL, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(h.Keys) > 0 {
+		req.Header.Set("X-API-Key", h.Keys[w.ID%len(h.Keys)])
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		var e server.ErrorResponse
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		return &StatusError{Code: resp.StatusCode, Message: msg}
+	}
+	return nil
+}
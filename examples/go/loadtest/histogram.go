@@ -0,0 +1,45 @@
+package loadtest
+
+import "time"
+
+// bucketBounds are the upper bounds of the latency histogram buckets; a
+// final bucket holds everything slower
+var bucketBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+}
+
+// Bucket counts requests completing within UpTo and above the previous
+// bucket's bound; the last bucket has no bound
+type Bucket struct {
+	UpTo  time.Duration `json:"upTo,omitempty"`
+	Count int           `json:"count"`
+}
+
+// Histogram counts latencies in fixed exponential buckets, so runs of any
+// size take the same memory and reports from different runs line up
+type Histogram struct {
+	Buckets []Bucket `json:"buckets"`
+}
+
+// NewHistogram creates an empty histogram
+func NewHistogram() *Histogram {
+	h := &Histogram{Buckets: make([]Bucket, len(bucketBounds)+1)}
+	for i, b := range bucketBounds {
+		h.Buckets[i].UpTo = b
+	}
+	return h
+}
+
+// Observe counts one latency
+func (h *Histogram) Observe(d time.Duration) {
+	for i, b := range bucketBounds {
+		if d <= b {
+			h.Buckets[i].Count++
+			return
+		}
+	}
+	h.Buckets[len(h.Buckets)-1].Count++
+}
@@ -0,0 +1,302 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/whisperchain/go-examples/bench"
+	"github.com/whisperchain/go-examples/relay"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Worker is one simulated wallet
+type Worker struct {
+	ID     int
+	Wallet *wallet.Wallet // a fresh key; it holds no funds and has no client
+	Rand   *rand.Rand
+
+	peers []*Worker
+}
+
+// Peer returns another simulated wallet at random, itself when alone
+func (w *Worker) Peer() *Worker {
+	if len(w.peers) < 2 {
+		return w
+	}
+	for {
+		if p := w.peers[w.Rand.Intn(len(w.peers))]; p != w {
+			return p
+		}
+	}
+}
+
+// Harness simulates concurrent wallets acting against a deployment
+type Harness struct {
+	Wallets  int           // concurrent simulated wallets; zero is 10
+	Duration time.Duration // zero is one minute
+	Rampup   time.Duration // wallets start evenly spread over this period
+	// Rate is the actions per second each wallet attempts; zero acts as fast
+	// as responses allow
+	Rate    float64
+	Timeout time.Duration // per action; zero is 30 seconds
+	Actions []Action
+	Seed    int64 // seeds action choice, so runs pick the same sequence
+}
+
+// ActionReport is the outcome of one kind of action
+type ActionReport struct {
+	Action     string         `json:"action"`
+	Requests   int            `json:"requests"`
+	Errors     int            `json:"errors"`
+	Latency    bench.Latency  `json:"latency"` // of successful requests
+	Histogram  *Histogram     `json:"histogram"`
+	Throughput float64        `json:"throughput"`         // successful requests per second
+	Failures   map[string]int `json:"failures,omitempty"` // errors by Classify
+}
+
+// Report is the outcome of a load test
+type Report struct {
+	Wallets int            `json:"wallets"`
+	Started time.Time      `json:"started"`
+	Elapsed time.Duration  `json:"elapsed"`
+	Actions []ActionReport `json:"actions"`
+}
+
+// Run simulates the wallets until Duration passes or ctx is done
+func (h *Harness) Run(ctx context.Context) (*Report, error) {
+	if len(h.Actions) == 0 {
+		return nil, errors.New("loadtest: no actions")
+	}
+	wallets := h.Wallets
+	if wallets <= 0 {
+		wallets = 10
+	}
+	duration := h.Duration
+	if duration <= 0 {
+		duration = time.Minute
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	totalWeight := 0
+	for _, a := range h.Actions {
+		totalWeight += weight(a)
+	}
+
+	workers := make([]*Worker, wallets)
+	for i := range workers {
+		key, err := wallet.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		workers[i] = &Worker{ID: i, Wallet: wallet.NewWalletFromClient(key, nil), Rand: rand.New(rand.NewSource(h.Seed + int64(i)))}
+	}
+	for _, w := range workers {
+		w.peers = workers
+	}
+
+	rec := newRecorder(h.Actions)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		wg.Add(1)
+		go func(i int, w *Worker) {
+			defer wg.Done()
+			if h.Rampup > 0 && !sleep(ctx, h.Rampup*time.Duration(i)/time.Duration(wallets)) {
+				return
+			}
+			var interval time.Duration
+			if h.Rate > 0 {
+				interval = time.Duration(float64(time.Second) / h.Rate)
+			}
+			for next := time.Now(); ctx.Err() == nil; {
+				a := pick(h.Actions, totalWeight, w.Rand)
+				actx, acancel := context.WithTimeout(ctx, timeout)
+				t := time.Now()
+				err := a.Do(actx, w)
+				d := time.Since(t)
+				acancel()
+				if ctx.Err() != nil && err != nil {
+					return // cut off by the end of the run, not a failure
+				}
+				rec.observe(a.Name, d, err)
+				if interval > 0 {
+					next = next.Add(interval)
+					if !sleep(ctx, time.Until(next)) {
+						return
+					}
+				}
+			}
+		}(i, w)
+	}
+	wg.Wait()
+	return rec.report(wallets, start, time.Since(start)), nil
+}
+
+// Classify names the kind of failure err is, for failure breakdowns
+func Classify(err error) string {
+	var status *StatusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &status):
+		return "http " + strconv.Itoa(status.Code)
+	case errors.Is(err, relay.ErrInvalidEnvelope):
+		return "invalid envelope"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	msg := err.Error()
+	if len(msg) > 80 {
+		msg = msg[:80]
+	}
+	return "other: " + msg
+}
+
+type recorder struct {
+	mu      sync.Mutex
+	order   []string
+	actions map[string]*actionRecord
+}
+
+type actionRecord struct {
+	report  ActionReport
+	samples []time.Duration
+}
+
+func newRecorder(actions []Action) *recorder {
+	r := &recorder{actions: make(map[string]*actionRecord)}
+	for _, a := range actions {
+		if _, ok := r.actions[a.Name]; !ok {
+			r.order = append(r.order, a.Name)
+			r.actions[a.Name] = &actionRecord{report: ActionReport{Action: a.Name, Histogram: NewHistogram(), Failures: make(map[string]int)}}
+		}
+	}
+	return r
+}
+
+func (r *recorder) observe(name string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a := r.actions[name]
+	a.report.Requests++
+	if err != nil {
+		a.report.Errors++
+		a.report.Failures[Classify(err)]++
+		return
+	}
+	a.samples = append(a.samples, d)
+	a.report.Histogram.Observe(d)
+}
+
+func (r *recorder) report(wallets int, start time.Time, elapsed time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := &Report{Wallets: wallets, Started: start.UTC(), Elapsed: elapsed}
+	for _, name := range r.order {
+		a := r.actions[name]
+		a.report.Latency = bench.Summarize(a.samples)
+		if elapsed > 0 {
+			a.report.Throughput = float64(len(a.samples)) / elapsed.Seconds()
+		}
+		rep.Actions = append(rep.Actions, a.report)
+	}
+	return rep
+}
+
+// FailureKinds returns an action's failure kinds, most frequent first
+func (a *ActionReport) FailureKinds() []string {
+	kinds := make([]string, 0, len(a.Failures))
+	for k := range a.Failures {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if a.Failures[kinds[i]] != a.Failures[kinds[j]] {
+			return a.Failures[kinds[i]] > a.Failures[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	return kinds
+}
+
+func pick(actions []Action, total int, rng *rand.Rand) Action {
+	n := rng.Intn(total)
+	for _, a := range actions {
+		if n -= weight(a); n < 0 {
+			return a
+		}
+	}
+	return actions[len(actions)-1]
+}
+
+func weight(a Action) int {
+	if a.Weight <= 0 {
+		return 1
+	}
+	return a.Weight
+}
+
+// sleep waits for d, reporting false when ctx ended first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// WriteText writes a summary per action, its latency histogram and its
+// failure breakdown
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d wallets for %s\n\n", r.Wallets, r.Elapsed.Round(time.Second))
+	fmt.Fprintln(tw, "ACTION\tREQS\tERRORS\tMEAN\tP50\tP90\tP99\tMAX\tREQ/S")
+	for _, a := range r.Actions {
+		l := a.Latency
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%.1f\n", a.Action, a.Requests, a.Errors,
+			round(l.Mean), round(l.P50), round(l.P90), round(l.P99), round(l.Max), a.Throughput)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, a := range r.Actions {
+		fmt.Fprintf(w, "\n%s latency\n", a.Action)
+		for _, b := range a.Histogram.Buckets {
+			if b.Count == 0 {
+				continue
+			}
+			bound := "> " + bucketBounds[len(bucketBounds)-1].String()
+			if b.UpTo > 0 {
+				bound = "<= " + b.UpTo.String()
+			}
+			fmt.Fprintf(w, "  %-8s %d\n", bound, b.Count)
+		}
+		for _, kind := range a.FailureKinds() {
+			fmt.Fprintf(w, "  failed: %s x%d\n", kind, a.Failures[kind])
+		}
+	}
+	return nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
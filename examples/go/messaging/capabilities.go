@@ -0,0 +1,348 @@
+package messaging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// MessageHello carries a peer's Capabilities, sent when peers first talk
+const MessageHello = "hello"
+
+// SuiteECIES is the only encryption suite so far: ECIES over secp256k1 with
+// AES-128-CTR and HMAC-SHA256, as geth's ecies package implements it
+const SuiteECIES = "ecies-secp256k1-aes128ctr-hmacsha256"
+
+// Compression schemes for envelope plaintexts
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+)
+
+// Features a peer can advertise
+const (
+	FeatureReceipts = "receipts" // answers with delivery receipts
+	FeatureOrdering = "ordering" // stamps topic messages with an Order
+	FeatureResend   = "resend"   // answers resend requests
+)
+
+// maxPlaintext bounds decompression of an envelope
+const maxPlaintext = 16 << 20
+
+var (
+	// ErrUnsupportedVersion is returned for envelopes of a version this build
+	// cannot read
+	ErrUnsupportedVersion = errors.New("messaging: unsupported envelope version")
+	// ErrIncompatible is returned when two peers share no version or suite
+	ErrIncompatible = errors.New("messaging: peers have no protocol in common")
+	// ErrUnknownCompression is returned for envelopes compressed with a
+	// scheme this build does not know
+	ErrUnknownCompression = errors.New("messaging: unknown compression")
+	// ErrFeatureExists is returned when registering a feature twice
+	ErrFeatureExists = errors.New("messaging: feature already registered")
+)
+
+// SupportedVersions are the envelope versions this build reads, newest last
+var SupportedVersions = []int{EnvelopeVersion}
+
+func supportsVersion(v int) bool {
+	for _, s := range SupportedVersions {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities is what a peer can speak. Lists are in order of preference
+type Capabilities struct {
+	Versions    []int    `json:"versions"`
+	Suites      []string `json:"suites"`
+	Compression []string `json:"compression,omitempty"`
+	Features    []string `json:"features,omitempty"`
+}
+
+// Legacy is what a peer that never sent a hello is assumed to speak: the
+// first envelope version, no compression and no optional features
+var Legacy = Capabilities{Versions: []int{1}, Suites: []string{SuiteECIES}}
+
+// Agreement is what two peers settled on; each uses it for what it sends to
+// the other
+type Agreement struct {
+	Version     int      `json:"version"`
+	Suite       string   `json:"suite"`
+	Compression string   `json:"compression,omitempty"`
+	Features    []string `json:"features,omitempty"` // both support these, sorted
+}
+
+// Negotiate agrees on the newest common envelope version, local's most
+// preferred common suite and compression, and the features both support
+func Negotiate(local, remote Capabilities) (Agreement, error) {
+	var a Agreement
+	for _, v := range local.Versions {
+		if v > a.Version && containsInt(remote.Versions, v) {
+			a.Version = v
+		}
+	}
+	for _, s := range local.Suites {
+		if contains(remote.Suites, s) {
+			a.Suite = s
+			break
+		}
+	}
+	if a.Version == 0 || a.Suite == "" {
+		return Agreement{}, fmt.Errorf("%w: versions %v and %v, suites %v and %v", ErrIncompatible, local.Versions, remote.Versions, local.Suites, remote.Suites)
+	}
+	for _, c := range local.Compression {
+		if contains(remote.Compression, c) {
+			a.Compression = c
+			break
+		}
+	}
+	for _, f := range local.Features {
+		if contains(remote.Features, f) {
+			a.Features = append(a.Features, f)
+		}
+	}
+	sort.Strings(a.Features)
+	return a, nil
+}
+
+// Supports reports whether both peers support a feature
+func (a Agreement) Supports(feature string) bool {
+	return contains(a.Features, feature)
+}
+
+// Seal seals plaintext for the peer the agreement is with, compressing it
+// when the peer accepts compression
+func (a Agreement) Seal(w *wallet.Wallet, to *ecdsa.PublicKey, topic string, order *Order, plaintext []byte, attachments ...Attachment) (*Envelope, error) {
+	if !a.Supports(FeatureOrdering) {
+		order = nil
+	}
+	return seal(w, to, topic, order, a.Compression, plaintext, attachments)
+}
+
+// Feature is an optional protocol behaviour that can be rolled out
+// gradually: it is only used with peers that advertise it too
+type Feature struct {
+	Name        string
+	Description string
+	MinVersion  int  // envelope version it needs; zero is any
+	Enabled     bool // advertised in hellos
+}
+
+// Registry is the protocol configuration of this peer and what it agreed
+// with each peer it has heard from. Other modules consult it before using
+// an optional feature with a peer, so a change ships to new peers without
+// breaking old ones. It is safe for concurrent use
+type Registry struct {
+	mu          sync.RWMutex
+	versions    []int
+	suites      []string
+	compression []string
+	features    map[string]*Feature
+	peers       map[common.Address]Agreement
+}
+
+// NewRegistry creates a registry with this build's versions, suite and
+// compression, and its features enabled
+func NewRegistry() *Registry {
+	r := &Registry{
+		versions:    append([]int(nil), SupportedVersions...),
+		suites:      []string{SuiteECIES},
+		compression: []string{CompressionGzip},
+		features:    make(map[string]*Feature),
+		peers:       make(map[common.Address]Agreement),
+	}
+	for _, f := range []Feature{
+		{Name: FeatureReceipts, Description: "delivery receipts", Enabled: true},
+		{Name: FeatureOrdering, Description: "causal ordering of topic messages", Enabled: true},
+		{Name: FeatureResend, Description: "resend requests for missing messages", Enabled: true},
+	} {
+		f := f
+		r.features[f.Name] = &f
+	}
+	return r
+}
+
+// Register adds a feature
+func (r *Registry) Register(f Feature) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.features[f.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrFeatureExists, f.Name)
+	}
+	r.features[f.Name] = &f
+	return nil
+}
+
+// SetEnabled turns advertising a feature on or off; agreements already made
+// keep it until the peers exchange hellos again
+func (r *Registry) SetEnabled(name string, enabled bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.features[name]
+	if ok {
+		f.Enabled = enabled
+	}
+	return ok
+}
+
+// Features returns the registered features sorted by name
+func (r *Registry) Features() []Feature {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Feature, 0, len(r.features))
+	for _, f := range r.features {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Capabilities returns what this peer advertises
+func (r *Registry) Capabilities() Capabilities {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := Capabilities{
+		Versions:    append([]int(nil), r.versions...),
+		Suites:      append([]string(nil), r.suites...),
+		Compression: append([]string(nil), r.compression...),
+	}
+	newest := 0
+	for _, v := range r.versions {
+		if v > newest {
+			newest = v
+		}
+	}
+	for _, f := range r.features {
+		if f.Enabled && f.MinVersion <= newest {
+			c.Features = append(c.Features, f.Name)
+		}
+	}
+	sort.Strings(c.Features)
+	return c
+}
+
+// SendHello advertises this peer's capabilities to another peer
+func (r *Registry) SendHello(ctx context.Context, w *wallet.Wallet, sender Sender, to *ecdsa.PublicKey, topic string) error {
+	msg, err := NewMessage(MessageHello, r.Capabilities())
+	if err != nil {
+		return err
+	}
+	env, err := SealMessage(w, to, topic, msg)
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, env)
+}
+
+// Accept negotiates with a peer's capabilities from a hello that arrived in
+// env and records the agreement for the envelope's signer. Features whose
+// MinVersion is above the agreed version are left out
+func (r *Registry) Accept(env *Envelope, remote Capabilities) (Agreement, error) {
+	a, err := Negotiate(r.Capabilities(), remote)
+	if err != nil {
+		return Agreement{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := a.Features[:0]
+	for _, name := range a.Features {
+		if f := r.features[name]; f != nil && f.MinVersion <= a.Version {
+			kept = append(kept, name)
+		}
+	}
+	a.Features = kept
+	r.peers[env.Sender] = a
+	return a, nil
+}
+
+// Peer returns the agreement with a peer, or the one negotiated with Legacy
+// when it has not sent a hello
+func (r *Registry) Peer(addr common.Address) Agreement {
+	r.mu.RLock()
+	a, ok := r.peers[addr]
+	r.mu.RUnlock()
+	if ok {
+		return a
+	}
+	a, err := Negotiate(r.Capabilities(), Legacy)
+	if err != nil {
+		return Agreement{Version: 1, Suite: SuiteECIES}
+	}
+	return a
+}
+
+// Supports reports whether a feature may be used with a peer
+func (r *Registry) Supports(addr common.Address, feature string) bool {
+	return r.Peer(addr).Supports(feature)
+}
+
+// compress applies a compression scheme to a plaintext
+func compress(scheme string, plaintext []byte) ([]byte, error) {
+	switch scheme {
+	case CompressionNone:
+		return plaintext, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(plaintext); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCompression, scheme)
+}
+
+// decompress reverses compress, refusing plaintexts over maxPlaintext
+func decompress(scheme string, body []byte) ([]byte, error) {
+	switch scheme {
+	case CompressionNone:
+		return body, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := io.ReadAll(io.LimitReader(zr, maxPlaintext+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(plaintext) > maxPlaintext {
+			return nil, errors.New("messaging: plaintext too large")
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCompression, scheme)
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
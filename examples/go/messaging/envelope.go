@@ -0,0 +1,187 @@
+package messaging
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// EnvelopeVersion is the current envelope format version
+const EnvelopeVersion = 1
+
+// Attachment describes an encrypted attachment; only metadata is visible to relays
+type Attachment struct {
+	Type string      `json:"type"`
+	Size int         `json:"size"`
+	Hash common.Hash `json:"hash"`
+}
+
+// Envelope is the signed wire format of an encrypted WhisperChain message
+type Envelope struct {
+	Version     int            `json:"version"`
+	ID          common.Hash    `json:"id"`
+	Topic       string         `json:"topic"`
+	Sender      common.Address `json:"sender"`
+	Recipient   common.Address `json:"recipient"`
+	Timestamp   int64          `json:"timestamp"`
+	Attachments []Attachment   `json:"attachments,omitempty"`
+	Order       *Order         `json:"order,omitempty"`       // set on envelopes of an ordered topic
+	Compression string         `json:"compression,omitempty"` // applied to the plaintext before encryption; empty is none
+	Ciphertext  hexutil.Bytes  `json:"ciphertext"`
+	Signature   hexutil.Bytes  `json:"signature"`
+}
+
+// Seal encrypts plaintext to the recipient key and signs the envelope
+func Seal(w *wallet.Wallet, to *ecdsa.PublicKey, topic string, plaintext []byte, attachments ...Attachment) (*Envelope, error) {
+	return SealOrdered(w, to, topic, nil, plaintext, attachments...)
+}
+
+// SealOrdered is Seal with ordering metadata from a Timeline, covered by the
+// signature. A message to several recipients is sealed once per recipient
+// with the same order
+func SealOrdered(w *wallet.Wallet, to *ecdsa.PublicKey, topic string, order *Order, plaintext []byte, attachments ...Attachment) (*Envelope, error) {
+	return seal(w, to, topic, order, CompressionNone, plaintext, attachments)
+}
+
+// seal compresses, encrypts and signs an envelope
+func seal(w *wallet.Wallet, to *ecdsa.PublicKey, topic string, order *Order, compression string, plaintext []byte, attachments []Attachment) (*Envelope, error) {
+	body, err := compress(compression, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(to), body, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &Envelope{
+		Version:     EnvelopeVersion,
+		Topic:       topic,
+		Sender:      w.Address,
+		Recipient:   crypto.PubkeyToAddress(*to),
+		Timestamp:   time.Now().Unix(),
+		Attachments: attachments,
+		Order:       order,
+		Compression: compression,
+		Ciphertext:  ciphertext,
+	}
+	if err := env.Sign(w); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// Open decrypts the envelope payload with the recipient's private key
+func (e *Envelope) Open(key *ecdsa.PrivateKey) ([]byte, error) {
+	body, err := ecies.ImportECDSA(key).Decrypt(e.Ciphertext, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(e.Compression, body)
+}
+
+// SigningPayload returns the canonical bytes covered by the ID and signature
+func (e *Envelope) SigningPayload() ([]byte, error) {
+	unsigned := *e
+	unsigned.ID = common.Hash{}
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Hash computes the envelope ID from its signed content
+func (e *Envelope) Hash() (common.Hash, error) {
+	payload, err := e.SigningPayload()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(payload), nil
+}
+
+// Sign sets the envelope ID and signature using the sender's wallet
+func (e *Envelope) Sign(w *wallet.Wallet) error {
+	if e.Sender != w.Address {
+		return errors.New("wallet is not the envelope sender")
+	}
+
+	payload, err := e.SigningPayload()
+	if err != nil {
+		return err
+	}
+	sig, err := w.SignMessage(payload)
+	if err != nil {
+		return err
+	}
+
+	e.ID = crypto.Keccak256Hash(payload)
+	e.Signature = sig
+	return nil
+}
+
+// Verify checks the envelope ID and the sender's signature
+func (e *Envelope) Verify() bool {
+	payload, err := e.SigningPayload()
+	if err != nil {
+		return false
+	}
+	if crypto.Keccak256Hash(payload) != e.ID {
+		return false
+	}
+	return wallet.VerifySignature(payload, e.Signature, e.Sender)
+}
+
+// SenderKey recovers the sender's public key from the signature so replies
+// can be sealed without a key lookup
+func (e *Envelope) SenderKey() (*ecdsa.PublicKey, error) {
+	payload, err := e.SigningPayload()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := crypto.SigToPub(crypto.Keccak256(payload), e.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.PubkeyToAddress(*pub) != e.Sender {
+		return nil, errors.New("signature does not match sender")
+	}
+	return pub, nil
+}
+
+// ContentHash returns the hash of the ciphertext, used for blocklists
+func (e *Envelope) ContentHash() common.Hash {
+	return crypto.Keccak256Hash(e.Ciphertext)
+}
+
+// Size returns the total encrypted payload size including attachments
+func (e *Envelope) Size() int {
+	size := len(e.Ciphertext)
+	for _, a := range e.Attachments {
+		size += a.Size
+	}
+	return size
+}
+
+// Encode serializes the envelope
+func (e *Envelope) Encode() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// DecodeEnvelope parses a serialized envelope
+func DecodeEnvelope(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if !supportsVersion(e.Version) {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.Version)
+	}
+	return &e, nil
+}
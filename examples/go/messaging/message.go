@@ -0,0 +1,61 @@
+package messaging
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Message is the typed plaintext carried inside an envelope
+type Message struct {
+	Type string          `json:"type"`
+	Body json.RawMessage `json:"body"`
+}
+
+// NewMessage creates a message of the given type with a JSON body
+func NewMessage(typ string, body interface{}) (*Message, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Type: typ, Body: raw}, nil
+}
+
+// Decode unmarshals the message body into v
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Body, v)
+}
+
+// SealMessage encodes msg and seals it into an envelope for the recipient
+func SealMessage(w *wallet.Wallet, to *ecdsa.PublicKey, topic string, msg *Message) (*Envelope, error) {
+	return SealOrderedMessage(w, to, topic, nil, msg)
+}
+
+// SealOrderedMessage is SealMessage with ordering metadata from a Timeline
+func SealOrderedMessage(w *wallet.Wallet, to *ecdsa.PublicKey, topic string, order *Order, msg *Message) (*Envelope, error) {
+	plaintext, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return SealOrdered(w, to, topic, order, plaintext)
+}
+
+// OpenMessage decrypts an envelope and decodes its typed message
+func OpenMessage(env *Envelope, key *ecdsa.PrivateKey) (*Message, error) {
+	plaintext, err := env.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	var msg Message
+	if err := json.Unmarshal(plaintext, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Sender submits envelopes to the network, e.g. a relay client
+type Sender interface {
+	Send(ctx context.Context, env *Envelope) error
+}
@@ -0,0 +1,266 @@
+package messaging
+
+import (
+	"crypto/ecdsa"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/clock"
+)
+
+// Reasons a relay drops an envelope, kept few so they make usable labels
+const (
+	DropInvalid   = "invalid"   // bad ID or signature
+	DropModerated = "moderated" // rejected by a moderation filter
+	DropStore     = "store"     // could not be stored
+	DropForward   = "forward"   // stored but not forwarded
+)
+
+// latencyBounds are the upper bounds of the latency buckets; a final bucket
+// holds everything slower
+var latencyBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+	30 * time.Second, time.Minute, 5 * time.Minute,
+}
+
+// Latency summarizes a latency series. Percentiles are the upper bound of
+// the bucket they fall in, so they over-report by at most one bucket
+type Latency struct {
+	Count uint64        `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// MetricsSnapshot is the state of the messaging series at one moment
+type MetricsSnapshot struct {
+	// Delivery is the time from sending an envelope to its receipt arriving
+	Delivery Latency `json:"delivery"`
+	// AwaitingReceipt counts sent envelopes whose receipt has not arrived
+	AwaitingReceipt int `json:"awaitingReceipt"`
+	// Unacknowledged counts envelopes whose receipt did not arrive within
+	// the receipt timeout
+	Unacknowledged uint64            `json:"unacknowledged"`
+	Relayed        uint64            `json:"relayed"`
+	Dropped        map[string]uint64 `json:"dropped"` // by reason
+	// DropRate is the share of envelopes reaching the relay that it dropped
+	DropRate float64 `json:"dropRate"`
+	// OpenFailures counts received envelopes that could not be decrypted or
+	// decoded, the sign of a sender using a stale or wrong key
+	OpenFailures uint64  `json:"openFailures"`
+	StoreQuery   Latency `json:"storeQuery"`
+}
+
+// Metrics collects the messaging series operators put SLOs on: delivery
+// latency measured by receipts, the relay drop rate, envelopes that fail to
+// open and store query latency. Senders call Sent and open incoming
+// envelopes with OpenMessage; relays count what they relay and drop. It is
+// safe for concurrent use
+type Metrics struct {
+	ReceiptTimeout time.Duration // envelopes unacknowledged this long stop being tracked; zero is 10 minutes
+	MaxPending     int           // envelopes tracked at once; zero is 10000
+	Clock          clock.Clock
+
+	mu             sync.Mutex
+	pending        map[common.Hash]time.Time
+	delivery       histogram
+	storeQuery     histogram
+	unacknowledged uint64
+	relayed        uint64
+	dropped        map[string]uint64
+	openFailures   uint64
+}
+
+// NewMetrics creates empty messaging metrics
+func NewMetrics() *Metrics {
+	return &Metrics{pending: make(map[common.Hash]time.Time), dropped: make(map[string]uint64)}
+}
+
+// Sent starts the delivery clock for an envelope. The latency is measured
+// on the sender's clock, so skew between sender and recipient does not
+// affect it. Envelopes sent while MaxPending are awaiting receipts are not
+// measured
+func (m *Metrics) Sent(env *Envelope) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := clock.Or(m.Clock).Now()
+	m.expire(now)
+	if len(m.pending) >= m.maxPending() {
+		return
+	}
+	if m.pending == nil {
+		m.pending = make(map[common.Hash]time.Time)
+	}
+	m.pending[env.ID] = now
+}
+
+// Delivered stops the delivery clock for the envelope a receipt
+// acknowledges and returns its latency. Receipts for envelopes not being
+// tracked, including duplicates, are ignored
+func (m *Metrics) Delivered(r *Receipt) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sent, ok := m.pending[r.EnvelopeID]
+	if !ok {
+		return 0, false
+	}
+	delete(m.pending, r.EnvelopeID)
+	latency := clock.Or(m.Clock).Now().Sub(sent)
+	m.delivery.observe(latency)
+	return latency, true
+}
+
+// OpenMessage opens an envelope like the package function, counting
+// envelopes that fail to open and recording the delivery of any receipt
+func (m *Metrics) OpenMessage(env *Envelope, key *ecdsa.PrivateKey) (*Message, error) {
+	msg, err := OpenMessage(env, key)
+	if err != nil {
+		m.mu.Lock()
+		m.openFailures++
+		m.mu.Unlock()
+		return nil, err
+	}
+	if msg.Type == MessageReceipt {
+		var r Receipt
+		if msg.Decode(&r) == nil {
+			m.Delivered(&r)
+		}
+	}
+	return msg, nil
+}
+
+// Relayed counts an envelope the relay stored and forwarded
+func (m *Metrics) Relayed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.relayed++
+}
+
+// Dropped counts an envelope the relay did not deliver, by one of the Drop
+// reasons
+func (m *Metrics) Dropped(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dropped == nil {
+		m.dropped = make(map[string]uint64)
+	}
+	m.dropped[reason]++
+}
+
+// StoreQuery records how long a query of stored envelopes took
+func (m *Metrics) StoreQuery(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storeQuery.observe(d)
+}
+
+// Snapshot returns the current state of every series
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(clock.Or(m.Clock).Now())
+	s := MetricsSnapshot{
+		Delivery:        m.delivery.summary(),
+		AwaitingReceipt: len(m.pending),
+		Unacknowledged:  m.unacknowledged,
+		Relayed:         m.relayed,
+		Dropped:         make(map[string]uint64, len(m.dropped)),
+		OpenFailures:    m.openFailures,
+		StoreQuery:      m.storeQuery.summary(),
+	}
+	var dropped uint64
+	for reason, n := range m.dropped {
+		s.Dropped[reason] = n
+		dropped += n
+	}
+	if total := dropped + m.relayed; total > 0 {
+		s.DropRate = float64(dropped) / float64(total)
+	}
+	return s
+}
+
+// expire stops tracking envelopes past the receipt timeout; m.mu must be held
+func (m *Metrics) expire(now time.Time) {
+	timeout := m.ReceiptTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	for id, sent := range m.pending {
+		if now.Sub(sent) >= timeout {
+			delete(m.pending, id)
+			m.unacknowledged++
+		}
+	}
+}
+
+func (m *Metrics) maxPending() int {
+	if m.MaxPending <= 0 {
+		return 10000
+	}
+	return m.MaxPending
+}
+
+// histogram counts latencies in fixed exponential buckets, so it takes the
+// same memory however long the process runs
+type histogram struct {
+	counts []uint64
+	n      uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBounds)+1)
+	}
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.n++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *histogram) summary() Latency {
+	if h.n == 0 {
+		return Latency{}
+	}
+	return Latency{
+		Count: h.n,
+		Mean:  h.sum / time.Duration(h.n),
+		P50:   h.percentile(0.50),
+		P90:   h.percentile(0.90),
+		P99:   h.percentile(0.99),
+		Max:   h.max,
+	}
+}
+
+// percentile returns the upper bound of the bucket holding the nearest-rank
+// percentile, capped at the largest latency seen
+func (h *histogram) percentile(p float64) time.Duration {
+	rank := uint64(p*float64(h.n) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank && i < len(latencyBounds) && latencyBounds[i] < h.max {
+			return latencyBounds[i]
+		}
+		if seen >= rank {
+			break
+		}
+	}
+	return h.max
+}
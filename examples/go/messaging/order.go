@@ -0,0 +1,293 @@
+package messaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/clock"
+)
+
+var (
+	// ErrWrongTopic is returned for envelopes of another topic than the timeline's
+	ErrWrongTopic = errors.New("messaging: envelope is for another topic")
+	// ErrBufferFull is returned when an out-of-order envelope does not fit in
+	// the reorder buffer; it is dropped and shows up as a gap until resent
+	ErrBufferFull = errors.New("messaging: reorder buffer full")
+)
+
+// Order places an envelope in its topic's conversation. Seq numbers each
+// sender's messages from 1 so receivers notice missing ones, Deps is the
+// vector clock of messages the sender had seen from the other members, and
+// Lamport gives every member the same total order
+type Order struct {
+	Seq     uint64                    `json:"seq"`
+	Lamport uint64                    `json:"lamport"`
+	Deps    map[common.Address]uint64 `json:"deps,omitempty"` // highest seq seen per other sender
+}
+
+// Before reports whether a renders before b: by Lamport time, then by
+// sender. Delivery by a Timeline respects causality, and this order is the
+// same on every client
+func Before(a, b *Envelope) bool {
+	if a.Order == nil || b.Order == nil {
+		return a.Timestamp < b.Timestamp
+	}
+	if a.Order.Lamport != b.Order.Lamport {
+		return a.Order.Lamport < b.Order.Lamport
+	}
+	return bytes.Compare(a.Sender[:], b.Sender[:]) < 0
+}
+
+// Gap is a run of messages from one sender that a timeline knows were sent
+// but has not received
+type Gap struct {
+	Sender common.Address
+	From   uint64 // first missing seq
+	To     uint64 // last missing seq, inclusive
+	Of     uint64 // highest seq known from the sender
+	Since  time.Time
+}
+
+func (g Gap) String() string {
+	if g.From == g.To {
+		return fmt.Sprintf("message %d of %d from %s missing", g.From, g.Of, g.Sender.Hex())
+	}
+	return fmt.Sprintf("messages %d-%d of %d from %s missing", g.From, g.To, g.Of, g.Sender.Hex())
+}
+
+// Timeline orders one topic's conversation for one member. The member
+// stamps what it sends with Next, and passes what it receives to Receive,
+// which holds back envelopes until everything they depend on has been
+// delivered, so every client renders the same conversation. Envelopes
+// without an Order are delivered as they come. It is safe for concurrent
+// use
+type Timeline struct {
+	Topic     string
+	Self      common.Address
+	MaxBuffer int // out-of-order envelopes held at once; zero is 1000
+	Clock     clock.Clock
+
+	mu        sync.Mutex
+	lamport   uint64
+	delivered map[common.Address]uint64 // highest contiguous seq delivered
+	known     map[common.Address]uint64 // highest seq known to exist
+	gapSince  map[common.Address]time.Time
+	buffer    map[common.Address]map[uint64]*Envelope
+	buffered  int
+	skipped   map[common.Address]map[uint64]bool // given up on, passed over when reached
+}
+
+// NewTimeline creates an empty timeline of topic for self
+func NewTimeline(self common.Address, topic string) *Timeline {
+	return &Timeline{
+		Topic:     topic,
+		Self:      self,
+		delivered: make(map[common.Address]uint64),
+		known:     make(map[common.Address]uint64),
+		gapSince:  make(map[common.Address]time.Time),
+		buffer:    make(map[common.Address]map[uint64]*Envelope),
+		skipped:   make(map[common.Address]map[uint64]bool),
+	}
+}
+
+// Next returns the order of the member's next message, counting it as
+// delivered locally. Seal it to every recipient with SealOrdered
+func (t *Timeline) Next() *Order {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lamport++
+	t.delivered[t.Self]++
+	o := &Order{Seq: t.delivered[t.Self], Lamport: t.lamport}
+	for sender, seq := range t.delivered {
+		if sender != t.Self && seq > 0 {
+			if o.Deps == nil {
+				o.Deps = make(map[common.Address]uint64)
+			}
+			o.Deps[sender] = seq
+		}
+	}
+	return o
+}
+
+// Receive takes an envelope of the topic and returns the envelopes that
+// became deliverable, in delivery order; that may be none, while env waits
+// for a missing message, or several, when env filled a gap. Duplicates are
+// ignored. Verify envelopes before passing them in
+func (t *Timeline) Receive(env *Envelope) ([]*Envelope, error) {
+	if env.Topic != t.Topic {
+		return nil, fmt.Errorf("%w: %q", ErrWrongTopic, env.Topic)
+	}
+	if env.Order == nil {
+		return []*Envelope{env}, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seq := env.Order.Seq
+	if seq <= t.delivered[env.Sender] || t.buffer[env.Sender][seq] != nil || t.skipped[env.Sender][seq] {
+		return nil, nil
+	}
+	if t.buffered >= t.maxBuffer() && seq != t.delivered[env.Sender]+1 {
+		t.learn(env.Sender, seq)
+		return nil, ErrBufferFull
+	}
+	if env.Order.Lamport > t.lamport {
+		t.lamport = env.Order.Lamport
+	}
+	t.learn(env.Sender, seq)
+	for sender, dep := range env.Order.Deps {
+		t.learn(sender, dep)
+	}
+	if t.buffer[env.Sender] == nil {
+		t.buffer[env.Sender] = make(map[uint64]*Envelope)
+	}
+	t.buffer[env.Sender][seq] = env
+	t.buffered++
+	return t.drain(), nil
+}
+
+// Gaps returns the messages known to be missing, oldest sender first. A
+// message is known to exist once a later one from the same sender arrives,
+// or another member's message depends on it
+func (t *Timeline) Gaps() []Gap {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var gaps []Gap
+	for sender, known := range t.known {
+		var g *Gap
+		for seq := t.delivered[sender] + 1; seq <= known; seq++ {
+			if t.buffer[sender][seq] != nil || t.skipped[sender][seq] {
+				g = nil
+				continue
+			}
+			if g != nil && g.To == seq-1 {
+				g.To = seq
+				continue
+			}
+			gaps = append(gaps, Gap{Sender: sender, From: seq, To: seq, Of: known, Since: t.gapSince[sender]})
+			g = &gaps[len(gaps)-1]
+		}
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		if !gaps[i].Since.Equal(gaps[j].Since) {
+			return gaps[i].Since.Before(gaps[j].Since)
+		}
+		if gaps[i].Sender != gaps[j].Sender {
+			return bytes.Compare(gaps[i].Sender[:], gaps[j].Sender[:]) < 0
+		}
+		return gaps[i].From < gaps[j].From
+	})
+	return gaps
+}
+
+// Skip gives up on the missing messages from sender with seqs from to to,
+// inclusive, so the messages after them can be delivered, and returns the
+// envelopes that became deliverable. A skipped message that arrives later
+// is ignored
+func (t *Timeline) Skip(sender common.Address, from, to uint64) []*Envelope {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.learn(sender, to)
+	if from <= t.delivered[sender] {
+		from = t.delivered[sender] + 1
+	}
+	for s := from; s <= to; s++ {
+		if t.buffer[sender][s] != nil {
+			continue
+		}
+		if t.skipped[sender] == nil {
+			t.skipped[sender] = make(map[uint64]bool)
+		}
+		t.skipped[sender][s] = true
+	}
+	return t.drain()
+}
+
+// Delivered returns the highest seq delivered from each sender
+func (t *Timeline) Delivered() map[common.Address]uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[common.Address]uint64, len(t.delivered))
+	for sender, seq := range t.delivered {
+		out[sender] = seq
+	}
+	return out
+}
+
+// learn records that sender has sent seq; t.mu must be held
+func (t *Timeline) learn(sender common.Address, seq uint64) {
+	if sender == t.Self || seq <= t.known[sender] {
+		return
+	}
+	t.known[sender] = seq
+	if _, ok := t.gapSince[sender]; !ok {
+		t.gapSince[sender] = clock.Or(t.Clock).Now()
+	}
+}
+
+// drain delivers buffered envelopes whose predecessors and dependencies have
+// all been delivered, earliest in render order first; t.mu must be held
+func (t *Timeline) drain() []*Envelope {
+	var out []*Envelope
+	for {
+		t.passSkipped()
+		var next *Envelope
+		for sender, envs := range t.buffer {
+			env := envs[t.delivered[sender]+1]
+			if env != nil && t.ready(env) && (next == nil || Before(env, next)) {
+				next = env
+			}
+		}
+		if next == nil {
+			return out
+		}
+		delete(t.buffer[next.Sender], next.Order.Seq)
+		if len(t.buffer[next.Sender]) == 0 {
+			delete(t.buffer, next.Sender)
+		}
+		t.buffered--
+		t.delivered[next.Sender] = next.Order.Seq
+		if t.delivered[next.Sender] >= t.known[next.Sender] {
+			delete(t.gapSince, next.Sender)
+		}
+		out = append(out, next)
+	}
+}
+
+// passSkipped advances past skipped messages that are next in line; t.mu
+// must be held
+func (t *Timeline) passSkipped() {
+	for sender, seqs := range t.skipped {
+		for seqs[t.delivered[sender]+1] {
+			t.delivered[sender]++
+			delete(seqs, t.delivered[sender])
+		}
+		if len(seqs) == 0 {
+			delete(t.skipped, sender)
+		}
+		if t.delivered[sender] >= t.known[sender] {
+			delete(t.gapSince, sender)
+		}
+	}
+}
+
+// ready reports whether everything env depends on has been delivered
+func (t *Timeline) ready(env *Envelope) bool {
+	for sender, seq := range env.Order.Deps {
+		if sender != env.Sender && t.delivered[sender] < seq {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Timeline) maxBuffer() int {
+	if t.MaxBuffer <= 0 {
+		return 1000
+	}
+	return t.MaxBuffer
+}
@@ -0,0 +1,312 @@
+package messaging
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/gasquote"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const (
+	// AttachmentPayment marks envelopes carrying an inline payment; the
+	// payment itself is inside the encrypted message
+	AttachmentPayment = "payment"
+	// MessagePayment carries a PaymentMessage
+	MessagePayment = "payment"
+	// MessagePaymentResponse carries a PaymentResponse
+	MessagePaymentResponse = "payment.response"
+)
+
+// PaymentKind is what an inline payment asks of the receiver
+type PaymentKind string
+
+const (
+	// PaymentSignedTx is a transaction signed by the sender that the receiver
+	// broadcasts to collect the money
+	PaymentSignedTx PaymentKind = "signed-tx"
+	// PaymentRequest asks the receiver to pay the sender
+	PaymentRequest PaymentKind = "request"
+)
+
+// Payment is a payment sent inside a chat message
+type Payment struct {
+	Kind    PaymentKind    `json:"kind"`
+	ChainID *hexutil.Big   `json:"chainId"`
+	RawTx   hexutil.Bytes  `json:"rawTx,omitempty"`  // signed transaction, for PaymentSignedTx
+	Asset   common.Address `json:"asset"`            // token to pay, zero for ETH; for PaymentRequest
+	Amount  *hexutil.Big   `json:"amount,omitempty"` // for PaymentRequest
+	Memo    string         `json:"memo,omitempty"`
+	Expires int64          `json:"expires,omitempty"` // unix seconds; zero never expires
+}
+
+// PaymentMessage is a chat message with a payment attached
+type PaymentMessage struct {
+	Text    string  `json:"text,omitempty"`
+	Payment Payment `json:"payment"`
+}
+
+// PaymentPreview is what the receiver is asked to accept, decoded offline
+type PaymentPreview struct {
+	Kind    PaymentKind
+	ChainID *big.Int
+	From    common.Address // who pays
+	To      common.Address // who is paid
+	Asset   common.Address // zero for ETH
+	Amount  *big.Int
+	MaxFee  *big.Int    // gas the payer commits to at most; signed transactions only
+	Nonce   uint64      // signed transactions only
+	TxHash  common.Hash // signed transactions only
+	Memo    string
+	Expires time.Time // zero when the payment does not expire
+}
+
+// PaymentResponse tells the sender whether the payment was accepted
+type PaymentResponse struct {
+	EnvelopeID common.Hash  `json:"envelopeId"`
+	Accepted   bool         `json:"accepted"`
+	TxHash     *common.Hash `json:"txHash,omitempty"`
+	Reason     string       `json:"reason,omitempty"`
+}
+
+// NewSignedTxPayment attaches a signed transaction paying the recipient
+func NewSignedTxPayment(tx *types.Transaction, memo string) (*Payment, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &Payment{Kind: PaymentSignedTx, ChainID: (*hexutil.Big)(tx.ChainId()), RawTx: raw, Memo: memo}, nil
+}
+
+// NewPaymentRequest asks the recipient to pay amount of asset, zero for ETH,
+// expiring ttl from now on clk; a nil clk is the wall clock
+func NewPaymentRequest(chainID *big.Int, asset common.Address, amount *big.Int, memo string, clk clock.Clock, ttl time.Duration) *Payment {
+	p := &Payment{
+		Kind:    PaymentRequest,
+		ChainID: (*hexutil.Big)(chainID),
+		Asset:   asset,
+		Amount:  (*hexutil.Big)(amount),
+		Memo:    memo,
+	}
+	if ttl > 0 {
+		p.Expires = clock.Or(clk).Now().Add(ttl).Unix()
+	}
+	return p
+}
+
+// SealPayment seals a chat message with a payment to the recipient key. The
+// envelope lists a payment attachment so relays can apply their filters
+func SealPayment(w *wallet.Wallet, to *ecdsa.PublicKey, topic, text string, p *Payment) (*Envelope, error) {
+	payment, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := NewMessage(MessagePayment, PaymentMessage{Text: text, Payment: *p})
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return Seal(w, to, topic, plaintext, Attachment{
+		Type: AttachmentPayment,
+		Size: len(payment),
+		Hash: crypto.Keccak256Hash(payment),
+	})
+}
+
+// OpenPayment decrypts a payment envelope and checks the payment against the
+// attachment listed on the envelope
+func OpenPayment(env *Envelope, key *ecdsa.PrivateKey) (*PaymentMessage, error) {
+	if !env.Verify() {
+		return nil, errors.New("invalid envelope")
+	}
+	msg, err := OpenMessage(env, key)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessagePayment {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	var pm PaymentMessage
+	if err := msg.Decode(&pm); err != nil {
+		return nil, err
+	}
+	payment, err := json.Marshal(&pm.Payment)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range env.Attachments {
+		if a.Type == AttachmentPayment && a.Hash == crypto.Keccak256Hash(payment) {
+			return &pm, nil
+		}
+	}
+	return nil, errors.New("payment does not match the envelope attachment")
+}
+
+// Preview decodes the payment for display. A signed transaction must be from
+// the envelope's sender and pay its recipient, directly or by an ERC-20
+// transfer
+func (pm *PaymentMessage) Preview(env *Envelope) (*PaymentPreview, error) {
+	p := &pm.Payment
+	if p.ChainID == nil {
+		return nil, errors.New("payment has no chain id")
+	}
+	preview := &PaymentPreview{Kind: p.Kind, ChainID: p.ChainID.ToInt(), Memo: p.Memo}
+	if p.Expires != 0 {
+		preview.Expires = time.Unix(p.Expires, 0)
+	}
+
+	switch p.Kind {
+	case PaymentRequest:
+		if p.Amount == nil || p.Amount.ToInt().Sign() <= 0 {
+			return nil, errors.New("payment request has no amount")
+		}
+		preview.From, preview.To = env.Recipient, env.Sender
+		preview.Asset, preview.Amount = p.Asset, p.Amount.ToInt()
+		return preview, nil
+
+	case PaymentSignedTx:
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(p.RawTx); err != nil {
+			return nil, err
+		}
+		if tx.ChainId().Cmp(preview.ChainID) != 0 {
+			return nil, errors.New("transaction is for a different chain")
+		}
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return nil, err
+		}
+		if from != env.Sender {
+			return nil, fmt.Errorf("transaction is from %s, not the sender", from.Hex())
+		}
+		if tx.To() == nil {
+			return nil, errors.New("contract creation is not a payment")
+		}
+		preview.From, preview.Nonce, preview.TxHash = from, tx.Nonce(), tx.Hash()
+		preview.MaxFee = new(big.Int).Mul(tx.GasFeeCap(), new(big.Int).SetUint64(tx.Gas()))
+
+		if len(tx.Data()) == 0 {
+			preview.To, preview.Amount = *tx.To(), tx.Value()
+		} else if to, amount, ok := contract.DecodeTransfer(tx.Data()); ok && tx.Value().Sign() == 0 {
+			preview.Asset, preview.To, preview.Amount = *tx.To(), to, amount
+		} else {
+			return nil, errors.New("transaction is not a plain transfer")
+		}
+		if preview.To != env.Recipient {
+			return nil, fmt.Errorf("transaction pays %s, not the recipient", preview.To.Hex())
+		}
+		return preview, nil
+	}
+	return nil, fmt.Errorf("unknown payment kind %q", p.Kind)
+}
+
+// QuoteFee prices the gas of the payment in token: the fee the payer
+// committed to for a signed transaction, or the fee of paying a request now
+func (p *PaymentPreview) QuoteFee(ctx context.Context, q *gasquote.Quoter, token gasquote.Token) (*gasquote.Quote, error) {
+	if p.Kind == PaymentSignedTx {
+		return q.QuoteWei(ctx, token, p.MaxFee)
+	}
+	to, value, data, err := p.call()
+	if err != nil {
+		return nil, err
+	}
+	return q.Quote(ctx, ethereum.CallMsg{From: p.From, To: &to, Value: value, Data: data}, token)
+}
+
+// call returns the transaction that pays the preview: a plain transfer for
+// ETH or an ERC-20 transfer call
+func (p *PaymentPreview) call() (common.Address, *big.Int, []byte, error) {
+	if p.Asset == (common.Address{}) {
+		return p.To, p.Amount, nil, nil
+	}
+	data, err := contract.TransferData(p.To, p.Amount)
+	return p.Asset, new(big.Int), data, err
+}
+
+// AcceptPayment broadcasts a signed transaction payment, or pays a payment
+// request from w, and tells the sender. Expiry is checked on clk, nil for
+// the wall clock. It returns the transaction sent
+func AcceptPayment(ctx context.Context, w *wallet.Wallet, sender Sender, env *Envelope, pm *PaymentMessage, clk clock.Clock) (*types.Transaction, error) {
+	preview, err := pm.Preview(env)
+	if err != nil {
+		return nil, err
+	}
+	if !preview.Expires.IsZero() && clock.Or(clk).Now().After(preview.Expires) {
+		return nil, errors.New("payment expired")
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if chainID.Cmp(preview.ChainID) != 0 {
+		return nil, fmt.Errorf("payment is for chain %s, wallet is on %s", preview.ChainID, chainID)
+	}
+
+	var tx *types.Transaction
+	switch preview.Kind {
+	case PaymentSignedTx:
+		tx = new(types.Transaction)
+		if err := tx.UnmarshalBinary(pm.Payment.RawTx); err != nil {
+			return nil, err
+		}
+		if err := client.SendTransaction(ctx, tx); err != nil {
+			return nil, err
+		}
+	case PaymentRequest:
+		if preview.From != w.Address {
+			return nil, errors.New("payment request is not addressed to this wallet")
+		}
+		to, value, data, err := preview.call()
+		if err != nil {
+			return nil, err
+		}
+		tx, err = w.SendTx(ctx, to, units.NewWei(value), &wallet.TxOpts{Data: data})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hash := tx.Hash()
+	return tx, respondPayment(ctx, w, sender, env, &PaymentResponse{EnvelopeID: env.ID, Accepted: true, TxHash: &hash})
+}
+
+// DeclinePayment tells the sender the payment was not accepted
+func DeclinePayment(ctx context.Context, w *wallet.Wallet, sender Sender, env *Envelope, reason string) error {
+	return respondPayment(ctx, w, sender, env, &PaymentResponse{EnvelopeID: env.ID, Reason: reason})
+}
+
+func respondPayment(ctx context.Context, w *wallet.Wallet, sender Sender, env *Envelope, resp *PaymentResponse) error {
+	key, err := env.SenderKey()
+	if err != nil {
+		return err
+	}
+	msg, err := NewMessage(MessagePaymentResponse, resp)
+	if err != nil {
+		return err
+	}
+	reply, err := SealMessage(w, key, env.Topic, msg)
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, reply)
+}
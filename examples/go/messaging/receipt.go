@@ -0,0 +1,37 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// MessageReceipt carries a Receipt
+const MessageReceipt = "receipt"
+
+// Receipt acknowledges that the recipient received and opened an envelope.
+// Receipts reveal when a message was read, so clients send them only when
+// the user allows it
+type Receipt struct {
+	EnvelopeID common.Hash `json:"envelopeId"`
+	ReceivedAt int64       `json:"receivedAt"` // unix milliseconds, as the recipient saw it
+}
+
+// SendReceipt acknowledges env to its sender, sealed to the key that signed it
+func SendReceipt(ctx context.Context, w *wallet.Wallet, sender Sender, env *Envelope) error {
+	key, err := env.SenderKey()
+	if err != nil {
+		return err
+	}
+	msg, err := NewMessage(MessageReceipt, &Receipt{EnvelopeID: env.ID, ReceivedAt: time.Now().UnixMilli()})
+	if err != nil {
+		return err
+	}
+	reply, err := SealMessage(w, key, env.Topic, msg)
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, reply)
+}
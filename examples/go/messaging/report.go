@@ -0,0 +1,81 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// ReportReason categorizes an abuse report
+type ReportReason string
+
+const (
+	ReasonSpam       ReportReason = "spam"
+	ReasonHarassment ReportReason = "harassment"
+	ReasonIllegal    ReportReason = "illegal-content"
+	ReasonPhishing   ReportReason = "phishing"
+	ReasonOther      ReportReason = "other"
+)
+
+// AbuseReport is a signed complaint referencing an offending envelope
+type AbuseReport struct {
+	Version     int            `json:"version"`
+	EnvelopeID  common.Hash    `json:"envelopeId"`
+	Offender    common.Address `json:"offender"`
+	ContentHash common.Hash    `json:"contentHash"`
+	Reason      ReportReason   `json:"reason"`
+	Reporter    common.Address `json:"reporter"`
+	Timestamp   int64          `json:"timestamp"`
+	Signature   hexutil.Bytes  `json:"signature"`
+}
+
+// NewAbuseReport creates a report about env signed by the reporter's wallet
+func NewAbuseReport(w *wallet.Wallet, env *Envelope, reason ReportReason) (*AbuseReport, error) {
+	if env.Sender == w.Address {
+		return nil, errors.New("cannot report own envelope")
+	}
+
+	r := &AbuseReport{
+		Version:     EnvelopeVersion,
+		EnvelopeID:  env.ID,
+		Offender:    env.Sender,
+		ContentHash: env.ContentHash(),
+		Reason:      reason,
+		Reporter:    w.Address,
+		Timestamp:   time.Now().Unix(),
+	}
+
+	payload, err := r.SigningPayload()
+	if err != nil {
+		return nil, err
+	}
+	if r.Signature, err = w.SignMessage(payload); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SigningPayload returns the canonical bytes covered by the signature
+func (r *AbuseReport) SigningPayload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Verify checks the reporter's signature
+func (r *AbuseReport) Verify() bool {
+	payload, err := r.SigningPayload()
+	if err != nil {
+		return false
+	}
+	return wallet.VerifySignature(payload, r.Signature, r.Reporter)
+}
+
+// Matches reports whether the report refers to env
+func (r *AbuseReport) Matches(env *Envelope) bool {
+	return r.EnvelopeID == env.ID && r.Offender == env.Sender && r.ContentHash == env.ContentHash()
+}
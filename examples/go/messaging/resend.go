@@ -0,0 +1,251 @@
+package messaging
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const (
+	// MessageResendRequest carries a ResendRequest
+	MessageResendRequest = "resend.request"
+	// MaxResend is the most messages one resend request is answered with
+	MaxResend = 100
+	// outboxPrefix is the storage key prefix of sent ordered envelopes
+	outboxPrefix = "messaging/outbox/"
+)
+
+// ErrBadResendRequest is returned for resend requests with an empty or
+// reversed range
+var ErrBadResendRequest = errors.New("messaging: bad resend request")
+
+// ResendRequest asks for a run of one sender's messages on a topic to be
+// sent again to the requester, who signed the envelope carrying it
+type ResendRequest struct {
+	Topic  string         `json:"topic"`
+	Sender common.Address `json:"sender"`
+	From   uint64         `json:"from"`
+	To     uint64         `json:"to"` // inclusive
+}
+
+// NewResendRequest asks for the messages of a gap
+func NewResendRequest(topic string, g Gap) *ResendRequest {
+	return &ResendRequest{Topic: topic, Sender: g.Sender, From: g.From, To: g.To}
+}
+
+// Validate checks the range and caps it at MaxResend messages
+func (r *ResendRequest) Validate() error {
+	if r.From == 0 || r.To < r.From {
+		return fmt.Errorf("%w: %d-%d", ErrBadResendRequest, r.From, r.To)
+	}
+	if r.To-r.From >= MaxResend {
+		r.To = r.From + MaxResend - 1
+	}
+	return nil
+}
+
+// RequestResend seals a resend request to the key of whoever is asked, the
+// original sender or a store node, and sends it
+func RequestResend(ctx context.Context, w *wallet.Wallet, sender Sender, to *ecdsa.PublicKey, req *ResendRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	msg, err := NewMessage(MessageResendRequest, req)
+	if err != nil {
+		return err
+	}
+	env, err := SealMessage(w, to, req.Topic, msg)
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, env)
+}
+
+// Resender finds the envelopes a resend request asks for that were sealed to
+// requester, such as an Outbox or a relay's store
+type Resender interface {
+	Resend(ctx context.Context, requester common.Address, req *ResendRequest) ([]*Envelope, error)
+}
+
+// AnswerResend sends again the envelopes asked for by a resend request that
+// arrived in env. Envelopes are only ever resent to the recipient they were
+// sealed to, so a request reveals nothing the requester could not read
+func AnswerResend(ctx context.Context, sender Sender, src Resender, env *Envelope, req *ResendRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	envs, err := src.Resend(ctx, env.Sender, req)
+	if err != nil {
+		return err
+	}
+	for _, e := range envs {
+		if err := sender.Send(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Outbox keeps the ordered envelopes a member sent, so it can answer resend
+// requests itself. Entries stay until deleted, for instance by a retention
+// job over the outbox prefix
+type Outbox struct {
+	Store storage.Store
+}
+
+// NewOutbox creates an outbox in store
+func NewOutbox(store storage.Store) *Outbox {
+	return &Outbox{Store: store}
+}
+
+// Put records a sent envelope; envelopes without an Order are not kept
+func (o *Outbox) Put(ctx context.Context, env *Envelope) error {
+	if env.Order == nil {
+		return nil
+	}
+	data, err := env.Encode()
+	if err != nil {
+		return err
+	}
+	return o.Store.Put(ctx, outboxKey(env.Topic, env.Recipient)+fmt.Sprintf("%020d", env.Order.Seq), data)
+}
+
+// Resend implements Resender
+func (o *Outbox) Resend(ctx context.Context, requester common.Address, req *ResendRequest) ([]*Envelope, error) {
+	prefix := outboxKey(req.Topic, requester)
+	var envs []*Envelope
+	for seq := req.From; seq <= req.To; seq++ {
+		data, err := o.Store.Get(ctx, prefix+fmt.Sprintf("%020d", seq))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		env, err := DecodeEnvelope(data)
+		if err != nil {
+			return nil, err
+		}
+		if env.Sender == req.Sender {
+			envs = append(envs, env)
+		}
+	}
+	return envs, nil
+}
+
+func outboxKey(topic string, recipient common.Address) string {
+	return outboxPrefix + url.PathEscape(topic) + "/" + recipient.Hex() + "/"
+}
+
+// Repairer requests the messages a timeline is missing, retrying each gap a
+// bounded number of times before declaring it permanently missing and
+// skipping it, so one lost message cannot stall a conversation forever.
+// Call Repair periodically
+type Repairer struct {
+	Timeline *Timeline
+	// Request sends a resend request for a gap; attempt counts from 1, so
+	// callers can ask the sender first and a store node after
+	Request     func(ctx context.Context, req *ResendRequest, attempt int) error
+	MaxAttempts int           // zero is 5
+	Interval    time.Duration // wait after the first attempt, doubling after each; zero is 30 seconds
+	Clock       clock.Clock
+
+	mu      sync.Mutex
+	pending map[gapKey]*repairAttempts
+	missing []Gap
+}
+
+type gapKey struct {
+	sender common.Address
+	from   uint64
+}
+
+type repairAttempts struct {
+	count int
+	next  time.Time
+}
+
+// NewRepairer creates a repairer for a timeline that sends requests with
+// request
+func NewRepairer(t *Timeline, request func(ctx context.Context, req *ResendRequest, attempt int) error) *Repairer {
+	return &Repairer{Timeline: t, Request: request, pending: make(map[gapKey]*repairAttempts)}
+}
+
+// Repair requests every gap that is due another attempt and gives up on gaps
+// that have had all of them, returning the envelopes that skipping released.
+// A failed request counts as an attempt; the first error is returned after
+// every gap has been tried
+func (r *Repairer) Repair(ctx context.Context) ([]*Envelope, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[gapKey]*repairAttempts)
+	}
+	now := clock.Or(r.Clock).Now()
+	gaps := r.Timeline.Gaps()
+	open := make(map[gapKey]bool, len(gaps))
+	var (
+		released []*Envelope
+		firstErr error
+	)
+	for _, g := range gaps {
+		key := gapKey{sender: g.Sender, from: g.From}
+		open[key] = true
+		a := r.pending[key]
+		if a == nil {
+			a = &repairAttempts{}
+			r.pending[key] = a
+		}
+		if now.Before(a.next) {
+			continue
+		}
+		if a.count >= r.maxAttempts() {
+			r.missing = append(r.missing, g)
+			delete(r.pending, key)
+			released = append(released, r.Timeline.Skip(g.Sender, g.From, g.To)...)
+			continue
+		}
+		a.count++
+		a.next = now.Add(r.interval() << (a.count - 1))
+		if err := r.Request(ctx, NewResendRequest(r.Timeline.Topic, g), a.count); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	// gaps that were filled, or shrank to start elsewhere, stop being tracked
+	for key := range r.pending {
+		if !open[key] {
+			delete(r.pending, key)
+		}
+	}
+	return released, firstErr
+}
+
+// Missing returns the gaps given up on, in the order they were given up
+func (r *Repairer) Missing() []Gap {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Gap(nil), r.missing...)
+}
+
+func (r *Repairer) maxAttempts() int {
+	if r.MaxAttempts <= 0 {
+		return 5
+	}
+	return r.MaxAttempts
+}
+
+func (r *Repairer) interval() time.Duration {
+	if r.Interval <= 0 {
+		return 30 * time.Second
+	}
+	return r.Interval
+}
@@ -0,0 +1,276 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/storage"
+)
+
+const (
+	// subscriptionPrefix is the storage key prefix of subscriptions
+	subscriptionPrefix = "messaging/subscription/"
+	// maxSeen is how many delivered envelope IDs a subscription remembers,
+	// so catch-up over the overlap window does not deliver them again
+	maxSeen = 256
+)
+
+var (
+	// ErrSubscriptionExists is returned when subscribing with an ID in use
+	ErrSubscriptionExists = errors.New("messaging: subscription exists")
+	// ErrNoSubscription is returned for unknown subscription IDs
+	ErrNoSubscription = errors.New("messaging: no such subscription")
+)
+
+// Filter selects envelopes for a subscription; empty lists match everything
+type Filter struct {
+	Topics   []string         `json:"topics,omitempty"`
+	Channels []string         `json:"channels,omitempty"` // channel names, which channels use as their topic
+	Senders  []common.Address `json:"senders,omitempty"`
+}
+
+// Match reports whether env passes the filter
+func (f Filter) Match(env *Envelope) bool {
+	if len(f.Topics)+len(f.Channels) > 0 && !contains(f.Topics, env.Topic) && !contains(f.Channels, env.Topic) {
+		return false
+	}
+	if len(f.Senders) == 0 {
+		return true
+	}
+	for _, s := range f.Senders {
+		if s == env.Sender {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription is a saved interest in the envelopes sent to a recipient.
+// LastSeen and Seen record what was delivered, so a restored subscription
+// resumes where it stopped
+type Subscription struct {
+	ID        string         `json:"id"`
+	Recipient common.Address `json:"recipient"`
+	Filter    Filter         `json:"filter"`
+	Created   time.Time      `json:"created"`
+	LastSeen  int64          `json:"lastSeen,omitempty"` // newest delivered envelope timestamp, unix seconds
+	Seen      []common.Hash  `json:"seen,omitempty"`     // most recently delivered IDs, oldest first
+}
+
+// seen reports whether the subscription delivered id
+func (s *Subscription) seen(id common.Hash) bool {
+	for _, h := range s.Seen {
+		if h == id {
+			return true
+		}
+	}
+	return false
+}
+
+// History is a store node subscriptions catch up from, such as a relay: it
+// returns the envelopes sent or received by addr with timestamps in
+// [since, until), oldest first
+type History interface {
+	Envelopes(ctx context.Context, addr common.Address, since, until time.Time) ([]*Envelope, error)
+}
+
+// SubscriptionHandler receives the envelopes matching a subscription. An
+// error leaves the envelope unrecorded, and Restore offers it again unless it
+// is older than LastSeen less Overlap by then. It
+// runs with the subscriptions locked and must not call back into them
+type SubscriptionHandler func(ctx context.Context, sub *Subscription, env *Envelope) error
+
+// Subscriptions keeps subscriptions in a store and hands each incoming
+// envelope to the handler once per matching subscription. After a restart,
+// Restore reloads them and fetches from History what arrived while the
+// process was down, so embedded clients do not miss messages across deploys.
+// It is safe for concurrent use
+type Subscriptions struct {
+	Store   storage.Store
+	History History // optional; without it Restore only reloads
+	Handler SubscriptionHandler
+	// Overlap is how far before LastSeen catch-up starts, covering clock
+	// skew and envelopes stored late; default one minute
+	Overlap time.Duration
+	Clock   clock.Clock // optional, sets Created and the catch-up end
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+}
+
+// NewSubscriptions creates an empty set of subscriptions; call Restore to
+// load saved ones
+func NewSubscriptions(store storage.Store, history History, handler SubscriptionHandler) *Subscriptions {
+	return &Subscriptions{Store: store, History: history, Handler: handler, Overlap: time.Minute, subs: make(map[string]*Subscription)}
+}
+
+// Subscribe saves a subscription; it receives envelopes that arrive from now on
+func (s *Subscriptions) Subscribe(ctx context.Context, id string, recipient common.Address, filter Filter) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrSubscriptionExists, id)
+	}
+	now := clock.Or(s.Clock).Now()
+	sub := &Subscription{ID: id, Recipient: recipient, Filter: filter, Created: now, LastSeen: now.Unix()}
+	if err := s.save(ctx, sub); err != nil {
+		return nil, err
+	}
+	s.subs[id] = sub
+	return copySubscription(sub), nil
+}
+
+// Unsubscribe deletes a subscription
+func (s *Subscriptions) Unsubscribe(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrNoSubscription, id)
+	}
+	if err := s.Store.Delete(ctx, subscriptionKey(id)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	delete(s.subs, id)
+	return nil
+}
+
+// List returns the subscriptions sorted by ID
+func (s *Subscriptions) List() []*Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		out = append(out, copySubscription(sub))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Forward delivers an incoming envelope to every matching subscription, so
+// the set can sit behind a relay as its relay.Forwarder. Envelopes a
+// subscription has already seen are skipped
+func (s *Subscriptions) Forward(ctx context.Context, env *Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, sub := range s.sorted() {
+		if _, err := s.deliver(ctx, sub, env); err != nil {
+			errs = append(errs, fmt.Errorf("subscription %s: %w", sub.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Restore loads the saved subscriptions, then catches each up from History
+// with what it missed since LastSeen, less Overlap. It returns how many
+// envelopes catch-up delivered; subscriptions that failed to catch up are
+// loaded anyway and reported in the error, and a later Restore retries them
+func (s *Subscriptions) Restore(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.Store.List(ctx, subscriptionPrefix)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		data, err := s.Store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		var sub Subscription
+		if err := json.Unmarshal(data, &sub); err != nil {
+			return 0, fmt.Errorf("%s: %w", key, err)
+		}
+		s.subs[sub.ID] = &sub
+	}
+	if s.History == nil {
+		return 0, nil
+	}
+
+	n := 0
+	var errs []error
+	until := clock.Or(s.Clock).Now().Add(time.Minute)
+	for _, sub := range s.sorted() {
+		since := time.Unix(sub.LastSeen, 0).Add(-s.Overlap)
+		envs, err := s.History.Envelopes(ctx, sub.Recipient, since, until)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("subscription %s: %w", sub.ID, err))
+			continue
+		}
+		for _, env := range envs {
+			ok, err := s.deliver(ctx, sub, env)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("subscription %s: %w", sub.ID, err))
+				break
+			}
+			if ok {
+				n++
+			}
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// deliver hands env to the handler if sub wants it and records the
+// delivery, reporting whether it did
+func (s *Subscriptions) deliver(ctx context.Context, sub *Subscription, env *Envelope) (bool, error) {
+	if env.Recipient != sub.Recipient || sub.seen(env.ID) || !sub.Filter.Match(env) {
+		return false, nil
+	}
+	if s.Handler != nil {
+		if err := s.Handler(ctx, copySubscription(sub), env); err != nil {
+			return false, err
+		}
+	}
+	next := copySubscription(sub)
+	next.Seen = append(next.Seen, env.ID)
+	if len(next.Seen) > maxSeen {
+		next.Seen = next.Seen[len(next.Seen)-maxSeen:]
+	}
+	if env.Timestamp > next.LastSeen {
+		next.LastSeen = env.Timestamp
+	}
+	if err := s.save(ctx, next); err != nil {
+		return false, err
+	}
+	*sub = *next
+	return true, nil
+}
+
+func (s *Subscriptions) sorted() []*Subscription {
+	out := make([]*Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		out = append(out, sub)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (s *Subscriptions) save(ctx context.Context, sub *Subscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return s.Store.Put(ctx, subscriptionKey(sub.ID), data)
+}
+
+func subscriptionKey(id string) string {
+	return subscriptionPrefix + url.PathEscape(id)
+}
+
+func copySubscription(sub *Subscription) *Subscription {
+	c := *sub
+	c.Seen = append([]common.Hash(nil), sub.Seen...)
+	c.Filter.Topics = append([]string(nil), sub.Filter.Topics...)
+	c.Filter.Channels = append([]string(nil), sub.Filter.Channels...)
+	c.Filter.Senders = append([]common.Address(nil), sub.Filter.Senders...)
+	return &c
+}
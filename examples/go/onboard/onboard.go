@@ -0,0 +1,241 @@
+package onboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/aa"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/gasquote"
+	"github.com/whisperchain/go-examples/keyregistry"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// distributorABIJSON is the starter WHSP distributor: claim sends the
+// allocation to the caller once
+const distributorABIJSON = `[
+{"type":"function","name":"claim","stateMutability":"nonpayable","inputs":[],"outputs":[]},
+{"type":"function","name":"claimed","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"bool"}]}
+]`
+
+var distributorABI = mustParseABI(distributorABIJSON)
+
+// ErrOperationFailed is returned when the bundled operation reverted
+var ErrOperationFailed = errors.New("onboard: user operation reverted")
+
+// Result reports what onboarding did. Steps already done on an earlier run
+// are skipped, so Onboard can be retried safely
+type Result struct {
+	Account       common.Address
+	UserOpHash    common.Hash // zero when there was nothing left to do
+	TxHash        common.Hash
+	Deployed      bool // the account was deployed by this run
+	KeyRegistered bool
+	Claimed       bool
+	// Fee is the most the paymaster covers, in the Onboarder's FeeToken; nil
+	// without a Quoter or when there was nothing left to do
+	Fee *gasquote.Quote
+}
+
+// Onboarder sets up new users without them holding ETH: it deploys a smart
+// account, registers their messaging key and claims the starter WHSP
+// allocation in one user operation paid for by a paymaster
+type Onboarder struct {
+	Bundler     *aa.Bundler
+	Paymaster   aa.Paymaster
+	Factory     common.Address // SimpleAccount factory
+	Registry    *keyregistry.Registry
+	Distributor common.Address // zero skips the starter claim
+	Poll        time.Duration
+	Audit       audit.Log
+	// Quoter, when set, prices each sponsored operation in FeeToken so
+	// sponsorship can be budgeted or charged back in tokens
+	Quoter   *gasquote.Quoter
+	FeeToken gasquote.Token
+}
+
+// NewOnboarder creates an onboarder
+func NewOnboarder(bundler *aa.Bundler, paymaster aa.Paymaster, factory common.Address, registry *keyregistry.Registry, distributor common.Address, auditLog audit.Log) *Onboarder {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Onboarder{
+		Bundler:     bundler,
+		Paymaster:   paymaster,
+		Factory:     factory,
+		Registry:    registry,
+		Distributor: distributor,
+		Poll:        2 * time.Second,
+		Audit:       auditLog,
+	}
+}
+
+// Onboard prepares owner's smart account and waits for the sponsored
+// operation to be included. A nil messagingKey registers the owner's public
+// key. The key is registered to the account address, which is the identity
+// key validators should check for smart-account users
+func (o *Onboarder) Onboard(ctx context.Context, owner *wallet.Wallet, messagingKey []byte) (*Result, error) {
+	if messagingKey == nil {
+		messagingKey = crypto.FromECDSAPub(&owner.PrivateKey.PublicKey)
+	}
+	account, err := aa.NewAccount(ctx, owner, o.Factory, nil)
+	if err != nil {
+		return nil, err
+	}
+	account.EntryPoint = o.Bundler.EntryPoint
+	res := &Result{Account: account.Address}
+
+	deployed, err := account.Deployed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := o.pending(ctx, account.Address, messagingKey, res)
+	if err != nil {
+		return nil, err
+	}
+	if len(calls) == 0 {
+		if deployed {
+			return res, nil
+		}
+		// Deploy with a no-op call to the account itself
+		calls = []aa.Call{{To: account.Address}}
+	}
+
+	op, err := account.UserOp(ctx, calls...)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.Paymaster.Sponsor(ctx, op, account.EntryPoint); err != nil {
+		return nil, fmt.Errorf("paymaster declined: %w", err)
+	}
+	if o.Quoter != nil {
+		if res.Fee, err = o.Quoter.QuoteUserOp(ctx, op, o.FeeToken); err != nil {
+			return nil, err
+		}
+	}
+	client, err := owner.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := op.Sign(owner, account.EntryPoint, chainID); err != nil {
+		return nil, err
+	}
+	hash, err := o.Bundler.Send(ctx, op)
+	if err != nil {
+		o.record(ctx, account.Address, "failed", map[string]string{"error": err.Error()})
+		return nil, err
+	}
+	res.UserOpHash = hash
+
+	rcpt, err := o.Bundler.Wait(ctx, hash, o.Poll)
+	if err != nil {
+		return nil, err
+	}
+	if rcpt.Receipt != nil {
+		res.TxHash = rcpt.Receipt.TxHash
+	}
+	if !rcpt.Success {
+		o.record(ctx, account.Address, "reverted", map[string]string{"userOp": hash.Hex(), "reason": rcpt.Reason})
+		return nil, fmt.Errorf("%w: %s", ErrOperationFailed, rcpt.Reason)
+	}
+	res.Deployed = !deployed
+	o.record(ctx, account.Address, "success", map[string]string{
+		"userOp":        hash.Hex(),
+		"tx":            res.TxHash.Hex(),
+		"deployed":      fmt.Sprint(res.Deployed),
+		"keyRegistered": fmt.Sprint(res.KeyRegistered),
+		"claimed":       fmt.Sprint(res.Claimed),
+	})
+	if res.Fee != nil {
+		o.Audit.Record(ctx, audit.Entry{
+			Actor:   account.Address.Hex(),
+			Action:  "onboard.fee",
+			Subject: o.FeeToken.Symbol,
+			Outcome: "quoted",
+			Details: map[string]string{"userOp": hash.Hex(), "maxWei": res.Fee.MaxWei.String(), "max": res.Fee.Max.String()},
+		})
+	}
+	return res, nil
+}
+
+// pending returns the onboarding calls not done yet, marking them in res
+func (o *Onboarder) pending(ctx context.Context, account common.Address, messagingKey []byte, res *Result) ([]aa.Call, error) {
+	var calls []aa.Call
+	info, err := o.Registry.KeyInfo(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Registered() {
+		data, err := keyregistry.RegisterKeyData(messagingKey)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, aa.Call{To: o.Registry.Address, Data: data})
+		res.KeyRegistered = true
+	}
+
+	if o.Distributor != (common.Address{}) {
+		claimed, err := o.claimed(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			data, err := distributorABI.Pack("claim")
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, aa.Call{To: o.Distributor, Data: data})
+			res.Claimed = true
+		}
+	}
+	return calls, nil
+}
+
+func (o *Onboarder) claimed(ctx context.Context, account common.Address) (bool, error) {
+	data, err := distributorABI.Pack("claimed", account)
+	if err != nil {
+		return false, err
+	}
+	out, err := o.Registry.Client.CallContract(ctx, ethereum.CallMsg{To: &o.Distributor, Data: data}, nil)
+	if err != nil {
+		return false, err
+	}
+	values, err := distributorABI.Unpack("claimed", out)
+	if err != nil {
+		return false, err
+	}
+	v, ok := values[0].(bool)
+	if !ok {
+		return false, errors.New("unexpected claimed result")
+	}
+	return v, nil
+}
+
+func (o *Onboarder) record(ctx context.Context, account common.Address, outcome string, details map[string]string) {
+	o.Audit.Record(ctx, audit.Entry{
+		Actor:   account.Hex(),
+		Action:  "onboard",
+		Subject: account.Hex(),
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
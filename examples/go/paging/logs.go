@@ -0,0 +1,108 @@
+package paging
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Span is how many blocks a paged scan queries at a time
+const Span = 2000
+
+// LogKey is the sort key of a log: block number then log index
+func LogKey(l types.Log) string {
+	return BlockKey(l.BlockNumber, l.Index, "")
+}
+
+// BlockKey is a sort key ordering by block, then position within the block,
+// then id
+func BlockKey(block uint64, index uint, id string) string {
+	return fmt.Sprintf("%012d.%06d.%s", block, index, id)
+}
+
+// KeyBlock returns the block a BlockKey was made for
+func KeyBlock(key string) (uint64, bool) {
+	if len(key) < 12 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(key[:12], 10, 64)
+	return n, err == nil
+}
+
+// Logs returns a page of the logs matching q in chain order, scanning from
+// the cursor on and stopping once the page is full
+func Logs(ctx context.Context, client *ethclient.Client, q ethereum.FilterQuery, r Request) (*Page[types.Log], error) {
+	c, err := NewCollector(r, LogKey)
+	if err != nil {
+		return nil, err
+	}
+	if after, _ := r.Key(); after != "" && q.BlockHash == nil {
+		if b, ok := KeyBlock(after); ok && (q.FromBlock == nil || b > q.FromBlock.Uint64()) {
+			q.FromBlock = new(big.Int).SetUint64(b)
+		}
+	}
+	err = EachLog(ctx, client, q, func(l types.Log) error {
+		c.Add(l)
+		if c.Full() {
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Page(), nil
+}
+
+// EachLog calls fn for every log matching q in chain order, without holding
+// more than Span blocks of logs. The range runs from q.FromBlock to q.ToBlock,
+// nil meaning the head when the scan starts. fn runs on the caller's
+// goroutine, so a slow consumer slows the scan; the scan ends when ctx is
+// done or fn returns an error, ErrStop ending it without one
+func EachLog(ctx context.Context, client *ethclient.Client, q ethereum.FilterQuery, fn func(types.Log) error) error {
+	if q.BlockHash != nil {
+		logs, err := client.FilterLogs(ctx, q)
+		if err != nil {
+			return err
+		}
+		return Stopped(Each(ctx, logs, fn))
+	}
+
+	var from, to uint64
+	if q.FromBlock != nil {
+		from = q.FromBlock.Uint64()
+	}
+	if q.ToBlock != nil {
+		to = q.ToBlock.Uint64()
+	} else {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		to = head
+	}
+
+	for lo := from; lo <= to; lo += Span {
+		window := q
+		window.FromBlock, window.ToBlock = new(big.Int).SetUint64(lo), new(big.Int).SetUint64(min(lo+Span-1, to))
+		logs, err := client.FilterLogs(ctx, window)
+		if err != nil {
+			return err
+		}
+		live := logs[:0]
+		for _, l := range logs {
+			if !l.Removed {
+				live = append(live, l)
+			}
+		}
+		if err := Each(ctx, live, fn); err != nil {
+			return Stopped(err)
+		}
+	}
+	return nil
+}
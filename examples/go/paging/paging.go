@@ -0,0 +1,141 @@
+package paging
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	// DefaultLimit is the page size when a request sets none
+	DefaultLimit = 50
+	// MaxLimit caps the page size a caller may ask for
+	MaxLimit = 500
+)
+
+// ErrInvalidCursor is returned for cursors this package did not issue
+var ErrInvalidCursor = errors.New("paging: invalid cursor")
+
+// Request asks for the page following Cursor; an empty cursor asks for the
+// first page
+type Request struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// ParseRequest reads the cursor and limit query parameters
+func ParseRequest(values url.Values) (Request, error) {
+	r := Request{Cursor: values.Get("cursor")}
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Request{}, errors.New("paging: invalid limit")
+		}
+		r.Limit = n
+	}
+	if _, err := r.Key(); err != nil {
+		return Request{}, err
+	}
+	return r, nil
+}
+
+// Size returns the page size after applying the default and the maximum
+func (r Request) Size() int {
+	switch {
+	case r.Limit <= 0:
+		return DefaultLimit
+	case r.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return r.Limit
+}
+
+// Key returns the sort key the cursor resumes after; empty for the first page
+func (r Request) Key() (string, error) {
+	if r.Cursor == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(r.Cursor)
+	if err != nil || len(b) == 0 {
+		return "", ErrInvalidCursor
+	}
+	return string(b), nil
+}
+
+// Cursor makes the opaque cursor resuming after an item's sort key. Callers
+// must treat cursors as opaque; only the API that issued one understands it
+func Cursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// Page is one page of results; each API documents its order
+type Page[T any] struct {
+	Items   []T    `json:"items"`
+	Next    string `json:"next,omitempty"` // cursor for the following page
+	HasMore bool   `json:"hasMore"`
+}
+
+// Collector builds a page in ascending key order from items offered in any
+// order, keeping only the page and one lookahead item so memory stays
+// bounded by the page size
+type Collector[T any] struct {
+	after string
+	size  int
+	key   func(T) string
+	items []T
+	keys  []string
+}
+
+// NewCollector creates a collector for the page r asks for, ordering items
+// by key. Keys must be unique and sort as strings
+func NewCollector[T any](r Request, key func(T) string) (*Collector[T], error) {
+	after, err := r.Key()
+	if err != nil {
+		return nil, err
+	}
+	return &Collector[T]{after: after, size: r.Size(), key: key}, nil
+}
+
+// Add offers an item; items at or before the cursor or past the page are
+// dropped
+func (c *Collector[T]) Add(item T) {
+	k := c.key(item)
+	if c.after != "" && k <= c.after {
+		return
+	}
+	i := sort.SearchStrings(c.keys, k)
+	if i > c.size || i < len(c.keys) && c.keys[i] == k {
+		return
+	}
+	var zero T
+	c.items = append(c.items, zero)
+	c.keys = append(c.keys, "")
+	copy(c.items[i+1:], c.items[i:])
+	copy(c.keys[i+1:], c.keys[i:])
+	c.items[i], c.keys[i] = item, k
+	if len(c.items) > c.size+1 {
+		c.items, c.keys = c.items[:c.size+1], c.keys[:c.size+1]
+	}
+}
+
+// Full reports whether the page and its lookahead item are collected. Scans
+// offering items in ascending key order can stop once it is
+func (c *Collector[T]) Full() bool {
+	return len(c.items) > c.size
+}
+
+// Page returns the collected page
+func (c *Collector[T]) Page() *Page[T] {
+	p := &Page[T]{Items: c.items}
+	if p.Items == nil {
+		p.Items = []T{}
+	}
+	if len(c.items) > c.size {
+		p.Items = c.items[:c.size]
+		p.Next = Cursor(c.keys[c.size-1])
+		p.HasMore = true
+	}
+	return p
+}
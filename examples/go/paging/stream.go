@@ -0,0 +1,32 @@
+package paging
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStop is returned by a streaming callback to end the scan early; the
+// scan then returns nil
+var ErrStop = errors.New("paging: stop")
+
+// Stopped maps ErrStop to nil, for streaming scans to return
+func Stopped(err error) error {
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+	return err
+}
+
+// Each calls fn for items in order, stopping when ctx is done or fn fails.
+// Streaming scans use it on each bounded batch they fetch
+func Each[T any](ctx context.Context, items []T, fn func(T) error) error {
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package paperbackup
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// EncryptKeystore returns the key as Web3 Secret Storage (V3) JSON, which
+// any Ethereum wallet can import with the passphrase
+func EncryptKeystore(key *ecdsa.PrivateKey, passphrase string) ([]byte, error) {
+	return wallet.EncryptKeystore(key, passphrase)
+}
+
+// DecryptKeystore decrypts V3 keystore JSON
+func DecryptKeystore(data []byte, passphrase string) (*ecdsa.PrivateKey, error) {
+	return wallet.DecryptKeystore(data, passphrase)
+}
@@ -0,0 +1,89 @@
+package paperbackup
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// SeedQRFormat selects between the two SeedQR encodings
+type SeedQRFormat int
+
+const (
+	// Standard encodes each word as its 4-digit BIP-39 index in a numeric QR
+	Standard SeedQRFormat = iota
+	// Compact encodes the raw entropy in a binary QR
+	Compact
+)
+
+// EncodeSeedQR returns the SeedQR payload for a 12 or 24 word mnemonic
+func EncodeSeedQR(mnemonic string, format SeedQRFormat) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) != 12 && len(words) != 24 {
+		return nil, errors.New("SeedQR supports 12 and 24 word mnemonics")
+	}
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, errors.New("invalid mnemonic")
+	}
+	if format == Compact {
+		return bip39.EntropyFromMnemonic(mnemonic)
+	}
+
+	var sb strings.Builder
+	for _, w := range words {
+		index, _ := bip39.GetWordIndex(w)
+		fmt.Fprintf(&sb, "%04d", index)
+	}
+	return []byte(sb.String()), nil
+}
+
+// DecodeSeedQR restores the mnemonic from a Standard or Compact SeedQR payload
+func DecodeSeedQR(payload []byte) (string, error) {
+	switch len(payload) {
+	case 16, 32:
+		return bip39.NewMnemonic(payload)
+	case 48, 96:
+		list := bip39.GetWordList()
+		words := make([]string, 0, len(payload)/4)
+		for i := 0; i < len(payload); i += 4 {
+			index, err := strconv.Atoi(string(payload[i : i+4]))
+			if err != nil || index < 0 || index >= len(list) {
+				return "", errors.New("malformed SeedQR digits")
+			}
+			words = append(words, list[index])
+		}
+		mnemonic := strings.Join(words, " ")
+		if !bip39.IsMnemonicValid(mnemonic) {
+			return "", errors.New("SeedQR mnemonic fails its checksum")
+		}
+		return mnemonic, nil
+	default:
+		return "", fmt.Errorf("unrecognised SeedQR payload of %d bytes", len(payload))
+	}
+}
+
+// CheckDigits returns a four digit code derived from data. It is printed on
+// the backup and recomputed on import to confirm the restored secret
+func CheckDigits(data []byte) string {
+	h := sha256.Sum256(append([]byte("whisperchain-paper-backup:"), data...))
+	return fmt.Sprintf("%04d", binary.BigEndian.Uint32(h[:4])%10000)
+}
+
+// RowCheck returns a two digit check for a row of words, weighted by position
+// so swapped words are caught when a row is typed back in by hand
+func RowCheck(words []string) (string, error) {
+	sum := 0
+	for i, w := range words {
+		index, ok := bip39.GetWordIndex(w)
+		if !ok {
+			return "", fmt.Errorf("%q is not a BIP-39 word", w)
+		}
+		sum += (i + 1) * (index + 1)
+	}
+	return fmt.Sprintf("%02d", sum%97), nil
+}
@@ -0,0 +1,179 @@
+package paperbackup
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/skip2/go-qrcode"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Kind is what a backup sheet holds
+type Kind string
+
+const (
+	KindSeed     Kind = "seed"
+	KindKeystore Kind = "keystore"
+)
+
+// wordsPerRow is how many mnemonic words share a row check
+const wordsPerRow = 4
+
+// Row is a numbered group of mnemonic words with its check digits
+type Row struct {
+	First int // number of the first word, starting at 1
+	Words []string
+	Check string
+}
+
+// Sheet is a printable paper backup
+type Sheet struct {
+	Kind    Kind
+	Created time.Time
+	Payload []byte         // QR content
+	Rows    []Row          // seed sheets only
+	Address common.Address // keystore sheets only
+	Check   string
+}
+
+// NewSeedSheet builds a SeedQR backup for a mnemonic
+func NewSeedSheet(mnemonic string, format SeedQRFormat) (*Sheet, error) {
+	payload, err := EncodeSeedQR(mnemonic, format)
+	if err != nil {
+		return nil, err
+	}
+	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(mnemonic)
+	s := &Sheet{Kind: KindSeed, Created: time.Now().UTC(), Payload: payload, Check: CheckDigits(entropy)}
+	for i := 0; i < len(words); i += wordsPerRow {
+		row := words[i:min(i+wordsPerRow, len(words))]
+		check, err := RowCheck(row)
+		if err != nil {
+			return nil, err
+		}
+		s.Rows = append(s.Rows, Row{First: i + 1, Words: row, Check: check})
+	}
+	return s, nil
+}
+
+// NewKeystoreSheet builds an encrypted keystore backup; the passphrase is
+// needed to restore it and should be stored separately
+func NewKeystoreSheet(key *ecdsa.PrivateKey, passphrase string) (*Sheet, error) {
+	if passphrase == "" {
+		return nil, errors.New("keystore backups need a passphrase")
+	}
+	payload, err := EncryptKeystore(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &Sheet{
+		Kind:    KindKeystore,
+		Created: time.Now().UTC(),
+		Payload: payload,
+		Address: crypto.PubkeyToAddress(key.PublicKey),
+		Check:   CheckDigits(crypto.FromECDSA(key)),
+	}, nil
+}
+
+// QR renders the payload. Seeds use low error correction so the code stays
+// small enough to transcribe by hand, as the SeedQR specification expects
+func (s *Sheet) QR() (*qrcode.QRCode, error) {
+	level := qrcode.Medium
+	if s.Kind == KindSeed {
+		level = qrcode.Low
+	}
+	return qrcode.New(string(s.Payload), level)
+}
+
+// Terminal renders the QR code with block characters for display in a terminal
+func (s *Sheet) Terminal() (string, error) {
+	q, err := s.QR()
+	if err != nil {
+		return "", err
+	}
+	return q.ToSmallString(false), nil
+}
+
+var sheetTemplate = template.Must(template.New("sheet").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>WhisperChain {{.Kind}} backup</title>
+<style>
+body { font-family: monospace; margin: 2cm; }
+table { border-collapse: collapse; margin-top: 1em; }
+td { border: 1px solid #000; padding: 4px 10px; }
+.check { font-weight: bold; }
+</style></head><body>
+<h1>WhisperChain {{.Kind}} backup</h1>
+<p>Created {{.Created.Format "2006-01-02"}} &middot; check digits <span class="check">{{.Check}}</span></p>
+<img src="data:image/png;base64,{{.Image}}" width="320" height="320" alt="backup QR code">
+{{if .Rows}}<table>
+{{range .Rows}}<tr><td>{{.First}}.</td>{{range .Words}}<td>{{.}}</td>{{end}}<td class="check">{{.Check}}</td></tr>
+{{end}}</table>{{end}}
+{{if eq .Kind "keystore"}}<p>Address {{.Address.Hex}}</p>
+<p>The QR code holds an encrypted keystore. Its passphrase is not on this sheet.</p>{{end}}
+</body></html>
+`))
+
+// WriteHTML writes a printable page with the QR code, word grid and check digits
+func (s *Sheet) WriteHTML(w io.Writer) error {
+	q, err := s.QR()
+	if err != nil {
+		return err
+	}
+	png, err := q.PNG(640)
+	if err != nil {
+		return err
+	}
+	return sheetTemplate.Execute(w, struct {
+		*Sheet
+		Image string
+	}{s, base64.StdEncoding.EncodeToString(png)})
+}
+
+// Restored is the secret recovered from a scanned backup
+type Restored struct {
+	Kind     Kind
+	Mnemonic string
+	Key      *ecdsa.PrivateKey
+	Check    string // compare with the check digits printed on the sheet
+}
+
+// Import restores a backup from a scanned QR payload; the passphrase is only
+// used for keystore backups
+func Import(payload []byte, passphrase string) (*Restored, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if json.Valid(trimmed) && len(trimmed) > 0 && trimmed[0] == '{' {
+		key, err := DecryptKeystore(trimmed, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return &Restored{Kind: KindKeystore, Key: key, Check: CheckDigits(crypto.FromECDSA(key))}, nil
+	}
+
+	// Scanners that type into a terminal add a trailing newline to numeric
+	// codes; compact codes are binary and must not be trimmed
+	if len(trimmed) == 48 || len(trimmed) == 96 {
+		payload = trimmed
+	}
+	mnemonic, err := DecodeSeedQR(payload)
+	if err != nil {
+		return nil, err
+	}
+	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	return &Restored{Kind: KindSeed, Mnemonic: mnemonic, Check: CheckDigits(entropy)}, nil
+}
@@ -0,0 +1,353 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// invoicePrefix is the store key prefix for invoices
+const invoicePrefix = "invoice/"
+
+var (
+	// ErrNoInvoice is returned when no open invoice matches a transfer
+	ErrNoInvoice = errors.New("payments: no open invoice for transfer")
+	// ErrInvoiceExists is returned when creating an invoice with a used ID
+	ErrInvoiceExists = errors.New("payments: invoice already exists")
+	// ErrNothingToRefund is returned when an invoice has no unrefunded excess
+	ErrNothingToRefund = errors.New("payments: invoice is not overpaid")
+)
+
+// InvoiceStatus is how far an invoice has been paid
+type InvoiceStatus string
+
+const (
+	InvoiceUnpaid    InvoiceStatus = "unpaid"
+	InvoicePartial   InvoiceStatus = "partial"
+	InvoicePaid      InvoiceStatus = "paid"
+	InvoiceOverpaid  InvoiceStatus = "overpaid" // paid, with an excess not yet refunded
+	InvoiceCancelled InvoiceStatus = "cancelled"
+)
+
+// Refund is a transaction returning an invoice's excess to its payer
+type Refund struct {
+	TxHash  common.Hash       `json:"txHash"`
+	To      common.Address    `json:"to"`
+	Amount  units.TokenAmount `json:"amount"`
+	Created time.Time         `json:"created"`
+}
+
+// Invoice asks for an amount of one asset at a payee address. Any number of
+// transfers may pay it; their total is compared to Amount
+type Invoice struct {
+	ID        string             `json:"id"`
+	Payee     common.Address     `json:"payee"`
+	Payer     common.Address     `json:"payer"`  // zero accepts any sender
+	Asset     common.Address     `json:"asset"`  // Amount's token; set by Create
+	Amount    units.TokenAmount  `json:"amount"` // in units.Native for ETH
+	Created   time.Time          `json:"created"`
+	Due       time.Time          `json:"due,omitempty"`
+	Cancelled bool               `json:"cancelled,omitempty"`
+	Payments  []indexer.Transfer `json:"payments,omitempty"`
+	Refunds   []Refund           `json:"refunds,omitempty"`
+}
+
+// Received returns the total of the payments applied to the invoice
+func (inv *Invoice) Received() units.TokenAmount {
+	total := new(big.Int)
+	for _, p := range inv.Payments {
+		total.Add(total, p.Amount.Base())
+	}
+	return inv.amount(total)
+}
+
+// Refunded returns the total refunded to payers
+func (inv *Invoice) Refunded() units.TokenAmount {
+	total := new(big.Int)
+	for _, r := range inv.Refunds {
+		total.Add(total, r.Amount.Base())
+	}
+	return inv.amount(total)
+}
+
+// Remaining returns how much is still owed, zero once paid
+func (inv *Invoice) Remaining() units.TokenAmount {
+	rest := new(big.Int).Sub(inv.Amount.Base(), inv.Received().Base())
+	if rest.Sign() < 0 {
+		rest.SetInt64(0)
+	}
+	return inv.amount(rest)
+}
+
+// Excess returns the overpayment not refunded yet
+func (inv *Invoice) Excess() units.TokenAmount {
+	excess := new(big.Int).Sub(inv.Received().Base(), inv.Amount.Base())
+	excess.Sub(excess, inv.Refunded().Base())
+	if excess.Sign() < 0 {
+		excess.SetInt64(0)
+	}
+	return inv.amount(excess)
+}
+
+// amount wraps base units in the invoice's token. Payments match on the
+// asset address alone, so totals are kept in base units rather than
+// combined as amounts whose token details may come from different sources
+func (inv *Invoice) amount(base *big.Int) units.TokenAmount {
+	return units.NewTokenAmount(inv.Amount.Token(), base)
+}
+
+// Status classifies the invoice from its payments and refunds
+func (inv *Invoice) Status() InvoiceStatus {
+	switch {
+	case inv.Cancelled:
+		return InvoiceCancelled
+	case inv.Excess().Sign() > 0:
+		return InvoiceOverpaid
+	case inv.Remaining().Sign() == 0:
+		return InvoicePaid
+	case len(inv.Payments) > 0:
+		return InvoicePartial
+	}
+	return InvoiceUnpaid
+}
+
+// Matches reports whether t pays toward the invoice
+func (inv *Invoice) Matches(t *indexer.Transfer) bool {
+	if t.Asset != inv.Asset || t.To != inv.Payee {
+		return false
+	}
+	return inv.Payer == (common.Address{}) || t.From == inv.Payer
+}
+
+// Apply adds a payment to the invoice. It reports false for a transfer that
+// was already applied
+func (inv *Invoice) Apply(t indexer.Transfer) (bool, error) {
+	if !inv.Matches(&t) {
+		return false, fmt.Errorf("transfer %s does not pay invoice %s", t.TxHash.Hex(), inv.ID)
+	}
+	for _, p := range inv.Payments {
+		if p.TxHash == t.TxHash && p.LogIndex == t.LogIndex {
+			return false, nil
+		}
+	}
+	inv.Payments = append(inv.Payments, t)
+	return true, nil
+}
+
+// RefundTo returns who an overpayment goes back to: the sender of the
+// payment that pushed the total past the amount
+func (inv *Invoice) RefundTo() common.Address {
+	if p := inv.overpayment(); p != nil {
+		return p.From
+	}
+	return inv.Payer
+}
+
+// overpayment returns the payment that pushed the total past the amount
+func (inv *Invoice) overpayment() *indexer.Transfer {
+	total := new(big.Int)
+	for i := range inv.Payments {
+		total.Add(total, inv.Payments[i].Amount.Base())
+		if total.Cmp(inv.Amount.Base()) > 0 {
+			return &inv.Payments[i]
+		}
+	}
+	return nil
+}
+
+// Invoices keeps invoices in a store and applies incoming transfers to them
+type Invoices struct {
+	Store storage.Store
+	Links *indexer.Links // optional; links refunds to the overpayment
+	Clock clock.Clock    // dates invoices and refunds; nil is the wall clock
+}
+
+// NewInvoices creates an invoice book backed by store
+func NewInvoices(store storage.Store) *Invoices {
+	return &Invoices{Store: store}
+}
+
+// Create saves a new invoice
+func (b *Invoices) Create(ctx context.Context, inv *Invoice) error {
+	if inv.ID == "" {
+		return errors.New("invoice ID is required")
+	}
+	if inv.Amount.Sign() <= 0 {
+		return errors.New("invoice amount must be positive")
+	}
+	inv.Asset = inv.Amount.Token().Address
+	if inv.Payee == (common.Address{}) {
+		return errors.New("invoice payee is required")
+	}
+	if _, err := b.Store.Get(ctx, invoicePrefix+inv.ID); err == nil {
+		return ErrInvoiceExists
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if inv.Created.IsZero() {
+		inv.Created = clock.Or(b.Clock).Now().UTC()
+	}
+	return b.save(ctx, inv)
+}
+
+// Get loads an invoice
+func (b *Invoices) Get(ctx context.Context, id string) (*Invoice, error) {
+	data, err := b.Store.Get(ctx, invoicePrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	var inv Invoice
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// List returns every invoice, ordered by ID
+func (b *Invoices) List(ctx context.Context) ([]*Invoice, error) {
+	keys, err := b.Store.List(ctx, invoicePrefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Invoice, 0, len(keys))
+	for _, key := range keys {
+		inv, err := b.Get(ctx, key[len(invoicePrefix):])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, inv)
+	}
+	return out, nil
+}
+
+// Remaining returns how much is still owed on an invoice
+func (b *Invoices) Remaining(ctx context.Context, id string) (units.TokenAmount, error) {
+	inv, err := b.Get(ctx, id)
+	if err != nil {
+		return units.TokenAmount{}, err
+	}
+	return inv.Remaining(), nil
+}
+
+// Cancel closes an invoice to further payments
+func (b *Invoices) Cancel(ctx context.Context, id string) error {
+	inv, err := b.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	inv.Cancelled = true
+	return b.save(ctx, inv)
+}
+
+// Apply adds an incoming transfer to the oldest matching invoice that is
+// still owed money, or to the one it was already applied to. Feed it settled
+// transfers, such as the output of confirm.Settler.Settle, so reorged
+// payments never count. It returns ErrNoInvoice when nothing matches
+func (b *Invoices) Apply(ctx context.Context, t indexer.Transfer) (*Invoice, error) {
+	invoices, err := b.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var target *Invoice
+	for _, inv := range invoices {
+		if !inv.Matches(&t) {
+			continue
+		}
+		for _, p := range inv.Payments {
+			if p.TxHash == t.TxHash && p.LogIndex == t.LogIndex {
+				return inv, nil
+			}
+		}
+		if inv.Cancelled || inv.Remaining().Sign() == 0 {
+			continue
+		}
+		if target == nil || inv.Created.Before(target.Created) {
+			target = inv
+		}
+	}
+	if target == nil {
+		return nil, ErrNoInvoice
+	}
+	if _, err := target.Apply(t); err != nil {
+		return nil, err
+	}
+	return target, b.save(ctx, target)
+}
+
+// Refund builds and signs a transaction returning an invoice's excess from
+// w, which must hold the payee address. The refund is recorded before it is
+// returned, so calling again does not refund twice; the caller broadcasts it
+func (b *Invoices) Refund(ctx context.Context, w *wallet.Wallet, id string, opts *wallet.TxOpts) (*types.Transaction, error) {
+	inv, err := b.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if w.Address != inv.Payee {
+		return nil, fmt.Errorf("wallet %s is not the invoice payee %s", w.Address.Hex(), inv.Payee.Hex())
+	}
+	excess := inv.Excess()
+	if excess.Sign() == 0 {
+		return nil, ErrNothingToRefund
+	}
+	to := inv.RefundTo()
+	if to == (common.Address{}) {
+		return nil, errors.New("no payer to refund")
+	}
+
+	tx, err := buildRefund(ctx, w, to, excess, opts)
+	if err != nil {
+		return nil, err
+	}
+	tx, err = w.SignTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if p := inv.overpayment(); b.Links != nil && p != nil {
+		link := &indexer.RefundLink{Original: p.TxHash, LogIndex: p.LogIndex, Refund: tx.Hash(), Asset: inv.Asset, Amount: excess}
+		if err := b.Links.Link(ctx, link); err != nil {
+			return nil, err
+		}
+	}
+	inv.Refunds = append(inv.Refunds, Refund{TxHash: tx.Hash(), To: to, Amount: excess, Created: clock.Or(b.Clock).Now().UTC()})
+	if err := b.save(ctx, inv); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (b *Invoices) save(ctx context.Context, inv *Invoice) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return b.Store.Put(ctx, invoicePrefix+inv.ID, data)
+}
+
+// buildRefund prepares an unsigned transfer of amount to to
+func buildRefund(ctx context.Context, w *wallet.Wallet, to common.Address, amount units.TokenAmount, opts *wallet.TxOpts) (*types.Transaction, error) {
+	if value, err := amount.Wei(); err == nil {
+		return w.BuildTx(ctx, to, value, opts)
+	}
+	o := wallet.TxOpts{}
+	if opts != nil {
+		o = *opts
+	}
+	data, err := contract.TransferData(to, amount.Base())
+	if err != nil {
+		return nil, err
+	}
+	o.Data = data
+	return w.BuildTx(ctx, amount.Token().Address, units.Wei{}, &o)
+}
@@ -0,0 +1,174 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// ReceiptVersion is the current receipt document format version. Version 2
+// carries the amount with its token's symbol and decimals
+const ReceiptVersion = 2
+
+// NativeAsset is the asset address used for ETH payments
+var NativeAsset = common.Address{}
+
+// Receipt is a signed, portable record of a completed payment
+type Receipt struct {
+	Version     int               `json:"version"`
+	ChainID     *hexutil.Big      `json:"chainId"`
+	Payer       common.Address    `json:"payer"`
+	Payee       common.Address    `json:"payee"`
+	Asset       common.Address    `json:"asset"`
+	Amount      units.TokenAmount `json:"amount"`
+	TxHash      common.Hash       `json:"txHash"`
+	BlockNumber uint64            `json:"blockNumber"`
+	BlockHash   common.Hash       `json:"blockHash"`
+	Timestamp   uint64            `json:"timestamp"`
+	Issuer      common.Address    `json:"issuer"`
+	Signature   hexutil.Bytes     `json:"signature,omitempty"`
+}
+
+// IsNative reports whether the receipt is for an ETH payment
+func (r *Receipt) IsNative() bool {
+	return r.Asset == NativeAsset
+}
+
+// SigningPayload returns the canonical bytes covered by the signature
+func (r *Receipt) SigningPayload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Encode serializes the receipt as a JSON document
+func (r *Receipt) Encode() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// DecodeReceipt parses a receipt document produced by Encode
+func DecodeReceipt(data []byte) (*Receipt, error) {
+	var r Receipt
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Version != ReceiptVersion {
+		return nil, fmt.Errorf("unsupported receipt version %d", r.Version)
+	}
+	return &r, nil
+}
+
+// IssueReceipt builds and signs a receipt for a confirmed transfer
+func IssueReceipt(ctx context.Context, w *wallet.Wallet, txHash common.Hash) (*Receipt, error) {
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rcpt, err := client.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		return nil, errors.New("transaction failed")
+	}
+
+	tx, _, err := client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := client.HeaderByHash(ctx, rcpt.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	payer, err := client.TransactionSender(ctx, tx, rcpt.BlockHash, rcpt.TransactionIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Receipt{
+		Version:     ReceiptVersion,
+		ChainID:     (*hexutil.Big)(tx.ChainId()),
+		Payer:       payer,
+		Asset:       NativeAsset,
+		TxHash:      txHash,
+		BlockNumber: rcpt.BlockNumber.Uint64(),
+		BlockHash:   rcpt.BlockHash,
+		Timestamp:   header.Time,
+		Issuer:      w.Address,
+	}
+
+	if len(tx.Data()) == 0 {
+		if tx.To() == nil {
+			return nil, errors.New("contract creation is not a payment")
+		}
+		r.Payee = *tx.To()
+		r.Amount = units.NewWei(tx.Value()).Amount()
+	} else {
+		log := findTransferLog(rcpt.Logs, payer)
+		if log == nil {
+			return nil, errors.New("no token transfer found in transaction")
+		}
+		// Tokens without readable metadata, which ERC-20 makes optional,
+		// are receipted in base units
+		token, err := contract.NewERC20(log.Address, client).Token(ctx)
+		if err != nil {
+			token = units.Token{Address: log.Address}
+		}
+		r.Asset = log.Address
+		r.Payee = common.BytesToAddress(log.Topics[2].Bytes())
+		r.Amount = units.NewTokenAmount(token, new(big.Int).SetBytes(log.Data))
+	}
+
+	if err := SignReceipt(w, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SignReceipt sets the issuer and signature of a receipt
+func SignReceipt(w *wallet.Wallet, r *Receipt) error {
+	r.Issuer = w.Address
+	payload, err := r.SigningPayload()
+	if err != nil {
+		return err
+	}
+	sig, err := w.SignMessage(payload)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// VerifyReceipt checks the receipt signature against its issuer offline
+func VerifyReceipt(r *Receipt) bool {
+	payload, err := r.SigningPayload()
+	if err != nil {
+		return false
+	}
+	return wallet.VerifySignature(payload, r.Signature, r.Issuer)
+}
+
+// findTransferLog returns the first ERC-20 Transfer log sent by from
+func findTransferLog(logs []*types.Log, from common.Address) *types.Log {
+	for _, l := range logs {
+		if len(l.Topics) != 3 || l.Topics[0] != contract.TransferTopic {
+			continue
+		}
+		if common.BytesToAddress(l.Topics[1].Bytes()) == from {
+			return l
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// ErrRefundExceeds is returned when a refund is larger than what is left of
+// the original payment
+var ErrRefundExceeds = errors.New("payments: refund exceeds the unrefunded payment")
+
+// Refunder returns payments received by a wallet and links each refund to
+// its original in the index
+type Refunder struct {
+	Wallet *wallet.Wallet
+	Links  *indexer.Links
+	Opts   *wallet.TxOpts // optional fee and gas overrides
+}
+
+// NewRefunder creates a refunder for payments received by w
+func NewRefunder(w *wallet.Wallet, links *indexer.Links) *Refunder {
+	return &Refunder{Wallet: w, Links: links}
+}
+
+// Refund sends amount back to the payer of the original transaction. The
+// amount must be in the asset it was paid in, the original must have
+// succeeded and paid the wallet, and refunds so far plus amount may not
+// exceed what it paid. The link is recorded before broadcasting and removed
+// if the broadcast fails
+func (r *Refunder) Refund(ctx context.Context, originalTxHash common.Hash, amount units.TokenAmount) (*types.Transaction, error) {
+	if amount.Sign() <= 0 {
+		return nil, errors.New("refund amount must be positive")
+	}
+	paid, err := r.payment(ctx, originalTxHash, amount.Token())
+	if err != nil {
+		return nil, err
+	}
+	if paid.Asset != amount.Token().Address {
+		return nil, fmt.Errorf("%w: %s paid in %s", units.ErrTokenMismatch, originalTxHash.Hex(), paid.Asset.Hex())
+	}
+	refunded, err := r.Links.Refunded(ctx, paid)
+	if err != nil {
+		return nil, err
+	}
+	if new(big.Int).Add(refunded.Base(), amount.Base()).Cmp(paid.Amount.Base()) > 0 {
+		return nil, fmt.Errorf("%w: paid %s, refunded %s", ErrRefundExceeds, paid.Amount, refunded)
+	}
+
+	tx, err := buildRefund(ctx, r.Wallet, paid.From, amount, r.Opts)
+	if err != nil {
+		return nil, err
+	}
+	tx, err = r.Wallet.SignTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	link := &indexer.RefundLink{
+		Original: originalTxHash,
+		LogIndex: paid.LogIndex,
+		Refund:   tx.Hash(),
+		Asset:    paid.Asset,
+		Amount:   amount,
+	}
+	if err := r.Links.Link(ctx, link); err != nil {
+		return nil, err
+	}
+	client, err := r.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		r.Links.Unlink(ctx, originalTxHash, tx.Hash())
+		return nil, err
+	}
+	return tx, nil
+}
+
+// payment finds the transfer to the wallet in a successful transaction;
+// token describes the amount when the payment is in that token
+func (r *Refunder) payment(ctx context.Context, txHash common.Hash, token units.Token) (*indexer.Transfer, error) {
+	w := r.Wallet
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rcpt, err := client.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		return nil, errors.New("original transaction failed")
+	}
+	tx, _, err := client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx.To() != nil && *tx.To() == w.Address && tx.Value().Sign() > 0 {
+		payer, err := client.TransactionSender(ctx, tx, rcpt.BlockHash, rcpt.TransactionIndex)
+		if err != nil {
+			return nil, err
+		}
+		return &indexer.Transfer{Asset: NativeAsset, From: payer, To: w.Address, Amount: units.NewWei(tx.Value()).Amount(), TxHash: txHash}, nil
+	}
+	for _, l := range rcpt.Logs {
+		if len(l.Topics) != 3 || l.Topics[0] != contract.TransferTopic || len(l.Data) != 32 {
+			continue
+		}
+		if common.BytesToAddress(l.Topics[2].Bytes()) != w.Address {
+			continue
+		}
+		if token.Address != l.Address {
+			token = units.Token{Address: l.Address}
+		}
+		return &indexer.Transfer{
+			Asset:    l.Address,
+			From:     common.BytesToAddress(l.Topics[1].Bytes()),
+			To:       w.Address,
+			Amount:   units.NewTokenAmount(token, new(big.Int).SetBytes(l.Data)),
+			TxHash:   txHash,
+			LogIndex: l.Index,
+		}, nil
+	}
+	return nil, fmt.Errorf("transaction %s did not pay %s", txHash.Hex(), w.Address.Hex())
+}
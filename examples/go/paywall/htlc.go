@@ -0,0 +1,117 @@
+package paywall
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+)
+
+// htlcABIJSON is the ABI of the WhisperChain hashed timelock contract. Locks
+// are keyed by hashlock = keccak256(preimage); the receiver claims with the
+// preimage before the timelock, after which the sender may refund
+const htlcABIJSON = `[
+{"type":"function","name":"lock","stateMutability":"payable","inputs":[{"name":"hashlock","type":"bytes32"},{"name":"receiver","type":"address"},{"name":"timelock","type":"uint64"}],"outputs":[]},
+{"type":"function","name":"claim","stateMutability":"nonpayable","inputs":[{"name":"hashlock","type":"bytes32"},{"name":"preimage","type":"bytes32"}],"outputs":[]},
+{"type":"function","name":"refund","stateMutability":"nonpayable","inputs":[{"name":"hashlock","type":"bytes32"}],"outputs":[]},
+{"type":"function","name":"locks","stateMutability":"view","inputs":[{"name":"hashlock","type":"bytes32"}],"outputs":[{"name":"","type":"tuple","components":[{"name":"sender","type":"address"},{"name":"receiver","type":"address"},{"name":"amount","type":"uint256"},{"name":"timelock","type":"uint64"},{"name":"claimed","type":"bool"},{"name":"refunded","type":"bool"}]}]},
+{"type":"event","name":"Locked","anonymous":false,"inputs":[{"name":"hashlock","type":"bytes32","indexed":true},{"name":"sender","type":"address","indexed":true},{"name":"receiver","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false},{"name":"timelock","type":"uint64","indexed":false}]},
+{"type":"event","name":"Claimed","anonymous":false,"inputs":[{"name":"hashlock","type":"bytes32","indexed":true},{"name":"preimage","type":"bytes32","indexed":false}]},
+{"type":"event","name":"Refunded","anonymous":false,"inputs":[{"name":"hashlock","type":"bytes32","indexed":true}]}
+]`
+
+var htlcABI = mustParseABI(htlcABIJSON)
+
+// ErrNotClaimed is returned when a lock has no claim yet
+var ErrNotClaimed = errors.New("paywall: lock not claimed")
+
+// Lock is the on-chain record of a hashlocked payment
+type Lock struct {
+	Sender   common.Address
+	Receiver common.Address
+	Amount   *big.Int
+	Timelock uint64
+	Claimed  bool
+	Refunded bool
+}
+
+// Exists reports whether anything was locked under the hashlock
+func (l *Lock) Exists() bool {
+	return l.Sender != (common.Address{})
+}
+
+// HTLC wraps the hashed timelock contract
+type HTLC struct {
+	Address  common.Address
+	Client   *ethclient.Client
+	contract *bind.BoundContract
+}
+
+// NewHTLC creates a new HTLC instance
+func NewHTLC(address common.Address, client *ethclient.Client) *HTLC {
+	return &HTLC{
+		Address:  address,
+		Client:   client,
+		contract: bind.NewBoundContract(address, htlcABI, client, client, client),
+	}
+}
+
+// Lock locks auth.Value for receiver under hashlock until the unix timelock
+func (h *HTLC) Lock(auth *bind.TransactOpts, hashlock common.Hash, receiver common.Address, timelock uint64) (*types.Transaction, error) {
+	return h.contract.Transact(auth, "lock", [32]byte(hashlock), receiver, timelock)
+}
+
+// Claim takes the locked funds by revealing the preimage
+func (h *HTLC) Claim(auth *bind.TransactOpts, hashlock, preimage common.Hash) (*types.Transaction, error) {
+	return h.contract.Transact(auth, "claim", [32]byte(hashlock), [32]byte(preimage))
+}
+
+// Refund returns unclaimed funds to the sender after the timelock
+func (h *HTLC) Refund(auth *bind.TransactOpts, hashlock common.Hash) (*types.Transaction, error) {
+	return h.contract.Transact(auth, "refund", [32]byte(hashlock))
+}
+
+// LockInfo returns the on-chain record for a hashlock
+func (h *HTLC) LockInfo(ctx context.Context, hashlock common.Hash) (*Lock, error) {
+	lock, err := contract.Call[Lock](ctx, h.contract, "locks", [32]byte(hashlock))
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// Preimage returns the preimage revealed by the claim of hashlock, searching
+// from block start
+func (h *HTLC) Preimage(ctx context.Context, hashlock common.Hash, start uint64) (common.Hash, error) {
+	logs, err := h.Client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(start),
+		Addresses: []common.Address{h.Address},
+		Topics:    [][]common.Hash{{htlcABI.Events["Claimed"].ID}, {hashlock}},
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for _, l := range logs {
+		if l.Removed || len(l.Data) != 32 {
+			continue
+		}
+		return common.BytesToHash(l.Data), nil
+	}
+	return common.Hash{}, ErrNotClaimed
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
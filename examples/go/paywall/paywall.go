@@ -0,0 +1,495 @@
+package paywall
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/entropy"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const (
+	// Topic is the messaging topic of purchase requests and quotes
+	Topic = "paywall"
+	// MessagePurchase carries a Purchase
+	MessagePurchase = "paywall.purchase"
+	// MessageQuote carries a Quote
+	MessageQuote = "paywall.quote"
+)
+
+// OfferVersion is the current offer format
+const OfferVersion = 1
+
+// Store key prefixes
+const (
+	keyPrefix   = "paywall/key/"   // <offer id> -> content key
+	quotePrefix = "paywall/quote/" // <hashlock> -> pendingQuote
+)
+
+var (
+	// ErrUnknownOffer is returned for offers this seller did not publish
+	ErrUnknownOffer = errors.New("paywall: unknown offer")
+	// ErrWrongKey is returned when the released key does not open the content
+	ErrWrongKey = errors.New("paywall: released key does not match the offer")
+)
+
+// Offer is paid content published on a channel. The content is encrypted
+// under a key each buyer receives wrapped under a secret that the seller
+// reveals on-chain to collect the payment
+type Offer struct {
+	Version    int            `json:"version"`
+	ID         common.Hash    `json:"id"` // hash of the ciphertext
+	Seller     common.Address `json:"seller"`
+	ChainID    *hexutil.Big   `json:"chainId"`
+	HTLC       common.Address `json:"htlc"`
+	Price      *hexutil.Big   `json:"price"` // wei
+	Title      string         `json:"title"`
+	KeyHash    common.Hash    `json:"keyHash"` // keccak256 of the content key
+	Ciphertext hexutil.Bytes  `json:"ciphertext"`
+	Signature  hexutil.Bytes  `json:"signature,omitempty"`
+}
+
+// SigningPayload returns the canonical bytes covered by the signature
+func (o *Offer) SigningPayload() ([]byte, error) {
+	unsigned := *o
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Verify checks the offer signature and that the ID matches the content
+func (o *Offer) Verify() bool {
+	if crypto.Keccak256Hash(o.Ciphertext) != o.ID {
+		return false
+	}
+	payload, err := o.SigningPayload()
+	if err != nil {
+		return false
+	}
+	return wallet.VerifySignature(payload, o.Signature, o.Seller)
+}
+
+// Purchase asks the seller for a quote
+type Purchase struct {
+	OfferID common.Hash `json:"offerId"`
+}
+
+// Quote tells a buyer what to lock: Price under Hashlock for the seller,
+// with a timelock no earlier than Deadline. WrappedKey is the content key
+// encrypted under the hashlock's preimage
+type Quote struct {
+	OfferID    common.Hash    `json:"offerId"`
+	Buyer      common.Address `json:"buyer"`
+	Hashlock   common.Hash    `json:"hashlock"`
+	WrappedKey hexutil.Bytes  `json:"wrappedKey"`
+	Price      *hexutil.Big   `json:"price"`
+	Deadline   int64          `json:"deadline"` // unix seconds
+}
+
+// pendingQuote is a quote awaiting payment, kept by the seller
+type pendingQuote struct {
+	Quote    Quote       `json:"quote"`
+	Preimage common.Hash `json:"preimage"`
+	Issued   time.Time   `json:"issued"`
+}
+
+// Seller publishes offers, answers purchases and claims payments
+type Seller struct {
+	Wallet      *wallet.Wallet
+	HTLC        *HTLC
+	Sender      messaging.Sender
+	Store       storage.Store
+	Audit       audit.Log
+	LockPeriod  time.Duration // minimum time buyers must lock funds for
+	ClaimMargin time.Duration // locks expiring sooner than this are not claimed
+	Rand        io.Reader     // content keys, preimages and nonces; nil is crypto/rand
+	Clock       clock.Clock   // dates quotes and checks lock deadlines; nil is the wall clock
+}
+
+// NewSeller creates a seller collecting payments through htlc
+func NewSeller(w *wallet.Wallet, htlc *HTLC, sender messaging.Sender, store storage.Store, auditLog audit.Log) *Seller {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Seller{
+		Wallet:      w,
+		HTLC:        htlc,
+		Sender:      sender,
+		Store:       store,
+		Audit:       auditLog,
+		LockPeriod:  24 * time.Hour,
+		ClaimMargin: 10 * time.Minute,
+	}
+}
+
+// Publish encrypts content under a fresh key and returns the signed offer
+// to distribute on a channel
+func (s *Seller) Publish(ctx context.Context, title string, content []byte, price *big.Int) (*Offer, error) {
+	client, err := s.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if err := entropy.Read(s.Rand, key); err != nil {
+		return nil, err
+	}
+	ciphertext, err := encrypt(s.Rand, key, content)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Offer{
+		Version:    OfferVersion,
+		ID:         crypto.Keccak256Hash(ciphertext),
+		Seller:     s.Wallet.Address,
+		ChainID:    (*hexutil.Big)(chainID),
+		HTLC:       s.HTLC.Address,
+		Price:      (*hexutil.Big)(price),
+		Title:      title,
+		KeyHash:    crypto.Keccak256Hash(key),
+		Ciphertext: ciphertext,
+	}
+	payload, err := o.SigningPayload()
+	if err != nil {
+		return nil, err
+	}
+	if o.Signature, err = s.Wallet.SignMessage(payload); err != nil {
+		return nil, err
+	}
+	if err := s.Store.Put(ctx, keyPrefix+o.ID.Hex(), key); err != nil {
+		return nil, err
+	}
+	s.record(ctx, "offer-published", o.ID, "ok", map[string]string{"price": price.String()})
+	return o, nil
+}
+
+// HandlePurchase answers a purchase request with a quote bound to a fresh
+// secret for that buyer, so one buyer's claim reveals nothing to others
+func (s *Seller) HandlePurchase(ctx context.Context, env *messaging.Envelope, offer *Offer) (*Quote, error) {
+	if !env.Verify() {
+		return nil, errors.New("invalid envelope")
+	}
+	msg, err := messaging.OpenMessage(env, s.Wallet.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessagePurchase {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	var p Purchase
+	if err := msg.Decode(&p); err != nil {
+		return nil, err
+	}
+	if p.OfferID != offer.ID || offer.Seller != s.Wallet.Address {
+		return nil, ErrUnknownOffer
+	}
+	key, err := s.Store.Get(ctx, keyPrefix+offer.ID.Hex())
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrUnknownOffer
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var preimage common.Hash
+	if err := entropy.Read(s.Rand, preimage[:]); err != nil {
+		return nil, err
+	}
+	wrapped, err := encrypt(s.Rand, wrappingKey(preimage), key)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Or(s.Clock).Now()
+	q := Quote{
+		OfferID:    offer.ID,
+		Buyer:      env.Sender,
+		Hashlock:   crypto.Keccak256Hash(preimage[:]),
+		WrappedKey: wrapped,
+		Price:      offer.Price,
+		Deadline:   now.Add(s.LockPeriod).Unix(),
+	}
+	data, err := json.Marshal(&pendingQuote{Quote: q, Preimage: preimage, Issued: now.UTC()})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.Put(ctx, quotePrefix+q.Hashlock.Hex(), data); err != nil {
+		return nil, err
+	}
+
+	buyerKey, err := env.SenderKey()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := messaging.NewMessage(MessageQuote, &q)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := messaging.SealMessage(s.Wallet, buyerKey, Topic, reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Sender.Send(ctx, sealed); err != nil {
+		return nil, err
+	}
+	s.record(ctx, "quote-issued", offer.ID, "pending", map[string]string{"buyer": env.Sender.Hex(), "hashlock": q.Hashlock.Hex()})
+	return &q, nil
+}
+
+// Settle claims every quoted lock that is funded for the seller with at
+// least the price and enough time left, revealing its secret to the buyer.
+// It returns the hashlocks claimed
+func (s *Seller) Settle(ctx context.Context) ([]common.Hash, error) {
+	keys, err := s.Store.List(ctx, quotePrefix)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []common.Hash
+	for _, key := range keys {
+		data, err := s.Store.Get(ctx, key)
+		if err != nil {
+			return claimed, err
+		}
+		var pq pendingQuote
+		if err := json.Unmarshal(data, &pq); err != nil {
+			return claimed, err
+		}
+		q := pq.Quote
+
+		lock, err := s.HTLC.LockInfo(ctx, q.Hashlock)
+		if err != nil {
+			return claimed, err
+		}
+		now := clock.Or(s.Clock).Now()
+		expired := now.Add(-s.LockPeriod).After(time.Unix(q.Deadline, 0))
+		switch {
+		case lock.Claimed || lock.Refunded:
+			s.Store.Delete(ctx, key)
+			continue
+		case !lock.Exists():
+			if expired {
+				s.Store.Delete(ctx, key)
+				s.record(ctx, "quote-expired", q.OfferID, "expired", map[string]string{"hashlock": q.Hashlock.Hex()})
+			}
+			continue
+		case lock.Receiver != s.Wallet.Address || lock.Amount.Cmp(q.Price.ToInt()) < 0:
+			continue // not a valid payment; the buyer can refund it
+		case now.Add(s.ClaimMargin).After(time.Unix(int64(lock.Timelock), 0)):
+			continue // too close to the refund window to claim safely
+		}
+
+		auth, err := s.Wallet.TransactOpts(chainID)
+		if err != nil {
+			return claimed, err
+		}
+		auth.Context = ctx
+		tx, err := s.HTLC.Claim(auth, q.Hashlock, pq.Preimage)
+		if err != nil {
+			return claimed, fmt.Errorf("claim %s: %w", q.Hashlock.Hex(), err)
+		}
+		s.Store.Delete(ctx, key)
+		s.record(ctx, "payment-claimed", q.OfferID, "claimed", map[string]string{
+			"buyer":    q.Buyer.Hex(),
+			"hashlock": q.Hashlock.Hex(),
+			"tx":       tx.Hash().Hex(),
+		})
+		claimed = append(claimed, q.Hashlock)
+	}
+	return claimed, nil
+}
+
+// Schedule registers Settle with a scheduler
+func (s *Seller) Schedule(sch *scheduler.Scheduler, interval time.Duration) error {
+	return sch.Every("paywall-settle", interval, func(ctx context.Context) error {
+		_, err := s.Settle(ctx)
+		return err
+	})
+}
+
+func (s *Seller) record(ctx context.Context, action string, offer common.Hash, outcome string, details map[string]string) {
+	s.Audit.Record(ctx, audit.Entry{
+		Actor:   s.Wallet.Address.Hex(),
+		Action:  action,
+		Subject: offer.Hex(),
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+// Buyer purchases and unlocks offers
+type Buyer struct {
+	Wallet *wallet.Wallet
+	HTLC   *HTLC
+	Sender messaging.Sender
+}
+
+// NewBuyer creates a buyer paying through htlc
+func NewBuyer(w *wallet.Wallet, htlc *HTLC, sender messaging.Sender) *Buyer {
+	return &Buyer{Wallet: w, HTLC: htlc, Sender: sender}
+}
+
+// Request asks the seller for a quote on offer
+func (b *Buyer) Request(ctx context.Context, sellerKey *ecdsa.PublicKey, offer *Offer) error {
+	if crypto.PubkeyToAddress(*sellerKey) != offer.Seller {
+		return errors.New("key does not belong to the offer's seller")
+	}
+	msg, err := messaging.NewMessage(MessagePurchase, &Purchase{OfferID: offer.ID})
+	if err != nil {
+		return err
+	}
+	env, err := messaging.SealMessage(b.Wallet, sellerKey, Topic, msg)
+	if err != nil {
+		return err
+	}
+	return b.Sender.Send(ctx, env)
+}
+
+// OpenQuote decodes the seller's quote and checks it against the offer
+func (b *Buyer) OpenQuote(env *messaging.Envelope, offer *Offer) (*Quote, error) {
+	if !env.Verify() || env.Sender != offer.Seller {
+		return nil, errors.New("quote is not from the offer's seller")
+	}
+	msg, err := messaging.OpenMessage(env, b.Wallet.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessageQuote {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	var q Quote
+	if err := msg.Decode(&q); err != nil {
+		return nil, err
+	}
+	if q.OfferID != offer.ID || q.Buyer != b.Wallet.Address {
+		return nil, errors.New("quote is for another offer or buyer")
+	}
+	if q.Price == nil || q.Price.ToInt().Cmp(offer.Price.ToInt()) != 0 {
+		return nil, errors.New("quoted price differs from the offer")
+	}
+	return &q, nil
+}
+
+// Pay locks the quoted price for the seller until the quote's deadline
+func (b *Buyer) Pay(ctx context.Context, offer *Offer, q *Quote) (*types.Transaction, error) {
+	if !offer.Verify() {
+		return nil, errors.New("invalid offer")
+	}
+	if offer.HTLC != b.HTLC.Address {
+		return nil, fmt.Errorf("offer is paid through %s", offer.HTLC.Hex())
+	}
+	client, err := b.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if offer.ChainID == nil || offer.ChainID.ToInt().Cmp(chainID) != 0 {
+		return nil, errors.New("offer is for a different chain")
+	}
+	auth, err := b.Wallet.TransactOpts(chainID)
+	if err != nil {
+		return nil, err
+	}
+	auth.Context = ctx
+	auth.Value = q.Price.ToInt()
+	return b.HTLC.Lock(auth, q.Hashlock, offer.Seller, uint64(q.Deadline))
+}
+
+// Unlock decrypts the content once the seller has claimed the payment,
+// searching for the claim from block start. It returns ErrNotClaimed until then
+func (b *Buyer) Unlock(ctx context.Context, offer *Offer, q *Quote, start uint64) ([]byte, error) {
+	preimage, err := b.HTLC.Preimage(ctx, q.Hashlock, start)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decrypt(wrappingKey(preimage), q.WrappedKey)
+	if err != nil || crypto.Keccak256Hash(key) != offer.KeyHash {
+		return nil, ErrWrongKey
+	}
+	return decrypt(key, offer.Ciphertext)
+}
+
+// Refund recovers the payment after the deadline if the seller never claimed
+func (b *Buyer) Refund(ctx context.Context, q *Quote) (*types.Transaction, error) {
+	client, err := b.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := b.Wallet.TransactOpts(chainID)
+	if err != nil {
+		return nil, err
+	}
+	auth.Context = ctx
+	return b.HTLC.Refund(auth, q.Hashlock)
+}
+
+// wrappingKey derives the key that wraps the content key from a preimage
+func wrappingKey(preimage common.Hash) []byte {
+	return crypto.Keccak256([]byte("whisperchain/paywall/wrap"), preimage[:])
+}
+
+// encrypt seals plaintext with AES-256-GCM, prefixing a nonce from rand
+func encrypt(rand io.Reader, key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if err := entropy.Read(rand, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"path"
+	"sync"
+)
+
+// Effect is the outcome a rule produces when it matches
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Request describes an action a subject wants to perform
+type Request struct {
+	Subject    string
+	Action     string
+	Resource   string
+	Attributes map[string]string
+}
+
+// Rule matches requests by glob patterns on subject, action and resource.
+// Empty pattern lists match everything; Match, if set, must also return true.
+type Rule struct {
+	Name      string                 `json:"name"`
+	Effect    Effect                 `json:"effect"`
+	Subjects  []string               `json:"subjects,omitempty"`
+	Actions   []string               `json:"actions,omitempty"`
+	Resources []string               `json:"resources,omitempty"`
+	Match     func(req Request) bool `json:"-"` // not persisted
+}
+
+// Decision is the result of evaluating a request
+type Decision struct {
+	Allowed bool
+	Rule    string // name of the deciding rule; empty when the default applied
+}
+
+// Engine evaluates requests against an ordered rule set; the first matching
+// rule decides
+type Engine struct {
+	DefaultAllow bool
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// NewEngine creates an engine with the given rules
+func NewEngine(defaultAllow bool, rules ...Rule) *Engine {
+	return &Engine{DefaultAllow: defaultAllow, rules: rules}
+}
+
+// SetRules atomically replaces the rule set
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = append([]Rule(nil), rules...)
+}
+
+// Reset atomically replaces the rule set and the default decision, so no
+// request is evaluated against the new rules with the old default
+func (e *Engine) Reset(defaultAllow bool, rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.DefaultAllow = defaultAllow
+	e.rules = append([]Rule(nil), rules...)
+}
+
+// Rules returns a copy of the current rule set
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Rule(nil), e.rules...)
+}
+
+// Evaluate decides a request
+func (e *Engine) Evaluate(req Request) Decision {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, r := range e.rules {
+		if r.matches(req) {
+			return Decision{Allowed: r.Effect == Allow, Rule: r.Name}
+		}
+	}
+	return Decision{Allowed: e.DefaultAllow}
+}
+
+func (r *Rule) matches(req Request) bool {
+	if !matchAny(r.Subjects, req.Subject) || !matchAny(r.Actions, req.Action) || !matchAny(r.Resources, req.Resource) {
+		return false
+	}
+	return r.Match == nil || r.Match(req)
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, value); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+)
+
+const aggregatorABIJSON = `[
+	{"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+	{"inputs":[],"name":"latestRoundData","outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"}
+]`
+
+var aggregatorABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(aggregatorABIJSON))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// roundData is the output of latestRoundData
+type roundData struct {
+	RoundId         *big.Int
+	Answer          *big.Int
+	StartedAt       *big.Int
+	UpdatedAt       *big.Int
+	AnsweredInRound *big.Int
+}
+
+// Chainlink is a Source backed by Chainlink AggregatorV3 price feeds. It only
+// serves current prices; requests for times older than MaxAge before the
+// latest round return ErrNoPrice.
+type Chainlink struct {
+	Client *ethclient.Client
+	Feeds  map[common.Address]common.Address // asset -> fiat-denominated feed
+	MaxAge time.Duration                     // maximum staleness of a round; zero disables the check
+}
+
+// NewChainlink creates a feed-backed price source
+func NewChainlink(client *ethclient.Client, maxAge time.Duration) *Chainlink {
+	return &Chainlink{Client: client, Feeds: make(map[common.Address]common.Address), MaxAge: maxAge}
+}
+
+// Price reads the latest round of the asset's feed
+func (c *Chainlink) Price(ctx context.Context, asset common.Address, at time.Time) (*big.Rat, error) {
+	feed, ok := c.Feeds[asset]
+	if !ok {
+		return nil, ErrNoPrice
+	}
+	aggregator := bind.NewBoundContract(feed, aggregatorABI, c.Client, nil, nil)
+	opts := &bind.CallOpts{Context: ctx}
+
+	decimals, err := contract.CallOpts[uint8](opts, aggregator, "decimals")
+	if err != nil {
+		return nil, err
+	}
+	round, err := contract.CallOpts[roundData](opts, aggregator, "latestRoundData")
+	if err != nil {
+		return nil, err
+	}
+	if round.Answer.Sign() <= 0 {
+		return nil, fmt.Errorf("feed %s returned non-positive answer", feed.Hex())
+	}
+	if c.MaxAge > 0 && at.Sub(time.Unix(round.UpdatedAt.Int64(), 0)) > c.MaxAge {
+		return nil, ErrNoPrice
+	}
+	return Units(round.Answer, decimals), nil
+}
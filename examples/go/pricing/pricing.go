@@ -0,0 +1,117 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrNoPrice is returned when no price is known for an asset at a time
+var ErrNoPrice = errors.New("pricing: no price available")
+
+// Source returns the fiat price of one whole unit of an asset at a point in time
+type Source interface {
+	Price(ctx context.Context, asset common.Address, at time.Time) (*big.Rat, error)
+}
+
+// Static is a Source with fixed prices, useful for stablecoins and examples
+type Static map[common.Address]*big.Rat
+
+// Price returns the fixed price of asset
+func (s Static) Price(ctx context.Context, asset common.Address, at time.Time) (*big.Rat, error) {
+	p, ok := s[asset]
+	if !ok {
+		return nil, ErrNoPrice
+	}
+	return new(big.Rat).Set(p), nil
+}
+
+type point struct {
+	at    time.Time
+	price *big.Rat
+}
+
+// History is an in-memory price history. Lookups return the latest price at
+// or before the requested time that is no older than MaxAge.
+type History struct {
+	MaxAge time.Duration // zero accepts any age
+
+	mu     sync.RWMutex
+	points map[common.Address][]point
+}
+
+// NewHistory creates an empty price history
+func NewHistory(maxAge time.Duration) *History {
+	return &History{MaxAge: maxAge, points: make(map[common.Address][]point)}
+}
+
+// Add records the price of asset at a time
+func (h *History) Add(asset common.Address, at time.Time, price *big.Rat) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pts := h.points[asset]
+	i := sort.Search(len(pts), func(i int) bool { return !pts[i].at.Before(at) })
+	if i < len(pts) && pts[i].at.Equal(at) {
+		pts[i].price = new(big.Rat).Set(price)
+		return
+	}
+	pts = append(pts, point{})
+	copy(pts[i+1:], pts[i:])
+	pts[i] = point{at: at, price: new(big.Rat).Set(price)}
+	h.points[asset] = pts
+}
+
+// Price returns the price of asset in effect at the given time
+func (h *History) Price(ctx context.Context, asset common.Address, at time.Time) (*big.Rat, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	pts := h.points[asset]
+	i := sort.Search(len(pts), func(i int) bool { return pts[i].at.After(at) })
+	if i == 0 {
+		return nil, ErrNoPrice
+	}
+	p := pts[i-1]
+	if h.MaxAge > 0 && at.Sub(p.at) > h.MaxAge {
+		return nil, ErrNoPrice
+	}
+	return new(big.Rat).Set(p.price), nil
+}
+
+// Chain tries sources in order and returns the first price found
+type Chain []Source
+
+// Price returns the first available price
+func (c Chain) Price(ctx context.Context, asset common.Address, at time.Time) (*big.Rat, error) {
+	for _, s := range c {
+		p, err := s.Price(ctx, asset, at)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, ErrNoPrice) {
+			return nil, err
+		}
+	}
+	return nil, ErrNoPrice
+}
+
+// Units converts an amount in base units to whole units
+func Units(amount *big.Int, decimals uint8) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(amount, scale)
+}
+
+// Value returns the fiat value of an amount in base units
+func Value(ctx context.Context, src Source, asset common.Address, amount *big.Int, decimals uint8, at time.Time) (*big.Rat, error) {
+	price, err := src.Price(ctx, asset, at)
+	if err != nil {
+		return nil, err
+	}
+	return price.Mul(price, Units(amount, decimals)), nil
+}
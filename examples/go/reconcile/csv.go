@@ -0,0 +1,84 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// csvHeader is the column layout read by ReadExpected
+var csvHeader = []string{"reference", "asset", "from", "to", "amount", "time"}
+
+// ReadExpected parses expected deposits from a CSV export with the columns
+// reference, asset, from, to, amount (base units) and time (RFC 3339). Empty
+// asset and from columns mean ETH and any sender.
+func ReadExpected(r io.Reader) ([]Expected, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 0 && rows[0][0] == csvHeader[0] {
+		rows = rows[1:]
+	}
+
+	out := make([]Expected, 0, len(rows))
+	for i, row := range rows {
+		if len(row) != len(csvHeader) {
+			return nil, fmt.Errorf("row %d: expected %d columns, got %d", i+1, len(csvHeader), len(row))
+		}
+		e := Expected{Reference: row[0]}
+		for _, f := range []struct {
+			value string
+			dst   *common.Address
+		}{{row[1], &e.Asset}, {row[2], &e.From}, {row[3], &e.To}} {
+			if f.value == "" {
+				continue
+			}
+			if !common.IsHexAddress(f.value) {
+				return nil, fmt.Errorf("row %d: invalid address %q", i+1, f.value)
+			}
+			*f.dst = common.HexToAddress(f.value)
+		}
+		if e.To == (common.Address{}) {
+			return nil, fmt.Errorf("row %d: missing recipient", i+1)
+		}
+		amount, ok := new(big.Int).SetString(row[4], 10)
+		if !ok {
+			return nil, fmt.Errorf("row %d: invalid amount %q", i+1, row[4])
+		}
+		e.Amount = amount
+		if e.Time, err = time.Parse(time.RFC3339, row[5]); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// WriteReport writes the report as CSV for back-office review
+func WriteReport(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"status", "reference", "asset", "to", "expected_amount", "observed_amount", "delta", "tx_hash", "block"})
+	for _, res := range r.Results {
+		row := make([]string, 9)
+		row[0] = string(res.Status)
+		if e := res.Expected; e != nil {
+			row[1], row[2], row[3], row[4] = e.Reference, e.Asset.Hex(), e.To.Hex(), e.Amount.String()
+		}
+		if t := res.Observed; t != nil {
+			row[2], row[3], row[5] = t.Asset.Hex(), t.To.Hex(), t.Amount.String()
+			row[7], row[8] = t.TxHash.Hex(), strconv.FormatUint(t.BlockNumber, 10)
+		}
+		if res.Delta != nil {
+			row[6] = res.Delta.String()
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,201 @@
+package reconcile
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/indexer"
+)
+
+// Expected is a deposit the back office expects to see on-chain, such as an
+// exchange withdrawal or a paid invoice
+type Expected struct {
+	Reference string
+	Asset     common.Address // indexer.NativeAsset for ETH
+	From      common.Address // zero matches any sender
+	To        common.Address
+	Amount    *big.Int
+	Time      time.Time
+}
+
+// Tolerance controls how loosely expected and observed transfers may match
+type Tolerance struct {
+	Window    time.Duration // maximum distance between expected and block time
+	Amount    *big.Int      // absolute amount difference allowed
+	AmountBps int64         // relative difference allowed, in basis points of the expected amount
+}
+
+// Status classifies a reconciliation result
+type Status string
+
+const (
+	Matched        Status = "matched"
+	Unsettled      Status = "unsettled" // matched, but the transfer is not yet settled
+	AmountMismatch Status = "amount-mismatch"
+	Missing        Status = "missing"
+	Unexpected     Status = "unexpected"
+)
+
+// Result pairs an expected deposit with the observed transfer it matched
+type Result struct {
+	Status   Status
+	Expected *Expected         // nil for unexpected transfers
+	Observed *indexer.Transfer // nil for missing deposits
+	Delta    *big.Int          // observed minus expected amount, when both exist
+}
+
+// Report is the outcome of a reconciliation run
+type Report struct {
+	Results []Result
+}
+
+// Count returns the number of results with the given status
+func (r *Report) Count(s Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == s {
+			n++
+		}
+	}
+	return n
+}
+
+// Exceptions returns the results that need manual review; unsettled matches
+// only need time
+func (r *Report) Exceptions() []Result {
+	var out []Result
+	for _, res := range r.Results {
+		if res.Status != Matched && res.Status != Unsettled {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// SettledFunc reports whether an observed transfer has enough confirmations
+// to be acted on, such as confirm.Settler.Settled
+type SettledFunc func(ctx context.Context, t *indexer.Transfer) (bool, error)
+
+// Hold downgrades matches whose transfer is not settled yet to Unsettled, so
+// invoices are only fulfilled on settled funds. Errors abort the check
+func (r *Report) Hold(ctx context.Context, settled SettledFunc) error {
+	for i := range r.Results {
+		res := &r.Results[i]
+		if res.Status != Matched {
+			continue
+		}
+		ok, err := settled(ctx, res.Observed)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			res.Status = Unsettled
+		}
+	}
+	return nil
+}
+
+// Reconcile matches expected deposits to observed transfers. Each observed
+// transfer is used at most once. Expected deposits are first matched within
+// the amount tolerance, preferring the closest block time; the rest are paired
+// with any remaining transfer in the window as amount mismatches or reported
+// missing. Incoming transfers to an expected recipient that match nothing are
+// reported unexpected.
+func Reconcile(expected []Expected, observed []indexer.Transfer, tol Tolerance) *Report {
+	exp := append([]Expected(nil), expected...)
+	sort.SliceStable(exp, func(i, j int) bool { return exp[i].Time.Before(exp[j].Time) })
+
+	used := make([]bool, len(observed))
+	results := make([]*Result, len(exp))
+
+	for pass := 0; pass < 2; pass++ {
+		for i := range exp {
+			if results[i] != nil {
+				continue
+			}
+			best := -1
+			var bestDist time.Duration
+			for j := range observed {
+				if used[j] || !candidate(&exp[i], &observed[j], tol.Window) {
+					continue
+				}
+				if pass == 0 && !withinAmount(exp[i].Amount, observed[j].Amount.Base(), tol) {
+					continue
+				}
+				dist := distance(exp[i].Time, observed[j].Timestamp)
+				if best < 0 || dist < bestDist {
+					best, bestDist = j, dist
+				}
+			}
+			if best < 0 {
+				continue
+			}
+			used[best] = true
+			status := Matched
+			if pass == 1 {
+				status = AmountMismatch
+			}
+			results[i] = &Result{
+				Status:   status,
+				Expected: &exp[i],
+				Observed: &observed[best],
+				Delta:    new(big.Int).Sub(observed[best].Amount.Base(), exp[i].Amount),
+			}
+		}
+	}
+
+	report := &Report{}
+	recipients := make(map[common.Address]bool)
+	for i := range exp {
+		recipients[exp[i].To] = true
+		if results[i] == nil {
+			results[i] = &Result{Status: Missing, Expected: &exp[i]}
+		}
+		report.Results = append(report.Results, *results[i])
+	}
+	for j := range observed {
+		if !used[j] && recipients[observed[j].To] {
+			report.Results = append(report.Results, Result{Status: Unexpected, Observed: &observed[j]})
+		}
+	}
+	return report
+}
+
+func candidate(e *Expected, t *indexer.Transfer, window time.Duration) bool {
+	if t.Asset != e.Asset || t.To != e.To {
+		return false
+	}
+	if e.From != (common.Address{}) && t.From != e.From {
+		return false
+	}
+	return distance(e.Time, t.Timestamp) <= window
+}
+
+func withinAmount(expected, observed *big.Int, tol Tolerance) bool {
+	diff := new(big.Int).Sub(observed, expected)
+	diff.Abs(diff)
+
+	allowed := new(big.Int)
+	if tol.Amount != nil {
+		allowed.Set(tol.Amount)
+	}
+	if tol.AmountBps > 0 {
+		rel := new(big.Int).Mul(expected, big.NewInt(tol.AmountBps))
+		rel.Quo(rel, big.NewInt(10000))
+		if rel.Cmp(allowed) > 0 {
+			allowed = rel
+		}
+	}
+	return diff.Cmp(allowed) <= 0
+}
+
+func distance(t time.Time, unix uint64) time.Duration {
+	d := time.Unix(int64(unix), 0).Sub(t)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
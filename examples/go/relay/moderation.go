@@ -0,0 +1,189 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/messaging"
+)
+
+// Stage identifies where in the relay path a filter runs
+type Stage string
+
+const (
+	PreStore   Stage = "pre-store"
+	PreForward Stage = "pre-forward"
+)
+
+// Decision is the outcome of a moderation filter
+type Decision struct {
+	Allow  bool
+	Reason string
+}
+
+// Allow is the decision returned by filters that accept an envelope
+var Allow = Decision{Allow: true}
+
+// Reject returns a rejecting decision with a reason
+func Reject(format string, args ...interface{}) Decision {
+	return Decision{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Filter inspects envelope metadata and decides whether it may pass.
+// Filters only ever see encrypted envelopes, never plaintext.
+type Filter interface {
+	Name() string
+	Check(ctx context.Context, stage Stage, env *messaging.Envelope) (Decision, error)
+}
+
+// SizeFilter rejects envelopes larger than MaxBytes
+type SizeFilter struct {
+	MaxBytes int
+}
+
+// Name returns the filter name
+func (f *SizeFilter) Name() string { return "size" }
+
+// Check rejects oversized envelopes
+func (f *SizeFilter) Check(ctx context.Context, stage Stage, env *messaging.Envelope) (Decision, error) {
+	if size := env.Size(); size > f.MaxBytes {
+		return Reject("size %d exceeds limit %d", size, f.MaxBytes), nil
+	}
+	return Allow, nil
+}
+
+// AttachmentFilter rejects envelopes carrying disallowed attachment types
+type AttachmentFilter struct {
+	Allowed map[string]bool // if non-empty, only these types pass
+	Blocked map[string]bool
+}
+
+// Name returns the filter name
+func (f *AttachmentFilter) Name() string { return "attachment-type" }
+
+// Check rejects blocked or non-allowlisted attachment types
+func (f *AttachmentFilter) Check(ctx context.Context, stage Stage, env *messaging.Envelope) (Decision, error) {
+	for _, a := range env.Attachments {
+		if f.Blocked[a.Type] {
+			return Reject("attachment type %q is blocked", a.Type), nil
+		}
+		if len(f.Allowed) > 0 && !f.Allowed[a.Type] {
+			return Reject("attachment type %q is not allowed", a.Type), nil
+		}
+	}
+	return Allow, nil
+}
+
+// HashBlocklist rejects envelopes whose ciphertext or attachments match reported hashes
+type HashBlocklist struct {
+	mu     sync.RWMutex
+	hashes map[common.Hash]string
+}
+
+// NewHashBlocklist creates an empty blocklist
+func NewHashBlocklist() *HashBlocklist {
+	return &HashBlocklist{hashes: make(map[common.Hash]string)}
+}
+
+// Add blocks a content hash with a reason
+func (b *HashBlocklist) Add(hash common.Hash, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hashes[hash] = reason
+}
+
+// Remove unblocks a content hash
+func (b *HashBlocklist) Remove(hash common.Hash) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.hashes, hash)
+}
+
+// Contains reports whether a hash is blocked
+func (b *HashBlocklist) Contains(hash common.Hash) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.hashes[hash]
+	return ok
+}
+
+// Name returns the filter name
+func (b *HashBlocklist) Name() string { return "hash-blocklist" }
+
+// Check rejects envelopes containing a blocked hash
+func (b *HashBlocklist) Check(ctx context.Context, stage Stage, env *messaging.Envelope) (Decision, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if reason, ok := b.hashes[env.ContentHash()]; ok {
+		return Reject("content hash blocked: %s", reason), nil
+	}
+	for _, a := range env.Attachments {
+		if reason, ok := b.hashes[a.Hash]; ok {
+			return Reject("attachment hash blocked: %s", reason), nil
+		}
+	}
+	return Allow, nil
+}
+
+// moderate runs the filters for a stage, auditing every rejection and the final outcome
+func (r *Relay) moderate(ctx context.Context, stage Stage, env *messaging.Envelope) error {
+	r.mu.RLock()
+	filters := append([]Filter(nil), r.filters[stage]...)
+	r.mu.RUnlock()
+
+	for _, f := range filters {
+		d, err := f.Check(ctx, stage, env)
+		if err != nil {
+			return fmt.Errorf("filter %s: %w", f.Name(), err)
+		}
+		if !d.Allow {
+			r.auditModeration(ctx, stage, env, f.Name(), "rejected", d.Reason)
+			return &RejectedError{Stage: stage, Filter: f.Name(), Reason: d.Reason}
+		}
+	}
+	if len(filters) > 0 {
+		r.auditModeration(ctx, stage, env, "", "allowed", "")
+	}
+	return nil
+}
+
+// auditModeration records a moderation decision using envelope metadata only
+func (r *Relay) auditModeration(ctx context.Context, stage Stage, env *messaging.Envelope, filter, outcome, reason string) {
+	details := map[string]string{
+		"stage":        string(stage),
+		"topic":        env.Topic,
+		"sender":       env.Sender.Hex(),
+		"size":         strconv.Itoa(env.Size()),
+		"content_hash": env.ContentHash().Hex(),
+	}
+	if filter != "" {
+		details["filter"] = filter
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+
+	r.Audit.Record(ctx, audit.Entry{
+		Actor:   "relay",
+		Action:  "moderation",
+		Subject: env.ID.Hex(),
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+// RejectedError reports an envelope rejected by moderation
+type RejectedError struct {
+	Stage  Stage
+	Filter string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("relay: rejected at %s by %s: %s", e.Stage, e.Filter, e.Reason)
+}
@@ -0,0 +1,220 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/paging"
+	"github.com/whisperchain/go-examples/storage"
+)
+
+// envelopePrefix is the storage key prefix for relayed envelopes
+const envelopePrefix = "relay/envelope/"
+
+// ErrInvalidEnvelope is returned for envelopes with a bad ID or signature
+var ErrInvalidEnvelope = errors.New("relay: invalid envelope")
+
+// Forwarder delivers envelopes to the next hop or subscribers
+type Forwarder interface {
+	Forward(ctx context.Context, env *messaging.Envelope) error
+}
+
+// Relay stores and forwards envelopes through moderation hooks
+type Relay struct {
+	Store     storage.Store
+	Forwarder Forwarder
+	Audit     audit.Log
+	Metrics   *messaging.Metrics // optional, counts relayed and dropped envelopes and times store queries
+
+	mu      sync.RWMutex
+	filters map[Stage][]Filter
+}
+
+// New creates a relay; a nil audit log discards entries
+func New(store storage.Store, forwarder Forwarder, auditLog audit.Log) *Relay {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Relay{
+		Store:     store,
+		Forwarder: forwarder,
+		Audit:     auditLog,
+		filters:   make(map[Stage][]Filter),
+	}
+}
+
+// Use registers a moderation filter at a stage; filters run in registration order
+func (r *Relay) Use(stage Stage, f Filter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filters[stage] = append(r.filters[stage], f)
+}
+
+// Handle verifies, moderates, stores and forwards an envelope
+func (r *Relay) Handle(ctx context.Context, env *messaging.Envelope) error {
+	reason, err := r.handle(ctx, env)
+	if r.Metrics != nil {
+		if err != nil {
+			r.Metrics.Dropped(reason)
+		} else {
+			r.Metrics.Relayed()
+		}
+	}
+	return err
+}
+
+// handle relays env, returning the drop reason with any error
+func (r *Relay) handle(ctx context.Context, env *messaging.Envelope) (string, error) {
+	if !env.Verify() {
+		return messaging.DropInvalid, ErrInvalidEnvelope
+	}
+
+	if err := r.moderate(ctx, PreStore, env); err != nil {
+		return messaging.DropModerated, err
+	}
+
+	data, err := env.Encode()
+	if err != nil {
+		return messaging.DropStore, err
+	}
+	if err := r.Store.Put(ctx, envelopePrefix+env.ID.Hex(), data); err != nil {
+		return messaging.DropStore, err
+	}
+
+	if err := r.moderate(ctx, PreForward, env); err != nil {
+		return messaging.DropModerated, err
+	}
+	if r.Forwarder == nil {
+		return "", nil
+	}
+	if err := r.Forwarder.Forward(ctx, env); err != nil {
+		return messaging.DropForward, err
+	}
+	return "", nil
+}
+
+// Send implements messaging.Sender for in-process use of the relay
+func (r *Relay) Send(ctx context.Context, env *messaging.Envelope) error {
+	return r.Handle(ctx, env)
+}
+
+// Get returns a stored envelope by ID
+func (r *Relay) Get(ctx context.Context, id common.Hash) (*messaging.Envelope, error) {
+	data, err := r.Store.Get(ctx, envelopePrefix+id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return messaging.DecodeEnvelope(data)
+}
+
+// Envelopes returns the stored envelopes sent or received by addr with
+// timestamps in [since, until), oldest first. A zero addr matches every
+// envelope
+func (r *Relay) Envelopes(ctx context.Context, addr common.Address, since, until time.Time) ([]*messaging.Envelope, error) {
+	var envs []*messaging.Envelope
+	err := r.scan(ctx, Query{Participant: addr, Since: since, Until: until}, func(env *messaging.Envelope) {
+		envs = append(envs, env)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(envs, func(i, j int) bool { return envs[i].Timestamp < envs[j].Timestamp })
+	return envs, nil
+}
+
+// Resend implements messaging.Resender, so the relay can answer resend
+// requests as a store node: it returns the stored envelopes of the request
+// that were sealed to requester, in seq order
+func (r *Relay) Resend(ctx context.Context, requester common.Address, req *messaging.ResendRequest) ([]*messaging.Envelope, error) {
+	var envs []*messaging.Envelope
+	err := r.scan(ctx, Query{Sender: req.Sender, Recipient: requester, Topic: req.Topic}, func(env *messaging.Envelope) {
+		if env.Order != nil && env.Order.Seq >= req.From && env.Order.Seq <= req.To {
+			envs = append(envs, env)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Order.Seq < envs[j].Order.Seq })
+	return envs, nil
+}
+
+// Query selects stored envelopes; zero fields match everything
+type Query struct {
+	Participant common.Address // sender or recipient
+	Sender      common.Address
+	Recipient   common.Address
+	Topic       string
+	Since       time.Time
+	Until       time.Time
+}
+
+// Page returns a page of the envelopes matching q, oldest first, holding no
+// more than the page in memory
+func (r *Relay) Page(ctx context.Context, q Query, req paging.Request) (*paging.Page[*messaging.Envelope], error) {
+	c, err := paging.NewCollector(req, EnvelopeKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.scan(ctx, q, c.Add); err != nil {
+		return nil, err
+	}
+	return c.Page(), nil
+}
+
+// EnvelopeKey is the paging sort key of an envelope
+func EnvelopeKey(env *messaging.Envelope) string {
+	return fmt.Sprintf("%012d.%s", env.Timestamp, env.ID.Hex())
+}
+
+// scan calls fn for each stored envelope matching q, timing the query
+func (r *Relay) scan(ctx context.Context, q Query, fn func(*messaging.Envelope)) error {
+	if r.Metrics != nil {
+		start := time.Now()
+		defer func() { r.Metrics.StoreQuery(time.Since(start)) }()
+	}
+	keys, err := r.Store.List(ctx, envelopePrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		data, err := r.Store.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		env, err := messaging.DecodeEnvelope(data)
+		if err != nil {
+			return err
+		}
+		if q.Participant != (common.Address{}) && env.Sender != q.Participant && env.Recipient != q.Participant {
+			continue
+		}
+		if q.Sender != (common.Address{}) && env.Sender != q.Sender {
+			continue
+		}
+		if q.Recipient != (common.Address{}) && env.Recipient != q.Recipient {
+			continue
+		}
+		if q.Topic != "" && env.Topic != q.Topic {
+			continue
+		}
+		if !q.Since.IsZero() && env.Timestamp < q.Since.Unix() {
+			continue
+		}
+		if !q.Until.IsZero() && env.Timestamp >= q.Until.Unix() {
+			continue
+		}
+		fn(env)
+	}
+	return nil
+}
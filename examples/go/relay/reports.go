@@ -0,0 +1,161 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/messaging"
+)
+
+// reportPrefix is the storage key prefix for accepted abuse reports
+const reportPrefix = "relay/report/"
+
+var (
+	ErrInvalidReport   = errors.New("relay: invalid abuse report")
+	ErrDuplicateReport = errors.New("relay: duplicate abuse report")
+)
+
+// ReportDesk aggregates abuse reports and mutes senders that reach a threshold
+// of distinct reporters
+type ReportDesk struct {
+	Threshold int
+	MuteFor   time.Duration
+	Clock     clock.Clock // times mutes; nil is the wall clock
+
+	relay     *Relay
+	mu        sync.Mutex
+	reporters map[common.Address]map[common.Address]bool
+	muted     map[common.Address]time.Time
+}
+
+// NewReportDesk attaches report handling to a relay and installs its mute
+// list as a pre-store filter
+func NewReportDesk(r *Relay, threshold int, muteFor time.Duration) *ReportDesk {
+	d := &ReportDesk{
+		Threshold: threshold,
+		MuteFor:   muteFor,
+		relay:     r,
+		reporters: make(map[common.Address]map[common.Address]bool),
+		muted:     make(map[common.Address]time.Time),
+	}
+	r.Use(PreStore, d)
+	return d
+}
+
+// Submit validates and records a report, muting the offender at threshold
+func (d *ReportDesk) Submit(ctx context.Context, report *messaging.AbuseReport) error {
+	if !report.Verify() {
+		return ErrInvalidReport
+	}
+
+	env, err := d.relay.Get(ctx, report.EnvelopeID)
+	if err != nil {
+		return err
+	}
+	if !report.Matches(env) || report.Reporter == env.Sender {
+		return ErrInvalidReport
+	}
+
+	d.mu.Lock()
+	set := d.reporters[report.Offender]
+	if set == nil {
+		set = make(map[common.Address]bool)
+		d.reporters[report.Offender] = set
+	}
+	if set[report.Reporter] {
+		d.mu.Unlock()
+		return ErrDuplicateReport
+	}
+	set[report.Reporter] = true
+	count := len(set)
+	now := clock.Or(d.Clock).Now()
+	mute := count >= d.Threshold && !d.mutedLocked(report.Offender, now)
+	if mute {
+		d.muted[report.Offender] = now.Add(d.MuteFor)
+	}
+	d.mu.Unlock()
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	key := reportPrefix + report.EnvelopeID.Hex() + "/" + report.Reporter.Hex()
+	if err := d.relay.Store.Put(ctx, key, data); err != nil {
+		return err
+	}
+
+	d.relay.Audit.Record(ctx, audit.Entry{
+		Actor:   report.Reporter.Hex(),
+		Action:  "abuse-report",
+		Subject: report.EnvelopeID.Hex(),
+		Outcome: "accepted",
+		Details: map[string]string{
+			"offender": report.Offender.Hex(),
+			"reason":   string(report.Reason),
+			"count":    strconv.Itoa(count),
+		},
+	})
+	if mute {
+		d.relay.Audit.Record(ctx, audit.Entry{
+			Actor:   "relay",
+			Action:  "mute",
+			Subject: report.Offender.Hex(),
+			Outcome: "muted",
+			Details: map[string]string{"until": d.muted[report.Offender].UTC().Format(time.RFC3339)},
+		})
+	}
+	return nil
+}
+
+// Muted reports whether addr is currently muted
+func (d *ReportDesk) Muted(addr common.Address) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.mutedLocked(addr, clock.Or(d.Clock).Now())
+}
+
+// Unmute lifts a mute and clears the sender's report count
+func (d *ReportDesk) Unmute(addr common.Address) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.muted, addr)
+	delete(d.reporters, addr)
+}
+
+// ReportCount returns the number of distinct reporters against addr
+func (d *ReportDesk) ReportCount(addr common.Address) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.reporters[addr])
+}
+
+// Name returns the filter name
+func (d *ReportDesk) Name() string { return "mute-list" }
+
+// Check rejects envelopes from muted senders
+func (d *ReportDesk) Check(ctx context.Context, stage Stage, env *messaging.Envelope) (Decision, error) {
+	if d.Muted(env.Sender) {
+		return Reject("sender %s is muted", env.Sender.Hex()), nil
+	}
+	return Allow, nil
+}
+
+func (d *ReportDesk) mutedLocked(addr common.Address, now time.Time) bool {
+	until, ok := d.muted[addr]
+	if !ok {
+		return false
+	}
+	if now.After(until) {
+		delete(d.muted, addr)
+		delete(d.reporters, addr)
+		return false
+	}
+	return true
+}
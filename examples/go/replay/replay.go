@@ -0,0 +1,301 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// replayURL is the endpoint replayed clients are dialed at; nothing is ever
+// sent to it
+const replayURL = "http://replay.invalid"
+
+// ErrNotRecorded is returned when a replayed client makes a request the
+// session never made
+var ErrNotRecorded = errors.New("replay: request not in the recording")
+
+// Exchange is one recorded HTTP round trip to the node. Bodies are the raw
+// JSON-RPC request and response, single or batched
+type Exchange struct {
+	Seq      int             `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Method   string          `json:"method"` // first JSON-RPC method, for reading the file
+	Status   int             `json:"status"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Recorder is an http.RoundTripper that forwards requests to the node and
+// writes every exchange to a session file as JSON lines. Only HTTP endpoints
+// can be recorded; the URL, which often holds an API key, is not written
+type Recorder struct {
+	Base http.RoundTripper
+
+	mu  sync.Mutex
+	w   io.Writer
+	seq int
+}
+
+// NewRecorder records exchanges to w; a nil base uses http.DefaultTransport
+func NewRecorder(w io.Writer, base http.RoundTripper) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Recorder{Base: base, w: w}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	line, err := json.Marshal(Exchange{
+		Seq:      r.seq,
+		Time:     time.Now().UTC(),
+		Method:   firstMethod(reqBody),
+		Status:   resp.StatusCode,
+		Request:  compact(reqBody),
+		Response: compact(respBody),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("replay: writing session: %w", err)
+	}
+	return resp, nil
+}
+
+// DialRecording connects to an HTTP node, recording the session to w
+func DialRecording(ctx context.Context, url string, w io.Writer) (*ethclient.Client, error) {
+	client, err := rpc.DialOptions(ctx, url, rpc.WithHTTPClient(&http.Client{Transport: NewRecorder(w, nil)}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// Replayer is an http.RoundTripper answering from a recorded session. A
+// request is matched to a recorded one with the same body apart from its
+// JSON-RPC ids; repeated requests get their responses in recorded order, so
+// code that made the same calls gets the same answers
+type Replayer struct {
+	mu      sync.Mutex
+	pending map[string][]*Exchange
+	left    int
+}
+
+// Load reads a session written by a Recorder
+func Load(r io.Reader) (*Replayer, error) {
+	p := &Replayer{pending: make(map[string][]*Exchange)}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(sc.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("replay: exchange %d: %w", p.left+1, err)
+		}
+		key, _, err := normalize(ex.Request)
+		if err != nil {
+			return nil, fmt.Errorf("replay: exchange %d: %w", ex.Seq, err)
+		}
+		p.pending[key] = append(p.pending[key], &ex)
+		p.left++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadFile reads a session file
+func LoadFile(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// RoundTrip implements http.RoundTripper
+func (p *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	key, ids, err := normalize(body)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	queue := p.pending[key]
+	if len(queue) == 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, firstMethod(body))
+	}
+	ex := queue[0]
+	p.pending[key] = queue[1:]
+	p.left--
+	p.mu.Unlock()
+
+	_, recordedIDs, err := normalize(ex.Request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := renumber(ex.Response, recordedIDs, ids)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode:    ex.Status,
+		Status:        fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(resp)),
+		ContentLength: int64(len(resp)),
+		Request:       req,
+	}, nil
+}
+
+// Remaining returns how many recorded exchanges have not been replayed; a
+// faithful reproduction leaves none
+func (p *Replayer) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.left
+}
+
+// Client returns a node client answered by the recording
+func (p *Replayer) Client(ctx context.Context) (*ethclient.Client, error) {
+	client, err := rpc.DialOptions(ctx, replayURL, rpc.WithHTTPClient(&http.Client{Transport: p}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// normalize returns a request's body with its ids removed, as a matching
+// key, and the ids in order
+func normalize(body []byte) (string, []json.RawMessage, error) {
+	var batch []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &batch); err == nil {
+		ids := make([]json.RawMessage, len(batch))
+		for i, msg := range batch {
+			ids[i] = msg["id"]
+			delete(msg, "id")
+		}
+		key, err := json.Marshal(batch)
+		return string(key), ids, err
+	}
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return "", nil, fmt.Errorf("replay: not a JSON-RPC request: %w", err)
+	}
+	ids := []json.RawMessage{msg["id"]}
+	delete(msg, "id")
+	key, err := json.Marshal(msg)
+	return string(key), ids, err
+}
+
+// renumber rewrites the ids of a recorded response to the ids the replayed
+// request used
+func renumber(resp []byte, recorded, current []json.RawMessage) ([]byte, error) {
+	var text string
+	if json.Unmarshal(resp, &text) == nil {
+		// Not JSON, such as a proxy error page; recorded as a string
+		return []byte(text), nil
+	}
+	ids := make(map[string]json.RawMessage, len(recorded))
+	for i, id := range recorded {
+		if i < len(current) {
+			ids[string(id)] = current[i]
+		}
+	}
+	swap := func(msg map[string]json.RawMessage) {
+		if id, ok := ids[string(msg["id"])]; ok {
+			msg["id"] = id
+		}
+	}
+
+	var batch []map[string]json.RawMessage
+	if err := json.Unmarshal(resp, &batch); err == nil {
+		for _, msg := range batch {
+			swap(msg)
+		}
+		return json.Marshal(batch)
+	}
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(resp, &msg); err != nil {
+		return resp, nil
+	}
+	swap(msg)
+	return json.Marshal(msg)
+}
+
+func firstMethod(body []byte) string {
+	var probe struct {
+		Method string `json:"method"`
+	}
+	var batch []json.RawMessage
+	if json.Unmarshal(body, &batch) == nil && len(batch) > 0 {
+		body = batch[0]
+	}
+	json.Unmarshal(body, &probe)
+	return probe.Method
+}
+
+// readBody reads a body and puts back an unread copy
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// compact keeps a body as JSON in the session when it is JSON, and as a
+// string otherwise
+func compact(body []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if json.Compact(&buf, body) == nil && buf.Len() > 0 {
+		return buf.Bytes()
+	}
+	s, _ := json.Marshal(string(body))
+	return s
+}
@@ -0,0 +1,67 @@
+package reputation
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Behavior counts locally observed misbehavior per address
+type Behavior struct {
+	SpamPenalty float64 // score reduction factor per spam report
+	RatePenalty float64 // score reduction factor per rate-limit violation
+
+	mu         sync.Mutex
+	spam       map[common.Address]int
+	violations map[common.Address]int
+}
+
+// NewBehavior creates a behavior log with default penalties
+func NewBehavior() *Behavior {
+	return &Behavior{
+		SpamPenalty: 0.5,
+		RatePenalty: 0.1,
+		spam:        make(map[common.Address]int),
+		violations:  make(map[common.Address]int),
+	}
+}
+
+// ReportSpam records a spam report against addr
+func (b *Behavior) ReportSpam(addr common.Address) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spam[addr]++
+}
+
+// RecordRateViolation records a rate-limit violation by addr
+func (b *Behavior) RecordRateViolation(addr common.Address) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.violations[addr]++
+}
+
+// Reset clears all recorded behavior for addr
+func (b *Behavior) Reset(addr common.Address) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.spam, addr)
+	delete(b.violations, addr)
+}
+
+// Counts returns the spam reports and rate violations recorded for addr
+func (b *Behavior) Counts(addr common.Address) (spam, violations int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spam[addr], b.violations[addr]
+}
+
+// Name returns the signal name
+func (b *Behavior) Name() string { return "behavior" }
+
+// Score returns 1 for a clean address, decaying with each recorded incident
+func (b *Behavior) Score(ctx context.Context, addr common.Address) (float64, error) {
+	spam, violations := b.Counts(addr)
+	penalty := b.SpamPenalty*float64(spam) + b.RatePenalty*float64(violations)
+	return 1 / (1 + penalty), nil
+}
@@ -0,0 +1,111 @@
+package reputation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MaxScore is the score of a sender with perfect signals
+const MaxScore = 100.0
+
+// Signal produces a normalized score in [0, 1] for an address
+type Signal interface {
+	Name() string
+	Score(ctx context.Context, addr common.Address) (float64, error)
+}
+
+// Score is the combined reputation of an address
+type Score struct {
+	Address    common.Address
+	Value      float64
+	Components map[string]float64
+}
+
+type weightedSignal struct {
+	signal Signal
+	weight float64
+}
+
+// Engine combines weighted signals into a reputation score
+type Engine struct {
+	mu      sync.RWMutex
+	signals []weightedSignal
+}
+
+// NewEngine creates an engine with no signals
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Register adds a signal with the given relative weight
+func (e *Engine) Register(s Signal, weight float64) error {
+	if weight <= 0 {
+		return errors.New("weight must be positive")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, ws := range e.signals {
+		if ws.signal.Name() == s.Name() {
+			return fmt.Errorf("signal %q already registered", s.Name())
+		}
+	}
+	e.signals = append(e.signals, weightedSignal{signal: s, weight: weight})
+	return nil
+}
+
+// Score evaluates every signal for addr and returns the weighted result
+func (e *Engine) Score(ctx context.Context, addr common.Address) (*Score, error) {
+	e.mu.RLock()
+	signals := append([]weightedSignal(nil), e.signals...)
+	e.mu.RUnlock()
+
+	if len(signals) == 0 {
+		return nil, errors.New("no signals registered")
+	}
+
+	score := &Score{
+		Address:    addr,
+		Components: make(map[string]float64, len(signals)),
+	}
+
+	var total, weights float64
+	for _, ws := range signals {
+		v, err := ws.signal.Score(ctx, addr)
+		if err != nil {
+			return nil, fmt.Errorf("signal %s: %w", ws.signal.Name(), err)
+		}
+		v = clamp(v)
+		score.Components[ws.signal.Name()] = v
+		total += v * ws.weight
+		weights += ws.weight
+	}
+
+	score.Value = total / weights * MaxScore
+	return score, nil
+}
+
+// Admit reports whether addr meets the minimum score, e.g. for channel admission
+// or message filtering
+func (e *Engine) Admit(ctx context.Context, addr common.Address, minScore float64) (bool, *Score, error) {
+	score, err := e.Score(ctx, addr)
+	if err != nil {
+		return false, nil, err
+	}
+	return score.Value >= minScore, score, nil
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
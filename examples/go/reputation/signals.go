@@ -0,0 +1,129 @@
+package reputation
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/eas"
+)
+
+// ActivitySignal scores an address by its confirmed transaction count
+type ActivitySignal struct {
+	Client     *ethclient.Client
+	Saturation uint64 // transaction count that earns a full score
+}
+
+// Name returns the signal name
+func (s *ActivitySignal) Name() string { return "activity" }
+
+// Score returns nonce/Saturation capped at 1
+func (s *ActivitySignal) Score(ctx context.Context, addr common.Address) (float64, error) {
+	if s.Saturation == 0 {
+		return 0, errors.New("saturation must be positive")
+	}
+	nonce, err := s.Client.NonceAt(ctx, addr, nil)
+	if err != nil {
+		return 0, err
+	}
+	return float64(nonce) / float64(s.Saturation), nil
+}
+
+// AgeSignal scores an address by how long ago it was first seen on-chain
+type AgeSignal struct {
+	// FirstSeen returns the time of the address's first transaction,
+	// typically backed by an indexer or explorer API
+	FirstSeen  func(ctx context.Context, addr common.Address) (time.Time, error)
+	Saturation time.Duration // age that earns a full score
+}
+
+// Name returns the signal name
+func (s *AgeSignal) Name() string { return "account_age" }
+
+// Score returns age/Saturation capped at 1
+func (s *AgeSignal) Score(ctx context.Context, addr common.Address) (float64, error) {
+	if s.Saturation <= 0 {
+		return 0, errors.New("saturation must be positive")
+	}
+	first, err := s.FirstSeen(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	if first.IsZero() {
+		return 0, nil
+	}
+	return float64(time.Since(first)) / float64(s.Saturation), nil
+}
+
+// TokenSignal scores an address by its balance of a token
+type TokenSignal struct {
+	Token     *contract.ERC20
+	Threshold *big.Int // balance that earns a full score
+}
+
+// Name returns the signal name
+func (s *TokenSignal) Name() string { return "token_" + s.Token.Address.Hex() }
+
+// Score returns balance/Threshold capped at 1
+func (s *TokenSignal) Score(ctx context.Context, addr common.Address) (float64, error) {
+	if s.Threshold == nil || s.Threshold.Sign() <= 0 {
+		return 0, errors.New("threshold must be positive")
+	}
+	balance, err := s.Token.BalanceOf(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(balance.Base()), new(big.Float).SetInt(s.Threshold)).Float64()
+	return ratio, nil
+}
+
+// AttestationSignal scores an address by attestations it holds from trusted attesters
+type AttestationSignal struct {
+	Indexer    *eas.Indexer
+	Schema     common.Hash
+	Attesters  []common.Address // trusted attesters; empty trusts any attester
+	Saturation int              // attestation count that earns a full score
+}
+
+// Name returns the signal name
+func (s *AttestationSignal) Name() string { return "attestations_" + s.Schema.Hex() }
+
+// Score returns trusted attestations/Saturation capped at 1
+func (s *AttestationSignal) Score(ctx context.Context, addr common.Address) (float64, error) {
+	if s.Saturation <= 0 {
+		return 0, errors.New("saturation must be positive")
+	}
+	schema := s.Schema
+	atts, err := s.Indexer.Attestations(ctx, eas.Filter{Schema: &schema, Recipient: &addr})
+	if err != nil {
+		return 0, err
+	}
+
+	now := uint64(time.Now().Unix())
+	count := 0
+	for _, att := range atts {
+		if att.ExpirationTime != 0 && att.ExpirationTime < now {
+			continue
+		}
+		if s.trusted(att.Attester) {
+			count++
+		}
+	}
+	return float64(count) / float64(s.Saturation), nil
+}
+
+func (s *AttestationSignal) trusted(attester common.Address) bool {
+	if len(s.Attesters) == 0 {
+		return true
+	}
+	for _, a := range s.Attesters {
+		if a == attester {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package reqctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/audit"
+)
+
+// Headers metadata is read from and written to
+const (
+	HeaderTenant      = "X-Tenant-ID"
+	HeaderIdempotency = "Idempotency-Key"
+	HeaderTrace       = "X-Trace-ID"
+	HeaderTraceParent = "traceparent" // W3C trace context
+)
+
+// Metadata identifies the request an operation is part of. Subsystems only
+// read it, so one server request can be followed through the wallet, the
+// transaction queue, the indexer and messaging in logs and the audit log
+type Metadata struct {
+	Tenant         string `json:"tenant,omitempty"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	TraceID        string `json:"traceId,omitempty"`
+	SpanID         string `json:"spanId,omitempty"`
+	ParentSpanID   string `json:"parentSpanId,omitempty"`
+}
+
+type metadataKey struct{}
+
+// With attaches metadata to ctx
+func With(ctx context.Context, m Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, m)
+}
+
+// FromContext returns the metadata attached to ctx, or the zero Metadata
+func FromContext(ctx context.Context) Metadata {
+	m, _ := ctx.Value(metadataKey{}).(Metadata)
+	return m
+}
+
+// Child starts a span under the current one: tenant, idempotency key and
+// trace are inherited and a trace is started when there is none
+func Child(ctx context.Context) (context.Context, Metadata) {
+	m := FromContext(ctx)
+	if m.TraceID == "" {
+		m.TraceID = randomHex(16)
+	}
+	m.ParentSpanID, m.SpanID = m.SpanID, randomHex(8)
+	return With(ctx, m), m
+}
+
+// WithTenant returns ctx with its metadata's tenant set
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	m := FromContext(ctx)
+	m.Tenant = tenant
+	return With(ctx, m)
+}
+
+// WithIdempotencyKey returns ctx with its metadata's idempotency key set
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	m := FromContext(ctx)
+	m.IdempotencyKey = key
+	return With(ctx, m)
+}
+
+// Fields returns the set fields by name, for audit details and log lines
+func (m Metadata) Fields() map[string]string {
+	out := make(map[string]string, 5)
+	for k, v := range map[string]string{
+		"tenant":         m.Tenant,
+		"idempotencyKey": m.IdempotencyKey,
+		"traceId":        m.TraceID,
+		"spanId":         m.SpanID,
+		"parentSpanId":   m.ParentSpanID,
+	} {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Labels returns the metadata fit for metric labels. Only the tenant is
+// included; trace and idempotency ids are unbounded
+func (m Metadata) Labels() map[string]string {
+	if m.Tenant == "" {
+		return map[string]string{}
+	}
+	return map[string]string{"tenant": m.Tenant}
+}
+
+// Logger returns l annotated with the metadata of ctx
+func Logger(ctx context.Context, l *slog.Logger) *slog.Logger {
+	m := FromContext(ctx)
+	var attrs []any
+	for k, v := range m.Fields() {
+		attrs = append(attrs, slog.String(k, v))
+	}
+	if len(attrs) == 0 {
+		return l
+	}
+	return l.With(attrs...)
+}
+
+// FromRequest reads metadata from request headers. The trace id is taken
+// from X-Trace-ID, or a W3C traceparent header, whose parent span becomes
+// the parent of the request's span. Headers are set by the caller, so only
+// trust the tenant behind a gateway that sets it
+func FromRequest(r *http.Request) Metadata {
+	m := Metadata{
+		Tenant:         safeID(r.Header.Get(HeaderTenant)),
+		IdempotencyKey: idempotencyKey(r.Header.Get(HeaderIdempotency)),
+		TraceID:        safeID(r.Header.Get(HeaderTrace)),
+	}
+	if m.TraceID == "" {
+		parts := strings.Split(r.Header.Get(HeaderTraceParent), "-")
+		if len(parts) == 4 {
+			m.TraceID, m.SpanID = validID(parts[1], 32), validID(parts[2], 16)
+		}
+	}
+	return m
+}
+
+// Inject writes the trace of ctx to outgoing request headers. Tenant and
+// idempotency key are not sent, as requests may leave the deployment
+func Inject(ctx context.Context, h http.Header) {
+	m := FromContext(ctx)
+	if m.TraceID == "" {
+		return
+	}
+	h.Set(HeaderTrace, m.TraceID)
+	if len(m.TraceID) == 32 && len(m.SpanID) == 16 {
+		h.Set(HeaderTraceParent, "00-"+m.TraceID+"-"+m.SpanID+"-01")
+	}
+}
+
+// Transport is an http.RoundTripper injecting the trace of each request's
+// context, such as for a node client dialed with rpc.WithHTTPClient
+type Transport struct {
+	Base http.RoundTripper // nil is http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if FromContext(req.Context()).TraceID == "" {
+		return base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	Inject(req.Context(), req.Header)
+	return base.RoundTrip(req)
+}
+
+// Dial connects to a node, sending the trace of each call's context with
+// HTTP requests so wallet, indexer and queue calls can be matched in node or
+// proxy logs. WebSocket endpoints are dialed without propagation
+func Dial(ctx context.Context, url string) (*ethclient.Client, error) {
+	client, err := rpc.DialOptions(ctx, url, rpc.WithHTTPClient(&http.Client{Transport: &Transport{}}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// auditLog adds the metadata of each entry's context to its details
+type auditLog struct {
+	next audit.Log
+}
+
+// Audit wraps an audit log so every entry recorded with a context carrying
+// metadata is stamped with it; details set by the caller win
+func Audit(next audit.Log) audit.Log {
+	if next == nil {
+		next = audit.Discard
+	}
+	return auditLog{next: next}
+}
+
+// Record implements audit.Log
+func (l auditLog) Record(ctx context.Context, e audit.Entry) error {
+	fields := FromContext(ctx).Fields()
+	if len(fields) == 0 {
+		return l.next.Record(ctx, e)
+	}
+	details := make(map[string]string, len(e.Details)+len(fields))
+	for k, v := range fields {
+		details[k] = v
+	}
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	e.Details = details
+	return l.next.Record(ctx, e)
+}
+
+// validID returns s when it is a lowercase hex id of the given length and
+// not all zeros, as W3C trace context requires, and "" otherwise
+func validID(s string, length int) string {
+	if len(s) != length || strings.Trim(s, "0") == "" {
+		return ""
+	}
+	if _, err := hex.DecodeString(s); err != nil || strings.ToLower(s) != s {
+		return ""
+	}
+	return s
+}
+
+// safeID returns s when it is a plausible id of up to 64 letters, digits,
+// dashes and underscores, so callers cannot inject into logs, and "" otherwise
+func safeID(s string) string {
+	if len(s) > 64 {
+		return ""
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return ""
+		}
+	}
+	return s
+}
+
+// idempotencyKey returns k when it is at most 255 printable ASCII characters
+func idempotencyKey(k string) string {
+	if len(k) > 255 {
+		return ""
+	}
+	for _, c := range k {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+	return k
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
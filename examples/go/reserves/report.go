@@ -0,0 +1,161 @@
+package reserves
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// TokenBalance is an ERC-20 balance
+type TokenBalance struct {
+	Token   common.Address `json:"token"`
+	Balance *hexutil.Big   `json:"balance"`
+}
+
+// Holding is one managed address: its balances at the report block and its
+// signature of the report's control message
+type Holding struct {
+	Address   common.Address `json:"address"`
+	Balance   *hexutil.Big   `json:"balance"`
+	Tokens    []TokenBalance `json:"tokens,omitempty"` // in Report.Tokens order
+	Signature hexutil.Bytes  `json:"signature,omitempty"`
+}
+
+// Report is a proof of reserves: balances of every managed address at one
+// block, a fresh signature from each address proving control, and the
+// attester's signature over the whole report
+type Report struct {
+	ChainID     *hexutil.Big     `json:"chainId"`
+	Block       uint64           `json:"block"`
+	BlockHash   common.Hash      `json:"blockHash"`
+	BlockTime   time.Time        `json:"blockTime"`
+	Challenge   string           `json:"challenge,omitempty"` // auditor-chosen nonce, if any
+	Tokens      []common.Address `json:"tokens,omitempty"`
+	Holdings    []Holding        `json:"holdings"`
+	Total       *hexutil.Big     `json:"total"`
+	TokenTotals []TokenBalance   `json:"tokenTotals,omitempty"`
+	Attester    common.Address   `json:"attester"`
+	Signature   hexutil.Bytes    `json:"signature,omitempty"`
+}
+
+// Message returns what addr signs to prove control. It names the block hash,
+// so the signature cannot have been made before the snapshot block, and the
+// challenge, so an auditor can demand signatures made for their request
+func (r *Report) Message(addr common.Address) []byte {
+	return []byte(fmt.Sprintf("WhisperChain proof of reserves\nAddress: %s\nChain: %s\nBlock: %d\nBlock hash: %s\nChallenge: %s",
+		addr.Hex(), r.ChainID.ToInt(), r.Block, r.BlockHash.Hex(), r.Challenge))
+}
+
+// Prove signs the control message with w's key
+func (r *Report) Prove(w *wallet.Wallet) error {
+	h := r.holding(w.Address)
+	if h == nil {
+		return fmt.Errorf("reserves: %s is not in the report", w.Address.Hex())
+	}
+	sig, err := w.SignPersonalMessage(r.Message(w.Address))
+	if err != nil {
+		return err
+	}
+	h.Signature = sig
+	return nil
+}
+
+// Attach adds a control signature made elsewhere, such as by a cold or
+// hardware wallet signing Message as a personal message
+func (r *Report) Attach(addr common.Address, sig []byte) error {
+	h := r.holding(addr)
+	if h == nil {
+		return fmt.Errorf("reserves: %s is not in the report", addr.Hex())
+	}
+	if !wallet.VerifyPersonalSignature(r.Message(addr), sig, addr) {
+		return fmt.Errorf("reserves: signature is not from %s", addr.Hex())
+	}
+	h.Signature = sig
+	return nil
+}
+
+// Unproven returns the addresses still missing a control signature
+func (r *Report) Unproven() []common.Address {
+	var out []common.Address
+	for _, h := range r.Holdings {
+		if len(h.Signature) == 0 {
+			out = append(out, h.Address)
+		}
+	}
+	return out
+}
+
+// Seal signs the report once every address has proven control
+func (r *Report) Seal(attester *wallet.Wallet) error {
+	if missing := r.Unproven(); len(missing) > 0 {
+		return fmt.Errorf("reserves: %d addresses have not signed", len(missing))
+	}
+	r.Attester = attester.Address
+	data, err := r.payload()
+	if err != nil {
+		return err
+	}
+	sig, err := attester.SignPersonalMessage(data)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// Encode returns the report as indented JSON
+func (r *Report) Encode() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// DecodeReport parses a report
+func DecodeReport(data []byte) (*Report, error) {
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.ChainID == nil || r.Total == nil {
+		return nil, errors.New("reserves: report is incomplete")
+	}
+	return &r, nil
+}
+
+// payload is what the attester signs: the report without its signature
+func (r *Report) payload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+func (r *Report) holding(addr common.Address) *Holding {
+	for i := range r.Holdings {
+		if r.Holdings[i].Address == addr {
+			return &r.Holdings[i]
+		}
+	}
+	return nil
+}
+
+// totals sums the holdings
+func (r *Report) totals() (*big.Int, []*big.Int) {
+	total := new(big.Int)
+	tokens := make([]*big.Int, len(r.Tokens))
+	for i := range tokens {
+		tokens[i] = new(big.Int)
+	}
+	for _, h := range r.Holdings {
+		total.Add(total, h.Balance.ToInt())
+		for i, t := range h.Tokens {
+			if i < len(tokens) {
+				tokens[i].Add(tokens[i], t.Balance.ToInt())
+			}
+		}
+	}
+	return total, tokens
+}
@@ -0,0 +1,147 @@
+package reserves
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Generator produces proof-of-reserves reports for a set of managed
+// addresses. Wallets sign their control messages as the report is made;
+// Offline addresses, such as cold storage, are snapshotted and left for
+// Report.Attach
+type Generator struct {
+	Client   *ethclient.Client // must serve state at the report block
+	Wallets  []*wallet.Wallet
+	Offline  []common.Address
+	Tokens   []common.Address // ERC-20 reserves to report besides ETH
+	Attester *wallet.Wallet   // signs the finished report
+	Audit    audit.Log
+}
+
+// NewGenerator creates a generator for the given wallets
+func NewGenerator(client *ethclient.Client, attester *wallet.Wallet, auditLog audit.Log, wallets ...*wallet.Wallet) *Generator {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Generator{Client: client, Wallets: wallets, Attester: attester, Audit: auditLog}
+}
+
+// Addresses returns every managed address, once each, in address order
+func (g *Generator) Addresses() []common.Address {
+	seen := make(map[common.Address]bool)
+	var out []common.Address
+	add := func(addr common.Address) {
+		if !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+	for _, w := range g.Wallets {
+		add(w.Address)
+	}
+	for _, addr := range g.Offline {
+		add(addr)
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i][:], out[j][:]) < 0 })
+	return out
+}
+
+// Generate snapshots balances at block, latest when nil, and collects
+// control signatures from Wallets. The report is sealed when there are no
+// Offline addresses; otherwise attach their signatures and call Seal
+func (g *Generator) Generate(ctx context.Context, block *big.Int, challenge string) (*Report, error) {
+	r, err := g.Snapshot(ctx, block, challenge)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range g.Wallets {
+		if err := r.Prove(w); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.Unproven()) == 0 && g.Attester != nil {
+		if err := r.Seal(g.Attester); err != nil {
+			return nil, err
+		}
+	}
+	g.Audit.Record(ctx, audit.Entry{
+		Actor:   "reserves",
+		Action:  "proof-of-reserves",
+		Subject: strconv.FormatUint(r.Block, 10),
+		Outcome: "generated",
+		Details: map[string]string{"addresses": strconv.Itoa(len(r.Holdings)), "total": r.Total.ToInt().String()},
+	})
+	return r, nil
+}
+
+// Snapshot reads the balances of every managed address at block without
+// signing anything
+func (g *Generator) Snapshot(ctx context.Context, block *big.Int, challenge string) (*Report, error) {
+	addresses := g.Addresses()
+	if len(addresses) == 0 {
+		return nil, errors.New("reserves: no managed addresses")
+	}
+	chainID, err := g.Client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header, err := g.Client.HeaderByNumber(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	number := header.Number
+	r := &Report{
+		ChainID:   (*hexutil.Big)(chainID),
+		Block:     number.Uint64(),
+		BlockHash: header.Hash(),
+		BlockTime: time.Unix(int64(header.Time), 0).UTC(),
+		Challenge: challenge,
+		Tokens:    g.Tokens,
+		Holdings:  make([]Holding, 0, len(addresses)),
+	}
+	for _, addr := range addresses {
+		h, err := holding(ctx, g.Client, addr, g.Tokens, number)
+		if err != nil {
+			return nil, err
+		}
+		r.Holdings = append(r.Holdings, *h)
+	}
+	total, tokens := r.totals()
+	r.Total = (*hexutil.Big)(total)
+	for i, token := range r.Tokens {
+		r.TokenTotals = append(r.TokenTotals, TokenBalance{Token: token, Balance: (*hexutil.Big)(tokens[i])})
+	}
+	return r, nil
+}
+
+// holding reads addr's balances at block
+func holding(ctx context.Context, client *ethclient.Client, addr common.Address, tokens []common.Address, block *big.Int) (*Holding, error) {
+	balance, err := client.BalanceAt(ctx, addr, block)
+	if err != nil {
+		return nil, err
+	}
+	h := &Holding{Address: addr, Balance: (*hexutil.Big)(balance)}
+	for _, token := range tokens {
+		token := token
+		data := contract.BalanceOfData(addr)
+		out, err := client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, block)
+		if err != nil {
+			return nil, err
+		}
+		h.Tokens = append(h.Tokens, TokenBalance{Token: token, Balance: (*hexutil.Big)(new(big.Int).SetBytes(out))})
+	}
+	return h, nil
+}
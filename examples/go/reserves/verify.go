@@ -0,0 +1,96 @@
+package reserves
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Verify checks everything in the report that needs no chain access: the
+// attester's signature, a control signature from every address and the
+// totals. Anyone holding the report can run it
+func (r *Report) Verify() error {
+	if r.ChainID == nil || r.Total == nil {
+		return errors.New("reserves: report is incomplete")
+	}
+	data, err := r.payload()
+	if err != nil {
+		return err
+	}
+	if !wallet.VerifyPersonalSignature(data, r.Signature, r.Attester) {
+		return errors.New("reserves: report is not signed by its attester")
+	}
+	seen := make(map[common.Address]bool, len(r.Holdings))
+	for _, h := range r.Holdings {
+		if seen[h.Address] {
+			return fmt.Errorf("reserves: %s is reported twice", h.Address.Hex())
+		}
+		seen[h.Address] = true
+		if h.Balance == nil || len(h.Tokens) != len(r.Tokens) {
+			return fmt.Errorf("reserves: %s has incomplete balances", h.Address.Hex())
+		}
+		for i, t := range h.Tokens {
+			if t.Token != r.Tokens[i] || t.Balance == nil {
+				return fmt.Errorf("reserves: %s has incomplete balances", h.Address.Hex())
+			}
+		}
+		if !wallet.VerifyPersonalSignature(r.Message(h.Address), h.Signature, h.Address) {
+			return fmt.Errorf("reserves: no valid control signature from %s", h.Address.Hex())
+		}
+	}
+	total, tokens := r.totals()
+	if total.Cmp(r.Total.ToInt()) != 0 {
+		return errors.New("reserves: total does not match the holdings")
+	}
+	if len(r.TokenTotals) != len(r.Tokens) {
+		return errors.New("reserves: token totals do not match the holdings")
+	}
+	for i, t := range r.TokenTotals {
+		if t.Token != r.Tokens[i] || t.Balance == nil || tokens[i].Cmp(t.Balance.ToInt()) != 0 {
+			return errors.New("reserves: token totals do not match the holdings")
+		}
+	}
+	return nil
+}
+
+// VerifyOnChain checks the report against a node the verifier trusts: the
+// chain and block hash match and every balance is what the chain held at
+// the block. The node must serve state at that block, so old reports need
+// an archive node. Run Verify first
+func (r *Report) VerifyOnChain(ctx context.Context, client *ethclient.Client) error {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	if chainID.Cmp(r.ChainID.ToInt()) != 0 {
+		return fmt.Errorf("reserves: node is on chain %s, report is for %s", chainID, r.ChainID.ToInt())
+	}
+	block := new(big.Int).SetUint64(r.Block)
+	header, err := client.HeaderByNumber(ctx, block)
+	if err != nil {
+		return err
+	}
+	if header.Hash() != r.BlockHash {
+		return errors.New("reserves: block hash differs from the chain")
+	}
+	for _, h := range r.Holdings {
+		got, err := holding(ctx, client, h.Address, r.Tokens, block)
+		if err != nil {
+			return err
+		}
+		if got.Balance.ToInt().Cmp(h.Balance.ToInt()) != 0 {
+			return fmt.Errorf("reserves: %s held %s wei, report says %s", h.Address.Hex(), got.Balance.ToInt(), h.Balance.ToInt())
+		}
+		for i, t := range got.Tokens {
+			if t.Balance.ToInt().Cmp(h.Tokens[i].Balance.ToInt()) != 0 {
+				return fmt.Errorf("reserves: %s held %s of %s, report says %s", h.Address.Hex(), t.Balance.ToInt(), t.Token.Hex(), h.Tokens[i].Balance.ToInt())
+			}
+		}
+	}
+	return nil
+}
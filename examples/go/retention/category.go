@@ -0,0 +1,163 @@
+package retention
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/payments"
+	"github.com/whisperchain/go-examples/sigrequest"
+)
+
+// Category is one kind of stored record that may hold personal data
+type Category struct {
+	Name   string
+	Prefix string // store key prefix of the records
+	// Subjects returns the accounts a record is about; a record is erased
+	// when its subject asks
+	Subjects func(key string, value []byte) []common.Address
+	// Time returns when a record was created, false when it cannot tell;
+	// records without a time are never expired
+	Time func(key string, value []byte) (time.Time, bool)
+	// MaxAge is how long records are kept; zero keeps them until erased
+	MaxAge time.Duration
+}
+
+// Messages are envelopes stored by a relay, about their sender and recipient
+func Messages(maxAge time.Duration) Category {
+	return Category{
+		Name:   "messages",
+		Prefix: "relay/envelope/",
+		MaxAge: maxAge,
+		Subjects: func(_ string, value []byte) []common.Address {
+			env, err := messaging.DecodeEnvelope(value)
+			if err != nil {
+				return nil
+			}
+			return []common.Address{env.Sender, env.Recipient}
+		},
+		Time: func(_ string, value []byte) (time.Time, bool) {
+			env, err := messaging.DecodeEnvelope(value)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return time.Unix(env.Timestamp, 0), true
+		},
+	}
+}
+
+// AbuseReports are reports accepted by a relay, about reporter and offender
+func AbuseReports(maxAge time.Duration) Category {
+	decode := func(value []byte) (*messaging.AbuseReport, bool) {
+		var r messaging.AbuseReport
+		return &r, json.Unmarshal(value, &r) == nil
+	}
+	return Category{
+		Name:   "abuse-reports",
+		Prefix: "relay/report/",
+		MaxAge: maxAge,
+		Subjects: func(_ string, value []byte) []common.Address {
+			if r, ok := decode(value); ok {
+				return []common.Address{r.Reporter, r.Offender}
+			}
+			return nil
+		},
+		Time: func(_ string, value []byte) (time.Time, bool) {
+			if r, ok := decode(value); ok {
+				return time.Unix(r.Timestamp, 0), true
+			}
+			return time.Time{}, false
+		},
+	}
+}
+
+// BehaviorProfiles are anomaly detection profiles, keyed by account. They
+// are rebuilt from chain history, so they have no age
+func BehaviorProfiles() Category {
+	return Category{
+		Name:     "behavior-profiles",
+		Prefix:   "anomaly/profile/",
+		Subjects: addressAfterPrefix("anomaly/profile/"),
+	}
+}
+
+// SignatureRequests are pending dapp signature requests, about the account
+// asked to sign
+func SignatureRequests(maxAge time.Duration) Category {
+	decode := func(value []byte) (*sigrequest.Item, bool) {
+		var item sigrequest.Item
+		return &item, json.Unmarshal(value, &item) == nil
+	}
+	return Category{
+		Name:   "signature-requests",
+		Prefix: "sigrequest/pending/",
+		MaxAge: maxAge,
+		Subjects: func(_ string, value []byte) []common.Address {
+			if item, ok := decode(value); ok {
+				return []common.Address{item.Request.From}
+			}
+			return nil
+		},
+		Time: func(_ string, value []byte) (time.Time, bool) {
+			if item, ok := decode(value); ok {
+				return item.ReceivedAt, true
+			}
+			return time.Time{}, false
+		},
+	}
+}
+
+// Invoices are about their payer and payee. They are accounting records,
+// which law usually requires keeping for years after a deletion request, so
+// they are not in Defaults; add them only where that does not apply
+func Invoices(maxAge time.Duration) Category {
+	decode := func(value []byte) (*payments.Invoice, bool) {
+		var inv payments.Invoice
+		return &inv, json.Unmarshal(value, &inv) == nil
+	}
+	return Category{
+		Name:   "invoices",
+		Prefix: "invoice/",
+		MaxAge: maxAge,
+		Subjects: func(_ string, value []byte) []common.Address {
+			if inv, ok := decode(value); ok {
+				return []common.Address{inv.Payer, inv.Payee}
+			}
+			return nil
+		},
+		Time: func(_ string, value []byte) (time.Time, bool) {
+			if inv, ok := decode(value); ok {
+				return inv.Created, true
+			}
+			return time.Time{}, false
+		},
+	}
+}
+
+// Defaults are the categories of personal data this module stores, with
+// messages and abuse reports kept for a year and signature requests for a
+// month
+func Defaults() []Category {
+	return []Category{
+		Messages(365 * 24 * time.Hour),
+		AbuseReports(365 * 24 * time.Hour),
+		BehaviorProfiles(),
+		SignatureRequests(30 * 24 * time.Hour),
+	}
+}
+
+// addressAfterPrefix reads the account from keys of the form prefix+address
+func addressAfterPrefix(prefix string) func(key string, value []byte) []common.Address {
+	return func(key string, _ []byte) []common.Address {
+		rest := strings.TrimPrefix(key, prefix)
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			rest = rest[:i]
+		}
+		if !common.IsHexAddress(rest) {
+			return nil
+		}
+		return []common.Address{common.HexToAddress(rest)}
+	}
+}
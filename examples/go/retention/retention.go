@@ -0,0 +1,234 @@
+package retention
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Record is one erased record. The key is hashed so the attestation does
+// not repeat the data it attests is gone
+type Record struct {
+	Store    string `json:"store"`
+	Category string `json:"category"`
+	KeyHash  string `json:"keyHash"` // hex SHA-256 of the store key
+}
+
+// Attestation is a signed statement that a subject's records were erased
+// from every registered store
+type Attestation struct {
+	Subject   common.Address `json:"subject"`
+	Erased    time.Time      `json:"erased"`
+	Stores    []string       `json:"stores"` // every store searched
+	Records   []Record       `json:"records"`
+	Attester  common.Address `json:"attester"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// payload is what the attester signs: the attestation without signature
+func (a *Attestation) payload() ([]byte, error) {
+	unsigned := *a
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// Verify reports whether the attestation is signed by its attester
+func (a *Attestation) Verify() bool {
+	data, err := a.payload()
+	if err != nil {
+		return false
+	}
+	return wallet.VerifyPersonalSignature(data, a.Signature, a.Attester)
+}
+
+// Manager applies retention limits and erasure requests across every store
+// holding personal data: a deployment's main store, each tenant's, backup
+// staging stores and so on. Backups already taken are not rewritten; keep
+// their retention no longer than the longest MaxAge, or restore, erase again
+// and re-backup
+type Manager struct {
+	Categories []Category
+	Signer     *wallet.Wallet // signs erasure attestations
+	Audit      audit.Log
+	Clock      clock.Clock
+
+	mu     sync.Mutex
+	stores map[string]storage.Store
+}
+
+// NewManager creates a manager for the given categories, Defaults when none
+func NewManager(signer *wallet.Wallet, auditLog audit.Log, categories ...Category) *Manager {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	if len(categories) == 0 {
+		categories = Defaults()
+	}
+	return &Manager{Categories: categories, Signer: signer, Audit: auditLog, stores: make(map[string]storage.Store)}
+}
+
+// AddStore registers a store to search under a name used in attestations
+func (m *Manager) AddStore(name string, s storage.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stores == nil {
+		m.stores = make(map[string]storage.Store)
+	}
+	m.stores[name] = s
+}
+
+// Erase deletes every record about subject and returns a signed attestation.
+// A failed deletion stops the erasure with an error and no attestation; the
+// request is safe to repeat. Audit entries, which records of the erasure
+// itself need, name the subject only by hash
+func (m *Manager) Erase(ctx context.Context, subject common.Address) (*Attestation, error) {
+	if m.Signer == nil {
+		return nil, errors.New("retention: no attestation signer")
+	}
+	att := &Attestation{Subject: subject, Stores: []string{}, Records: []Record{}, Attester: m.Signer.Address}
+	err := m.each(ctx, func(store string, s storage.Store, c Category, key string, value []byte) error {
+		if c.Subjects == nil || !about(c.Subjects(key, value), subject) {
+			return nil
+		}
+		if err := s.Delete(ctx, key); err != nil {
+			return fmt.Errorf("retention: erase from %s: %w", store, err)
+		}
+		att.Records = append(att.Records, Record{Store: store, Category: c.Name, KeyHash: hashHex(key)})
+		return nil
+	}, func(store string) { att.Stores = append(att.Stores, store) })
+	subjectHash := hashHex(subject.Hex())
+	if err != nil {
+		m.record(ctx, "erase", subjectHash, "failed", map[string]string{"error": err.Error(), "records": strconv.Itoa(len(att.Records))})
+		return nil, err
+	}
+
+	att.Erased = clock.Or(m.Clock).Now().UTC()
+	data, err := att.payload()
+	if err != nil {
+		return nil, err
+	}
+	if att.Signature, err = m.Signer.SignPersonalMessage(data); err != nil {
+		return nil, err
+	}
+	m.record(ctx, "erase", subjectHash, "erased", map[string]string{"records": strconv.Itoa(len(att.Records))})
+	return att, nil
+}
+
+// Enforce deletes records older than their category's MaxAge and returns
+// how many were deleted per category
+func (m *Manager) Enforce(ctx context.Context) (map[string]int, error) {
+	now := clock.Or(m.Clock).Now()
+	deleted := make(map[string]int)
+	err := m.each(ctx, func(store string, s storage.Store, c Category, key string, value []byte) error {
+		if c.MaxAge <= 0 || c.Time == nil {
+			return nil
+		}
+		created, ok := c.Time(key, value)
+		if !ok || now.Sub(created) < c.MaxAge {
+			return nil
+		}
+		if err := s.Delete(ctx, key); err != nil {
+			return fmt.Errorf("retention: expire from %s: %w", store, err)
+		}
+		deleted[c.Name]++
+		return nil
+	}, nil)
+	details := make(map[string]string, len(deleted))
+	for name, n := range deleted {
+		details[name] = strconv.Itoa(n)
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "failed"
+		details["error"] = err.Error()
+	}
+	m.record(ctx, "expire", "", outcome, details)
+	return deleted, err
+}
+
+// Schedule registers periodic retention runs with a scheduler
+func (m *Manager) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("retention", interval, func(ctx context.Context) error {
+		_, err := m.Enforce(ctx)
+		return err
+	})
+}
+
+// each calls fn for every record of every category in every store, in
+// store name order
+func (m *Manager) each(ctx context.Context, fn func(store string, s storage.Store, c Category, key string, value []byte) error, visited func(store string)) error {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.stores))
+	stores := make(map[string]storage.Store, len(m.stores))
+	for name, s := range m.stores {
+		names = append(names, name)
+		stores[name] = s
+	}
+	m.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := stores[name]
+		for _, c := range m.Categories {
+			keys, err := s.List(ctx, c.Prefix)
+			if err != nil {
+				return fmt.Errorf("retention: list %s in %s: %w", c.Name, name, err)
+			}
+			for _, key := range keys {
+				value, err := s.Get(ctx, key)
+				if errors.Is(err, storage.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if err := fn(name, s, c, key, value); err != nil {
+					return err
+				}
+			}
+		}
+		if visited != nil {
+			visited(name)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) record(ctx context.Context, action, subject, outcome string, details map[string]string) {
+	m.Audit.Record(ctx, audit.Entry{
+		Actor:   "retention",
+		Action:  action,
+		Subject: subject,
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+func about(subjects []common.Address, subject common.Address) bool {
+	for _, s := range subjects {
+		if s == subject {
+			return true
+		}
+	}
+	return false
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,274 @@
+package rpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ewmaWeight is the weight of the newest sample in moving averages
+const ewmaWeight = 0.2
+
+// traceFactor discounts providers that cannot serve trace requests
+const traceFactor = 0.9
+
+// referenceLatency is the latency at which the latency factor of a score halves
+const referenceLatency = 200 * time.Millisecond
+
+// Stats is the observed quality of an endpoint
+type Stats struct {
+	Latency      time.Duration // moving average of successful request latency
+	Availability float64       // moving average of request success, 0 to 1
+	HeadLag      uint64        // blocks behind the best endpoint at the last probe
+	Trace        bool          // supports debug_ or trace_ tracing
+	Archive      bool          // serves state for old blocks
+	WriteLatency time.Duration // canary send to receipt, zero if never measured
+	Requests     uint64
+	Failures     uint64
+	Probed       time.Time
+}
+
+// Score rates the endpoint between 0 and 1 by availability, latency, head lag
+// and, once probed, trace support. Endpoints with no observations score 1 so
+// they get tried
+func (s Stats) Score() float64 {
+	if s.Requests == 0 {
+		return 1
+	}
+	latency := float64(referenceLatency) / float64(referenceLatency+s.Latency)
+	lag := 1 / (1 + float64(s.HeadLag))
+	score := s.Availability * latency * lag
+	if !s.Probed.IsZero() && !s.Trace {
+		score *= traceFactor
+	}
+	return score
+}
+
+// Endpoint is one RPC provider
+type Endpoint struct {
+	Name    string
+	URL     string
+	Client  *ethclient.Client
+	Archive bool // declared archive node; probes also detect archive state
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Dial connects to an endpoint
+func Dial(ctx context.Context, name, url string) (*Endpoint, error) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &Endpoint{Name: name, URL: url, Client: client}, nil
+}
+
+// Stats returns a snapshot of the endpoint's quality
+func (e *Endpoint) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// observe records the outcome of a request
+func (e *Endpoint) observe(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ok := 0.0
+	if err == nil {
+		ok = 1
+	} else {
+		e.stats.Failures++
+	}
+	if e.stats.Requests == 0 {
+		e.stats.Availability = ok
+		if err == nil {
+			e.stats.Latency = latency
+		}
+	} else {
+		e.stats.Availability += ewmaWeight * (ok - e.stats.Availability)
+		if err == nil {
+			e.stats.Latency += time.Duration(ewmaWeight * float64(latency-e.stats.Latency))
+		}
+	}
+	e.stats.Requests++
+}
+
+func (e *Endpoint) update(f func(s *Stats)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f(&e.stats)
+}
+
+// Pool routes requests across endpoints, trying them in an order weighted by
+// score and failing over when a provider errors
+type Pool struct {
+	Endpoints []*Endpoint // replace with SetEndpoints once the pool is in use
+
+	// Endpoints are healthy while their availability is at least
+	// MinAvailability and they trail the best head by at most MaxHeadLag
+	MinAvailability float64
+	MaxHeadLag      uint64
+	// BroadcastFanout limits how many endpoints a transaction is sent to;
+	// zero sends to every healthy endpoint
+	BroadcastFanout int
+	// Quorum is how many endpoints must agree on cross-checked reads; below 2
+	// cross-checking is off
+	Quorum int
+
+	mu   sync.Mutex
+	rnd  *rand.Rand
+	head uint64 // best head seen by the last probe
+}
+
+// New creates a pool
+func New(endpoints ...*Endpoint) *Pool {
+	return &Pool{
+		Endpoints:       endpoints,
+		MinAvailability: 0.8,
+		MaxHeadLag:      3,
+		rnd:             rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// ErrNoEndpoints is returned by a pool without endpoints
+var ErrNoEndpoints = errors.New("rpcpool: no endpoints")
+
+// Do runs fn against endpoints in weighted order until one succeeds. Errors
+// returned by the node itself, such as reverts, and not-found results are
+// returned without failing over since another provider would answer the same
+func (p *Pool) Do(ctx context.Context, fn func(ctx context.Context, c *ethclient.Client) error) error {
+	return p.do(ctx, p.Ordered(), fn)
+}
+
+func (p *Pool) do(ctx context.Context, endpoints []*Endpoint, fn func(ctx context.Context, c *ethclient.Client) error) error {
+	if len(endpoints) == 0 {
+		return ErrNoEndpoints
+	}
+	var errs []error
+	for _, e := range endpoints {
+		start := time.Now()
+		err := fn(ctx, e.Client)
+		if err == nil || isAnswer(err) {
+			e.observe(time.Since(start), nil)
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e.observe(time.Since(start), err)
+		errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+	}
+	return errors.Join(errs...)
+}
+
+// Ordered returns the endpoints in a random order where each endpoint's
+// chance of coming first is proportional to its score
+func (p *Pool) Ordered() []*Endpoint {
+	type keyed struct {
+		e   *Endpoint
+		key float64
+	}
+	p.mu.Lock()
+	if p.rnd == nil {
+		p.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	ks := make([]keyed, len(p.Endpoints))
+	for i, e := range p.Endpoints {
+		// Efraimidis-Spirakis: sorting by u^(1/w) is weighted sampling
+		// without replacement; zero scores sort last
+		key := -1.0
+		if w := e.Stats().Score(); w > 0 {
+			key = math.Pow(p.rnd.Float64(), 1/w)
+		}
+		ks[i] = keyed{e, key}
+	}
+	p.mu.Unlock()
+
+	sort.SliceStable(ks, func(i, j int) bool { return ks[i].key > ks[j].key })
+	out := make([]*Endpoint, len(ks))
+	for i, k := range ks {
+		out[i] = k.e
+	}
+	return out
+}
+
+// Scores returns each endpoint's current score by name
+func (p *Pool) Scores() map[string]float64 {
+	endpoints := p.endpoints()
+	scores := make(map[string]float64, len(endpoints))
+	for _, e := range endpoints {
+		scores[e.Name] = e.Stats().Score()
+	}
+	return scores
+}
+
+// Close closes every endpoint
+func (p *Pool) Close() {
+	for _, e := range p.endpoints() {
+		e.Client.Close()
+	}
+}
+
+// List returns a snapshot of the endpoints
+func (p *Pool) List() []*Endpoint {
+	return p.endpoints()
+}
+
+// SetEndpoints replaces the endpoints while requests are running. Pass
+// current endpoints again to keep their stats. The endpoints no longer in the
+// pool are returned for the caller to close once in-flight requests are done
+func (p *Pool) SetEndpoints(endpoints []*Endpoint) (removed []*Endpoint) {
+	next := append([]*Endpoint(nil), endpoints...)
+	keep := make(map[*Endpoint]bool, len(next))
+	for _, e := range next {
+		keep[e] = true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.Endpoints {
+		if !keep[e] {
+			removed = append(removed, e)
+		}
+	}
+	p.Endpoints = next
+	return removed
+}
+
+// endpoints returns a snapshot of the endpoints, safe to range over while
+// SetEndpoints runs
+func (p *Pool) endpoints() []*Endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Endpoint(nil), p.Endpoints...)
+}
+
+// isAnswer reports whether err came from a working node. Unsupported methods
+// and rate limiting (-32005) are provider problems and fail over
+func isAnswer(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return true
+	}
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	code := rpcErr.ErrorCode()
+	return code != -32601 && code != -32005
+}
+
+// isMethodNotFound reports whether the node does not serve a method
+func isMethodNotFound(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601
+}
@@ -0,0 +1,217 @@
+package rpcpool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Testnets are the chain IDs canary writes are allowed on
+var Testnets = map[uint64]string{
+	5:        "goerli",
+	17000:    "holesky",
+	80002:    "polygon-amoy",
+	84532:    "base-sepolia",
+	421614:   "arbitrum-sepolia",
+	11155111: "sepolia",
+	11155420: "optimism-sepolia",
+	1337:     "dev",
+	31337:    "dev",
+}
+
+// ErrNotTestnet is returned when a canary write is attempted on a chain that
+// is not in Testnets
+var ErrNotTestnet = errors.New("rpcpool: canary writes are only sent on testnets")
+
+// Result is the outcome of probing one endpoint
+type Result struct {
+	Endpoint     string
+	Latency      time.Duration
+	Head         uint64
+	HeadLag      uint64
+	Trace        bool
+	Archive      bool
+	WriteLatency time.Duration // zero when no canary write was sent
+	Err          error
+}
+
+// Prober periodically sends canary requests through every endpoint of a pool
+// and updates the stats the pool routes by
+type Prober struct {
+	Pool   *Pool
+	Alerts alert.Notifier
+	// Canary, when set, sends a zero-value self-transfer through each endpoint
+	// and times its receipt; only on chains listed in Testnets
+	Canary         *wallet.Wallet
+	ReceiptTimeout time.Duration
+	ReceiptPoll    time.Duration // how often the canary receipt is looked up; default one second
+	// Clock times canary receipts and probe rounds; nil is the wall clock.
+	// Read latencies are always measured on the wall clock
+	Clock clock.Clock
+}
+
+// NewProber creates a prober for read canaries only
+func NewProber(pool *Pool, alerts alert.Notifier) *Prober {
+	if alerts == nil {
+		alerts = alert.Discard
+	}
+	return &Prober{Pool: pool, Alerts: alerts, ReceiptTimeout: 2 * time.Minute, ReceiptPoll: time.Second}
+}
+
+// Probe measures every endpoint. Head lag is relative to the highest head
+// reported by any endpoint in the same round
+func (pr *Prober) Probe(ctx context.Context) []Result {
+	endpoints := pr.Pool.endpoints()
+	results := make([]Result, len(endpoints))
+	var best uint64
+	for i, e := range endpoints {
+		results[i] = pr.read(ctx, e)
+		if results[i].Err == nil && results[i].Head > best {
+			best = results[i].Head
+		}
+	}
+
+	pr.Pool.setHead(best)
+
+	for i, e := range endpoints {
+		r := &results[i]
+		if r.Err == nil {
+			r.HeadLag = best - r.Head
+			if pr.Canary != nil {
+				r.WriteLatency, r.Err = pr.write(ctx, e)
+			}
+		}
+		e.observe(r.Latency, r.Err)
+		e.update(func(s *Stats) {
+			s.Probed = clock.Or(pr.Clock).Now()
+			if r.Err != nil {
+				return
+			}
+			s.HeadLag = r.HeadLag
+			s.Trace = r.Trace
+			s.Archive = r.Archive
+			if r.WriteLatency > 0 {
+				s.WriteLatency = r.WriteLatency
+			}
+		})
+		if r.Err != nil {
+			pr.Alerts.Notify(ctx, alert.Alert{
+				Severity: alert.Warning,
+				Source:   "rpcpool",
+				Title:    "endpoint " + e.Name + " failed its canary",
+				Message:  r.Err.Error(),
+				Key:      "rpcpool/" + e.Name,
+				Labels:   map[string]string{"endpoint": e.Name},
+			})
+		}
+	}
+	return results
+}
+
+// Schedule registers periodic probes with a scheduler
+func (pr *Prober) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("rpcpool-probe", interval, func(ctx context.Context) error {
+		pr.Probe(ctx)
+		return nil
+	})
+}
+
+// read times a head query and checks for tracing support
+func (pr *Prober) read(ctx context.Context, e *Endpoint) Result {
+	r := Result{Endpoint: e.Name}
+	start := time.Now()
+	head, err := e.Client.BlockNumber(ctx)
+	r.Latency = time.Since(start)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Head = head
+	r.Trace = supportsTrace(ctx, e)
+	r.Archive = head > ArchiveDepth && servesArchive(ctx, e)
+	return r
+}
+
+// servesArchive asks for state at block 1, which full nodes have pruned
+func servesArchive(ctx context.Context, e *Endpoint) bool {
+	_, err := e.Client.BalanceAt(ctx, common.Address{}, big.NewInt(1))
+	return err == nil
+}
+
+// supportsTrace asks for a trace of a transaction that does not exist; nodes
+// with tracing answer "not found", others reject the method
+func supportsTrace(ctx context.Context, e *Endpoint) bool {
+	var out json.RawMessage
+	err := e.Client.Client().CallContext(ctx, &out, "debug_traceTransaction", common.Hash{}, map[string]string{"tracer": "callTracer"})
+	if err == nil || !isMethodNotFound(err) {
+		return true
+	}
+	err = e.Client.Client().CallContext(ctx, &out, "trace_transaction", common.Hash{})
+	return err == nil || !isMethodNotFound(err)
+}
+
+// write sends a zero-value self-transfer through the endpoint and waits for
+// the endpoint to return its receipt
+func (pr *Prober) write(ctx context.Context, e *Endpoint) (time.Duration, error) {
+	chainID, err := e.Client.ChainID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := Testnets[chainID.Uint64()]; !ok {
+		return 0, ErrNotTestnet
+	}
+	nonce, err := e.Client.PendingNonceAt(ctx, pr.Canary.Address)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := pr.Canary.BuildTx(ctx, pr.Canary.Address, units.Wei{}, &wallet.TxOpts{Nonce: &nonce})
+	if err != nil {
+		return 0, err
+	}
+	signedTx, err := pr.Canary.SignTx(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	start := clock.Or(pr.Clock).Now()
+	if err := e.Client.SendTransaction(ctx, signedTx); err != nil {
+		return 0, err
+	}
+	timeout := pr.ReceiptTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	poll := pr.ReceiptPoll
+	if poll <= 0 {
+		poll = time.Second
+	}
+	ctx, cancel := clock.WithTimeout(ctx, pr.Clock, timeout)
+	defer cancel()
+	ticker := clock.Or(pr.Clock).NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		_, err := e.Client.TransactionReceipt(ctx, signedTx.Hash())
+		if err == nil {
+			return clock.Since(pr.Clock, start), nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return 0, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("canary %s not mined: %w", signedTx.Hash().Hex(), ctx.Err())
+		case <-ticker.C():
+		}
+	}
+}
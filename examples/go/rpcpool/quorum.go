@@ -0,0 +1,217 @@
+package rpcpool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ErrInsufficientQuorum is returned when fewer endpoints answer than the
+// quorum requires
+var ErrInsufficientQuorum = errors.New("rpcpool: not enough endpoints answered for a quorum read")
+
+// DivergenceError reports endpoints that gave different answers to a
+// cross-checked read
+type DivergenceError struct {
+	Request string
+	Answers map[string]string // endpoint name to canonical JSON answer
+}
+
+// Error lists the answers by endpoint
+func (e *DivergenceError) Error() string {
+	names := make([]string, 0, len(e.Answers))
+	for name := range e.Answers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + e.Answers[name]
+	}
+	return fmt.Sprintf("rpcpool: endpoints disagree on %s: %s", e.Request, strings.Join(parts, ", "))
+}
+
+// CrossCheck runs fn on Quorum independent healthy endpoints and returns the
+// answer only if all agree, compared by their JSON encoding. An endpoint that
+// errors is replaced by the next one. With Quorum below 2 it is a plain Read
+func (p *Pool) CrossCheck(ctx context.Context, request string, fn func(ctx context.Context, c *ethclient.Client) (interface{}, error)) (interface{}, error) {
+	if p.Quorum < 2 {
+		var out interface{}
+		err := p.Read(ctx, func(ctx context.Context, c *ethclient.Client) error {
+			var err error
+			out, err = fn(ctx, c)
+			return err
+		})
+		return out, err
+	}
+
+	type answer struct {
+		endpoint string
+		value    interface{}
+		encoded  []byte
+	}
+	candidates := p.Healthy()
+	var (
+		mu      sync.Mutex
+		answers []answer
+		errs    []error
+		next    = 0
+	)
+	// Fill the quorum in rounds, replacing endpoints that error
+	for len(answers) < p.Quorum && next < len(candidates) {
+		need := p.Quorum - len(answers)
+		if need > len(candidates)-next {
+			need = len(candidates) - next
+		}
+		round := candidates[next : next+need]
+		next += need
+
+		var wg sync.WaitGroup
+		for _, e := range round {
+			wg.Add(1)
+			go func(e *Endpoint) {
+				defer wg.Done()
+				v, err := fn(ctx, e.Client)
+				var encoded []byte
+				if err == nil {
+					encoded, err = json.Marshal(v)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+					return
+				}
+				answers = append(answers, answer{e.Name, v, encoded})
+			}(e)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if len(answers) < p.Quorum {
+		return nil, fmt.Errorf("%w: %d of %d: %v", ErrInsufficientQuorum, len(answers), p.Quorum, errors.Join(errs...))
+	}
+
+	for _, a := range answers[1:] {
+		if !bytes.Equal(a.encoded, answers[0].encoded) {
+			div := &DivergenceError{Request: request, Answers: make(map[string]string, len(answers))}
+			for _, a := range answers {
+				div.Answers[a.endpoint] = string(a.encoded)
+			}
+			return nil, div
+		}
+	}
+	return answers[0].value, nil
+}
+
+// CheckedBalance returns an account balance agreed by the quorum. With a nil
+// block the balance is read at the lowest head the quorum has all seen, so
+// providers a block apart do not disagree
+func (p *Pool) CheckedBalance(ctx context.Context, account common.Address, block *big.Int) (*big.Int, error) {
+	if block == nil {
+		head, err := p.commonHead(ctx)
+		if err != nil {
+			return nil, err
+		}
+		block = new(big.Int).SetUint64(head)
+	}
+	v, err := p.CrossCheck(ctx, "balance of "+account.Hex()+" at "+block.String(), func(ctx context.Context, c *ethclient.Client) (interface{}, error) {
+		return c.BalanceAt(ctx, account, block)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*big.Int), nil
+}
+
+// receiptSummary is the part of a receipt every provider must agree on
+type receiptSummary struct {
+	Found       bool        `json:"found"`
+	Status      uint64      `json:"status"`
+	BlockHash   common.Hash `json:"blockHash"`
+	BlockNumber *big.Int    `json:"blockNumber"`
+	GasUsed     uint64      `json:"gasUsed"`
+	Logs        int         `json:"logs"`
+}
+
+// CheckedReceipt returns a receipt whose status, block and gas used are agreed
+// by the quorum. A receipt missing from some providers is a divergence, so
+// check receipts once they have a few confirmations
+func (p *Pool) CheckedReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	var (
+		mu    sync.Mutex
+		first *types.Receipt
+	)
+	_, err := p.CrossCheck(ctx, "receipt of "+hash.Hex(), func(ctx context.Context, c *ethclient.Client) (interface{}, error) {
+		rcpt, err := c.TransactionReceipt(ctx, hash)
+		if errors.Is(err, ethereum.NotFound) {
+			return receiptSummary{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		if first == nil {
+			first = rcpt
+		}
+		mu.Unlock()
+		return receiptSummary{
+			Found:       true,
+			Status:      rcpt.Status,
+			BlockHash:   rcpt.BlockHash,
+			BlockNumber: rcpt.BlockNumber,
+			GasUsed:     rcpt.GasUsed,
+			Logs:        len(rcpt.Logs),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, ethereum.NotFound
+	}
+	return first, nil
+}
+
+// commonHead returns the lowest head among the quorum's healthy endpoints
+func (p *Pool) commonHead(ctx context.Context) (uint64, error) {
+	endpoints := p.Healthy()
+	n := p.Quorum
+	if n < 1 {
+		n = 1
+	}
+	var (
+		lowest uint64
+		seen   int
+	)
+	for _, e := range endpoints {
+		if seen == n {
+			break
+		}
+		head, err := e.Client.BlockNumber(ctx)
+		if err != nil {
+			continue
+		}
+		if seen == 0 || head < lowest {
+			lowest = head
+		}
+		seen++
+	}
+	if seen == 0 {
+		return 0, ErrInsufficientQuorum
+	}
+	return lowest, nil
+}
@@ -0,0 +1,311 @@
+package rpcpool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ArchiveDepth is how many blocks behind the head full nodes keep state for;
+// queries for older state are routed to archive endpoints
+const ArchiveDepth = 128
+
+// Route is how a request is dispatched
+type Route int
+
+const (
+	RouteRead    Route = iota // fastest healthy endpoint first
+	RouteSend                 // every healthy endpoint at once
+	RouteArchive              // archive endpoints only
+	RouteTrace                // tracing endpoints only
+)
+
+var routeNames = map[Route]string{
+	RouteRead:    "read",
+	RouteSend:    "send",
+	RouteArchive: "archive",
+	RouteTrace:   "trace",
+}
+
+// String returns the route name
+func (r Route) String() string {
+	if name, ok := routeNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("route(%d)", int(r))
+}
+
+// ErrNoCapableEndpoint is returned when no endpoint can serve an archive or
+// trace request
+var ErrNoCapableEndpoint = errors.New("rpcpool: no endpoint supports this request")
+
+// sendMethods broadcast transactions
+var sendMethods = map[string]bool{
+	"eth_sendRawTransaction":            true,
+	"eth_sendRawTransactionConditional": true,
+}
+
+// blockArg is the position of the block parameter of state queries
+var blockArg = map[string]int{
+	"eth_getBalance":          1,
+	"eth_getCode":             1,
+	"eth_getTransactionCount": 1,
+	"eth_getStorageAt":        2,
+	"eth_call":                1,
+	"eth_getProof":            2,
+}
+
+// RouteFor classifies a JSON-RPC request. State queries at blocks more than
+// ArchiveDepth behind head are archive requests; with an unknown head (zero)
+// only "earliest" is
+func RouteFor(method string, args []interface{}, head uint64) Route {
+	switch {
+	case sendMethods[method]:
+		return RouteSend
+	case strings.HasPrefix(method, "debug_trace") || strings.HasPrefix(method, "trace_"):
+		return RouteTrace
+	}
+	i, ok := blockArg[method]
+	if !ok || i >= len(args) {
+		return RouteRead
+	}
+	n, ok := blockNumber(args[i])
+	if !ok {
+		return RouteRead
+	}
+	if n == 0 || (head > ArchiveDepth && n < head-ArchiveDepth) {
+		return RouteArchive
+	}
+	return RouteRead
+}
+
+// blockNumber extracts an explicit block number; tags other than "earliest"
+// report false
+func blockNumber(arg interface{}) (uint64, bool) {
+	switch v := arg.(type) {
+	case *big.Int:
+		if v == nil || !v.IsUint64() {
+			return 0, false
+		}
+		return v.Uint64(), true
+	case uint64:
+		return v, true
+	case hexutil.Uint64:
+		return uint64(v), true
+	case string:
+		if v == "earliest" {
+			return 0, true
+		}
+		n, err := hexutil.DecodeUint64(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Call performs a raw JSON-RPC request routed by RouteFor
+func (p *Pool) Call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	route := RouteFor(method, args, p.Head())
+	if route == RouteSend {
+		// Each endpoint decodes into its own buffer; the first answer wins
+		var (
+			mu    sync.Mutex
+			first json.RawMessage
+		)
+		err := p.broadcast(ctx, p.Healthy(), func(ctx context.Context, c *ethclient.Client) error {
+			var raw json.RawMessage
+			if err := c.Client().CallContext(ctx, &raw, method, args...); err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if first == nil {
+				first = raw
+			}
+			return nil
+		})
+		if err != nil || first == nil || result == nil {
+			return err
+		}
+		return json.Unmarshal(first, result)
+	}
+	endpoints, err := p.route(route)
+	if err != nil {
+		return err
+	}
+	return p.do(ctx, endpoints, func(ctx context.Context, c *ethclient.Client) error {
+		return c.Client().CallContext(ctx, result, method, args...)
+	})
+}
+
+// Read runs fn on the fastest healthy endpoint, falling back to slower and
+// then unhealthy ones
+func (p *Pool) Read(ctx context.Context, fn func(ctx context.Context, c *ethclient.Client) error) error {
+	endpoints, _ := p.route(RouteRead)
+	return p.do(ctx, endpoints, fn)
+}
+
+// Archive runs fn on archive endpoints, fastest first
+func (p *Pool) Archive(ctx context.Context, fn func(ctx context.Context, c *ethclient.Client) error) error {
+	endpoints, err := p.route(RouteArchive)
+	if err != nil {
+		return err
+	}
+	return p.do(ctx, endpoints, fn)
+}
+
+// Trace runs fn on endpoints that support tracing, fastest first
+func (p *Pool) Trace(ctx context.Context, fn func(ctx context.Context, c *ethclient.Client) error) error {
+	endpoints, err := p.route(RouteTrace)
+	if err != nil {
+		return err
+	}
+	return p.do(ctx, endpoints, fn)
+}
+
+// Broadcast sends a signed transaction to healthy endpoints simultaneously
+// and succeeds if any accepts it
+func (p *Pool) Broadcast(ctx context.Context, tx *types.Transaction) error {
+	return p.broadcast(ctx, p.Healthy(), func(ctx context.Context, c *ethclient.Client) error {
+		return c.SendTransaction(ctx, tx)
+	})
+}
+
+// Healthy returns the healthy endpoints, fastest first, or every endpoint
+// fastest first when none is healthy
+func (p *Pool) Healthy() []*Endpoint {
+	all := p.byLatency(p.endpoints())
+	var healthy []*Endpoint
+	for _, e := range all {
+		if p.healthy(e.Stats()) {
+			healthy = append(healthy, e)
+		}
+	}
+	if len(healthy) == 0 {
+		return all
+	}
+	return healthy
+}
+
+// Head returns the best head seen by the last probe, or zero before one ran
+func (p *Pool) Head() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.head
+}
+
+func (p *Pool) setHead(head uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if head > p.head {
+		p.head = head
+	}
+}
+
+// route orders endpoints for a route: capable and healthy first by latency,
+// then capable but unhealthy ones
+func (p *Pool) route(r Route) ([]*Endpoint, error) {
+	capable := func(e *Endpoint) bool { return true }
+	switch r {
+	case RouteArchive:
+		capable = func(e *Endpoint) bool { return e.Archive || e.Stats().Archive }
+	case RouteTrace:
+		capable = func(e *Endpoint) bool { return e.Stats().Trace }
+	}
+
+	endpoints := p.endpoints()
+	var healthy, unhealthy []*Endpoint
+	for _, e := range p.byLatency(endpoints) {
+		if !capable(e) {
+			continue
+		}
+		if p.healthy(e.Stats()) {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	if len(healthy)+len(unhealthy) == 0 {
+		if len(endpoints) == 0 {
+			return nil, ErrNoEndpoints
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNoCapableEndpoint, r)
+	}
+	return append(healthy, unhealthy...), nil
+}
+
+func (p *Pool) healthy(s Stats) bool {
+	if s.Requests == 0 {
+		return true
+	}
+	return s.Availability >= p.MinAvailability && s.HeadLag <= p.MaxHeadLag
+}
+
+// byLatency sorts endpoints by average latency; unmeasured endpoints keep
+// their configured order ahead of measured ones so they get measured
+func (p *Pool) byLatency(endpoints []*Endpoint) []*Endpoint {
+	out := append([]*Endpoint(nil), endpoints...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Stats(), out[j].Stats()
+		if a.Requests == 0 || b.Requests == 0 {
+			return a.Requests == 0 && b.Requests != 0
+		}
+		return a.Latency < b.Latency
+	})
+	return out
+}
+
+// broadcast runs fn on up to BroadcastFanout endpoints concurrently. A node
+// that already has the transaction counts as accepting it
+func (p *Pool) broadcast(ctx context.Context, endpoints []*Endpoint, fn func(ctx context.Context, c *ethclient.Client) error) error {
+	if len(endpoints) == 0 {
+		return ErrNoEndpoints
+	}
+	if p.BroadcastFanout > 0 && len(endpoints) > p.BroadcastFanout {
+		endpoints = endpoints[:p.BroadcastFanout]
+	}
+
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, e := range endpoints {
+		wg.Add(1)
+		go func(i int, e *Endpoint) {
+			defer wg.Done()
+			start := time.Now()
+			err := fn(ctx, e.Client)
+			if err != nil && alreadyKnown(err) {
+				err = nil
+			}
+			if err == nil || isAnswer(err) {
+				e.observe(time.Since(start), nil)
+			} else {
+				e.observe(time.Since(start), err)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", e.Name, err)
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func alreadyKnown(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
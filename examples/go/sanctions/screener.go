@@ -0,0 +1,274 @@
+package sanctions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+var (
+	// ErrSanctioned is returned for sends to a listed address
+	ErrSanctioned = errors.New("sanctions: counterparty is sanctioned")
+	// ErrUnavailable is returned when screening fails and FailOpen is off
+	ErrUnavailable = errors.New("sanctions: screening unavailable")
+)
+
+// Decision is the outcome of screening one address
+type Decision struct {
+	Address    common.Address `json:"address"`
+	Allowed    bool           `json:"allowed"`
+	Listed     []string       `json:"listed,omitempty"` // providers listing the address
+	Overridden bool           `json:"overridden,omitempty"`
+	Cached     bool           `json:"cached,omitempty"`
+	Time       time.Time      `json:"time"`
+}
+
+// Override is a compliance officer's decision that replaces screening for an
+// address, such as clearing a false positive or blocking one not yet listed
+type Override struct {
+	Address  common.Address `json:"address"`
+	Allow    bool           `json:"allow"`
+	Reason   string         `json:"reason"`
+	Approver string         `json:"approver"`
+	Expires  time.Time      `json:"expires,omitempty"` // zero never expires
+}
+
+type cached struct {
+	decision Decision
+	until    time.Time
+}
+
+// Screener checks counterparties against every provider before a send.
+// Results are cached for CacheTTL; every decision, cached or not, is audited
+type Screener struct {
+	Providers []Provider
+	CacheTTL  time.Duration // zero is one hour
+	// FailOpen allows sends when a provider fails; by default a failing
+	// provider blocks them
+	FailOpen bool
+	Timeout  time.Duration // per screening from the sign hook; zero is 10 seconds
+	Audit    audit.Log
+	Clock    clock.Clock
+
+	mu        sync.Mutex
+	cache     map[common.Address]cached
+	overrides map[common.Address]Override
+}
+
+// NewScreener creates a screener over the given providers
+func NewScreener(auditLog audit.Log, providers ...Provider) *Screener {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Screener{
+		Providers: providers,
+		Audit:     auditLog,
+		cache:     make(map[common.Address]cached),
+		overrides: make(map[common.Address]Override),
+	}
+}
+
+// Screen decides whether addr may be sent to. A blocked address returns the
+// decision and ErrSanctioned
+func (s *Screener) Screen(ctx context.Context, addr common.Address) (*Decision, error) {
+	now := clock.Or(s.Clock).Now()
+	s.mu.Lock()
+	if o, ok := s.overrides[addr]; ok && (o.Expires.IsZero() || now.Before(o.Expires)) {
+		s.mu.Unlock()
+		d := &Decision{Address: addr, Allowed: o.Allow, Overridden: true, Time: now.UTC()}
+		s.record(ctx, d, map[string]string{"approver": o.Approver, "reason": o.Reason})
+		return d, blocked(d)
+	}
+	if c, ok := s.cache[addr]; ok && now.Before(c.until) {
+		s.mu.Unlock()
+		d := c.decision
+		d.Cached = true
+		s.record(ctx, &d, nil)
+		return &d, blocked(&d)
+	}
+	s.mu.Unlock()
+
+	d := &Decision{Address: addr, Allowed: true, Time: now.UTC()}
+	var failures []string
+	for _, p := range s.Providers {
+		listed, err := p.Sanctioned(ctx, addr)
+		if err != nil {
+			failures = append(failures, p.Name()+": "+err.Error())
+			continue
+		}
+		if listed {
+			d.Listed = append(d.Listed, p.Name())
+			d.Allowed = false
+		}
+	}
+	if len(failures) > 0 && d.Allowed {
+		details := map[string]string{"failures": strings.Join(failures, "; ")}
+		if !s.FailOpen {
+			d.Allowed = false
+			s.record(ctx, d, details)
+			return d, fmt.Errorf("%w: %s", ErrUnavailable, details["failures"])
+		}
+		s.record(ctx, d, details)
+		return d, nil // not cached, so the next send screens again
+	}
+
+	ttl := s.CacheTTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	s.mu.Lock()
+	s.cache[addr] = cached{decision: *d, until: now.Add(ttl)}
+	s.mu.Unlock()
+	s.record(ctx, d, nil)
+	return d, blocked(d)
+}
+
+// SetOverride records an override; it takes effect immediately
+func (s *Screener) SetOverride(ctx context.Context, o Override) error {
+	if o.Approver == "" || o.Reason == "" {
+		return errors.New("sanctions: overrides need an approver and a reason")
+	}
+	s.mu.Lock()
+	s.overrides[o.Address] = o
+	delete(s.cache, o.Address)
+	s.mu.Unlock()
+	outcome := "block"
+	if o.Allow {
+		outcome = "allow"
+	}
+	s.Audit.Record(ctx, audit.Entry{
+		Actor:   o.Approver,
+		Action:  "sanctions-override",
+		Subject: o.Address.Hex(),
+		Outcome: outcome,
+		Details: map[string]string{"reason": o.Reason, "expires": formatTime(o.Expires)},
+	})
+	return nil
+}
+
+// RemoveOverride returns an address to normal screening
+func (s *Screener) RemoveOverride(ctx context.Context, addr common.Address, approver string) {
+	s.mu.Lock()
+	delete(s.overrides, addr)
+	s.mu.Unlock()
+	s.Audit.Record(ctx, audit.Entry{Actor: approver, Action: "sanctions-override", Subject: addr.Hex(), Outcome: "removed"})
+}
+
+// Overrides returns the overrides in effect
+func (s *Screener) Overrides() []Override {
+	now := clock.Or(s.Clock).Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Override
+	for _, o := range s.overrides {
+		if o.Expires.IsZero() || now.Before(o.Expires) {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// Flush drops cached decisions, such as after a list update
+func (s *Screener) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = make(map[common.Address]cached)
+}
+
+// Check screens the counterparties of a transaction: its recipient and, for
+// ERC-20 transfers and approvals, the token recipient or spender
+func (s *Screener) Check(ctx context.Context, tx *types.Transaction) error {
+	for _, addr := range Counterparties(tx) {
+		if _, err := s.Screen(ctx, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Install screens every transaction the wallet signs, before any sign hook
+// already installed, such as a watchtower's journal
+func (s *Screener) Install(w *wallet.Wallet) {
+	w.WrapSignHook(func(next wallet.SignHook) wallet.SignHook {
+		return func(tx *types.Transaction) error {
+			timeout := s.Timeout
+			if timeout <= 0 {
+				timeout = 10 * time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := s.Check(ctx, tx); err != nil {
+				return err
+			}
+			if next != nil {
+				return next(tx)
+			}
+			return nil
+		}
+	})
+}
+
+// Counterparties returns the addresses a transaction sends value or rights to
+func Counterparties(tx *types.Transaction) []common.Address {
+	if tx.To() == nil {
+		return nil
+	}
+	out := []common.Address{*tx.To()}
+	// ERC-20 calls whose first argument is a counterparty
+	if to, _, ok := contract.DecodeTransfer(tx.Data()); ok {
+		out = append(out, to)
+	} else if spender, _, ok := contract.DecodeApprove(tx.Data()); ok {
+		out = append(out, spender)
+	}
+	return out
+}
+
+func (s *Screener) record(ctx context.Context, d *Decision, details map[string]string) {
+	if details == nil {
+		details = make(map[string]string)
+	}
+	if len(d.Listed) > 0 {
+		details["listed"] = strings.Join(d.Listed, ",")
+	}
+	if d.Cached {
+		details["cached"] = "true"
+	}
+	if d.Overridden {
+		details["overridden"] = "true"
+	}
+	outcome := "allowed"
+	if !d.Allowed {
+		outcome = "blocked"
+	}
+	s.Audit.Record(ctx, audit.Entry{
+		Actor:   "sanctions",
+		Action:  "sanctions-screen",
+		Subject: d.Address.Hex(),
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+func blocked(d *Decision) error {
+	if d.Allowed {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSanctioned, d.Address.Hex())
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
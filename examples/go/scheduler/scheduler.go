@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/whisperchain/go-examples/clock"
+)
+
+// Job is a unit of periodic work
+type Job func(ctx context.Context) error
+
+type entry struct {
+	interval time.Duration
+	job      Job
+	cancel   context.CancelFunc
+}
+
+// Scheduler runs named jobs at fixed intervals
+type Scheduler struct {
+	// OnError is called when a job returns an error; nil ignores errors
+	OnError func(name string, err error)
+	// Clock paces the jobs; nil is the wall clock
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	ctx     context.Context
+	wg      sync.WaitGroup
+	running bool
+}
+
+// New creates an idle scheduler
+func New() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*entry)}
+}
+
+// Every registers a job to run at the given interval; if the scheduler is
+// already running the job starts immediately
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) error {
+	if interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %q already scheduled", name)
+	}
+	e := &entry{interval: interval, job: job}
+	s.jobs[name] = e
+	if s.running {
+		s.start(name, e)
+	}
+	return nil
+}
+
+// Remove stops and unregisters a job
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.jobs[name]; ok {
+		if e.cancel != nil {
+			e.cancel()
+		}
+		delete(s.jobs, name)
+	}
+}
+
+// Run starts all jobs and blocks until ctx is cancelled and jobs have stopped
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errors.New("scheduler already running")
+	}
+	s.running = true
+	s.ctx = ctx
+	for name, e := range s.jobs {
+		s.start(name, e)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+	return ctx.Err()
+}
+
+// start launches a job loop; callers must hold s.mu
+func (s *Scheduler) start(name string, e *entry) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	e.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := clock.Or(s.Clock).NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := e.job(ctx); err != nil && s.OnError != nil && ctx.Err() == nil {
+				s.OnError(name, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"html/template"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/channelregistry"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/keyregistry"
+	"github.com/whisperchain/go-examples/relay"
+)
+
+//go:embed explorer.html
+var explorerHTML string
+
+var explorerTemplates = template.Must(template.New("explorer").Parse(explorerHTML))
+
+// Explorer is a small HTML block explorer for self-hosted deployments. It
+// shows WHSP transfers, channel registrations, key registry events and relayed
+// message IDs straight from the node, with no third-party explorer. Any of
+// Channels, Keys and Relay may be nil to leave that section out
+type Explorer struct {
+	Client     *ethclient.Client
+	Indexer    *indexer.Indexer
+	Token      common.Address // WHSP token
+	Channels   *channelregistry.Registry
+	Keys       *keyregistry.Registry
+	Relay      *relay.Relay
+	StartBlock uint64      // block the contracts were deployed at
+	Window     uint64      // blocks scanned for transfers
+	Limit      int         // rows per section
+	Clock      clock.Clock // picks the recent messages window; nil is the wall clock
+
+	mu sync.Mutex // the indexer's header cache is not safe for concurrent use
+}
+
+// NewExplorer creates an explorer scanning the last 5000 blocks for
+// transfers and showing 50 rows per section
+func NewExplorer(client *ethclient.Client, token common.Address, channels *channelregistry.Registry, keys *keyregistry.Registry, r *relay.Relay) *Explorer {
+	return &Explorer{
+		Client:   client,
+		Indexer:  indexer.New(client, true, token),
+		Token:    token,
+		Channels: channels,
+		Keys:     keys,
+		Relay:    r,
+		Window:   5000,
+		Limit:    50,
+	}
+}
+
+// explorerPage is the data both explorer templates render
+type explorerPage struct {
+	Title        string
+	Query        string
+	Error        string
+	Head         uint64
+	Window       uint64
+	Transfers    []transferRow
+	Channels     []channelRow
+	Keys         []keyregistry.KeyEvent
+	Messages     []messageRow
+	Balance      string
+	TokenBalance string
+	KeyInfo      *keyregistry.KeyInfo
+}
+
+type transferRow struct {
+	Block  uint64
+	TxHash common.Hash
+	From   common.Address
+	To     common.Address
+	Amount string
+	Symbol string
+}
+
+type channelRow struct {
+	Name    string
+	Owner   common.Address
+	Access  string
+	Created string
+}
+
+type messageRow struct {
+	ID   common.Hash
+	Time string
+}
+
+// EnableExplorer serves the explorer under /explorer/. Pages are cached like
+// the other public reads
+func (p *Public) EnableExplorer(e *Explorer) {
+	p.mux.HandleFunc("/explorer/", p.cached(e.handleIndex))
+	p.mux.HandleFunc("/explorer/address", p.cached(e.handleAddress))
+}
+
+func (e *Explorer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/explorer/" {
+		http.NotFound(w, r)
+		return
+	}
+	ctx := r.Context()
+	page := &explorerPage{Title: "Overview", Window: e.Window}
+	head, err := e.Client.BlockNumber(ctx)
+	if err != nil {
+		e.render(w, http.StatusBadGateway, "index", page, err)
+		return
+	}
+	page.Head = head
+
+	if page.Transfers, err = e.recentTransfers(ctx, head); err != nil {
+		e.render(w, http.StatusBadGateway, "index", page, err)
+		return
+	}
+	if e.Channels != nil {
+		channels, err := e.Channels.List(ctx, e.StartBlock)
+		if err != nil {
+			e.render(w, http.StatusBadGateway, "index", page, err)
+			return
+		}
+		page.Channels = e.channelRows(channels)
+	}
+	if e.Keys != nil {
+		events, err := e.Keys.Events(ctx, e.StartBlock)
+		if err != nil {
+			e.render(w, http.StatusBadGateway, "index", page, err)
+			return
+		}
+		reverse(events)
+		page.Keys = events[:min(len(events), e.Limit)]
+	}
+	if e.Relay != nil {
+		now := clock.Or(e.Clock).Now()
+		envs, err := e.Relay.Envelopes(ctx, common.Address{}, now.Add(-24*time.Hour), now.Add(time.Minute))
+		if err != nil {
+			e.render(w, http.StatusInternalServerError, "index", page, err)
+			return
+		}
+		reverse(envs)
+		for _, env := range envs[:min(len(envs), e.Limit)] {
+			page.Messages = append(page.Messages, messageRow{ID: env.ID, Time: formatTime(env.Timestamp)})
+		}
+	}
+	e.render(w, http.StatusOK, "index", page, nil)
+}
+
+func (e *Explorer) handleAddress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := strings.TrimSpace(r.URL.Query().Get("address"))
+	page := &explorerPage{Title: query, Query: query, Window: e.Window}
+	if !common.IsHexAddress(query) {
+		e.render(w, http.StatusBadRequest, "address", page, errors.New("invalid address"))
+		return
+	}
+	addr := common.HexToAddress(query)
+	page.Title, page.Query = addr.Hex(), addr.Hex()
+
+	head, err := e.Client.BlockNumber(ctx)
+	if err != nil {
+		e.render(w, http.StatusBadGateway, "address", page, err)
+		return
+	}
+	page.Head = head
+
+	balance, err := e.Client.BalanceAt(ctx, addr, nil)
+	if err != nil {
+		e.render(w, http.StatusBadGateway, "address", page, err)
+		return
+	}
+	page.Balance = formatUnits(balance, 18)
+
+	tokenBalance, err := contract.NewERC20(e.Token, e.Client).BalanceOf(ctx, addr)
+	if err != nil {
+		e.render(w, http.StatusBadGateway, "address", page, err)
+		return
+	}
+	page.TokenBalance = tokenBalance.String()
+
+	e.mu.Lock()
+	transfers, err := e.Indexer.Transfers(ctx, addr, e.fromBlock(head), head)
+	e.mu.Unlock()
+	if err != nil {
+		e.render(w, http.StatusBadGateway, "address", page, err)
+		return
+	}
+	reverse(transfers)
+	for _, t := range transfers[:min(len(transfers), e.Limit)] {
+		row := transferRow{Block: t.BlockNumber, TxHash: t.TxHash, From: t.From, To: t.To}
+		if token := t.Amount.Token(); token.Symbol != "" {
+			row.Amount, row.Symbol = formatUnits(t.Amount.Base(), token.Decimals), token.Symbol
+		} else {
+			row.Amount, row.Symbol = t.Amount.Base().String(), t.Asset.Hex()
+		}
+		page.Transfers = append(page.Transfers, row)
+	}
+
+	if e.Keys != nil {
+		ki, err := e.Keys.KeyInfo(ctx, addr)
+		if err != nil {
+			e.render(w, http.StatusBadGateway, "address", page, err)
+			return
+		}
+		if ki.Registered() {
+			page.KeyInfo = ki
+		}
+	}
+	if e.Channels != nil {
+		owned, err := e.Channels.OwnedBy(ctx, addr, e.StartBlock)
+		if err != nil {
+			e.render(w, http.StatusBadGateway, "address", page, err)
+			return
+		}
+		page.Channels = e.channelRows(owned)
+	}
+	e.render(w, http.StatusOK, "address", page, nil)
+}
+
+// recentTransfers returns the newest WHSP transfers in the scan window
+func (e *Explorer) recentTransfers(ctx context.Context, head uint64) ([]transferRow, error) {
+	token := contract.NewERC20(e.Token, e.Client)
+	info, err := token.GetTokenInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := token.FilterTransfers(ctx, e.fromBlock(head), &head, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Raw.BlockNumber != events[j].Raw.BlockNumber {
+			return events[i].Raw.BlockNumber > events[j].Raw.BlockNumber
+		}
+		return events[i].Raw.Index > events[j].Raw.Index
+	})
+	rows := make([]transferRow, 0, min(len(events), e.Limit))
+	for _, ev := range events[:min(len(events), e.Limit)] {
+		rows = append(rows, transferRow{
+			Block:  ev.Raw.BlockNumber,
+			TxHash: ev.Raw.TxHash,
+			From:   ev.From,
+			To:     ev.To,
+			Amount: formatUnits(ev.Value, info.Decimals),
+			Symbol: info.Symbol,
+		})
+	}
+	return rows, nil
+}
+
+// channelRows lists channels newest first
+func (e *Explorer) channelRows(channels []*channelregistry.Channel) []channelRow {
+	rows := make([]channelRow, 0, len(channels))
+	for i := len(channels) - 1; i >= 0 && len(rows) < e.Limit; i-- {
+		c := channels[i]
+		access := "open"
+		if rules, err := c.Rules(); err != nil {
+			access = "unknown"
+		} else if rules.TokenGated() && rules.Paid() {
+			access = "token gated, paid"
+		} else if rules.TokenGated() {
+			access = "token gated"
+		} else if rules.Paid() {
+			access = "paid"
+		}
+		rows = append(rows, channelRow{Name: c.Name, Owner: c.Owner, Access: access, Created: formatTime(int64(c.CreatedAt))})
+	}
+	return rows
+}
+
+func (e *Explorer) fromBlock(head uint64) uint64 {
+	from := e.StartBlock
+	if head > e.Window && head-e.Window > from {
+		from = head - e.Window
+	}
+	return from
+}
+
+func (e *Explorer) render(w http.ResponseWriter, status int, name string, page *explorerPage, err error) {
+	if err != nil {
+		page.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	explorerTemplates.ExecuteTemplate(w, name, page)
+}
+
+// formatUnits renders base units with decimals as a decimal string, trimming
+// trailing zeros
+func formatUnits(amount *big.Int, decimals uint8) string {
+	s := new(big.Rat).SetFrac(amount, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)).FloatString(int(decimals))
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04 UTC")
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
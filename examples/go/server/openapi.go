@@ -0,0 +1,310 @@
+package server
+
+import (
+	"encoding"
+	"math/big"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// swaggerUIVersion is the swagger-ui-dist release the docs page loads
+const swaggerUIVersion = "5.17.14"
+
+// Param documents a query or header parameter of a route
+type Param struct {
+	Name        string
+	In          string // "query" or "header"
+	Description string
+	Required    bool
+}
+
+// OpenAPIDocument is an OpenAPI 3.0 document
+type OpenAPIDocument struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       OpenAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// OpenAPIInfo describes the API
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Operation is one method on a path
+type Operation struct {
+	OperationID  string                `json:"operationId"`
+	Summary      string                `json:"summary,omitempty"`
+	Parameters   []Parameter           `json:"parameters,omitempty"`
+	RequestBody  *RequestBody          `json:"requestBody,omitempty"`
+	Responses    map[string]*Response  `json:"responses"`
+	Security     []map[string][]string `json:"security"`
+	RequiredRole string                `json:"x-required-role,omitempty"`
+}
+
+// Parameter is an OpenAPI parameter object
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is an OpenAPI request body object
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is an OpenAPI response object
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the shared schemas and security schemes
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is an OpenAPI security scheme object
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	Name   string `json:"name,omitempty"`
+	In     string `json:"in,omitempty"`
+}
+
+// Schema is the subset of JSON Schema the generator emits
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	addressType   = reflect.TypeOf(common.Address{})
+	hashType      = reflect.TypeOf(common.Hash{})
+	bigIntType    = reflect.TypeOf(big.Int{})
+	hexBytesType  = reflect.TypeOf(hexutil.Bytes{})
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// OpenAPI describes routes as an OpenAPI 3 document. Request and response
+// schemas are derived from the example values on each route by reflection,
+// following their json tags
+func OpenAPI(title, version string, routes []Route) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    OpenAPIInfo{Title: title, Version: version},
+		Paths:   make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]SecurityScheme{
+				"apiKey": {Type: "apiKey", Name: "X-API-Key", In: "header"},
+				"bearer": {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+	errorSchema := doc.schema(reflect.TypeOf(ErrorResponse{}))
+
+	for _, route := range routes {
+		op := &Operation{
+			OperationID: route.Name,
+			Summary:     route.Summary,
+			Responses: map[string]*Response{
+				"default": {Description: "Error", Content: jsonContent(errorSchema)},
+			},
+			Security: []map[string][]string{},
+		}
+		if !route.Public {
+			op.Security = []map[string][]string{{"apiKey": {}}, {"bearer": {}}}
+			op.RequiredRole = route.Role.String()
+		}
+		for _, p := range route.Params {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        p.Name,
+				In:          p.In,
+				Description: p.Description,
+				Required:    p.Required,
+				Schema:      &Schema{Type: "string"},
+			})
+		}
+		if route.Request != nil {
+			op.RequestBody = &RequestBody{Required: true, Content: jsonContent(doc.schema(reflect.TypeOf(route.Request)))}
+		}
+		if route.Response != nil {
+			op.Responses["200"] = &Response{Description: "OK", Content: jsonContent(doc.schema(reflect.TypeOf(route.Response)))}
+		} else {
+			op.Responses["204"] = &Response{Description: "No Content"}
+		}
+
+		if doc.Paths[route.Path] == nil {
+			doc.Paths[route.Path] = make(map[string]*Operation)
+		}
+		doc.Paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+// schema returns the schema for t, registering named structs as components
+func (d *OpenAPIDocument) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64"}
+	case addressType:
+		return &Schema{Type: "string", Pattern: "^0x[0-9a-fA-F]{40}$"}
+	case hashType:
+		return &Schema{Type: "string", Pattern: "^0x[0-9a-fA-F]{64}$"}
+	case bigIntType:
+		return &Schema{Type: "integer"}
+	case hexBytesType:
+		return &Schema{Type: "string", Pattern: "^0x([0-9a-fA-F]{2})*$"}
+	}
+	if reflect.PtrTo(t).Implements(textMarshaler) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		name := componentName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			d.Components.Schemas[name] = &Schema{} // placeholder for recursive types
+			d.Components.Schemas[name] = d.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+// object describes a struct's exported fields by their json names
+func (d *OpenAPIDocument) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// componentName names a schema after its type, spelling out the type
+// arguments of generic types: Page[*messaging.Envelope] becomes PageEnvelope
+func componentName(t reflect.Type) string {
+	name, args, ok := strings.Cut(t.Name(), "[")
+	if !ok {
+		return name
+	}
+	for _, arg := range strings.Split(strings.TrimSuffix(args, "]"), ",") {
+		arg = arg[strings.LastIndex(arg, ".")+1:]
+		name += strings.Trim(arg, "*[]")
+	}
+	return name
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+// serveOpenAPI serves the document from doc at /openapi.json and a Swagger
+// UI for it at /docs/. The document is built per request so routes added
+// later are included
+func serveOpenAPI(mux *http.ServeMux, doc func() *OpenAPIDocument) {
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		writeJSON(w, http.StatusOK, doc())
+	})
+	mux.HandleFunc("/docs/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(swaggerUIPage))
+	})
+}
+
+// EnableOpenAPI serves the server's OpenAPI document at /openapi.json and a
+// Swagger UI at /docs/, both without authentication
+func (s *Server) EnableOpenAPI(title, version string) {
+	serveOpenAPI(s.mux, func() *OpenAPIDocument { return OpenAPI(title, version, s.Routes()) })
+}
+
+// EnableOpenAPI serves the public API's OpenAPI document at /openapi.json
+// and a Swagger UI at /docs/
+func (p *Public) EnableOpenAPI(title, version string) {
+	serveOpenAPI(p.mux, func() *OpenAPIDocument { return OpenAPI(title, version, p.Routes()) })
+}
+
+var swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>WhisperChain API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/paging"
+	"github.com/whisperchain/go-examples/relay"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// maxCacheEntries bounds the public response cache
+const maxCacheEntries = 10000
+
+// Public is a read-only API for explorers. It holds no wallet and needs no
+// credentials: callers are rate limited by IP and chain reads are cached.
+// Messages are only returned to callers proving they are the recipient
+type Public struct {
+	Client    *ethclient.Client
+	Relay     *relay.Relay // nil disables message retrieval
+	RateLimit float64      // requests per second per IP
+	Burst     int
+	CacheTTL  time.Duration
+	// ProofWindow is how old a recipient proof may be
+	ProofWindow time.Duration
+	// Timeout bounds each cached chain read
+	Timeout time.Duration
+	// Clock ages proofs and cache entries; nil is the wall clock
+	Clock clock.Clock
+	// TrustProxy takes the client IP from X-Forwarded-For; only enable it
+	// behind a proxy that sets the header
+	TrustProxy bool
+
+	limiter *limiter
+	cache   *responseCache
+	routes  []Route
+	mux     *http.ServeMux
+}
+
+// TokenResponse is returned by GET /v1/public/token
+type TokenResponse struct {
+	Address     string `json:"address"`
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol"`
+	Decimals    uint8  `json:"decimals"`
+	TotalSupply string `json:"totalSupply"`
+}
+
+// NewPublic creates a public API allowing 5 requests a second per IP with
+// bursts of 20, caching chain reads for 15 seconds
+func NewPublic(client *ethclient.Client, r *relay.Relay) *Public {
+	p := &Public{
+		Client:      client,
+		Relay:       r,
+		RateLimit:   5,
+		Burst:       20,
+		CacheTTL:    15 * time.Second,
+		ProofWindow: 5 * time.Minute,
+		Timeout:     10 * time.Second,
+		limiter:     newLimiter(),
+		cache:       &responseCache{entries: make(map[string]*cachedResponse)},
+		mux:         http.NewServeMux(),
+	}
+	address := Param{Name: "address", In: "query", Required: true}
+	p.handle(Route{Name: "public-balance", Path: "/v1/public/balance", Handler: p.cached(p.handleBalance),
+		Summary: "ETH balance of an address in wei", Params: []Param{address}, Response: BalanceResponse{}})
+	p.handle(Route{Name: "public-token", Path: "/v1/public/token", Handler: p.cached(p.handleToken),
+		Summary: "ERC-20 token metadata", Params: []Param{{Name: "address", In: "query", Description: "token contract", Required: true}}, Response: TokenResponse{}})
+	p.handle(Route{Name: "public-token-balance", Path: "/v1/public/token/balance", Handler: p.cached(p.handleTokenBalance),
+		Summary: "ERC-20 balance of an address", Params: []Param{{Name: "token", In: "query", Required: true}, address}, Response: BalanceResponse{}})
+	p.handle(Route{Name: "public-messages", Path: "/v1/public/messages", Handler: p.handleMessages,
+		Summary: "Envelopes received by a recipient, who proves their identity with a signature",
+		Params: []Param{
+			{Name: "recipient", In: "query", Required: true},
+			{Name: "since", In: "query", Description: "unix seconds"},
+			{Name: "cursor", In: "query", Description: "next cursor of the previous page"},
+			{Name: "limit", In: "query", Description: "page size"},
+			{Name: "X-Recipient-Timestamp", In: "header", Description: "unix seconds", Required: true},
+			{Name: "X-Recipient-Signature", In: "header", Description: "personal_sign over RecipientProofMessage", Required: true},
+		},
+		Response: paging.Page[*messaging.Envelope]{}})
+	return p
+}
+
+// Routes returns the public API's routes
+func (p *Public) Routes() []Route {
+	return append([]Route(nil), p.routes...)
+}
+
+// handle registers a read-only route
+func (p *Public) handle(route Route) {
+	route.Method, route.Public = http.MethodGet, true
+	p.routes = append(p.routes, route)
+	p.mux.HandleFunc(route.Path, route.Handler)
+}
+
+// ServeHTTP implements http.Handler
+func (p *Public) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "read-only API")
+		return
+	}
+	if !p.limiter.allow(&Principal{ID: "ip:" + p.clientIP(r), RateLimit: p.RateLimit, Burst: p.Burst}, clock.Or(p.Clock).Now()) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	p.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the public API on addr
+func (p *Public) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, p)
+}
+
+// RecipientProofMessage is what a recipient personal_signs to list their
+// messages; timestamp is unix seconds
+func RecipientProofMessage(recipient common.Address, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("WhisperChain messages for %s at %d", recipient.Hex(), timestamp))
+}
+
+func (p *Public) handleBalance(w http.ResponseWriter, r *http.Request) {
+	addr, ok := addressParam(w, r, "address")
+	if !ok {
+		return
+	}
+	balance, err := p.Client.BalanceAt(r.Context(), addr, nil)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, BalanceResponse{Address: addr.Hex(), Balance: balance.String()})
+}
+
+func (p *Public) handleToken(w http.ResponseWriter, r *http.Request) {
+	token, ok := addressParam(w, r, "address")
+	if !ok {
+		return
+	}
+	info, err := contract.NewERC20(token, p.Client).GetTokenInfo(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, TokenResponse{
+		Address:     token.Hex(),
+		Name:        info.Name,
+		Symbol:      info.Symbol,
+		Decimals:    info.Decimals,
+		TotalSupply: info.TotalSupply.String(),
+	})
+}
+
+func (p *Public) handleTokenBalance(w http.ResponseWriter, r *http.Request) {
+	token, ok := addressParam(w, r, "token")
+	if !ok {
+		return
+	}
+	addr, ok := addressParam(w, r, "address")
+	if !ok {
+		return
+	}
+	balance, err := contract.NewERC20(token, p.Client).BalanceOf(r.Context(), addr)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, BalanceResponse{Address: addr.Hex(), Balance: balance.String()})
+}
+
+// handleMessages pages through envelopes received by recipient since the
+// optional since parameter (unix seconds). The caller proves it is the recipient with
+// X-Recipient-Timestamp and X-Recipient-Signature, a personal_sign over
+// RecipientProofMessage. Responses are never cached
+func (p *Public) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if p.Relay == nil {
+		writeError(w, http.StatusNotFound, "message retrieval disabled")
+		return
+	}
+	recipient, ok := addressParam(w, r, "recipient")
+	if !ok {
+		return
+	}
+	ts, err := strconv.ParseInt(r.Header.Get("X-Recipient-Timestamp"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "missing recipient proof")
+		return
+	}
+	age := clock.Since(p.Clock, time.Unix(ts, 0))
+	if age < -time.Minute || age > p.ProofWindow {
+		writeError(w, http.StatusUnauthorized, "recipient proof expired")
+		return
+	}
+	sig := common.FromHex(r.Header.Get("X-Recipient-Signature"))
+	if !wallet.VerifyPersonalSignature(RecipientProofMessage(recipient, ts), sig, recipient) {
+		writeError(w, http.StatusUnauthorized, "invalid recipient proof")
+		return
+	}
+
+	req, err := paging.ParseRequest(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+		since = time.Unix(n, 0)
+	}
+	page, err := p.Relay.Page(r.Context(), relay.Query{Recipient: recipient, Since: since, Until: clock.Or(p.Clock).Now().Add(time.Minute)}, req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, page)
+}
+
+// cached serves repeated requests for the same URL from memory for CacheTTL.
+// Only successful responses are kept
+func (p *Public) cached(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path + "?" + r.URL.Query().Encode()
+		maxAge := strconv.Itoa(int(p.CacheTTL / time.Second))
+		now := clock.Or(p.Clock).Now()
+		if c, ok := p.cache.get(key, now); ok {
+			w.Header().Set("Content-Type", c.contentType)
+			w.Header().Set("Cache-Control", "public, max-age="+maxAge)
+			w.Header().Set("X-Cache", "hit")
+			w.WriteHeader(c.status)
+			w.Write(c.body)
+			return
+		}
+
+		rec := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		ctx := r.Context()
+		if p.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = clock.WithTimeout(ctx, p.Clock, p.Timeout)
+			defer cancel()
+		}
+		h(rec, r.WithContext(ctx))
+
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		if rec.status == http.StatusOK {
+			p.cache.put(key, now, &cachedResponse{
+				status:      rec.status,
+				contentType: rec.header.Get("Content-Type"),
+				body:        rec.body.Bytes(),
+				expires:     now.Add(p.CacheTTL),
+			})
+			w.Header().Set("Cache-Control", "public, max-age="+maxAge)
+		}
+		w.Header().Set("X-Cache", "miss")
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	}
+}
+
+func (p *Public) clientIP(r *http.Request) string {
+	if p.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	return remoteHost(r)
+}
+
+// remoteHost returns the IP of the request's peer
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func addressParam(w http.ResponseWriter, r *http.Request, name string) (common.Address, bool) {
+	v := r.URL.Query().Get(name)
+	if !common.IsHexAddress(v) {
+		writeError(w, http.StatusBadRequest, "invalid "+name)
+		return common.Address{}, false
+	}
+	return common.HexToAddress(v), true
+}
+
+// cachedResponse is a stored response body
+type cachedResponse struct {
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// responseCache is a TTL cache of response bodies keyed by URL
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+func (c *responseCache) get(key string, now time.Time) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || now.After(e.expires) {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *responseCache) put(key string, now time.Time, e *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCacheEntries {
+		for k, old := range c.entries {
+			if now.After(old.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = e
+}
+
+// bufferedResponse holds a handler's response so it can be cached
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
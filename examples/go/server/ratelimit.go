@@ -0,0 +1,78 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often allow drops buckets that have refilled
+const sweepInterval = time.Minute
+
+// bucket is a token bucket refilled at rate tokens per second
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket refills to its burst; past it the bucket is
+	// indistinguishable from a new one and can be dropped
+	full time.Time
+}
+
+// limiter keeps one token bucket per principal, dropping idle ones
+type limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{buckets: make(map[string]*bucket)}
+}
+
+// allow consumes a token for the principal at now, reporting whether one was
+// available
+func (l *limiter) allow(p *Principal, now time.Time) bool {
+	if p.RateLimit <= 0 {
+		return true
+	}
+	burst := float64(p.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[p.ID]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[p.ID] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * p.RateLimit
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((burst - b.tokens) / p.RateLimit * float64(time.Second)))
+	return allowed
+}
+
+// sweep drops buckets that have refilled, at most once per sweepInterval
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for id, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, id)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterRefills(t *testing.T) {
+	l := newLimiter()
+	p := &Principal{ID: "k", RateLimit: 2, Burst: 2}
+	now := time.Unix(1_700_000_000, 0)
+
+	if !l.allow(p, now) || !l.allow(p, now) {
+		t.Fatal("burst not allowed")
+	}
+	if l.allow(p, now) {
+		t.Fatal("allowed past the burst")
+	}
+	if !l.allow(p, now.Add(500*time.Millisecond)) {
+		t.Fatal("token not refilled")
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	l := newLimiter()
+	now := time.Unix(1_700_000_000, 0)
+
+	// Many one-off callers, as from distinct IPs
+	for i := 0; i < 1000; i++ {
+		l.allow(&Principal{ID: string(rune('a' + i)), RateLimit: 1, Burst: 5}, now)
+	}
+	busy := &Principal{ID: "busy", RateLimit: 0.001, Burst: 1}
+	l.allow(busy, now)
+	if len(l.buckets) != 1001 {
+		t.Fatalf("got %d buckets", len(l.buckets))
+	}
+
+	// Idle buckets refill within a second; the busy one takes 1000s
+	now = now.Add(sweepInterval)
+	l.allow(&Principal{ID: "new", RateLimit: 1, Burst: 5}, now)
+	if len(l.buckets) != 2 {
+		t.Fatalf("got %d buckets after sweep, want busy and new", len(l.buckets))
+	}
+	if l.allow(busy, now) {
+		t.Fatal("the sweep reset a drained bucket")
+	}
+}
+
+func TestLimiterUnlimitedKeepsNoState(t *testing.T) {
+	l := newLimiter()
+	for i := 0; i < 100; i++ {
+		if !l.allow(&Principal{ID: string(rune(i))}, time.Now()) {
+			t.Fatal("unlimited principal refused")
+		}
+	}
+	if len(l.buckets) != 0 {
+		t.Fatalf("got %d buckets", len(l.buckets))
+	}
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whisperchain/go-examples/clock"
+)
+
+// Role is an access level; higher roles include the permissions of lower ones
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleOperator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+// String returns the role name
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// Allows reports whether the role satisfies a required role
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// ParseRole parses a role name
+func ParseRole(s string) (Role, error) {
+	for role, name := range roleNames {
+		if name == s {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q", s)
+}
+
+// Principal is an authenticated caller
+type Principal struct {
+	ID        string
+	Role      Role
+	Tenant    string  // stamped on the request's metadata; empty for single-tenant deployments
+	RateLimit float64 // requests per second; zero means unlimited
+	Burst     int
+}
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWeakSecret         = errors.New("jwt secret is shorter than 32 bytes")
+)
+
+// Authenticator resolves the principal behind a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// APIKeys authenticates requests carrying an X-API-Key header. Keys may carry
+// an expiry so they can be rotated with an overlap window.
+type APIKeys struct {
+	Clock clock.Clock // expires rotated keys; nil is the wall clock
+
+	mu   sync.RWMutex
+	keys map[[32]byte]*apiKey
+}
+
+type apiKey struct {
+	principal Principal
+	expires   time.Time // zero means no expiry
+}
+
+// NewAPIKeys creates an empty API key set
+func NewAPIKeys() *APIKeys {
+	return &APIKeys{keys: make(map[[32]byte]*apiKey)}
+}
+
+// Add maps an API key to a principal; only the key hash is kept
+func (k *APIKeys) Add(key string, p Principal) {
+	k.AddWithExpiry(key, p, time.Time{})
+}
+
+// AddWithExpiry maps an API key to a principal until expires
+func (k *APIKeys) AddWithExpiry(key string, p Principal, expires time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[sha256.Sum256([]byte(key))] = &apiKey{principal: p, expires: expires}
+}
+
+// AddHash maps the SHA-256 hash of an API key to a principal, for keys
+// kept only as hashes
+func (k *APIKeys) AddHash(hash [32]byte, p Principal) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[hash] = &apiKey{principal: p}
+}
+
+// Rotate issues newKey for the principal behind oldKey and lets oldKey keep
+// working for the grace period so clients can switch over
+func (k *APIKeys) Rotate(oldKey, newKey string, grace time.Duration) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	old, ok := k.keys[sha256.Sum256([]byte(oldKey))]
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	k.keys[sha256.Sum256([]byte(newKey))] = &apiKey{principal: old.principal}
+
+	expires := clock.Or(k.Clock).Now().Add(grace)
+	if old.expires.IsZero() || expires.Before(old.expires) {
+		old.expires = expires
+	}
+	return nil
+}
+
+// Revoke removes an API key
+func (k *APIKeys) Revoke(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, sha256.Sum256([]byte(key)))
+}
+
+// Authenticate looks up the request's API key
+func (k *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	entry, ok := k.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if !entry.expires.IsZero() && clock.Or(k.Clock).Now().After(entry.expires) {
+		return nil, ErrInvalidCredentials
+	}
+	principal := entry.principal
+	return &principal, nil
+}
+
+// MinJWTSecret is the shortest HMAC key JWTAuth accepts
+const MinJWTSecret = 32
+
+// JWTAuth authenticates HS256 bearer tokens with sub, role and exp claims
+type JWTAuth struct {
+	Secret    []byte // at least MinJWTSecret bytes
+	Issuer    string
+	RateLimit float64
+	Burst     int
+	Clock     clock.Clock // nil is the wall clock
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	Issuer    string `json:"iss"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Authenticate verifies the bearer token and maps its claims to a principal
+func (j *JWTAuth) Authenticate(r *http.Request) (*Principal, error) {
+	if len(j.Secret) < MinJWTSecret {
+		return nil, ErrWeakSecret
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidCredentials
+	}
+
+	mac := hmac.New(sha256.New, j.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidCredentials
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if claims.ExpiresAt == 0 || clock.Or(j.Clock).Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidCredentials
+	}
+	if j.Issuer != "" && claims.Issuer != j.Issuer {
+		return nil, ErrInvalidCredentials
+	}
+	role, err := ParseRole(claims.Role)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		ID:        "jwt:" + claims.Subject,
+		Role:      role,
+		RateLimit: j.RateLimit,
+		Burst:     j.Burst,
+	}, nil
+}
+
+// Issue creates a signed token for a subject and role
+func (j *JWTAuth) Issue(subject string, role Role, ttl time.Duration) (string, error) {
+	if len(j.Secret) < MinJWTSecret {
+		return "", ErrWeakSecret
+	}
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(jwtClaims{
+		Subject:   subject,
+		Role:      role.String(),
+		Issuer:    j.Issuer,
+		ExpiresAt: clock.Or(j.Clock).Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, j.Secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Chain tries authenticators in order, skipping those that find no credentials
+type Chain []Authenticator
+
+// Authenticate returns the first principal found
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+// WithPrincipal attaches a principal to a context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the authenticated principal, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWTAuthNeedsSecret(t *testing.T) {
+	var zero JWTAuth
+	if _, err := zero.Issue("alice", RoleAdmin, time.Hour); !errors.Is(err, ErrWeakSecret) {
+		t.Fatalf("issue without a secret: got %v", err)
+	}
+	other, err := (&JWTAuth{Secret: bytes.Repeat([]byte{1}, MinJWTSecret)}).Issue("mallory", RoleAdmin, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/v1/balance", nil)
+	r.Header.Set("Authorization", "Bearer "+other)
+	if _, err := zero.Authenticate(r); !errors.Is(err, ErrWeakSecret) {
+		t.Fatalf("authenticate without a secret: got %v", err)
+	}
+	if _, err := (&JWTAuth{Secret: []byte("short")}).Authenticate(r); !errors.Is(err, ErrWeakSecret) {
+		t.Fatalf("authenticate with a short secret: got %v", err)
+	}
+
+	j := &JWTAuth{Secret: bytes.Repeat([]byte{2}, MinJWTSecret)}
+	tok, err := j.Issue("alice", RoleOperator, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+tok)
+	p, err := j.Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "jwt:alice" || p.Role != RoleOperator {
+		t.Fatalf("got principal %+v", p)
+	}
+}
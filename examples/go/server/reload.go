@@ -0,0 +1,26 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/whisperchain/go-examples/config"
+)
+
+// EnableReload lets deployment admins apply the configuration file without a
+// restart, the same as sending the process SIGHUP
+func (s *Server) EnableReload(rl *config.Reloader) {
+	s.Handle(Route{Name: "reload-config", Method: http.MethodPost, Path: "/v1/admin/reload", Role: RoleAdmin,
+		Summary: "Reload endpoints, policy, gas strategy and alert routes", Response: config.Change{},
+		Handler: s.deploymentAdmin(func(w http.ResponseWriter, r *http.Request) {
+			change, err := rl.Reload(r.Context())
+			switch {
+			case errors.Is(err, config.ErrInvalid):
+				writeError(w, http.StatusUnprocessableEntity, err.Error())
+			case err != nil:
+				writeError(w, http.StatusInternalServerError, "reload failed; the running configuration is unchanged")
+			default:
+				writeJSON(w, http.StatusOK, change)
+			}
+		})})
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/retention"
+)
+
+// EnableRetention lets deployment admins erase a data subject's records
+// across every store and apply retention limits on demand
+func (s *Server) EnableRetention(m *retention.Manager) {
+	s.Handle(Route{Name: "erase-subject", Method: http.MethodPost, Path: "/v1/admin/erase", Role: RoleAdmin,
+		Summary: "Erase every record about an address and return a signed attestation",
+		Params:  []Param{{Name: "address", In: "query", Description: "data subject", Required: true}}, Response: retention.Attestation{},
+		Handler: s.deploymentAdmin(func(w http.ResponseWriter, r *http.Request) {
+			address := r.URL.Query().Get("address")
+			if !common.IsHexAddress(address) {
+				writeError(w, http.StatusBadRequest, "invalid address")
+				return
+			}
+			att, err := m.Erase(r.Context(), common.HexToAddress(address))
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "erasure incomplete; repeat the request")
+				return
+			}
+			writeJSON(w, http.StatusOK, att)
+		})})
+	s.Handle(Route{Name: "enforce-retention", Method: http.MethodPost, Path: "/v1/admin/retention/enforce", Role: RoleAdmin,
+		Summary: "Delete records past their retention period", Response: map[string]int{},
+		Handler: s.deploymentAdmin(func(w http.ResponseWriter, r *http.Request) {
+			deleted, err := m.Enforce(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "retention run incomplete")
+				return
+			}
+			writeJSON(w, http.StatusOK, deleted)
+		})})
+}
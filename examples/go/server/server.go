@@ -0,0 +1,329 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/policy"
+	"github.com/whisperchain/go-examples/reqctx"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Route is an HTTP endpoint gated by a minimum role. Summary, Params,
+// Request and Response document it in the OpenAPI document
+type Route struct {
+	Name    string
+	Method  string
+	Path    string
+	Role    Role
+	Handler http.HandlerFunc
+	Public  bool // served without authentication, role checks or rate limits
+
+	Summary  string
+	Params   []Param
+	Request  interface{} // a value of the JSON body type, or nil for none
+	Response interface{} // a value of the JSON response type, or nil for no content
+}
+
+// Server exposes wallet operations over HTTP with role-based access control
+type Server struct {
+	Wallet *wallet.Wallet
+	Auth   Authenticator
+	Audit  audit.Log
+	Policy *policy.Engine // optional; consulted after role checks
+	Clock  clock.Clock    // refills rate limits; nil is the wall clock
+
+	tenants *Tenants
+	limiter *limiter
+	routes  []Route
+	mux     *http.ServeMux
+}
+
+// New creates a server with the default wallet routes
+func New(w *wallet.Wallet, auth Authenticator, auditLog audit.Log) *Server {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	s := &Server{
+		Wallet:  w,
+		Auth:    auth,
+		Audit:   auditLog,
+		limiter: newLimiter(),
+		mux:     http.NewServeMux(),
+	}
+
+	s.Handle(Route{Name: "get-balance", Method: http.MethodGet, Path: "/v1/balance", Role: RoleViewer, Handler: s.handleBalance,
+		Summary: "Wallet ETH balance in wei", Response: BalanceResponse{}})
+	s.Handle(Route{Name: "get-address", Method: http.MethodGet, Path: "/v1/address", Role: RoleViewer, Handler: s.handleAddress,
+		Summary: "Wallet address", Response: AddressResponse{}})
+	s.Handle(Route{Name: "send-transfer", Method: http.MethodPost, Path: "/v1/transfer", Role: RoleOperator, Handler: s.handleTransfer,
+		Summary: "Send ETH from the wallet", Request: TransferRequest{}, Response: TransferResponse{}})
+	s.Handle(Route{Name: "export-key", Method: http.MethodPost, Path: "/v1/admin/export-key", Role: RoleAdmin, Handler: s.handleExportKey,
+		Summary: "Export the wallet private key", Response: ExportKeyResponse{}})
+	return s
+}
+
+// Handle registers a route behind authentication, authorization, rate limiting
+// and audit logging; Public routes only have their method checked
+func (s *Server) Handle(route Route) {
+	s.routes = append(s.routes, route)
+	if route.Public {
+		s.mux.Handle(route.Path, allowMethod(route))
+		return
+	}
+	s.mux.Handle(route.Path, s.guard(route))
+}
+
+// Routes returns the registered routes
+func (s *Server) Routes() []Route {
+	return append([]Route(nil), s.routes...)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API on addr
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+// guard wraps a route handler with access control and auditing
+func (s *Server) guard(route Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != route.Method {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		r = withMetadata(w, r)
+
+		p, err := s.Auth.Authenticate(r)
+		if err != nil {
+			s.record(r, "anonymous", route, http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		var tenant *Tenant
+		if p.Tenant != "" {
+			// A tenant principal never falls back to the server's wallet
+			if s.tenants == nil {
+				s.record(r, p.ID, route, http.StatusForbidden)
+				writeError(w, http.StatusForbidden, "tenants are not enabled")
+				return
+			}
+			t, ok := s.tenants.Get(p.Tenant)
+			if !ok {
+				s.record(r, p.ID, route, http.StatusForbidden)
+				writeError(w, http.StatusForbidden, ErrUnknownTenant.Error())
+				return
+			}
+			tenant = t
+			r = r.WithContext(WithTenant(r.Context(), t))
+		}
+		if !p.Role.Allows(route.Role) {
+			s.record(r, p.ID, route, http.StatusForbidden)
+			writeError(w, http.StatusForbidden, "requires role "+route.Role.String())
+			return
+		}
+		if s.Policy != nil {
+			d := s.Policy.Evaluate(policy.Request{
+				Subject:    p.ID,
+				Action:     route.Name,
+				Resource:   r.URL.Path,
+				Attributes: map[string]string{"role": p.Role.String()},
+			})
+			if !d.Allowed {
+				s.record(r, p.ID, route, http.StatusForbidden)
+				writeError(w, http.StatusForbidden, "denied by policy")
+				return
+			}
+		}
+		if tenant != nil {
+			d := tenant.Policy.Evaluate(policy.Request{
+				Subject:    p.ID,
+				Action:     route.Name,
+				Resource:   r.URL.Path,
+				Attributes: map[string]string{"role": p.Role.String(), "tenant": tenant.ID},
+			})
+			if !d.Allowed {
+				s.record(r, p.ID, route, http.StatusForbidden)
+				writeError(w, http.StatusForbidden, "denied by tenant policy")
+				return
+			}
+			switch err := s.tenants.admit(tenant); {
+			case errors.Is(err, ErrTenantSuspended):
+				s.record(r, p.ID, route, http.StatusForbidden)
+				writeError(w, http.StatusForbidden, err.Error())
+				return
+			case err != nil:
+				s.record(r, p.ID, route, http.StatusTooManyRequests)
+				writeError(w, http.StatusTooManyRequests, err.Error())
+				return
+			}
+		}
+		if !s.limiter.allow(p, clock.Or(s.Clock).Now()) {
+			s.record(r, p.ID, route, http.StatusTooManyRequests)
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		// The tenant comes from the credentials, never from the header
+		ctx := reqctx.WithTenant(WithPrincipal(r.Context(), p), p.Tenant)
+		r = r.WithContext(ctx)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		route.Handler(rec, r)
+		s.record(r, p.ID, route, rec.status)
+	})
+}
+
+// allowMethod serves a public route, refusing other methods
+func allowMethod(route Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != route.Method {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		route.Handler(w, withMetadata(w, r))
+	})
+}
+
+// withMetadata starts the request's span, continuing the caller's trace when
+// it sent one, and echoes the trace id so callers can quote it in reports
+func withMetadata(w http.ResponseWriter, r *http.Request) *http.Request {
+	m := reqctx.FromRequest(r)
+	m.Tenant = ""
+	ctx, m := reqctx.Child(reqctx.With(r.Context(), m))
+	w.Header().Set(reqctx.HeaderTrace, m.TraceID)
+	return r.WithContext(ctx)
+}
+
+func (s *Server) record(r *http.Request, actor string, route Route, status int) {
+	outcome := "ok"
+	if status >= 400 {
+		outcome = "denied"
+		if status >= 500 || status == http.StatusBadRequest {
+			outcome = "error"
+		}
+	}
+	if t, ok := TenantFromContext(r.Context()); ok {
+		t.count(status)
+	}
+	details := reqctx.FromContext(r.Context()).Fields()
+	details["status"] = strconv.Itoa(status)
+	details["remote"] = r.RemoteAddr
+	s.Audit.Record(r.Context(), audit.Entry{
+		Actor:   actor,
+		Action:  route.Name,
+		Subject: r.URL.Path,
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+// BalanceResponse is returned by GET /v1/balance
+type BalanceResponse struct {
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+}
+
+// AddressResponse is returned by GET /v1/address
+type AddressResponse struct {
+	Address string `json:"address"`
+}
+
+// TransferRequest is the body of POST /v1/transfer
+type TransferRequest struct {
+	To     string `json:"to"`
+	Amount string `json:"amount"` // wei, decimal
+}
+
+// TransferResponse is returned by POST /v1/transfer
+type TransferResponse struct {
+	TxHash string `json:"txHash"`
+}
+
+// ExportKeyResponse is returned by POST /v1/admin/export-key
+type ExportKeyResponse struct {
+	PrivateKey string `json:"privateKey"`
+}
+
+// ErrorResponse is returned for failed requests
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	balance, err := s.wallet(r).GetBalance(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, BalanceResponse{Address: s.wallet(r).Address.Hex(), Balance: balance.String()})
+}
+
+func (s *Server) handleAddress(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, AddressResponse{Address: s.wallet(r).Address.Hex()})
+}
+
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	to, amount, err := parseTransfer(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := s.wallet(r).Transfer(r.Context(), to, amount)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, TransferResponse{TxHash: tx.Hash().Hex()})
+}
+
+func (s *Server) handleExportKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ExportKeyResponse{PrivateKey: s.wallet(r).GetPrivateKeyHex()})
+}
+
+func parseTransfer(req TransferRequest) (common.Address, units.Wei, error) {
+	if !common.IsHexAddress(req.To) {
+		return common.Address{}, units.Wei{}, errors.New("invalid address")
+	}
+	amount, err := units.ParseWei(req.Amount)
+	if err != nil || amount.Sign() <= 0 {
+		return common.Address{}, units.Wei{}, errors.New("invalid amount")
+	}
+	return common.HexToAddress(req.To), amount, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: msg})
+}
+
+// statusRecorder captures the response status for auditing
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
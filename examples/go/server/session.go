@@ -0,0 +1,452 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/reqctx"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Session token prefixes; other bearer tokens are left to later authenticators
+const (
+	accessPrefix  = "wsa_"
+	refreshPrefix = "wsr_"
+)
+
+// ErrTooManyNonces is returned by Nonce while MaxNonces are outstanding
+var ErrTooManyNonces = errors.New("server: too many outstanding nonces")
+
+// RoleFunc maps a signed-in address to its role; false refuses the login
+type RoleFunc func(addr common.Address) (Role, bool)
+
+// SessionTokens is returned by login and refresh
+type SessionTokens struct {
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	AccessExpiresAt  time.Time `json:"accessExpiresAt"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+	Address          string    `json:"address"`
+	Role             string    `json:"role"`
+}
+
+// session is one sign-in; refreshing rotates its tokens
+type session struct {
+	id             string
+	address        common.Address
+	role           Role
+	access         [32]byte
+	refresh        [32]byte
+	accessExpires  time.Time
+	refreshExpires time.Time
+	expires        time.Time    // end of the SIWE message's validity, if any
+	spent          []spentToken // rotated refresh tokens, oldest first
+}
+
+// spentToken is a rotated refresh token, kept until it would have expired
+// so that presenting it again is caught as a copy
+type spentToken struct {
+	key     [32]byte
+	expires time.Time
+}
+
+// pruneInterval is how often requests sweep expired sessions and spent
+// refresh tokens
+const pruneInterval = time.Minute
+
+// Sessions signs callers in with SIWE and then authenticates them by short
+// lived bearer tokens, so clients do not sign every request. Refresh tokens
+// are single use: presenting a rotated one revokes the whole session, as it
+// means the token was copied
+type Sessions struct {
+	Domain     string // SIWE domain clients must sign for
+	ChainID    uint64 // zero accepts any chain
+	Roles      RoleFunc
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	NonceTTL   time.Duration
+	MaxNonces  int // outstanding nonces; Nonce refuses more until some expire or are used
+	RateLimit  float64
+	Burst      int
+	// NonceRateLimit and NonceBurst limit nonce requests per client IP
+	NonceRateLimit float64
+	NonceBurst     int
+	Clock          clock.Clock // expires tokens and nonces; nil is the wall clock
+
+	mu         sync.Mutex
+	nonces     map[string]time.Time
+	nonceOrder []string // issue order, which is expiry order as NonceTTL is fixed
+	sessions   map[string]*session
+	access     map[[32]byte]*session
+	refresh    map[[32]byte]*session
+	rotated    map[[32]byte]string // spent refresh token -> session id
+	pruned     time.Time           // last sweep of sessions
+}
+
+// NewSessions creates a session authenticator for domain with 15 minute
+// access tokens and 24 hour refresh tokens. At most 10000 nonces are
+// outstanding, and each IP may request one a second with bursts of 10
+func NewSessions(domain string, roles RoleFunc) *Sessions {
+	return &Sessions{
+		Domain:         domain,
+		Roles:          roles,
+		AccessTTL:      15 * time.Minute,
+		RefreshTTL:     24 * time.Hour,
+		NonceTTL:       5 * time.Minute,
+		MaxNonces:      10000,
+		NonceRateLimit: 1,
+		NonceBurst:     10,
+		nonces:         make(map[string]time.Time),
+		sessions:       make(map[string]*session),
+		access:         make(map[[32]byte]*session),
+		refresh:        make(map[[32]byte]*session),
+		rotated:        make(map[[32]byte]string),
+	}
+}
+
+// Nonce issues a single-use nonce for a SIWE message
+func (s *Sessions) Nonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := clock.Or(s.Clock).Now()
+	s.prune(now)
+	if s.MaxNonces > 0 && len(s.nonces) >= s.MaxNonces {
+		return "", ErrTooManyNonces
+	}
+	s.nonces[nonce] = now.Add(s.NonceTTL)
+	s.nonceOrder = append(s.nonceOrder, nonce)
+	return nonce, nil
+}
+
+// Login verifies a signed SIWE message and starts a session
+func (s *Sessions) Login(message string, signature []byte) (*SessionTokens, error) {
+	m, err := ParseSIWE(message)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Or(s.Clock).Now()
+	switch {
+	case m.Domain != s.Domain:
+		return nil, ErrInvalidCredentials
+	case s.ChainID != 0 && m.ChainID != s.ChainID:
+		return nil, ErrInvalidCredentials
+	case !m.Valid(now):
+		return nil, ErrInvalidCredentials
+	case !wallet.VerifyPersonalSignature([]byte(message), signature, m.Address):
+		return nil, ErrInvalidCredentials
+	}
+	role, ok := s.Roles(m.Address)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.nonces[m.Nonce]
+	if !ok || now.After(expires) {
+		return nil, ErrInvalidCredentials
+	}
+	delete(s.nonces, m.Nonce)
+
+	id, err := randomToken("")
+	if err != nil {
+		return nil, err
+	}
+	sess := &session{id: id, address: m.Address, role: role, expires: m.ExpirationTime}
+	s.sessions[id] = sess
+	return s.issue(sess, now)
+}
+
+// Refresh exchanges a refresh token for new tokens
+func (s *Sessions) Refresh(refreshToken string) (*SessionTokens, error) {
+	key := sha256.Sum256([]byte(refreshToken))
+	now := clock.Or(s.Clock).Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	if id, spent := s.rotated[key]; spent {
+		if sess, ok := s.sessions[id]; ok {
+			s.end(sess)
+		}
+		return nil, ErrInvalidCredentials
+	}
+	sess, ok := s.refresh[key]
+	if !ok || now.After(sess.refreshExpires) {
+		return nil, ErrInvalidCredentials
+	}
+	if !sess.expires.IsZero() && !now.Before(sess.expires) {
+		s.end(sess)
+		return nil, ErrInvalidCredentials
+	}
+	delete(s.access, sess.access)
+	delete(s.refresh, sess.refresh)
+	s.rotated[sess.refresh] = sess.id
+	sess.spent = append(sess.spent, spentToken{key: sess.refresh, expires: sess.refreshExpires})
+	return s.issue(sess, now)
+}
+
+// Revoke ends the session an access or refresh token belongs to
+func (s *Sessions) Revoke(token string) bool {
+	key := sha256.Sum256([]byte(token))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.access[key]
+	if !ok {
+		sess, ok = s.refresh[key]
+	}
+	if ok {
+		s.end(sess)
+	}
+	return ok
+}
+
+// RevokeAddress ends every session of an address
+func (s *Sessions) RevokeAddress(addr common.Address) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, sess := range s.sessions {
+		if sess.address == addr {
+			s.end(sess)
+			n++
+		}
+	}
+	return n
+}
+
+// Authenticate resolves a session access token
+func (s *Sessions) Authenticate(r *http.Request) (*Principal, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !strings.HasPrefix(token, accessPrefix) {
+		return nil, ErrNoCredentials
+	}
+	key := sha256.Sum256([]byte(token))
+	now := clock.Or(s.Clock).Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	sess, ok := s.access[key]
+	if !ok || now.After(sess.accessExpires) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{
+		ID:        "siwe:" + sess.address.Hex(),
+		Role:      sess.role,
+		RateLimit: s.RateLimit,
+		Burst:     s.Burst,
+	}, nil
+}
+
+// issue creates a token pair for sess; the caller holds the lock
+func (s *Sessions) issue(sess *session, now time.Time) (*SessionTokens, error) {
+	access, err := randomToken(accessPrefix)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken(refreshPrefix)
+	if err != nil {
+		return nil, err
+	}
+	sess.access, sess.refresh = sha256.Sum256([]byte(access)), sha256.Sum256([]byte(refresh))
+	sess.accessExpires, sess.refreshExpires = now.Add(s.AccessTTL), now.Add(s.RefreshTTL)
+	if !sess.expires.IsZero() {
+		if sess.expires.Before(sess.accessExpires) {
+			sess.accessExpires = sess.expires
+		}
+		if sess.expires.Before(sess.refreshExpires) {
+			sess.refreshExpires = sess.expires
+		}
+	}
+	s.access[sess.access] = sess
+	s.refresh[sess.refresh] = sess
+	return &SessionTokens{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		AccessExpiresAt:  sess.accessExpires,
+		RefreshExpiresAt: sess.refreshExpires,
+		Address:          sess.address.Hex(),
+		Role:             sess.role.String(),
+	}, nil
+}
+
+// end removes a session and its tokens; the caller holds the lock
+func (s *Sessions) end(sess *session) {
+	delete(s.sessions, sess.id)
+	delete(s.access, sess.access)
+	delete(s.refresh, sess.refresh)
+	for _, t := range sess.spent {
+		delete(s.rotated, t.key)
+	}
+}
+
+// prune drops expired nonces and, at most once per pruneInterval, expired
+// sessions and spent refresh tokens that have expired, after which they
+// fail as unknown; the caller holds the lock
+func (s *Sessions) prune(now time.Time) {
+	s.expireNonces(now)
+	if now.Sub(s.pruned) < pruneInterval {
+		return
+	}
+	s.pruned = now
+	for _, sess := range s.sessions {
+		if now.After(sess.refreshExpires) {
+			s.end(sess)
+			continue
+		}
+		n := 0
+		for _, t := range sess.spent {
+			if !now.After(t.expires) {
+				break
+			}
+			delete(s.rotated, t.key)
+			n++
+		}
+		sess.spent = sess.spent[n:]
+	}
+}
+
+// expireNonces drops nonces issued more than NonceTTL ago, oldest first,
+// and the order entries of nonces already used; the caller holds the lock
+func (s *Sessions) expireNonces(now time.Time) {
+	n := 0
+	for _, nonce := range s.nonceOrder {
+		expires, ok := s.nonces[nonce]
+		if ok && !now.After(expires) {
+			break
+		}
+		delete(s.nonces, nonce)
+		n++
+	}
+	s.nonceOrder = s.nonceOrder[n:]
+}
+
+func randomToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// LoginRequest is the body of POST /v1/auth/login
+type LoginRequest struct {
+	Message   string `json:"message"`   // EIP-4361 message
+	Signature string `json:"signature"` // personal_sign signature, hex
+}
+
+// RefreshRequest is the body of POST /v1/auth/refresh and /v1/auth/logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// NonceResponse is returned by GET /v1/auth/nonce
+type NonceResponse struct {
+	Nonce string `json:"nonce"`
+}
+
+// EnableSessions serves SIWE login under /v1/auth/ and accepts session
+// access tokens ahead of the server's other authenticators
+func (s *Server) EnableSessions(sess *Sessions) {
+	s.Auth = Chain{sess, s.Auth}
+	s.Handle(Route{Name: "session-nonce", Method: http.MethodGet, Path: "/v1/auth/nonce", Public: true,
+		Summary: "Issue a nonce for a SIWE message", Response: NonceResponse{},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			client := &Principal{ID: "nonce-ip:" + remoteHost(r), RateLimit: sess.NonceRateLimit, Burst: sess.NonceBurst}
+			if !s.limiter.allow(client, clock.Or(sess.Clock).Now()) {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			nonce, err := sess.Nonce()
+			switch {
+			case errors.Is(err, ErrTooManyNonces):
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, err.Error())
+				return
+			case err != nil:
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, NonceResponse{Nonce: nonce})
+		}})
+	s.Handle(Route{Name: "session-login", Method: http.MethodPost, Path: "/v1/auth/login", Public: true,
+		Summary: "Sign in with a signed SIWE message", Request: LoginRequest{}, Response: SessionTokens{},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var req LoginRequest
+			if !decodePost(w, r, &req) {
+				return
+			}
+			tokens, err := sess.Login(req.Message, common.FromHex(req.Signature))
+			s.authResult(w, r, "session-login", tokens, err)
+		}})
+	s.Handle(Route{Name: "session-refresh", Method: http.MethodPost, Path: "/v1/auth/refresh", Public: true,
+		Summary: "Exchange a refresh token for new tokens", Request: RefreshRequest{}, Response: SessionTokens{},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var req RefreshRequest
+			if !decodePost(w, r, &req) {
+				return
+			}
+			tokens, err := sess.Refresh(req.RefreshToken)
+			s.authResult(w, r, "session-refresh", tokens, err)
+		}})
+	s.Handle(Route{Name: "session-logout", Method: http.MethodPost, Path: "/v1/auth/logout", Public: true,
+		Summary: "End the session a refresh token belongs to", Request: RefreshRequest{},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var req RefreshRequest
+			if !decodePost(w, r, &req) {
+				return
+			}
+			sess.Revoke(req.RefreshToken)
+			w.WriteHeader(http.StatusNoContent)
+		}})
+}
+
+func (s *Server) authResult(w http.ResponseWriter, r *http.Request, action string, tokens *SessionTokens, err error) {
+	actor, outcome := "anonymous", "denied"
+	if tokens != nil {
+		actor, outcome = "siwe:"+tokens.Address, "ok"
+	}
+	details := reqctx.FromContext(r.Context()).Fields()
+	details["remote"] = r.RemoteAddr
+	s.Audit.Record(r.Context(), audit.Entry{Actor: actor, Action: action, Subject: r.URL.Path, Outcome: outcome, Details: details})
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, tokens)
+	}
+}
+
+func decodePost(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return false
+	}
+	return true
+}
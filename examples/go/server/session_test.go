@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+func TestNonceCap(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+	s := NewSessions("example.com", nil)
+	s.Clock, s.MaxNonces, s.NonceTTL = clk, 3, time.Minute
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Nonce(); err != nil {
+			t.Fatalf("nonce %d: %v", i, err)
+		}
+		clk.Advance(10 * time.Second)
+	}
+	if _, err := s.Nonce(); !errors.Is(err, ErrTooManyNonces) {
+		t.Fatalf("past the cap: got %v", err)
+	}
+
+	// The first nonce expires at 60s; by 61s its slot is free again
+	clk.Set(time.Unix(1_700_000_061, 0))
+	if _, err := s.Nonce(); err != nil {
+		t.Fatalf("after the oldest expired: %v", err)
+	}
+	if len(s.nonces) != 3 || len(s.nonceOrder) != 3 {
+		t.Fatalf("got %d nonces, %d in order", len(s.nonces), len(s.nonceOrder))
+	}
+	if _, err := s.Nonce(); !errors.Is(err, ErrTooManyNonces) {
+		t.Fatalf("cap not kept after eviction: got %v", err)
+	}
+
+	clk.Advance(time.Hour)
+	if _, err := s.Nonce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.nonces) != 1 || len(s.nonceOrder) != 1 {
+		t.Fatalf("expired nonces kept: %d, %d in order", len(s.nonces), len(s.nonceOrder))
+	}
+}
+
+func TestLoginFreesNonce(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	w := &wallet.Wallet{PrivateKey: key, Address: crypto.PubkeyToAddress(key.PublicKey)}
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+	s := NewSessions("example.com", func(common.Address) (Role, bool) { return RoleViewer, true })
+	s.Clock, s.MaxNonces = clk, 1
+
+	nonce, err := s.Nonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &SIWEMessage{Domain: "example.com", Address: w.Address, URI: "https://example.com", Version: "1", ChainID: 1, Nonce: nonce, IssuedAt: clk.Now()}
+	sig, err := w.SignPersonalMessage([]byte(m.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Login(m.String(), sig); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Login(m.String(), sig); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("nonce reused: got %v", err)
+	}
+	if _, err := s.Nonce(); err != nil {
+		t.Fatalf("used nonce still counts toward the cap: %v", err)
+	}
+}
+
+func TestNonceRouteRateLimited(t *testing.T) {
+	sess := NewSessions("example.com", nil)
+	sess.Clock = clock.NewFake(time.Unix(1_700_000_000, 0))
+	sess.NonceRateLimit, sess.NonceBurst = 1, 2
+	srv := New(nil, Chain{}, nil)
+	srv.EnableSessions(sess)
+
+	get := func(remote string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/auth/nonce", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := get("192.0.2.1:1000"); code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, code)
+		}
+	}
+	if code := get("192.0.2.1:2000"); code != http.StatusTooManyRequests {
+		t.Fatalf("past the burst: status %d", code)
+	}
+	if code := get("192.0.2.2:1000"); code != http.StatusOK {
+		t.Fatalf("other client: status %d", code)
+	}
+}
+
+func TestSpentRefreshTokens(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+	s := NewSessions("example.com", func(common.Address) (Role, bool) { return RoleViewer, true })
+	s.Clock = clk
+	login := func() *SessionTokens {
+		key, _ := crypto.GenerateKey()
+		w := &wallet.Wallet{PrivateKey: key, Address: crypto.PubkeyToAddress(key.PublicKey)}
+		nonce, err := s.Nonce()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &SIWEMessage{Domain: "example.com", Address: w.Address, URI: "https://example.com", Version: "1", ChainID: 1, Nonce: nonce, IssuedAt: clk.Now()}
+		sig, err := w.SignPersonalMessage([]byte(m.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens, err := s.Login(m.String(), sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens
+	}
+
+	copied, kept := login(), login()
+	first := copied.RefreshToken
+	for i := 0; i < 3; i++ {
+		var err error
+		if copied, err = s.Refresh(copied.RefreshToken); err != nil {
+			t.Fatal(err)
+		}
+		if kept, err = s.Refresh(kept.RefreshToken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.rotated) != 6 {
+		t.Fatalf("%d spent tokens, want 6", len(s.rotated))
+	}
+
+	// Replaying a spent token ends its session and forgets only its tokens
+	if _, err := s.Refresh(first); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("replay: got %v", err)
+	}
+	if _, err := s.Refresh(copied.RefreshToken); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal("session survived a replayed refresh token")
+	}
+	if len(s.sessions) != 1 || len(s.rotated) != 3 {
+		t.Fatalf("%d sessions, %d spent tokens after the replay", len(s.sessions), len(s.rotated))
+	}
+
+	// Once they could no longer be used, a request sweeps them
+	clk.Advance(s.RefreshTTL + pruneInterval)
+	r := httptest.NewRequest(http.MethodGet, "/v1/balance", nil)
+	r.Header.Set("Authorization", "Bearer "+kept.AccessToken)
+	if _, err := s.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expired access token: got %v", err)
+	}
+	if len(s.sessions) != 0 || len(s.rotated) != 0 || len(s.refresh) != 0 {
+		t.Fatalf("kept %d sessions, %d spent and %d live refresh tokens", len(s.sessions), len(s.rotated), len(s.refresh))
+	}
+}
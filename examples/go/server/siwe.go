@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// siweHeader ends the first line of a Sign-In with Ethereum message
+const siweHeader = " wants you to sign in with your Ethereum account:"
+
+// SIWEMessage is an EIP-4361 Sign-In with Ethereum message
+type SIWEMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        uint64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time // zero when absent
+	NotBefore      time.Time // zero when absent
+	RequestID      string
+	Resources      []string
+}
+
+// String renders the message in the EIP-4361 format wallets sign
+func (m *SIWEMessage) String() string {
+	var b strings.Builder
+	b.WriteString(m.Domain + siweHeader + "\n")
+	b.WriteString(m.Address.Hex() + "\n\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "URI: %s\nVersion: %s\nChain ID: %d\nNonce: %s\nIssued At: %s", m.URI, m.Version, m.ChainID, m.Nonce, m.IssuedAt.UTC().Format(time.RFC3339))
+	if !m.ExpirationTime.IsZero() {
+		b.WriteString("\nExpiration Time: " + m.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	if !m.NotBefore.IsZero() {
+		b.WriteString("\nNot Before: " + m.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if m.RequestID != "" {
+		b.WriteString("\nRequest ID: " + m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		b.WriteString("\nResources:")
+		for _, r := range m.Resources {
+			b.WriteString("\n- " + r)
+		}
+	}
+	return b.String()
+}
+
+// ParseSIWE parses an EIP-4361 message
+func ParseSIWE(text string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siweHeader) {
+		return nil, errors.New("siwe: missing header")
+	}
+	m := &SIWEMessage{Domain: strings.TrimSuffix(lines[0], siweHeader)}
+	if i := strings.Index(m.Domain, "://"); i >= 0 {
+		m.Domain = m.Domain[i+3:]
+	}
+	if !common.IsHexAddress(lines[1]) {
+		return nil, fmt.Errorf("siwe: invalid address %q", lines[1])
+	}
+	m.Address = common.HexToAddress(lines[1])
+
+	var statement []string
+	inResources := false
+	for _, line := range lines[2:] {
+		if inResources && strings.HasPrefix(line, "- ") {
+			m.Resources = append(m.Resources, strings.TrimPrefix(line, "- "))
+			continue
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if line == "Resources:" {
+			inResources = true
+			continue
+		}
+		if !ok || m.URI == "" && key != "URI" {
+			if line != "" {
+				statement = append(statement, line)
+			}
+			continue
+		}
+		var err error
+		switch key {
+		case "URI":
+			m.URI = value
+		case "Version":
+			m.Version = value
+		case "Chain ID":
+			m.ChainID, err = strconv.ParseUint(value, 10, 64)
+		case "Nonce":
+			m.Nonce = value
+		case "Issued At":
+			m.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			m.ExpirationTime, err = time.Parse(time.RFC3339, value)
+		case "Not Before":
+			m.NotBefore, err = time.Parse(time.RFC3339, value)
+		case "Request ID":
+			m.RequestID = value
+		default:
+			return nil, fmt.Errorf("siwe: unknown field %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("siwe: %s: %w", key, err)
+		}
+	}
+	m.Statement = strings.Join(statement, "\n")
+
+	switch {
+	case m.URI == "":
+		return nil, errors.New("siwe: missing URI")
+	case m.Version != "1":
+		return nil, fmt.Errorf("siwe: unsupported version %q", m.Version)
+	case len(m.Nonce) < 8:
+		return nil, errors.New("siwe: nonce must be at least 8 characters")
+	case m.IssuedAt.IsZero():
+		return nil, errors.New("siwe: missing issued-at time")
+	}
+	return m, nil
+}
+
+// Valid reports whether the message is within its validity window at t
+func (m *SIWEMessage) Valid(t time.Time) bool {
+	if !m.ExpirationTime.IsZero() && !t.Before(m.ExpirationTime) {
+		return false
+	}
+	return m.NotBefore.IsZero() || !t.Before(m.NotBefore)
+}
@@ -0,0 +1,494 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/policy"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// tenantPrefix is where tenant configs, keys and data are kept
+const tenantPrefix = "tenants/"
+
+var (
+	ErrInvalidTenant   = errors.New("server: tenant id must be 1-32 lowercase letters, digits or dashes")
+	ErrUnknownTenant   = errors.New("server: unknown tenant")
+	ErrTenantExists    = errors.New("server: tenant already exists")
+	ErrTenantSuspended = errors.New("server: tenant suspended")
+	ErrQuotaExceeded   = errors.New("server: tenant quota exceeded")
+)
+
+// tenantID restricts ids to what is safe in storage keys and log lines
+var tenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// TenantConfig is the persisted definition of a tenant
+type TenantConfig struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Suspended  bool          `json:"suspended"`
+	RateLimit  float64       `json:"rateLimit"` // requests per second across the tenant; zero is unlimited
+	Burst      int           `json:"burst"`
+	DailyQuota int64         `json:"dailyQuota"` // requests per UTC day; zero is unlimited
+	Policy     []policy.Rule `json:"policy,omitempty"`
+	Address    string        `json:"address,omitempty"` // the tenant's wallet, set on creation
+	Created    time.Time     `json:"created"`
+}
+
+// TenantMetrics counts a tenant's requests
+type TenantMetrics struct {
+	Requests int64 `json:"requests"`
+	Denied   int64 `json:"denied"`
+	Errors   int64 `json:"errors"`
+	Quota    int64 `json:"quotaExceeded"`
+	Today    int64 `json:"today"` // requests counted against DailyQuota
+}
+
+// Tenant is one isolated customer of a multi-tenant server: its own key,
+// policy, quotas and storage namespace
+type Tenant struct {
+	ID     string
+	Wallet *wallet.Wallet
+	Policy *policy.Engine // evaluated after the server's policy; allows by default
+	Store  storage.Store  // the tenant's namespace of the shared store
+
+	requests, denied, errs, quota atomic.Int64
+
+	mu    sync.Mutex
+	cfg   TenantConfig
+	day   string
+	today int64
+}
+
+// Config returns the tenant's current config
+func (t *Tenant) Config() TenantConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cfg
+}
+
+// Metrics returns the tenant's counters
+func (t *Tenant) Metrics() TenantMetrics {
+	t.mu.Lock()
+	today := t.today
+	t.mu.Unlock()
+	return TenantMetrics{
+		Requests: t.requests.Load(),
+		Denied:   t.denied.Load(),
+		Errors:   t.errs.Load(),
+		Quota:    t.quota.Load(),
+		Today:    today,
+	}
+}
+
+// count records a request's outcome in the tenant's metrics
+func (t *Tenant) count(status int) {
+	t.requests.Add(1)
+	switch {
+	case status == http.StatusTooManyRequests:
+		t.quota.Add(1)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		t.denied.Add(1)
+	case status >= 400:
+		t.errs.Add(1)
+	}
+}
+
+// Tenants holds the tenants of a server. Configs and keys live in Store
+// under tenants/<id>/; each key is an encrypted keystore
+type Tenants struct {
+	Store      storage.Store
+	Client     *ethclient.Client // tenant wallets connect through it
+	Passphrase string            // encrypts tenant keystores
+	APIKeys    *APIKeys          // when set, creating a tenant issues it an admin API key
+	Clock      clock.Clock       // refills rate limits and resets daily quotas; nil is the wall clock
+
+	createMu sync.Mutex
+	mu       sync.RWMutex
+	tenants  map[string]*Tenant
+	limiter  *limiter
+}
+
+// NewTenants creates an empty tenant set; call Load to read saved tenants
+func NewTenants(store storage.Store, client *ethclient.Client, passphrase string) *Tenants {
+	return &Tenants{Store: store, Client: client, Passphrase: passphrase, tenants: make(map[string]*Tenant), limiter: newLimiter()}
+}
+
+// Load reads every saved tenant and unlocks its key
+func (ts *Tenants) Load(ctx context.Context) error {
+	keys, err := ts.Store.List(ctx, tenantPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(key, tenantPrefix), "/config")
+		if !ok || strings.Contains(id, "/") {
+			continue
+		}
+		data, err := ts.Store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		var cfg TenantConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+		keystore, err := ts.Store.Get(ctx, tenantPrefix+id+"/keystore")
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+		priv, err := wallet.DecryptKeystore(keystore, ts.Passphrase)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+		if ts.APIKeys != nil {
+			if err := ts.loadAPIKey(ctx, id); err != nil {
+				return fmt.Errorf("tenant %s: %w", id, err)
+			}
+		}
+		ts.put(ts.tenant(cfg, wallet.NewWalletFromClient(priv, ts.Client)))
+	}
+	return nil
+}
+
+// loadAPIKey restores the hash of the admin API key issued to a tenant
+func (ts *Tenants) loadAPIKey(ctx context.Context, id string) error {
+	data, err := ts.Store.Get(ctx, tenantPrefix+id+"/apikey")
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var hash [32]byte
+	if len(data) != hex.EncodedLen(len(hash)) {
+		return errors.New("malformed api key hash")
+	}
+	if _, err := hex.Decode(hash[:], data); err != nil {
+		return fmt.Errorf("malformed api key hash: %w", err)
+	}
+	ts.APIKeys.AddHash(hash, tenantAdmin(id))
+	return nil
+}
+
+// Create adds a tenant with a new key. It returns the tenant and, when
+// APIKeys is set, the tenant's admin API key, which is not shown again; only
+// its hash is saved, so Load restores it
+func (ts *Tenants) Create(ctx context.Context, cfg TenantConfig) (*Tenant, string, error) {
+	if !tenantID.MatchString(cfg.ID) {
+		return nil, "", ErrInvalidTenant
+	}
+	if _, ok := ts.Get(cfg.ID); ok {
+		return nil, "", ErrTenantExists
+	}
+	// Key generation and scrypt are slow, so they run before any lock
+	priv, err := wallet.GenerateKey(nil)
+	if err != nil {
+		return nil, "", err
+	}
+	keystore, err := wallet.EncryptKeystore(priv, ts.Passphrase)
+	if err != nil {
+		return nil, "", err
+	}
+	var apiKey string
+	if ts.APIKeys != nil {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			return nil, "", err
+		}
+		apiKey = "wct_" + hex.EncodeToString(b)
+	}
+	w := wallet.NewWalletFromClient(priv, ts.Client)
+	cfg.Address = w.Address.Hex()
+	cfg.Created = clock.Or(ts.Clock).Now().UTC()
+
+	// createMu keeps two creates of one id apart while the store is written;
+	// mu is only taken to add the tenant, so lookups are never held up
+	ts.createMu.Lock()
+	defer ts.createMu.Unlock()
+	if _, ok := ts.Get(cfg.ID); ok {
+		return nil, "", ErrTenantExists
+	}
+	if err := ts.persist(ctx, cfg, keystore, apiKey); err != nil {
+		return nil, "", err
+	}
+	t := ts.tenant(cfg, w)
+	ts.put(t)
+	if apiKey != "" {
+		ts.APIKeys.Add(apiKey, tenantAdmin(cfg.ID))
+	}
+	return t, apiKey, nil
+}
+
+// persist saves a new tenant's keystore, API key hash and config, the
+// config last since Load starts from it; on failure it removes what it saved
+func (ts *Tenants) persist(ctx context.Context, cfg TenantConfig, keystore []byte, apiKey string) error {
+	var saved []string
+	put := func(suffix string, data []byte) error {
+		key := tenantPrefix + cfg.ID + suffix
+		if err := ts.Store.Put(ctx, key, data); err != nil {
+			return err
+		}
+		saved = append(saved, key)
+		return nil
+	}
+	err := put("/keystore", keystore)
+	if err == nil && apiKey != "" {
+		hash := sha256.Sum256([]byte(apiKey))
+		err = put("/apikey", []byte(hex.EncodeToString(hash[:])))
+	}
+	if err == nil {
+		err = ts.save(ctx, cfg)
+	}
+	if err != nil {
+		for _, key := range saved {
+			ts.Store.Delete(ctx, key)
+		}
+	}
+	return err
+}
+
+// tenantAdmin is the principal of a tenant's admin API key
+func tenantAdmin(id string) Principal {
+	return Principal{ID: "tenant:" + id, Role: RoleAdmin, Tenant: id}
+}
+
+// Get returns a tenant by id
+func (ts *Tenants) Get(id string) (*Tenant, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.tenants[id]
+	return t, ok
+}
+
+// List returns every tenant, by id
+func (ts *Tenants) List() []*Tenant {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	out := make([]*Tenant, 0, len(ts.tenants))
+	for _, t := range ts.tenants {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Update replaces a tenant's name, quotas and policy; its id, key and
+// creation time are kept
+func (ts *Tenants) Update(ctx context.Context, cfg TenantConfig) (*Tenant, error) {
+	return ts.update(ctx, cfg.ID, func(old TenantConfig) TenantConfig {
+		cfg.Address, cfg.Created = old.Address, old.Created
+		return cfg
+	})
+}
+
+// Suspend stops or resumes serving a tenant
+func (ts *Tenants) Suspend(ctx context.Context, id string, suspended bool) error {
+	_, err := ts.update(ctx, id, func(cfg TenantConfig) TenantConfig {
+		cfg.Suspended = suspended
+		return cfg
+	})
+	return err
+}
+
+// update saves and applies a change to a tenant's config in place, so
+// requests in flight keep counting against the same tenant
+func (ts *Tenants) update(ctx context.Context, id string, change func(TenantConfig) TenantConfig) (*Tenant, error) {
+	t, ok := ts.Get(id)
+	if !ok {
+		return nil, ErrUnknownTenant
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cfg := change(t.cfg)
+	if err := ts.save(ctx, cfg); err != nil {
+		return nil, err
+	}
+	t.cfg = cfg
+	t.Policy.SetRules(cfg.Policy)
+	return t, nil
+}
+
+// admit checks that a tenant may make a request and counts it against the
+// daily quota
+func (ts *Tenants) admit(t *Tenant) error {
+	cfg := t.Config()
+	if cfg.Suspended {
+		return ErrTenantSuspended
+	}
+	now := clock.Or(ts.Clock).Now()
+	if !ts.limiter.allow(&Principal{ID: "tenant:" + t.ID, RateLimit: cfg.RateLimit, Burst: cfg.Burst}, now) {
+		return ErrQuotaExceeded
+	}
+	day := now.UTC().Format("2006-01-02")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.day != day {
+		t.day, t.today = day, 0
+	}
+	if t.cfg.DailyQuota > 0 && t.today >= t.cfg.DailyQuota {
+		return ErrQuotaExceeded
+	}
+	t.today++
+	return nil
+}
+
+func (ts *Tenants) tenant(cfg TenantConfig, w *wallet.Wallet) *Tenant {
+	return &Tenant{
+		ID:     cfg.ID,
+		cfg:    cfg,
+		Wallet: w,
+		Policy: policy.NewEngine(true, cfg.Policy...),
+		Store:  storage.Prefixed(ts.Store, tenantPrefix+cfg.ID+"/data/"),
+	}
+}
+
+func (ts *Tenants) put(t *Tenant) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tenants[t.ID] = t
+}
+
+func (ts *Tenants) save(ctx context.Context, cfg TenantConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return ts.Store.Put(ctx, tenantPrefix+cfg.ID+"/config", data)
+}
+
+type tenantKey struct{}
+
+// WithTenant attaches the request's tenant to ctx
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// TenantFromContext returns the request's tenant, if any
+func TenantFromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(*Tenant)
+	return t, ok
+}
+
+// TenantResponse describes a tenant to admins
+type TenantResponse struct {
+	TenantConfig
+	Metrics TenantMetrics `json:"metrics"`
+	APIKey  string        `json:"apiKey,omitempty"` // only when created
+}
+
+// SuspendRequest is the body of POST /v1/admin/tenants/suspend
+type SuspendRequest struct {
+	ID        string `json:"id"`
+	Suspended bool   `json:"suspended"`
+}
+
+// EnableTenants serves every tenant from one server. Callers whose
+// principal names a tenant act on that tenant's wallet and are held to its
+// policy and quotas; principals without a tenant act on the server's own
+// wallet. Deployment admins, admins without a tenant, manage tenants under
+// /v1/admin/tenants
+func (s *Server) EnableTenants(ts *Tenants) {
+	s.tenants = ts
+	s.Handle(Route{Name: "list-tenants", Method: http.MethodGet, Path: "/v1/admin/tenants", Role: RoleAdmin,
+		Summary: "List tenants with their metrics", Response: []TenantResponse{},
+		Handler: s.deploymentAdmin(func(w http.ResponseWriter, r *http.Request) {
+			var out []TenantResponse
+			for _, t := range ts.List() {
+				out = append(out, TenantResponse{TenantConfig: t.Config(), Metrics: t.Metrics()})
+			}
+			writeJSON(w, http.StatusOK, out)
+		})})
+	s.Handle(Route{Name: "create-tenant", Method: http.MethodPost, Path: "/v1/admin/tenants/create", Role: RoleAdmin,
+		Summary: "Create a tenant with a new wallet", Request: TenantConfig{}, Response: TenantResponse{},
+		Handler: s.deploymentAdmin(func(w http.ResponseWriter, r *http.Request) {
+			var cfg TenantConfig
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON body")
+				return
+			}
+			t, apiKey, err := ts.Create(r.Context(), cfg)
+			if err != nil {
+				writeTenantError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, TenantResponse{TenantConfig: t.Config(), APIKey: apiKey})
+		})})
+	s.Handle(Route{Name: "update-tenant", Method: http.MethodPost, Path: "/v1/admin/tenants/update", Role: RoleAdmin,
+		Summary: "Replace a tenant's name, quotas and policy", Request: TenantConfig{}, Response: TenantResponse{},
+		Handler: s.deploymentAdmin(func(w http.ResponseWriter, r *http.Request) {
+			var cfg TenantConfig
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON body")
+				return
+			}
+			t, err := ts.Update(r.Context(), cfg)
+			if err != nil {
+				writeTenantError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, TenantResponse{TenantConfig: t.Config(), Metrics: t.Metrics()})
+		})})
+	s.Handle(Route{Name: "suspend-tenant", Method: http.MethodPost, Path: "/v1/admin/tenants/suspend", Role: RoleAdmin,
+		Summary: "Suspend or resume a tenant", Request: SuspendRequest{},
+		Handler: s.deploymentAdmin(func(w http.ResponseWriter, r *http.Request) {
+			var req SuspendRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON body")
+				return
+			}
+			if err := ts.Suspend(r.Context(), req.ID, req.Suspended); err != nil {
+				writeTenantError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})})
+}
+
+// deploymentAdmin refuses tenant principals, so tenant admins cannot manage
+// other tenants
+func (s *Server) deploymentAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := PrincipalFromContext(r.Context()); !ok || p.Tenant != "" {
+			writeError(w, http.StatusForbidden, "requires a deployment admin")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// wallet returns the wallet a request acts on: its tenant's, or the server's
+func (s *Server) wallet(r *http.Request) *wallet.Wallet {
+	if t, ok := TenantFromContext(r.Context()); ok {
+		return t.Wallet
+	}
+	return s.Wallet
+}
+
+func writeTenantError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownTenant):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrTenantExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidTenant):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/whisperchain/go-examples/storage"
+)
+
+// failingStore fails every Put of a key with the given suffix
+type failingStore struct {
+	storage.Store
+	suffix string
+}
+
+func (f *failingStore) Put(ctx context.Context, key string, value []byte) error {
+	if strings.HasSuffix(key, f.suffix) {
+		return errors.New("disk full")
+	}
+	return f.Store.Put(ctx, key, value)
+}
+
+func TestTenantAPIKeySurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	ts := NewTenants(store, nil, "pass")
+	ts.APIKeys = NewAPIKeys()
+	_, apiKey, err := ts.Create(ctx, TenantConfig{ID: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ts.Create(ctx, TenantConfig{ID: "acme"}); !errors.Is(err, ErrTenantExists) {
+		t.Fatalf("second create: got %v", err)
+	}
+
+	restarted := NewTenants(store, nil, "pass")
+	restarted.APIKeys = NewAPIKeys()
+	if err := restarted.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/v1/balance", nil)
+	r.Header.Set("X-API-Key", apiKey)
+	p, err := restarted.APIKeys.Authenticate(r)
+	if err != nil {
+		t.Fatalf("tenant key after restart: %v", err)
+	}
+	if p.Tenant != "acme" || p.Role != RoleAdmin {
+		t.Fatalf("got principal %+v", p)
+	}
+}
+
+func TestCreateRemovesKeystoreWhenSaveFails(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	ts := NewTenants(&failingStore{Store: store, suffix: "/config"}, nil, "pass")
+	ts.APIKeys = NewAPIKeys()
+	if _, _, err := ts.Create(ctx, TenantConfig{ID: "acme"}); err == nil {
+		t.Fatal("create succeeded without its config")
+	}
+	if keys, _ := store.List(ctx, tenantPrefix); len(keys) != 0 {
+		t.Fatalf("left behind %v", keys)
+	}
+	if _, ok := ts.Get("acme"); ok {
+		t.Fatal("tenant added without its config")
+	}
+}
+
+func TestTenantPrincipalNeedsTenants(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("tenant-key", Principal{ID: "tenant:acme", Role: RoleAdmin, Tenant: "acme"})
+	s := New(nil, keys, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/balance", nil)
+	r.Header.Set("X-API-Key", "tenant-key")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("tenant principal on a single-tenant server: %d", w.Code)
+	}
+}
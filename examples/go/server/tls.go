@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/whisperchain/go-examples/clock"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate and client CA pool that can be reloaded
+// from disk without restarting the server
+type CertReloader struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string      // optional; enables client certificate verification
+	Clock        clock.Clock // paces Watch; nil is the wall clock
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTime  time.Time
+}
+
+// NewCertReloader loads the initial certificate and client CA bundle
+func NewCertReloader(certFile, keyFile, clientCAFile string) (*CertReloader, error) {
+	r := &CertReloader{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCAFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CAs from disk and swaps them in
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if r.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates in client CA file")
+		}
+	}
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCA = pool
+	r.modTime = modTime
+	return nil
+}
+
+// Watch polls the files and reloads when any of them changes; reload errors
+// keep the previous certificate in service and are passed to onError
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := clock.Or(r.Clock).NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			modTime, err := r.latestModTime()
+			if err == nil {
+				r.mu.RLock()
+				changed := modTime.After(r.modTime)
+				r.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				err = r.Reload()
+			}
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// TLSConfig returns a server TLS config that always uses the latest
+// certificate; clientAuth selects the mTLS mode
+func (r *CertReloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCA,
+				ClientAuth:   clientAuth,
+			}, nil
+		},
+	}
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.CertFile, r.KeyFile, r.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// MTLSAuth authenticates requests by their verified client certificate.
+// Identities are the certificate's URI SAN (e.g. a SPIFFE ID) or, failing
+// that, its subject common name.
+type MTLSAuth struct {
+	mu         sync.RWMutex
+	identities map[string]Principal
+}
+
+// NewMTLSAuth creates an empty client identity mapping
+func NewMTLSAuth() *MTLSAuth {
+	return &MTLSAuth{identities: make(map[string]Principal)}
+}
+
+// Add maps a client certificate identity to a principal
+func (m *MTLSAuth) Add(identity string, p Principal) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p.ID == "" {
+		p.ID = "mtls:" + identity
+	}
+	m.identities[identity] = p
+}
+
+// Remove unmaps a client identity
+func (m *MTLSAuth) Remove(identity string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.identities, identity)
+}
+
+// Authenticate resolves the principal for the verified client certificate
+func (m *MTLSAuth) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	identity := certIdentity(r.TLS.VerifiedChains[0][0])
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.identities[identity]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return &p, nil
+}
+
+func certIdentity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
+
+// ListenAndServeTLS serves the API over TLS using certificates from the reloader
+func (s *Server) ListenAndServeTLS(addr string, certs *CertReloader, clientAuth tls.ClientAuthType) error {
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   s,
+		TLSConfig: certs.TLSConfig(clientAuth),
+	}
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,179 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/whisperchain/go-examples/entropy"
+)
+
+// Each share holds the split secret followed by a four-byte checksum of it,
+// then a byte holding the threshold and a trailing byte holding its x
+// coordinate
+
+const checksumSize = 4
+
+var (
+	// ErrTooFewShares is returned when fewer shares than the threshold are combined
+	ErrTooFewShares = errors.New("shamir: fewer shares than the threshold")
+	// ErrInvalidShare is returned for malformed, mismatched or duplicate shares
+	ErrInvalidShare = errors.New("shamir: invalid or duplicate share")
+	// ErrChecksum is returned when the combined secret fails its checksum,
+	// which means at least one share is corrupted
+	ErrChecksum = errors.New("shamir: checksum mismatch, a share is corrupted")
+)
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+)
+
+func init() {
+	// Generator 3 over GF(2^8) with the AES reduction polynomial x^8+x^4+x^3+x+1
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		expTable[i+255] = x
+		logTable[x] = byte(i)
+		x = mulNoTable(x, 3)
+	}
+}
+
+func mulNoTable(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		hi := a & 0x80
+		a <<= 1
+		if hi != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+// Split divides secret into n shares, any k of which reconstruct it
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	return SplitFrom(nil, secret, n, k)
+}
+
+// SplitFrom is Split drawing polynomial coefficients from rand, crypto/rand
+// when nil
+func SplitFrom(rand io.Reader, secret []byte, n, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("shamir: empty secret")
+	}
+	if k < 2 || k > n || n > 255 {
+		return nil, errors.New("shamir: need 2 <= k <= n <= 255")
+	}
+
+	sum := sha256.Sum256(secret)
+	data := append(append([]byte{}, secret...), sum[:checksumSize]...)
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(data)+2)
+		shares[i][len(data)] = byte(k)
+		shares[i][len(data)+1] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, k-1)
+	for pos, s := range data {
+		if err := entropy.Read(rand, coeffs); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			x := byte(i + 1)
+			// Horner evaluation of s + c1*x + ... + c(k-1)*x^(k-1)
+			var y byte
+			for j := len(coeffs) - 1; j >= 0; j-- {
+				y = mul(y, x) ^ coeffs[j]
+			}
+			shares[i][pos] = mul(y, x) ^ s
+		}
+	}
+	return shares, nil
+}
+
+// Threshold returns how many shares are needed to combine share
+func Threshold(share []byte) (int, error) {
+	if len(share) < checksumSize+3 {
+		return 0, ErrInvalidShare
+	}
+	return int(share[len(share)-2]), nil
+}
+
+// Combine reconstructs a secret from at least k shares produced by Split
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrTooFewShares
+	}
+
+	size := len(shares[0])
+	k, err := Threshold(shares[0])
+	if err != nil {
+		return nil, err
+	}
+	if k < 2 {
+		return nil, ErrInvalidShare
+	}
+	if len(shares) < k {
+		return nil, ErrTooFewShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size || int(share[size-2]) != k {
+			return nil, ErrInvalidShare
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, ErrInvalidShare
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	data := make([]byte, size-2)
+	for pos := range data {
+		// Lagrange interpolation at x = 0
+		var value byte
+		for i, xi := range xs {
+			basis := byte(1)
+			for j, xj := range xs {
+				if i != j {
+					basis = mul(basis, div(xj, xj^xi))
+				}
+			}
+			value ^= mul(shares[i][pos], basis)
+		}
+		data[pos] = value
+	}
+
+	secret, check := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	sum := sha256.Sum256(secret)
+	if !bytes.Equal(sum[:checksumSize], check) {
+		return nil, ErrChecksum
+	}
+	return secret, nil
+}
@@ -0,0 +1,138 @@
+package shamir
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var secret = []byte("correct horse battery staple, 32b")
+
+func TestRoundTripEveryThreshold(t *testing.T) {
+	for _, n := range []int{2, 3, 5, 10} {
+		for k := 2; k <= n; k++ {
+			shares, err := Split(secret, n, k)
+			if err != nil {
+				t.Fatalf("split n=%d k=%d: %v", n, k, err)
+			}
+			if len(shares) != n {
+				t.Fatalf("split n=%d k=%d: got %d shares", n, k, len(shares))
+			}
+			// Every window of k consecutive shares, and all n, recombine
+			for start := 0; start+k <= n; start++ {
+				got, err := Combine(shares[start : start+k])
+				if err != nil {
+					t.Fatalf("combine n=%d k=%d from %d: %v", n, k, start, err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Fatalf("combine n=%d k=%d from %d: wrong secret", n, k, start)
+				}
+			}
+			got, err := Combine(shares)
+			if err != nil || !bytes.Equal(got, secret) {
+				t.Fatalf("combine all n=%d k=%d: %v", n, k, err)
+			}
+		}
+	}
+}
+
+func TestCombineOrderIndependent(t *testing.T) {
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Combine([][]byte{shares[4], shares[0], shares[2]})
+	if err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("combine out of order: %v", err)
+	}
+}
+
+func TestCombineRejects(t *testing.T) {
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Split(secret, 5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := func(i, pos int) []byte {
+		c := append([]byte{}, shares[i]...)
+		c[pos] ^= 0x5a
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		shares [][]byte
+		want   error
+	}{
+		{"none", nil, ErrTooFewShares},
+		{"one", shares[:1], ErrTooFewShares},
+		{"below threshold", shares[:2], ErrTooFewShares},
+		{"duplicate", [][]byte{shares[0], shares[1], shares[1]}, ErrInvalidShare},
+		{"duplicate x", [][]byte{shares[0], shares[1], withX(shares[2], shares[0][len(shares[0])-1])}, ErrInvalidShare},
+		{"zero x", [][]byte{shares[0], shares[1], withX(shares[2], 0)}, ErrInvalidShare},
+		{"different lengths", [][]byte{shares[0], shares[1], shares[2][1:]}, ErrInvalidShare},
+		{"mixed thresholds", [][]byte{shares[0], shares[1], other[2]}, ErrInvalidShare},
+		{"truncated", [][]byte{{1, 2}, {3, 4}}, ErrInvalidShare},
+		{"corrupted first byte", [][]byte{corrupt(0, 0), shares[1], shares[2]}, ErrChecksum},
+		{"corrupted last byte", [][]byte{shares[0], shares[1], corrupt(2, len(secret)-1)}, ErrChecksum},
+		{"corrupted checksum", [][]byte{shares[0], corrupt(1, len(secret)+1), shares[2]}, ErrChecksum},
+		{"corrupted beyond threshold", [][]byte{shares[0], shares[1], shares[2], corrupt(3, 5)}, ErrChecksum},
+		{"other secret", [][]byte{shares[0], shares[1], mustSplit(t, []byte("another secret of 32 bytes ......"), 5, 3)[2]}, ErrChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Combine(tt.shares)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRejectsBadParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret []byte
+		n, k   int
+	}{
+		{"empty secret", nil, 3, 2},
+		{"threshold one", secret, 3, 1},
+		{"threshold above n", secret, 3, 4},
+		{"too many shares", secret, 256, 2},
+	}
+	for _, tt := range tests {
+		if _, err := Split(tt.secret, tt.n, tt.k); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	shares := mustSplit(t, secret, 4, 3)
+	k, err := Threshold(shares[0])
+	if err != nil || k != 3 {
+		t.Fatalf("got %d, %v", k, err)
+	}
+	if _, err := Threshold([]byte{1}); !errors.Is(err, ErrInvalidShare) {
+		t.Fatalf("short share: got %v", err)
+	}
+}
+
+func mustSplit(t *testing.T, secret []byte, n, k int) [][]byte {
+	t.Helper()
+	shares, err := Split(secret, n, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shares
+}
+
+func withX(share []byte, x byte) []byte {
+	c := append([]byte{}, share...)
+	c[len(c)-1] = x
+	return c
+}
@@ -0,0 +1,299 @@
+package sigrequest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const pendingPrefix = "sigrequest/pending/"
+
+// ErrUnknownRequest is returned for request ids not in the inbox
+var ErrUnknownRequest = errors.New("sigrequest: unknown request")
+
+// Item is a pending request together with who sent it
+type Item struct {
+	Request    Request       `json:"request"`
+	Requester  hexutil.Bytes `json:"requester"` // uncompressed messaging key of the sender
+	ReceivedAt time.Time     `json:"receivedAt"`
+}
+
+// Inbox receives signature requests addressed to a wallet and answers them
+// once the user approves or rejects
+type Inbox struct {
+	Wallet *wallet.Wallet
+	Sender messaging.Sender
+	Store  storage.Store
+	Audit  audit.Log
+	Clock  clock.Clock // expires requests; nil is the wall clock
+}
+
+// NewInbox creates an inbox for the wallet
+func NewInbox(w *wallet.Wallet, sender messaging.Sender, store storage.Store, auditLog audit.Log) *Inbox {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Inbox{Wallet: w, Sender: sender, Store: store, Audit: auditLog}
+}
+
+// HandleEnvelope stores a request received over the messaging layer
+func (in *Inbox) HandleEnvelope(ctx context.Context, env *messaging.Envelope) (*Item, error) {
+	if !env.Verify() {
+		return nil, errors.New("invalid envelope")
+	}
+	msg, err := messaging.OpenMessage(env, in.Wallet.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessageRequest {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+
+	var req Request
+	if err := msg.Decode(&req); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.From != in.Wallet.Address {
+		return nil, fmt.Errorf("request is for %s", req.From.Hex())
+	}
+	if req.Expired(clock.Or(in.Clock).Now()) {
+		return nil, errors.New("request expired")
+	}
+	requester, err := env.SenderKey()
+	if err != nil {
+		return nil, err
+	}
+
+	item := &Item{Request: req, Requester: crypto.FromECDSAPub(requester), ReceivedAt: clock.Or(in.Clock).Now().UTC()}
+	if err := in.save(ctx, item); err != nil {
+		return nil, err
+	}
+	in.record(ctx, "sign-request-received", item, "pending")
+	return item, nil
+}
+
+// Pending lists unanswered requests, dropping expired ones
+func (in *Inbox) Pending(ctx context.Context) ([]*Item, error) {
+	keys, err := in.Store.List(ctx, pendingPrefix)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Or(in.Clock).Now()
+	var out []*Item
+	for _, key := range keys {
+		item, err := in.load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if item.Request.Expired(now) {
+			in.Store.Delete(ctx, key)
+			in.record(ctx, "sign-request-expired", item, "expired")
+			continue
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// Approve signs the request and sends the result back to the requester
+func (in *Inbox) Approve(ctx context.Context, id string) (*Response, error) {
+	item, err := in.load(ctx, pendingPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Request.Expired(clock.Or(in.Clock).Now()) {
+		return nil, errors.New("request expired")
+	}
+
+	resp := &Response{RequestID: id, Approved: true}
+	switch item.Request.Kind {
+	case KindTransaction:
+		raw, err := in.signTransaction(ctx, &item.Request)
+		if err != nil {
+			return nil, err
+		}
+		resp.RawTx = raw
+	case KindTypedData:
+		sig, err := SignTypedData(in.Wallet, item.Request.TypedData)
+		if err != nil {
+			return nil, err
+		}
+		resp.Signature = sig
+	case KindMessage:
+		sig, err := SignPersonal(in.Wallet, item.Request.Message)
+		if err != nil {
+			return nil, err
+		}
+		resp.Signature = sig
+	}
+	return resp, in.reply(ctx, item, resp)
+}
+
+// Reject declines the request and notifies the requester
+func (in *Inbox) Reject(ctx context.Context, id, reason string) error {
+	item, err := in.load(ctx, pendingPrefix+id)
+	if err != nil {
+		return err
+	}
+	return in.reply(ctx, item, &Response{RequestID: id, Reason: reason})
+}
+
+func (in *Inbox) reply(ctx context.Context, item *Item, resp *Response) error {
+	requester, err := crypto.UnmarshalPubkey(item.Requester)
+	if err != nil {
+		return err
+	}
+	msg, err := messaging.NewMessage(MessageResponse, resp)
+	if err != nil {
+		return err
+	}
+	env, err := messaging.SealMessage(in.Wallet, requester, Topic, msg)
+	if err != nil {
+		return err
+	}
+	if err := in.Sender.Send(ctx, env); err != nil {
+		return err
+	}
+	outcome := "rejected"
+	if resp.Approved {
+		outcome = "approved"
+	}
+	in.record(ctx, "sign-request-answered", item, outcome)
+	return in.Store.Delete(ctx, pendingPrefix+item.Request.ID)
+}
+
+// signTransaction fills in missing fields and signs an EIP-1559 transaction
+func (in *Inbox) signTransaction(ctx context.Context, req *Request) (hexutil.Bytes, error) {
+	t := req.Transaction
+	client, err := in.Wallet.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID := req.ChainID.ToInt()
+
+	network, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if network.Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("request is for chain %s, wallet is on %s", chainID, network)
+	}
+
+	value := new(big.Int)
+	if t.Value != nil {
+		value = t.Value.ToInt()
+	}
+	var nonce uint64
+	if t.Nonce != nil {
+		nonce = uint64(*t.Nonce)
+	} else if nonce, err = in.Wallet.GetNonce(ctx); err != nil {
+		return nil, err
+	}
+	gas := uint64(t.Gas)
+	if gas == 0 {
+		msg := ethereum.CallMsg{From: in.Wallet.Address, To: t.To, Value: value, Data: t.Data}
+		if gas, err = client.EstimateGas(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+	tip := (*big.Int)(t.GasTipCap)
+	if tip == nil {
+		if tip, err = client.SuggestGasTipCap(ctx); err != nil {
+			return nil, err
+		}
+	}
+	feeCap := (*big.Int)(t.GasFeeCap)
+	if feeCap == nil {
+		head, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if head.BaseFee == nil {
+			return nil, errors.New("chain does not support EIP-1559 fees")
+		}
+		feeCap = new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	}
+
+	tx, err := types.SignNewTx(in.Wallet.PrivateKey, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        t.To,
+		Value:     value,
+		Data:      t.Data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := in.Wallet.NotifySigned(tx); err != nil {
+		return nil, err
+	}
+	return tx.MarshalBinary()
+}
+
+// SignTypedData signs EIP-712 typed data and returns a signature with a 27/28
+// recovery id as expected by eth_signTypedData_v4 callers
+func SignTypedData(w *wallet.Wallet, td *apitypes.TypedData) ([]byte, error) {
+	return w.SignTypedData(*td)
+}
+
+// SignPersonal signs an EIP-191 personal message and returns a signature with
+// a 27/28 recovery id as expected by personal_sign callers
+func SignPersonal(w *wallet.Wallet, message []byte) ([]byte, error) {
+	return w.SignPersonalMessage(message)
+}
+
+func (in *Inbox) load(ctx context.Context, key string) (*Item, error) {
+	data, err := in.Store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrUnknownRequest
+	}
+	if err != nil {
+		return nil, err
+	}
+	var item Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (in *Inbox) save(ctx context.Context, item *Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return in.Store.Put(ctx, pendingPrefix+item.Request.ID, data)
+}
+
+func (in *Inbox) record(ctx context.Context, action string, item *Item, outcome string) {
+	in.Audit.Record(ctx, audit.Entry{
+		Actor:   in.Wallet.Address.Hex(),
+		Action:  action,
+		Subject: item.Request.ID,
+		Outcome: outcome,
+		Details: map[string]string{
+			"kind":   string(item.Request.Kind),
+			"origin": item.Request.Origin,
+		},
+	})
+}
@@ -0,0 +1,212 @@
+package sigrequest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Message types exchanged over the messaging layer
+const (
+	MessageRequest  = "sign-request"
+	MessageResponse = "sign-response"
+)
+
+// Topic is the envelope topic used for signature requests and responses
+const Topic = "sign-requests"
+
+// Kind is what a request asks the wallet to sign
+type Kind string
+
+const (
+	KindTransaction Kind = "transaction"
+	KindTypedData   Kind = "typed-data"    // EIP-712
+	KindMessage     Kind = "personal-sign" // EIP-191 personal message
+)
+
+// TxRequest describes a transaction to sign; unset fee, gas and nonce fields
+// are filled in by the wallet
+type TxRequest struct {
+	To        *common.Address `json:"to,omitempty"`
+	Value     *hexutil.Big    `json:"value,omitempty"`
+	Data      hexutil.Bytes   `json:"data,omitempty"`
+	Gas       hexutil.Uint64  `json:"gas,omitempty"`
+	GasFeeCap *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	GasTipCap *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Nonce     *hexutil.Uint64 `json:"nonce,omitempty"`
+}
+
+// Request is a signature request sent by a dapp or service to a wallet
+type Request struct {
+	ID          string              `json:"id"`
+	Kind        Kind                `json:"kind"`
+	Origin      string              `json:"origin"` // requesting dapp, e.g. its URL
+	From        common.Address      `json:"from"`   // account expected to sign
+	ChainID     *hexutil.Big        `json:"chainId,omitempty"`
+	Transaction *TxRequest          `json:"transaction,omitempty"`
+	TypedData   *apitypes.TypedData `json:"typedData,omitempty"`
+	Message     hexutil.Bytes       `json:"message,omitempty"`
+	ExpiresAt   time.Time           `json:"expiresAt"`
+}
+
+// Validate checks that the request carries the payload its kind requires
+func (r *Request) Validate() error {
+	if r.ID == "" || len(r.ID) > 128 {
+		return errors.New("missing or oversized request id")
+	}
+	switch r.Kind {
+	case KindTransaction:
+		if r.Transaction == nil || r.ChainID == nil {
+			return errors.New("transaction request needs a transaction and chain id")
+		}
+	case KindTypedData:
+		if r.TypedData == nil {
+			return errors.New("typed data request needs typed data")
+		}
+	case KindMessage:
+		if len(r.Message) == 0 {
+			return errors.New("message request needs a message")
+		}
+	default:
+		return fmt.Errorf("unknown request kind %q", r.Kind)
+	}
+	return nil
+}
+
+// Expired reports whether the request can no longer be answered
+func (r *Request) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && now.After(r.ExpiresAt)
+}
+
+// Response is the wallet's answer to a request
+type Response struct {
+	RequestID string        `json:"requestId"`
+	Approved  bool          `json:"approved"`
+	Signature hexutil.Bytes `json:"signature,omitempty"` // typed data and messages
+	RawTx     hexutil.Bytes `json:"rawTx,omitempty"`     // signed transactions
+	Reason    string        `json:"reason,omitempty"`
+}
+
+// NewID returns a random request id
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hexutil.Encode(b), nil
+}
+
+// Send seals a request for the wallet's messaging key and sends it
+func Send(ctx context.Context, w *wallet.Wallet, sender messaging.Sender, walletKey *ecdsa.PublicKey, req *Request) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	msg, err := messaging.NewMessage(MessageRequest, req)
+	if err != nil {
+		return err
+	}
+	env, err := messaging.SealMessage(w, walletKey, Topic, msg)
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, env)
+}
+
+// OpenResponse decrypts a response envelope addressed to the requester
+func OpenResponse(env *messaging.Envelope, key *ecdsa.PrivateKey) (*Response, error) {
+	if !env.Verify() {
+		return nil, errors.New("invalid envelope")
+	}
+	msg, err := messaging.OpenMessage(env, key)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessageResponse {
+		return nil, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	var resp Response
+	if err := msg.Decode(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Preview is a human-readable summary of what signing a request would do
+type Preview struct {
+	Summary  string
+	Details  map[string]string
+	Warnings []string
+}
+
+// Preview describes the request for display before the user decides
+func (r *Request) Preview() *Preview {
+	p := &Preview{Details: map[string]string{"origin": r.Origin, "from": r.From.Hex()}}
+	switch r.Kind {
+	case KindTransaction:
+		previewTx(p, r.Transaction)
+	case KindTypedData:
+		td := r.TypedData
+		p.Summary = fmt.Sprintf("Sign %s for %s", td.PrimaryType, td.Domain.Name)
+		p.Details["primaryType"] = td.PrimaryType
+		if td.Domain.VerifyingContract != "" {
+			p.Details["verifyingContract"] = td.Domain.VerifyingContract
+		}
+		if td.Domain.ChainId != nil {
+			p.Details["chainId"] = (*big.Int)(td.Domain.ChainId).String()
+		}
+		if td.PrimaryType == "Permit" || td.PrimaryType == "PermitSingle" || td.PrimaryType == "PermitBatch" {
+			p.Warnings = append(p.Warnings, "signature grants token spending rights without a transaction")
+		}
+	case KindMessage:
+		p.Summary = "Sign message"
+		p.Details["message"] = string(r.Message)
+	}
+	return p
+}
+
+func previewTx(p *Preview, tx *TxRequest) {
+	value := new(big.Int)
+	if tx.Value != nil {
+		value = tx.Value.ToInt()
+	}
+	if tx.To == nil {
+		p.Summary = "Deploy a contract"
+		p.Warnings = append(p.Warnings, "transaction creates a contract")
+		return
+	}
+	p.Details["to"] = tx.To.Hex()
+	p.Details["value"] = value.String()
+	if len(tx.Data) == 0 {
+		p.Summary = fmt.Sprintf("Send %s wei to %s", value, tx.To.Hex())
+		return
+	}
+
+	p.Details["selector"] = hexutil.Encode(tx.Data[:min(4, len(tx.Data))])
+	if to, amount, ok := contract.DecodeTransfer(tx.Data); ok {
+		p.Summary = fmt.Sprintf("Transfer %s tokens of %s to %s", amount, tx.To.Hex(), to.Hex())
+		return
+	}
+	if spender, amount, ok := contract.DecodeApprove(tx.Data); ok {
+		p.Summary = fmt.Sprintf("Approve %s to spend %s tokens of %s", spender.Hex(), amount, tx.To.Hex())
+		if amount.Cmp(math.MaxBig256) == 0 {
+			p.Warnings = append(p.Warnings, "unlimited token approval")
+		}
+		return
+	}
+	p.Summary = fmt.Sprintf("Call contract %s", tx.To.Hex())
+	if value.Sign() > 0 {
+		p.Summary += fmt.Sprintf(" with %s wei", value)
+	}
+}
@@ -0,0 +1,196 @@
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/messaging"
+)
+
+// Event types
+const (
+	TypeTransfer = "transfer"
+	TypeReceipt  = "receipt"
+	TypeMessage  = "message"
+	TypeAlert    = "alert"
+)
+
+// Event is the normalized form every sink publishes. Amounts are decimal
+// strings so consumers in any language read them without precision loss
+type Event struct {
+	ID     string          `json:"id"`     // stable across republishing, for consumer dedup
+	Type   string          `json:"type"`   // one of the Type constants
+	Source string          `json:"source"` // the chain as "eip155:<id>", or "whisperchain"
+	Time   time.Time       `json:"time"`
+	Key    string          `json:"key,omitempty"` // partition key: the account concerned
+	Data   json.RawMessage `json:"data"`
+}
+
+// Schema is the JSON Schema of Event registered with a schema registry
+const Schema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "WhisperChainEvent",
+  "type": "object",
+  "required": ["id", "type", "source", "time", "data"],
+  "properties": {
+    "id": {"type": "string"},
+    "type": {"type": "string", "enum": ["transfer", "receipt", "message", "alert"]},
+    "source": {"type": "string"},
+    "time": {"type": "string", "format": "date-time"},
+    "key": {"type": "string"},
+    "data": {"type": "object"}
+  }
+}`
+
+// Sink publishes events to an external pipeline
+type Sink interface {
+	Publish(ctx context.Context, events ...Event) error
+}
+
+// Transfer is the data of a transfer event
+type Transfer struct {
+	Asset       string `json:"asset"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Amount      string `json:"amount"`
+	Fee         string `json:"fee,omitempty"`
+	TxHash      string `json:"txHash"`
+	LogIndex    uint   `json:"logIndex"`
+	BlockNumber uint64 `json:"blockNumber"`
+	BlockHash   string `json:"blockHash"`
+}
+
+// Receipt is the data of a receipt event
+type Receipt struct {
+	TxHash          string `json:"txHash"`
+	Status          uint64 `json:"status"`
+	BlockNumber     uint64 `json:"blockNumber"`
+	BlockHash       string `json:"blockHash"`
+	GasUsed         uint64 `json:"gasUsed"`
+	EffectiveGas    string `json:"effectiveGasPrice,omitempty"`
+	ContractAddress string `json:"contractAddress,omitempty"`
+}
+
+// Message is the data of a message event. Only routing metadata is
+// published; the ciphertext stays between sender and recipient
+type Message struct {
+	ID          string `json:"id"`
+	Topic       string `json:"topic"`
+	Sender      string `json:"sender"`
+	Recipient   string `json:"recipient"`
+	Attachments int    `json:"attachments,omitempty"`
+}
+
+// FromTransfer normalizes an indexed transfer; Key is the recipient
+func FromTransfer(chainID int64, t indexer.Transfer) Event {
+	data := Transfer{
+		Asset:       t.Asset.Hex(),
+		From:        t.From.Hex(),
+		To:          t.To.Hex(),
+		Amount:      t.Amount.Base().String(),
+		TxHash:      t.TxHash.Hex(),
+		LogIndex:    t.LogIndex,
+		BlockNumber: t.BlockNumber,
+		BlockHash:   t.BlockHash.Hex(),
+	}
+	if t.Fee != nil {
+		data.Fee = t.Fee.String()
+	}
+	return Event{
+		ID:     t.TxHash.Hex() + ":" + strconv.FormatUint(uint64(t.LogIndex), 10),
+		Type:   TypeTransfer,
+		Source: chainSource(chainID),
+		Time:   time.Unix(int64(t.Timestamp), 0).UTC(),
+		Key:    t.To.Hex(),
+		Data:   mustJSON(data),
+	}
+}
+
+// FromReceipt normalizes a transaction receipt; Key is the sender, if known
+func FromReceipt(chainID int64, from string, r *types.Receipt, mined time.Time) Event {
+	data := Receipt{
+		TxHash:    r.TxHash.Hex(),
+		Status:    r.Status,
+		BlockHash: r.BlockHash.Hex(),
+		GasUsed:   r.GasUsed,
+	}
+	if r.BlockNumber != nil {
+		data.BlockNumber = r.BlockNumber.Uint64()
+	}
+	if r.EffectiveGasPrice != nil {
+		data.EffectiveGas = r.EffectiveGasPrice.String()
+	}
+	if r.ContractAddress != (common.Address{}) {
+		data.ContractAddress = r.ContractAddress.Hex()
+	}
+	return Event{
+		ID:     r.TxHash.Hex(),
+		Type:   TypeReceipt,
+		Source: chainSource(chainID),
+		Time:   mined.UTC(),
+		Key:    from,
+		Data:   mustJSON(data),
+	}
+}
+
+// FromEnvelope normalizes a messaging envelope; Key is the recipient
+func FromEnvelope(env *messaging.Envelope) Event {
+	return Event{
+		ID:     env.ID.Hex(),
+		Type:   TypeMessage,
+		Source: "whisperchain",
+		Time:   time.Unix(env.Timestamp, 0).UTC(),
+		Key:    env.Recipient.Hex(),
+		Data: mustJSON(Message{
+			ID:          env.ID.Hex(),
+			Topic:       env.Topic,
+			Sender:      env.Sender.Hex(),
+			Recipient:   env.Recipient.Hex(),
+			Attachments: len(env.Attachments),
+		}),
+	}
+}
+
+// FromAlert normalizes an alert; Key is its dedup key
+func FromAlert(a alert.Alert) Event {
+	if a.Time.IsZero() {
+		a.Time = time.Now().UTC()
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{a.Source, a.Key, a.Title, a.Time.Format(time.RFC3339Nano)}, "\x00")))
+	return Event{
+		ID:     hex.EncodeToString(sum[:16]),
+		Type:   TypeAlert,
+		Source: "whisperchain",
+		Time:   a.Time.UTC(),
+		Key:    a.Key,
+		Data:   mustJSON(a),
+	}
+}
+
+// Notifier returns an alert.Notifier publishing alerts to s
+func Notifier(s Sink) alert.Notifier {
+	return alert.Func(func(ctx context.Context, a alert.Alert) error {
+		return s.Publish(ctx, FromAlert(a))
+	})
+}
+
+func chainSource(chainID int64) string {
+	return "eip155:" + strconv.FormatInt(chainID, 10)
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err) // only called with plain data types
+	}
+	return data
+}
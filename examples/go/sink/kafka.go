@@ -0,0 +1,111 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Kafka publishes events through a Kafka REST Proxy (Confluent REST Proxy v2
+// or Redpanda's HTTP Proxy), so no Kafka client library is needed. Events
+// are keyed by Event.Key, keeping each account's events in order on one
+// partition
+type Kafka struct {
+	URL        string // REST proxy root, e.g. http://localhost:8082
+	Topic      string // Kafka topic for every event type
+	Username   string // optional basic auth
+	Password   string
+	HTTPClient *http.Client
+	// Registry, if set, registers the event schema under "<Topic>-value" and
+	// publishes with its id so the proxy validates and frames records for
+	// schema-aware consumers
+	Registry *Registry
+}
+
+// NewKafka creates a sink for a topic behind a REST proxy
+func NewKafka(proxyURL, topic string) *Kafka {
+	return &Kafka{URL: strings.TrimRight(proxyURL, "/"), Topic: topic}
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key,omitempty"`
+	Value Event  `json:"value"`
+}
+
+type kafkaRequest struct {
+	KeySchema     string        `json:"key_schema,omitempty"`
+	ValueSchemaID int           `json:"value_schema_id,omitempty"`
+	Records       []kafkaRecord `json:"records"`
+}
+
+// Publish produces events in one request. The proxy reports failures per
+// record; any failed record fails the call, and records produced before it
+// may be produced again on retry, so consumers deduplicate on Event.ID
+func (k *Kafka) Publish(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	contentType := "application/vnd.kafka.json.v2+json"
+	var body kafkaRequest
+	if k.Registry != nil {
+		id, err := k.Registry.SchemaID(ctx, k.Topic+"-value")
+		if err != nil {
+			return err
+		}
+		contentType = "application/vnd.kafka.jsonschema.v2+json"
+		body.KeySchema = `{"type":"string"}`
+		body.ValueSchemaID = id
+	}
+	for _, e := range events {
+		body.Records = append(body.Records, kafkaRecord{Key: e.Key, Value: e})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.URL+"/topics/"+url.PathEscape(k.Topic), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if k.Username != "" {
+		req.SetBasicAuth(k.Username, k.Password)
+	}
+	client := k.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sink: kafka proxy returned %s: %s", resp.Status, msg)
+	}
+
+	var out struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	var errs []error
+	for i, o := range out.Offsets {
+		if o.Error != "" && i < len(events) {
+			errs = append(errs, fmt.Errorf("sink: kafka record %s: %s", events[i].ID, o.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
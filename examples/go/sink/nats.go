@@ -0,0 +1,231 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATS publishes events to a NATS server over its text protocol, one
+// subject per event type: "<Subject>.transfer", "<Subject>.alert" and so on.
+// Each publish round ends with a PING, so a nil error means the server has
+// the events. Streams capturing the subjects deduplicate on the Nats-Msg-Id
+// header, which carries Event.ID
+type NATS struct {
+	URL      string // nats://host:4222, or tls://host:4222 for TLS
+	Subject  string // subject prefix, e.g. "whisperchain.events"
+	Token    string // optional auth token
+	User     string // optional user and password
+	Password string
+	TLS      *tls.Config   // optional; used for tls:// URLs and servers requiring TLS
+	Timeout  time.Duration // per publish round; zero is 10 seconds
+	// Registry, if set, registers the event schema under "<Subject>-value"
+	// and sends its id in the Schema-Id header
+	Registry *Registry
+
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	headers bool // server supports HPUB
+	maxData int
+}
+
+// NewNATS creates a sink publishing under a subject prefix
+func NewNATS(serverURL, subject string) *NATS {
+	return &NATS{URL: serverURL, Subject: subject}
+}
+
+// natsInfo is the part of the server's INFO the sink uses
+type natsInfo struct {
+	Headers     bool `json:"headers"`
+	MaxPayload  int  `json:"max_payload"`
+	TLSRequired bool `json:"tls_required"`
+}
+
+// Publish sends events and waits for the server to acknowledge them. A
+// failed round drops the connection; the next call reconnects
+func (n *NATS) Publish(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	schemaID := 0
+	if n.Registry != nil {
+		id, err := n.Registry.SchemaID(ctx, n.Subject+"-value")
+		if err != nil {
+			return err
+		}
+		schemaID = id
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.publish(ctx, schemaID, events); err != nil {
+		n.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.closeLocked()
+}
+
+func (n *NATS) publish(ctx context.Context, schemaID int, events []Event) error {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if n.conn == nil {
+		if err := n.connect(ctx, deadline); err != nil {
+			return err
+		}
+	}
+	n.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { n.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	w := bufio.NewWriter(n.conn)
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if n.maxData > 0 && len(payload) > n.maxData {
+			return fmt.Errorf("sink: event %s exceeds the server's %d byte payload limit", e.ID, n.maxData)
+		}
+		subject := n.Subject + "." + e.Type
+		if n.headers {
+			hdr := "NATS/1.0\r\nNats-Msg-Id: " + headerValue(e.ID) + "\r\nContent-Type: application/json\r\n"
+			if schemaID != 0 {
+				hdr += "Schema-Id: " + strconv.Itoa(schemaID) + "\r\n"
+			}
+			hdr += "\r\n"
+			fmt.Fprintf(w, "HPUB %s %d %d\r\n%s", subject, len(hdr), len(hdr)+len(payload), hdr)
+		} else {
+			fmt.Fprintf(w, "PUB %s %d\r\n", subject, len(payload))
+		}
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return n.awaitPong()
+}
+
+// connect dials the server, upgrades to TLS when asked and authenticates
+func (n *NATS) connect(ctx context.Context, deadline time.Time) error {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	d := net.Dialer{Deadline: deadline}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	var info natsInfo
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info) != nil {
+		conn.Close()
+		return errors.New("sink: not a NATS server")
+	}
+	if u.Scheme == "tls" || info.TLSRequired {
+		cfg := n.TLS
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = u.Hostname()
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn, r = tc, bufio.NewReader(tc)
+	}
+
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "whisperchain-sink", "lang": "go", "version": "1", "headers": info.Headers}
+	if n.Token != "" {
+		opts["auth_token"] = n.Token
+	}
+	if n.User != "" {
+		opts["user"], opts["pass"] = n.User, n.Password
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn, n.r, n.headers, n.maxData = conn, r, info.Headers, info.MaxPayload
+	if err := n.awaitPong(); err != nil {
+		n.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// awaitPong reads until the PONG answering the last PING, answering server
+// PINGs and failing on -ERR
+func (n *NATS) awaitPong() error {
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("sink: nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *NATS) closeLocked() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn, n.r = nil, nil
+	return err
+}
+
+// headerValue strips line breaks so a value cannot inject headers
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,78 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Registry registers the event schema with a Confluent-compatible schema
+// registry, such as Confluent Schema Registry, Redpanda or Apicurio in its
+// compatibility mode, so consumers can validate what they read
+type Registry struct {
+	URL        string // e.g. http://localhost:8081
+	Username   string // optional basic auth, e.g. a Confluent Cloud API key
+	Password   string
+	HTTPClient *http.Client
+
+	mu  sync.Mutex
+	ids map[string]int // schema id by subject
+}
+
+// NewRegistry creates a registry client
+func NewRegistry(rawURL string) *Registry {
+	return &Registry{URL: strings.TrimRight(rawURL, "/")}
+}
+
+// SchemaID registers Schema under subject, once per subject, and returns its
+// id. Registering an unchanged schema returns the existing id; a change the
+// subject's compatibility rules reject is an error
+func (r *Registry) SchemaID(ctx context.Context, subject string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.ids[subject]; ok {
+		return id, nil
+	}
+	body, err := json.Marshal(map[string]string{"schemaType": "JSON", "schema": Schema})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL+"/subjects/"+url.PathEscape(subject)+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if r.Username != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("sink: schema registry returned %s: %s", resp.Status, msg)
+	}
+	var out struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	if r.ids == nil {
+		r.ids = make(map[string]int)
+	}
+	r.ids[subject] = out.ID
+	return out.ID, nil
+}
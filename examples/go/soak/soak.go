@@ -0,0 +1,399 @@
+package soak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/rpcpool"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Topic is the messaging topic soak messages are sent on
+const Topic = "soak"
+
+// Invariant names a property the soak test checks
+type Invariant string
+
+const (
+	// NonceGap: a wallet's mined nonce differs from the transactions the
+	// test sent and saw mined
+	NonceGap Invariant = "nonce-gap"
+	// StuckTransaction: a transaction stayed unmined past the deadline
+	StuckTransaction Invariant = "stuck-transaction"
+	// BalanceMismatch: a wallet's balance differs from its starting balance
+	// plus mined transfers less fees
+	BalanceMismatch Invariant = "balance-mismatch"
+	// LostMessage: a sent envelope never reached the message store
+	LostMessage Invariant = "lost-message"
+)
+
+// Violation is a broken invariant with what is needed to debug it
+type Violation struct {
+	Invariant Invariant         `json:"invariant"`
+	Time      time.Time         `json:"time"`
+	Wallet    common.Address    `json:"wallet"`
+	Detail    string            `json:"detail"`
+	Context   map[string]string `json:"context"`
+}
+
+// MessageStore is where sent envelopes must arrive, such as a relay
+type MessageStore interface {
+	Get(ctx context.Context, id common.Hash) (*messaging.Envelope, error)
+}
+
+// Report summarizes a soak run
+type Report struct {
+	Started    time.Time     `json:"started"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Transfers  int           `json:"transfers"`
+	Messages   int           `json:"messages"`
+	Checks     int           `json:"checks"`
+	Errors     int           `json:"errors"` // failed sends; not violations by themselves
+	Violations []Violation   `json:"violations"`
+}
+
+// Runner keeps sending transfers and messages between funded devnet wallets
+// and checks invariants as it goes. The wallets must not be used by anything
+// else during the run, nor be the block producer's fee recipient, or their
+// nonces and balances will not reconcile
+type Runner struct {
+	Client   *ethclient.Client
+	Wallets  []*wallet.Wallet
+	Sender   messaging.Sender // optional; with Messages, also sends messages
+	Messages MessageStore
+	Amount   units.Wei     // per transfer; zero is 1 gwei
+	Interval time.Duration // between actions; zero is one second
+	// CheckEvery is how many actions run between invariant checks; zero is 10
+	CheckEvery int
+	Deadline   time.Duration // before a transaction is stuck or a message lost; zero is two minutes
+	Alerts     alert.Notifier
+	// OnViolation, when set, is called with each violation as it is found
+	OnViolation func(Violation)
+	Seed        int64
+	Clock       clock.Clock
+
+	rand     *rand.Rand
+	ledgers  map[common.Address]*ledger
+	messages []*sentMessage
+	report   *Report
+	seen     map[string]bool // violations already reported
+}
+
+// ledger is what the runner expects of one wallet
+type ledger struct {
+	startBalance *big.Int
+	startNonce   uint64
+	txs          []*sentTx
+}
+
+type sentTx struct {
+	hash     common.Hash
+	nonce    uint64
+	from, to common.Address
+	value    *big.Int
+	sent     time.Time
+	block    uint64 // zero until mined
+	fee      *big.Int
+	success  bool
+}
+
+type sentMessage struct {
+	id        common.Hash
+	from, to  common.Address
+	sent      time.Time
+	delivered bool
+}
+
+// New creates a runner over funded wallets
+func New(client *ethclient.Client, wallets ...*wallet.Wallet) *Runner {
+	return &Runner{Client: client, Wallets: wallets, Alerts: alert.Discard}
+}
+
+// Run soaks until ctx is done, then runs a final check and returns the
+// report. Violations do not stop the run
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	if len(r.Wallets) < 2 {
+		return nil, errors.New("soak: at least two wallets are needed")
+	}
+	chainID, err := r.Client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := rpcpool.Testnets[chainID.Uint64()]; !ok {
+		return nil, fmt.Errorf("soak: chain %s is not a devnet or testnet", chainID)
+	}
+	if err := r.start(ctx); err != nil {
+		return nil, err
+	}
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	every := r.CheckEvery
+	if every <= 0 {
+		every = 10
+	}
+	ticker := clock.Or(r.Clock).NewTicker(interval)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		select {
+		case <-ctx.Done():
+			// the final check gets its own time; the run's context is over
+			final, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			r.check(final)
+			r.report.Elapsed = clock.Since(r.Clock, r.report.Started)
+			return r.report, nil
+		case <-ticker.C():
+		}
+		r.act(ctx)
+		if n%every == 0 {
+			r.check(ctx)
+		}
+	}
+}
+
+// start records each wallet's starting balance and nonce
+func (r *Runner) start(ctx context.Context) error {
+	r.rand = rand.New(rand.NewSource(r.Seed))
+	r.ledgers = make(map[common.Address]*ledger, len(r.Wallets))
+	r.messages = nil
+	r.seen = make(map[string]bool)
+	r.report = &Report{Started: clock.Or(r.Clock).Now().UTC(), Violations: []Violation{}}
+	if r.Alerts == nil {
+		r.Alerts = alert.Discard
+	}
+	head, err := r.Client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	block := new(big.Int).SetUint64(head)
+	for _, w := range r.Wallets {
+		balance, err := r.Client.BalanceAt(ctx, w.Address, block)
+		if err != nil {
+			return err
+		}
+		nonce, err := r.Client.NonceAt(ctx, w.Address, block)
+		if err != nil {
+			return err
+		}
+		pending, err := r.Client.PendingNonceAt(ctx, w.Address)
+		if err != nil {
+			return err
+		}
+		if pending != nonce {
+			return fmt.Errorf("soak: %s has pending transactions; start from a settled account", w.Address.Hex())
+		}
+		r.ledgers[w.Address] = &ledger{startBalance: balance, startNonce: nonce}
+	}
+	return nil
+}
+
+// act sends one transfer, or a message when a message store is set
+func (r *Runner) act(ctx context.Context) {
+	from := r.Wallets[r.rand.Intn(len(r.Wallets))]
+	to := r.Wallets[r.rand.Intn(len(r.Wallets)-1)]
+	if to == from {
+		to = r.Wallets[len(r.Wallets)-1]
+	}
+	now := clock.Or(r.Clock).Now()
+	if r.Sender != nil && r.Messages != nil && r.rand.Intn(2) == 0 {
+		msg, err := messaging.NewMessage("text", "soak "+strconv.Itoa(r.report.Messages))
+		if err == nil {
+			var env *messaging.Envelope
+			if env, err = messaging.SealMessage(from, to.PublicKey, Topic, msg); err == nil {
+				if err = r.Sender.Send(ctx, env); err == nil {
+					r.messages = append(r.messages, &sentMessage{id: env.ID, from: from.Address, to: to.Address, sent: now})
+					r.report.Messages++
+					return
+				}
+			}
+		}
+		r.report.Errors++
+		return
+	}
+
+	amount := r.Amount
+	if amount.IsZero() {
+		amount = units.GweiFromUint64(1).Wei()
+	}
+	tx, err := from.SendTx(ctx, to.Address, amount, nil)
+	if err != nil {
+		r.report.Errors++
+		return
+	}
+	l := r.ledgers[from.Address]
+	want := l.startNonce + uint64(len(l.txs))
+	if tx.Nonce() != want {
+		r.violate(ctx, NonceGap, from.Address, "nonce "+tx.Hash().Hex(), fmt.Sprintf("sent with nonce %d, expected %d", tx.Nonce(), want), map[string]string{
+			"tx": tx.Hash().Hex(), "nonce": strconv.FormatUint(tx.Nonce(), 10), "expected": strconv.FormatUint(want, 10),
+		})
+	}
+	l.txs = append(l.txs, &sentTx{hash: tx.Hash(), nonce: tx.Nonce(), from: from.Address, to: to.Address, value: amount.Big(), sent: now})
+	r.report.Transfers++
+}
+
+// check refreshes receipts and deliveries and asserts every invariant at
+// one block, so balances and the receipts counted against them agree
+func (r *Runner) check(ctx context.Context) {
+	r.report.Checks++
+	head, err := r.Client.BlockNumber(ctx)
+	if err != nil {
+		r.report.Errors++
+		return
+	}
+	block := new(big.Int).SetUint64(head)
+	now := clock.Or(r.Clock).Now()
+	deadline := r.Deadline
+	if deadline <= 0 {
+		deadline = 2 * time.Minute
+	}
+
+	for _, addr := range r.addresses() {
+		for _, tx := range r.ledgers[addr].txs {
+			if tx.block != 0 {
+				continue
+			}
+			receipt, err := r.Client.TransactionReceipt(ctx, tx.hash)
+			switch {
+			case err == nil:
+				tx.block = receipt.BlockNumber.Uint64()
+				tx.success = receipt.Status == types.ReceiptStatusSuccessful
+				tx.fee = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice)
+			case !errors.Is(err, ethereum.NotFound):
+				r.report.Errors++
+			case now.Sub(tx.sent) > deadline:
+				r.violate(ctx, StuckTransaction, addr, "stuck "+tx.hash.Hex(), fmt.Sprintf("unmined after %s", now.Sub(tx.sent).Round(time.Second)), map[string]string{
+					"tx": tx.hash.Hex(), "nonce": strconv.FormatUint(tx.nonce, 10), "sent": tx.sent.UTC().Format(time.RFC3339), "head": strconv.FormatUint(head, 10),
+				})
+			}
+		}
+	}
+
+	for _, addr := range r.addresses() {
+		r.checkWallet(ctx, addr, block)
+	}
+
+	if r.Messages != nil {
+		for _, m := range r.messages {
+			if m.delivered {
+				continue
+			}
+			_, err := r.Messages.Get(ctx, m.id)
+			switch {
+			case err == nil:
+				m.delivered = true
+			case !errors.Is(err, storage.ErrNotFound):
+				r.report.Errors++
+			case now.Sub(m.sent) > deadline:
+				r.violate(ctx, LostMessage, m.from, "lost "+m.id.Hex(), fmt.Sprintf("not delivered after %s", now.Sub(m.sent).Round(time.Second)), map[string]string{
+					"envelope": m.id.Hex(), "to": m.to.Hex(), "sent": m.sent.UTC().Format(time.RFC3339),
+				})
+			}
+		}
+	}
+}
+
+// checkWallet asserts a wallet's nonce and balance at block
+func (r *Runner) checkWallet(ctx context.Context, addr common.Address, block *big.Int) {
+	l := r.ledgers[addr]
+	head := block.Uint64()
+	var mined uint64
+	expected := new(big.Int).Set(l.startBalance)
+	var counted []string
+	for _, w := range r.Wallets {
+		for _, tx := range r.ledgers[w.Address].txs {
+			if tx.block == 0 || tx.block > head {
+				continue
+			}
+			if tx.from == addr {
+				mined++
+				expected.Sub(expected, tx.fee)
+				if tx.success {
+					expected.Sub(expected, tx.value)
+				}
+				counted = append(counted, tx.hash.Hex())
+			}
+			if tx.to == addr && tx.success {
+				expected.Add(expected, tx.value)
+				counted = append(counted, tx.hash.Hex())
+			}
+		}
+	}
+
+	nonce, err := r.Client.NonceAt(ctx, addr, block)
+	if err != nil {
+		r.report.Errors++
+		return
+	}
+	if want := l.startNonce + mined; nonce != want {
+		r.violate(ctx, NonceGap, addr, "nonce@"+block.String(), fmt.Sprintf("nonce %d at block %d, expected %d", nonce, head, want), map[string]string{
+			"block": block.String(), "nonce": strconv.FormatUint(nonce, 10), "expected": strconv.FormatUint(want, 10),
+			"startNonce": strconv.FormatUint(l.startNonce, 10), "minedTxs": strconv.FormatUint(mined, 10),
+		})
+	}
+	balance, err := r.Client.BalanceAt(ctx, addr, block)
+	if err != nil {
+		r.report.Errors++
+		return
+	}
+	if balance.Cmp(expected) != 0 {
+		r.violate(ctx, BalanceMismatch, addr, "balance@"+block.String(), fmt.Sprintf("balance %s at block %d, expected %s", balance, head, expected), map[string]string{
+			"block": block.String(), "balance": balance.String(), "expected": expected.String(),
+			"difference": new(big.Int).Sub(balance, expected).String(), "startBalance": l.startBalance.String(),
+			"counted": fmt.Sprint(counted),
+		})
+	}
+}
+
+// violate records a violation once per key and reports it
+func (r *Runner) violate(ctx context.Context, inv Invariant, addr common.Address, key, detail string, details map[string]string) {
+	key = string(inv) + "/" + addr.Hex() + "/" + key
+	if r.seen[key] {
+		return
+	}
+	r.seen[key] = true
+	v := Violation{Invariant: inv, Time: clock.Or(r.Clock).Now().UTC(), Wallet: addr, Detail: detail, Context: details}
+	r.report.Violations = append(r.report.Violations, v)
+	if r.OnViolation != nil {
+		r.OnViolation(v)
+	}
+	labels := map[string]string{"invariant": string(inv), "wallet": addr.Hex()}
+	for k, val := range details {
+		labels[k] = val
+	}
+	r.Alerts.Notify(ctx, alert.Alert{
+		Time:     v.Time,
+		Severity: alert.Critical,
+		Source:   "soak",
+		Title:    string(inv) + " on " + addr.Hex(),
+		Message:  detail,
+		Key:      "soak/" + key,
+		Labels:   labels,
+	})
+}
+
+// addresses returns the wallet addresses in a stable order
+func (r *Runner) addresses() []common.Address {
+	out := make([]common.Address, 0, len(r.Wallets))
+	for _, w := range r.Wallets {
+		out = append(out, w.Address)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hex() < out[j].Hex() })
+	return out
+}
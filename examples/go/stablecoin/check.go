@@ -0,0 +1,135 @@
+package stablecoin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// issuerABIJSON covers the issuer controls of USDC and USDT
+const issuerABIJSON = `[
+{"type":"function","name":"isBlacklisted","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"isBlackListed","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"paused","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bool"}]}
+]`
+
+var issuerABI = mustParseABI(issuerABIJSON)
+
+var (
+	// ErrBlacklisted is returned when the issuer has frozen the sender or
+	// recipient; the transfer would revert, or strand funds at a frozen address
+	ErrBlacklisted = errors.New("stablecoin: address is blacklisted by the issuer")
+	// ErrPaused is returned when the issuer has paused all transfers
+	ErrPaused = errors.New("stablecoin: token is paused")
+	// ErrInsufficientBalance is returned when the sender cannot cover the amount
+	ErrInsufficientBalance = errors.New("stablecoin: insufficient balance")
+)
+
+// Checker runs pre-send checks against the token contract
+type Checker struct {
+	Client *ethclient.Client
+}
+
+// NewChecker creates a checker
+func NewChecker(client *ethclient.Client) *Checker {
+	return &Checker{Client: client}
+}
+
+// Blacklisted reports whether the issuer has blacklisted addr. Tokens
+// without a blacklist report false
+func (c *Checker) Blacklisted(ctx context.Context, t Token, addr common.Address) (bool, error) {
+	if t.Blacklist == NoBlacklist {
+		return false, nil
+	}
+	return c.callBool(ctx, t.Address, string(t.Blacklist), addr)
+}
+
+// Paused reports whether the token's transfers are paused
+func (c *Checker) Paused(ctx context.Context, t Token) (bool, error) {
+	if !t.Pausable {
+		return false, nil
+	}
+	return c.callBool(ctx, t.Address, "paused")
+}
+
+// Check verifies that from can send amount of t to to: the amount is in t,
+// the token is not paused, neither side is blacklisted and from holds enough
+func (c *Checker) Check(ctx context.Context, t Token, from, to common.Address, amount units.TokenAmount) error {
+	if amount.Token() != t.Unit() {
+		return fmt.Errorf("%w: %s amount sent as %s", units.ErrTokenMismatch, amount.Token().Symbol, t.Symbol)
+	}
+	paused, err := c.Paused(ctx, t)
+	if err != nil {
+		return err
+	}
+	if paused {
+		return fmt.Errorf("%w: %s", ErrPaused, t.Symbol)
+	}
+	for _, addr := range []common.Address{from, to} {
+		listed, err := c.Blacklisted(ctx, t, addr)
+		if err != nil {
+			return err
+		}
+		if listed {
+			return fmt.Errorf("%w: %s on %s", ErrBlacklisted, addr.Hex(), t.Symbol)
+		}
+	}
+	balance, err := contract.NewERC20ForToken(t.Unit(), c.Client).BalanceOf(ctx, from)
+	if err != nil {
+		return err
+	}
+	if balance.Base().Cmp(amount.Base()) < 0 {
+		return fmt.Errorf("%w: have %s, need %s", ErrInsufficientBalance, t.Format(balance.Base()), t.Format(amount.Base()))
+	}
+	return nil
+}
+
+// Send checks the transfer and sends amount of t from w to to
+func (c *Checker) Send(ctx context.Context, w *wallet.Wallet, t Token, to common.Address, amount units.TokenAmount) (*types.Transaction, error) {
+	if err := c.Check(ctx, t, w.Address, to, amount); err != nil {
+		return nil, err
+	}
+	data, err := contract.TransferData(to, amount.Base())
+	if err != nil {
+		return nil, err
+	}
+	return w.SendTx(ctx, t.Address, units.Wei{}, &wallet.TxOpts{Data: data})
+}
+
+func (c *Checker) callBool(ctx context.Context, token common.Address, method string, args ...interface{}) (bool, error) {
+	data, err := issuerABI.Pack(method, args...)
+	if err != nil {
+		return false, err
+	}
+	result, err := c.Client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return false, err
+	}
+	out, err := issuerABI.Unpack(method, result)
+	if err != nil {
+		return false, err
+	}
+	v, ok := out[0].(bool)
+	if !ok {
+		return false, errors.New("unexpected " + method + " result")
+	}
+	return v, nil
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
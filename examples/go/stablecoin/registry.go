@@ -0,0 +1,114 @@
+package stablecoin
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// Blacklist names the issuer's blacklist getter, which differs per issuer
+type Blacklist string
+
+const (
+	NoBlacklist     Blacklist = ""
+	CircleBlacklist Blacklist = "isBlacklisted" // USDC FiatToken
+	TetherBlacklist Blacklist = "isBlackListed" // USDT on Ethereum
+)
+
+// Token is a stablecoin deployment on one chain
+type Token struct {
+	Symbol    string
+	ChainID   uint64
+	Address   common.Address
+	Decimals  uint8
+	Blacklist Blacklist
+	Pausable  bool // the issuer can pause all transfers
+}
+
+// Registry holds known stablecoin deployments
+type Registry struct {
+	Tokens []Token
+}
+
+// DefaultRegistry knows USDC, USDT and DAI on Ethereum, Optimism, Arbitrum,
+// Base and Polygon. USDC is Circle's native deployment, not bridged USDC.e
+func DefaultRegistry() *Registry {
+	return &Registry{Tokens: []Token{
+		{"USDC", 1, common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), 6, CircleBlacklist, true},
+		{"USDT", 1, common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), 6, TetherBlacklist, true},
+		{"DAI", 1, common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"), 18, NoBlacklist, false},
+
+		{"USDC", 10, common.HexToAddress("0x0b2C639c533813f4Aa9D7837CAf62653d097Ff85"), 6, CircleBlacklist, true},
+		{"USDT", 10, common.HexToAddress("0x94b008aA00579c1307B0EF2c499aD98a8ce58e58"), 6, NoBlacklist, false},
+		{"DAI", 10, common.HexToAddress("0xDA10009cBd5D07dd0CeCc66161FC93D7c9000da1"), 18, NoBlacklist, false},
+
+		{"USDC", 42161, common.HexToAddress("0xaf88d065e77c8cC2239327C5EDb3A432268e5831"), 6, CircleBlacklist, true},
+		{"USDT", 42161, common.HexToAddress("0xFd086bC7CD5C481DCC9C85ebE478A1C0b69FCbb9"), 6, NoBlacklist, false},
+		{"DAI", 42161, common.HexToAddress("0xDA10009cBd5D07dd0CeCc66161FC93D7c9000da1"), 18, NoBlacklist, false},
+
+		{"USDC", 8453, common.HexToAddress("0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913"), 6, CircleBlacklist, true},
+		{"DAI", 8453, common.HexToAddress("0x50c5725949A6F0c72E6C4a641F24049A917DB0Cb"), 18, NoBlacklist, false},
+
+		{"USDC", 137, common.HexToAddress("0x3c499c542cEF5E3811e1192ce70d8cC03d5c3359"), 6, CircleBlacklist, true},
+		{"USDT", 137, common.HexToAddress("0xc2132D05D31c914a87C6611C10748AEb04B58e8F"), 6, NoBlacklist, false},
+		{"DAI", 137, common.HexToAddress("0x8f3Cf7ad23Cd3CaDbD9735AFf958023239c6A063"), 18, NoBlacklist, false},
+	}}
+}
+
+// Lookup finds a stablecoin by symbol, case-insensitively
+func (r *Registry) Lookup(chainID uint64, symbol string) (Token, bool) {
+	for _, t := range r.Tokens {
+		if t.ChainID == chainID && strings.EqualFold(t.Symbol, symbol) {
+			return t, true
+		}
+	}
+	return Token{}, false
+}
+
+// ByAddress finds a stablecoin by contract address
+func (r *Registry) ByAddress(chainID uint64, addr common.Address) (Token, bool) {
+	for _, t := range r.Tokens {
+		if t.ChainID == chainID && t.Address == addr {
+			return t, true
+		}
+	}
+	return Token{}, false
+}
+
+// OnChain returns the stablecoins deployed on a chain
+func (r *Registry) OnChain(chainID uint64) []Token {
+	var out []Token
+	for _, t := range r.Tokens {
+		if t.ChainID == chainID {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Unit returns the token's identity for typed amounts
+func (t Token) Unit() units.Token {
+	return units.Token{Address: t.Address, Symbol: t.Symbol, Decimals: t.Decimals}
+}
+
+// Amount wraps base units of the token
+func (t Token) Amount(base *big.Int) units.TokenAmount {
+	return units.NewTokenAmount(t.Unit(), base)
+}
+
+// Parse converts a decimal string such as "12.50" to an amount of the token
+func (t Token) Parse(s string) (units.TokenAmount, error) {
+	return units.ParseTokenAmount(t.Unit(), s)
+}
+
+// Format renders base units as a decimal string with the symbol, trimming
+// trailing zeros but keeping cents
+func (t Token) Format(amount *big.Int) string {
+	whole, frac, _ := strings.Cut(units.FormatUnits(amount, t.Decimals), ".")
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	return whole + "." + frac + " " + t.Symbol
+}
@@ -0,0 +1,353 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+	"github.com/whisperchain/go-examples/watchtower"
+)
+
+// SnapshotVersion is the current snapshot format
+const SnapshotVersion = 1
+
+// NativeAsset is the asset address used for ETH balances
+var NativeAsset = common.Address{}
+
+var (
+	// ErrBadSignature is returned when a snapshot's signature does not match
+	// its signer
+	ErrBadSignature = errors.New("state: snapshot signature is invalid")
+	// ErrUntrustedSigner is returned when a snapshot was signed by a key that
+	// is not trusted
+	ErrUntrustedSigner = errors.New("state: snapshot signer is not trusted")
+	// ErrChainMismatch is returned when importing a snapshot from another chain
+	ErrChainMismatch = errors.New("state: snapshot is for a different chain")
+)
+
+// Balance is an account's holding of one asset
+type Balance struct {
+	Asset  common.Address `json:"asset"`
+	Amount *hexutil.Big   `json:"amount"`
+}
+
+// PendingTx is a signed transaction that was not mined when the snapshot was
+// taken. Raw is set while the node still has the transaction
+type PendingTx struct {
+	Nonce uint64        `json:"nonce"`
+	Hash  common.Hash   `json:"hash"`
+	Raw   hexutil.Bytes `json:"raw,omitempty"`
+}
+
+// Account is the on-chain state of one wallet address
+type Account struct {
+	Address      common.Address `json:"address"`
+	Nonce        uint64         `json:"nonce"`        // mined transactions at the snapshot block
+	PendingNonce uint64         `json:"pendingNonce"` // next nonce including the node's pool
+	Balances     []Balance      `json:"balances"`
+	Pending      []PendingTx    `json:"pending,omitempty"`
+}
+
+// Snapshot is a signed, timestamped copy of wallet state for recovery drills:
+// balances and nonces pinned to one block, the pending transaction queue and
+// application records such as channel states
+type Snapshot struct {
+	Version     int               `json:"version"`
+	Created     time.Time         `json:"created"`
+	ChainID     *hexutil.Big      `json:"chainId"`
+	BlockNumber uint64            `json:"blockNumber"`
+	BlockHash   common.Hash       `json:"blockHash"`
+	Accounts    []Account         `json:"accounts"`
+	State       map[string][]byte `json:"state,omitempty"`
+	Signer      common.Address    `json:"signer"`
+	Signature   hexutil.Bytes     `json:"signature,omitempty"`
+}
+
+// SigningPayload returns the canonical bytes covered by the signature
+func (s *Snapshot) SigningPayload() ([]byte, error) {
+	unsigned := *s
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Encode serializes the snapshot as a JSON document
+func (s *Snapshot) Encode() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// DecodeSnapshot parses a snapshot document produced by Encode
+func DecodeSnapshot(data []byte) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return &s, nil
+}
+
+// Verify checks the snapshot signature offline and, when trusted is not
+// empty, that the signer is one of the trusted addresses
+func Verify(s *Snapshot, trusted ...common.Address) error {
+	payload, err := s.SigningPayload()
+	if err != nil {
+		return err
+	}
+	if !wallet.VerifySignature(payload, s.Signature, s.Signer) {
+		return ErrBadSignature
+	}
+	if len(trusted) == 0 {
+		return nil
+	}
+	for _, t := range trusted {
+		if t == s.Signer {
+			return nil
+		}
+	}
+	return ErrUntrustedSigner
+}
+
+// Exporter takes and restores snapshots of the wallets a service manages
+type Exporter struct {
+	Client     *ethclient.Client
+	Signer     *wallet.Wallet
+	Store      storage.Store
+	Watchtower *watchtower.Watchtower // optional; its journal is the pending queue
+	Accounts   []common.Address
+	Tokens     []common.Address // ERC-20 balances to include
+	Prefixes   []string         // store records to include, such as channel states
+	Audit      audit.Log
+}
+
+// NewExporter creates an exporter that signs snapshots with signer and
+// includes signer's own account
+func NewExporter(client *ethclient.Client, signer *wallet.Wallet, store storage.Store, auditLog audit.Log) *Exporter {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Exporter{
+		Client:   client,
+		Signer:   signer,
+		Store:    store,
+		Accounts: []common.Address{signer.Address},
+		Audit:    auditLog,
+	}
+}
+
+// Export takes a signed snapshot. Balances and mined nonces are read at the
+// current head so they are consistent with each other
+func (e *Exporter) Export(ctx context.Context) (*Snapshot, error) {
+	chainID, err := e.Client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	head, err := e.Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Version:     SnapshotVersion,
+		Created:     time.Now().UTC(),
+		ChainID:     (*hexutil.Big)(chainID),
+		BlockNumber: head.Number.Uint64(),
+		BlockHash:   head.Hash(),
+	}
+	for _, addr := range e.Accounts {
+		acct, err := e.account(ctx, addr, head.Number)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", addr.Hex(), err)
+		}
+		s.Accounts = append(s.Accounts, *acct)
+	}
+	if s.State, err = e.records(ctx); err != nil {
+		return nil, err
+	}
+
+	s.Signer = e.Signer.Address
+	payload, err := s.SigningPayload()
+	if err != nil {
+		return nil, err
+	}
+	if s.Signature, err = e.Signer.SignMessage(payload); err != nil {
+		return nil, err
+	}
+	e.record(ctx, "state-exported", s, "ok")
+	return s, nil
+}
+
+// Import verifies a snapshot and writes its records into the store,
+// overwriting existing keys. Pending transactions are not resent; see Resubmit
+func (e *Exporter) Import(ctx context.Context, s *Snapshot, trusted ...common.Address) error {
+	if err := Verify(s, trusted...); err != nil {
+		e.record(ctx, "state-imported", s, err.Error())
+		return err
+	}
+	if e.Client != nil {
+		chainID, err := e.Client.ChainID(ctx)
+		if err != nil {
+			return err
+		}
+		if s.ChainID == nil || s.ChainID.ToInt().Cmp(chainID) != 0 {
+			e.record(ctx, "state-imported", s, ErrChainMismatch.Error())
+			return ErrChainMismatch
+		}
+	}
+
+	keys := make([]string, 0, len(s.State))
+	for key := range s.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := e.Store.Put(ctx, key, s.State[key]); err != nil {
+			return fmt.Errorf("import %s: %w", key, err)
+		}
+	}
+	e.record(ctx, "state-imported", s, "ok")
+	return nil
+}
+
+// Resubmit broadcasts the snapshot's pending transactions whose nonces are
+// still unused and returns the hashes sent. Transactions the node already
+// has are counted as sent
+func (e *Exporter) Resubmit(ctx context.Context, s *Snapshot) ([]common.Hash, error) {
+	var sent []common.Hash
+	for _, acct := range s.Accounts {
+		mined, err := e.Client.NonceAt(ctx, acct.Address, nil)
+		if err != nil {
+			return sent, err
+		}
+		for _, p := range acct.Pending {
+			if p.Nonce < mined || len(p.Raw) == 0 {
+				continue
+			}
+			tx := new(types.Transaction)
+			if err := tx.UnmarshalBinary(p.Raw); err != nil {
+				return sent, fmt.Errorf("pending %s: %w", p.Hash.Hex(), err)
+			}
+			if err := e.Client.SendTransaction(ctx, tx); err != nil && !strings.Contains(strings.ToLower(err.Error()), "already known") {
+				return sent, fmt.Errorf("resubmit %s: %w", p.Hash.Hex(), err)
+			}
+			sent = append(sent, tx.Hash())
+		}
+	}
+	return sent, nil
+}
+
+func (e *Exporter) account(ctx context.Context, addr common.Address, block *big.Int) (*Account, error) {
+	nonce, err := e.Client.NonceAt(ctx, addr, block)
+	if err != nil {
+		return nil, err
+	}
+	pendingNonce, err := e.Client.PendingNonceAt(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	acct := &Account{Address: addr, Nonce: nonce, PendingNonce: pendingNonce}
+
+	eth, err := e.Client.BalanceAt(ctx, addr, block)
+	if err != nil {
+		return nil, err
+	}
+	acct.Balances = append(acct.Balances, Balance{Asset: NativeAsset, Amount: (*hexutil.Big)(eth)})
+	for _, token := range e.Tokens {
+		amount, err := e.tokenBalance(ctx, token, addr, block)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", token.Hex(), err)
+		}
+		acct.Balances = append(acct.Balances, Balance{Asset: token, Amount: (*hexutil.Big)(amount)})
+	}
+
+	if e.Watchtower == nil {
+		return acct, nil
+	}
+	signed, err := e.Watchtower.Signed(ctx, addr, nonce)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range signed {
+		p := PendingTx{Nonce: st.Nonce, Hash: st.Hash}
+		tx, isPending, err := e.Client.TransactionByHash(ctx, st.Hash)
+		switch {
+		case errors.Is(err, ethereum.NotFound):
+			// dropped or replaced; keep the hash for the record
+		case err != nil:
+			return nil, err
+		case !isPending:
+			continue // mined after the snapshot block
+		default:
+			if p.Raw, err = tx.MarshalBinary(); err != nil {
+				return nil, err
+			}
+		}
+		acct.Pending = append(acct.Pending, p)
+	}
+	return acct, nil
+}
+
+// tokenBalance calls balanceOf at block so token balances match the ETH ones
+func (e *Exporter) tokenBalance(ctx context.Context, token, addr common.Address, block *big.Int) (*big.Int, error) {
+	data := contract.BalanceOfData(addr)
+	out, err := e.Client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, block)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) < 32 {
+		return nil, errors.New("balanceOf returned no value")
+	}
+	return new(big.Int).SetBytes(out[:32]), nil
+}
+
+func (e *Exporter) records(ctx context.Context) (map[string][]byte, error) {
+	if len(e.Prefixes) == 0 || e.Store == nil {
+		return nil, nil
+	}
+	records := make(map[string][]byte)
+	for _, prefix := range e.Prefixes {
+		keys, err := e.Store.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			value, err := e.Store.Get(ctx, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue // deleted while exporting
+			}
+			if err != nil {
+				return nil, err
+			}
+			records[key] = value
+		}
+	}
+	return records, nil
+}
+
+func (e *Exporter) record(ctx context.Context, action string, s *Snapshot, outcome string) {
+	e.Audit.Record(ctx, audit.Entry{
+		Actor:   s.Signer.Hex(),
+		Action:  action,
+		Subject: s.BlockHash.Hex(),
+		Outcome: outcome,
+		Details: map[string]string{
+			"block":    fmt.Sprint(s.BlockNumber),
+			"accounts": fmt.Sprint(len(s.Accounts)),
+			"records":  fmt.Sprint(len(s.State)),
+		},
+	})
+}
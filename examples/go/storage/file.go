@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileStore is a Store that keeps one file per key in a directory
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore creates a file store rooted at dir, creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// Get returns the value stored under key
+func (f *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put atomically stores value under key
+func (f *FileStore) Put(ctx context.Context, key string, value []byte) error {
+	tmp, err := os.CreateTemp(f.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+// Delete removes key; deleting a missing key is not an error
+func (f *FileStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the sorted keys that start with prefix
+func (f *FileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(f.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, e := range entries {
+		raw, err := hex.DecodeString(e.Name())
+		if err != nil {
+			continue // temp files and foreign entries
+		}
+		if key := string(raw); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// path maps a key to a file name; keys are hex-encoded so any string is safe
+func (f *FileStore) path(key string) string {
+	return filepath.Join(f.Dir, hex.EncodeToString([]byte(key)))
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// identifier matches the table and channel names PostgresStore accepts, so
+// they can be put in statements unescaped
+var identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// maxNotifyKey keeps notification payloads under PostgreSQL's 8000 byte limit
+const maxNotifyKey = 7000
+
+// Change operations announced by a PostgresStore
+const (
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// PostgresStore is a Store in a PostgreSQL table, opened with any
+// database/sql driver for PostgreSQL such as lib/pq or pgx's stdlib. With
+// Channel set, writes under NotifyPrefixes are announced with NOTIFY in the
+// same transaction, so listeners hear only of committed rows
+type PostgresStore struct {
+	DB      *sql.DB
+	Table   string
+	Channel string // NOTIFY channel; empty disables notifications
+	// NotifyPrefixes limits notifications to keys under these prefixes, such
+	// as the indexer's; empty announces every key
+	NotifyPrefixes []string
+}
+
+// Notification is the JSON payload of a PostgresStore's NOTIFY
+type Notification struct {
+	Op  string `json:"op"`
+	Key string `json:"key"`
+}
+
+// NewPostgresStore creates the table if needed. Table and channel must be
+// lowercase SQL identifiers
+func NewPostgresStore(ctx context.Context, db *sql.DB, table, channel string) (*PostgresStore, error) {
+	if !identifier.MatchString(table) || channel != "" && !identifier.MatchString(channel) {
+		return nil, errors.New("storage: table and channel must be lowercase identifiers")
+	}
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+		key text PRIMARY KEY,
+		value bytea NOT NULL,
+		updated timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS `+table+`_updated ON `+table+` (updated)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStore{DB: db, Table: table, Channel: channel}, nil
+}
+
+// Get returns the value stored under key
+func (p *PostgresStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := p.DB.QueryRowContext(ctx, `SELECT value FROM `+p.Table+` WHERE key = $1`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+// Put stores value under key
+func (p *PostgresStore) Put(ctx context.Context, key string, value []byte) error {
+	return p.write(ctx, key, func(tx *sql.Tx) (string, error) {
+		var inserted bool
+		err := tx.QueryRowContext(ctx, `INSERT INTO `+p.Table+` (key, value) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated = now()
+			RETURNING xmax = 0`, key, value).Scan(&inserted)
+		if inserted {
+			return OpInsert, err
+		}
+		return OpUpdate, err
+	})
+}
+
+// Delete removes key; deleting a missing key is not an error
+func (p *PostgresStore) Delete(ctx context.Context, key string) error {
+	return p.write(ctx, key, func(tx *sql.Tx) (string, error) {
+		res, err := tx.ExecContext(ctx, `DELETE FROM `+p.Table+` WHERE key = $1`, key)
+		if err != nil {
+			return "", err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return "", nil
+		}
+		return OpDelete, nil
+	})
+}
+
+// List returns the sorted keys that start with prefix
+func (p *PostgresStore) List(ctx context.Context, prefix string) ([]string, error) {
+	return p.keys(ctx, `SELECT key FROM `+p.Table+` WHERE left(key, length($1)) = $1 ORDER BY key COLLATE "C"`, prefix)
+}
+
+// Changed returns the sorted keys under prefix written at or after since,
+// for listeners catching up on notifications missed while disconnected
+func (p *PostgresStore) Changed(ctx context.Context, prefix string, since time.Time) ([]string, error) {
+	return p.keys(ctx, `SELECT key FROM `+p.Table+` WHERE left(key, length($1)) = $1 AND updated >= $2 ORDER BY key COLLATE "C"`, prefix, since)
+}
+
+// ListenStatement returns the LISTEN statement to run on the connection a
+// consumer receives notifications on
+func (p *PostgresStore) ListenStatement() string {
+	return `LISTEN ` + p.Channel
+}
+
+// WaitFunc blocks until the next notification on a LISTENing connection and
+// returns its payload. database/sql cannot receive notifications, so adapt
+// the driver's API: receive from a pq.Listener's Notify channel, or call a
+// pgx connection's WaitForNotification
+type WaitFunc func(ctx context.Context) (payload string, err error)
+
+// Consume calls fn with the key and current value of each inserted or
+// updated row under prefix until ctx is done or wait fails. Rows deleted
+// before they are read are skipped. Notifications are not delivered while
+// disconnected; after reconnecting, catch up with Changed
+func (p *PostgresStore) Consume(ctx context.Context, wait WaitFunc, prefix string, fn func(ctx context.Context, op, key string, value []byte) error) error {
+	for {
+		payload, err := wait(ctx)
+		if err != nil {
+			return err
+		}
+		var n Notification
+		if json.Unmarshal([]byte(payload), &n) != nil || n.Op == OpDelete || !strings.HasPrefix(n.Key, prefix) {
+			continue
+		}
+		value, err := p.Get(ctx, n.Key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(ctx, n.Op, n.Key, value); err != nil {
+			return err
+		}
+	}
+}
+
+// write runs op in a transaction and announces the change it reports
+func (p *PostgresStore) write(ctx context.Context, key string, op func(tx *sql.Tx) (string, error)) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	change, err := op(tx)
+	if err != nil {
+		return err
+	}
+	if change != "" && p.notifies(key) {
+		if len(key) > maxNotifyKey {
+			return fmt.Errorf("storage: key of %d bytes is too long to announce", len(key))
+		}
+		payload, _ := json.Marshal(Notification{Op: change, Key: key})
+		if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, p.Channel, string(payload)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) notifies(key string) bool {
+	if p.Channel == "" {
+		return false
+	}
+	if len(p.NotifyPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.NotifyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PostgresStore) keys(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := p.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"strings"
+)
+
+// PrefixStore confines a Store to the keys under a prefix, so several
+// tenants or components can share one backend without seeing each other's
+// keys
+type PrefixStore struct {
+	Store  Store
+	Prefix string
+}
+
+// Prefixed returns a view of store holding only keys under prefix
+func Prefixed(store Store, prefix string) *PrefixStore {
+	return &PrefixStore{Store: store, Prefix: prefix}
+}
+
+// Get returns the value stored under key
+func (p *PrefixStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return p.Store.Get(ctx, p.Prefix+key)
+}
+
+// Put stores value under key
+func (p *PrefixStore) Put(ctx context.Context, key string, value []byte) error {
+	return p.Store.Put(ctx, p.Prefix+key, value)
+}
+
+// Delete removes key
+func (p *PrefixStore) Delete(ctx context.Context, key string) error {
+	return p.Store.Delete(ctx, p.Prefix+key)
+}
+
+// List returns the sorted keys that start with prefix, without the store's
+// own prefix
+func (p *PrefixStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := p.Store.List(ctx, p.Prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		keys[i] = strings.TrimPrefix(k, p.Prefix)
+	}
+	return keys, nil
+}
@@ -0,0 +1,460 @@
+package streampay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/confirm"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/relay"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+	"github.com/whisperchain/go-examples/watcher"
+)
+
+// storePrefix namespaces gate records by channel
+const storePrefix = "streampay/"
+
+// Plan prices access to a channel: Rate of Asset buys one Window of access.
+// Subscribers keep access for Grace past the end of what they paid for
+type Plan struct {
+	Channel string         // messaging topic of the channel
+	Owner   common.Address // receives the payments
+	Asset   common.Address // token, or the zero address for ETH
+	Rate    *big.Int       // base units per window
+	Window  time.Duration
+	Grace   time.Duration
+}
+
+// Validate checks the plan can price access
+func (p *Plan) Validate() error {
+	if p.Channel == "" {
+		return errors.New("plan has no channel")
+	}
+	if p.Rate == nil || p.Rate.Sign() <= 0 {
+		return errors.New("plan rate must be positive")
+	}
+	if p.Window <= 0 {
+		return errors.New("plan window must be positive")
+	}
+	return nil
+}
+
+// covered returns how long amount pays for
+func (p *Plan) covered(amount *big.Int) time.Duration {
+	d := new(big.Int).Mul(amount, big.NewInt(int64(p.Window)))
+	d.Div(d, p.Rate)
+	if !d.IsInt64() {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration(d.Int64())
+}
+
+// Subscription is one subscriber's current payment stream
+type Subscription struct {
+	Subscriber  common.Address `json:"subscriber"`
+	Start       time.Time      `json:"start"`
+	Paid        *hexutil.Big   `json:"paid"` // total since Start
+	PaidThrough time.Time      `json:"paidThrough"`
+	Active      bool           `json:"active"`
+	LastTx      common.Hash    `json:"lastTx"`
+	Voucher     *Voucher       `json:"voucher,omitempty"` // latest voucher of a voucher stream
+	Settled     *hexutil.Big   `json:"settled,omitempty"` // voucher total already collected
+}
+
+// due returns the voucher total not yet collected
+func (s *Subscription) due() *big.Int {
+	if s.Voucher == nil {
+		return new(big.Int)
+	}
+	due := new(big.Int).Set(s.Voucher.Amount.ToInt())
+	if s.Settled != nil {
+		due.Sub(due, s.Settled.ToInt())
+	}
+	return due
+}
+
+// Gate tracks payment streams to a channel owner and cuts off subscribers
+// whose stream stops. Streams pay with vouchers, which Redeem accepts and
+// Close collects, or with on-chain transfers to the owner, which Credit
+// applies
+type Gate struct {
+	Plan     Plan
+	Store    storage.Store
+	Audit    audit.Log
+	OnCutoff func(ctx context.Context, sub *Subscription) // optional
+	Settler  *confirm.Settler                             // optional; Watch credits payments once settled
+	Token    *contract.ERC20                              // the plan's asset; Redeem checks vouchers are funded
+	Wallet   *wallet.Wallet                               // the owner's; Close collects vouchers with it
+	Clock    clock.Clock                                  // times cutoffs; nil is the wall clock
+
+	mu sync.Mutex
+}
+
+// NewGate creates a gate for plan
+func NewGate(plan Plan, store storage.Store, auditLog audit.Log) (*Gate, error) {
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Gate{Plan: plan, Store: store, Audit: auditLog}, nil
+}
+
+// Credit applies a transfer to the sender's stream. Transfers of other
+// assets or to other addresses are ignored, and each transfer counts once.
+// A payment after a cutoff starts a new stream
+func (g *Gate) Credit(ctx context.Context, t indexer.Transfer) (*Subscription, error) {
+	if t.To != g.Plan.Owner || t.Asset != g.Plan.Asset || t.Amount.Sign() <= 0 {
+		return nil, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	seen := g.key("seen/" + t.TxHash.Hex() + "/" + fmt.Sprint(t.LogIndex))
+	if _, err := g.Store.Get(ctx, seen); err == nil {
+		return nil, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	sub, err := g.load(ctx, t.From)
+	if err != nil {
+		return nil, err
+	}
+	if sub != nil && sub.Voucher != nil && (sub.Active || sub.due().Sign() > 0) {
+		// Voucher streams are paid by their vouchers alone
+		return nil, nil
+	}
+	paidAt := time.Unix(int64(t.Timestamp), 0).UTC()
+	if t.Timestamp == 0 {
+		paidAt = clock.Or(g.Clock).Now().UTC()
+	}
+	if sub == nil || !sub.Active {
+		sub = &Subscription{Subscriber: t.From, Start: paidAt, Paid: (*hexutil.Big)(new(big.Int)), Active: true}
+		g.record(ctx, "stream-started", sub, "active")
+	}
+	paid := new(big.Int).Add(sub.Paid.ToInt(), t.Amount.Base())
+	sub.Paid = (*hexutil.Big)(paid)
+	sub.PaidThrough = sub.Start.Add(g.Plan.covered(paid))
+	sub.LastTx = t.TxHash
+
+	if err := g.save(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, g.Store.Put(ctx, seen, []byte(paidAt.Format(time.RFC3339)))
+}
+
+// Redeem applies a voucher to its subscriber's stream, extending access to
+// what the voucher's total pays for. The first voucher of a stream opens
+// it, from the gate's clock rather than the voucher's Opened, which only
+// identifies the stream; later ones must raise the total, and each must be
+// covered by the subscriber's allowance to the owner and balance
+func (g *Gate) Redeem(ctx context.Context, v *Voucher) (*Subscription, error) {
+	if g.Plan.Asset == (common.Address{}) {
+		return nil, ErrNativeAsset
+	}
+	if !v.matches(&g.Plan) || !v.Verify() {
+		return nil, ErrBadVoucher
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sub, err := g.load(ctx, v.Subscriber)
+	if err != nil {
+		return nil, err
+	}
+	sameStream := sub != nil && sub.Voucher != nil && sub.Voucher.Opened == v.Opened
+	switch {
+	case sameStream && !sub.Active:
+		return nil, ErrStreamClosed
+	case sameStream && v.Amount.ToInt().Cmp(sub.Voucher.Amount.ToInt()) <= 0:
+		return nil, ErrStaleVoucher
+	case !sameStream && sub != nil && (sub.Active || sub.due().Sign() > 0):
+		return nil, ErrStreamOpen
+	}
+	if err := g.funded(ctx, v); err != nil {
+		return nil, err
+	}
+
+	if !sameStream {
+		sub = &Subscription{Subscriber: v.Subscriber, Start: clock.Or(g.Clock).Now().UTC(), Active: true}
+		g.record(ctx, "stream-started", sub, "active")
+	}
+	sub.Paid = v.Amount
+	sub.PaidThrough = sub.Start.Add(g.Plan.covered(v.Amount.ToInt()))
+	sub.Voucher = v
+	if err := g.save(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// funded checks the subscriber can pay the voucher's total
+func (g *Gate) funded(ctx context.Context, v *Voucher) error {
+	if g.Token == nil {
+		return errors.New("streampay: gate has no token to check vouchers against")
+	}
+	allowance, err := g.Token.Allowance(ctx, v.Subscriber, g.Plan.Owner)
+	if err != nil {
+		return err
+	}
+	balance, err := g.Token.BalanceOf(ctx, v.Subscriber)
+	if err != nil {
+		return err
+	}
+	if v.Amount.ToInt().Cmp(allowance.Base()) > 0 || v.Amount.ToInt().Cmp(balance.Base()) > 0 {
+		return ErrUnfunded
+	}
+	return nil
+}
+
+// Close ends a subscriber's stream and collects what its latest voucher
+// owes with one transferFrom, returning nil when nothing is due. A failed
+// collection is retried by the next Sweep
+func (g *Gate) Close(ctx context.Context, subscriber common.Address) (*types.Transaction, error) {
+	g.mu.Lock()
+	sub, err := g.load(ctx, subscriber)
+	if err != nil || sub == nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	if sub.Active {
+		sub.Active = false
+		if err := g.save(ctx, sub); err != nil {
+			g.mu.Unlock()
+			return nil, err
+		}
+		g.record(ctx, "stream-closed", sub, "closed")
+	}
+	g.mu.Unlock()
+	return g.collect(ctx, subscriber)
+}
+
+// collect sends the transferFrom for a closed stream's unpaid voucher total.
+// The total is marked collected before sending, so concurrent calls cannot
+// collect twice, and unmarked if the send fails
+func (g *Gate) collect(ctx context.Context, subscriber common.Address) (*types.Transaction, error) {
+	g.mu.Lock()
+	sub, err := g.load(ctx, subscriber)
+	if err != nil || sub == nil || sub.Active {
+		g.mu.Unlock()
+		return nil, err
+	}
+	due := sub.due()
+	if due.Sign() <= 0 {
+		g.mu.Unlock()
+		return nil, nil
+	}
+	if g.Wallet == nil || g.Wallet.Address != g.Plan.Owner {
+		g.mu.Unlock()
+		return nil, errors.New("streampay: collecting vouchers needs the owner's wallet")
+	}
+	data, err := contract.TransferFromData(subscriber, g.Plan.Owner, due)
+	if err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	previous := sub.Settled
+	sub.Settled = sub.Voucher.Amount
+	err = g.save(ctx, sub)
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := g.Wallet.SendTx(ctx, g.Plan.Asset, units.Wei{}, &wallet.TxOpts{Data: data})
+	entry := audit.Entry{
+		Actor:   g.Plan.Owner.Hex(),
+		Action:  "stream-collect",
+		Subject: g.Plan.Channel,
+		Outcome: "sent",
+		Details: map[string]string{"subscriber": subscriber.Hex(), "amount": due.String()},
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Details["error"] = err.Error()
+		g.Audit.Record(ctx, entry)
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if sub, lerr := g.load(ctx, subscriber); lerr == nil && sub != nil {
+			sub.Settled = previous
+			g.save(ctx, sub)
+		}
+		return nil, err
+	}
+	entry.Details["tx"] = tx.Hash().Hex()
+	g.Audit.Record(ctx, entry)
+	return tx, nil
+}
+
+// Allowed reports whether addr may access the channel at now. The owner
+// always may
+func (g *Gate) Allowed(ctx context.Context, addr common.Address, now time.Time) (bool, error) {
+	if addr == g.Plan.Owner {
+		return true, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sub, err := g.load(ctx, addr)
+	if err != nil || sub == nil {
+		return false, err
+	}
+	return sub.Active && now.Before(sub.PaidThrough.Add(g.Plan.Grace)), nil
+}
+
+// Sweep cuts off every stream that stopped paying more than Grace ago and
+// returns them, then collects what the vouchers of closed streams still owe
+func (g *Gate) Sweep(ctx context.Context) ([]Subscription, error) {
+	cut, owing, err := g.sweep(ctx)
+	if g.OnCutoff != nil {
+		for i := range cut {
+			g.OnCutoff(ctx, &cut[i])
+		}
+	}
+	for _, addr := range owing {
+		if _, cerr := g.collect(ctx, addr); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return cut, err
+}
+
+func (g *Gate) sweep(ctx context.Context) (cut []Subscription, owing []common.Address, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	keys, err := g.Store.List(ctx, g.key("sub/"))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := clock.Or(g.Clock).Now()
+	for _, key := range keys {
+		sub, err := g.get(ctx, key)
+		if err != nil {
+			return cut, owing, err
+		}
+		if sub.Active && !now.Before(sub.PaidThrough.Add(g.Plan.Grace)) {
+			sub.Active = false
+			if err := g.save(ctx, sub); err != nil {
+				return cut, owing, err
+			}
+			g.record(ctx, "stream-cutoff", sub, "cutoff")
+			cut = append(cut, *sub)
+		}
+		if !sub.Active && sub.due().Sign() > 0 {
+			owing = append(owing, sub.Subscriber)
+		}
+	}
+	return cut, owing, nil
+}
+
+// Schedule registers Sweep with a scheduler
+func (g *Gate) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("streampay-"+g.Plan.Channel, interval, func(ctx context.Context) error {
+		_, err := g.Sweep(ctx)
+		return err
+	})
+}
+
+// Watch credits payments to the owner as w sees them, or once settled with
+// a Settler, from block from, until ctx is done
+func (g *Gate) Watch(ctx context.Context, w *watcher.Watcher, from uint64) error {
+	var tokens []common.Address
+	if g.Plan.Asset != (common.Address{}) {
+		tokens = []common.Address{g.Plan.Asset}
+	}
+	incoming := w.Incoming(ctx, g.Plan.Owner, tokens, from)
+	if g.Settler != nil {
+		incoming = g.Settler.Settle(ctx, incoming)
+	}
+	for t := range incoming {
+		if t.Asset != g.Plan.Asset {
+			continue
+		}
+		if _, err := g.Credit(ctx, t); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// Name returns the relay filter name
+func (g *Gate) Name() string { return "streampay" }
+
+// Check implements relay.Filter: envelopes on the channel's topic are only
+// delivered to subscribers whose stream is current, cutting off access as
+// soon as payments stop
+func (g *Gate) Check(ctx context.Context, stage relay.Stage, env *messaging.Envelope) (relay.Decision, error) {
+	if env.Topic != g.Plan.Channel {
+		return relay.Allow, nil
+	}
+	ok, err := g.Allowed(ctx, env.Recipient, clock.Or(g.Clock).Now())
+	if err != nil {
+		return relay.Decision{}, err
+	}
+	if !ok {
+		return relay.Reject("no active payment stream for %s", env.Recipient.Hex()), nil
+	}
+	return relay.Allow, nil
+}
+
+func (g *Gate) key(suffix string) string {
+	return storePrefix + g.Plan.Channel + "/" + suffix
+}
+
+func (g *Gate) load(ctx context.Context, addr common.Address) (*Subscription, error) {
+	sub, err := g.get(ctx, g.key("sub/"+addr.Hex()))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	return sub, err
+}
+
+func (g *Gate) get(ctx context.Context, key string) (*Subscription, error) {
+	data, err := g.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var sub Subscription
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (g *Gate) save(ctx context.Context, sub *Subscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return g.Store.Put(ctx, g.key("sub/"+sub.Subscriber.Hex()), data)
+}
+
+func (g *Gate) record(ctx context.Context, action string, sub *Subscription, outcome string) {
+	g.Audit.Record(ctx, audit.Entry{
+		Actor:   sub.Subscriber.Hex(),
+		Action:  action,
+		Subject: g.Plan.Channel,
+		Outcome: outcome,
+		Details: map[string]string{
+			"paid":        sub.Paid.ToInt().String(),
+			"paidThrough": sub.PaidThrough.Format(time.RFC3339),
+		},
+	})
+}
@@ -0,0 +1,231 @@
+package streampay
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+var (
+	// ErrNotOpen is returned by Pay before Open
+	ErrNotOpen = errors.New("streampay: stream is not open")
+	// ErrDepositSpent is returned by Pay once the vouchers would exceed the
+	// deposit approved by Open
+	ErrDepositSpent = errors.New("streampay: deposit spent")
+)
+
+// Stream pays a channel owner off chain: Open approves the owner to collect
+// up to a deposit, then every Windows windows Pay hands the owner a signed
+// voucher for the running total. The owner collects the latest voucher in
+// one transfer when the stream closes, so a stream costs two transactions
+// however long it runs. Access lapses once the vouchers stop
+type Stream struct {
+	Wallet  *wallet.Wallet
+	Plan    Plan
+	Windows int64                                       // windows bought per voucher
+	Send    func(ctx context.Context, v *Voucher) error // delivers a voucher to the owner
+	Audit   audit.Log
+	Clock   clock.Clock // dates the stream; nil is the wall clock
+
+	mu      sync.Mutex
+	opened  int64
+	deposit *big.Int
+	paid    *big.Int
+}
+
+// NewStream creates a voucher stream paying one window at a time through
+// send, for example as a message to the owner
+func NewStream(w *wallet.Wallet, plan Plan, send func(ctx context.Context, v *Voucher) error, auditLog audit.Log) (*Stream, error) {
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	if plan.Asset == (common.Address{}) {
+		return nil, ErrNativeAsset
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Stream{Wallet: w, Plan: plan, Windows: 1, Send: send, Audit: auditLog}, nil
+}
+
+// Open starts a new stream, approving the owner to collect up to deposit.
+// Close the previous stream at the owner, or let it be cut off, first
+func (s *Stream) Open(ctx context.Context, deposit *big.Int) (*types.Transaction, error) {
+	data, err := contract.ApproveData(s.Plan.Owner, deposit)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.Wallet.SendTx(ctx, s.Plan.Asset, units.Wei{}, &wallet.TxOpts{Data: data})
+
+	entry := s.entry("stream-opened", "sent", map[string]string{"deposit": deposit.String()})
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Details["error"] = err.Error()
+		s.Audit.Record(ctx, entry)
+		return nil, err
+	}
+	entry.Details["tx"] = tx.Hash().Hex()
+	s.Audit.Record(ctx, entry)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opened = clock.Or(s.Clock).Now().Unix()
+	s.deposit = new(big.Int).Set(deposit)
+	s.paid = new(big.Int)
+	return tx, nil
+}
+
+// Pay signs a voucher raising the total by Rate times Windows and sends it
+// to the owner. A voucher that fails to send does not count
+func (s *Stream) Pay(ctx context.Context) (*Voucher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paid == nil {
+		return nil, ErrNotOpen
+	}
+	total := new(big.Int).Mul(s.Plan.Rate, big.NewInt(s.windows()))
+	total.Add(total, s.paid)
+	if total.Cmp(s.deposit) > 0 {
+		return nil, ErrDepositSpent
+	}
+
+	v := &Voucher{
+		Channel: s.Plan.Channel,
+		Owner:   s.Plan.Owner,
+		Asset:   s.Plan.Asset,
+		Opened:  s.opened,
+		Amount:  (*hexutil.Big)(total),
+	}
+	err := v.Sign(s.Wallet)
+	if err == nil {
+		err = s.Send(ctx, v)
+	}
+
+	entry := s.entry("stream-voucher", "sent", map[string]string{"total": total.String()})
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Details["error"] = err.Error()
+		s.Audit.Record(ctx, entry)
+		return nil, err
+	}
+	s.Audit.Record(ctx, entry)
+	s.paid = total
+	return v, nil
+}
+
+// Schedule pays now and then once per Windows windows; the plan's Grace
+// must cover the time a voucher takes to reach the owner. Remove the job or
+// stop the scheduler to end the stream
+func (s *Stream) Schedule(sch *scheduler.Scheduler) error {
+	return sch.Every(s.JobName(), time.Duration(s.windows())*s.Plan.Window, func(ctx context.Context) error {
+		_, err := s.Pay(ctx)
+		return err
+	})
+}
+
+// JobName is the scheduler job name used by Schedule
+func (s *Stream) JobName() string {
+	return "streampay-" + s.Plan.Channel + "-" + s.Plan.Owner.Hex()
+}
+
+func (s *Stream) windows() int64 {
+	return windows(s.Windows)
+}
+
+func (s *Stream) entry(action, outcome string, details map[string]string) audit.Entry {
+	details["owner"] = s.Plan.Owner.Hex()
+	return audit.Entry{
+		Actor:   s.Wallet.Address.Hex(),
+		Action:  action,
+		Subject: s.Plan.Channel,
+		Outcome: outcome,
+		Details: details,
+	}
+}
+
+// Transfers pays a channel owner with a scheduled on-chain transfer every
+// Windows windows. It serves ETH plans, which vouchers cannot settle; token
+// plans should use a Stream, which does not send a transaction per payment
+type Transfers struct {
+	Wallet  *wallet.Wallet
+	Plan    Plan
+	Windows int64 // windows bought per transfer; more means fewer transactions
+	Audit   audit.Log
+}
+
+// NewTransfers creates scheduled transfers paying one window at a time
+func NewTransfers(w *wallet.Wallet, plan Plan, auditLog audit.Log) (*Transfers, error) {
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Transfers{Wallet: w, Plan: plan, Windows: 1, Audit: auditLog}, nil
+}
+
+// Pay sends one transfer of Rate times Windows to the owner
+func (t *Transfers) Pay(ctx context.Context) (*types.Transaction, error) {
+	amount := new(big.Int).Mul(t.Plan.Rate, big.NewInt(windows(t.Windows)))
+	var (
+		tx  *types.Transaction
+		err error
+	)
+	if t.Plan.Asset == (common.Address{}) {
+		tx, err = t.Wallet.SendTx(ctx, t.Plan.Owner, units.NewWei(amount), nil)
+	} else {
+		var data []byte
+		if data, err = contract.TransferData(t.Plan.Owner, amount); err == nil {
+			tx, err = t.Wallet.SendTx(ctx, t.Plan.Asset, units.Wei{}, &wallet.TxOpts{Data: data})
+		}
+	}
+
+	entry := audit.Entry{
+		Actor:   t.Wallet.Address.Hex(),
+		Action:  "stream-payment",
+		Subject: t.Plan.Channel,
+		Outcome: "sent",
+		Details: map[string]string{"amount": amount.String(), "owner": t.Plan.Owner.Hex()},
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Details["error"] = err.Error()
+	} else {
+		entry.Details["tx"] = tx.Hash().Hex()
+	}
+	t.Audit.Record(ctx, entry)
+	return tx, err
+}
+
+// Schedule pays now and then once per Windows windows; the plan's Grace
+// must cover the time a transfer takes to be mined
+func (t *Transfers) Schedule(sch *scheduler.Scheduler) error {
+	return sch.Every(t.JobName(), time.Duration(windows(t.Windows))*t.Plan.Window, func(ctx context.Context) error {
+		_, err := t.Pay(ctx)
+		return err
+	})
+}
+
+// JobName is the scheduler job name used by Schedule
+func (t *Transfers) JobName() string {
+	return "streampay-transfers-" + t.Plan.Channel + "-" + t.Plan.Owner.Hex()
+}
+
+func windows(n int64) int64 {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,346 @@
+package streampay
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+var token = common.HexToAddress("0x00000000000000000000000000000000000070c0")
+
+// fakeToken is an eth RPC namespace holding one ERC-20 token's balances and
+// allowances, updated by the approve and transferFrom transactions it is sent
+type fakeToken struct {
+	mu         sync.Mutex
+	chainID    *big.Int
+	nonces     map[common.Address]uint64
+	balances   map[common.Address]*big.Int
+	allowances map[[2]common.Address]*big.Int
+	sent       int
+}
+
+func (f *fakeToken) ChainId() *hexutil.Big { return (*hexutil.Big)(f.chainID) }
+
+func (f *fakeToken) GetTransactionCount(addr common.Address, block string) hexutil.Uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return hexutil.Uint64(f.nonces[addr])
+}
+
+func (f *fakeToken) EstimateGas(args map[string]interface{}) hexutil.Uint64 { return 60000 }
+
+func (f *fakeToken) Call(args struct {
+	To    *common.Address `json:"to"`
+	Input hexutil.Bytes   `json:"input"`
+}, block string) (hexutil.Bytes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := []byte(args.Input)
+	switch {
+	case len(data) == 36 && string(data[:4]) == string(contract.BalanceOfSelector):
+		return common.LeftPadBytes(f.balance(common.BytesToAddress(data[4:36])).Bytes(), 32), nil
+	case len(data) == 68:
+		owner, spender := common.BytesToAddress(data[4:36]), common.BytesToAddress(data[36:68])
+		return common.LeftPadBytes(f.allowance(owner, spender).Bytes(), 32), nil
+	}
+	return nil, errors.New("unsupported call")
+}
+
+func (f *fakeToken) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Hash{}, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(f.chainID), tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nonces[from]++
+	f.sent++
+	if spender, amount, ok := contract.DecodeApprove(tx.Data()); ok {
+		f.allowances[[2]common.Address{from, spender}] = amount
+	} else if src, dst, amount, ok := contract.DecodeTransferFrom(tx.Data()); ok {
+		left := new(big.Int).Sub(f.allowance(src, from), amount)
+		if left.Sign() < 0 || f.balance(src).Cmp(amount) < 0 {
+			return common.Hash{}, errors.New("transferFrom exceeds allowance or balance")
+		}
+		f.allowances[[2]common.Address{src, from}] = left
+		f.balances[src] = new(big.Int).Sub(f.balance(src), amount)
+		f.balances[dst] = new(big.Int).Add(f.balance(dst), amount)
+	}
+	return tx.Hash(), nil
+}
+
+func (f *fakeToken) balance(a common.Address) *big.Int {
+	if b := f.balances[a]; b != nil {
+		return b
+	}
+	return new(big.Int)
+}
+
+func (f *fakeToken) allowance(owner, spender common.Address) *big.Int {
+	if a := f.allowances[[2]common.Address{owner, spender}]; a != nil {
+		return a
+	}
+	return new(big.Int)
+}
+
+func newFakeToken(t *testing.T) (*fakeToken, *ethclient.Client) {
+	f := &fakeToken{
+		chainID:    big.NewInt(1337),
+		nonces:     map[common.Address]uint64{},
+		balances:   map[common.Address]*big.Int{},
+		allowances: map[[2]common.Address]*big.Int{},
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", f); err != nil {
+		t.Fatal(err)
+	}
+	client := ethclient.NewClient(rpc.DialInProc(srv))
+	t.Cleanup(func() {
+		client.Close()
+		srv.Stop()
+	})
+	return f, client
+}
+
+func newWallet(t *testing.T, client *ethclient.Client) *wallet.Wallet {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wallet.NewWalletFromClient(key, client)
+	w.GasStrategy = wallet.FixedGasPrice{Price: big.NewInt(1e9)}
+	w.TxManager = nil
+	return w
+}
+
+func TestVoucherStreamSettlesOnClose(t *testing.T) {
+	ctx := context.Background()
+	chain, client := newFakeToken(t)
+	subscriber, owner := newWallet(t, client), newWallet(t, client)
+	chain.balances[subscriber.Address] = big.NewInt(1000)
+
+	plan := Plan{Channel: "news", Owner: owner.Address, Asset: token, Rate: big.NewInt(10), Window: time.Hour}
+	gate, err := NewGate(plan, storage.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate.Token = contract.NewERC20ForToken(units.Token{Address: token, Symbol: "TKN", Decimals: 18}, client)
+	gate.Wallet = owner
+
+	stream, err := NewStream(subscriber, plan, func(ctx context.Context, v *Voucher) error {
+		_, err := gate.Redeem(ctx, v)
+		return err
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Windows = 2
+
+	if _, err := stream.Pay(ctx); !errors.Is(err, ErrNotOpen) {
+		t.Fatalf("pay before open: got %v", err)
+	}
+	if _, err := stream.Open(ctx, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	var last *Voucher
+	for i := 0; i < 2; i++ {
+		if last, err = stream.Pay(ctx); err != nil {
+			t.Fatalf("pay %d: %v", i, err)
+		}
+	}
+	if _, err := stream.Pay(ctx); !errors.Is(err, ErrDepositSpent) {
+		t.Fatalf("pay past the deposit: got %v", err)
+	}
+	if chain.sent != 1 {
+		t.Fatalf("%d transactions before close, want only the approval", chain.sent)
+	}
+
+	now := time.Unix(last.Opened, 0)
+	if ok, _ := gate.Allowed(ctx, subscriber.Address, now.Add(3*time.Hour)); !ok {
+		t.Fatal("40 of rate 10 should cover four hours")
+	}
+	if ok, _ := gate.Allowed(ctx, subscriber.Address, now.Add(5*time.Hour)); ok {
+		t.Fatal("access past what the vouchers pay for")
+	}
+	if _, err := gate.Redeem(ctx, last); !errors.Is(err, ErrStaleVoucher) {
+		t.Fatalf("replayed voucher: got %v", err)
+	}
+
+	tx, err := gate.Close(ctx, subscriber.Address)
+	if err != nil || tx == nil {
+		t.Fatalf("close: %v, %v", tx, err)
+	}
+	if got := chain.balance(owner.Address); got.Int64() != 40 {
+		t.Fatalf("owner collected %d, want 40", got)
+	}
+	if tx, err := gate.Close(ctx, subscriber.Address); err != nil || tx != nil {
+		t.Fatalf("second close: %v, %v", tx, err)
+	}
+	if _, err := gate.Redeem(ctx, last); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("voucher after close: got %v", err)
+	}
+}
+
+func TestRedeemRejects(t *testing.T) {
+	ctx := context.Background()
+	chain, client := newFakeToken(t)
+	subscriber, owner := newWallet(t, client), newWallet(t, client)
+	chain.balances[subscriber.Address] = big.NewInt(100)
+	chain.allowances[[2]common.Address{subscriber.Address, owner.Address}] = big.NewInt(30)
+
+	plan := Plan{Channel: "news", Owner: owner.Address, Asset: token, Rate: big.NewInt(10), Window: time.Hour}
+	gate, err := NewGate(plan, storage.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate.Token = contract.NewERC20ForToken(units.Token{Address: token, Symbol: "TKN", Decimals: 18}, client)
+
+	voucher := func(amount int64, edit func(v *Voucher)) *Voucher {
+		v := &Voucher{Channel: plan.Channel, Owner: plan.Owner, Asset: plan.Asset, Opened: 1700000000, Amount: (*hexutil.Big)(big.NewInt(amount))}
+		if edit != nil {
+			edit(v)
+		}
+		if err := v.Sign(subscriber); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	forged := voucher(10, nil)
+	forged.Amount = (*hexutil.Big)(big.NewInt(20))
+
+	tests := []struct {
+		name string
+		v    *Voucher
+		want error
+	}{
+		{"other channel", voucher(10, func(v *Voucher) { v.Channel = "sports" }), ErrBadVoucher},
+		{"other asset", voucher(10, func(v *Voucher) { v.Asset = common.Address{} }), ErrBadVoucher},
+		{"forged amount", forged, ErrBadVoucher},
+		{"zero amount", voucher(0, nil), ErrBadVoucher},
+		{"over allowance", voucher(40, nil), ErrUnfunded},
+	}
+	for _, tt := range tests {
+		if _, err := gate.Redeem(ctx, tt.v); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := gate.Redeem(ctx, voucher(20, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gate.Redeem(ctx, voucher(10, nil)); !errors.Is(err, ErrStaleVoucher) {
+		t.Fatalf("lower total: got %v", err)
+	}
+	if _, err := gate.Redeem(ctx, voucher(30, func(v *Voucher) { v.Opened++ })); !errors.Is(err, ErrStreamOpen) {
+		t.Fatalf("second stream: got %v", err)
+	}
+}
+
+func TestRedeemStartsAtGateClock(t *testing.T) {
+	ctx := context.Background()
+	chain, client := newFakeToken(t)
+	subscriber, owner := newWallet(t, client), newWallet(t, client)
+	chain.balances[subscriber.Address] = big.NewInt(100)
+	chain.allowances[[2]common.Address{subscriber.Address, owner.Address}] = big.NewInt(30)
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+
+	plan := Plan{Channel: "news", Owner: owner.Address, Asset: token, Rate: big.NewInt(10), Window: time.Hour}
+	gate, err := NewGate(plan, storage.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate.Token, gate.Wallet, gate.Clock = contract.NewERC20ForToken(units.Token{Address: token, Symbol: "TKN", Decimals: 18}, client), owner, clk
+
+	// Dated a year ahead, one window's payment must still buy one window
+	v := &Voucher{Channel: plan.Channel, Owner: plan.Owner, Asset: plan.Asset, Opened: clk.Now().AddDate(1, 0, 0).Unix(), Amount: (*hexutil.Big)(big.NewInt(10))}
+	if err := v.Sign(subscriber); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := gate.Redeem(ctx, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clk.Now().Add(time.Hour); !sub.PaidThrough.Equal(want) {
+		t.Fatalf("paid through %v, want %v", sub.PaidThrough, want)
+	}
+	clk.Advance(2 * time.Hour)
+	cut, err := gate.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cut) != 1 || cut[0].Subscriber != subscriber.Address {
+		t.Fatalf("forward-dated stream not cut off: %+v", cut)
+	}
+}
+
+func TestNewStreamNeedsToken(t *testing.T) {
+	plan := Plan{Channel: "news", Rate: big.NewInt(1), Window: time.Hour}
+	if _, err := NewStream(nil, plan, nil, nil); !errors.Is(err, ErrNativeAsset) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestSweepCutsOffAndCollects(t *testing.T) {
+	ctx := context.Background()
+	chain, client := newFakeToken(t)
+	subscriber, owner := newWallet(t, client), newWallet(t, client)
+	chain.balances[subscriber.Address] = big.NewInt(100)
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+
+	plan := Plan{Channel: "news", Owner: owner.Address, Asset: token, Rate: big.NewInt(10), Window: time.Hour, Grace: 10 * time.Minute}
+	gate, err := NewGate(plan, storage.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate.Token, gate.Wallet, gate.Clock = contract.NewERC20ForToken(units.Token{Address: token, Symbol: "TKN", Decimals: 18}, client), owner, clk
+	stream, err := NewStream(subscriber, plan, func(ctx context.Context, v *Voucher) error {
+		_, err := gate.Redeem(ctx, v)
+		return err
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Clock = clk
+
+	if _, err := stream.Open(ctx, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Pay(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	clk.Advance(65 * time.Minute)
+	if cut, err := gate.Sweep(ctx); err != nil || len(cut) != 0 {
+		t.Fatalf("cut off within the grace period: %v, %v", cut, err)
+	}
+	clk.Advance(10 * time.Minute)
+	cut, err := gate.Sweep(ctx)
+	if err != nil || len(cut) != 1 || cut[0].Subscriber != subscriber.Address {
+		t.Fatalf("sweep: %v, %v", cut, err)
+	}
+	if got := chain.balance(owner.Address); got.Int64() != 10 {
+		t.Fatalf("owner collected %d, want 10", got)
+	}
+	if ok, _ := gate.Allowed(ctx, subscriber.Address, clk.Now()); ok {
+		t.Fatal("access after cutoff")
+	}
+}
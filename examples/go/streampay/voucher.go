@@ -0,0 +1,82 @@
+package streampay
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+var (
+	// ErrNativeAsset is returned for voucher streams on ETH plans; vouchers
+	// settle with transferFrom, so they need a token
+	ErrNativeAsset = errors.New("streampay: vouchers need a token asset")
+	// ErrBadVoucher is returned for vouchers that are not for the plan or
+	// not signed by their subscriber
+	ErrBadVoucher = errors.New("streampay: invalid voucher")
+	// ErrStaleVoucher is returned for vouchers that do not raise the total
+	ErrStaleVoucher = errors.New("streampay: voucher does not raise the total")
+	// ErrStreamOpen is returned for a voucher opening a new stream while
+	// another from the same subscriber is active or not yet collected
+	ErrStreamOpen = errors.New("streampay: another stream is still open")
+	// ErrStreamClosed is returned for vouchers of a stream that was closed
+	ErrStreamClosed = errors.New("streampay: stream is closed")
+	// ErrUnfunded is returned when the subscriber's allowance or balance
+	// does not cover a voucher
+	ErrUnfunded = errors.New("streampay: voucher exceeds the subscriber's allowance or balance")
+)
+
+// Voucher is a subscriber's signed promise of the total paid to a channel
+// owner since the stream opened. Each voucher supersedes the one before, so
+// the owner keeps only the latest and collects it on chain once, from the
+// subscriber's allowance, when the stream closes
+type Voucher struct {
+	Channel    string         `json:"channel"`
+	Owner      common.Address `json:"owner"`
+	Asset      common.Address `json:"asset"`
+	Subscriber common.Address `json:"subscriber"`
+	Opened     int64          `json:"opened"` // unix seconds; identifies the stream, not when it starts
+	Amount     *hexutil.Big   `json:"amount"` // total for the stream, in base units
+	Signature  hexutil.Bytes  `json:"signature,omitempty"`
+}
+
+// SigningPayload returns the canonical bytes covered by the signature
+func (v *Voucher) SigningPayload() ([]byte, error) {
+	unsigned := *v
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Sign signs the voucher with the subscriber's wallet
+func (v *Voucher) Sign(w *wallet.Wallet) error {
+	v.Subscriber = w.Address
+	payload, err := v.SigningPayload()
+	if err != nil {
+		return err
+	}
+	sig, err := w.SignMessage(payload)
+	if err != nil {
+		return err
+	}
+	v.Signature = sig
+	return nil
+}
+
+// Verify checks the voucher is signed by its subscriber
+func (v *Voucher) Verify() bool {
+	if v.Amount == nil || v.Amount.ToInt().Sign() <= 0 {
+		return false
+	}
+	payload, err := v.SigningPayload()
+	if err != nil {
+		return false
+	}
+	return wallet.VerifySignature(payload, v.Signature, v.Subscriber)
+}
+
+// matches reports whether the voucher pays for plan
+func (v *Voucher) matches(plan *Plan) bool {
+	return v.Channel == plan.Channel && v.Owner == plan.Owner && v.Asset == plan.Asset
+}
@@ -0,0 +1,144 @@
+package timelock
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+)
+
+// timelockABIJSON is the subset of OpenZeppelin's TimelockController used here
+const timelockABIJSON = `[
+{"type":"function","name":"getMinDelay","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"getTimestamp","stateMutability":"view","inputs":[{"name":"id","type":"bytes32"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"schedule","stateMutability":"nonpayable","inputs":[{"name":"target","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"predecessor","type":"bytes32"},{"name":"salt","type":"bytes32"},{"name":"delay","type":"uint256"}],"outputs":[]},
+{"type":"function","name":"execute","stateMutability":"payable","inputs":[{"name":"target","type":"address"},{"name":"value","type":"uint256"},{"name":"payload","type":"bytes"},{"name":"predecessor","type":"bytes32"},{"name":"salt","type":"bytes32"}],"outputs":[]},
+{"type":"function","name":"cancel","stateMutability":"nonpayable","inputs":[{"name":"id","type":"bytes32"}],"outputs":[]}
+]`
+
+var timelockABI = mustParseABI(timelockABIJSON)
+
+// doneTimestamp is the value getTimestamp returns for executed operations
+const doneTimestamp = 1
+
+// Operation is a single call routed through the timelock
+type Operation struct {
+	Target      common.Address `json:"target"`
+	Value       *hexutil.Big   `json:"value"`
+	Data        hexutil.Bytes  `json:"data"`
+	Predecessor common.Hash    `json:"predecessor"`
+	Salt        common.Hash    `json:"salt"`
+}
+
+// ID returns the operation id, matching TimelockController.hashOperation
+func (op *Operation) ID() common.Hash {
+	bytes32, _ := abi.NewType("bytes32", "", nil)
+	address, _ := abi.NewType("address", "", nil)
+	uint256, _ := abi.NewType("uint256", "", nil)
+	bytesT, _ := abi.NewType("bytes", "", nil)
+	args := abi.Arguments{{Type: address}, {Type: uint256}, {Type: bytesT}, {Type: bytes32}, {Type: bytes32}}
+
+	encoded, err := args.Pack(op.Target, op.value(), []byte(op.Data), [32]byte(op.Predecessor), [32]byte(op.Salt))
+	if err != nil {
+		return common.Hash{}
+	}
+	return crypto.Keccak256Hash(encoded)
+}
+
+func (op *Operation) value() *big.Int {
+	if op.Value == nil {
+		return new(big.Int)
+	}
+	return op.Value.ToInt()
+}
+
+// State is the lifecycle state of an operation
+type State string
+
+const (
+	StateUnset   State = "unset" // never scheduled, or cancelled
+	StateWaiting State = "waiting"
+	StateReady   State = "ready"
+	StateDone    State = "done"
+)
+
+// Timelock wraps an OpenZeppelin TimelockController
+type Timelock struct {
+	Address  common.Address
+	Client   *ethclient.Client
+	contract *bind.BoundContract
+}
+
+// New creates a new Timelock instance
+func New(address common.Address, client *ethclient.Client) *Timelock {
+	return &Timelock{
+		Address:  address,
+		Client:   client,
+		contract: bind.NewBoundContract(address, timelockABI, client, client, client),
+	}
+}
+
+// MinDelay returns the minimum delay enforced for new operations
+func (t *Timelock) MinDelay(ctx context.Context) (time.Duration, error) {
+	v, err := t.callUint(ctx, "getMinDelay")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(v.Int64()) * time.Second, nil
+}
+
+// Schedule queues an operation that becomes executable after delay
+func (t *Timelock) Schedule(auth *bind.TransactOpts, op *Operation, delay time.Duration) (*types.Transaction, error) {
+	return t.contract.Transact(auth, "schedule", op.Target, op.value(), []byte(op.Data), [32]byte(op.Predecessor), [32]byte(op.Salt), big.NewInt(int64(delay/time.Second)))
+}
+
+// Execute runs a ready operation; auth.Value must equal the operation value
+func (t *Timelock) Execute(auth *bind.TransactOpts, op *Operation) (*types.Transaction, error) {
+	return t.contract.Transact(auth, "execute", op.Target, op.value(), []byte(op.Data), [32]byte(op.Predecessor), [32]byte(op.Salt))
+}
+
+// Cancel removes a pending operation
+func (t *Timelock) Cancel(auth *bind.TransactOpts, id common.Hash) (*types.Transaction, error) {
+	return t.contract.Transact(auth, "cancel", [32]byte(id))
+}
+
+// Status returns the state of an operation and, while it is waiting or ready,
+// the time it becomes executable
+func (t *Timelock) Status(ctx context.Context, id common.Hash, now time.Time) (State, time.Time, error) {
+	ts, err := t.callUint(ctx, "getTimestamp", [32]byte(id))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	switch {
+	case ts.Sign() == 0:
+		return StateUnset, time.Time{}, nil
+	case ts.Cmp(big.NewInt(doneTimestamp)) == 0:
+		return StateDone, time.Time{}, nil
+	}
+	eta := time.Unix(ts.Int64(), 0)
+	if now.Before(eta) {
+		return StateWaiting, eta, nil
+	}
+	return StateReady, eta, nil
+}
+
+func (t *Timelock) callUint(ctx context.Context, method string, args ...interface{}) (*big.Int, error) {
+	return contract.Call[*big.Int](ctx, t.contract, method, args...)
+}
+
+func mustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -0,0 +1,229 @@
+package timelock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+)
+
+const trackedPrefix = "timelock/op/"
+
+// Tracked is a scheduled operation being watched
+type Tracked struct {
+	ID        common.Hash `json:"id"`
+	Label     string      `json:"label"`
+	Operation Operation   `json:"operation"`
+	ETA       time.Time   `json:"eta"`
+	State     State       `json:"state"`
+	Notified  []string    `json:"notified,omitempty"` // countdown warnings already sent
+}
+
+// Tracker keeps a persistent list of queued operations and raises countdown
+// alerts as they approach and reach their execution time
+type Tracker struct {
+	Timelock *Timelock
+	Store    storage.Store
+	Alerts   alert.Notifier
+	Warnings []time.Duration // notify when this much time remains, e.g. 24h and 1h
+	Clock    clock.Clock     // nil is the wall clock
+}
+
+// NewTracker creates a tracker with 24 hour and 1 hour countdown warnings
+func NewTracker(tl *Timelock, store storage.Store, alerts alert.Notifier) *Tracker {
+	if alerts == nil {
+		alerts = alert.Discard
+	}
+	return &Tracker{
+		Timelock: tl,
+		Store:    store,
+		Alerts:   alerts,
+		Warnings: []time.Duration{24 * time.Hour, time.Hour},
+	}
+}
+
+// Queue schedules an operation and starts tracking it
+func (tr *Tracker) Queue(ctx context.Context, auth *bind.TransactOpts, op *Operation, delay time.Duration, label string) (*types.Transaction, error) {
+	tx, err := tr.Timelock.Schedule(auth, op, delay)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tracked{
+		ID:        op.ID(),
+		Label:     label,
+		Operation: *op,
+		ETA:       clock.Or(tr.Clock).Now().Add(delay).UTC(),
+		State:     StateUnset, // until the schedule transaction is mined
+	}
+	if err := tr.save(ctx, t); err != nil {
+		return tx, err
+	}
+	tr.notify(ctx, t, alert.Info, "queued", fmt.Sprintf("executable after %s", t.ETA.Format(time.RFC3339)))
+	return tx, nil
+}
+
+// Track watches an operation that was scheduled elsewhere
+func (tr *Tracker) Track(ctx context.Context, op *Operation, label string) error {
+	state, eta, err := tr.Timelock.Status(ctx, op.ID(), clock.Or(tr.Clock).Now())
+	if err != nil {
+		return err
+	}
+	return tr.save(ctx, &Tracked{ID: op.ID(), Label: label, Operation: *op, ETA: eta, State: state})
+}
+
+// Execute runs a tracked operation that is ready
+func (tr *Tracker) Execute(ctx context.Context, auth *bind.TransactOpts, id common.Hash) (*types.Transaction, error) {
+	t, err := tr.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	state, _, err := tr.Timelock.Status(ctx, id, clock.Or(tr.Clock).Now())
+	if err != nil {
+		return nil, err
+	}
+	if state != StateReady {
+		return nil, fmt.Errorf("operation %s is %s", id.Hex(), state)
+	}
+	auth.Value = t.Operation.value()
+	return tr.Timelock.Execute(auth, &t.Operation)
+}
+
+// Pending returns the tracked operations that have not been executed or cancelled
+func (tr *Tracker) Pending(ctx context.Context) ([]*Tracked, error) {
+	keys, err := tr.Store.List(ctx, trackedPrefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Tracked, 0, len(keys))
+	for _, key := range keys {
+		data, err := tr.Store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var t Tracked
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, &t)
+	}
+	return out, nil
+}
+
+// Tick refreshes every tracked operation from the chain, sends countdown and
+// readiness alerts, and stops tracking executed or cancelled operations
+func (tr *Tracker) Tick(ctx context.Context) error {
+	pending, err := tr.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	now := clock.Or(tr.Clock).Now()
+	for _, t := range pending {
+		state, eta, err := tr.Timelock.Status(ctx, t.ID, now)
+		if err != nil {
+			return err
+		}
+
+		switch state {
+		case StateDone:
+			tr.notify(ctx, t, alert.Info, "executed", "")
+			if err := tr.Store.Delete(ctx, trackedPrefix+t.ID.Hex()); err != nil {
+				return err
+			}
+			continue
+		case StateUnset:
+			if t.State == StateUnset {
+				continue // not scheduled on-chain yet
+			}
+			tr.notify(ctx, t, alert.Warning, "cancelled", "")
+			if err := tr.Store.Delete(ctx, trackedPrefix+t.ID.Hex()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		changed := t.State != state || !t.ETA.Equal(eta)
+		t.State, t.ETA = state, eta.UTC()
+		if state == StateReady && changed {
+			tr.notify(ctx, t, alert.Warning, "ready", "operation can now be executed")
+		}
+		if state == StateWaiting {
+			remaining := eta.Sub(now)
+			for _, w := range tr.Warnings {
+				mark := w.String()
+				if remaining > w || contains(t.Notified, mark) {
+					continue
+				}
+				t.Notified = append(t.Notified, mark)
+				tr.notify(ctx, t, alert.Info, "countdown", fmt.Sprintf("executable in %s", remaining.Round(time.Minute)))
+				changed = true
+			}
+		}
+		if changed {
+			if err := tr.save(ctx, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Schedule registers periodic tracking with a scheduler
+func (tr *Tracker) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("timelock-tracker", interval, tr.Tick)
+}
+
+func (tr *Tracker) notify(ctx context.Context, t *Tracked, sev alert.Severity, event, msg string) {
+	title := fmt.Sprintf("timelock operation %s", event)
+	if t.Label != "" {
+		title += ": " + t.Label
+	}
+	tr.Alerts.Notify(ctx, alert.Alert{
+		Severity: sev,
+		Source:   "timelock",
+		Title:    title,
+		Message:  msg,
+		Key:      "timelock/" + t.ID.Hex() + "/" + event,
+		Labels: map[string]string{
+			"timelock":  tr.Timelock.Address.Hex(),
+			"operation": t.ID.Hex(),
+			"target":    t.Operation.Target.Hex(),
+		},
+	})
+}
+
+func (tr *Tracker) load(ctx context.Context, id common.Hash) (*Tracked, error) {
+	data, err := tr.Store.Get(ctx, trackedPrefix+id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	var t Tracked
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (tr *Tracker) save(ctx context.Context, t *Tracked) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return tr.Store.Put(ctx, trackedPrefix+t.ID.Hex(), data)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
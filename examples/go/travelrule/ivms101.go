@@ -0,0 +1,207 @@
+package travelrule
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The types below are the parts of the interVASP Messaging Standard
+// (IVMS101) identity payload exchanged between VASPs, in its JSON form.
+// Fields this package does not check are carried through unchanged
+
+// IdentityPayload is the IVMS101 identity data of one transfer
+type IdentityPayload struct {
+	Originator      Originator       `json:"originator"`
+	Beneficiary     Beneficiary      `json:"beneficiary"`
+	OriginatingVASP *OriginatingVASP `json:"originatingVASP,omitempty"`
+	BeneficiaryVASP *BeneficiaryVASP `json:"beneficiaryVASP,omitempty"`
+}
+
+// Originator is the account holder sending the transfer
+type Originator struct {
+	OriginatorPersons []Person `json:"originatorPersons"`
+	AccountNumber     []string `json:"accountNumber,omitempty"`
+}
+
+// Beneficiary is the account holder receiving the transfer
+type Beneficiary struct {
+	BeneficiaryPersons []Person `json:"beneficiaryPersons"`
+	AccountNumber      []string `json:"accountNumber,omitempty"`
+}
+
+// OriginatingVASP is the VASP sending on behalf of the originator
+type OriginatingVASP struct {
+	OriginatingVASP Person `json:"originatingVASP"`
+}
+
+// BeneficiaryVASP is the VASP receiving on behalf of the beneficiary
+type BeneficiaryVASP struct {
+	BeneficiaryVASP Person `json:"beneficiaryVASP"`
+}
+
+// Person is exactly one of a natural or a legal person
+type Person struct {
+	NaturalPerson *NaturalPerson `json:"naturalPerson,omitempty"`
+	LegalPerson   *LegalPerson   `json:"legalPerson,omitempty"`
+}
+
+// NaturalPerson is an individual
+type NaturalPerson struct {
+	Name                   NaturalPersonName       `json:"name"`
+	GeographicAddress      []Address               `json:"geographicAddress,omitempty"`
+	NationalIdentification *NationalIdentification `json:"nationalIdentification,omitempty"`
+	CustomerIdentification string                  `json:"customerIdentification,omitempty"`
+	DateAndPlaceOfBirth    *DateAndPlaceOfBirth    `json:"dateAndPlaceOfBirth,omitempty"`
+	CountryOfResidence     string                  `json:"countryOfResidence,omitempty"`
+}
+
+// NaturalPersonName holds an individual's names
+type NaturalPersonName struct {
+	NameIdentifier []NaturalPersonNameID `json:"nameIdentifier"`
+}
+
+// NaturalPersonNameID is one name: the primary identifier is the family
+// name, the secondary the given names
+type NaturalPersonNameID struct {
+	PrimaryIdentifier   string `json:"primaryIdentifier"`
+	SecondaryIdentifier string `json:"secondaryIdentifier,omitempty"`
+	NameIdentifierType  string `json:"nameIdentifierType"` // LEGL, ALIA, BIRT, MAID or MISC
+}
+
+// LegalPerson is a company or other entity
+type LegalPerson struct {
+	Name                   LegalPersonName         `json:"name"`
+	GeographicAddress      []Address               `json:"geographicAddress,omitempty"`
+	CustomerNumber         string                  `json:"customerNumber,omitempty"`
+	NationalIdentification *NationalIdentification `json:"nationalIdentification,omitempty"`
+	CountryOfRegistration  string                  `json:"countryOfRegistration,omitempty"`
+}
+
+// LegalPersonName holds an entity's names
+type LegalPersonName struct {
+	NameIdentifier []LegalPersonNameID `json:"nameIdentifier"`
+}
+
+// LegalPersonNameID is one name of an entity
+type LegalPersonNameID struct {
+	LegalPersonName               string `json:"legalPersonName"`
+	LegalPersonNameIdentifierType string `json:"legalPersonNameIdentifierType"` // LEGL, SHRT or TRAD
+}
+
+// Address is a geographic address
+type Address struct {
+	AddressType    string   `json:"addressType"` // HOME, BIZZ or GEOG
+	StreetName     string   `json:"streetName,omitempty"`
+	BuildingNumber string   `json:"buildingNumber,omitempty"`
+	AddressLine    []string `json:"addressLine,omitempty"`
+	PostCode       string   `json:"postCode,omitempty"`
+	TownName       string   `json:"townName,omitempty"`
+	Country        string   `json:"country"`
+}
+
+// NationalIdentification is an identity document or registration number
+type NationalIdentification struct {
+	NationalIdentifier     string `json:"nationalIdentifier"`
+	NationalIdentifierType string `json:"nationalIdentifierType"` // e.g. CCPT, RAID, LEIX, TXID
+	CountryOfIssue         string `json:"countryOfIssue,omitempty"`
+	RegistrationAuthority  string `json:"registrationAuthority,omitempty"`
+}
+
+// DateAndPlaceOfBirth identifies an individual by birth
+type DateAndPlaceOfBirth struct {
+	DateOfBirth  string `json:"dateOfBirth"` // YYYY-MM-DD
+	PlaceOfBirth string `json:"placeOfBirth"`
+}
+
+var (
+	naturalNameTypes = map[string]bool{"LEGL": true, "ALIA": true, "BIRT": true, "MAID": true, "MISC": true}
+	legalNameTypes   = map[string]bool{"LEGL": true, "SHRT": true, "TRAD": true}
+	addressTypes     = map[string]bool{"HOME": true, "BIZZ": true, "GEOG": true}
+)
+
+// Validate checks the constraints the receiving VASP relies on: both parties
+// are named, every person is natural or legal, names carry a legal name and
+// codes and countries are well-formed
+func (p *IdentityPayload) Validate() error {
+	if len(p.Originator.OriginatorPersons) == 0 {
+		return errors.New("travelrule: originator has no persons")
+	}
+	if len(p.Beneficiary.BeneficiaryPersons) == 0 {
+		return errors.New("travelrule: beneficiary has no persons")
+	}
+	for i := range p.Originator.OriginatorPersons {
+		if err := p.Originator.OriginatorPersons[i].validate(); err != nil {
+			return fmt.Errorf("travelrule: originator person %d: %w", i, err)
+		}
+	}
+	for i := range p.Beneficiary.BeneficiaryPersons {
+		if err := p.Beneficiary.BeneficiaryPersons[i].validate(); err != nil {
+			return fmt.Errorf("travelrule: beneficiary person %d: %w", i, err)
+		}
+	}
+	if p.OriginatingVASP != nil {
+		if err := p.OriginatingVASP.OriginatingVASP.validate(); err != nil {
+			return fmt.Errorf("travelrule: originating VASP: %w", err)
+		}
+	}
+	if p.BeneficiaryVASP != nil {
+		if err := p.BeneficiaryVASP.BeneficiaryVASP.validate(); err != nil {
+			return fmt.Errorf("travelrule: beneficiary VASP: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Person) validate() error {
+	switch {
+	case p.NaturalPerson != nil && p.LegalPerson != nil:
+		return errors.New("both natural and legal person")
+	case p.NaturalPerson != nil:
+		n := p.NaturalPerson
+		legal := false
+		for _, id := range n.Name.NameIdentifier {
+			if id.PrimaryIdentifier == "" || !naturalNameTypes[id.NameIdentifierType] {
+				return errors.New("invalid name identifier")
+			}
+			legal = legal || id.NameIdentifierType == "LEGL"
+		}
+		if !legal {
+			return errors.New("no legal name")
+		}
+		if n.CountryOfResidence != "" && !country(n.CountryOfResidence) {
+			return errors.New("invalid country of residence")
+		}
+		return validAddresses(n.GeographicAddress)
+	case p.LegalPerson != nil:
+		l := p.LegalPerson
+		legal := false
+		for _, id := range l.Name.NameIdentifier {
+			if id.LegalPersonName == "" || !legalNameTypes[id.LegalPersonNameIdentifierType] {
+				return errors.New("invalid name identifier")
+			}
+			legal = legal || id.LegalPersonNameIdentifierType == "LEGL"
+		}
+		if !legal {
+			return errors.New("no legal name")
+		}
+		if l.CountryOfRegistration != "" && !country(l.CountryOfRegistration) {
+			return errors.New("invalid country of registration")
+		}
+		return validAddresses(l.GeographicAddress)
+	}
+	return errors.New("neither natural nor legal person")
+}
+
+func validAddresses(addresses []Address) error {
+	for _, a := range addresses {
+		if !addressTypes[a.AddressType] || !country(a.Country) {
+			return errors.New("invalid geographic address")
+		}
+	}
+	return nil
+}
+
+// country reports whether c looks like an ISO 3166-1 alpha-2 code
+func country(c string) bool {
+	return len(c) == 2 && c[0] >= 'A' && c[0] <= 'Z' && c[1] >= 'A' && c[1] <= 'Z'
+}
@@ -0,0 +1,335 @@
+package travelrule
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const (
+	// Topic is the messaging topic compliance data is exchanged on
+	Topic = "travelrule"
+	// AttachmentCompliance marks envelopes carrying compliance data
+	AttachmentCompliance = "travelrule"
+	// MessageTransfer carries a Transfer
+	MessageTransfer = "travelrule.transfer"
+	// MessageResponse carries a Response
+	MessageResponse = "travelrule.response"
+)
+
+// recordPrefix is the storage key prefix for compliance records by tx hash
+const recordPrefix = "travelrule/record/"
+
+// ErrNoRecord is returned when no compliance data is held for a transaction
+var ErrNoRecord = errors.New("travelrule: no record for transaction")
+
+// TransferRef identifies the on-chain transfer the data is about
+type TransferRef struct {
+	ChainID *hexutil.Big   `json:"chainId"`
+	TxHash  common.Hash    `json:"txHash"`
+	Asset   common.Address `json:"asset"` // zero for ETH
+	Amount  *hexutil.Big   `json:"amount"`
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+}
+
+// Transfer is the compliance message an originating VASP sends
+type Transfer struct {
+	Transfer TransferRef     `json:"transfer"`
+	Identity IdentityPayload `json:"ivms101"`
+}
+
+// Response is the beneficiary VASP's answer: accepted once it matched the
+// beneficiary to its customer, rejected with a reason otherwise
+type Response struct {
+	TxHash   common.Hash `json:"txHash"`
+	Accepted bool        `json:"accepted"`
+	Reason   string      `json:"reason,omitempty"`
+}
+
+// Direction says which side of a transfer a record was kept by
+type Direction string
+
+const (
+	Outgoing Direction = "outgoing"
+	Incoming Direction = "incoming"
+)
+
+// recordMessage is the message type of records sealed to the desk itself
+const recordMessage = "travelrule.record"
+
+// Record is compliance data held for a transaction
+type Record struct {
+	Direction    Direction      `json:"direction"`
+	Counterparty common.Address `json:"counterparty"` // the other VASP's messaging address
+	PeerKey      hexutil.Bytes  `json:"peerKey"`      // its uncompressed messaging key
+	Transfer     Transfer       `json:"transfer"`
+	Response     *Response      `json:"response,omitempty"`
+	Time         time.Time      `json:"time"`
+}
+
+// Desk exchanges compliance data with cooperating VASP deployments over the
+// messaging layer. Records are kept under the transaction hash and sealed to
+// the desk's own key, so the store never holds identity data in the clear
+type Desk struct {
+	Wallet *wallet.Wallet
+	Sender messaging.Sender
+	Store  storage.Store
+	Audit  audit.Log
+}
+
+// NewDesk creates a desk for the VASP whose messaging key is w's
+func NewDesk(w *wallet.Wallet, sender messaging.Sender, store storage.Store, auditLog audit.Log) *Desk {
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Desk{Wallet: w, Sender: sender, Store: store, Audit: auditLog}
+}
+
+// Send validates and seals compliance data for the beneficiary VASP's key and
+// keeps a record of it. Send before or together with the transfer
+func (d *Desk) Send(ctx context.Context, to *ecdsa.PublicKey, t *Transfer) (*messaging.Envelope, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	env, err := seal(d.Wallet, to, MessageTransfer, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Sender.Send(ctx, env); err != nil {
+		d.record(ctx, "travelrule-send", t.Transfer.TxHash, "failed")
+		return nil, err
+	}
+	rec := &Record{Direction: Outgoing, Counterparty: crypto.PubkeyToAddress(*to), PeerKey: crypto.FromECDSAPub(to), Transfer: *t, Time: time.Now().UTC()}
+	if err := d.save(ctx, rec); err != nil {
+		return nil, err
+	}
+	d.record(ctx, "travelrule-send", t.Transfer.TxHash, "sent")
+	return env, nil
+}
+
+// Receive opens compliance data from an originating VASP and keeps a record.
+// Match the beneficiary against the customer behind Transfer.To, then answer
+// with Respond
+func (d *Desk) Receive(ctx context.Context, env *messaging.Envelope) (*Record, error) {
+	if !env.Verify() {
+		return nil, errors.New("travelrule: invalid envelope")
+	}
+	var t Transfer
+	if err := open(env, d.Wallet.PrivateKey, MessageTransfer, &t); err != nil {
+		return nil, err
+	}
+	if err := t.validate(); err != nil {
+		d.record(ctx, "travelrule-receive", t.Transfer.TxHash, "invalid")
+		return nil, err
+	}
+	key, err := env.SenderKey()
+	if err != nil {
+		return nil, err
+	}
+	rec := &Record{Direction: Incoming, Counterparty: env.Sender, PeerKey: crypto.FromECDSAPub(key), Transfer: t, Time: time.Now().UTC()}
+	if err := d.save(ctx, rec); err != nil {
+		return nil, err
+	}
+	d.record(ctx, "travelrule-receive", t.Transfer.TxHash, "received")
+	return rec, nil
+}
+
+// Respond answers the originating VASP of a received record
+func (d *Desk) Respond(ctx context.Context, txHash common.Hash, accepted bool, reason string) error {
+	rec, err := d.Lookup(ctx, txHash)
+	if err != nil {
+		return err
+	}
+	if rec.Direction != Incoming {
+		return errors.New("travelrule: only received transfers are answered")
+	}
+	key, err := crypto.UnmarshalPubkey(rec.PeerKey)
+	if err != nil {
+		return err
+	}
+	resp := &Response{TxHash: txHash, Accepted: accepted, Reason: reason}
+	env, err := seal(d.Wallet, key, MessageResponse, resp)
+	if err != nil {
+		return err
+	}
+	if err := d.Sender.Send(ctx, env); err != nil {
+		return err
+	}
+	rec.Response = resp
+	if err := d.save(ctx, rec); err != nil {
+		return err
+	}
+	d.record(ctx, "travelrule-respond", txHash, outcome(accepted))
+	return nil
+}
+
+// HandleResponse stores the beneficiary VASP's answer to data this desk sent
+func (d *Desk) HandleResponse(ctx context.Context, env *messaging.Envelope) (*Response, error) {
+	if !env.Verify() {
+		return nil, errors.New("travelrule: invalid envelope")
+	}
+	var resp Response
+	if err := open(env, d.Wallet.PrivateKey, MessageResponse, &resp); err != nil {
+		return nil, err
+	}
+	rec, err := d.Lookup(ctx, resp.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Direction != Outgoing || rec.Counterparty != env.Sender {
+		return nil, errors.New("travelrule: response is not from the beneficiary VASP")
+	}
+	rec.Response = &resp
+	if err := d.save(ctx, rec); err != nil {
+		return nil, err
+	}
+	d.record(ctx, "travelrule-response", resp.TxHash, outcome(resp.Accepted))
+	return &resp, nil
+}
+
+// Lookup returns the record held for a transaction
+func (d *Desk) Lookup(ctx context.Context, txHash common.Hash) (*Record, error) {
+	data, err := d.Store.Get(ctx, recordPrefix+txHash.Hex())
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNoRecord
+	}
+	if err != nil {
+		return nil, err
+	}
+	env, err := messaging.DecodeEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := open(env, d.Wallet.PrivateKey, recordMessage, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Check reports whether a transaction is the referenced transfer: a plain
+// ETH transfer or an ERC-20 transfer call from From to To for Amount
+func (r *TransferRef) Check(tx *types.Transaction) error {
+	if tx.Hash() != r.TxHash {
+		return errors.New("travelrule: transaction hash differs")
+	}
+	if r.ChainID == nil || tx.ChainId().Cmp(r.ChainID.ToInt()) != 0 {
+		return errors.New("travelrule: transaction is for another chain")
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	if from != r.From || tx.To() == nil || r.Amount == nil {
+		return errors.New("travelrule: transaction is not from the originator")
+	}
+	to, amount := *tx.To(), tx.Value()
+	if r.Asset != (common.Address{}) {
+		recipient, value, ok := contract.DecodeTransfer(tx.Data())
+		if to != r.Asset || !ok {
+			return errors.New("travelrule: transaction is not a transfer of the asset")
+		}
+		to, amount = recipient, value
+	}
+	if to != r.To || amount.Cmp(r.Amount.ToInt()) != 0 {
+		return errors.New("travelrule: transaction pays a different beneficiary or amount")
+	}
+	return nil
+}
+
+func (t *Transfer) validate() error {
+	if t.Transfer.TxHash == (common.Hash{}) || t.Transfer.ChainID == nil || t.Transfer.Amount == nil {
+		return errors.New("travelrule: transfer reference is incomplete")
+	}
+	return t.Identity.Validate()
+}
+
+// save seals the record to the desk's own key and stores it by tx hash
+func (d *Desk) save(ctx context.Context, rec *Record) error {
+	env, err := seal(d.Wallet, &d.Wallet.PrivateKey.PublicKey, recordMessage, rec)
+	if err != nil {
+		return err
+	}
+	data, err := env.Encode()
+	if err != nil {
+		return err
+	}
+	return d.Store.Put(ctx, recordPrefix+rec.Transfer.Transfer.TxHash.Hex(), data)
+}
+
+func (d *Desk) record(ctx context.Context, action string, txHash common.Hash, outcome string) {
+	d.Audit.Record(ctx, audit.Entry{
+		Actor:   d.Wallet.Address.Hex(),
+		Action:  action,
+		Subject: txHash.Hex(),
+		Outcome: outcome,
+	})
+}
+
+// seal wraps body in a message of typ for to, listing a compliance attachment
+// so relays can route it without reading it
+func seal(w *wallet.Wallet, to *ecdsa.PublicKey, typ string, body interface{}) (*messaging.Envelope, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := messaging.NewMessage(typ, body)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return messaging.Seal(w, to, Topic, plaintext, messaging.Attachment{
+		Type: AttachmentCompliance,
+		Size: len(payload),
+		Hash: crypto.Keccak256Hash(payload),
+	})
+}
+
+// open decrypts a message of typ into v and checks it against the envelope's
+// compliance attachment
+func open(env *messaging.Envelope, key *ecdsa.PrivateKey, typ string, v interface{}) error {
+	msg, err := messaging.OpenMessage(env, key)
+	if err != nil {
+		return err
+	}
+	if msg.Type != typ {
+		return fmt.Errorf("travelrule: unexpected message type %q", msg.Type)
+	}
+	if err := msg.Decode(v); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	for _, a := range env.Attachments {
+		if a.Type == AttachmentCompliance && a.Hash == crypto.Keccak256Hash(payload) {
+			return nil
+		}
+	}
+	return errors.New("travelrule: message does not match the envelope attachment")
+}
+
+func outcome(accepted bool) string {
+	if accepted {
+		return "accepted"
+	}
+	return "rejected"
+}
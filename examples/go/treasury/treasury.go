@@ -0,0 +1,184 @@
+package treasury
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/approval"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/units"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Policy bounds automatic movements between tiers
+type Policy struct {
+	HotMin          units.Wei // top up when the hot balance falls below this
+	HotTarget       units.Wei // top-ups aim for this hot balance
+	MaxTopUp        units.Wei // largest single warm-to-hot transfer; zero is unlimited
+	DailyTopUpLimit units.Wei // total warm-to-hot transfers per UTC day; zero is unlimited
+	LargeWithdrawal units.Wei // withdrawals above this go through cold approval; zero never does
+}
+
+// Balances reports the ETH held in each tier
+type Balances struct {
+	Hot  units.Wei
+	Warm units.Wei
+	Cold units.Wei
+}
+
+// Total returns the sum of all tiers
+func (b *Balances) Total() units.Wei {
+	return b.Hot.Add(b.Warm).Add(b.Cold)
+}
+
+// Treasury keeps a hot wallet funded from a warm wallet and routes large
+// withdrawals through the approval workflow against the cold wallet
+type Treasury struct {
+	Hot       *wallet.Wallet
+	Warm      *wallet.Wallet
+	Cold      *wallet.Wallet     // offline or multisig-owner key; only signs after approval
+	Approvals *approval.Workflow // workflow whose wallet is Cold
+	Policy    Policy
+	Audit     audit.Log
+	Clock     clock.Clock // starts each day's top-up limit; nil is the wall clock
+
+	mu       sync.Mutex
+	day      string
+	toppedUp units.Wei
+}
+
+// New creates a treasury
+func New(hot, warm, cold *wallet.Wallet, approvals *approval.Workflow, policy Policy, auditLog audit.Log) (*Treasury, error) {
+	if policy.HotTarget.Cmp(policy.HotMin) < 0 {
+		return nil, errors.New("hot target must be at least the hot minimum")
+	}
+	if approvals != nil && approvals.Wallet.Address != cold.Address {
+		return nil, errors.New("approval workflow must use the cold wallet")
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Treasury{
+		Hot:       hot,
+		Warm:      warm,
+		Cold:      cold,
+		Approvals: approvals,
+		Policy:    policy,
+		Audit:     auditLog,
+	}, nil
+}
+
+// Balances returns the current balance of every tier
+func (t *Treasury) Balances(ctx context.Context) (*Balances, error) {
+	hot, err := t.Hot.GetBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	warm, err := t.Warm.GetBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := t.Cold.GetBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Balances{Hot: hot, Warm: warm, Cold: cold}, nil
+}
+
+// Rebalance tops up the hot wallet from the warm wallet when it is below the
+// minimum, within the per-transfer and daily limits. It returns nil when no
+// transfer was needed or allowed.
+func (t *Treasury) Rebalance(ctx context.Context) (*types.Transaction, error) {
+	hot, err := t.Hot.GetBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hot.Cmp(t.Policy.HotMin) >= 0 {
+		return nil, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	amount := t.Policy.HotTarget.Sub(hot)
+	if !t.Policy.MaxTopUp.IsZero() && amount.Cmp(t.Policy.MaxTopUp) > 0 {
+		amount = t.Policy.MaxTopUp
+	}
+
+	today := clock.Or(t.Clock).Now().UTC().Format("2006-01-02")
+	if t.day != today {
+		t.day = today
+		t.toppedUp = units.Wei{}
+	}
+	if !t.Policy.DailyTopUpLimit.IsZero() {
+		remaining := t.Policy.DailyTopUpLimit.Sub(t.toppedUp)
+		if remaining.Sign() <= 0 {
+			t.record(ctx, "treasury-topup", "", "limit-reached", amount)
+			return nil, nil
+		}
+		if amount.Cmp(remaining) > 0 {
+			amount = remaining
+		}
+	}
+
+	tx, err := t.Warm.Transfer(ctx, t.Hot.Address, amount)
+	if err != nil {
+		t.record(ctx, "treasury-topup", "", "error", amount)
+		return nil, err
+	}
+	t.toppedUp = t.toppedUp.Add(amount)
+	t.record(ctx, "treasury-topup", tx.Hash().Hex(), "sent", amount)
+	return tx, nil
+}
+
+// Withdraw pays out from the hot wallet, or for amounts above the large
+// withdrawal threshold signs from the cold wallet and submits the transaction
+// for approval. Exactly one of the returned values is non-nil on success.
+func (t *Treasury) Withdraw(ctx context.Context, to common.Address, amount units.Wei, reason string) (*types.Transaction, *approval.Request, error) {
+	if t.Policy.LargeWithdrawal.IsZero() || amount.Cmp(t.Policy.LargeWithdrawal) <= 0 {
+		tx, err := t.Hot.Transfer(ctx, to, amount)
+		if err != nil {
+			return nil, nil, err
+		}
+		t.record(ctx, "treasury-withdraw-hot", tx.Hash().Hex(), "sent", amount)
+		return tx, nil, nil
+	}
+
+	if t.Approvals == nil {
+		return nil, nil, errors.New("large withdrawal requires an approval workflow")
+	}
+	tx, err := t.Cold.SignTransfer(ctx, to, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := t.Approvals.Submit(ctx, tx, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.record(ctx, "treasury-withdraw-cold", tx.Hash().Hex(), string(req.Status), amount)
+	return nil, req, nil
+}
+
+// Schedule registers periodic rebalancing with a scheduler
+func (t *Treasury) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("treasury-rebalance", interval, func(ctx context.Context) error {
+		_, err := t.Rebalance(ctx)
+		return err
+	})
+}
+
+func (t *Treasury) record(ctx context.Context, action, subject, outcome string, amount units.Wei) {
+	t.Audit.Record(ctx, audit.Entry{
+		Actor:   "treasury",
+		Action:  action,
+		Subject: subject,
+		Outcome: outcome,
+		Details: map[string]string{"amount": amount.String()},
+	})
+}
@@ -0,0 +1,254 @@
+package txlint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/stablecoin"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// ErrRejected is returned when a transaction has a finding at or above the
+// linter's Block severity
+var ErrRejected = errors.New("txlint: transaction rejected")
+
+// Rule names a lint check
+type Rule string
+
+const (
+	// ValueToToken flags ETH sent to a token contract, which most tokens
+	// reject and the rest keep
+	ValueToToken Rule = "value-to-token"
+	// ApprovalToEOA flags an ERC-20 approval whose spender has no code; a
+	// spender is normally a contract, and approving an EOA is a common
+	// phishing request
+	ApprovalToEOA Rule = "approval-to-eoa"
+	// CallToEOA flags calldata sent to an address with no code, such as a
+	// token transfer addressed to the recipient instead of the token; it
+	// succeeds and does nothing
+	CallToEOA Rule = "calldata-to-eoa"
+	// Decimals flags a token amount that looks scaled by the wrong number of
+	// decimals, such as a USDC amount computed with 18
+	Decimals Rule = "decimals"
+	// WrongChain flags a call to a registry token address that is deployed on
+	// another chain but not on the transaction's
+	WrongChain Rule = "wrong-chain"
+)
+
+// Finding is one lint result
+type Finding struct {
+	Rule     Rule           `json:"rule"`
+	Severity alert.Severity `json:"severity"`
+	Detail   string         `json:"detail"`
+}
+
+// String formats the finding for logs and errors
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s: %s", f.Severity, f.Rule, f.Detail)
+}
+
+// Linter checks transactions for common mistakes before they are broadcast.
+// Rules that look up code are skipped without a client, so an offline
+// signer still gets the registry checks
+type Linter struct {
+	Client   *ethclient.Client
+	Registry *stablecoin.Registry
+	// Block is the severity at which Check rejects a transaction; zero is
+	// Critical
+	Block   alert.Severity
+	Timeout time.Duration // per check from the sign hook; zero is 10 seconds
+}
+
+// NewLinter creates a linter; a nil registry uses the default stablecoin
+// registry
+func NewLinter(client *ethclient.Client, registry *stablecoin.Registry) *Linter {
+	if registry == nil {
+		registry = stablecoin.DefaultRegistry()
+	}
+	return &Linter{Client: client, Registry: registry}
+}
+
+// Lint returns every finding for tx, most severe first. The transaction
+// must carry its chain ID, as signed transactions do
+func (l *Linter) Lint(ctx context.Context, tx *types.Transaction) ([]Finding, error) {
+	to := tx.To()
+	if to == nil {
+		return nil, nil // deployments have no recipient to check
+	}
+	var findings []Finding
+	add := func(rule Rule, sev alert.Severity, format string, args ...interface{}) {
+		findings = append(findings, Finding{Rule: rule, Severity: sev, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	chainID := uint64(0)
+	if id := tx.ChainId(); id != nil && id.IsUint64() {
+		chainID = id.Uint64()
+	}
+	token, known := l.Registry.ByAddress(chainID, *to)
+	if !known && chainID != 0 {
+		if elsewhere := l.deployments(*to); len(elsewhere) > 0 {
+			add(WrongChain, alert.Critical, "%s is %s on chain %s, not chain %d",
+				to.Hex(), elsewhere[0].Symbol, chains(elsewhere), chainID)
+		}
+	}
+
+	data := tx.Data()
+	method, spender, amount := decode(data)
+	if tx.Value().Sign() > 0 {
+		switch {
+		case known:
+			add(ValueToToken, alert.Critical, "sends %s wei to the %s contract", tx.Value(), token.Symbol)
+		case method != "":
+			add(ValueToToken, alert.Warning, "sends %s wei with an ERC-20 %s call", tx.Value(), method)
+		}
+	}
+	if known && amount != nil {
+		if detail := decimalsMismatch(token, amount); detail != "" {
+			add(Decimals, alert.Warning, "%s %s: %s", token.Symbol, method, detail)
+		}
+	}
+
+	if l.Client != nil {
+		if len(data) > 0 && !known {
+			code, err := l.Client.CodeAt(ctx, *to, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(code) == 0 {
+				add(CallToEOA, alert.Critical, "sends %d bytes of calldata to %s, which has no code", len(data), to.Hex())
+			}
+		}
+		if method == "approve" {
+			code, err := l.Client.CodeAt(ctx, spender, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(code) == 0 {
+				add(ApprovalToEOA, alert.Warning, "approves %s, which has no code", spender.Hex())
+			}
+		}
+	}
+
+	// most severe first, keeping rule order within a severity
+	for i := 1; i < len(findings); i++ {
+		for j := i; j > 0 && findings[j].Severity > findings[j-1].Severity; j-- {
+			findings[j], findings[j-1] = findings[j-1], findings[j]
+		}
+	}
+	return findings, nil
+}
+
+// Check lints tx and returns ErrRejected listing the findings at or above
+// Block
+func (l *Linter) Check(ctx context.Context, tx *types.Transaction) error {
+	findings, err := l.Lint(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("txlint: %w", err)
+	}
+	block := l.Block
+	if block == 0 {
+		block = alert.Critical
+	}
+	var blocking []string
+	for _, f := range findings {
+		if f.Severity >= block {
+			blocking = append(blocking, f.String())
+		}
+	}
+	if len(blocking) > 0 {
+		return fmt.Errorf("%w: %s", ErrRejected, strings.Join(blocking, "; "))
+	}
+	return nil
+}
+
+// Install lints every transaction the wallet signs, before any sign hook
+// already installed
+func (l *Linter) Install(w *wallet.Wallet) {
+	w.WrapSignHook(func(next wallet.SignHook) wallet.SignHook {
+		return func(tx *types.Transaction) error {
+			timeout := l.Timeout
+			if timeout <= 0 {
+				timeout = 10 * time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := l.Check(ctx, tx); err != nil {
+				return err
+			}
+			if next != nil {
+				return next(tx)
+			}
+			return nil
+		}
+	})
+}
+
+// deployments returns the registry tokens at addr on any chain
+func (l *Linter) deployments(addr common.Address) []stablecoin.Token {
+	var out []stablecoin.Token
+	for _, t := range l.Registry.Tokens {
+		if t.Address == addr {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// decode returns the ERC-20 method, the approved spender and the amount of a
+// transfer, transferFrom or approve call, or an empty method for other data
+func decode(data []byte) (method string, spender common.Address, amount *big.Int) {
+	if _, amount, ok := contract.DecodeTransfer(data); ok {
+		return "transfer", common.Address{}, amount
+	}
+	if spender, amount, ok := contract.DecodeApprove(data); ok {
+		return "approve", spender, amount
+	}
+	if _, _, amount, ok := contract.DecodeTransferFrom(data); ok {
+		return "transferFrom", common.Address{}, amount
+	}
+	return "", common.Address{}, nil
+}
+
+// unlimited is the threshold above which an approval is treated as
+// unlimited rather than an amount
+var unlimited = new(big.Int).Lsh(big.NewInt(1), 255)
+
+// decimalsMismatch describes an amount that looks computed for 18 decimals
+// on a token with fewer, or for 6 decimals on an 18-decimal token. Both
+// heuristics need the amount to be a whole multiple of the suspected scale,
+// which real amounts rarely are by accident
+func decimalsMismatch(t stablecoin.Token, amount *big.Int) string {
+	if amount.Sign() == 0 || amount.Cmp(unlimited) >= 0 {
+		return ""
+	}
+	pow := func(n uint8) *big.Int { return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil) }
+	if t.Decimals < 18 {
+		// over 10^11 whole tokens is more than any stablecoin's supply
+		if amount.Cmp(pow(t.Decimals+11)) > 0 && new(big.Int).Mod(amount, pow(18-t.Decimals)).Sign() == 0 {
+			return fmt.Sprintf("%s looks scaled by 18 decimals, not %d", t.Format(amount), t.Decimals)
+		}
+		return ""
+	}
+	// under a millionth of a token, and a whole number of 6-decimal units
+	if amount.Cmp(pow(t.Decimals-6)) < 0 && new(big.Int).Mod(amount, pow(6)).Sign() == 0 {
+		return fmt.Sprintf("%s looks scaled by 6 decimals, not %d", t.Format(amount), t.Decimals)
+	}
+	return ""
+}
+
+func chains(tokens []stablecoin.Token) string {
+	ids := make([]string, len(tokens))
+	for i, t := range tokens {
+		ids[i] = fmt.Sprint(t.ChainID)
+	}
+	return strings.Join(ids, ", ")
+}
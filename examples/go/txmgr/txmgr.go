@@ -0,0 +1,272 @@
+package txmgr
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/conn"
+	"github.com/whisperchain/go-examples/reqctx"
+)
+
+// maxIdempotencyKeys bounds how many sends are remembered for deduplication
+const maxIdempotencyKeys = 4096
+
+// ErrKeyReused is returned when an idempotency key is retried for a
+// different transaction than the one it was first used for
+var ErrKeyReused = errors.New("txmgr: idempotency key already used for a different transaction")
+
+// SignFunc signs a transaction for the sending account
+type SignFunc func(tx *types.Transaction) (*types.Transaction, error)
+
+// BuildFunc creates the unsigned transaction to send at nonce
+type BuildFunc func(nonce uint64) (*types.Transaction, error)
+
+// CheckFunc is called with each signed transaction before Send broadcasts
+// it; an error stops the send without using the nonce
+type CheckFunc func(ctx context.Context, tx *types.Transaction) error
+
+// Config controls waiting and replacement
+type Config struct {
+	Confirmations   uint64        // blocks including the receipt's; at least 1
+	PollInterval    time.Duration // receipt polling interval without a head subscription
+	StuckAfter      time.Duration // replace a transaction not mined within this; zero never replaces
+	FeeBump         int64         // percent added to fees on replacement; nodes require at least 10
+	MaxFeeCap       *big.Int      // replacements stop at this fee cap or gas price
+	MaxReplacements int
+	Timeout         time.Duration // give up waiting after this; zero waits until ctx is done
+}
+
+// DefaultConfig waits for one confirmation and speeds up transactions stuck
+// for three minutes by 15%, at most five times
+func DefaultConfig() Config {
+	return Config{
+		Confirmations:   1,
+		PollInterval:    2 * time.Second,
+		StuckAfter:      3 * time.Minute,
+		FeeBump:         15,
+		MaxReplacements: 5,
+	}
+}
+
+// Manager serializes sends per account with a local nonce tracker, waits for
+// receipts and replaces stuck transactions
+type Manager struct {
+	Client *ethclient.Client
+	// Conn, when set, supplies the client on first use instead of Client
+	Conn   *conn.Conn
+	Config Config
+	Clock  clock.Clock // nil is the wall clock
+
+	mu       sync.Mutex
+	check    CheckFunc
+	accounts map[common.Address]*account
+	sent     map[string]sentTx // by idempotency key
+	sentKeys []string          // in insertion order, for eviction
+}
+
+// sentTx is a transaction sent under an idempotency key and the fingerprint
+// of the request it was built for
+type sentTx struct {
+	tx          *types.Transaction
+	fingerprint common.Hash
+}
+
+// account tracks the next nonce of one sender; mu is held for the whole of
+// build, sign and send so concurrent sends get consecutive nonces
+type account struct {
+	mu     sync.Mutex
+	next   uint64
+	synced bool
+}
+
+// New creates a manager with DefaultConfig
+func New(client *ethclient.Client) *Manager {
+	return &Manager{Client: client, Config: DefaultConfig(), accounts: make(map[common.Address]*account)}
+}
+
+// NewConn creates a manager with DefaultConfig whose client is resolved
+// through c when first needed, so creating it does not contact the node
+func NewConn(c *conn.Conn) *Manager {
+	return &Manager{Conn: c, Config: DefaultConfig(), accounts: make(map[common.Address]*account)}
+}
+
+func (m *Manager) client(ctx context.Context) (*ethclient.Client, error) {
+	if m.Conn != nil {
+		return m.Conn.Client(ctx)
+	}
+	return m.Client, nil
+}
+
+// Fingerprint identifies what a transaction does, its recipient, value and
+// calldata, but not its nonce, gas or fees; to is nil for a deployment
+func Fingerprint(to *common.Address, value *big.Int, data []byte) common.Hash {
+	b := []byte{0}
+	if to != nil {
+		b = append([]byte{1}, to.Bytes()...)
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	b = append(b, common.BigToHash(value).Bytes()...)
+	return crypto.Keccak256Hash(b, data)
+}
+
+// Send builds a transaction at the account's next nonce, signs and broadcasts
+// it. The nonce is only consumed when the node accepts the transaction. When
+// ctx carries an idempotency key, a retried send with the same key, tenant
+// and sender returns the transaction already sent instead of sending again,
+// or ErrKeyReused if fingerprint, the Fingerprint of what build creates,
+// differs from the first send's
+func (m *Manager) Send(ctx context.Context, from common.Address, fingerprint common.Hash, build BuildFunc, sign SignFunc) (*types.Transaction, error) {
+	acct := m.account(from)
+	acct.mu.Lock()
+	defer acct.mu.Unlock()
+
+	key := idempotencyKey(ctx, from)
+	if sent, ok := m.sentFor(key); ok {
+		if sent.fingerprint != fingerprint {
+			return nil, ErrKeyReused
+		}
+		return sent.tx, nil
+	}
+
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		if !acct.synced {
+			nonce, err := client.PendingNonceAt(ctx, from)
+			if err != nil {
+				return nil, err
+			}
+			acct.next, acct.synced = nonce, true
+		}
+		tx, err := build(acct.next)
+		if err != nil {
+			return nil, err
+		}
+		signedTx, err := sign(tx)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Check(ctx, signedTx); err != nil {
+			return nil, err
+		}
+		err = client.SendTransaction(ctx, signedTx)
+		if err == nil {
+			acct.next++
+			m.remember(key, sentTx{tx: signedTx, fingerprint: fingerprint})
+			return signedTx, nil
+		}
+		// Something else used the nonce; resync once and retry
+		if isNonceTooLow(err) && attempt == 0 {
+			acct.synced = false
+			continue
+		}
+		acct.synced = false
+		return nil, err
+	}
+}
+
+// WrapCheck replaces the pre-broadcast check with wrap applied to the
+// current one, which may be nil
+func (m *Manager) WrapCheck(wrap func(next CheckFunc) CheckFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.check = wrap(m.check)
+}
+
+// Check runs the pre-broadcast check, if any; code that broadcasts a
+// transaction for an account the manager serves without going through Send
+// should call it first
+func (m *Manager) Check(ctx context.Context, tx *types.Transaction) error {
+	m.mu.Lock()
+	check := m.check
+	m.mu.Unlock()
+	if check == nil {
+		return nil
+	}
+	return check(ctx, tx)
+}
+
+// Reset drops the tracked nonce so the next send reads it from the node
+func (m *Manager) Reset(from common.Address) {
+	acct := m.account(from)
+	acct.mu.Lock()
+	defer acct.mu.Unlock()
+	acct.synced = false
+}
+
+// SendAndWait sends a transaction and waits for it, replacing it if stuck
+func (m *Manager) SendAndWait(ctx context.Context, from common.Address, fingerprint common.Hash, build BuildFunc, sign SignFunc) (*types.Receipt, error) {
+	tx, err := m.Send(ctx, from, fingerprint, build, sign)
+	if err != nil {
+		return nil, err
+	}
+	return m.Wait(ctx, from, tx, sign)
+}
+
+func (m *Manager) account(from common.Address) *account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts == nil {
+		m.accounts = make(map[common.Address]*account)
+	}
+	acct, ok := m.accounts[from]
+	if !ok {
+		acct = &account{}
+		m.accounts[from] = acct
+	}
+	return acct
+}
+
+// idempotencyKey scopes the idempotency key of ctx to its tenant and the
+// sender; it is empty when ctx has no key
+func idempotencyKey(ctx context.Context, from common.Address) string {
+	md := reqctx.FromContext(ctx)
+	if md.IdempotencyKey == "" {
+		return ""
+	}
+	return md.Tenant + "\x00" + from.Hex() + "\x00" + md.IdempotencyKey
+}
+
+func (m *Manager) sentFor(key string) (sentTx, bool) {
+	if key == "" {
+		return sentTx{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sent, ok := m.sent[key]
+	return sent, ok
+}
+
+func (m *Manager) remember(key string, sent sentTx) {
+	if key == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sent == nil {
+		m.sent = make(map[string]sentTx)
+	}
+	if len(m.sentKeys) >= maxIdempotencyKeys {
+		delete(m.sent, m.sentKeys[0])
+		m.sentKeys = m.sentKeys[1:]
+	}
+	m.sent[key] = sent
+	m.sentKeys = append(m.sentKeys, key)
+}
+
+func isNonceTooLow(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
@@ -0,0 +1,274 @@
+package txmgr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/clock"
+)
+
+// simulatedEth is an in-process node with a transaction pool. Like a real
+// node it checks each transaction's signature and chain, rejects a nonce
+// that is already mined or leaves a gap, and replaces a pooled transaction
+// only for 10% more in fees. A transaction is mined as soon as it pays at
+// least minPrice; cheaper ones wait in the pool. Nonce reads take a
+// millisecond, as a remote node's would, to widen races between senders
+type simulatedEth struct {
+	mu       sync.Mutex
+	chainID  *big.Int
+	minPrice *big.Int
+	mined    map[common.Address]uint64
+	pool     map[common.Address]map[uint64]*types.Transaction
+	receipts map[common.Hash]*types.Receipt
+	head     uint64
+	sent     []*types.Transaction
+}
+
+func (s *simulatedEth) ChainId() *hexutil.Big { return (*hexutil.Big)(s.chainID) }
+
+func (s *simulatedEth) GetTransactionCount(addr common.Address, block string) hexutil.Uint64 {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if block == "pending" {
+		return hexutil.Uint64(s.pending(addr))
+	}
+	return hexutil.Uint64(s.mined[addr])
+}
+
+func (s *simulatedEth) BlockNumber() hexutil.Uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return hexutil.Uint64(s.head)
+}
+
+func (s *simulatedEth) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.receipts[hash]
+}
+
+func (s *simulatedEth) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Hash{}, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(s.chainID), tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tx.Nonce() < s.mined[from] {
+		return common.Hash{}, fmt.Errorf("nonce too low: address %s, tx: %d state: %d", from.Hex(), tx.Nonce(), s.mined[from])
+	}
+	if next := s.pending(from); tx.Nonce() > next {
+		return common.Hash{}, fmt.Errorf("nonce too high: address %s, tx: %d state: %d", from.Hex(), tx.Nonce(), next)
+	}
+	if old, ok := s.pool[from][tx.Nonce()]; ok {
+		floor := new(big.Int).Mul(old.GasPrice(), big.NewInt(110))
+		if new(big.Int).Mul(tx.GasPrice(), big.NewInt(100)).Cmp(floor) < 0 {
+			return common.Hash{}, errors.New("replacement transaction underpriced")
+		}
+	}
+	if s.pool[from] == nil {
+		s.pool[from] = make(map[uint64]*types.Transaction)
+	}
+	s.pool[from][tx.Nonce()] = tx
+	s.sent = append(s.sent, tx)
+	s.mine(from)
+	return tx.Hash(), nil
+}
+
+// pending returns the nonce after from's pooled transactions; s.mu must be
+// held
+func (s *simulatedEth) pending(from common.Address) uint64 {
+	next := s.mined[from]
+	for {
+		if _, ok := s.pool[from][next]; !ok {
+			return next
+		}
+		next++
+	}
+}
+
+// mine includes from's pooled transactions, in nonce order, while they pay
+// minPrice; s.mu must be held
+func (s *simulatedEth) mine(from common.Address) {
+	for {
+		tx, ok := s.pool[from][s.mined[from]]
+		if !ok || tx.GasPrice().Cmp(s.minPrice) < 0 {
+			return
+		}
+		delete(s.pool[from], tx.Nonce())
+		s.mined[from]++
+		s.head++
+		s.receipts[tx.Hash()] = &types.Receipt{
+			Status:      types.ReceiptStatusSuccessful,
+			Logs:        []*types.Log{},
+			TxHash:      tx.Hash(),
+			BlockHash:   common.BigToHash(new(big.Int).SetUint64(s.head)),
+			BlockNumber: new(big.Int).SetUint64(s.head),
+		}
+	}
+}
+
+// newSimulated returns a manager and a key on a simulated node that mines
+// transactions paying at least minGwei
+func newSimulated(t *testing.T, minGwei int64) (*Manager, *ecdsa.PrivateKey, *simulatedEth) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &simulatedEth{
+		chainID:  big.NewInt(1337),
+		minPrice: gwei(minGwei),
+		mined:    make(map[common.Address]uint64),
+		pool:     make(map[common.Address]map[uint64]*types.Transaction),
+		receipts: make(map[common.Hash]*types.Receipt),
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+	client := ethclient.NewClient(rpc.DialInProc(srv))
+	t.Cleanup(client.Close)
+	return New(client), key, node
+}
+
+func gwei(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9)) }
+
+var to = common.HexToAddress("0x000000000000000000000000000000000000beef")
+
+// transfer builds a legacy value transfer at the given gas price
+func transfer(price *big.Int) BuildFunc {
+	return func(nonce uint64) (*types.Transaction, error) {
+		return types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: price, Gas: 21000, To: &to, Value: big.NewInt(1)}), nil
+	}
+}
+
+func signer(key *ecdsa.PrivateKey, chainID *big.Int) SignFunc {
+	return func(tx *types.Transaction) (*types.Transaction, error) {
+		return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+	}
+}
+
+func TestConcurrentSendsGetConsecutiveNonces(t *testing.T) {
+	ctx := context.Background()
+	m, key, node := newSimulated(t, 1)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	sign := signer(key, node.chainID)
+	fp := Fingerprint(&to, big.NewInt(1), nil)
+
+	// A send that fails before broadcast consumes no nonce
+	if _, err := m.Send(ctx, from, fp, transfer(gwei(10)), func(*types.Transaction) (*types.Transaction, error) {
+		return nil, errors.New("signer unavailable")
+	}); err == nil {
+		t.Fatal("send succeeded without a signature")
+	}
+
+	const senders, each = 8, 5
+	var wg sync.WaitGroup
+	errs := make(chan error, senders*each)
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				if _, err := m.Send(ctx, from, fp, transfer(gwei(10)), sign); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if len(node.sent) != senders*each {
+		t.Fatalf("node got %d transactions, want %d", len(node.sent), senders*each)
+	}
+	for i, tx := range node.sent {
+		if tx.Nonce() != uint64(i) {
+			t.Fatalf("transaction %d has nonce %d", i, tx.Nonce())
+		}
+	}
+	if node.mined[from] != senders*each {
+		t.Fatalf("%d mined", node.mined[from])
+	}
+}
+
+func TestStuckTransactionReplacedWithBumpedFee(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 10 gwei stays pooled; the 15% bump to 11.5 gwei is mined
+	m, key, node := newSimulated(t, 11)
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+	m.Clock = clk
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	sign := signer(key, node.chainID)
+
+	tx, err := m.Send(ctx, from, Fingerprint(&to, big.NewInt(1), nil), transfer(gwei(10)), sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		rcpt *types.Receipt
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rcpt, err := m.Wait(ctx, from, tx, sign)
+		done <- result{rcpt, err}
+	}()
+
+	var r result
+	for waiting := true; waiting; {
+		select {
+		case r = <-done:
+			waiting = false
+		case <-time.After(time.Millisecond):
+			clk.Advance(time.Minute)
+		}
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if len(node.sent) != 2 {
+		t.Fatalf("node got %d transactions, want the original and one replacement", len(node.sent))
+	}
+	replacement := node.sent[1]
+	if r.rcpt.TxHash != replacement.Hash() {
+		t.Fatalf("receipt for %s, want the replacement %s", r.rcpt.TxHash, replacement.Hash())
+	}
+	if replacement.Nonce() != tx.Nonce() {
+		t.Fatalf("replacement nonce %d, want %d", replacement.Nonce(), tx.Nonce())
+	}
+	if want := new(big.Int).Div(gwei(115), big.NewInt(10)); replacement.GasPrice().Cmp(want) != 0 {
+		t.Fatalf("replacement gas price %s, want %s", replacement.GasPrice(), want)
+	}
+	if _, ok := node.receipts[tx.Hash()]; ok {
+		t.Fatal("the stuck transaction was mined")
+	}
+}
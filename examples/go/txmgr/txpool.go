@@ -0,0 +1,194 @@
+package txmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// poolPriceBump is the percent by which a node requires a replacement's fees
+// to exceed the pooled transaction's; geth's --txpool.pricebump default
+const poolPriceBump = 10
+
+// ErrNotInPool is returned when the node's pool holds nothing at a nonce
+var ErrNotInPool = errors.New("txmgr: no pooled transaction at nonce")
+
+// PoolTx is a transaction as reported by the txpool namespace
+type PoolTx struct {
+	Hash      common.Hash     `json:"hash"`
+	From      common.Address  `json:"from"`
+	To        *common.Address `json:"to"`
+	Nonce     hexutil.Uint64  `json:"nonce"`
+	Type      hexutil.Uint64  `json:"type"`
+	Gas       hexutil.Uint64  `json:"gas"`
+	GasPrice  *hexutil.Big    `json:"gasPrice"`
+	GasFeeCap *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	GasTipCap *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Value     *hexutil.Big    `json:"value"`
+	Input     hexutil.Bytes   `json:"input"`
+}
+
+// PoolTxs maps nonces to one account's pooled transactions
+type PoolTxs map[uint64]*PoolTx
+
+// PoolContent is the node's pool: pending transactions are executable now,
+// queued ones wait on a nonce gap
+type PoolContent struct {
+	Pending map[common.Address]PoolTxs
+	Queued  map[common.Address]PoolTxs
+}
+
+// PoolStatus counts the transactions in the node's pool
+type PoolStatus struct {
+	Pending uint64
+	Queued  uint64
+}
+
+// PoolState is where a transaction sits in the node's pool
+type PoolState string
+
+const (
+	PoolPending PoolState = "pending"
+	PoolQueued  PoolState = "queued"
+	PoolMissing PoolState = "missing" // mined, dropped or never seen
+)
+
+// Fees is the minimum a replacement must pay. GasPrice is set for legacy
+// transactions, GasTipCap and GasFeeCap for dynamic fee ones
+type Fees struct {
+	GasPrice  *big.Int
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+}
+
+// TxPoolStatus calls txpool_status
+func TxPoolStatus(ctx context.Context, client *ethclient.Client) (*PoolStatus, error) {
+	var raw struct {
+		Pending hexutil.Uint `json:"pending"`
+		Queued  hexutil.Uint `json:"queued"`
+	}
+	if err := client.Client().CallContext(ctx, &raw, "txpool_status"); err != nil {
+		return nil, err
+	}
+	return &PoolStatus{Pending: uint64(raw.Pending), Queued: uint64(raw.Queued)}, nil
+}
+
+// TxPoolContent calls txpool_content. On busy nodes the result is large;
+// prefer TxPoolContentFrom for a single account
+func TxPoolContent(ctx context.Context, client *ethclient.Client) (*PoolContent, error) {
+	var raw map[string]map[common.Address]map[string]*PoolTx
+	if err := client.Client().CallContext(ctx, &raw, "txpool_content"); err != nil {
+		return nil, err
+	}
+	content := &PoolContent{
+		Pending: make(map[common.Address]PoolTxs),
+		Queued:  make(map[common.Address]PoolTxs),
+	}
+	for addr, txs := range raw["pending"] {
+		parsed, err := parsePoolTxs(txs)
+		if err != nil {
+			return nil, err
+		}
+		content.Pending[addr] = parsed
+	}
+	for addr, txs := range raw["queued"] {
+		parsed, err := parsePoolTxs(txs)
+		if err != nil {
+			return nil, err
+		}
+		content.Queued[addr] = parsed
+	}
+	return content, nil
+}
+
+// TxPoolContentFrom returns the pending and queued transactions of one
+// account, falling back to txpool_content on nodes without
+// txpool_contentFrom
+func TxPoolContentFrom(ctx context.Context, client *ethclient.Client, from common.Address) (pending, queued PoolTxs, err error) {
+	var raw map[string]map[string]*PoolTx
+	if err := client.Client().CallContext(ctx, &raw, "txpool_contentFrom", from); err == nil {
+		if pending, err = parsePoolTxs(raw["pending"]); err != nil {
+			return nil, nil, err
+		}
+		queued, err = parsePoolTxs(raw["queued"])
+		return pending, queued, err
+	}
+	content, err := TxPoolContent(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content.Pending[from], content.Queued[from], nil
+}
+
+// InPool reports where hash sits in the node's pool of from's transactions
+func (m *Manager) InPool(ctx context.Context, from common.Address, hash common.Hash) (PoolState, error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	pending, queued, err := TxPoolContentFrom(ctx, client, from)
+	if err != nil {
+		return "", err
+	}
+	for _, tx := range pending {
+		if tx.Hash == hash {
+			return PoolPending, nil
+		}
+	}
+	for _, tx := range queued {
+		if tx.Hash == hash {
+			return PoolQueued, nil
+		}
+	}
+	return PoolMissing, nil
+}
+
+// ReplacementFloor returns the lowest fees the node will accept to replace
+// whatever it holds at from's nonce, which may not be the transaction this
+// manager sent. It returns ErrNotInPool when the nonce is free
+func (m *Manager) ReplacementFloor(ctx context.Context, from common.Address, nonce uint64) (*Fees, error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending, queued, err := TxPoolContentFrom(ctx, client, from)
+	if err != nil {
+		return nil, err
+	}
+	tx, ok := pending[nonce]
+	if !ok {
+		if tx, ok = queued[nonce]; !ok {
+			return nil, fmt.Errorf("%w: %d", ErrNotInPool, nonce)
+		}
+	}
+	floor := func(v *hexutil.Big) *big.Int {
+		if v == nil {
+			return nil
+		}
+		out := new(big.Int).Mul(v.ToInt(), big.NewInt(100+poolPriceBump))
+		out.Add(out, big.NewInt(99))
+		return out.Div(out, big.NewInt(100))
+	}
+	if tx.GasFeeCap != nil {
+		return &Fees{GasTipCap: floor(tx.GasTipCap), GasFeeCap: floor(tx.GasFeeCap)}, nil
+	}
+	return &Fees{GasPrice: floor(tx.GasPrice)}, nil
+}
+
+func parsePoolTxs(raw map[string]*PoolTx) (PoolTxs, error) {
+	txs := make(PoolTxs, len(raw))
+	for key, tx := range raw {
+		nonce, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("txmgr: bad pool nonce %q: %w", key, err)
+		}
+		txs[nonce] = tx
+	}
+	return txs, nil
+}
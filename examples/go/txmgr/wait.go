@@ -0,0 +1,306 @@
+package txmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/clock"
+)
+
+// ErrNonceUsed is returned when the nonce was consumed by a transaction that
+// is not one of the tracked versions
+var ErrNonceUsed = errors.New("txmgr: nonce used by another transaction")
+
+// errFeeCapReached stops replacement without failing the wait
+var errFeeCapReached = errors.New("txmgr: replacement would exceed the fee cap")
+
+// WaitMined waits until the transaction's receipt is confirmations blocks
+// deep. It returns early only when ctx is done
+func WaitMined(ctx context.Context, client *ethclient.Client, hash common.Hash, confirmations uint64, poll time.Duration) (*types.Receipt, error) {
+	m := &Manager{Client: client, Config: Config{Confirmations: confirmations, PollInterval: poll}}
+	return m.WaitHash(ctx, hash)
+}
+
+// WaitHash waits until a transaction's receipt is Confirmations blocks deep,
+// polling on the manager's clock. Unlike Wait it never replaces the
+// transaction
+func (m *Manager) WaitHash(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return m.wait(ctx, common.Address{}, nil, []common.Hash{hash}, nil)
+}
+
+// Wait waits for tx, or a replacement of it, to be confirmed. Transactions
+// not mined within StuckAfter are re-signed with fees bumped by FeeBump
+func (m *Manager) Wait(ctx context.Context, from common.Address, tx *types.Transaction, sign SignFunc) (*types.Receipt, error) {
+	return m.wait(ctx, from, tx, []common.Hash{tx.Hash()}, sign)
+}
+
+// wait polls for any of hashes; with tx and sign set it also replaces the
+// transaction when stuck and detects its nonce being used elsewhere
+func (m *Manager) wait(ctx context.Context, from common.Address, tx *types.Transaction, hashes []common.Hash, sign SignFunc) (*types.Receipt, error) {
+	confirmations := m.Config.Confirmations
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	if m.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = clock.WithTimeout(ctx, m.Clock, m.Config.Timeout)
+		defer cancel()
+	}
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ticks, stop := m.ticks(ctx, client)
+	defer stop()
+
+	current := tx
+	lastSent := clock.Or(m.Clock).Now()
+	replacements := 0
+	for {
+		rcpt, err := receipt(ctx, client, hashes)
+		if err != nil {
+			return nil, err
+		}
+		if rcpt != nil {
+			done, err := confirmed(ctx, client, rcpt, confirmations)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				return rcpt, nil
+			}
+		} else if current != nil {
+			mined, err := client.NonceAt(ctx, from, nil)
+			if err != nil {
+				return nil, err
+			}
+			if mined > current.Nonce() {
+				// One of ours may have been mined since the receipt check
+				if rcpt, err := receipt(ctx, client, hashes); err != nil || rcpt != nil {
+					if err != nil {
+						return nil, err
+					}
+					continue
+				}
+				return nil, fmt.Errorf("%w: nonce %d", ErrNonceUsed, current.Nonce())
+			}
+
+			if sign != nil && m.Config.StuckAfter > 0 && replacements < m.Config.MaxReplacements &&
+				clock.Since(m.Clock, lastSent) >= m.Config.StuckAfter {
+				replaced, err := m.replace(ctx, from, current, sign)
+				switch {
+				case errors.Is(err, errFeeCapReached):
+					replacements = m.Config.MaxReplacements
+				case err != nil:
+					return nil, err
+				case replaced != nil:
+					hashes = append(hashes, replaced.Hash())
+					current = replaced
+					lastSent = clock.Or(m.Clock).Now()
+					replacements++
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticks:
+		}
+	}
+}
+
+// receipt returns the first receipt found for hashes, or nil
+func receipt(ctx context.Context, client *ethclient.Client, hashes []common.Hash) (*types.Receipt, error) {
+	for _, h := range hashes {
+		rcpt, err := client.TransactionReceipt(ctx, h)
+		if err == nil {
+			return rcpt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// confirmed reports whether rcpt is deep enough and still canonical
+func confirmed(ctx context.Context, client *ethclient.Client, rcpt *types.Receipt, confirmations uint64) (bool, error) {
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	if head+1 < rcpt.BlockNumber.Uint64()+confirmations {
+		return false, nil
+	}
+	if confirmations == 1 {
+		return true, nil
+	}
+	// Refetch in case the block was reorged out while waiting
+	again, err := client.TransactionReceipt(ctx, rcpt.TxHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return again.BlockHash == rcpt.BlockHash, nil
+}
+
+// replace re-signs tx with bumped fees and broadcasts it. It returns nil
+// without error when the node reports the nonce as already mined. Fees are
+// raised to the pool's replacement floor when the node exposes its pool, so
+// the replacement is not rejected as underpriced
+func (m *Manager) replace(ctx context.Context, from common.Address, tx *types.Transaction, sign SignFunc) (*types.Transaction, error) {
+	floor, err := m.ReplacementFloor(ctx, from, tx.Nonce())
+	if err != nil {
+		// No txpool namespace, or nothing pooled at the nonce
+		floor = nil
+	}
+	bumped, err := m.bump(tx, floor)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := sign(bumped)
+	if err != nil {
+		return nil, err
+	}
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, signedTx); err != nil {
+		if isNonceTooLow(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+// bump copies tx with fees raised by FeeBump percent, rounded up, and to at
+// least floor when set
+func (m *Manager) bump(tx *types.Transaction, floor *Fees) (*types.Transaction, error) {
+	pct := m.Config.FeeBump
+	if pct < 10 {
+		pct = 10
+	}
+	inc := func(v *big.Int) *big.Int {
+		out := new(big.Int).Mul(v, big.NewInt(100+pct))
+		out.Add(out, big.NewInt(99))
+		return out.Div(out, big.NewInt(100))
+	}
+	atLeast := func(v, min *big.Int) *big.Int {
+		if min != nil && v.Cmp(min) < 0 {
+			return new(big.Int).Set(min)
+		}
+		return v
+	}
+	if floor == nil {
+		floor = &Fees{}
+	}
+	overCap := func(v *big.Int) bool {
+		return m.Config.MaxFeeCap != nil && v.Cmp(m.Config.MaxFeeCap) > 0
+	}
+
+	switch tx.Type() {
+	case types.LegacyTxType:
+		price := atLeast(inc(tx.GasPrice()), floor.GasPrice)
+		if overCap(price) {
+			return nil, errFeeCapReached
+		}
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: price,
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+		}), nil
+	case types.DynamicFeeTxType:
+		feeCap := atLeast(inc(tx.GasFeeCap()), floor.GasFeeCap)
+		if overCap(feeCap) {
+			return nil, errFeeCapReached
+		}
+		tipCap := atLeast(inc(tx.GasTipCap()), floor.GasTipCap)
+		if tipCap.Cmp(feeCap) > 0 {
+			tipCap = feeCap
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			GasTipCap:  tipCap,
+			GasFeeCap:  feeCap,
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		}), nil
+	}
+	return nil, fmt.Errorf("txmgr: cannot replace transaction type %d", tx.Type())
+}
+
+// ticks fires on every new head when the client supports subscriptions and
+// every PollInterval regardless, in case the subscription drops. With a Conn
+// the subscription is made through it, so closing the Conn ends it
+func (m *Manager) ticks(ctx context.Context, client *ethclient.Client) (<-chan struct{}, func()) {
+	poll := m.Config.PollInterval
+	if poll <= 0 {
+		poll = 2 * time.Second
+	}
+	out := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(ctx)
+
+	// HTTP endpoints cannot subscribe and are polled only
+	heads := make(chan *types.Header, 1)
+	var (
+		sub ethereum.Subscription
+		err error
+	)
+	if m.Conn != nil {
+		sub, err = m.Conn.Subscribe(ctx, func(c *ethclient.Client) (ethereum.Subscription, error) {
+			return c.SubscribeNewHead(ctx, heads)
+		})
+	} else {
+		sub, err = client.SubscribeNewHead(ctx, heads)
+	}
+	if err != nil {
+		sub = nil
+	}
+
+	go func() {
+		ticker := clock.Or(m.Clock).NewTicker(poll)
+		defer ticker.Stop()
+		var subErr <-chan error
+		if sub != nil {
+			defer sub.Unsubscribe()
+			subErr = sub.Err()
+		} else {
+			heads = nil
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			case <-heads:
+			case <-subErr:
+				heads, subErr = nil, nil
+				continue
+			}
+			select {
+			case out <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return out, cancel
+}
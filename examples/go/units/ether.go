@@ -0,0 +1,243 @@
+package units
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Decimals of the ether denominations
+const (
+	GweiDecimals  = 9
+	EtherDecimals = 18
+)
+
+// Wei is an amount of ether in its base unit. Values are immutable: the
+// arithmetic methods return new values and never alias their operands. The
+// zero value is zero wei
+type Wei struct {
+	v *big.Int
+}
+
+// NewWei wraps a base-unit amount, copying it; nil is zero
+func NewWei(v *big.Int) Wei {
+	return Wei{v: copyInt(v)}
+}
+
+// WeiFromUint64 returns n wei
+func WeiFromUint64(n uint64) Wei {
+	return Wei{v: new(big.Int).SetUint64(n)}
+}
+
+// ParseWei parses a decimal count of wei, as stored in JSON and CSV
+func ParseWei(s string) (Wei, error) {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return Wei{}, fmt.Errorf("%w: %s", ErrInvalidAmount, s)
+	}
+	return Wei{v: v}, nil
+}
+
+// Big returns the amount as a new *big.Int, for go-ethereum APIs
+func (w Wei) Big() *big.Int {
+	return copyInt(w.v)
+}
+
+func (w Wei) int() *big.Int {
+	if w.v == nil {
+		return new(big.Int)
+	}
+	return w.v
+}
+
+// Add returns w + o
+func (w Wei) Add(o Wei) Wei {
+	return Wei{v: new(big.Int).Add(w.int(), o.int())}
+}
+
+// Sub returns w - o, which is negative when o is larger
+func (w Wei) Sub(o Wei) Wei {
+	return Wei{v: new(big.Int).Sub(w.int(), o.int())}
+}
+
+// Mul returns w * n, such as a gas price times a gas limit
+func (w Wei) Mul(n uint64) Wei {
+	return Wei{v: new(big.Int).Mul(w.int(), new(big.Int).SetUint64(n))}
+}
+
+// Cmp compares w and o, returning -1, 0 or +1
+func (w Wei) Cmp(o Wei) int {
+	return w.int().Cmp(o.int())
+}
+
+// Sign returns -1, 0 or +1
+func (w Wei) Sign() int {
+	return w.int().Sign()
+}
+
+// IsZero reports whether w is zero
+func (w Wei) IsZero() bool {
+	return w.Sign() == 0
+}
+
+// Amount returns w as an amount of Native, for APIs that take any asset
+func (w Wei) Amount() TokenAmount {
+	return NewTokenAmount(Native, w.v)
+}
+
+// Gwei returns w in gwei; the conversion is exact
+func (w Wei) Gwei() Gwei {
+	return Gwei{wei: w.Big()}
+}
+
+// Ether returns w in ether; the conversion is exact
+func (w Wei) Ether() Ether {
+	return Ether{wei: w.Big()}
+}
+
+// String returns the decimal count of wei
+func (w Wei) String() string {
+	return w.int().String()
+}
+
+// MarshalText encodes the decimal count of wei
+func (w Wei) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+// UnmarshalText decodes a decimal count of wei
+func (w *Wei) UnmarshalText(data []byte) error {
+	v, err := ParseWei(string(data))
+	if err != nil {
+		return err
+	}
+	*w = v
+	return nil
+}
+
+// Gwei is an amount of ether denominated in gwei, as gas prices are quoted.
+// It is held in wei, so fractional gwei are exact
+type Gwei struct {
+	wei *big.Int
+}
+
+// GweiFromUint64 returns n gwei
+func GweiFromUint64(n uint64) Gwei {
+	return Gwei{wei: new(big.Int).Mul(new(big.Int).SetUint64(n), pow10(GweiDecimals))}
+}
+
+// ParseGwei parses a decimal amount of gwei such as "1.5"
+func ParseGwei(s string) (Gwei, error) {
+	v, err := ParseUnits(s, GweiDecimals)
+	if err != nil {
+		return Gwei{}, err
+	}
+	return Gwei{wei: v}, nil
+}
+
+// Wei returns g in wei
+func (g Gwei) Wei() Wei {
+	return NewWei(g.wei)
+}
+
+func (g Gwei) int() *big.Int {
+	return Wei{v: g.wei}.int()
+}
+
+// Add returns g + o
+func (g Gwei) Add(o Gwei) Gwei {
+	return Gwei{wei: new(big.Int).Add(g.int(), o.int())}
+}
+
+// Sub returns g - o, which is negative when o is larger
+func (g Gwei) Sub(o Gwei) Gwei {
+	return Gwei{wei: new(big.Int).Sub(g.int(), o.int())}
+}
+
+// Mul returns g * n
+func (g Gwei) Mul(n uint64) Gwei {
+	return Gwei{wei: new(big.Int).Mul(g.int(), new(big.Int).SetUint64(n))}
+}
+
+// Cmp compares g and o, returning -1, 0 or +1
+func (g Gwei) Cmp(o Gwei) int {
+	return g.int().Cmp(o.int())
+}
+
+// Sign returns -1, 0 or +1
+func (g Gwei) Sign() int {
+	return g.int().Sign()
+}
+
+// IsZero reports whether g is zero
+func (g Gwei) IsZero() bool {
+	return g.Sign() == 0
+}
+
+// String renders g such as "1.5 gwei"
+func (g Gwei) String() string {
+	return FormatUnits(g.wei, GweiDecimals) + " gwei"
+}
+
+// Ether is an amount of ether denominated in whole ether. It is held in
+// wei, so every amount a transaction can carry is exact
+type Ether struct {
+	wei *big.Int
+}
+
+// EtherFromUint64 returns n ether
+func EtherFromUint64(n uint64) Ether {
+	return Ether{wei: new(big.Int).Mul(new(big.Int).SetUint64(n), pow10(EtherDecimals))}
+}
+
+// ParseEther parses a decimal amount of ether such as "0.25"
+func ParseEther(s string) (Ether, error) {
+	v, err := ParseUnits(s, EtherDecimals)
+	if err != nil {
+		return Ether{}, err
+	}
+	return Ether{wei: v}, nil
+}
+
+// Wei returns e in wei
+func (e Ether) Wei() Wei {
+	return NewWei(e.wei)
+}
+
+func (e Ether) int() *big.Int {
+	return Wei{v: e.wei}.int()
+}
+
+// Add returns e + o
+func (e Ether) Add(o Ether) Ether {
+	return Ether{wei: new(big.Int).Add(e.int(), o.int())}
+}
+
+// Sub returns e - o, which is negative when o is larger
+func (e Ether) Sub(o Ether) Ether {
+	return Ether{wei: new(big.Int).Sub(e.int(), o.int())}
+}
+
+// Mul returns e * n
+func (e Ether) Mul(n uint64) Ether {
+	return Ether{wei: new(big.Int).Mul(e.int(), new(big.Int).SetUint64(n))}
+}
+
+// Cmp compares e and o, returning -1, 0 or +1
+func (e Ether) Cmp(o Ether) int {
+	return e.int().Cmp(o.int())
+}
+
+// Sign returns -1, 0 or +1
+func (e Ether) Sign() int {
+	return e.int().Sign()
+}
+
+// IsZero reports whether e is zero
+func (e Ether) IsZero() bool {
+	return e.Sign() == 0
+}
+
+// String renders e such as "0.25 ETH"
+func (e Ether) String() string {
+	return FormatUnits(e.wei, EtherDecimals) + " ETH"
+}
@@ -0,0 +1,158 @@
+package units
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrTokenMismatch is returned when combining amounts of different tokens
+var ErrTokenMismatch = errors.New("units: amounts are in different tokens")
+
+// Token identifies an ERC-20 and the decimals its amounts are scaled by
+type Token struct {
+	Address  common.Address
+	Symbol   string
+	Decimals uint8
+}
+
+// Native is ETH described as a token, at the zero address that indexers
+// and invoices use for it, so ETH and ERC-20 amounts can share a type
+var Native = Token{Symbol: "ETH", Decimals: EtherDecimals}
+
+// IsNative reports whether t is ETH
+func (t Token) IsNative() bool {
+	return t.Address == Native.Address
+}
+
+// TokenAmount is an amount of one token in base units. Like Wei it is
+// immutable, and it only combines with amounts of the same token
+type TokenAmount struct {
+	token Token
+	value *big.Int
+}
+
+// NewTokenAmount wraps a base-unit amount of token, copying it; nil is zero
+func NewTokenAmount(token Token, base *big.Int) TokenAmount {
+	return TokenAmount{token: token, value: copyInt(base)}
+}
+
+// ParseTokenAmount parses a decimal amount such as "12.50" in the token's
+// decimals
+func ParseTokenAmount(token Token, s string) (TokenAmount, error) {
+	v, err := ParseUnits(s, token.Decimals)
+	if err != nil {
+		return TokenAmount{}, fmt.Errorf("%s: %w", token.Symbol, err)
+	}
+	return TokenAmount{token: token, value: v}, nil
+}
+
+// Token returns the amount's token
+func (a TokenAmount) Token() Token {
+	return a.token
+}
+
+// Base returns the amount in base units as a new *big.Int, for calldata
+func (a TokenAmount) Base() *big.Int {
+	return copyInt(a.value)
+}
+
+func (a TokenAmount) int() *big.Int {
+	if a.value == nil {
+		return new(big.Int)
+	}
+	return a.value
+}
+
+// Wei returns a native amount as wei, or ErrTokenMismatch for a token
+func (a TokenAmount) Wei() (Wei, error) {
+	if !a.token.IsNative() {
+		return Wei{}, fmt.Errorf("%w: %s is not ETH", ErrTokenMismatch, a.token.Symbol)
+	}
+	return NewWei(a.value), nil
+}
+
+// Add returns a + o, or ErrTokenMismatch
+func (a TokenAmount) Add(o TokenAmount) (TokenAmount, error) {
+	if err := a.same(o); err != nil {
+		return TokenAmount{}, err
+	}
+	return TokenAmount{token: a.token, value: new(big.Int).Add(a.int(), o.int())}, nil
+}
+
+// Sub returns a - o, or ErrTokenMismatch
+func (a TokenAmount) Sub(o TokenAmount) (TokenAmount, error) {
+	if err := a.same(o); err != nil {
+		return TokenAmount{}, err
+	}
+	return TokenAmount{token: a.token, value: new(big.Int).Sub(a.int(), o.int())}, nil
+}
+
+// Cmp compares a and o, returning -1, 0 or +1, or ErrTokenMismatch
+func (a TokenAmount) Cmp(o TokenAmount) (int, error) {
+	if err := a.same(o); err != nil {
+		return 0, err
+	}
+	return a.int().Cmp(o.int()), nil
+}
+
+// Sign returns -1, 0 or +1
+func (a TokenAmount) Sign() int {
+	return a.int().Sign()
+}
+
+// IsZero reports whether a is zero
+func (a TokenAmount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// String renders the amount with its symbol, such as "12.5 USDC"
+func (a TokenAmount) String() string {
+	return FormatUnits(a.int(), a.token.Decimals) + " " + a.token.Symbol
+}
+
+// tokenAmountJSON is the encoding of a TokenAmount. The amount is a decimal
+// string of base units, so it survives JSON decoders that use float64
+type tokenAmountJSON struct {
+	Token    common.Address `json:"token"`
+	Symbol   string         `json:"symbol,omitempty"`
+	Decimals uint8          `json:"decimals"`
+	Amount   string         `json:"amount"`
+}
+
+// MarshalJSON encodes the amount with its token, so it decodes without a
+// lookup of the token's decimals
+func (a TokenAmount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tokenAmountJSON{
+		Token:    a.token.Address,
+		Symbol:   a.token.Symbol,
+		Decimals: a.token.Decimals,
+		Amount:   a.int().String(),
+	})
+}
+
+// UnmarshalJSON decodes an amount encoded by MarshalJSON
+func (a *TokenAmount) UnmarshalJSON(data []byte) error {
+	var enc tokenAmountJSON
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	v, ok := new(big.Int).SetString(enc.Amount, 10)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidAmount, enc.Amount)
+	}
+	*a = TokenAmount{token: Token{Address: enc.Token, Symbol: enc.Symbol, Decimals: enc.Decimals}, value: v}
+	return nil
+}
+
+// same checks that o is in a's token. Tokens are the same contract with the
+// same decimals; the symbol is only a label
+func (a TokenAmount) same(o TokenAmount) error {
+	if a.token.Address != o.token.Address || a.token.Decimals != o.token.Decimals {
+		return fmt.Errorf("%w: %s and %s", ErrTokenMismatch, a.token.Symbol, o.token.Symbol)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidAmount is returned for amounts that cannot be parsed
+var ErrInvalidAmount = errors.New("units: invalid amount")
+
+// ParseUnits converts a decimal string such as "12.50" to base units of a
+// currency with the given decimals. More fractional digits than the currency
+// has is an error rather than a silent rounding
+func ParseUnits(s string, decimals uint8) (*big.Int, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if len(frac) > int(decimals) {
+		return nil, fmt.Errorf("%w: %s has more than %d decimals", ErrInvalidAmount, s, decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", int(decimals)-len(frac))
+	if whole == "" && frac == "" || strings.ContainsAny(digits, "+-") {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAmount, s)
+	}
+	v, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAmount, s)
+	}
+	return v, nil
+}
+
+// FormatUnits renders base units as a decimal string without trailing zeros
+func FormatUnits(v *big.Int, decimals uint8) string {
+	if v == nil {
+		v = new(big.Int)
+	}
+	s := new(big.Rat).SetFrac(v, pow10(decimals)).FloatString(int(decimals))
+	if whole, frac, ok := strings.Cut(s, "."); ok {
+		if frac = strings.TrimRight(frac, "0"); frac == "" {
+			return whole
+		}
+		return whole + "." + frac
+	}
+	return s
+}
+
+func pow10(n uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// copyInt returns a copy of v, treating nil as zero
+func copyInt(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(v)
+}
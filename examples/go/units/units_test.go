@@ -0,0 +1,90 @@
+package units
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestDenominationArithmetic(t *testing.T) {
+	one, half := GweiFromUint64(1), mustGwei(t, "0.5")
+	if got := one.Add(half).String(); got != "1.5 gwei" {
+		t.Fatalf("1 + 0.5 gwei = %s", got)
+	}
+	if got := half.Sub(one); got.Sign() >= 0 || got.String() != "-0.5 gwei" {
+		t.Fatalf("0.5 - 1 gwei = %s", got)
+	}
+	if got := half.Mul(3).Wei(); got.Cmp(WeiFromUint64(1_500_000_000)) != 0 {
+		t.Fatalf("0.5 gwei * 3 = %s wei", got)
+	}
+	if one.Cmp(half) != 1 || (Gwei{}).Cmp(GweiFromUint64(0)) != 0 || !(Gwei{}).IsZero() {
+		t.Fatal("gwei comparisons")
+	}
+
+	eth := EtherFromUint64(2)
+	if got := eth.Sub(eth.Mul(2)).Add(eth).String(); got != "0 ETH" {
+		t.Fatalf("2 - 4 + 2 ETH = %s", got)
+	}
+	if eth.Cmp(Ether{}) != 1 || !(Ether{}).IsZero() || eth.Wei().Ether().Cmp(eth) != 0 {
+		t.Fatal("ether comparisons")
+	}
+
+	// Operands are never aliased
+	before := one.String()
+	one.Add(one).Mul(7)
+	if one.String() != before {
+		t.Fatalf("operand changed to %s", one)
+	}
+}
+
+func TestTokenAmountJSON(t *testing.T) {
+	usdc := Token{Address: common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"), Symbol: "USDC", Decimals: 6}
+	for _, a := range []TokenAmount{
+		NewTokenAmount(usdc, big.NewInt(12_500_000)),
+		WeiFromUint64(1).Amount(),
+		{},
+	} {
+		data, err := json.Marshal(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got TokenAmount
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		if got.Token() != a.Token() || got.Base().Cmp(a.Base()) != 0 {
+			t.Fatalf("%s decoded as %s", a, got)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount":"1.5"}`), new(TokenAmount)); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("fractional base units: got %v", err)
+	}
+}
+
+func TestNativeAmount(t *testing.T) {
+	w := WeiFromUint64(42)
+	a := w.Amount()
+	if !a.Token().IsNative() || a.String() != "0.000000000000000042 ETH" {
+		t.Fatalf("got %s", a)
+	}
+	if back, err := a.Wei(); err != nil || back.Cmp(w) != 0 {
+		t.Fatalf("back to wei: %s, %v", back, err)
+	}
+	token := NewTokenAmount(Token{Address: common.HexToAddress("0x01"), Symbol: "T"}, big.NewInt(1))
+	if _, err := token.Wei(); !errors.Is(err, ErrTokenMismatch) {
+		t.Fatalf("token as wei: got %v", err)
+	}
+}
+
+func mustGwei(t *testing.T, s string) Gwei {
+	t.Helper()
+	g, err := ParseGwei(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
@@ -0,0 +1,82 @@
+package ur
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+)
+
+// words is the Bytewords alphabet; the minimal encoding of a byte is the first
+// and last letter of its word, which are unique across the list
+var words = strings.Fields(`
+able acid also apex aqua arch atom aunt away axis back bald barn belt beta bias
+blue body brag brew bulb buzz calm cash cats chef city claw code cola cook cost
+crux curl cusp cyan dark data days deli dice diet door down draw drop drum dull
+duty each easy echo edge epic even exam exit eyes fact fair fern figs film fish
+fizz flap flew flux foxy free frog fuel fund gala game gear gems gift girl glow
+good gray grim guru gush gyro half hang hard hawk heat help high hill holy hope
+horn huts iced idea idle inch inky into iris iron item jade jazz join jolt jowl
+judo jugs jump junk jury keep keno kept keys kick kiln king kite kiwi knob lamb
+lava lazy leaf legs liar limp lion list logo loud love luau luck lung main many
+math maze memo menu meow mild mint miss monk nail navy need news next noon note
+numb obey oboe omit onyx open oval owls paid part peck play plus poem pool pose
+puff puma purr quad quiz race ramp real redo rich road rock roof ruby ruin runs
+rust safe saga scar sets silk skew slot soap solo song stub surf swan taco task
+taxi tent tied time tiny toil tomb toys trip tuna twin ugly undo unit urge user
+vast very veto vial vibe view visa void vows wall wand warm wasp wave waxy webs
+what when whiz wolf work yank yawn yell yoga yurt zaps zero zest zinc zone zoom
+`)
+
+var minimalIndex = func() map[string]byte {
+	m := make(map[string]byte, len(words))
+	for i := range words {
+		m[minimalWord(byte(i))] = byte(i)
+	}
+	return m
+}()
+
+func minimalWord(b byte) string {
+	w := words[b]
+	return w[:1] + w[3:]
+}
+
+// EncodeBytewords encodes data with its CRC32 checksum in minimal Bytewords
+func EncodeBytewords(data []byte) string {
+	var sb strings.Builder
+	sb.Grow((len(data) + 4) * 2)
+	for _, b := range withChecksum(data) {
+		sb.WriteString(minimalWord(b))
+	}
+	return sb.String()
+}
+
+// DecodeBytewords decodes minimal Bytewords and verifies the checksum
+func DecodeBytewords(s string) ([]byte, error) {
+	s = strings.ToLower(s)
+	if len(s)%2 != 0 {
+		return nil, errors.New("bytewords: odd length")
+	}
+	buf := make([]byte, 0, len(s)/2)
+	for i := 0; i < len(s); i += 2 {
+		b, ok := minimalIndex[s[i:i+2]]
+		if !ok {
+			return nil, errors.New("bytewords: invalid word " + s[i:i+2])
+		}
+		buf = append(buf, b)
+	}
+	if len(buf) < 4 {
+		return nil, errors.New("bytewords: missing checksum")
+	}
+	data, sum := buf[:len(buf)-4], buf[len(buf)-4:]
+	if binary.BigEndian.Uint32(sum) != crc32.ChecksumIEEE(data) {
+		return nil, errors.New("bytewords: checksum mismatch")
+	}
+	return data, nil
+}
+
+func withChecksum(data []byte) []byte {
+	out := make([]byte, len(data), len(data)+4)
+	copy(out, data)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(data))
+}
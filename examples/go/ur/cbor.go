@@ -0,0 +1,216 @@
+package ur
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A minimal CBOR (RFC 8949) codec covering the subset used by UR registry
+// types: unsigned integers, byte and text strings, arrays, maps with unsigned
+// keys, tags and booleans
+
+const (
+	majorUint  = 0
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorMap   = 5
+	majorTag   = 6
+	majorOther = 7
+)
+
+// tagged is a CBOR tagged value
+type tagged struct {
+	Tag   uint64
+	Value interface{}
+}
+
+// cborMap is a CBOR map with unsigned integer keys, encoded in key order
+type cborMap map[uint64]interface{}
+
+func appendHead(buf []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= 0xff:
+		return append(buf, m|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(buf, m|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(buf, m|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, m|27), n)
+	}
+}
+
+func cborEncode(v interface{}) ([]byte, error) {
+	return appendCBOR(nil, v)
+}
+
+func appendCBOR(buf []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case uint64:
+		return appendHead(buf, majorUint, v), nil
+	case uint32:
+		return appendHead(buf, majorUint, uint64(v)), nil
+	case int:
+		if v < 0 {
+			return nil, errors.New("cbor: negative integers are not supported")
+		}
+		return appendHead(buf, majorUint, uint64(v)), nil
+	case bool:
+		if v {
+			return append(buf, majorOther<<5|21), nil
+		}
+		return append(buf, majorOther<<5|20), nil
+	case []byte:
+		return append(appendHead(buf, majorBytes, uint64(len(v))), v...), nil
+	case string:
+		return append(appendHead(buf, majorText, uint64(len(v))), v...), nil
+	case []interface{}:
+		buf = appendHead(buf, majorArray, uint64(len(v)))
+		for _, item := range v {
+			if buf, err = appendCBOR(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case cborMap:
+		keys := make([]uint64, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		buf = appendHead(buf, majorMap, uint64(len(v)))
+		for _, k := range keys {
+			buf = appendHead(buf, majorUint, k)
+			if buf, err = appendCBOR(buf, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case tagged:
+		return appendCBOR(appendHead(buf, majorTag, v.Tag), v.Value)
+	default:
+		return nil, fmt.Errorf("cbor: unsupported type %T", v)
+	}
+}
+
+// maxItems bounds array and map lengths so hostile input cannot force large
+// allocations
+const maxItems = 1 << 16
+
+func cborDecode(data []byte) (interface{}, error) {
+	v, rest, err := decodeItem(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
+
+func decodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > 16 {
+		return nil, nil, errors.New("cbor: nesting too deep")
+	}
+	major, n, data, err := decodeHead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch major {
+	case majorUint:
+		return n, data, nil
+	case majorBytes, majorText:
+		if uint64(len(data)) < n {
+			return nil, nil, errors.New("cbor: truncated string")
+		}
+		if major == majorText {
+			return string(data[:n]), data[n:], nil
+		}
+		return append([]byte(nil), data[:n]...), data[n:], nil
+	case majorArray:
+		if n > maxItems {
+			return nil, nil, errors.New("cbor: array too long")
+		}
+		out := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var item interface{}
+			if item, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			out = append(out, item)
+		}
+		return out, data, nil
+	case majorMap:
+		if n > maxItems {
+			return nil, nil, errors.New("cbor: map too long")
+		}
+		out := make(cborMap, n)
+		for i := uint64(0); i < n; i++ {
+			var key, item interface{}
+			if key, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			k, ok := key.(uint64)
+			if !ok {
+				return nil, nil, errors.New("cbor: unsupported map key")
+			}
+			if item, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			out[k] = item
+		}
+		return out, data, nil
+	case majorTag:
+		item, rest, err := decodeItem(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tagged{Tag: n, Value: item}, rest, nil
+	case majorOther:
+		switch n {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported item (major type %d)", major)
+}
+
+func decodeHead(data []byte) (byte, uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, 0, nil, errors.New("cbor: unexpected end of data")
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, nil, errors.New("cbor: indefinite lengths are not supported")
+	}
+	if len(data) < size {
+		return 0, 0, nil, errors.New("cbor: unexpected end of data")
+	}
+	var n uint64
+	for _, b := range data[:size] {
+		n = n<<8 | uint64(b)
+	}
+	return major, n, data[size:], nil
+}
@@ -0,0 +1,506 @@
+package ur
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Registry types for Ethereum air-gap signing (ERC-4527), as used by
+// Keystone-style QR hardware wallets
+const (
+	TypeEthSignRequest = "eth-sign-request"
+	TypeEthSignature   = "eth-signature"
+)
+
+// CBOR tags for nested registry items
+const (
+	tagUUID    = 37
+	tagKeyPath = 304
+)
+
+// DataType identifies what SignData holds
+type DataType uint64
+
+const (
+	DataLegacyTx  DataType = 1 // RLP of an unsigned EIP-155 legacy transaction
+	DataTypedData DataType = 2 // EIP-712 typed data JSON
+	DataPersonal  DataType = 3 // personal_sign message
+	DataTypedTx   DataType = 4 // EIP-2718 typed transaction signing payload
+)
+
+// HardenedBit marks a hardened derivation path component
+const HardenedBit = 0x80000000
+
+// KeyPath is a BIP-32 derivation path (crypto-keypath)
+type KeyPath struct {
+	Components        []uint32
+	SourceFingerprint uint32 // master key fingerprint, zero if unknown
+}
+
+// ParseKeyPath parses a path such as m/44'/60'/0'/0/0
+func ParseKeyPath(path string) (*KeyPath, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q", path)
+	}
+	kp := &KeyPath{}
+	for _, p := range parts[1:] {
+		var hardened uint32
+		if strings.HasSuffix(p, "'") || strings.HasSuffix(p, "h") {
+			hardened, p = HardenedBit, p[:len(p)-1]
+		}
+		n, err := strconv.ParseUint(p, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path %q", path)
+		}
+		kp.Components = append(kp.Components, uint32(n)|hardened)
+	}
+	return kp, nil
+}
+
+// String formats the path in m/44'/60'/0' notation
+func (kp *KeyPath) String() string {
+	var sb strings.Builder
+	sb.WriteString("m")
+	for _, c := range kp.Components {
+		sb.WriteString("/" + strconv.FormatUint(uint64(c&^HardenedBit), 10))
+		if c&HardenedBit != 0 {
+			sb.WriteString("'")
+		}
+	}
+	return sb.String()
+}
+
+func (kp *KeyPath) cbor() interface{} {
+	components := make([]interface{}, 0, 2*len(kp.Components))
+	for _, c := range kp.Components {
+		components = append(components, uint64(c&^HardenedBit), c&HardenedBit != 0)
+	}
+	m := cborMap{1: components, 3: len(kp.Components)}
+	if kp.SourceFingerprint != 0 {
+		m[2] = kp.SourceFingerprint
+	}
+	return tagged{Tag: tagKeyPath, Value: m}
+}
+
+func parseKeyPath(v interface{}) (*KeyPath, error) {
+	t, ok := v.(tagged)
+	if !ok || t.Tag != tagKeyPath {
+		return nil, errors.New("ur: expected crypto-keypath")
+	}
+	m, ok := t.Value.(cborMap)
+	if !ok {
+		return nil, errors.New("ur: malformed crypto-keypath")
+	}
+	components, _ := m[1].([]interface{})
+	if len(components)%2 != 0 {
+		return nil, errors.New("ur: malformed crypto-keypath")
+	}
+	kp := &KeyPath{}
+	for i := 0; i < len(components); i += 2 {
+		index, ok1 := components[i].(uint64)
+		hardened, ok2 := components[i+1].(bool)
+		if !ok1 || !ok2 || index >= HardenedBit {
+			return nil, errors.New("ur: unsupported crypto-keypath component")
+		}
+		c := uint32(index)
+		if hardened {
+			c |= HardenedBit
+		}
+		kp.Components = append(kp.Components, c)
+	}
+	if fp, ok := m[2].(uint64); ok {
+		kp.SourceFingerprint = uint32(fp)
+	}
+	return kp, nil
+}
+
+// SignRequest is an eth-sign-request sent from the online wallet to the
+// offline signer
+type SignRequest struct {
+	RequestID [16]byte
+	SignData  []byte
+	DataType  DataType
+	ChainID   uint64
+	Path      *KeyPath
+	Address   *common.Address
+	Origin    string
+}
+
+// NewRequestID returns a random request UUID
+func NewRequestID() ([16]byte, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return id, err
+	}
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return id, nil
+}
+
+// UR encodes the request
+func (r *SignRequest) UR() (*UR, error) {
+	m := cborMap{
+		1: tagged{Tag: tagUUID, Value: r.RequestID[:]},
+		2: r.SignData,
+		3: uint64(r.DataType),
+	}
+	if r.ChainID != 0 {
+		m[4] = r.ChainID
+	}
+	if r.Path != nil {
+		m[5] = r.Path.cbor()
+	}
+	if r.Address != nil {
+		m[6] = r.Address.Bytes()
+	}
+	if r.Origin != "" {
+		m[7] = r.Origin
+	}
+	data, err := cborEncode(m)
+	if err != nil {
+		return nil, err
+	}
+	return New(TypeEthSignRequest, data)
+}
+
+// ParseSignRequest decodes an eth-sign-request
+func ParseSignRequest(u *UR) (*SignRequest, error) {
+	if u.Type != TypeEthSignRequest {
+		return nil, fmt.Errorf("ur: expected %s, got %s", TypeEthSignRequest, u.Type)
+	}
+	m, err := decodeMap(u.CBOR)
+	if err != nil {
+		return nil, err
+	}
+	r := &SignRequest{}
+	if r.RequestID, err = parseUUID(m[1]); err != nil {
+		return nil, err
+	}
+	var ok bool
+	if r.SignData, ok = m[2].([]byte); !ok || len(r.SignData) == 0 {
+		return nil, errors.New("ur: missing sign data")
+	}
+	dt, ok := m[3].(uint64)
+	if !ok {
+		return nil, errors.New("ur: missing data type")
+	}
+	r.DataType = DataType(dt)
+	r.ChainID, _ = m[4].(uint64)
+	if v, ok := m[5]; ok {
+		if r.Path, err = parseKeyPath(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := m[6].([]byte); ok {
+		if len(v) != common.AddressLength {
+			return nil, errors.New("ur: malformed address")
+		}
+		addr := common.BytesToAddress(v)
+		r.Address = &addr
+	}
+	r.Origin, _ = m[7].(string)
+	return r, nil
+}
+
+// Signature is an eth-signature returned by the offline signer
+type Signature struct {
+	RequestID [16]byte
+	Signature []byte // r || s || v
+	Origin    string
+}
+
+// UR encodes the signature
+func (s *Signature) UR() (*UR, error) {
+	m := cborMap{
+		1: tagged{Tag: tagUUID, Value: s.RequestID[:]},
+		2: s.Signature,
+	}
+	if s.Origin != "" {
+		m[3] = s.Origin
+	}
+	data, err := cborEncode(m)
+	if err != nil {
+		return nil, err
+	}
+	return New(TypeEthSignature, data)
+}
+
+// ParseSignature decodes an eth-signature
+func ParseSignature(u *UR) (*Signature, error) {
+	if u.Type != TypeEthSignature {
+		return nil, fmt.Errorf("ur: expected %s, got %s", TypeEthSignature, u.Type)
+	}
+	m, err := decodeMap(u.CBOR)
+	if err != nil {
+		return nil, err
+	}
+	s := &Signature{}
+	if s.RequestID, err = parseUUID(m[1]); err != nil {
+		return nil, err
+	}
+	var ok bool
+	if s.Signature, ok = m[2].([]byte); !ok || len(s.Signature) < 65 {
+		return nil, errors.New("ur: malformed signature")
+	}
+	s.Origin, _ = m[3].(string)
+	return s, nil
+}
+
+func decodeMap(data []byte) (cborMap, error) {
+	v, err := cborDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(cborMap)
+	if !ok {
+		return nil, errors.New("ur: expected a map")
+	}
+	return m, nil
+}
+
+func parseUUID(v interface{}) ([16]byte, error) {
+	var id [16]byte
+	t, ok := v.(tagged)
+	if !ok || t.Tag != tagUUID {
+		return id, errors.New("ur: missing request id")
+	}
+	b, ok := t.Value.([]byte)
+	if !ok || len(b) != len(id) {
+		return id, errors.New("ur: malformed request id")
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// legacyPayload is the EIP-155 signing payload of a legacy transaction
+type legacyPayload struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       *common.Address `rlp:"nil"`
+	Value    *big.Int
+	Data     []byte
+	ChainID  *big.Int
+	Zero1    uint
+	Zero2    uint
+}
+
+// dynamicFeePayload is the EIP-1559 signing payload, after the type byte
+type dynamicFeePayload struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	Gas        uint64
+	To         *common.Address `rlp:"nil"`
+	Value      *big.Int
+	Data       []byte
+	AccessList types.AccessList
+}
+
+// NewTxSignRequest builds a request for an unsigned legacy or EIP-1559
+// transaction that from is expected to sign
+func NewTxSignRequest(tx *types.Transaction, chainID *big.Int, from common.Address, path *KeyPath, origin string) (*SignRequest, error) {
+	if !chainID.IsUint64() {
+		return nil, errors.New("chain id out of range")
+	}
+	var (
+		payload  []byte
+		dataType DataType
+		err      error
+	)
+	switch tx.Type() {
+	case types.LegacyTxType:
+		dataType = DataLegacyTx
+		payload, err = rlp.EncodeToBytes(&legacyPayload{
+			Nonce: tx.Nonce(), GasPrice: tx.GasPrice(), Gas: tx.Gas(), To: tx.To(),
+			Value: tx.Value(), Data: tx.Data(), ChainID: chainID,
+		})
+	case types.DynamicFeeTxType:
+		dataType = DataTypedTx
+		var body []byte
+		body, err = rlp.EncodeToBytes(&dynamicFeePayload{
+			ChainID: chainID, Nonce: tx.Nonce(), GasTipCap: tx.GasTipCap(), GasFeeCap: tx.GasFeeCap(),
+			Gas: tx.Gas(), To: tx.To(), Value: tx.Value(), Data: tx.Data(), AccessList: tx.AccessList(),
+		})
+		payload = append([]byte{types.DynamicFeeTxType}, body...)
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %d", tx.Type())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if crypto.Keccak256Hash(payload) != types.LatestSignerForChainID(chainID).Hash(tx) {
+		return nil, errors.New("signing payload does not match transaction hash")
+	}
+	return newSignRequest(payload, dataType, chainID.Uint64(), from, path, origin)
+}
+
+// NewTypedDataSignRequest builds a request to sign EIP-712 typed data
+func NewTypedDataSignRequest(td *apitypes.TypedData, from common.Address, path *KeyPath, origin string) (*SignRequest, error) {
+	data, err := json.Marshal(td)
+	if err != nil {
+		return nil, err
+	}
+	var chainID uint64
+	if td.Domain.ChainId != nil {
+		chainID = (*big.Int)(td.Domain.ChainId).Uint64()
+	}
+	return newSignRequest(data, DataTypedData, chainID, from, path, origin)
+}
+
+// NewPersonalSignRequest builds a request to sign a personal message
+func NewPersonalSignRequest(message []byte, from common.Address, path *KeyPath, origin string) (*SignRequest, error) {
+	return newSignRequest(message, DataPersonal, 0, from, path, origin)
+}
+
+func newSignRequest(data []byte, dataType DataType, chainID uint64, from common.Address, path *KeyPath, origin string) (*SignRequest, error) {
+	id, err := NewRequestID()
+	if err != nil {
+		return nil, err
+	}
+	return &SignRequest{
+		RequestID: id,
+		SignData:  data,
+		DataType:  dataType,
+		ChainID:   chainID,
+		Path:      path,
+		Address:   &from,
+		Origin:    origin,
+	}, nil
+}
+
+// Transaction decodes the unsigned transaction in a transaction request so it
+// can be shown to the user before signing
+func (r *SignRequest) Transaction() (*types.Transaction, error) {
+	var tx *types.Transaction
+	switch r.DataType {
+	case DataLegacyTx:
+		var p legacyPayload
+		if err := rlp.DecodeBytes(r.SignData, &p); err != nil {
+			return nil, err
+		}
+		if p.ChainID == nil || !p.ChainID.IsUint64() || p.ChainID.Uint64() != r.ChainID || p.Zero1 != 0 || p.Zero2 != 0 {
+			return nil, errors.New("ur: legacy transaction is not EIP-155 protected for the requested chain")
+		}
+		tx = types.NewTx(&types.LegacyTx{Nonce: p.Nonce, GasPrice: p.GasPrice, Gas: p.Gas, To: p.To, Value: p.Value, Data: p.Data})
+	case DataTypedTx:
+		if len(r.SignData) == 0 || r.SignData[0] != types.DynamicFeeTxType {
+			return nil, errors.New("ur: unsupported typed transaction")
+		}
+		var p dynamicFeePayload
+		if err := rlp.DecodeBytes(r.SignData[1:], &p); err != nil {
+			return nil, err
+		}
+		if p.ChainID == nil || !p.ChainID.IsUint64() || p.ChainID.Uint64() != r.ChainID {
+			return nil, errors.New("ur: transaction chain id does not match the request")
+		}
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID: p.ChainID, Nonce: p.Nonce, GasTipCap: p.GasTipCap, GasFeeCap: p.GasFeeCap,
+			Gas: p.Gas, To: p.To, Value: p.Value, Data: p.Data, AccessList: p.AccessList,
+		})
+	default:
+		return nil, errors.New("ur: request is not a transaction")
+	}
+	// Re-encoding must reproduce the payload, so the decoded transaction is
+	// exactly what gets signed
+	if types.LatestSignerForChainID(new(big.Int).SetUint64(r.ChainID)).Hash(tx) != crypto.Keccak256Hash(r.SignData) {
+		return nil, errors.New("ur: non-canonical transaction payload")
+	}
+	return tx, nil
+}
+
+// Sign answers a request on the offline device. Transactions are decoded and
+// checked before signing; typed data is hashed per EIP-712
+func Sign(key *ecdsa.PrivateKey, r *SignRequest) (*Signature, error) {
+	if r.Address != nil && *r.Address != crypto.PubkeyToAddress(key.PublicKey) {
+		return nil, fmt.Errorf("request is for %s", r.Address.Hex())
+	}
+
+	var hash []byte
+	switch r.DataType {
+	case DataLegacyTx, DataTypedTx:
+		if _, err := r.Transaction(); err != nil {
+			return nil, err
+		}
+		hash = crypto.Keccak256(r.SignData)
+	case DataTypedData:
+		var td apitypes.TypedData
+		if err := json.Unmarshal(r.SignData, &td); err != nil {
+			return nil, err
+		}
+		h, _, err := apitypes.TypedDataAndHash(td)
+		if err != nil {
+			return nil, err
+		}
+		hash = h
+	case DataPersonal:
+		prefix := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(r.SignData))
+		hash = crypto.Keccak256([]byte(prefix), r.SignData)
+	default:
+		return nil, fmt.Errorf("unsupported data type %d", r.DataType)
+	}
+
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		return nil, err
+	}
+	v := new(big.Int).SetUint64(uint64(sig[64]))
+	switch r.DataType {
+	case DataLegacyTx:
+		v.Add(v, new(big.Int).SetUint64(r.ChainID*2+35))
+	case DataTypedData, DataPersonal:
+		v.Add(v, big.NewInt(27))
+	}
+	out := append(sig[:64:64], v.Bytes()...)
+	if v.Sign() == 0 {
+		out = append(out, 0)
+	}
+	return &Signature{RequestID: r.RequestID, Signature: out, Origin: r.Origin}, nil
+}
+
+// ApplySignature attaches a signature returned for NewTxSignRequest to the
+// transaction and checks that it was produced by from
+func ApplySignature(tx *types.Transaction, chainID *big.Int, from common.Address, sig *Signature) (*types.Transaction, error) {
+	if len(sig.Signature) < 65 {
+		return nil, errors.New("ur: malformed signature")
+	}
+	v := new(big.Int).SetBytes(sig.Signature[64:])
+	switch {
+	case v.Cmp(big.NewInt(35)) >= 0:
+		v.Sub(v, new(big.Int).Add(new(big.Int).Mul(chainID, big.NewInt(2)), big.NewInt(35)))
+	case v.Cmp(big.NewInt(27)) >= 0:
+		v.Sub(v, big.NewInt(27))
+	}
+	if !v.IsUint64() || v.Uint64() > 1 {
+		return nil, errors.New("ur: invalid recovery id")
+	}
+	raw := append(append([]byte(nil), sig.Signature[:64]...), byte(v.Uint64()))
+
+	signer := types.LatestSignerForChainID(chainID)
+	signed, err := tx.WithSignature(signer, raw)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, err
+	}
+	if sender != from {
+		return nil, fmt.Errorf("signature is from %s, expected %s", sender.Hex(), from.Hex())
+	}
+	return signed, nil
+}
@@ -0,0 +1,156 @@
+package ur
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestKeyPath(t *testing.T) {
+	kp, err := ParseKeyPath("m/44'/60'/0'/0/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kp.String() != "m/44'/60'/0'/0/7" {
+		t.Fatalf("got %s", kp)
+	}
+	for _, bad := range []string{"", "44'/60'", "m/x", "m/2147483648"} {
+		if _, err := ParseKeyPath(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestTransactionSignRoundTrip(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	chainID := big.NewInt(11155111)
+	path, _ := ParseKeyPath("m/44'/60'/0'/0/0")
+
+	txs := map[string]*types.Transaction{
+		"legacy": types.NewTx(&types.LegacyTx{Nonce: 3, GasPrice: big.NewInt(2e9), Gas: 21000, To: &to, Value: big.NewInt(1e15)}),
+		"dynamic fee": types.NewTx(&types.DynamicFeeTx{
+			ChainID: chainID, Nonce: 4, GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(3e10),
+			Gas: 60000, To: &to, Data: []byte{0xa9, 0x05, 0x9c, 0xbb},
+		}),
+	}
+	for name, tx := range txs {
+		t.Run(name, func(t *testing.T) {
+			req, err := NewTxSignRequest(tx, chainID, from, path, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Online wallet -> animated QR -> offline signer
+			u, err := req.UR()
+			if err != nil {
+				t.Fatal(err)
+			}
+			received := transfer(t, u)
+			parsed, err := ParseSignRequest(received)
+			if err != nil {
+				t.Fatal(err)
+			}
+			shown, err := parsed.Transaction()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shown.Nonce() != tx.Nonce() || *shown.To() != to || shown.Value().Cmp(tx.Value()) != 0 {
+				t.Fatal("signer was shown a different transaction")
+			}
+
+			other, _ := crypto.GenerateKey()
+			if _, err := Sign(other, parsed); err == nil {
+				t.Fatal("signed with a key the request is not for")
+			}
+			sig, err := Sign(key, parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Offline signer -> QR -> online wallet
+			su, err := sig.UR()
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := ParseSignature(transfer(t, su))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if back.RequestID != req.RequestID {
+				t.Fatal("signature answers a different request")
+			}
+			signed, err := ApplySignature(tx, chainID, from, back)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+			if err != nil || sender != from {
+				t.Fatalf("sender %s, %v", sender.Hex(), err)
+			}
+			if _, err := ApplySignature(tx, chainID, to, back); err == nil {
+				t.Fatal("signature accepted for the wrong sender")
+			}
+		})
+	}
+}
+
+func TestPersonalSignRequest(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	req, err := NewPersonalSignRequest([]byte("hello"), from, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := req.UR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSignRequest(transfer(t, u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(key, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := append([]byte(nil), sig.Signature...)
+	raw[64] -= 27
+	hash := crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n5hello"))
+	pub, err := crypto.SigToPub(hash, raw)
+	if err != nil || crypto.PubkeyToAddress(*pub) != from {
+		t.Fatal("personal signature does not recover the signer")
+	}
+}
+
+// transfer sends u through an encoder and decoder with small fragments, as
+// an animated QR code would
+func transfer(t *testing.T, u *UR) *UR {
+	t.Helper()
+	enc, err := NewEncoder(u, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder()
+	for i := 0; !dec.Complete(); i++ {
+		if i > 10*enc.SeqLen()+10 {
+			t.Fatal("transfer did not complete")
+		}
+		part, err := enc.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dec.Receive(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := dec.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
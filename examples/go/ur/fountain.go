@@ -0,0 +1,450 @@
+package ur
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Multipart URs use the BC-UR fountain code: the first seqLen parts carry the
+// message fragments in order, later parts XOR a pseudo-randomly chosen set of
+// fragments so a receiver can recover from any sufficiently large subset of
+// frames, whichever order the camera catches them in
+
+// xoshiro is the xoshiro256** generator specified by BC-UR
+type xoshiro [4]uint64
+
+func newXoshiro(seed []byte) *xoshiro {
+	digest := sha256.Sum256(seed)
+	var x xoshiro
+	for i := range x {
+		x[i] = binary.BigEndian.Uint64(digest[i*8:])
+	}
+	return &x
+}
+
+func (x *xoshiro) next() uint64 {
+	result := bits.RotateLeft64(x[1]*5, 7) * 9
+	t := x[1] << 17
+	x[2] ^= x[0]
+	x[3] ^= x[1]
+	x[1] ^= x[2]
+	x[0] ^= x[3]
+	x[2] ^= t
+	x[3] = bits.RotateLeft64(x[3], 45)
+	return result
+}
+
+func (x *xoshiro) nextDouble() float64 {
+	return float64(x.next()) / (float64(math.MaxUint64) + 1)
+}
+
+func (x *xoshiro) nextInt(low, high int) int {
+	return int(x.nextDouble()*float64(high-low+1)) + low
+}
+
+// sampler is Vose's alias method over a fixed distribution
+type sampler struct {
+	probs   []float64
+	aliases []int
+}
+
+func newSampler(weights []float64) *sampler {
+	n := len(weights)
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	p := make([]float64, n)
+	for i, w := range weights {
+		p[i] = w * float64(n) / total
+	}
+
+	s := &sampler{probs: make([]float64, n), aliases: make([]int, n)}
+	var small, large []int
+	for i := n - 1; i >= 0; i-- {
+		if p[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	for len(small) > 0 && len(large) > 0 {
+		a, g := small[len(small)-1], large[len(large)-1]
+		small, large = small[:len(small)-1], large[:len(large)-1]
+		s.probs[a] = p[a]
+		s.aliases[a] = g
+		p[g] += p[a] - 1
+		if p[g] < 1 {
+			small = append(small, g)
+		} else {
+			large = append(large, g)
+		}
+	}
+	for _, i := range large {
+		s.probs[i] = 1
+	}
+	for _, i := range small {
+		s.probs[i] = 1
+	}
+	return s
+}
+
+func (s *sampler) next(rng *xoshiro) int {
+	r1, r2 := rng.nextDouble(), rng.nextDouble()
+	i := int(float64(len(s.probs)) * r1)
+	if r2 < s.probs[i] {
+		return i
+	}
+	return s.aliases[i]
+}
+
+// chooseFragments returns the sorted fragment indexes mixed into a part
+func chooseFragments(seqNum uint32, seqLen int, checksum uint32) []int {
+	if int(seqNum) <= seqLen {
+		return []int{int(seqNum) - 1}
+	}
+
+	seed := binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, seqNum), checksum)
+	rng := newXoshiro(seed)
+	weights := make([]float64, seqLen)
+	for i := range weights {
+		weights[i] = 1 / float64(i+1)
+	}
+	degree := newSampler(weights).next(rng) + 1
+
+	remaining := make([]int, seqLen)
+	for i := range remaining {
+		remaining[i] = i
+	}
+	shuffled := make([]int, 0, seqLen)
+	for len(remaining) > 0 {
+		i := rng.nextInt(0, len(remaining)-1)
+		shuffled = append(shuffled, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	chosen := shuffled[:degree]
+	sort.Ints(chosen)
+	return chosen
+}
+
+// fragmentLength picks the smallest fragment count whose fragments fit maxLen
+func fragmentLength(messageLen, minLen, maxLen int) int {
+	for count := 1; ; count++ {
+		n := (messageLen + count - 1) / count
+		if n <= maxLen || n <= minLen {
+			return n
+		}
+	}
+}
+
+func xorInto(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// part is one fountain-coded frame
+type part struct {
+	SeqNum     uint32
+	SeqLen     int
+	MessageLen int
+	Checksum   uint32
+	Data       []byte
+}
+
+func (p *part) cbor() ([]byte, error) {
+	return cborEncode([]interface{}{uint64(p.SeqNum), p.SeqLen, p.MessageLen, p.Checksum, p.Data})
+}
+
+func parsePart(data []byte) (*part, error) {
+	v, err := cborDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 5 {
+		return nil, errors.New("ur: malformed part")
+	}
+	var nums [4]uint64
+	for i := range nums {
+		if nums[i], ok = arr[i].(uint64); !ok {
+			return nil, errors.New("ur: malformed part")
+		}
+	}
+	body, ok := arr[4].([]byte)
+	if !ok || len(body) == 0 {
+		return nil, errors.New("ur: malformed part")
+	}
+	if nums[0] == 0 || nums[0] > math.MaxUint32 || nums[1] == 0 || nums[1] > maxFragments ||
+		nums[2] == 0 || nums[2] > maxMessageLen || nums[3] > math.MaxUint32 {
+		return nil, errors.New("ur: part header out of range")
+	}
+	return &part{
+		SeqNum:     uint32(nums[0]),
+		SeqLen:     int(nums[1]),
+		MessageLen: int(nums[2]),
+		Checksum:   uint32(nums[3]),
+		Data:       body,
+	}, nil
+}
+
+// Limits applied to incoming parts
+const (
+	maxMessageLen = 1 << 20
+	maxFragments  = 1 << 12
+	maxMixed      = 1 << 12
+)
+
+// Encoder produces an endless sequence of UR parts for an animated QR code
+type Encoder struct {
+	ur        *UR
+	fragments [][]byte
+	checksum  uint32
+	seqNum    uint32
+}
+
+// Default fragment bounds, sized for QR codes that scan reliably on phones
+const (
+	DefaultMaxFragmentLen = 200
+	minFragmentLen        = 10
+)
+
+// NewEncoder splits a UR into fragments of at most maxFragmentLen bytes
+func NewEncoder(u *UR, maxFragmentLen int) (*Encoder, error) {
+	if len(u.CBOR) == 0 {
+		return nil, errors.New("ur: empty payload")
+	}
+	if maxFragmentLen < minFragmentLen {
+		return nil, errors.New("ur: fragment length too small")
+	}
+	fragLen := fragmentLength(len(u.CBOR), minFragmentLen, maxFragmentLen)
+	count := (len(u.CBOR) + fragLen - 1) / fragLen
+	padded := make([]byte, fragLen*count)
+	copy(padded, u.CBOR)
+
+	e := &Encoder{ur: u, checksum: crc32.ChecksumIEEE(u.CBOR)}
+	for i := 0; i < count; i++ {
+		e.fragments = append(e.fragments, padded[i*fragLen:(i+1)*fragLen])
+	}
+	return e, nil
+}
+
+// SeqLen returns the number of fragments
+func (e *Encoder) SeqLen() int {
+	return len(e.fragments)
+}
+
+// IsSinglePart reports whether the whole UR fits in one QR frame
+func (e *Encoder) IsSinglePart() bool {
+	return len(e.fragments) == 1
+}
+
+// NextPart returns the next frame as a lowercase UR string; uppercase it for
+// alphanumeric QR encoding. A single-part UR returns the same string each time
+func (e *Encoder) NextPart() (string, error) {
+	if e.IsSinglePart() {
+		return e.ur.String(), nil
+	}
+	e.seqNum++
+	mixed := make([]byte, len(e.fragments[0]))
+	for _, i := range chooseFragments(e.seqNum, len(e.fragments), e.checksum) {
+		xorInto(mixed, e.fragments[i])
+	}
+	p := &part{SeqNum: e.seqNum, SeqLen: len(e.fragments), MessageLen: len(e.ur.CBOR), Checksum: e.checksum, Data: mixed}
+	data, err := p.cbor()
+	if err != nil {
+		return "", err
+	}
+	return formatPart(e.ur.Type, p.SeqNum, p.SeqLen, data), nil
+}
+
+// fragment is a known XOR combination of message fragments
+type fragment struct {
+	indexes []int
+	data    []byte
+}
+
+// Decoder reassembles a UR from parts scanned in any order
+type Decoder struct {
+	urType     string
+	seqLen     int
+	messageLen int
+	checksum   uint32
+	fragLen    int
+
+	simple map[int][]byte
+	mixed  []fragment
+	result *UR
+}
+
+// NewDecoder creates an empty decoder
+func NewDecoder() *Decoder {
+	return &Decoder{simple: make(map[int][]byte)}
+}
+
+// Receive processes one scanned frame; frames from a different UR are rejected
+func (d *Decoder) Receive(s string) error {
+	if d.result != nil {
+		return nil
+	}
+	urType, seq, body, err := splitUR(s)
+	if err != nil {
+		return err
+	}
+	if seq == "" {
+		u, err := decodeSingle(urType, body)
+		if err != nil {
+			return err
+		}
+		d.result = u
+		return nil
+	}
+
+	data, err := DecodeBytewords(body)
+	if err != nil {
+		return err
+	}
+	p, err := parsePart(data)
+	if err != nil {
+		return err
+	}
+	if err := d.accept(urType, p); err != nil {
+		return err
+	}
+	d.add(fragment{indexes: chooseFragments(p.SeqNum, p.SeqLen, p.Checksum), data: p.Data})
+	if len(d.simple) == d.seqLen {
+		return d.assemble()
+	}
+	return nil
+}
+
+func (d *Decoder) accept(urType string, p *part) error {
+	if d.urType == "" {
+		if len(p.Data)*p.SeqLen < p.MessageLen {
+			return errors.New("ur: fragments shorter than message")
+		}
+		d.urType, d.seqLen, d.messageLen, d.checksum, d.fragLen = urType, p.SeqLen, p.MessageLen, p.Checksum, len(p.Data)
+		return nil
+	}
+	if urType != d.urType || p.SeqLen != d.seqLen || p.MessageLen != d.messageLen ||
+		p.Checksum != d.checksum || len(p.Data) != d.fragLen {
+		return errors.New("ur: part belongs to a different message")
+	}
+	return nil
+}
+
+// add peels known fragments off incoming parts until nothing more resolves
+func (d *Decoder) add(f fragment) {
+	queue := []fragment{f}
+	for len(queue) > 0 {
+		f := d.reduce(queue[0])
+		queue = queue[1:]
+		switch len(f.indexes) {
+		case 0:
+		case 1:
+			i := f.indexes[0]
+			if _, ok := d.simple[i]; ok {
+				continue
+			}
+			d.simple[i] = f.data
+			keep := d.mixed[:0]
+			for _, m := range d.mixed {
+				if containsInt(m.indexes, i) {
+					queue = append(queue, m)
+				} else {
+					keep = append(keep, m)
+				}
+			}
+			d.mixed = keep
+		default:
+			if len(d.mixed) < maxMixed && !d.hasMixed(f.indexes) {
+				d.mixed = append(d.mixed, f)
+			}
+		}
+	}
+}
+
+func (d *Decoder) reduce(f fragment) fragment {
+	var indexes []int
+	data := append([]byte(nil), f.data...)
+	for _, i := range f.indexes {
+		if known, ok := d.simple[i]; ok {
+			xorInto(data, known)
+		} else {
+			indexes = append(indexes, i)
+		}
+	}
+	return fragment{indexes: indexes, data: data}
+}
+
+func (d *Decoder) hasMixed(indexes []int) bool {
+	for _, m := range d.mixed {
+		if equalInts(m.indexes, indexes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Decoder) assemble() error {
+	message := make([]byte, 0, d.seqLen*d.fragLen)
+	for i := 0; i < d.seqLen; i++ {
+		message = append(message, d.simple[i]...)
+	}
+	message = message[:d.messageLen]
+	if crc32.ChecksumIEEE(message) != d.checksum {
+		return errors.New("ur: message checksum mismatch")
+	}
+	d.result = &UR{Type: d.urType, CBOR: message}
+	return nil
+}
+
+// Complete reports whether the UR has been fully received
+func (d *Decoder) Complete() bool {
+	return d.result != nil
+}
+
+// Progress returns the fraction of fragments recovered so far
+func (d *Decoder) Progress() float64 {
+	switch {
+	case d.result != nil:
+		return 1
+	case d.seqLen == 0:
+		return 0
+	}
+	return float64(len(d.simple)) / float64(d.seqLen)
+}
+
+// Result returns the decoded UR once complete
+func (d *Decoder) Result() (*UR, error) {
+	if d.result == nil {
+		return nil, errors.New("ur: incomplete")
+	}
+	return d.result, nil
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
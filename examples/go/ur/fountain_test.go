@@ -0,0 +1,175 @@
+package ur
+
+import (
+	"bytes"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+func TestBytewordsVector(t *testing.T) {
+	// BCR-2020-012 example
+	got := EncodeBytewords([]byte{0, 1, 2, 128, 255})
+	if got != "aeadaolazmjendeoti" {
+		t.Fatalf("got %s", got)
+	}
+	data, err := DecodeBytewords(strings.ToUpper(got))
+	if err != nil || !bytes.Equal(data, []byte{0, 1, 2, 128, 255}) {
+		t.Fatalf("decode: %x, %v", data, err)
+	}
+	if _, err := DecodeBytewords("aeadaolazmjendeota"); err == nil {
+		t.Fatal("bad checksum accepted")
+	}
+}
+
+func TestXoshiroVector(t *testing.T) {
+	// BC-UR reference generator seeded with "Wolf"
+	want := []uint64{42, 81, 85, 8, 82, 84, 76, 73, 70, 88, 2, 74, 40, 48, 77, 54, 88, 7, 5, 88}
+	rng := newXoshiro([]byte("Wolf"))
+	for i, w := range want {
+		if got := rng.next() % 100; got != w {
+			t.Fatalf("output %d: got %d, want %d", i, got, w)
+		}
+	}
+}
+
+// makeMessage is the BC-UR reference test message: len bytes from the
+// generator seeded with seed
+func makeMessage(seed string, n int) []byte {
+	rng := newXoshiro([]byte(seed))
+	msg := make([]byte, n)
+	for i := range msg {
+		msg[i] = byte(rng.nextInt(0, 255))
+	}
+	return msg
+}
+
+func TestChooseFragmentsVector(t *testing.T) {
+	msg := makeMessage("Wolf", 1024)
+	checksum := crc32.ChecksumIEEE(msg)
+	fragLen := fragmentLength(len(msg), minFragmentLen, 100)
+	seqLen := (len(msg) + fragLen - 1) / fragLen
+	if fragLen != 94 || seqLen != 11 {
+		t.Fatalf("got %d fragments of %d bytes", seqLen, fragLen)
+	}
+
+	// Parts after the first seqLen mix fragments as in the reference encoder
+	want := [][]int{
+		{9}, {2, 5, 6, 8, 9, 10}, {8}, {1, 5}, {1}, {0, 2, 4, 5, 8, 10},
+		{5}, {2}, {2}, {0, 1, 3, 4, 5, 7, 9, 10}, {0, 1, 2, 3, 5, 6, 8, 9, 10},
+	}
+	for i := 1; i <= seqLen; i++ {
+		if got := chooseFragments(uint32(i), seqLen, checksum); !equalInts(got, []int{i - 1}) {
+			t.Fatalf("part %d: got %v", i, got)
+		}
+	}
+	for i, w := range want {
+		seqNum := uint32(seqLen + 1 + i)
+		if got := chooseFragments(seqNum, seqLen, checksum); !equalInts(got, w) {
+			t.Fatalf("part %d: got %v, want %v", seqNum, got, w)
+		}
+	}
+}
+
+func TestFountainRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		maxFrag int
+		keep    func(seqNum int) bool
+	}{
+		{"single part", 50, 100, func(int) bool { return true }},
+		{"all parts", 1024, 100, func(int) bool { return true }},
+		{"every third dropped", 1024, 100, func(n int) bool { return n%3 != 0 }},
+		{"first pass lost", 1024, 100, func(n int) bool { return n > 11 }},
+		{"only odd parts", 5000, 200, func(n int) bool { return n%2 == 1 }},
+		{"one fragment missing", 2000, 100, func(n int) bool { return n != 7 }},
+		{"uneven tail", 1001, 37, func(n int) bool { return n%4 != 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := New("bytes", makeMessage(tt.name, tt.size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			enc, err := NewEncoder(u, tt.maxFrag)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dec := NewDecoder()
+			for n := 1; !dec.Complete(); n++ {
+				if n > 20*enc.SeqLen()+20 {
+					t.Fatalf("not decoded after %d parts, progress %.2f", n, dec.Progress())
+				}
+				part, err := enc.NextPart()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.keep(n) {
+					continue
+				}
+				// Scanners see uppercase alphanumeric QR payloads
+				if err := dec.Receive(strings.ToUpper(part)); err != nil {
+					t.Fatalf("part %d: %v", n, err)
+				}
+			}
+
+			got, err := dec.Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != u.Type || !bytes.Equal(got.CBOR, u.CBOR) {
+				t.Fatal("decoded a different UR")
+			}
+			if dec.Progress() != 1 {
+				t.Fatalf("progress %v after completion", dec.Progress())
+			}
+		})
+	}
+}
+
+func TestDecoderRejects(t *testing.T) {
+	encoderFor := func(seed string) *Encoder {
+		u, _ := New("bytes", makeMessage(seed, 500))
+		enc, err := NewEncoder(u, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}
+	a, b := encoderFor("a"), encoderFor("b")
+
+	dec := NewDecoder()
+	first, _ := a.NextPart()
+	if err := dec.Receive(first); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := b.NextPart()
+	if err := dec.Receive(other); err == nil {
+		t.Fatal("part of another message accepted")
+	}
+
+	second, _ := a.NextPart()
+	corrupted := second[:len(second)-1] + string(second[len(second)-1]^1)
+	if err := dec.Receive(corrupted); err == nil {
+		t.Fatal("corrupted part accepted")
+	}
+	for _, bad := range []string{"", "http://x", "ur:bytes/0-1/ae", "ur:BY TES/ae", "ur:bytes/1-2/zzzz"} {
+		if err := dec.Receive(bad); err == nil {
+			t.Fatalf("%q accepted", bad)
+		}
+	}
+	if _, err := dec.Result(); err == nil {
+		t.Fatal("incomplete decoder returned a result")
+	}
+}
+
+func TestEncoderRejects(t *testing.T) {
+	if _, err := NewEncoder(&UR{Type: "bytes"}, 100); err == nil {
+		t.Fatal("empty payload accepted")
+	}
+	if _, err := NewEncoder(&UR{Type: "bytes", CBOR: []byte{1}}, minFragmentLen-1); err == nil {
+		t.Fatal("tiny fragments accepted")
+	}
+}
@@ -0,0 +1,101 @@
+package ur
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UR is a Uniform Resource: a typed CBOR payload that can be carried in one
+// or more QR codes (BCR-2020-005)
+type UR struct {
+	Type string
+	CBOR []byte
+}
+
+// New creates a UR after checking the type name
+func New(urType string, cbor []byte) (*UR, error) {
+	if !validType(urType) {
+		return nil, fmt.Errorf("ur: invalid type %q", urType)
+	}
+	return &UR{Type: urType, CBOR: cbor}, nil
+}
+
+// String returns the single-part form, ur:<type>/<bytewords>
+func (u *UR) String() string {
+	return "ur:" + u.Type + "/" + EncodeBytewords(u.CBOR)
+}
+
+// Parse decodes a single-part UR string
+func Parse(s string) (*UR, error) {
+	urType, seq, body, err := splitUR(s)
+	if err != nil {
+		return nil, err
+	}
+	if seq != "" {
+		return nil, errors.New("ur: multipart UR needs a Decoder")
+	}
+	return decodeSingle(urType, body)
+}
+
+func decodeSingle(urType, body string) (*UR, error) {
+	data, err := DecodeBytewords(body)
+	if err != nil {
+		return nil, err
+	}
+	return &UR{Type: urType, CBOR: data}, nil
+}
+
+// splitUR separates the type, the optional "seq-len" component and the body
+func splitUR(s string) (urType, seq, body string, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !strings.HasPrefix(s, "ur:") {
+		return "", "", "", errors.New("ur: missing scheme")
+	}
+	parts := strings.Split(s[3:], "/")
+	switch len(parts) {
+	case 2:
+		urType, body = parts[0], parts[1]
+	case 3:
+		urType, seq, body = parts[0], parts[1], parts[2]
+		if _, _, err := parseSeq(seq); err != nil {
+			return "", "", "", err
+		}
+	default:
+		return "", "", "", errors.New("ur: malformed path")
+	}
+	if !validType(urType) {
+		return "", "", "", fmt.Errorf("ur: invalid type %q", urType)
+	}
+	return urType, seq, body, nil
+}
+
+func parseSeq(seq string) (int, int, error) {
+	num, total, ok := strings.Cut(seq, "-")
+	if !ok {
+		return 0, 0, errors.New("ur: malformed sequence")
+	}
+	n, err1 := strconv.Atoi(num)
+	t, err2 := strconv.Atoi(total)
+	if err1 != nil || err2 != nil || n < 1 || t < 1 {
+		return 0, 0, errors.New("ur: malformed sequence")
+	}
+	return n, t, nil
+}
+
+func formatPart(urType string, seqNum uint32, seqLen int, data []byte) string {
+	return fmt.Sprintf("ur:%s/%d-%d/%s", urType, seqNum, seqLen, EncodeBytewords(data))
+}
+
+func validType(t string) bool {
+	if t == "" {
+		return false
+	}
+	for _, c := range t {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
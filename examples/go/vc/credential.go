@@ -0,0 +1,311 @@
+package vc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+const (
+	// ProofType is the only supported proof suite
+	ProofType = "EthereumEip712Signature2021"
+
+	// CredentialContext is the W3C credentials context URI
+	CredentialContext = "https://www.w3.org/2018/credentials/v1"
+
+	// BaseType is the type every credential carries
+	BaseType = "VerifiableCredential"
+
+	primaryType = "VerifiableCredential"
+)
+
+var (
+	ErrNoProof          = errors.New("credential has no proof")
+	ErrUnsupportedProof = errors.New("unsupported proof type")
+	ErrNotYetValid      = errors.New("credential not yet valid")
+	ErrExpired          = errors.New("credential expired")
+	ErrBadSignature     = errors.New("signature does not match issuer")
+)
+
+// credentialTypes is the EIP-712 schema used to sign credentials.
+// Claims are encoded as a name-sorted array so arbitrary subjects fit a fixed schema.
+var credentialTypes = apitypes.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+	},
+	"VerifiableCredential": {
+		{Name: "context", Type: "string[]"},
+		{Name: "type", Type: "string[]"},
+		{Name: "id", Type: "string"},
+		{Name: "issuer", Type: "string"},
+		{Name: "issuanceDate", Type: "string"},
+		{Name: "expirationDate", Type: "string"},
+		{Name: "credentialSubject", Type: "CredentialSubject"},
+	},
+	"CredentialSubject": {
+		{Name: "id", Type: "string"},
+		{Name: "claims", Type: "Claim[]"},
+	},
+	"Claim": {
+		{Name: "name", Type: "string"},
+		{Name: "value", Type: "string"},
+	},
+}
+
+// Subject is the entity a credential makes claims about
+type Subject struct {
+	ID     string
+	Claims map[string]string
+}
+
+// MarshalJSON flattens claims into the subject object as the VC data model expects
+func (s Subject) MarshalJSON() ([]byte, error) {
+	m := make(map[string]string, len(s.Claims)+1)
+	for k, v := range s.Claims {
+		m[k] = v
+	}
+	m["id"] = s.ID
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON reads a flattened subject object
+func (s *Subject) UnmarshalJSON(data []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	s.ID = m["id"]
+	delete(m, "id")
+	s.Claims = m
+	return nil
+}
+
+// EIP712Metadata describes the typed data the proof signs
+type EIP712Metadata struct {
+	Domain      apitypes.TypedDataDomain `json:"domain"`
+	Types       apitypes.Types           `json:"types"`
+	PrimaryType string                   `json:"primaryType"`
+}
+
+// Proof is an EthereumEip712Signature2021 proof
+type Proof struct {
+	Type               string          `json:"type"`
+	Created            string          `json:"created"`
+	ProofPurpose       string          `json:"proofPurpose"`
+	VerificationMethod string          `json:"verificationMethod"`
+	ProofValue         string          `json:"proofValue"`
+	EIP712             *EIP712Metadata `json:"eip712"`
+}
+
+// Credential is a W3C verifiable credential
+type Credential struct {
+	Context           []string `json:"@context"`
+	ID                string   `json:"id,omitempty"`
+	Type              []string `json:"type"`
+	Issuer            string   `json:"issuer"`
+	IssuanceDate      string   `json:"issuanceDate"`
+	ExpirationDate    string   `json:"expirationDate,omitempty"`
+	CredentialSubject Subject  `json:"credentialSubject"`
+	Proof             *Proof   `json:"proof,omitempty"`
+}
+
+// HasType reports whether the credential declares the given type
+func (c *Credential) HasType(t string) bool {
+	for _, ct := range c.Type {
+		if ct == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Claim returns a subject claim by name
+func (c *Credential) Claim(name string) (string, bool) {
+	v, ok := c.CredentialSubject.Claims[name]
+	return v, ok
+}
+
+// IssueOptions controls credential issuance
+type IssueOptions struct {
+	ID       string
+	Types    []string
+	IssuedAt time.Time
+	ValidFor time.Duration
+}
+
+// Issue creates a credential about subject signed by the wallet key
+func Issue(w *wallet.Wallet, chainID *big.Int, subject DID, claims map[string]string, opts IssueOptions) (*Credential, error) {
+	issuedAt := opts.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	issuedAt = issuedAt.UTC()
+
+	c := &Credential{
+		Context:      []string{CredentialContext},
+		ID:           opts.ID,
+		Type:         append([]string{BaseType}, opts.Types...),
+		Issuer:       NewDID(chainID, w.Address).String(),
+		IssuanceDate: issuedAt.Format(time.RFC3339),
+		CredentialSubject: Subject{
+			ID:     subject.String(),
+			Claims: claims,
+		},
+	}
+	if opts.ValidFor > 0 {
+		c.ExpirationDate = issuedAt.Add(opts.ValidFor).Format(time.RFC3339)
+	}
+
+	meta := &EIP712Metadata{
+		Domain: apitypes.TypedDataDomain{
+			Name:    "WhisperChain Credentials",
+			Version: "1",
+			ChainId: (*math.HexOrDecimal256)(new(big.Int).Set(chainID)),
+		},
+		Types:       credentialTypes,
+		PrimaryType: primaryType,
+	}
+
+	hash, err := c.typedDataHash(meta)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := w.SignHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+
+	c.Proof = &Proof{
+		Type:               ProofType,
+		Created:            issuedAt.Format(time.RFC3339),
+		ProofPurpose:       "assertionMethod",
+		VerificationMethod: c.Issuer + "#blockchainAccountId",
+		ProofValue:         hexutil.Encode(sig),
+		EIP712:             meta,
+	}
+	return c, nil
+}
+
+// Verify checks the credential proof and validity window and returns the issuer
+func Verify(c *Credential, now time.Time) (DID, error) {
+	if c.Proof == nil || c.Proof.EIP712 == nil {
+		return DID{}, ErrNoProof
+	}
+	if c.Proof.Type != ProofType {
+		return DID{}, ErrUnsupportedProof
+	}
+
+	issuer, err := ParseDID(c.Issuer)
+	if err != nil {
+		return DID{}, err
+	}
+	if c.Proof.VerificationMethod != c.Issuer+"#blockchainAccountId" {
+		return DID{}, errors.New("verification method does not belong to issuer")
+	}
+
+	if err := checkValidity(c, now); err != nil {
+		return DID{}, err
+	}
+
+	hash, err := c.typedDataHash(c.Proof.EIP712)
+	if err != nil {
+		return DID{}, err
+	}
+
+	sig, err := hexutil.Decode(c.Proof.ProofValue)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return DID{}, errors.New("malformed proof value")
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return DID{}, err
+	}
+	if crypto.PubkeyToAddress(*pub) != issuer.Address {
+		return DID{}, ErrBadSignature
+	}
+	return issuer, nil
+}
+
+// checkValidity enforces issuance and expiration dates
+func checkValidity(c *Credential, now time.Time) error {
+	issued, err := time.Parse(time.RFC3339, c.IssuanceDate)
+	if err != nil {
+		return fmt.Errorf("invalid issuanceDate: %w", err)
+	}
+	if now.Before(issued) {
+		return ErrNotYetValid
+	}
+
+	if c.ExpirationDate != "" {
+		expires, err := time.Parse(time.RFC3339, c.ExpirationDate)
+		if err != nil {
+			return fmt.Errorf("invalid expirationDate: %w", err)
+		}
+		if !now.Before(expires) {
+			return ErrExpired
+		}
+	}
+	return nil
+}
+
+// typedDataHash computes the EIP-712 digest of the credential without its proof
+func (c *Credential) typedDataHash(meta *EIP712Metadata) ([]byte, error) {
+	names := make([]string, 0, len(c.CredentialSubject.Claims))
+	for name := range c.CredentialSubject.Claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	claims := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		claims = append(claims, map[string]interface{}{
+			"name":  name,
+			"value": c.CredentialSubject.Claims[name],
+		})
+	}
+
+	typedData := apitypes.TypedData{
+		Types:       meta.Types,
+		PrimaryType: meta.PrimaryType,
+		Domain:      meta.Domain,
+		Message: apitypes.TypedDataMessage{
+			"context":        toInterfaces(c.Context),
+			"type":           toInterfaces(c.Type),
+			"id":             c.ID,
+			"issuer":         c.Issuer,
+			"issuanceDate":   c.IssuanceDate,
+			"expirationDate": c.ExpirationDate,
+			"credentialSubject": map[string]interface{}{
+				"id":     c.CredentialSubject.ID,
+				"claims": claims,
+			},
+		},
+	}
+
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	return hash, err
+}
+
+func toInterfaces(ss []string) []interface{} {
+	out := make([]interface{}, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package vc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// pkhPrefix is the method prefix for EVM account DIDs
+const pkhPrefix = "did:pkh:eip155:"
+
+// DID is a did:pkh identifier for an EVM account
+type DID struct {
+	ChainID *big.Int
+	Address common.Address
+}
+
+// NewDID creates a did:pkh identifier for an address on a chain
+func NewDID(chainID *big.Int, address common.Address) DID {
+	return DID{ChainID: new(big.Int).Set(chainID), Address: address}
+}
+
+// String returns the did:pkh:eip155:<chainId>:<address> form
+func (d DID) String() string {
+	return pkhPrefix + d.ChainID.String() + ":" + d.Address.Hex()
+}
+
+// ParseDID parses a did:pkh:eip155 identifier
+func ParseDID(s string) (DID, error) {
+	if !strings.HasPrefix(s, pkhPrefix) {
+		return DID{}, fmt.Errorf("unsupported DID %q", s)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s, pkhPrefix), ":")
+	if len(parts) != 2 {
+		return DID{}, fmt.Errorf("malformed did:pkh %q", s)
+	}
+
+	chainID, ok := new(big.Int).SetString(parts[0], 10)
+	if !ok || chainID.Sign() <= 0 {
+		return DID{}, fmt.Errorf("invalid chain id in %q", s)
+	}
+	if !common.IsHexAddress(parts[1]) {
+		return DID{}, fmt.Errorf("invalid address in %q", s)
+	}
+
+	return DID{ChainID: chainID, Address: common.HexToAddress(parts[1])}, nil
+}
@@ -0,0 +1,298 @@
+// Package vectors generates and checks the canonical protocol test vectors:
+// keys, signatures, ECIES ciphertexts and envelopes, as JSON that the
+// WhisperChain implementations in other languages load to assert byte-level
+// compatibility with this module. The published vectors are committed in
+// testdata; regenerate them with go generate after changing a format
+package vectors
+
+//go:generate go run ../cmd/vectors generate -out testdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/whisperchain/go-examples/entropy"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Version is the vector format version; it changes when a field's meaning does
+const Version = 1
+
+// DefaultSeed is the seed of the published vectors
+const DefaultSeed = "whisperchain-test-vectors-v1"
+
+// timestamp is the fixed envelope time, so vectors do not change between runs
+const timestamp = 1700000000
+
+// Signature schemes
+const (
+	// SchemeRaw signs keccak256(message) with v of 0 or 1, as SignMessage
+	SchemeRaw = "raw"
+	// SchemePersonal signs the EIP-191 personal message hash with v of 27 or
+	// 28, as SignPersonalMessage
+	SchemePersonal = "personal"
+)
+
+// KeyCase derives a public key and address from a private key
+type KeyCase struct {
+	Name       string         `json:"name"`
+	PrivateKey hexutil.Bytes  `json:"privateKey"`
+	PublicKey  hexutil.Bytes  `json:"publicKey"` // uncompressed, 65 bytes
+	Address    common.Address `json:"address"`
+}
+
+// SignatureCase is a deterministic (RFC 6979) signature over a message
+type SignatureCase struct {
+	Name       string         `json:"name"`
+	Scheme     string         `json:"scheme"`
+	PrivateKey hexutil.Bytes  `json:"privateKey"`
+	Message    hexutil.Bytes  `json:"message"`
+	Hash       hexutil.Bytes  `json:"hash"`
+	Signature  hexutil.Bytes  `json:"signature"`
+	Address    common.Address `json:"address"`
+}
+
+// CiphertextCase is an ECIES ciphertext to decrypt. Encryption is
+// randomized, so implementations check decryption, not re-encryption
+type CiphertextCase struct {
+	Name       string        `json:"name"`
+	PrivateKey hexutil.Bytes `json:"privateKey"` // recipient
+	Plaintext  hexutil.Bytes `json:"plaintext"`
+	Ciphertext hexutil.Bytes `json:"ciphertext"`
+}
+
+// EnvelopeCase is a serialized envelope with what a receiver must conclude
+// from it. Invalid cases must be rejected: by decoding when Decodes is
+// false, otherwise by verification
+type EnvelopeCase struct {
+	Name           string          `json:"name"`
+	Envelope       json.RawMessage `json:"envelope"`
+	Decodes        bool            `json:"decodes"`
+	Valid          bool            `json:"valid"`
+	SigningPayload hexutil.Bytes   `json:"signingPayload,omitempty"` // bytes the ID hashes and the sender signs
+	ID             common.Hash     `json:"id"`
+	RecipientKey   hexutil.Bytes   `json:"recipientKey,omitempty"`
+	Plaintext      hexutil.Bytes   `json:"plaintext,omitempty"` // of valid cases
+}
+
+// Suite is a full set of vectors
+type Suite struct {
+	Version     int              `json:"version"`
+	Seed        string           `json:"seed"`
+	Keys        []KeyCase        `json:"keys"`
+	Signatures  []SignatureCase  `json:"signatures"`
+	Ciphertexts []CiphertextCase `json:"ciphertexts"`
+	Envelopes   []EnvelopeCase   `json:"envelopes"`
+}
+
+// Generate builds the vectors for seed. Keys and ECIES randomness come from
+// the seed and signatures are deterministic, so a seed always gives the same
+// suite
+func Generate(seed string) (*Suite, error) {
+	rand := entropy.NewDeterministic(seed)
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		k, err := wallet.GenerateKey(rand)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = k
+	}
+	alice, bob, carol := keys[0], keys[1], keys[2]
+	s := &Suite{Version: Version, Seed: seed}
+
+	for i, k := range keys {
+		s.Keys = append(s.Keys, KeyCase{
+			Name:       fmt.Sprintf("key-%d", i),
+			PrivateKey: crypto.FromECDSA(k),
+			PublicKey:  crypto.FromECDSAPub(&k.PublicKey),
+			Address:    crypto.PubkeyToAddress(k.PublicKey),
+		})
+	}
+
+	for _, m := range []struct{ name, msg string }{
+		{"empty", ""},
+		{"ascii", "hello whisperchain"},
+		{"utf8", "привет, 世界 👋"},
+	} {
+		w := wallet.NewWalletFromClient(alice, nil)
+		raw, err := w.SignMessage([]byte(m.msg))
+		if err != nil {
+			return nil, err
+		}
+		personal, err := w.SignPersonalMessage([]byte(m.msg))
+		if err != nil {
+			return nil, err
+		}
+		s.Signatures = append(s.Signatures,
+			SignatureCase{Name: "raw-" + m.name, Scheme: SchemeRaw, PrivateKey: crypto.FromECDSA(alice), Message: []byte(m.msg),
+				Hash: crypto.Keccak256([]byte(m.msg)), Signature: raw, Address: w.Address},
+			SignatureCase{Name: "personal-" + m.name, Scheme: SchemePersonal, PrivateKey: crypto.FromECDSA(alice), Message: []byte(m.msg),
+				Hash: wallet.PersonalMessageHash([]byte(m.msg)), Signature: personal, Address: w.Address},
+		)
+	}
+
+	for _, p := range []struct{ name, text string }{
+		{"short", "hi"},
+		{"block-aligned", "0123456789abcdef"},
+		{"long", "WhisperChain envelopes carry ECIES ciphertexts: an ephemeral public key, an AES-128-CTR body and an HMAC-SHA256 tag"},
+	} {
+		ct, err := ecies.Encrypt(rand, ecies.ImportECDSAPublic(&bob.PublicKey), []byte(p.text), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.Ciphertexts = append(s.Ciphertexts, CiphertextCase{Name: p.name, PrivateKey: crypto.FromECDSA(bob), Plaintext: []byte(p.text), Ciphertext: ct})
+	}
+
+	envs, err := envelopeCases(rand, alice, bob, carol)
+	if err != nil {
+		return nil, err
+	}
+	s.Envelopes = envs
+	return s, nil
+}
+
+// envelopeCases builds envelopes from alice to bob: valid ones covering the
+// optional fields, and ones a receiver must reject
+func envelopeCases(rand *entropy.Deterministic, alice, bob, carol *ecdsa.PrivateKey) ([]EnvelopeCase, error) {
+	sender := wallet.NewWalletFromClient(alice, nil)
+	sealCompressed := func(topic string, plaintext []byte, order *messaging.Order, compression string, attachments ...messaging.Attachment) (*messaging.Envelope, error) {
+		body := plaintext
+		if compression == messaging.CompressionGzip {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(plaintext); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			body = buf.Bytes()
+		}
+		ct, err := ecies.Encrypt(rand, ecies.ImportECDSAPublic(&bob.PublicKey), body, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		env := &messaging.Envelope{
+			Version:     messaging.EnvelopeVersion,
+			Topic:       topic,
+			Sender:      sender.Address,
+			Recipient:   crypto.PubkeyToAddress(bob.PublicKey),
+			Timestamp:   timestamp,
+			Attachments: attachments,
+			Order:       order,
+			Compression: compression,
+			Ciphertext:  ct,
+		}
+		return env, env.Sign(sender)
+	}
+	seal := func(topic string, plaintext []byte, order *messaging.Order, attachments ...messaging.Attachment) (*messaging.Envelope, error) {
+		return sealCompressed(topic, plaintext, order, messaging.CompressionNone, attachments...)
+	}
+
+	msg, err := json.Marshal(&messaging.Message{Type: "text", Body: json.RawMessage(`{"text":"hello bob"}`)})
+	if err != nil {
+		return nil, err
+	}
+	var cases []EnvelopeCase
+	add := func(name string, env *messaging.Envelope, plaintext []byte, decodes, valid bool) error {
+		c, err := envelopeCase(name, env, bob, plaintext, decodes, valid)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, c)
+		return nil
+	}
+
+	basic, err := seal("dm", []byte("hello bob"), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := add("basic", basic, []byte("hello bob"), true, true); err != nil {
+		return nil, err
+	}
+	typed, err := seal("dm", msg, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := add("typed-message", typed, msg, true, true); err != nil {
+		return nil, err
+	}
+	attached, err := seal("files", []byte("see attached"), nil, messaging.Attachment{Type: "image/png", Size: 2048, Hash: crypto.Keccak256Hash([]byte("image"))})
+	if err != nil {
+		return nil, err
+	}
+	if err := add("attachment", attached, []byte("see attached"), true, true); err != nil {
+		return nil, err
+	}
+	// deps are a map; JSON object keys are sorted, which pins their order
+	ordered, err := seal("group/general", []byte("ordered"), &messaging.Order{Seq: 3, Lamport: 7, Deps: map[common.Address]uint64{
+		crypto.PubkeyToAddress(carol.PublicKey): 2,
+		crypto.PubkeyToAddress(bob.PublicKey):   5,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if err := add("ordered", ordered, []byte("ordered"), true, true); err != nil {
+		return nil, err
+	}
+
+	long := bytes.Repeat([]byte("compressible "), 40)
+	compressed, err := sealCompressed("dm", long, nil, messaging.CompressionGzip)
+	if err != nil {
+		return nil, err
+	}
+	if err := add("gzip", compressed, long, true, true); err != nil {
+		return nil, err
+	}
+
+	tampered := *basic
+	tampered.Ciphertext = append(hexutil.Bytes(nil), basic.Ciphertext...)
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 1
+	if err := add("tampered-ciphertext", &tampered, nil, true, false); err != nil {
+		return nil, err
+	}
+	// carol claims alice's envelope: the ID matches the new content, but the
+	// signature recovers to alice
+	forged := *basic
+	forged.Sender = crypto.PubkeyToAddress(carol.PublicKey)
+	if forged.ID, err = forged.Hash(); err != nil {
+		return nil, err
+	}
+	if err := add("wrong-signer", &forged, nil, true, false); err != nil {
+		return nil, err
+	}
+	future := *basic
+	future.Version = messaging.EnvelopeVersion + 1
+	if err := add("unsupported-version", &future, nil, false, false); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+func envelopeCase(name string, env *messaging.Envelope, recipient *ecdsa.PrivateKey, plaintext []byte, decodes, valid bool) (EnvelopeCase, error) {
+	data, err := env.Encode()
+	if err != nil {
+		return EnvelopeCase{}, err
+	}
+	c := EnvelopeCase{Name: name, Envelope: data, Decodes: decodes, Valid: valid}
+	if decodes {
+		if c.SigningPayload, err = env.SigningPayload(); err != nil {
+			return EnvelopeCase{}, err
+		}
+		c.ID = env.ID
+	}
+	if valid {
+		c.RecipientKey = crypto.FromECDSA(recipient)
+		c.Plaintext = plaintext
+	}
+	return c, nil
+}
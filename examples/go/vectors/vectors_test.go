@@ -0,0 +1,51 @@
+package vectors
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTestdataMatchesGenerate fails when the committed vectors drift from
+// what Generate produces, so a change to a format or to the code behind it
+// shows up as a diff to review and publish
+func TestTestdataMatchesGenerate(t *testing.T) {
+	s, err := Generate(DefaultSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := s.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		want, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("testdata/%s is out of date; run go generate ./vectors", name)
+		}
+	}
+}
+
+func TestTestdataVerifies(t *testing.T) {
+	s, err := Read("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Seed != DefaultSeed {
+		t.Fatalf("testdata seed %q, want %q", s.Seed, DefaultSeed)
+	}
+	if len(s.Keys) == 0 || len(s.Signatures) == 0 || len(s.Ciphertexts) == 0 || len(s.Envelopes) == 0 {
+		t.Fatal("testdata is missing cases")
+	}
+	if err := s.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,199 @@
+package vectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/whisperchain/go-examples/messaging"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// ErrMismatch is returned by Verify for each case this module disagrees with
+var ErrMismatch = errors.New("vectors: case does not match")
+
+// files maps each vector file to the part of the suite it holds
+var files = []string{"keys.json", "signatures.json", "ciphertexts.json", "envelopes.json"}
+
+// file is the layout of one vector file
+type file struct {
+	Version int             `json:"version"`
+	Seed    string          `json:"seed"`
+	Cases   json.RawMessage `json:"cases"`
+}
+
+// Write saves the suite to dir as one file per kind of case, so an
+// implementation can adopt them one at a time
+func (s *Suite) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for i, cases := range s.parts() {
+		raw, err := json.Marshal(cases)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(file{Version: s.Version, Seed: s.Seed, Cases: raw}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, files[i]), append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read loads a suite written by Write
+func Read(dir string) (*Suite, error) {
+	s := &Suite{}
+	for i, cases := range s.parts() {
+		data, err := os.ReadFile(filepath.Join(dir, files[i]))
+		if err != nil {
+			return nil, err
+		}
+		var f file
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", files[i], err)
+		}
+		if f.Version != Version {
+			return nil, fmt.Errorf("%s: unsupported vector version %d", files[i], f.Version)
+		}
+		if err := json.Unmarshal(f.Cases, cases); err != nil {
+			return nil, fmt.Errorf("%s: %w", files[i], err)
+		}
+		s.Version, s.Seed = f.Version, f.Seed
+	}
+	return s, nil
+}
+
+func (s *Suite) parts() []interface{} {
+	return []interface{}{&s.Keys, &s.Signatures, &s.Ciphertexts, &s.Envelopes}
+}
+
+// Verify checks every case against this module's implementation and returns
+// one ErrMismatch per failing case, joined, or nil. Vectors written by
+// another implementation verify the same way
+func (s *Suite) Verify() error {
+	var errs []error
+	fail := func(kind, name, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: %s %s: %s", ErrMismatch, kind, name, fmt.Sprintf(format, args...)))
+	}
+
+	for _, c := range s.Keys {
+		key, err := crypto.ToECDSA(c.PrivateKey)
+		if err != nil {
+			fail("key", c.Name, "%v", err)
+			continue
+		}
+		if pub := crypto.FromECDSAPub(&key.PublicKey); !bytes.Equal(pub, c.PublicKey) {
+			fail("key", c.Name, "public key %x", pub)
+		}
+		if addr := crypto.PubkeyToAddress(key.PublicKey); addr != c.Address {
+			fail("key", c.Name, "address %s", addr.Hex())
+		}
+	}
+
+	for _, c := range s.Signatures {
+		key, err := crypto.ToECDSA(c.PrivateKey)
+		if err != nil {
+			fail("signature", c.Name, "%v", err)
+			continue
+		}
+		w := wallet.NewWalletFromClient(key, nil)
+		var (
+			hash, sig []byte
+			ok        bool
+		)
+		switch c.Scheme {
+		case SchemeRaw:
+			hash = crypto.Keccak256(c.Message)
+			sig, err = w.SignMessage(c.Message)
+			ok = wallet.VerifySignature(c.Message, c.Signature, c.Address)
+		case SchemePersonal:
+			hash = wallet.PersonalMessageHash(c.Message)
+			sig, err = w.SignPersonalMessage(c.Message)
+			ok = wallet.VerifyPersonalSignature(c.Message, c.Signature, c.Address)
+		default:
+			fail("signature", c.Name, "unknown scheme %q", c.Scheme)
+			continue
+		}
+		switch {
+		case err != nil:
+			fail("signature", c.Name, "%v", err)
+		case !bytes.Equal(hash, c.Hash):
+			fail("signature", c.Name, "hash %x", hash)
+		case !bytes.Equal(sig, c.Signature):
+			fail("signature", c.Name, "signature %x", sig)
+		case !ok:
+			fail("signature", c.Name, "does not verify for %s", c.Address.Hex())
+		}
+	}
+
+	for _, c := range s.Ciphertexts {
+		key, err := crypto.ToECDSA(c.PrivateKey)
+		if err != nil {
+			fail("ciphertext", c.Name, "%v", err)
+			continue
+		}
+		plaintext, err := ecies.ImportECDSA(key).Decrypt(c.Ciphertext, nil, nil)
+		if err != nil {
+			fail("ciphertext", c.Name, "%v", err)
+		} else if !bytes.Equal(plaintext, c.Plaintext) {
+			fail("ciphertext", c.Name, "plaintext %x", plaintext)
+		}
+	}
+
+	for _, c := range s.Envelopes {
+		if err := verifyEnvelope(c); err != nil {
+			fail("envelope", c.Name, "%v", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func verifyEnvelope(c EnvelopeCase) error {
+	env, err := messaging.DecodeEnvelope(c.Envelope)
+	if !c.Decodes {
+		if err == nil {
+			return errors.New("decodes but should be rejected")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	payload, err := env.SigningPayload()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(payload, c.SigningPayload) {
+		return fmt.Errorf("signing payload %s", payload)
+	}
+	if env.ID != c.ID {
+		return fmt.Errorf("id %s", env.ID.Hex())
+	}
+	if valid := env.Verify(); valid != c.Valid {
+		return fmt.Errorf("verifies %t", valid)
+	}
+	if !c.Valid {
+		return nil
+	}
+	key, err := crypto.ToECDSA(c.RecipientKey)
+	if err != nil {
+		return err
+	}
+	plaintext, err := env.Open(key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(plaintext, c.Plaintext) {
+		return fmt.Errorf("plaintext %x", plaintext)
+	}
+	return nil
+}
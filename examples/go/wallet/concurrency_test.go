@@ -0,0 +1,307 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// simulatedEth is an in-process node for the eth methods a sending wallet
+// calls. Like a real node it checks each transaction's signature, chain and
+// funds, and rejects one that is not at the sender's next nonce, so two
+// sends racing for a nonce fail instead of passing unnoticed. Nonce reads
+// take a millisecond, as a remote node's would, to widen the race
+type simulatedEth struct {
+	mu       sync.Mutex
+	chainID  *big.Int
+	nonces   map[common.Address]uint64
+	balances map[common.Address]*big.Int
+	txs      []*types.Transaction
+}
+
+func (s *simulatedEth) ChainId() *hexutil.Big { return (*hexutil.Big)(s.chainID) }
+
+func (s *simulatedEth) GetTransactionCount(addr common.Address, block string) hexutil.Uint64 {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return hexutil.Uint64(s.nonces[addr])
+}
+
+func (s *simulatedEth) GetCode(addr common.Address, block string) hexutil.Bytes { return nil }
+
+func (s *simulatedEth) EstimateGas(args map[string]interface{}) hexutil.Uint64 { return 21000 }
+
+func (s *simulatedEth) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Hash{}, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(s.chainID), tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch next := s.nonces[from]; {
+	case tx.Nonce() < next:
+		return common.Hash{}, fmt.Errorf("nonce too low: address %s, tx: %d state: %d", from.Hex(), tx.Nonce(), next)
+	case tx.Nonce() > next:
+		return common.Hash{}, fmt.Errorf("nonce too high: address %s, tx: %d state: %d", from.Hex(), tx.Nonce(), next)
+	}
+	cost := tx.Cost()
+	balance := s.balances[from]
+	if balance == nil || balance.Cmp(cost) < 0 {
+		return common.Hash{}, errors.New("insufficient funds for gas * price + value")
+	}
+	balance.Sub(balance, cost)
+	if s.balances[*tx.To()] == nil {
+		s.balances[*tx.To()] = new(big.Int)
+	}
+	s.balances[*tx.To()].Add(s.balances[*tx.To()], tx.Value())
+	s.nonces[from]++
+	s.txs = append(s.txs, tx)
+	return tx.Hash(), nil
+}
+
+// newSimulated returns a wallet with a funded key on a simulated node
+func newSimulated(t *testing.T) (*Wallet, *simulatedEth) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	node := &simulatedEth{
+		chainID:  big.NewInt(1337),
+		nonces:   make(map[common.Address]uint64),
+		balances: map[common.Address]*big.Int{addr: new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))},
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+	client := ethclient.NewClient(rpc.DialInProc(srv))
+	t.Cleanup(client.Close)
+	return NewWalletFromClient(key, client), node
+}
+
+// fixedGwei returns a fixed legacy gas price of n gwei
+func fixedGwei(n int64) FixedGasPrice {
+	return FixedGasPrice{Price: new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9))}
+}
+
+func TestConcurrentSendsUseUniqueNonces(t *testing.T) {
+	for _, managed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("txmanager=%v", managed), func(t *testing.T) {
+			ctx := context.Background()
+			w, node := newSimulated(t)
+			w.SetGasStrategy(fixedGwei(10))
+			if !managed {
+				// Sends then take the node's pending nonce under the wallet's lock
+				w.SetTxManager(nil)
+			}
+			to := common.HexToAddress("0x000000000000000000000000000000000000beef")
+
+			const senders, each = 8, 5
+			var (
+				wg   sync.WaitGroup
+				mu   sync.Mutex
+				sent []*types.Transaction
+				errs []error
+			)
+			for i := 0; i < senders; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < each; j++ {
+						var (
+							tx  *types.Transaction
+							err error
+						)
+						if (i+j)%2 == 0 {
+							tx, err = w.Transfer(ctx, to, units.WeiFromUint64(1))
+						} else {
+							tx, err = w.SendTx(ctx, to, units.WeiFromUint64(1), &TxOpts{GasLimit: 21000})
+						}
+						mu.Lock()
+						sent, errs = append(sent, tx), append(errs, err)
+						mu.Unlock()
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			nonces := make(map[uint64]bool)
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("send %d: %v", i, err)
+				}
+				if nonces[sent[i].Nonce()] {
+					t.Fatalf("nonce %d sent twice", sent[i].Nonce())
+				}
+				nonces[sent[i].Nonce()] = true
+			}
+			for n := uint64(0); n < senders*each; n++ {
+				if !nonces[n] {
+					t.Fatalf("nonce %d skipped", n)
+				}
+			}
+
+			if n, err := w.GetNonce(ctx); err != nil || n != senders*each || len(node.txs) != senders*each {
+				t.Fatalf("node nonce %d, %v, with %d transactions; want %d", n, err, len(node.txs), senders*each)
+			}
+		})
+	}
+}
+
+func TestSendsReadOneSettingsSnapshot(t *testing.T) {
+	ctx := context.Background()
+	w, _ := newSimulated(t)
+	to := common.HexToAddress("0x000000000000000000000000000000000000beef")
+
+	// Generation k sets a gas price of 10+k gwei, then wraps the sign hook
+	// with layer k. A send reading one snapshot sees either both of
+	// generation k or the price of k with the hooks up to k-1; a send that
+	// read the hook later than the strategy could see newer layers
+	const generations = 40
+	var (
+		mu     sync.Mutex
+		layers = make(map[common.Hash][]int) // hook layers run per transaction, outermost first
+	)
+	w.SetGasStrategy(fixedGwei(10))
+	w.SetOnSign(func(tx *types.Transaction) error { return nil })
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for k := 1; k <= generations; k++ {
+			w.SetGasStrategy(fixedGwei(int64(10 + k)))
+			k := k
+			w.WrapSignHook(func(next SignHook) SignHook {
+				return func(tx *types.Transaction) error {
+					mu.Lock()
+					layers[tx.Hash()] = append(layers[tx.Hash()], k)
+					mu.Unlock()
+					return next(tx)
+				}
+			})
+		}
+	}()
+
+	const senders, each = 6, 8
+	var (
+		sentMu sync.Mutex
+		sent   []*types.Transaction
+	)
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				tx, err := w.Transfer(ctx, to, units.WeiFromUint64(1))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				sentMu.Lock()
+				sent = append(sent, tx)
+				sentMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	for _, tx := range sent {
+		price := new(big.Int).Div(tx.GasPrice(), big.NewInt(1e9)).Int64()
+		gen := int(price - 10)
+		got := layers[tx.Hash()]
+		top := 0
+		if len(got) > 0 {
+			top = got[0]
+		}
+		if top != gen && top != gen-1 {
+			t.Fatalf("nonce %d priced by generation %d but signed with hooks up to %d", tx.Nonce(), gen, top)
+		}
+		for i, k := range got {
+			if k != top-i {
+				t.Fatalf("nonce %d ran hook layers %v", tx.Nonce(), got)
+			}
+		}
+	}
+}
+
+func TestWrapSignHookKeepsConcurrentLayers(t *testing.T) {
+	ctx := context.Background()
+	w, _ := newSimulated(t)
+	w.SetGasStrategy(fixedGwei(10))
+	to := common.HexToAddress("0x000000000000000000000000000000000000beef")
+
+	const hooks = 32
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		calls = make(map[int]int)
+	)
+	for i := 0; i < hooks; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			w.WrapSignHook(func(next SignHook) SignHook {
+				return func(tx *types.Transaction) error {
+					mu.Lock()
+					calls[i]++
+					mu.Unlock()
+					if next == nil {
+						return nil
+					}
+					return next(tx)
+				}
+			})
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := w.Transfer(ctx, to, units.WeiFromUint64(1)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	mu.Lock()
+	for k := range calls {
+		delete(calls, k)
+	}
+	mu.Unlock()
+	if _, err := w.Transfer(ctx, to, units.WeiFromUint64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != hooks {
+		t.Fatalf("%d of %d hooks in the chain", len(calls), hooks)
+	}
+	for i, n := range calls {
+		if n != 1 {
+			t.Fatalf("hook %d ran %d times", i, n)
+		}
+	}
+}
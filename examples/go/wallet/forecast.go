@@ -0,0 +1,307 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// maxBaseFeeChange is the most the base fee moves per block under EIP-1559
+const maxBaseFeeChange = 0.125
+
+// fullBlock is the gas used ratio above which a block is treated as full, so
+// only tips that outbid its other transactions would have been included
+const fullBlock = 0.95
+
+// ErrNoBaseFee is returned when forecasting on a chain without EIP-1559
+var ErrNoBaseFee = errors.New("chain has no base fee to forecast")
+
+// Inclusion is a target for how soon a transaction should be mined
+type Inclusion struct {
+	Blocks      int     // horizon in blocks; at least 1
+	Probability float64 // wanted chance of inclusion within Blocks, in (0, 1)
+}
+
+// Forecast is the chance that a fee level is mined within a horizon
+type Forecast struct {
+	Blocks      int
+	GasTipCap   *big.Int
+	GasFeeCap   *big.Int
+	Probability float64
+}
+
+// String describes the forecast, e.g. "likely in 1 block at 23.5 gwei"
+func (f *Forecast) String() string {
+	likely := "likely"
+	switch {
+	case f.Probability < 0.5:
+		likely = "unlikely"
+	case f.Probability < 0.8:
+		likely = "possibly"
+	}
+	unit := "blocks"
+	if f.Blocks == 1 {
+		unit = "block"
+	}
+	return fmt.Sprintf("%s in %d %s at %s gwei (%.0f%%, tip %s gwei)",
+		likely, f.Blocks, unit, gwei(f.GasFeeCap), f.Probability*100, gwei(f.GasTipCap))
+}
+
+// FeeHistory is the fee data a forecast is made from
+type FeeHistory struct {
+	Percentiles  []float64    // reward percentiles, ascending
+	Rewards      [][]*big.Int // per block, the tip paid at each percentile
+	BaseFees     []*big.Int   // per block, plus the next block's last
+	GasUsedRatio []float64
+}
+
+// FeeForecaster predicts inclusion from eth_feeHistory: how often each
+// recent block would have taken a tip, and where the base fee is heading
+type FeeForecaster struct {
+	Blocks      uint64    // history length; default 20
+	Percentiles []float64 // default 10, 25, 50, 75, 90
+}
+
+// DefaultForecaster is used by TxOpts.Inclusion
+var DefaultForecaster = &FeeForecaster{}
+
+// History fetches fee history for the latest blocks
+func (f *FeeForecaster) History(ctx context.Context, client *ethclient.Client) (*FeeHistory, error) {
+	percentiles := f.Percentiles
+	if len(percentiles) == 0 {
+		percentiles = []float64{10, 25, 50, 75, 90}
+	}
+	blocks := f.Blocks
+	if blocks == 0 {
+		blocks = 20
+	}
+	h, err := client.FeeHistory(ctx, blocks, nil, percentiles)
+	if err != nil {
+		return nil, err
+	}
+	return newFeeHistory(h, percentiles)
+}
+
+// Forecast returns the chance of inclusion within blocks at each sampled tip
+// level, with fee caps covering the projected base fee
+func (f *FeeForecaster) Forecast(ctx context.Context, client *ethclient.Client, blocks int) ([]Forecast, error) {
+	h, err := f.History(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return h.Levels(blocks), nil
+}
+
+// Target returns the cheapest sampled fees meeting the inclusion target, or
+// the most likely ones when none does
+func (f *FeeForecaster) Target(ctx context.Context, client *ethclient.Client, target Inclusion) (*Forecast, error) {
+	h, err := f.History(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return h.Target(target), nil
+}
+
+// Fees implements GasStrategy for an inclusion target
+func (t Inclusion) Fees(ctx context.Context, client *ethclient.Client) (*Fees, error) {
+	fc, err := DefaultForecaster.Target(ctx, client, t)
+	if errors.Is(err, ErrNoBaseFee) {
+		return LegacyStrategy{}.Fees(ctx, client)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Fees{GasFeeCap: fc.GasFeeCap, GasTipCap: fc.GasTipCap}, nil
+}
+
+// Levels forecasts each sampled tip level, cheapest first
+func (h *FeeHistory) Levels(blocks int) []Forecast {
+	var out []Forecast
+	for _, tip := range h.tips() {
+		out = append(out, h.Forecast(tip, h.FeeCap(tip, blocks), blocks))
+	}
+	return out
+}
+
+// Target returns the cheapest sampled fees meeting the inclusion target, or
+// the most likely ones when none does
+func (h *FeeHistory) Target(target Inclusion) *Forecast {
+	blocks := target.Blocks
+	if blocks < 1 {
+		blocks = 1
+	}
+	var best *Forecast
+	for _, fc := range h.Levels(blocks) {
+		fc := fc
+		if fc.Probability >= target.Probability {
+			return &fc
+		}
+		if best == nil || fc.Probability > best.Probability {
+			best = &fc
+		}
+	}
+	return best
+}
+
+// FeeCap returns a fee cap covering the base fee for blocks blocks if it
+// rises at the fastest rate seen recently, plus tip
+func (h *FeeHistory) FeeCap(tip *big.Int, blocks int) *big.Int {
+	worst := h.BaseFees[len(h.BaseFees)-1]
+	for k := 1; k < blocks; k++ {
+		if next := h.projectedBaseFee(k, true); next.Cmp(worst) > 0 {
+			worst = next
+		}
+	}
+	return new(big.Int).Add(worst, tip)
+}
+
+// Forecast estimates the chance that a transaction paying tip up to feeCap
+// is mined within blocks blocks. Each future block takes the tip as often as
+// the recent blocks would have, once its projected base fee leaves room
+func (h *FeeHistory) Forecast(tip, feeCap *big.Int, blocks int) Forecast {
+	if blocks < 1 {
+		blocks = 1
+	}
+	miss := 1.0
+	for k := 0; k < blocks; k++ {
+		base := h.projectedBaseFee(k, false)
+		if feeCap.Cmp(base) < 0 {
+			continue
+		}
+		effective := new(big.Int).Sub(feeCap, base)
+		if effective.Cmp(tip) > 0 {
+			effective = tip
+		}
+		miss *= 1 - h.blockChance(effective)
+	}
+	return Forecast{Blocks: blocks, GasTipCap: tip, GasFeeCap: feeCap, Probability: 1 - miss}
+}
+
+// blockChance is the share of recent blocks that would have included tip. A
+// block with spare room takes any tip its cheapest sampled transaction paid;
+// a full one takes it by how much of its gas it outbids
+func (h *FeeHistory) blockChance(tip *big.Int) float64 {
+	if len(h.Rewards) == 0 {
+		return 0
+	}
+	var sum float64
+	for i, rewards := range h.Rewards {
+		if len(rewards) == 0 {
+			// Empty block; anything paying a tip would have fit
+			if tip.Sign() > 0 {
+				sum++
+			}
+			continue
+		}
+		if tip.Cmp(rewards[0]) < 0 {
+			continue
+		}
+		if h.GasUsedRatio[i] < fullBlock {
+			sum++
+			continue
+		}
+		rank := h.Percentiles[0] / 100
+		for j, r := range rewards {
+			if tip.Cmp(r) >= 0 {
+				rank = h.Percentiles[j] / 100
+			}
+		}
+		sum += rank
+	}
+	return sum / float64(len(h.Rewards))
+}
+
+// projectedBaseFee is the base fee k blocks after the next one, following
+// the recent trend, or the steepest recent rise when worst is set
+func (h *FeeHistory) projectedBaseFee(k int, worst bool) *big.Int {
+	next := h.BaseFees[len(h.BaseFees)-1]
+	if k == 0 {
+		return next
+	}
+	rate := h.trend(worst)
+	scaled, _ := new(big.Float).Mul(new(big.Float).SetInt(next), big.NewFloat(math.Pow(1+rate, float64(k)))).Int(nil)
+	return scaled
+}
+
+// trend is the mean per-block base fee change, or the largest when worst is
+// set, clamped to what the protocol allows
+func (h *FeeHistory) trend(worst bool) float64 {
+	var sum, max float64
+	n := 0
+	for i := 1; i < len(h.BaseFees); i++ {
+		prev, cur := h.BaseFees[i-1], h.BaseFees[i]
+		if prev.Sign() == 0 {
+			continue
+		}
+		change, _ := new(big.Rat).SetFrac(new(big.Int).Sub(cur, prev), prev).Float64()
+		sum += change
+		if change > max {
+			max = change
+		}
+		n++
+	}
+	rate := max
+	if !worst {
+		if n == 0 {
+			return 0
+		}
+		rate = sum / float64(n)
+	}
+	return math.Max(-maxBaseFeeChange, math.Min(maxBaseFeeChange, rate))
+}
+
+// tips returns the distinct sampled tips, ascending
+func (h *FeeHistory) tips() []*big.Int {
+	seen := make(map[string]bool)
+	tips := []*big.Int{new(big.Int)}
+	seen["0"] = true
+	for _, rewards := range h.Rewards {
+		for _, r := range rewards {
+			if r != nil && !seen[r.String()] {
+				seen[r.String()] = true
+				tips = append(tips, r)
+			}
+		}
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+	return tips
+}
+
+func newFeeHistory(h *ethereum.FeeHistory, percentiles []float64) (*FeeHistory, error) {
+	if h == nil || len(h.BaseFee) == 0 {
+		return nil, ErrNoBaseFee
+	}
+	for _, b := range h.BaseFee {
+		if b == nil || b.Sign() == 0 {
+			return nil, ErrNoBaseFee
+		}
+	}
+	if len(h.GasUsedRatio) != len(h.Reward) {
+		return nil, errors.New("malformed fee history")
+	}
+	return &FeeHistory{
+		Percentiles:  percentiles,
+		Rewards:      h.Reward,
+		BaseFees:     h.BaseFee,
+		GasUsedRatio: h.GasUsedRatio,
+	}, nil
+}
+
+// gwei formats wei as gwei with up to two decimals
+func gwei(wei *big.Int) string {
+	g := new(big.Rat).SetFrac(wei, big.NewInt(1e9))
+	s := g.FloatString(2)
+	for len(s) > 0 && s[len(s)-1] == '0' {
+		s = s[:len(s)-1]
+	}
+	if len(s) > 0 && s[len(s)-1] == '.' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,146 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Fees are the gas prices for a transaction. Legacy fees carry the gas price
+// in both caps
+type Fees struct {
+	GasFeeCap *big.Int // maxFeePerGas
+	GasTipCap *big.Int // maxPriorityFeePerGas
+	Legacy    bool     // the chain has no base fee; send a type-0 transaction
+}
+
+// GasStrategy prices transactions for the current network conditions
+type GasStrategy interface {
+	Fees(ctx context.Context, client *ethclient.Client) (*Fees, error)
+}
+
+// GasStrategyFunc adapts a function to a GasStrategy
+type GasStrategyFunc func(ctx context.Context, client *ethclient.Client) (*Fees, error)
+
+// Fees calls f
+func (f GasStrategyFunc) Fees(ctx context.Context, client *ethclient.Client) (*Fees, error) {
+	return f(ctx, client)
+}
+
+// DynamicFeeStrategy prices EIP-1559 transactions from the latest base fee and
+// the node's suggested tip, and falls back to a legacy gas price on chains
+// without a base fee
+type DynamicFeeStrategy struct {
+	// BaseFeeMultiplier scales the base fee in the fee cap so the transaction
+	// stays includable while the base fee rises; 2 survives six full blocks
+	BaseFeeMultiplier int64
+	MinTip            *big.Int // optional floor on the priority fee
+	MaxFeeCap         *big.Int // optional ceiling; fees above it are an error
+}
+
+// DefaultGasStrategy is used by wallets without a GasStrategy
+var DefaultGasStrategy GasStrategy = &DynamicFeeStrategy{BaseFeeMultiplier: 2}
+
+// ErrFeeCapExceeded is returned when the network requires more than MaxFeeCap
+var ErrFeeCapExceeded = errors.New("network fee exceeds the configured cap")
+
+// Fees returns dynamic fees, or a legacy gas price when the chain has no base fee
+func (s *DynamicFeeStrategy) Fees(ctx context.Context, client *ethclient.Client) (*Fees, error) {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		price, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if s.MaxFeeCap != nil && price.Cmp(s.MaxFeeCap) > 0 {
+			return nil, ErrFeeCapExceeded
+		}
+		return &Fees{GasFeeCap: price, GasTipCap: price, Legacy: true}, nil
+	}
+
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.MinTip != nil && tip.Cmp(s.MinTip) < 0 {
+		tip = new(big.Int).Set(s.MinTip)
+	}
+	multiplier := s.BaseFeeMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	feeCap := new(big.Int).Mul(head.BaseFee, big.NewInt(multiplier))
+	feeCap.Add(feeCap, tip)
+	if s.MaxFeeCap != nil && feeCap.Cmp(s.MaxFeeCap) > 0 {
+		// The cap still works while it covers the current base fee and tip
+		if new(big.Int).Add(head.BaseFee, tip).Cmp(s.MaxFeeCap) > 0 {
+			return nil, ErrFeeCapExceeded
+		}
+		feeCap = new(big.Int).Set(s.MaxFeeCap)
+	}
+	return &Fees{GasFeeCap: feeCap, GasTipCap: tip}, nil
+}
+
+// LegacyStrategy always prices type-0 transactions at the suggested gas price,
+// for chains that reject typed transactions
+type LegacyStrategy struct{}
+
+// Fees returns the node's suggested gas price
+func (LegacyStrategy) Fees(ctx context.Context, client *ethclient.Client) (*Fees, error) {
+	price, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Fees{GasFeeCap: price, GasTipCap: price, Legacy: true}, nil
+}
+
+// FixedGasPrice prices every transaction as a legacy transaction at Price
+type FixedGasPrice struct {
+	Price *big.Int
+}
+
+// Fees returns the fixed price
+func (f FixedGasPrice) Fees(ctx context.Context, client *ethclient.Client) (*Fees, error) {
+	return &Fees{GasFeeCap: f.Price, GasTipCap: f.Price, Legacy: true}, nil
+}
+
+// SwitchStrategy delegates to a strategy that can be replaced while
+// transactions are being priced; each transaction is priced by one strategy
+type SwitchStrategy struct {
+	current atomic.Pointer[strategyHolder]
+}
+
+type strategyHolder struct {
+	strategy GasStrategy
+}
+
+// NewSwitchStrategy creates a switch starting with s, nil for the default
+func NewSwitchStrategy(s GasStrategy) *SwitchStrategy {
+	sw := &SwitchStrategy{}
+	sw.Set(s)
+	return sw
+}
+
+// Set replaces the strategy, nil for the default
+func (sw *SwitchStrategy) Set(s GasStrategy) {
+	sw.current.Store(&strategyHolder{strategy: s})
+}
+
+// Get returns the current strategy
+func (sw *SwitchStrategy) Get() GasStrategy {
+	if h := sw.current.Load(); h != nil && h.strategy != nil {
+		return h.strategy
+	}
+	return DefaultGasStrategy
+}
+
+// Fees prices with the current strategy
+func (sw *SwitchStrategy) Fees(ctx context.Context, client *ethclient.Client) (*Fees, error) {
+	return sw.Get().Fees(ctx, client)
+}
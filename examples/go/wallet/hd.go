@@ -0,0 +1,205 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+	"github.com/whisperchain/go-examples/entropy"
+)
+
+// HardenedOffset is added to a BIP-32 index to derive a hardened child
+const HardenedOffset = 0x80000000
+
+// DefaultBasePath is the BIP-44 path of Ethereum accounts; account i is the
+// child m/44'/60'/0'/0/i
+const DefaultBasePath = "m/44'/60'/0'/0"
+
+// DerivationPath is a BIP-32 path as child indexes from the master key
+type DerivationPath []uint32
+
+// ParseDerivationPath parses paths such as m/44'/60'/0'/0/0; h may be used
+// instead of ' to mark hardened indexes
+func ParseDerivationPath(path string) (DerivationPath, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q must start with m", path)
+	}
+	var out DerivationPath
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || n >= HardenedOffset {
+			return nil, fmt.Errorf("invalid index %q in derivation path %q", part, path)
+		}
+		index := uint32(n)
+		if hardened {
+			index += HardenedOffset
+		}
+		out = append(out, index)
+	}
+	return out, nil
+}
+
+// String formats the path with ' for hardened indexes
+func (p DerivationPath) String() string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, index := range p {
+		b.WriteString("/")
+		if index >= HardenedOffset {
+			b.WriteString(strconv.FormatUint(uint64(index-HardenedOffset), 10))
+			b.WriteString("'")
+		} else {
+			b.WriteString(strconv.FormatUint(uint64(index), 10))
+		}
+	}
+	return b.String()
+}
+
+// AccountPath returns the default path of account index
+func AccountPath(index uint32) DerivationPath {
+	base, _ := ParseDerivationPath(DefaultBasePath)
+	return append(base, index)
+}
+
+// NewMnemonic generates a BIP-39 mnemonic; 128 bits of entropy gives 12 words
+// and 256 bits gives 24
+func NewMnemonic(bits int) (string, error) {
+	return NewMnemonicFrom(nil, bits)
+}
+
+// NewMnemonicFrom generates a BIP-39 mnemonic from rand, crypto/rand when nil
+func NewMnemonicFrom(rand io.Reader, bits int) (string, error) {
+	if bits%32 != 0 || bits < 128 || bits > 256 {
+		return "", bip39.ErrEntropyLengthInvalid
+	}
+	seed := make([]byte, bits/8)
+	if err := entropy.Read(rand, seed); err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(seed)
+}
+
+// HDWallet derives any number of account keys from one BIP-39 seed
+type HDWallet struct {
+	key       []byte
+	chainCode []byte
+}
+
+// ErrInvalidMnemonic is returned for mnemonics with unknown words or a bad checksum
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// NewHDWallet creates an HD wallet from a mnemonic and optional BIP-39
+// passphrase
+func NewHDWallet(mnemonic, passphrase string) (*HDWallet, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	return NewHDWalletFromSeed(bip39.NewSeed(mnemonic, passphrase))
+}
+
+// NewHDWalletFromSeed creates an HD wallet from a BIP-32 seed
+func NewHDWalletFromSeed(seed []byte) (*HDWallet, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.New("seed must be 16 to 64 bytes")
+	}
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	if !validScalar(sum[:32]) {
+		return nil, errors.New("seed does not produce a valid master key")
+	}
+	return &HDWallet{key: sum[:32], chainCode: sum[32:]}, nil
+}
+
+// Derive returns the private key at path
+func (h *HDWallet) Derive(path DerivationPath) (*ecdsa.PrivateKey, error) {
+	key, chainCode := h.key, h.chainCode
+	for _, index := range path {
+		var err error
+		key, chainCode, err = deriveChild(key, chainCode, index)
+		if err != nil {
+			return nil, fmt.Errorf("derive %s: %w", path, err)
+		}
+	}
+	return crypto.ToECDSA(key)
+}
+
+// Account returns the key and address of account index on the default path
+func (h *HDWallet) Account(index uint32) (*ecdsa.PrivateKey, common.Address, error) {
+	key, err := h.Derive(AccountPath(index))
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	return key, crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// Wallet connects account index to a node
+func (h *HDWallet) Wallet(index uint32, rpcURL string) (*Wallet, error) {
+	key, _, err := h.Account(index)
+	if err != nil {
+		return nil, err
+	}
+	return NewWalletFromPrivateKey(key, rpcURL)
+}
+
+// NewWalletFromMnemonic creates a wallet for account index of a mnemonic
+func NewWalletFromMnemonic(mnemonic, passphrase string, index uint32, rpcURL string) (*Wallet, error) {
+	h, err := NewHDWallet(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return h.Wallet(index, rpcURL)
+}
+
+// deriveChild implements BIP-32 private child key derivation
+func deriveChild(key, chainCode []byte, index uint32) ([]byte, []byte, error) {
+	var data []byte
+	if index >= HardenedOffset {
+		data = append([]byte{0}, key...)
+	} else {
+		priv, err := crypto.ToECDSA(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = crypto.CompressPubkey(&priv.PublicKey)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	// The spec skips to the next index in these cases, which occur with
+	// probability below 2^-127
+	n := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, nil, fmt.Errorf("index %d produces an invalid key", index)
+	}
+	child := il.Add(il, new(big.Int).SetBytes(key))
+	child.Mod(child, n)
+	if child.Sign() == 0 {
+		return nil, nil, fmt.Errorf("index %d produces an invalid key", index)
+	}
+	return child.FillBytes(make([]byte, 32)), sum[32:], nil
+}
+
+func validScalar(b []byte) bool {
+	k := new(big.Int).SetBytes(b)
+	return k.Sign() > 0 && k.Cmp(crypto.S256().Params().N) < 0
+}
@@ -0,0 +1,136 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// bip32Vectors are test vectors 1 and 2 from BIP-32, with each step's
+// extended private key
+var bip32Vectors = []struct {
+	seed  string
+	steps []struct{ path, xprv string }
+}{
+	{
+		seed: "000102030405060708090a0b0c0d0e0f",
+		steps: []struct{ path, xprv string }{
+			{"m", "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"},
+			{"m/0'", "xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7"},
+			{"m/0'/1", "xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs"},
+			{"m/0'/1/2'", "xprv9z4pot5VBttmtdRTWfWQmoH1taj2axGVzFqSb8C9xaxKymcFzXBDptWmT7FwuEzG3ryjH4ktypQSAewRiNMjANTtpgP4mLTj34bhnZX7UiM"},
+			{"m/0'/1/2'/2", "xprvA2JDeKCSNNZky6uBCviVfJSKyQ1mDYahRjijr5idH2WwLsEd4Hsb2Tyh8RfQMuPh7f7RtyzTtdrbdqqsunu5Mm3wDvUAKRHSC34sJ7in334"},
+			{"m/0'/1/2'/2/1000000000", "xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76"},
+		},
+	},
+	{
+		seed: "fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		steps: []struct{ path, xprv string }{
+			{"m", "xprv9s21ZrQH143K31xYSDQpPDxsXRTUcvj2iNHm5NUtrGiGG5e2DtALGdso3pGz6ssrdK4PFmM8NSpSBHNqPqm55Qn3LqFtT2emdEXVYsCzC2U"},
+			{"m/0", "xprv9vHkqa6EV4sPZHYqZznhT2NPtPCjKuDKGY38FBWLvgaDx45zo9WQRUT3dKYnjwih2yJD9mkrocEZXo1ex8G81dwSM1fwqWpWkeS3v86pgKt"},
+			{"m/0/2147483647'", "xprv9wSp6B7kry3Vj9m1zSnLvN3xH8RdsPP1Mh7fAaR7aRLcQMKTR2vidYEeEg2mUCTAwCd6vnxVrcjfy2kRgVsFawNzmjuHc2YmYRmagcEPdU9"},
+			{"m/0/2147483647'/1", "xprv9zFnWC6h2cLgpmSA46vutJzBcfJ8yaJGg8cX1e5StJh45BBciYTRXSd25UEPVuesF9yog62tGAQtHjXajPPdbRCHuWS6T8XA2ECKADdw4Ef"},
+			{"m/0/2147483647'/1/2147483646'", "xprvA1RpRA33e1JQ7ifknakTFpgNXPmW2YvmhqLQYMmrj4xJXXWYpDPS3xz7iAxn8L39njGVyuoseXzU6rcxFLJ8HFsTjSyQbLYnMpCqE2VbFWc"},
+			{"m/0/2147483647'/1/2147483646'/2", "xprvA2nrNbFZABcdryreWet9Ea4LvTJcGsqrMzxHx98MMrotbir7yrKCEXw7nadnHM8Dq38EGfSh6dqA9QWTyefMLEcBYJUuekgW4BYPJcr9E7j"},
+		},
+	},
+}
+
+func TestBIP32Vectors(t *testing.T) {
+	for i, v := range bip32Vectors {
+		seed, err := hex.DecodeString(v.seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := NewHDWalletFromSeed(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, step := range v.steps {
+			chainCode, key := decodeXprv(t, step.xprv)
+			path, err := ParseDerivationPath(step.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotKey, gotChain := h.key, h.chainCode
+			for _, index := range path {
+				if gotKey, gotChain, err = deriveChild(gotKey, gotChain, index); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(gotKey, key) || !bytes.Equal(gotChain, chainCode) {
+				t.Errorf("vector %d %s: key %x chain code %x, want %x %x", i+1, step.path, gotKey, gotChain, key, chainCode)
+			}
+			priv, err := h.Derive(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(crypto.FromECDSA(priv), key) {
+				t.Errorf("vector %d %s: Derive gave %x", i+1, step.path, crypto.FromECDSA(priv))
+			}
+		}
+	}
+}
+
+func TestBIP39Vectors(t *testing.T) {
+	// From the reference implementation's vectors, with passphrase TREZOR
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if got := hex.EncodeToString(bip39.NewSeed(mnemonic, "TREZOR")); got != want {
+		t.Fatalf("seed %s, want %s", got, want)
+	}
+
+	// The well-known development mnemonic and its first account at
+	// m/44'/60'/0'/0/0
+	h, err := NewHDWallet("test test test test test test test test test test test junk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, addr, err := h.Account(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(crypto.FromECDSA(key)); got != "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80" {
+		t.Errorf("key %s", got)
+	}
+	if addr != common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266") {
+		t.Errorf("address %s", addr)
+	}
+	if AccountPath(0).String() != "m/44'/60'/0'/0/0" {
+		t.Errorf("account path %s", AccountPath(0))
+	}
+
+	if _, err := NewHDWallet("test test test test test test test test test test test test", ""); !errors.Is(err, ErrInvalidMnemonic) {
+		t.Errorf("bad checksum: got %v", err)
+	}
+}
+
+// decodeXprv returns the chain code and private key of a base58check
+// serialized BIP-32 extended private key
+func decodeXprv(t *testing.T, s string) (chainCode, key []byte) {
+	t.Helper()
+	const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	n := new(big.Int)
+	for _, c := range s {
+		i := strings.IndexRune(alphabet, c)
+		if i < 0 {
+			t.Fatalf("%s: bad base58", s)
+		}
+		n.Mul(n, big.NewInt(58)).Add(n, big.NewInt(int64(i)))
+	}
+	raw := n.FillBytes(make([]byte, 82))
+	sum := sha256.Sum256(raw[:78])
+	sum = sha256.Sum256(sum[:])
+	if !bytes.Equal(sum[:4], raw[78:]) || raw[45] != 0 {
+		t.Fatalf("%s: bad checksum or not a private key", s)
+	}
+	return raw[13:45], raw[46:78]
+}
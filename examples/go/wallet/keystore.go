@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// EncryptKeystore returns the key as Web3 Secret Storage (V3) JSON, the
+// format geth and most wallets import
+func EncryptKeystore(key *ecdsa.PrivateKey, passphrase string) ([]byte, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	k := &keystore.Key{Id: id, Address: crypto.PubkeyToAddress(key.PublicKey), PrivateKey: key}
+	return keystore.EncryptKey(k, passphrase, keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+// DecryptKeystore decrypts V3 keystore JSON
+func DecryptKeystore(data []byte, passphrase string) (*ecdsa.PrivateKey, error) {
+	k, err := keystore.DecryptKey(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return k.PrivateKey, nil
+}
+
+// ExportKeystore returns the wallet's key as encrypted keystore JSON
+func (w *Wallet) ExportKeystore(passphrase string) ([]byte, error) {
+	return EncryptKeystore(w.PrivateKey, passphrase)
+}
+
+// SaveKeystore writes the encrypted key to dir under geth's file naming, so
+// the directory can be used as a geth keystore, and returns the file path
+func (w *Wallet) SaveKeystore(dir, passphrase string) (string, error) {
+	data, err := w.ExportKeystore(passphrase)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	ts := time.Now().UTC().Format("2006-01-02T15-04-05.000000000Z")
+	name := fmt.Sprintf("UTC--%s--%s", ts, strings.ToLower(w.Address.Hex()[2:]))
+	path := filepath.Join(dir, name)
+
+	// Write to a temporary file first so a crash never leaves a partial key
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// NewWalletFromKeystore decrypts keystore JSON and connects it to a node
+func NewWalletFromKeystore(data []byte, passphrase, rpcURL string) (*Wallet, error) {
+	key, err := DecryptKeystore(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewWalletFromPrivateKey(key, rpcURL)
+}
+
+// LoadKeystore reads a keystore file and connects its key to a node
+func LoadKeystore(path, passphrase, rpcURL string) (*Wallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewWalletFromKeystore(data, passphrase, rpcURL)
+}
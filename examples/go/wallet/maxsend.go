@@ -0,0 +1,214 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// gasPriceOracle is the OP Stack predeploy that prices L1 data
+var gasPriceOracle = common.HexToAddress("0x420000000000000000000000000000000000000F")
+
+const gasPriceOracleABIJSON = `[{"inputs":[{"name":"_data","type":"bytes"}],"name":"getL1Fee","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`
+
+var gasPriceOracleABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(gasPriceOracleABIJSON))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// l1FeeHeadroom is the percentage added to the quoted L1 data fee, which moves
+// with L1 gas prices between quoting and inclusion
+const l1FeeHeadroom = 25
+
+// ErrInsufficientFunds is returned when the balance does not cover the fee
+var ErrInsufficientFunds = errors.New("balance does not cover transfer fee")
+
+// MaxSend is the largest transfer a wallet can afford together with the fee
+// parameters it was computed for
+type MaxSend struct {
+	Value     units.Wei
+	Nonce     uint64
+	GasLimit  uint64
+	GasFeeCap *big.Int // equals GasTipCap on chains without a base fee
+	GasTipCap *big.Int
+	L1Fee     *big.Int // rollup data fee reserved on top of execution gas; zero on L1
+
+	legacy bool // chain has no base fee; send a legacy transaction
+}
+
+// Fee returns the maximum fee reserved for the transfer
+func (m *MaxSend) Fee() units.Wei {
+	return units.NewWei(m.GasFeeCap).Mul(m.GasLimit).Add(units.NewWei(m.L1Fee))
+}
+
+// MaxSendable computes the largest value that can be sent to to. Nodes require
+// the balance to cover value + gas limit * fee cap, so the fee cap rather than
+// the expected effective price is reserved; on OP Stack rollups the L1 data fee
+// is reserved as well.
+func (w *Wallet) MaxSendable(ctx context.Context, to common.Address) (*MaxSend, error) {
+	return w.maxSendable(ctx, w.Settings(), to)
+}
+
+func (w *Wallet) maxSendable(ctx context.Context, s Settings, to common.Address) (*MaxSend, error) {
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := client.PendingBalanceAt(ctx, w.Address)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := w.GetNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MaxSend{Nonce: nonce, GasLimit: transferGas, L1Fee: new(big.Int)}
+
+	code, err := client.CodeAt(ctx, to, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) > 0 {
+		// Contract recipients may run code on receive; estimate with a token value
+		gas, err := client.EstimateGas(ctx, ethereum.CallMsg{From: w.Address, To: &to, Value: big.NewInt(1)})
+		if err != nil {
+			return nil, err
+		}
+		m.GasLimit = gas
+	}
+
+	fees, err := s.gasStrategy().Fees(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	m.GasFeeCap, m.GasTipCap, m.legacy = fees.GasFeeCap, fees.GasTipCap, fees.Legacy
+
+	l1Fee, err := l1Fee(ctx, client, to, m)
+	if err != nil {
+		return nil, err
+	}
+	m.L1Fee = l1Fee
+
+	fee := m.Fee()
+	if units.NewWei(balance).Cmp(fee) <= 0 {
+		return nil, ErrInsufficientFunds
+	}
+	m.Value = units.NewWei(balance).Sub(fee)
+	return m, nil
+}
+
+// SendMax sends the wallet's entire spendable balance to to using the fee
+// parameters from MaxSendable. It takes the node's pending nonce, so it is
+// serialized with the wallet's other such sends
+func (w *Wallet) SendMax(ctx context.Context, to common.Address) (*types.Transaction, error) {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+	s := w.Settings()
+	m, err := w.maxSendable(ctx, s, to)
+	if err != nil {
+		return nil, err
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var txdata types.TxData = &types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     m.Nonce,
+		GasTipCap: m.GasTipCap,
+		GasFeeCap: m.GasFeeCap,
+		Gas:       m.GasLimit,
+		To:        &to,
+		Value:     m.Value.Big(),
+	}
+	if m.legacy {
+		txdata = &types.LegacyTx{Nonce: m.Nonce, GasPrice: m.GasFeeCap, Gas: m.GasLimit, To: &to, Value: m.Value.Big()}
+	}
+	tx, err := types.SignNewTx(w.PrivateKey, types.LatestSignerForChainID(chainID), txdata)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.notifySigned(tx); err != nil {
+		return nil, err
+	}
+	if s.TxManager != nil {
+		if err := s.TxManager.Check(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// l1Fee quotes the rollup data fee for the transfer, or zero when the chain
+// has no gas price oracle predeploy
+func l1Fee(ctx context.Context, client *ethclient.Client, to common.Address, m *MaxSend) (*big.Int, error) {
+	code, err := client.CodeAt(ctx, gasPriceOracle, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return new(big.Int), nil
+	}
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The oracle prices the serialized transaction; the value only affects its
+	// size by a few bytes, so quote with a large upper bound
+	unsigned := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     m.Nonce,
+		GasTipCap: m.GasTipCap,
+		GasFeeCap: m.GasFeeCap,
+		Gas:       m.GasLimit,
+		To:        &to,
+		Value:     new(big.Int).Lsh(big.NewInt(1), 128),
+	})
+	raw, err := unsigned.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := gasPriceOracleABI.Pack("getL1Fee", raw)
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &gasPriceOracle, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := gasPriceOracleABI.Unpack("getL1Fee", out)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 1 {
+		return nil, errors.New("unexpected getL1Fee result")
+	}
+	fee, ok := res[0].(*big.Int)
+	if !ok {
+		return nil, errors.New("unexpected getL1Fee result")
+	}
+	fee.Mul(fee, big.NewInt(100+l1FeeHeadroom))
+	return fee.Div(fee, big.NewInt(100)), nil
+}
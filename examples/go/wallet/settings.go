@@ -0,0 +1,68 @@
+package wallet
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/txmgr"
+)
+
+// Settings is an immutable snapshot of a wallet's replaceable configuration.
+// Each send reads it once, so a send that starts before a change completes
+// with the settings it started with
+type Settings struct {
+	OnSign      SignHook
+	GasStrategy GasStrategy
+	TxManager   *txmgr.Manager
+}
+
+// Settings returns the wallet's current configuration
+func (w *Wallet) Settings() Settings {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return Settings{OnSign: w.OnSign, GasStrategy: w.GasStrategy, TxManager: w.TxManager}
+}
+
+// SetOnSign replaces the sign hook, nil for none
+func (w *Wallet) SetOnSign(hook SignHook) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.OnSign = hook
+}
+
+// WrapSignHook replaces the sign hook with wrap applied to the current one,
+// which may be nil. The read and the replacement are one step, so hooks
+// installed from several goroutines all end up in the chain
+func (w *Wallet) WrapSignHook(wrap func(next SignHook) SignHook) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.OnSign = wrap(w.OnSign)
+}
+
+// SetGasStrategy replaces the gas strategy, nil for the default; to swap
+// strategies often, set a SwitchStrategy once instead
+func (w *Wallet) SetGasStrategy(s GasStrategy) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.GasStrategy = s
+}
+
+// SetTxManager replaces the tx manager, nil to send with the node's pending
+// nonce. Sends already in flight finish on the manager they started with
+func (w *Wallet) SetTxManager(m *txmgr.Manager) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.TxManager = m
+}
+
+func (s Settings) notifySigned(tx *types.Transaction) error {
+	if s.OnSign == nil {
+		return nil
+	}
+	return s.OnSign(tx)
+}
+
+func (s Settings) gasStrategy() GasStrategy {
+	if s.GasStrategy == nil {
+		return DefaultGasStrategy
+	}
+	return s.GasStrategy
+}
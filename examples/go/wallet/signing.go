@@ -0,0 +1,118 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// PersonalMessageHash returns the EIP-191 version 0x45 hash signed by
+// personal_sign: keccak256("\x19Ethereum Signed Message:\n" + len + message)
+func PersonalMessageHash(message []byte) []byte {
+	prefix := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message))
+	return crypto.Keccak256([]byte(prefix), message)
+}
+
+// SignPersonalMessage signs a message as personal_sign does, returning a
+// signature with a 27/28 recovery id that MetaMask, ethers.js and
+// ECDSA.recover accept
+func (w *Wallet) SignPersonalMessage(message []byte) ([]byte, error) {
+	return w.signWithRecoveryOffset(PersonalMessageHash(message))
+}
+
+// VerifyPersonalSignature checks a personal_sign signature; recovery ids
+// 0/1 and 27/28 are both accepted
+func VerifyPersonalSignature(message, signature []byte, address common.Address) bool {
+	signer, err := RecoverSigner(PersonalMessageHash(message), signature)
+	return err == nil && signer == address
+}
+
+// TypedDataHash returns the EIP-712 digest
+// keccak256("\x19\x01" || domainSeparator || hashStruct(message))
+func TypedDataHash(td apitypes.TypedData) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(td)
+	return hash, err
+}
+
+// DomainSeparator returns the hash of the typed data's EIP712Domain
+func DomainSeparator(td apitypes.TypedData) (common.Hash, error) {
+	hash, err := td.HashStruct("EIP712Domain", td.Domain.Map())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(hash), nil
+}
+
+// ParseTypedData decodes eth_signTypedData_v4 JSON
+func ParseTypedData(data []byte) (apitypes.TypedData, error) {
+	var td apitypes.TypedData
+	if err := json.Unmarshal(data, &td); err != nil {
+		return td, err
+	}
+	if td.PrimaryType == "" {
+		return td, errors.New("typed data has no primary type")
+	}
+	if _, ok := td.Types["EIP712Domain"]; !ok {
+		return td, errors.New("typed data has no EIP712Domain type")
+	}
+	return td, nil
+}
+
+// SignTypedData signs EIP-712 typed data as eth_signTypedData_v4 does, for
+// permits, off-chain orders and sign-in messages
+func (w *Wallet) SignTypedData(td apitypes.TypedData) ([]byte, error) {
+	hash, err := TypedDataHash(td)
+	if err != nil {
+		return nil, err
+	}
+	return w.signWithRecoveryOffset(hash)
+}
+
+// VerifyTypedDataSignature checks an EIP-712 signature against address
+func VerifyTypedDataSignature(td apitypes.TypedData, signature []byte, address common.Address) (bool, error) {
+	hash, err := TypedDataHash(td)
+	if err != nil {
+		return false, err
+	}
+	signer, err := RecoverSigner(hash, signature)
+	if err != nil {
+		return false, nil
+	}
+	return signer == address, nil
+}
+
+// RecoverSigner returns the address that signed a 32-byte digest. The
+// signature's recovery id may be 0/1 or 27/28
+func RecoverSigner(hash, signature []byte) (common.Address, error) {
+	if len(hash) != 32 {
+		return common.Address{}, errors.New("hash must be 32 bytes")
+	}
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, errors.New("signature must be 65 bytes")
+	}
+	sig := append([]byte(nil), signature...)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	if sig[64] > 1 {
+		return common.Address{}, errors.New("invalid recovery id")
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+func (w *Wallet) signWithRecoveryOffset(hash []byte) ([]byte, error) {
+	sig, err := w.SignHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
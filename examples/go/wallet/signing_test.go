@@ -0,0 +1,133 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// mailTypedData is the Mail example from EIP-712
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func TestTypedDataMailExample(t *testing.T) {
+	td, err := ParseTypedData([]byte(mailTypedData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	domain, err := DomainSeparator(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain != common.HexToHash("0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f") {
+		t.Fatalf("domain separator %s", domain)
+	}
+	hash, err := TypedDataHash(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2" {
+		t.Fatalf("digest %s", got)
+	}
+
+	// The spec signs with keccak256("cow"), Cow's wallet
+	key, err := crypto.ToECDSA(crypto.Keccak256([]byte("cow")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWalletFromClient(key, nil)
+	if w.Address != common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826") {
+		t.Fatalf("signer %s", w.Address)
+	}
+	sig, err := w.SignTypedData(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d" +
+		"07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b91562" + "1c"
+	if got := hex.EncodeToString(sig); got != want {
+		t.Fatalf("signature %s, want %s", got, want)
+	}
+	if ok, err := VerifyTypedDataSignature(td, sig, w.Address); err != nil || !ok {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+}
+
+func TestPersonalSignRoundTrip(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWalletFromClient(key, nil)
+	message := []byte("Sign in to WhisperChain")
+
+	sig, err := w.SignPersonalMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig[64] != 27 && sig[64] != 28 {
+		t.Fatalf("personal_sign recovery id %d", sig[64])
+	}
+	if !VerifyPersonalSignature(message, sig, w.Address) {
+		t.Fatal("27/28 signature does not verify")
+	}
+	raw := append([]byte(nil), sig...)
+	raw[64] -= 27
+	if !VerifyPersonalSignature(message, raw, w.Address) {
+		t.Fatal("0/1 signature does not verify")
+	}
+	if VerifyPersonalSignature([]byte("Sign in to WhisperChain!"), sig, w.Address) {
+		t.Fatal("signature verifies another message")
+	}
+	if VerifySignature(message, sig, w.Address) {
+		t.Fatal("personal_sign signature verifies as an unprefixed one")
+	}
+
+	// SignMessage signs without the prefix; VerifySignature takes either
+	// recovery id
+	sig, err = w.SignMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(message, sig, w.Address) {
+		t.Fatal("0/1 signature does not verify")
+	}
+	sig[64] += 27
+	if !VerifySignature(message, sig, w.Address) {
+		t.Fatal("27/28 signature does not verify")
+	}
+	if VerifyPersonalSignature(message, sig, w.Address) {
+		t.Fatal("unprefixed signature verifies as personal_sign")
+	}
+}
@@ -0,0 +1,232 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/whisperchain/go-examples/txmgr"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// transferGas is the intrinsic gas of a plain ETH transfer
+const transferGas = 21000
+
+// TxOpts overrides how a transaction is built. Zero fields are filled in from
+// the node: the nonce from the pending count, the gas limit from estimation
+// and the fees from the gas strategy
+type TxOpts struct {
+	Nonce     *uint64
+	GasLimit  uint64
+	GasFeeCap *units.Wei  // maxFeePerGas; with GasTipCap, skips the strategy
+	GasTipCap *units.Wei  // maxPriorityFeePerGas
+	GasPrice  *units.Wei  // sends a legacy transaction at this price
+	Strategy  GasStrategy // overrides the wallet's strategy
+	Inclusion *Inclusion  // prices from the fee forecast for this target; overrides Strategy
+	Data      []byte
+}
+
+// ErrFeeMismatch is returned when the fee options cannot form a transaction
+var ErrFeeMismatch = errors.New("set either gas price or both fee caps, with tip cap at most fee cap")
+
+// BuildTx prepares an unsigned transaction to to, choosing an EIP-1559
+// dynamic fee transaction unless the chain or the options require legacy
+func (w *Wallet) BuildTx(ctx context.Context, to common.Address, value units.Wei, opts *TxOpts) (*types.Transaction, error) {
+	return w.buildTx(ctx, w.Settings(), to, value, opts)
+}
+
+func (w *Wallet) buildTx(ctx context.Context, s Settings, to common.Address, value units.Wei, opts *TxOpts) (*types.Transaction, error) {
+	if opts == nil {
+		opts = &TxOpts{}
+	}
+
+	var nonce uint64
+	if opts.Nonce != nil {
+		nonce = *opts.Nonce
+	} else {
+		n, err := w.GetNonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+		nonce = n
+	}
+
+	fees, err := w.fees(ctx, s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	gas := opts.GasLimit
+	if gas == 0 {
+		gas, err = w.estimateGas(ctx, to, value.Big(), opts.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if fees.Legacy {
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: fees.GasFeeCap,
+			Gas:      gas,
+			To:       &to,
+			Value:    value.Big(),
+			Data:     opts.Data,
+		}), nil
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: fees.GasTipCap,
+		GasFeeCap: fees.GasFeeCap,
+		Gas:       gas,
+		To:        &to,
+		Value:     value.Big(),
+		Data:      opts.Data,
+	}), nil
+}
+
+// SignTx signs a transaction with the wallet's key and runs the sign hook
+func (w *Wallet) SignTx(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	return w.signTx(ctx, w.Settings(), tx)
+}
+
+func (w *Wallet) signTx(ctx context.Context, s Settings, tx *types.Transaction) (*types.Transaction, error) {
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), w.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.notifySigned(signedTx); err != nil {
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+// SendTx builds, signs and broadcasts a transaction. Without an explicit
+// nonce it goes through the tx manager so concurrent sends do not collide;
+// without a tx manager such sends are serialized on the wallet instead. The
+// tx manager's pre-broadcast check runs either way
+func (w *Wallet) SendTx(ctx context.Context, to common.Address, value units.Wei, opts *TxOpts) (*types.Transaction, error) {
+	s := w.Settings()
+	if opts == nil || opts.Nonce == nil {
+		if s.TxManager != nil {
+			build := func(nonce uint64) (*types.Transaction, error) {
+				var o TxOpts
+				if opts != nil {
+					o = *opts
+				}
+				o.Nonce = &nonce
+				return w.buildTx(ctx, s, to, value, &o)
+			}
+			var data []byte
+			if opts != nil {
+				data = opts.Data
+			}
+			fingerprint := txmgr.Fingerprint(&to, value.Big(), data)
+			return s.TxManager.Send(ctx, w.Address, fingerprint, build, func(tx *types.Transaction) (*types.Transaction, error) {
+				return w.signTx(ctx, s, tx)
+			})
+		}
+		w.sendMu.Lock()
+		defer w.sendMu.Unlock()
+	}
+
+	tx, err := w.buildTx(ctx, s, to, value, opts)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := w.signTx(ctx, s, tx)
+	if err != nil {
+		return nil, err
+	}
+	if s.TxManager != nil {
+		if err := s.TxManager.Check(ctx, signedTx); err != nil {
+			return nil, err
+		}
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, signedTx); err != nil {
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+// Fees returns the gas prices BuildTx would use with opts, nil for the
+// wallet's strategy
+func (w *Wallet) Fees(ctx context.Context, opts *TxOpts) (*Fees, error) {
+	if opts == nil {
+		opts = &TxOpts{}
+	}
+	return w.fees(ctx, w.Settings(), opts)
+}
+
+// fees resolves the gas price options, consulting the strategy only when the
+// caller did not fix the fees
+func (w *Wallet) fees(ctx context.Context, s Settings, opts *TxOpts) (*Fees, error) {
+	switch {
+	case opts.GasPrice != nil:
+		if opts.GasFeeCap != nil || opts.GasTipCap != nil {
+			return nil, ErrFeeMismatch
+		}
+		return &Fees{GasFeeCap: opts.GasPrice.Big(), GasTipCap: opts.GasPrice.Big(), Legacy: true}, nil
+	case opts.GasFeeCap != nil || opts.GasTipCap != nil:
+		if opts.GasFeeCap == nil || opts.GasTipCap == nil || opts.GasTipCap.Cmp(*opts.GasFeeCap) > 0 {
+			return nil, ErrFeeMismatch
+		}
+		return &Fees{GasFeeCap: opts.GasFeeCap.Big(), GasTipCap: opts.GasTipCap.Big()}, nil
+	}
+
+	strategy := opts.Strategy
+	if opts.Inclusion != nil {
+		strategy = *opts.Inclusion
+	}
+	if strategy == nil {
+		strategy = s.gasStrategy()
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return strategy.Fees(ctx, client)
+}
+
+// estimateGas uses the intrinsic transfer cost for plain payments to accounts
+// without code and asks the node otherwise
+func (w *Wallet) estimateGas(ctx context.Context, to common.Address, value *big.Int, data []byte) (uint64, error) {
+	client, err := w.Client(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		code, err := client.CodeAt(ctx, to, nil)
+		if err != nil {
+			return 0, err
+		}
+		if len(code) == 0 {
+			return transferGas, nil
+		}
+	}
+	return client.EstimateGas(ctx, ethereum.CallMsg{From: w.Address, To: &to, Value: value, Data: data})
+}
@@ -4,25 +4,85 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"errors"
+	"io"
 	"math/big"
+	"sync"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/confirm"
+	"github.com/whisperchain/go-examples/conn"
+	"github.com/whisperchain/go-examples/entropy"
+	"github.com/whisperchain/go-examples/txmgr"
+	"github.com/whisperchain/go-examples/units"
 )
 
-// Wallet represents an Ethereum wallet
+// Wallet represents an Ethereum wallet. It is safe for concurrent use once
+// constructed: the key and address never change, the replaceable settings
+// are read as one snapshot per send, and sends are nonce-serialized by the
+// tx manager or, without one, by the wallet itself
 type Wallet struct {
-	PrivateKey *ecdsa.PrivateKey
-	PublicKey  *ecdsa.PublicKey
-	Address    common.Address
-	Client     *ethclient.Client
+	PrivateKey  *ecdsa.PrivateKey
+	PublicKey   *ecdsa.PublicKey
+	Address     common.Address
+	OnSign      SignHook    // optional, called for every transaction the wallet signs
+	GasStrategy GasStrategy // optional, defaults to DefaultGasStrategy
+	// TxManager serializes nonces across concurrent sends and replaces stuck
+	// transactions; nil sends use the node's pending nonce directly
+	TxManager *txmgr.Manager
+	// Conn is the connection the wallet opened itself, which supplies the
+	// client on first use and is closed by Close; nil when the client was
+	// supplied by the caller
+	Conn *conn.Conn
+
+	client *ethclient.Client // supplied by the caller; nil with a Conn
+
+	// mu guards OnSign, GasStrategy and TxManager. Set the fields directly
+	// only before the wallet is shared; afterwards use the setters
+	mu sync.RWMutex
+	// sendMu serializes sends that take the node's pending nonce, so two
+	// goroutines sharing a wallet without a TxManager cannot pick the same one
+	sendMu sync.Mutex
+}
+
+// SignHook is called with each transaction the wallet signs, before it is
+// returned or broadcast; an error aborts the send
+type SignHook func(tx *types.Transaction) error
+
+// NotifySigned runs the sign hook, if any; code that signs with the wallet's
+// key outside the wallet's own methods should call it before broadcasting
+func (w *Wallet) NotifySigned(tx *types.Transaction) error {
+	return w.Settings().notifySigned(tx)
+}
+
+// TransactOpts returns contract binding options that sign with the wallet's
+// key and run the sign hook
+func (w *Wallet) TransactOpts(chainID *big.Int) (*bind.TransactOpts, error) {
+	auth, err := bind.NewKeyedTransactorWithChainID(w.PrivateKey, chainID)
+	if err != nil {
+		return nil, err
+	}
+	sign := auth.Signer
+	auth.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		signedTx, err := sign(from, tx)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.NotifySigned(signedTx); err != nil {
+			return nil, err
+		}
+		return signedTx, nil
+	}
+	return auth, nil
 }
 
 // NewWallet creates a new random wallet
 func NewWallet(rpcURL string) (*Wallet, error) {
-	privateKey, err := crypto.GenerateKey()
+	privateKey, err := GenerateKey(nil)
 	if err != nil {
 		return nil, err
 	}
@@ -30,73 +90,129 @@ func NewWallet(rpcURL string) (*Wallet, error) {
 	return NewWalletFromPrivateKey(privateKey, rpcURL)
 }
 
-// NewWalletFromPrivateKey creates a wallet from existing private key
-func NewWalletFromPrivateKey(privateKey *ecdsa.PrivateKey, rpcURL string) (*Wallet, error) {
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, errors.New("error casting public key to ECDSA")
+// GenerateKey creates a secp256k1 key from rand, crypto/rand when nil. The
+// same stream always gives the same key, so an entropy.Deterministic source
+// makes reproducible fixtures
+func GenerateKey(rand io.Reader) (*ecdsa.PrivateKey, error) {
+	if rand == nil {
+		return crypto.GenerateKey()
 	}
-
-	address := crypto.PubkeyToAddress(*publicKeyECDSA)
-
-	client, err := ethclient.Dial(rpcURL)
-	if err != nil {
-		return nil, err
+	b := make([]byte, 32)
+	for {
+		if err := entropy.Read(rand, b); err != nil {
+			return nil, err
+		}
+		// Out of range scalars are vanishingly rare; draw again
+		if key, err := crypto.ToECDSA(b); err == nil {
+			return key, nil
+		}
 	}
+}
 
+// NewWalletFromPrivateKey creates a wallet from existing private key. The
+// node is not contacted until the wallet is used, so a node that is down at
+// startup fails only the calls made while it is down; Close releases the
+// connection
+func NewWalletFromPrivateKey(privateKey *ecdsa.PrivateKey, rpcURL string) (*Wallet, error) {
+	c := conn.New(rpcURL)
 	return &Wallet{
 		PrivateKey: privateKey,
-		PublicKey:  publicKeyECDSA,
-		Address:    address,
-		Client:     client,
+		PublicKey:  &privateKey.PublicKey,
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		TxManager:  txmgr.NewConn(c),
+		Conn:       c,
 	}, nil
 }
 
-// GetBalance returns the ETH balance of the wallet
-func (w *Wallet) GetBalance(ctx context.Context) (*big.Int, error) {
-	return w.Client.BalanceAt(ctx, w.Address, nil)
+// Client returns the wallet's node client. Wallets created from a URL
+// resolve it through Conn, dialing a websocket node on the first call that
+// needs it; a failed dial is retried by later calls after Conn's backoff
+func (w *Wallet) Client(ctx context.Context) (*ethclient.Client, error) {
+	if w.Conn != nil {
+		return w.Conn.Client(ctx)
+	}
+	if w.client == nil {
+		return nil, ErrNoClient
+	}
+	return w.client, nil
 }
 
-// GetNonce returns the current nonce for the wallet
-func (w *Wallet) GetNonce(ctx context.Context) (uint64, error) {
-	return w.Client.PendingNonceAt(ctx, w.Address)
+// ErrNoClient is returned by Client for a wallet with neither a client nor
+// a Conn
+var ErrNoClient = errors.New("wallet: no node client")
+
+// Close closes the connection the wallet dialed, and with it every token
+// binding and subscription sharing its client. Wallets created with
+// NewWalletFromClient leave the client to its owner
+func (w *Wallet) Close() error {
+	if w.Conn == nil {
+		return nil
+	}
+	return w.Conn.Close()
 }
 
-// Transfer sends ETH to another address
-func (w *Wallet) Transfer(ctx context.Context, to common.Address, amount *big.Int) (*types.Transaction, error) {
-	nonce, err := w.GetNonce(ctx)
-	if err != nil {
-		return nil, err
+// NewWalletFromClient creates a wallet using an already connected client,
+// such as one replaying a recorded session
+func NewWalletFromClient(privateKey *ecdsa.PrivateKey, client *ethclient.Client) *Wallet {
+	return &Wallet{
+		PrivateKey: privateKey,
+		PublicKey:  &privateKey.PublicKey,
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		client:     client,
+		TxManager:  txmgr.New(client),
 	}
+}
 
-	gasLimit := uint64(21000) // Standard ETH transfer
-	gasPrice, err := w.Client.SuggestGasPrice(ctx)
+// GetBalance returns the ETH balance of the wallet
+func (w *Wallet) GetBalance(ctx context.Context) (units.Wei, error) {
+	client, err := w.Client(ctx)
 	if err != nil {
-		return nil, err
+		return units.Wei{}, err
 	}
-
-	chainID, err := w.Client.NetworkID(ctx)
+	balance, err := client.BalanceAt(ctx, w.Address, nil)
 	if err != nil {
-		return nil, err
+		return units.Wei{}, err
 	}
+	return units.NewWei(balance), nil
+}
 
-	tx := types.NewTransaction(nonce, to, amount, gasLimit, gasPrice, nil)
-
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), w.PrivateKey)
+// GetNonce returns the current nonce for the wallet
+func (w *Wallet) GetNonce(ctx context.Context) (uint64, error) {
+	client, err := w.Client(ctx)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return client.PendingNonceAt(ctx, w.Address)
+}
+
+// Transfer sends ETH to another address as an EIP-1559 transaction, or a
+// legacy one on chains without a base fee
+func (w *Wallet) Transfer(ctx context.Context, to common.Address, amount units.Wei) (*types.Transaction, error) {
+	return w.SendTx(ctx, to, amount, nil)
+}
 
-	err = w.Client.SendTransaction(ctx, signedTx)
+// TransferWithOpts sends ETH with the gas limit, fees or nonce overridden
+func (w *Wallet) TransferWithOpts(ctx context.Context, to common.Address, amount units.Wei, opts *TxOpts) (*types.Transaction, error) {
+	return w.SendTx(ctx, to, amount, opts)
+}
+
+// SignTransfer builds and signs an ETH transfer without broadcasting it
+func (w *Wallet) SignTransfer(ctx context.Context, to common.Address, amount units.Wei) (*types.Transaction, error) {
+	tx, err := w.BuildTx(ctx, to, amount, nil)
 	if err != nil {
 		return nil, err
 	}
+	return w.SignTx(ctx, tx)
+}
 
-	return signedTx, nil
+// Sweep transfers the entire ETH balance minus the transfer fee to another address
+func (w *Wallet) Sweep(ctx context.Context, to common.Address) (*types.Transaction, error) {
+	return w.SendMax(ctx, to)
 }
 
-// SignMessage signs a message with the wallet's private key
+// SignMessage signs keccak256(message) with the wallet's private key. The
+// hash has no EIP-191 prefix, so only VerifySignature accepts it; use
+// SignPersonalMessage for signatures other wallets and contracts verify
 func (w *Wallet) SignMessage(message []byte) ([]byte, error) {
 	hash := crypto.Keccak256Hash(message)
 	signature, err := crypto.Sign(hash.Bytes(), w.PrivateKey)
@@ -106,31 +222,64 @@ func (w *Wallet) SignMessage(message []byte) ([]byte, error) {
 	return signature, nil
 }
 
-// VerifySignature verifies a message signature
-func VerifySignature(message []byte, signature []byte, address common.Address) bool {
-	hash := crypto.Keccak256Hash(message)
-
-	// Ensure signature has correct length (65 bytes including recovery ID)
-	if len(signature) != 65 {
-		return false
-	}
-
-	// Recover public key from signature (requires full 65-byte signature)
-	publicKey, err := crypto.SigToPub(hash.Bytes(), signature)
-	if err != nil {
-		return false
+// SignHash signs a precomputed 32-byte digest with the wallet's private key
+func (w *Wallet) SignHash(hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.New("hash must be 32 bytes")
 	}
+	return crypto.Sign(hash, w.PrivateKey)
+}
 
-	recoveredAddr := crypto.PubkeyToAddress(*publicKey)
-	return recoveredAddr == address
+// VerifySignature verifies a SignMessage signature over keccak256(message);
+// recovery ids 0/1 and 27/28 are both accepted
+func VerifySignature(message []byte, signature []byte, address common.Address) bool {
+	signer, err := RecoverSigner(crypto.Keccak256(message), signature)
+	return err == nil && signer == address
 }
 
-// GetPrivateKeyHex returns the private key as hex string
+// GetPrivateKeyHex returns the private key as hex string; use ExportKeystore
+// or SaveKeystore to persist keys
 func (w *Wallet) GetPrivateKeyHex() string {
 	return "0x" + common.Bytes2Hex(crypto.FromECDSA(w.PrivateKey))
 }
 
-// WaitForTransaction waits for a transaction to be mined
+// WaitForTransaction waits for a transaction to be mined with the tx
+// manager's confirmations, or one; bound the wait with ctx
 func (w *Wallet) WaitForTransaction(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
-	return w.Client.TransactionReceipt(ctx, txHash)
+	cfg := txmgr.DefaultConfig()
+	if m := w.Settings().TxManager; m != nil {
+		cfg = m.Config
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return txmgr.WaitMined(ctx, client, txHash, cfg.Confirmations, cfg.PollInterval)
+}
+
+// WaitConfirmed waits until a transaction meets a confirmation requirement,
+// such as one chosen by a confirm.Policy for its value
+func (w *Wallet) WaitConfirmed(ctx context.Context, txHash common.Hash, req confirm.Requirement) (*types.Receipt, error) {
+	cfg := txmgr.DefaultConfig()
+	var clk clock.Clock
+	if m := w.Settings().TxManager; m != nil {
+		cfg, clk = m.Config, m.Clock
+	}
+	client, err := w.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return confirm.Wait(ctx, client, txHash, req, clk, cfg.PollInterval)
+}
+
+// WaitMined waits for a transaction sent by the wallet, speeding it up with
+// bumped fees if it gets stuck
+func (w *Wallet) WaitMined(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	s := w.Settings()
+	if s.TxManager == nil {
+		return w.WaitForTransaction(ctx, tx.Hash())
+	}
+	return s.TxManager.Wait(ctx, w.Address, tx, func(tx *types.Transaction) (*types.Transaction, error) {
+		return w.signTx(ctx, s, tx)
+	})
 }
@@ -0,0 +1,73 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/whisperchain/go-examples/conn"
+	"github.com/whisperchain/go-examples/reqctx"
+	"github.com/whisperchain/go-examples/txmgr"
+	"github.com/whisperchain/go-examples/units"
+)
+
+func TestNewWalletFromPrivateKeyDialsOnFirstUse(t *testing.T) {
+	// A port with nothing listening: the constructor must not notice
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ws://" + l.Addr().String()
+	l.Close()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWalletFromPrivateKey(key, url)
+	if err != nil {
+		t.Fatalf("constructor contacted the node: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := w.GetNonce(ctx); err == nil {
+		t.Fatal("nonce read from a node that is down")
+	}
+	// The failed dial backs off rather than redialing at once
+	if _, err := w.Client(ctx); !errors.Is(err, conn.ErrBackoff) {
+		t.Fatalf("second dial: got %v, want backoff", err)
+	}
+
+	w.Close()
+	if _, err := w.GetBalance(ctx); !errors.Is(err, conn.ErrClosed) {
+		t.Fatalf("after close: got %v", err)
+	}
+}
+
+func TestIdempotencyKeyBindsRequest(t *testing.T) {
+	w, node := newSimulated(t)
+	w.SetGasStrategy(fixedGwei(10))
+	ctx := reqctx.WithIdempotencyKey(context.Background(), "payout-7")
+	to := common.HexToAddress("0x000000000000000000000000000000000000beef")
+
+	first, err := w.Transfer(ctx, to, units.WeiFromUint64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := w.Transfer(ctx, to, units.WeiFromUint64(100))
+	if err != nil || again.Hash() != first.Hash() {
+		t.Fatalf("retry: got %v, %v; want the first transaction", again, err)
+	}
+	if _, err := w.Transfer(ctx, to, units.WeiFromUint64(999)); !errors.Is(err, txmgr.ErrKeyReused) {
+		t.Fatalf("other amount under the same key: got %v", err)
+	}
+	other := common.HexToAddress("0x000000000000000000000000000000000000cafe")
+	if _, err := w.Transfer(ctx, other, units.WeiFromUint64(100)); !errors.Is(err, txmgr.ErrKeyReused) {
+		t.Fatalf("other recipient under the same key: got %v", err)
+	}
+	if len(node.txs) != 1 {
+		t.Fatalf("node got %d transactions", len(node.txs))
+	}
+}
@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/whisperchain/go-examples/contract"
+)
+
+// Transfers streams the token's Transfer events from block from; nil or empty
+// from and to lists match any address. Events undone by a reorg are sent again
+// with Raw.Removed set
+func (w *Watcher) Transfers(ctx context.Context, token *contract.ERC20, from uint64, senders, recipients []common.Address) <-chan *contract.TransferEvent {
+	out := make(chan *contract.TransferEvent)
+	logs := w.Logs(ctx, eventQuery(token.Address, contract.TransferTopic, senders, recipients), from)
+	go func() {
+		defer close(out)
+		for l := range logs {
+			ev, err := token.ParseTransfer(l)
+			if err != nil {
+				w.report(err)
+				continue
+			}
+			if send(ctx, out, ev) != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Approvals streams the token's Approval events from block from; nil or empty
+// owner and spender lists match any address
+func (w *Watcher) Approvals(ctx context.Context, token *contract.ERC20, from uint64, owners, spenders []common.Address) <-chan *contract.ApprovalEvent {
+	out := make(chan *contract.ApprovalEvent)
+	logs := w.Logs(ctx, eventQuery(token.Address, contract.ApprovalTopic, owners, spenders), from)
+	go func() {
+		defer close(out)
+		for l := range logs {
+			ev, err := token.ParseApproval(l)
+			if err != nil {
+				w.report(err)
+				continue
+			}
+			if send(ctx, out, ev) != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func eventQuery(address common.Address, topic common.Hash, first, second []common.Address) ethereum.FilterQuery {
+	return ethereum.FilterQuery{
+		Addresses: []common.Address{address},
+		Topics:    [][]common.Hash{{topic}, addressTopics(first), addressTopics(second)},
+	}
+}
+
+func addressTopics(addrs []common.Address) []common.Hash {
+	if len(addrs) == 0 {
+		return nil
+	}
+	topics := make([]common.Hash, len(addrs))
+	for i, a := range addrs {
+		topics[i] = common.BytesToHash(a.Bytes())
+	}
+	return topics
+}
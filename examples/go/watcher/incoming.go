@@ -0,0 +1,165 @@
+package watcher
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/contract"
+	"github.com/whisperchain/go-examples/indexer"
+	"github.com/whisperchain/go-examples/units"
+)
+
+// Incoming streams ETH and ERC-20 transfers received by account from block
+// from. Tokens limits the contracts watched; empty watches every token. ETH is
+// found by scanning each block's transactions, so value moved by internal
+// calls is not seen. A transfer can be sent twice when its block is reorged
+// and included again; deduplicate on TxHash and LogIndex
+func (w *Watcher) Incoming(ctx context.Context, account common.Address, tokens []common.Address, from uint64) <-chan indexer.Transfer {
+	out := make(chan indexer.Transfer)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		w.incomingTokens(ctx, account, tokens, from, out)
+	}()
+	go func() {
+		defer wg.Done()
+		w.incomingNative(ctx, account, from, out)
+	}()
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+func (w *Watcher) incomingTokens(ctx context.Context, account common.Address, tokens []common.Address, from uint64, out chan<- indexer.Transfer) {
+	q := ethereum.FilterQuery{
+		Addresses: tokens,
+		Topics:    [][]common.Hash{{contract.TransferTopic}, nil, {common.BytesToHash(account.Bytes())}},
+	}
+	var (
+		client *ethclient.Client
+		header *types.Header
+		known  = make(map[common.Address]units.Token)
+	)
+	defer func() {
+		if client != nil {
+			w.release(client)
+		}
+	}()
+	for l := range w.Logs(ctx, q, from) {
+		// ERC-721 shares the event signature but indexes the token id
+		if l.Removed || len(l.Topics) != 3 || len(l.Data) != 32 {
+			continue
+		}
+		if header == nil || header.Hash() != l.BlockHash {
+			err := w.retry(ctx, &client, func(c *ethclient.Client) error {
+				h, err := c.HeaderByHash(ctx, l.BlockHash)
+				header = h
+				return err
+			})
+			if err != nil {
+				return
+			}
+		}
+		token, ok := known[l.Address]
+		if !ok {
+			// Tokens without readable metadata, which ERC-20 makes optional,
+			// are sent in base units and read again next time
+			token = units.Token{Address: l.Address}
+			err := w.retry(ctx, &client, func(c *ethclient.Client) error {
+				if t, err := contract.NewERC20(l.Address, c).Token(ctx); err == nil {
+					token, known[l.Address] = t, t
+				}
+				return nil
+			})
+			if err != nil {
+				return
+			}
+		}
+		t := indexer.Transfer{
+			Asset:       l.Address,
+			From:        common.BytesToAddress(l.Topics[1].Bytes()),
+			To:          account,
+			Amount:      units.NewTokenAmount(token, new(big.Int).SetBytes(l.Data)),
+			TxHash:      l.TxHash,
+			LogIndex:    l.Index,
+			BlockNumber: l.BlockNumber,
+			BlockHash:   l.BlockHash,
+			Timestamp:   header.Time,
+		}
+		if send(ctx, out, t) != nil {
+			return
+		}
+	}
+}
+
+func (w *Watcher) incomingNative(ctx context.Context, account common.Address, from uint64, out chan<- indexer.Transfer) {
+	var (
+		client *ethclient.Client
+		signer types.Signer
+	)
+	defer func() {
+		if client != nil {
+			w.release(client)
+		}
+	}()
+	for h := range w.Heads(ctx, from) {
+		var found []indexer.Transfer
+		err := w.retry(ctx, &client, func(c *ethclient.Client) error {
+			if signer == nil {
+				chainID, err := c.ChainID(ctx)
+				if err != nil {
+					return err
+				}
+				signer = types.LatestSignerForChainID(chainID)
+			}
+			block, err := c.BlockByHash(ctx, h.Hash())
+			if err != nil {
+				return err
+			}
+			found = found[:0]
+			for _, tx := range block.Transactions() {
+				if tx.To() == nil || *tx.To() != account || tx.Value().Sign() == 0 {
+					continue
+				}
+				rcpt, err := c.TransactionReceipt(ctx, tx.Hash())
+				if err != nil {
+					return err
+				}
+				if rcpt.Status != types.ReceiptStatusSuccessful {
+					continue
+				}
+				sender, err := types.Sender(signer, tx)
+				if err != nil {
+					return err
+				}
+				found = append(found, indexer.Transfer{
+					Asset:       indexer.NativeAsset,
+					From:        sender,
+					To:          account,
+					Amount:      units.NewWei(tx.Value()).Amount(),
+					TxHash:      tx.Hash(),
+					BlockNumber: block.NumberU64(),
+					BlockHash:   block.Hash(),
+					Timestamp:   block.Time(),
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		for _, t := range found {
+			if send(ctx, out, t) != nil {
+				return
+			}
+		}
+	}
+}
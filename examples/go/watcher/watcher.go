@@ -0,0 +1,332 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/clock"
+	"github.com/whisperchain/go-examples/conn"
+)
+
+// errSubscriptionClosed is reported when a subscription ends without an error
+var errSubscriptionClosed = errors.New("watcher: subscription closed")
+
+// Watcher streams chain activity from a WebSocket endpoint. Each stream holds
+// its own connection, reconnects with exponential backoff and backfills the
+// blocks it missed, so consumers see every head and log across disconnects.
+// With a Conn the streams share its client instead, and subscribe through it
+// so that closing the Conn ends them
+type Watcher struct {
+	URL        string
+	Conn       *conn.Conn                                           // optional, used instead of URL and Dial
+	Dial       func(ctx context.Context) (*ethclient.Client, error) // defaults to dialing URL
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	MaxRange   uint64      // blocks per eth_getLogs request when backfilling
+	OnError    func(error) // optional, called with every error before reconnecting
+	Clock      clock.Clock // paces backoff; nil is the wall clock
+}
+
+// New creates a watcher for a ws:// or wss:// endpoint
+func New(url string) *Watcher {
+	return &Watcher{URL: url, MinBackoff: time.Second, MaxBackoff: 30 * time.Second, MaxRange: 2000}
+}
+
+// NewConn creates a watcher whose streams share c
+func NewConn(c *conn.Conn) *Watcher {
+	w := New(c.URL)
+	w.Conn = c
+	return w
+}
+
+// Heads streams new headers starting at block from, or at the current head
+// when from is zero. Missed heights are fetched after reconnects and gaps;
+// after a reorg the replacement headers are sent again. The channel is closed
+// when ctx is done
+func (w *Watcher) Heads(ctx context.Context, from uint64) <-chan *types.Header {
+	out := make(chan *types.Header)
+	next := from
+	go func() {
+		defer close(out)
+		w.run(ctx, func(ctx context.Context, c *ethclient.Client) error {
+			heads := make(chan *types.Header, 64)
+			sub, err := w.subscribe(ctx, c, func(c *ethclient.Client) (ethereum.Subscription, error) {
+				return c.SubscribeNewHead(ctx, heads)
+			})
+			if err != nil {
+				return err
+			}
+			defer sub.Unsubscribe()
+
+			head, err := c.BlockNumber(ctx)
+			if err != nil {
+				return err
+			}
+			if next == 0 {
+				next = head
+			}
+			fill := func(to uint64) error {
+				for ; next <= to; next++ {
+					h, err := c.HeaderByNumber(ctx, new(big.Int).SetUint64(next))
+					if err != nil {
+						return err
+					}
+					if err := send(ctx, out, h); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if err := fill(head); err != nil {
+				return err
+			}
+
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case err := <-sub.Err():
+					return subErr(err)
+				case h := <-heads:
+					n := h.Number.Uint64()
+					if n >= next {
+						if err := fill(n - 1); err != nil {
+							return err
+						}
+					}
+					// n < next is a reorg replacing a delivered height
+					if err := send(ctx, out, h); err != nil {
+						return err
+					}
+					next = n + 1
+				}
+			}
+		})
+	}()
+	return out
+}
+
+// logPos orders logs by block and index; index -1 is before the block's first log
+type logPos struct {
+	block uint64
+	index int64
+}
+
+func (p logPos) after(q logPos) bool {
+	return p.block > q.block || (p.block == q.block && p.index > q.index)
+}
+
+// Logs streams logs matching q starting at block from, or at the next block
+// when from is zero. FromBlock and ToBlock of q are ignored. Logs removed by a
+// reorg are sent again with Removed set. The channel is closed when ctx is done
+func (w *Watcher) Logs(ctx context.Context, q ethereum.FilterQuery, from uint64) <-chan types.Log {
+	out := make(chan types.Log)
+	next := from
+	last := logPos{index: -1}
+	go func() {
+		defer close(out)
+		w.run(ctx, func(ctx context.Context, c *ethclient.Client) error {
+			deliver := func(l types.Log) error {
+				pos := logPos{l.BlockNumber, int64(l.Index)}
+				if l.Removed {
+					if !pos.after(last) {
+						last = logPos{l.BlockNumber, int64(l.Index) - 1}
+					}
+				} else {
+					if !pos.after(last) {
+						return nil // already sent before a reconnect
+					}
+					last = pos
+				}
+				if l.BlockNumber > next {
+					next = l.BlockNumber
+				}
+				return send(ctx, out, l)
+			}
+
+			// Subscribe before backfilling so nothing falls between the two
+			live := q
+			live.FromBlock, live.ToBlock = nil, nil
+			logs := make(chan types.Log, 256)
+			sub, err := w.subscribe(ctx, c, func(c *ethclient.Client) (ethereum.Subscription, error) {
+				return c.SubscribeFilterLogs(ctx, live, logs)
+			})
+			if err != nil {
+				return err
+			}
+			defer sub.Unsubscribe()
+
+			head, err := c.BlockNumber(ctx)
+			if err != nil {
+				return err
+			}
+			if next == 0 {
+				next = head + 1
+			}
+			step := w.MaxRange
+			if step == 0 {
+				step = 2000
+			}
+			for next <= head {
+				end := next + step - 1
+				if end > head {
+					end = head
+				}
+				page := q
+				page.FromBlock, page.ToBlock = new(big.Int).SetUint64(next), new(big.Int).SetUint64(end)
+				found, err := c.FilterLogs(ctx, page)
+				if err != nil {
+					return err
+				}
+				for _, l := range found {
+					if err := deliver(l); err != nil {
+						return err
+					}
+				}
+				next = end + 1
+			}
+
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case err := <-sub.Err():
+					return subErr(err)
+				case l := <-logs:
+					if err := deliver(l); err != nil {
+						return err
+					}
+				}
+			}
+		})
+	}()
+	return out
+}
+
+// run calls session with a fresh connection until ctx is done or the Conn
+// is closed, backing off between failures
+func (w *Watcher) run(ctx context.Context, session func(ctx context.Context, c *ethclient.Client) error) {
+	backoff := w.minBackoff()
+	for ctx.Err() == nil {
+		c, err := w.dial(ctx)
+		if err == nil {
+			start := clock.Or(w.Clock).Now()
+			err = session(ctx, c)
+			w.release(c)
+			if clock.Since(w.Clock, start) > w.maxBackoff() {
+				backoff = w.minBackoff()
+			}
+		}
+		if ctx.Err() != nil || errors.Is(err, conn.ErrClosed) {
+			return
+		}
+		w.report(err)
+		if clock.Sleep(ctx, w.Clock, backoff) != nil {
+			return
+		}
+		if backoff *= 2; backoff > w.maxBackoff() {
+			backoff = w.maxBackoff()
+		}
+	}
+}
+
+// retry runs fn with a lazily dialed client, redialing after failures until
+// fn succeeds, ctx is done or the Conn is closed
+func (w *Watcher) retry(ctx context.Context, client **ethclient.Client, fn func(c *ethclient.Client) error) error {
+	backoff := w.minBackoff()
+	for {
+		if *client == nil {
+			c, err := w.dial(ctx)
+			if err == nil {
+				*client = c
+			} else if ctx.Err() != nil {
+				return ctx.Err()
+			} else if errors.Is(err, conn.ErrClosed) {
+				return err
+			} else {
+				w.report(err)
+			}
+		}
+		if *client != nil {
+			err := fn(*client)
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+			w.report(err)
+			w.release(*client)
+			*client = nil
+		}
+		if err := clock.Sleep(ctx, w.Clock, backoff); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > w.maxBackoff() {
+			backoff = w.maxBackoff()
+		}
+	}
+}
+
+func (w *Watcher) dial(ctx context.Context) (*ethclient.Client, error) {
+	if w.Conn != nil {
+		return w.Conn.Client(ctx)
+	}
+	if w.Dial != nil {
+		return w.Dial(ctx)
+	}
+	return ethclient.DialContext(ctx, w.URL)
+}
+
+// release closes a client from dial unless the Conn owns it
+func (w *Watcher) release(c *ethclient.Client) {
+	if w.Conn == nil {
+		c.Close()
+	}
+}
+
+// subscribe starts a subscription on c, through the Conn when there is one
+func (w *Watcher) subscribe(ctx context.Context, c *ethclient.Client, start func(*ethclient.Client) (ethereum.Subscription, error)) (ethereum.Subscription, error) {
+	if w.Conn != nil {
+		return w.Conn.Subscribe(ctx, start)
+	}
+	return start(c)
+}
+
+func (w *Watcher) report(err error) {
+	if err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+func (w *Watcher) minBackoff() time.Duration {
+	if w.MinBackoff <= 0 {
+		return time.Second
+	}
+	return w.MinBackoff
+}
+
+func (w *Watcher) maxBackoff() time.Duration {
+	if w.MaxBackoff < w.minBackoff() {
+		return w.minBackoff()
+	}
+	return w.MaxBackoff
+}
+
+func send[T any](ctx context.Context, out chan<- T, v T) error {
+	select {
+	case out <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func subErr(err error) error {
+	if err == nil {
+		return errSubscriptionClosed
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package watcher
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/whisperchain/go-examples/conn"
+)
+
+// fakeHeads serves a chain stuck at one head and a newHeads subscription
+// that never fires
+type fakeHeads struct {
+	head uint64
+}
+
+func (f *fakeHeads) BlockNumber() hexutil.Uint64 { return hexutil.Uint64(f.head) }
+
+func (f *fakeHeads) GetBlockByNumber(number hexutil.Uint64, full bool) *types.Header {
+	return &types.Header{Number: new(big.Int).SetUint64(uint64(number)), Difficulty: new(big.Int)}
+}
+
+func (f *fakeHeads) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	return notifier.CreateSubscription(), nil
+}
+
+func TestConnCloseEndsStreams(t *testing.T) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", &fakeHeads{head: 5}); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	ws := httptest.NewServer(srv.WebsocketHandler([]string{"*"}))
+	defer ws.Close()
+
+	c := conn.New("ws" + strings.TrimPrefix(ws.URL, "http"))
+	w := NewConn(c)
+	w.MinBackoff = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	heads := w.Heads(ctx, 0)
+	select {
+	case h := <-heads:
+		if h.Number.Uint64() != 5 {
+			t.Fatalf("got head %d, want 5", h.Number)
+		}
+	case <-ctx.Done():
+		t.Fatal("no head")
+	}
+	if n := c.Subscriptions(); n != 1 {
+		t.Fatalf("%d subscriptions on the conn, want 1", n)
+	}
+
+	c.Close()
+	select {
+	case _, ok := <-heads:
+		if ok {
+			t.Fatal("head after close")
+		}
+	case <-ctx.Done():
+		t.Fatal("stream still open after the conn closed")
+	}
+	if n := c.Subscriptions(); n != 0 {
+		t.Fatalf("%d subscriptions left after close", n)
+	}
+}
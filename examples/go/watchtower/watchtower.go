@@ -0,0 +1,248 @@
+package watchtower
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/whisperchain/go-examples/alert"
+	"github.com/whisperchain/go-examples/audit"
+	"github.com/whisperchain/go-examples/scheduler"
+	"github.com/whisperchain/go-examples/storage"
+	"github.com/whisperchain/go-examples/wallet"
+)
+
+// Store key prefixes
+const (
+	signedPrefix  = "watchtower/signed/"  // <address>/<nonce>/<hash>
+	checkedPrefix = "watchtower/checked/" // <address> -> next nonce to check
+	flaggedPrefix = "watchtower/flagged/" // <address>/<nonce>
+)
+
+// Finding is a nonce consumed by a transaction this instance did not sign
+type Finding struct {
+	Address common.Address `json:"address"`
+	Nonce   uint64         `json:"nonce"`
+	Pending bool           `json:"pending"` // seen in the node's mempool, not yet mined
+}
+
+// Watchtower journals every transaction this process signs for its managed
+// addresses and raises a critical alert when the chain shows a nonce being
+// used that is not in the journal, which indicates the key is being used
+// elsewhere
+type Watchtower struct {
+	Client *ethclient.Client
+	Store  storage.Store
+	Alerts alert.Notifier
+	Audit  audit.Log
+
+	mu        sync.Mutex
+	addresses []common.Address
+}
+
+// New creates a watchtower with no managed addresses
+func New(client *ethclient.Client, store storage.Store, alerts alert.Notifier, auditLog audit.Log) *Watchtower {
+	if alerts == nil {
+		alerts = alert.Discard
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	return &Watchtower{Client: client, Store: store, Alerts: alerts, Audit: auditLog}
+}
+
+// Manage installs the watchtower as the wallet's sign hook and starts
+// watching its address. Transactions signed with the wallet's key that bypass
+// the wallet must be passed to Record
+func (wt *Watchtower) Manage(w *wallet.Wallet) {
+	w.SetOnSign(func(tx *types.Transaction) error {
+		return wt.Record(context.Background(), w.Address, tx)
+	})
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	for _, a := range wt.addresses {
+		if a == w.Address {
+			return
+		}
+	}
+	wt.addresses = append(wt.addresses, w.Address)
+}
+
+// Record journals a transaction signed by this process
+func (wt *Watchtower) Record(ctx context.Context, from common.Address, tx *types.Transaction) error {
+	key := signedPrefix + from.Hex() + "/" + nonceKey(tx.Nonce()) + "/" + tx.Hash().Hex()
+	if err := wt.Store.Put(ctx, key, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return err
+	}
+	return wt.Audit.Record(ctx, audit.Entry{
+		Actor:   from.Hex(),
+		Action:  "tx-signed",
+		Subject: tx.Hash().Hex(),
+		Outcome: "signed",
+		Details: map[string]string{"nonce": strconv.FormatUint(tx.Nonce(), 10)},
+	})
+}
+
+// Check compares each managed address's mined and pending nonces with the
+// journal. Nonces used before an address was first checked are not flagged
+func (wt *Watchtower) Check(ctx context.Context) ([]Finding, error) {
+	wt.mu.Lock()
+	addresses := append([]common.Address(nil), wt.addresses...)
+	wt.mu.Unlock()
+
+	var findings []Finding
+	for _, addr := range addresses {
+		found, err := wt.check(ctx, addr)
+		if err != nil {
+			return findings, fmt.Errorf("%s: %w", addr.Hex(), err)
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+func (wt *Watchtower) check(ctx context.Context, addr common.Address) ([]Finding, error) {
+	mined, err := wt.Client.NonceAt(ctx, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := wt.Client.PendingNonceAt(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := wt.checked(ctx, addr)
+	if errors.Is(err, storage.ErrNotFound) {
+		// First run: the current nonce is the baseline
+		return nil, wt.Store.Put(ctx, checkedPrefix+addr.Hex(), []byte(strconv.FormatUint(mined, 10)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for n := next; n < pending; n++ {
+		known, err := wt.journaled(ctx, addr, n)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			continue
+		}
+		f := Finding{Address: addr, Nonce: n, Pending: n >= mined}
+		// A pending nonce is re-checked once mined, but alerted only once
+		if err := wt.flag(ctx, f); err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	if mined > next {
+		if err := wt.Store.Put(ctx, checkedPrefix+addr.Hex(), []byte(strconv.FormatUint(mined, 10))); err != nil {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
+
+// Schedule registers periodic checks with a scheduler
+func (wt *Watchtower) Schedule(s *scheduler.Scheduler, interval time.Duration) error {
+	return s.Every("watchtower", interval, func(ctx context.Context) error {
+		_, err := wt.Check(ctx)
+		return err
+	})
+}
+
+// SignedTx is a journaled transaction
+type SignedTx struct {
+	Nonce uint64      `json:"nonce"`
+	Hash  common.Hash `json:"hash"`
+}
+
+// Signed returns the journaled transactions of addr with nonces from from
+// upward, in nonce order
+func (wt *Watchtower) Signed(ctx context.Context, addr common.Address, from uint64) ([]SignedTx, error) {
+	prefix := signedPrefix + addr.Hex() + "/"
+	keys, err := wt.Store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var out []SignedTx
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimPrefix(key, prefix), "/")
+		if len(parts) != 2 {
+			continue
+		}
+		nonce, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil || nonce < from {
+			continue
+		}
+		out = append(out, SignedTx{Nonce: nonce, Hash: common.HexToHash(parts[1])})
+	}
+	return out, nil
+}
+
+func (wt *Watchtower) checked(ctx context.Context, addr common.Address) (uint64, error) {
+	data, err := wt.Store.Get(ctx, checkedPrefix+addr.Hex())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(data), 10, 64)
+}
+
+func (wt *Watchtower) journaled(ctx context.Context, addr common.Address, nonce uint64) (bool, error) {
+	keys, err := wt.Store.List(ctx, signedPrefix+addr.Hex()+"/"+nonceKey(nonce)+"/")
+	if err != nil {
+		return false, err
+	}
+	return len(keys) > 0, nil
+}
+
+func (wt *Watchtower) flag(ctx context.Context, f Finding) error {
+	key := flaggedPrefix + f.Address.Hex() + "/" + nonceKey(f.Nonce)
+	if _, err := wt.Store.Get(ctx, key); err == nil {
+		return nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := wt.Store.Put(ctx, key, data); err != nil {
+		return err
+	}
+
+	state := "mined"
+	if f.Pending {
+		state = "pending"
+	}
+	wt.Audit.Record(ctx, audit.Entry{
+		Actor:   "watchtower",
+		Action:  "unknown-transaction",
+		Subject: f.Address.Hex(),
+		Outcome: state,
+		Details: map[string]string{"nonce": strconv.FormatUint(f.Nonce, 10)},
+	})
+	return wt.Alerts.Notify(ctx, alert.Alert{
+		Severity: alert.Critical,
+		Source:   "watchtower",
+		Title:    "transaction not signed by this instance",
+		Message: fmt.Sprintf("nonce %d of %s was used by a %s transaction missing from the local journal; the key may be compromised",
+			f.Nonce, f.Address.Hex(), state),
+		Key:    "watchtower/" + f.Address.Hex() + "/" + nonceKey(f.Nonce),
+		Labels: map[string]string{"address": f.Address.Hex(), "nonce": strconv.FormatUint(f.Nonce, 10)},
+	})
+}
+
+// nonceKey zero-pads nonces so store keys sort numerically
+func nonceKey(n uint64) string {
+	return fmt.Sprintf("%020d", n)
+}